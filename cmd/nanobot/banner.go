@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/buildinfo"
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/gateway"
+	"github.com/HKUDS/nanobot-go/pkg/providers"
+)
+
+// sendStartupBanner sends a self-check summary to the owner chat, if
+// configured, so operators see that a restart succeeded without reading
+// logs. server is nil when the gateway is not running.
+func sendStartupBanner(rt *runtime, server *gateway.Server) {
+	startup := rt.Config.Startup
+	if !startup.Banner || startup.Channel == "" || startup.To == "" {
+		return
+	}
+	banner := startupBanner(rt, server)
+	log.Printf("Startup banner sent to %s:%s", startup.Channel, startup.To)
+	rt.Bus.PublishOutbound(bus.OutboundMessage{
+		Channel: startup.Channel,
+		ChatID:  startup.To,
+		Type:    bus.MessageTypeText,
+		Content: banner,
+	})
+}
+
+// startupBanner describes the running agent: version, model, channels,
+// scheduled jobs and any subsystem that did not come up as configured.
+func startupBanner(rt *runtime, server *gateway.Server) string {
+	cfg := rt.Config
+	var degraded []string
+
+	host, _ := os.Hostname()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "nanobot %s started on %s", buildinfo.String(), host)
+	if rt.Config.Tools.ReadOnly {
+		sb.WriteString(" (read-only)")
+	}
+
+	provider := providers.SelectedProvider(cfg)
+	if provider == "" {
+		provider = "unknown provider"
+	}
+	fmt.Fprintf(&sb, "\nModel: %s via %s", cfg.Agents.Defaults.Model, provider)
+
+	var channelNames []string
+	for _, s := range rt.Channels.Snapshot() {
+		switch {
+		case !s.Enabled:
+			continue
+		case s.Connected:
+			channelNames = append(channelNames, s.Name)
+		default:
+			reason := "not connected"
+			if n := len(s.RecentErrors); n > 0 {
+				reason = s.RecentErrors[n-1].Message
+			}
+			degraded = append(degraded, fmt.Sprintf("channel %s: %s", s.Name, reason))
+		}
+	}
+	if server != nil {
+		channelNames = append(channelNames, "gateway on "+server.Addr())
+	}
+	if len(channelNames) == 0 {
+		channelNames = append(channelNames, "none")
+	}
+	fmt.Fprintf(&sb, "\nChannels: %s", strings.Join(channelNames, ", "))
+
+	enabled, next := 0, int64(0)
+	for _, job := range rt.Cron.ListJobs() {
+		if !job.Enabled {
+			continue
+		}
+		enabled++
+		if at := job.State.NextRunAtMs; at > 0 && (next == 0 || at < next) {
+			next = at
+		}
+	}
+	fmt.Fprintf(&sb, "\nCron: %d job(s) scheduled", enabled)
+	if next > 0 {
+		fmt.Fprintf(&sb, ", next at %s", time.UnixMilli(next).Format("2006-01-02 15:04"))
+	}
+
+	if cfg.Moderation.Enabled && rt.Loop.Moderator == nil {
+		degraded = append(degraded, "moderation: failed to start, see logs")
+	}
+	if cfg.Translation.Enabled && rt.Loop.Translator == nil {
+		degraded = append(degraded, "translation: failed to start, see logs")
+	}
+	if err := checkWritable(rt.Workspace); err != nil {
+		degraded = append(degraded, "workspace: "+err.Error())
+	}
+
+	if len(degraded) == 0 {
+		sb.WriteString("\nAll systems OK.")
+	} else {
+		sb.WriteString("\nDegraded:")
+		for _, d := range degraded {
+			sb.WriteString("\n- " + d)
+		}
+	}
+	return sb.String()
+}
+
+// checkWritable reports whether files can be created in dir.
+func checkWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".selfcheck-*")
+	if err != nil {
+		return fmt.Errorf("not writable: %w", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/channels"
+	"github.com/HKUDS/nanobot-go/pkg/tools"
+)
+
+// channelStatusFile is the workspace file the running agent writes channel health to.
+const channelStatusFile = "channels_status.json"
+
+func runChannels(args []string) {
+	if len(args) > 0 && args[0] == "status" {
+		args = args[1:]
+	}
+	fs := flag.NewFlagSet("channels", flag.ExitOnError)
+	configPath := fs.String("c", "", "Path to config file")
+	fs.Parse(args)
+
+	_, workspace := loadWorkspace(*configPath)
+	path := filepath.Join(workspace, channelStatusFile)
+	report, err := channels.LoadStatusReport(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Println("No channel status found. Start 'nanobot gateway' or 'nanobot agent' first.")
+		} else {
+			fmt.Printf("Error reading channel status: %v\n", err)
+		}
+		os.Exit(1)
+	}
+
+	now := time.Now()
+	fmt.Printf("Reported by pid %d at %s (%s ago)\n\n", report.PID, report.UpdatedAt.Format("2006-01-02 15:04:05"), now.Sub(report.UpdatedAt).Round(time.Second))
+	for _, s := range report.Channels {
+		fmt.Println(tools.FormatChannelStatus(s, now))
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/HKUDS/nanobot-go/pkg/buildinfo"
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+)
+
+// chatHistoryDefault is how many messages /history shows without an argument.
+const chatHistoryDefault = 20
+
+const chatHelp = `Commands:
+  /new            Start a new conversation (/restore brings the last one back)
+  /history [n]    Show the last n messages (default 20)
+  /model [name]   Show or switch the model
+  /exit           Quit (or Ctrl+D)
+End a line with \ to continue on the next one, or put """ on a line of
+its own to start and end a multi-line message. Other /commands, such as
+/verbosity, go to the agent.`
+
+// chatREPL is an interactive chat with the agent over the cli channel.
+type chatREPL struct {
+	rt     *runtime
+	chatID string
+	in     *bufio.Reader
+
+	mu      sync.Mutex    // serializes output
+	waiting bool          // a message was sent and its reply has not arrived
+	replied chan struct{} // signaled when a reply has been printed
+}
+
+func runChat(args []string) {
+	fs := flag.NewFlagSet("chat", flag.ExitOnError)
+	configPath := fs.String("c", "", "Path to config file")
+	sessionName := fs.String("s", "direct", "Session to continue")
+	flags := addRuntimeFlags(fs)
+	fs.Parse(args)
+
+	rt := startRuntime(*configPath, flags)
+	go func() {
+		waitForShutdown(rt, nil)
+		os.Exit(0)
+	}()
+
+	r := &chatREPL{
+		rt:      rt,
+		chatID:  *sessionName,
+		in:      bufio.NewReader(os.Stdin),
+		replied: make(chan struct{}, 1),
+	}
+	rt.Bus.SubscribeOutbound("cli", r.print)
+
+	fmt.Printf("nanobot %s, model %s, session cli:%s. Type /help for commands.\n", buildinfo.Version, rt.Loop.Model, r.chatID)
+	r.run()
+	fmt.Println("Shutting down...")
+	shutdownRuntime(rt, nil)
+}
+
+// run reads messages until /exit or end of input.
+func (r *chatREPL) run() {
+	for {
+		r.prompt("You: ")
+		input, err := r.readInput()
+		if err != nil {
+			if err != io.EOF {
+				fmt.Printf("Error reading input: %v\n", err)
+			}
+			fmt.Println()
+			return
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		if done := r.command(input); done {
+			return
+		}
+	}
+}
+
+// command runs a REPL command, or sends input to the agent and waits for
+// its reply. It reports whether the REPL should exit.
+func (r *chatREPL) command(input string) bool {
+	fields := strings.Fields(input)
+	switch strings.ToLower(fields[0]) {
+	case "/exit", "/quit":
+		return true
+	case "/help":
+		fmt.Println(chatHelp)
+	case "/new":
+		key := "cli:" + r.chatID
+		if _, err := r.rt.Loop.Sessions.Archive(key); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Error archiving session: %v\n", err)
+		} else {
+			fmt.Println("Started a new conversation.")
+		}
+	case "/history":
+		n := chatHistoryDefault
+		if len(fields) > 1 {
+			v, err := strconv.Atoi(fields[1])
+			if err != nil || v <= 0 {
+				fmt.Println("Usage: /history [n]")
+				return false
+			}
+			n = v
+		}
+		r.history(n)
+	case "/model":
+		r.model(fields[1:])
+	default:
+		r.send(input)
+	}
+	return false
+}
+
+// send publishes input on the cli channel and waits for the first reply.
+// Later messages, such as subagent results, are printed when they arrive.
+func (r *chatREPL) send(input string) {
+	select {
+	case <-r.replied:
+	default:
+	}
+	r.mu.Lock()
+	r.waiting = true
+	r.mu.Unlock()
+	r.rt.Bus.PublishInbound(bus.InboundMessage{
+		Channel:  "cli",
+		SenderID: "user",
+		ChatID:   r.chatID,
+		Content:  input,
+	})
+	<-r.replied
+}
+
+// print writes an outbound message, streaming it as it arrives.
+func (r *chatREPL) print(msg bus.OutboundMessage) {
+	if msg.ChatID != r.chatID {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.waiting {
+		// Not a reply to the pending message: start below the prompt
+		fmt.Println()
+	}
+	fmt.Print("nanobot: ")
+	if msg.Stream != nil {
+		for chunk := range msg.Stream {
+			fmt.Print(chunk)
+		}
+		fmt.Println()
+	} else {
+		fmt.Println(msg.Content)
+	}
+	if msg.Media != "" {
+		fmt.Printf("[%s: %s]\n", msg.Type, msg.Media)
+	}
+	if r.waiting {
+		r.waiting = false
+		r.replied <- struct{}{}
+	} else {
+		fmt.Print("You: ")
+	}
+}
+
+func (r *chatREPL) prompt(p string) {
+	r.mu.Lock()
+	fmt.Print(p)
+	r.mu.Unlock()
+}
+
+// readInput reads one message: a line, lines joined while they end in a
+// backslash, or the lines between two lines of """.
+func (r *chatREPL) readInput() (string, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(line) == `"""` {
+		var lines []string
+		for {
+			r.prompt("... ")
+			line, err := r.readLine()
+			if err != nil || strings.TrimSpace(line) == `"""` {
+				return strings.Join(lines, "\n"), nil
+			}
+			lines = append(lines, line)
+		}
+	}
+	var lines []string
+	for strings.HasSuffix(line, `\`) {
+		lines = append(lines, strings.TrimSuffix(line, `\`))
+		r.prompt("... ")
+		if line, err = r.readLine(); err != nil {
+			line = ""
+			break
+		}
+	}
+	return strings.Join(append(lines, line), "\n"), nil
+}
+
+func (r *chatREPL) readLine() (string, error) {
+	line, err := r.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// history prints the last n user and assistant messages of the session.
+func (r *chatREPL) history(n int) {
+	sess := r.rt.Loop.Sessions.GetOrCreate("cli:" + r.chatID)
+	var shown []map[string]interface{}
+	for _, m := range sess.Messages {
+		if role, _ := m["role"].(string); role == "user" || role == "assistant" {
+			if content, _ := m["content"].(string); content != "" {
+				shown = append(shown, m)
+			}
+		}
+	}
+	if len(shown) == 0 {
+		fmt.Println("No messages in this session yet.")
+		return
+	}
+	if len(shown) > n {
+		shown = shown[len(shown)-n:]
+	}
+	for _, m := range shown {
+		name := "You"
+		if m["role"] == "assistant" {
+			name = "nanobot"
+		}
+		ts, _ := m["timestamp"].(string)
+		if len(ts) >= len("2006-01-02T15:04") {
+			ts = strings.Replace(ts[:len("2006-01-02T15:04")], "T", " ", 1) + " "
+		}
+		fmt.Printf("%s%s: %s\n", ts, name, m["content"])
+	}
+}
+
+// model shows the model in use, or switches to the named model or alias
+// for the rest of the REPL.
+func (r *chatREPL) model(args []string) {
+	if len(args) == 0 {
+		fmt.Printf("Model: %s\n", r.rt.Loop.Model)
+		if aliases := r.rt.Config.Models; len(aliases) > 0 {
+			names := make([]string, 0, len(aliases))
+			for alias, target := range aliases {
+				names = append(names, fmt.Sprintf("%s (%s)", alias, target))
+			}
+			sort.Strings(names)
+			fmt.Printf("Aliases: %s\n", strings.Join(names, ", "))
+		}
+		return
+	}
+	r.rt.Loop.Model = args[0]
+	fmt.Printf("Switched to %s.\n", args[0])
+}
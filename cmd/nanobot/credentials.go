@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/HKUDS/nanobot-go/pkg/config"
+	"github.com/HKUDS/nanobot-go/pkg/providers"
+)
+
+// reloadCredentials re-reads the config file and applies the provider API
+// key and base to the running provider.
+func reloadCredentials(configPath string, provider providers.LLMProvider) error {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := providers.UpdateCredentials(provider, cfg); err != nil {
+		return err
+	}
+	log.Printf("Provider credentials reloaded")
+	return nil
+}
+
+// watchReloadSignal calls reload whenever the process receives SIGHUP.
+func watchReloadSignal(reload func() error) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		for range sig {
+			if err := reload(); err != nil {
+				log.Printf("Failed to reload provider credentials: %v", err)
+			}
+		}
+	}()
+}
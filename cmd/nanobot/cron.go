@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/cron"
+)
+
+// cronRunWait is how long `nanobot cron run` waits for a running gateway
+// or agent to pick the job up.
+const cronRunWait = 15 * time.Second
+
+func runCron(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: nanobot cron <list|add|remove|run> [-c config] [flags] [job ids...]")
+		os.Exit(1)
+	}
+
+	action := args[0]
+	fs := flag.NewFlagSet("cron", flag.ExitOnError)
+	configPath := fs.String("c", "", "Path to config file")
+	asJSON := fs.Bool("json", false, "Print jobs as JSON (list)")
+	name := fs.String("name", "", "Job name (add, default the message, command or URL)")
+	kind := fs.String("kind", cron.PayloadAgentTurn, "What the job does: agent_turn, message, shell or webhook (add)")
+	message := fs.String("message", "", "Reminder message or task instruction (add)")
+	command := fs.String("command", "", "Shell command (add, kind shell)")
+	url := fs.String("url", "", "URL to POST to (add, kind webhook)")
+	every := fs.Duration("every", 0, "Run every interval, e.g. 30m (add)")
+	expr := fs.String("cron", "", "Cron expression, e.g. '0 9 * * 1-5' (add)")
+	tz := fs.String("tz", "", "Time zone of the cron expression, e.g. Europe/Berlin (add)")
+	at := fs.String("at", "", "Run once at this time, as RFC 3339 or '2006-01-02 15:04' local time (add)")
+	in := fs.Duration("in", 0, "Run once after this long, e.g. 2h (add)")
+	keep := fs.Bool("keep", false, "Keep a one-time job after it ran, disabled (add)")
+	channel := fs.String("channel", "", "Channel to deliver to, e.g. telegram (add)")
+	to := fs.String("to", "", "Chat ID to deliver to (add)")
+	deliver := fs.Bool("deliver", true, "Send the output to the chat (add, kind shell)")
+	fs.Parse(args[1:])
+
+	_, workspace := loadWorkspace(*configPath)
+	service := cron.NewService(filepath.Join(workspace, "cron.json"), nil)
+	if action != "list" && service.Frozen() {
+		fmt.Println("Error: the cron store could not be read or upgraded, so it cannot be changed. See the log for details.")
+		os.Exit(1)
+	}
+
+	switch action {
+	case "list":
+		jobs := service.ListJobs()
+		if *asJSON {
+			if jobs == nil {
+				jobs = []cron.CronJob{}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(map[string]interface{}{"jobs": jobs})
+			return
+		}
+		if len(jobs) == 0 {
+			fmt.Println("No scheduled jobs.")
+			return
+		}
+		fmt.Printf("%-10s %-30s %-12s %-17s %s\n", "ID", "NAME", "KIND", "NEXT RUN", "SCHEDULE")
+		for _, j := range jobs {
+			next := "-"
+			switch {
+			case !j.Enabled:
+				next = "disabled"
+			case j.State.NextRunAtMs > 0:
+				next = time.UnixMilli(j.State.NextRunAtMs).In(j.Schedule.Location()).Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%-10s %-30s %-12s %-17s %s\n", j.ID, truncateName(j.Name, 30), j.Payload.Kind, next, cron.Describe(j.Schedule))
+			if j.State.LastStatus == "error" {
+				fmt.Printf("%-10s last run failed: %s\n", "", j.State.LastError)
+			}
+		}
+
+	case "add":
+		schedule, deleteAfterRun, err := cronSchedule(*every, *expr, *tz, *at, *in)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *keep {
+			deleteAfterRun = false
+		}
+		payload := cron.CronPayload{
+			Kind:    *kind,
+			Message: *message,
+			Deliver: *deliver,
+			Channel: *channel,
+			To:      *to,
+			Command: *command,
+			URL:     *url,
+		}
+		jobName := *name
+		if jobName == "" {
+			jobName = truncateName(*message+*command+*url, 30)
+		}
+		job, err := service.AddJob(jobName, schedule, payload, deleteAfterRun)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ added job '%s' (id: %s): %s\n", job.Name, job.ID, cron.Describe(job.Schedule))
+		for _, t := range cron.NextRuns(job.Schedule, time.Now(), 3) {
+			fmt.Printf("  next run %s\n", t.Format("2006-01-02 15:04:05 (Mon) MST"))
+		}
+
+	case "remove":
+		if fs.NArg() == 0 {
+			fmt.Println("Usage: nanobot cron remove [-c config] <job id>...")
+			os.Exit(1)
+		}
+		failed := 0
+		for _, id := range fs.Args() {
+			if !service.RemoveJob(id) {
+				fmt.Printf("✗ %s: job not found\n", id)
+				failed++
+				continue
+			}
+			fmt.Printf("✓ removed %s\n", id)
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+
+	case "run":
+		if fs.NArg() != 1 {
+			fmt.Println("Usage: nanobot cron run [-c config] <job id>")
+			os.Exit(1)
+		}
+		id := fs.Arg(0)
+		job, ok := service.RequestRun(id)
+		if !ok {
+			fmt.Printf("✗ %s: job not found\n", id)
+			os.Exit(1)
+		}
+		requested := job.State.RunRequestedAtMs
+		deadline := time.Now().Add(cronRunWait)
+		for time.Now().Before(deadline) {
+			time.Sleep(500 * time.Millisecond)
+			job, ok = service.GetJob(id)
+			if !ok {
+				fmt.Printf("✗ %s was removed before it ran\n", id)
+				os.Exit(1)
+			}
+			if job.State.RunRequestedAtMs == 0 && job.State.LastRunAtMs >= requested {
+				if job.State.LastStatus == "error" {
+					fmt.Printf("✗ %s failed: %s\n", id, job.State.LastError)
+					os.Exit(1)
+				}
+				fmt.Printf("✓ %s ran\n", id)
+				return
+			}
+		}
+		fmt.Printf("%s is queued: no running gateway or agent picked it up within %s. It runs when one starts.\n", id, cronRunWait)
+
+	default:
+		fmt.Printf("Unknown cron action: %s\n", action)
+		os.Exit(1)
+	}
+}
+
+// cronSchedule builds the schedule of a job added from the command line.
+// One-time jobs are deleted after they ran.
+func cronSchedule(every time.Duration, expr, tz, at string, in time.Duration) (cron.CronSchedule, bool, error) {
+	set := 0
+	for _, given := range []bool{every > 0, expr != "", at != "", in > 0} {
+		if given {
+			set++
+		}
+	}
+	if set != 1 {
+		return cron.CronSchedule{}, false, fmt.Errorf("give exactly one of -every, -cron, -at or -in")
+	}
+
+	switch {
+	case every > 0:
+		return cron.CronSchedule{Kind: "every", EveryMs: every.Milliseconds()}, false, nil
+	case expr != "":
+		return cron.CronSchedule{Kind: "cron", Expr: expr, Tz: tz}, false, nil
+	case in > 0:
+		return cron.CronSchedule{Kind: "at", AtMs: time.Now().Add(in).UnixMilli()}, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		t, err = time.ParseInLocation("2006-01-02 15:04", at, time.Local)
+	}
+	if err != nil {
+		return cron.CronSchedule{}, false, fmt.Errorf("invalid -at time %q: use RFC 3339 or '2006-01-02 15:04'", at)
+	}
+	return cron.CronSchedule{Kind: "at", AtMs: t.UnixMilli()}, true, nil
+}
+
+func truncateName(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/config"
+	"github.com/HKUDS/nanobot-go/pkg/cron"
+	"github.com/HKUDS/nanobot-go/pkg/memory"
+	"github.com/HKUDS/nanobot-go/pkg/tools"
+)
+
+// newCronHandler returns the function that runs a due cron job according to its payload kind.
+// Output sent straight to a chat goes through digest, which batches jobs firing close together.
+func newCronHandler(cfg *config.Config, workspace string, messageBus *bus.MessageBus, digest *cron.Digest) func(cron.CronJob) error {
+	execTool := tools.NewExecTool(cfg.Tools.Exec.Timeout, workspace, cfg.Tools.Exec.RestrictToWorkspace)
+	if cfg.Tools.Encoding.Normalize {
+		execTool.Encodings = cfg.Tools.Encoding.Candidates
+	}
+	activity := memory.NewActivityLog(workspace)
+
+	return func(job cron.CronJob) error {
+		activity.Record(memory.ActivityReminder, fmt.Sprintf("%s (%s, %s)", job.Name, job.ID, job.Payload.Kind))
+		switch job.Payload.Kind {
+		case cron.PayloadMessage, "system_event":
+			return deliverCronOutput(digest, job, job.Payload.Message)
+
+		case cron.PayloadShell:
+			output, err := execTool.RunCommand(job.Payload.Command)
+			if job.Payload.Deliver {
+				if derr := deliverCronOutput(digest, job, output); derr != nil && err == nil {
+					err = derr
+				}
+			}
+			return err
+
+		case cron.PayloadWebhook:
+			return cron.PostWebhook(job)
+
+		case cron.PayloadOutbound:
+			// Delivered on its own at the time asked for, not batched in the digest
+			var msg bus.OutboundMessage
+			if err := json.Unmarshal(job.Payload.Outbound, &msg); err != nil {
+				return fmt.Errorf("invalid scheduled message: %w", err)
+			}
+			msg.DeliverAt = time.Time{}
+			messageBus.PublishOutbound(msg)
+			return nil
+
+		default:
+			// Inject message to bus to trigger agent
+			// We use "cron" as channel and job.Payload.Channel/To as origin if available
+			channel := "cron"
+			chatID := job.ID
+
+			if job.Payload.Channel != "" {
+				channel = job.Payload.Channel
+			}
+			if job.Payload.To != "" {
+				chatID = job.Payload.To
+			}
+
+			messageBus.PublishInbound(bus.InboundMessage{
+				Channel:  channel,
+				SenderID: "cron",
+				ChatID:   chatID,
+				Content:  job.Payload.Message,
+				Metadata: map[string]interface{}{"cron_job": job.Name},
+			})
+			return nil
+		}
+	}
+}
+
+// deliverCronOutput sends content to the job's target chat, without an LLM turn.
+func deliverCronOutput(digest *cron.Digest, job cron.CronJob, content string) error {
+	if job.Payload.Channel == "" || job.Payload.To == "" {
+		return fmt.Errorf("no delivery target (channel and to are required)")
+	}
+	digest.Add(job.Payload.Channel, job.Payload.To, job.Name, content)
+	return nil
+}
+
+// newCronDigest creates the digest that batches cron deliveries per chat.
+func newCronDigest(cfg *config.Config, messageBus *bus.MessageBus) *cron.Digest {
+	return cron.NewDigest(time.Duration(cfg.Cron.DigestWindow)*time.Second, func(channel, chatID, content string) {
+		messageBus.PublishOutbound(bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			Type:    bus.MessageTypeText,
+			Content: content,
+		})
+	})
+}
+
+// newOutboundScheduler returns the bus scheduler that keeps messages to be
+// delivered later as one-shot jobs in the cron store, so they survive a
+// restart.
+func newOutboundScheduler(cronService *cron.Service) bus.Scheduler {
+	return func(msg bus.OutboundMessage) error {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		name := msg.Content
+		if name == "" {
+			name = fmt.Sprintf("%s %s", msg.Type, msg.Media)
+		}
+		job, err := cronService.AddJob(
+			"Scheduled message: "+name,
+			cron.CronSchedule{Kind: "at", AtMs: msg.DeliverAt.UnixMilli()},
+			cron.CronPayload{
+				Kind:     cron.PayloadOutbound,
+				Message:  msg.Content,
+				Channel:  msg.Channel,
+				To:       msg.ChatID,
+				Outbound: data,
+			},
+			true,
+		)
+		if err != nil {
+			return err
+		}
+		log.Printf("Scheduled message for %s:%s at %s (job %s)", msg.Channel, msg.ChatID, msg.DeliverAt.Format(time.RFC3339), job.ID)
+		return nil
+	}
+}
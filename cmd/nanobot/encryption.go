@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/HKUDS/nanobot-go/pkg/agent"
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+	"github.com/HKUDS/nanobot-go/pkg/config"
+	"github.com/HKUDS/nanobot-go/pkg/memory"
+	"github.com/HKUDS/nanobot-go/pkg/session"
+	"github.com/HKUDS/nanobot-go/pkg/usage"
+)
+
+// setupEncryption sets the encryption key when encryption is enabled. Without
+// the key nothing is started, so history is never written in plain text.
+func setupEncryption(cfg *config.Config) {
+	enc := cfg.Encryption
+	if !enc.Enabled {
+		return
+	}
+	key, err := atrest.LoadKey(enc.KeyEnv, enc.Keyring)
+	if err == nil {
+		err = atrest.SetKey(key)
+	}
+	if err != nil {
+		fmt.Printf("Error: encryption is enabled but %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// protectWorkspace registers the paths the gateway encrypts, for commands
+// that read or rewrite them without starting it.
+func protectWorkspace(workspace string) {
+	// Creating the stores registers the paths they protect
+	session.NewManager(workspace)
+	memory.NewMemoryStore(workspace)
+	usage.NewTracker(workspace, nil)
+	agent.ProtectFiles(workspace)
+	atrest.Protect(filepath.Join(workspace, "cron.json"))
+	atrest.Protect(filepath.Join(workspace, "bus", "dead-letter.jsonl"))
+}
+
+func runEncryption(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: nanobot encryption <keygen|encrypt|decrypt> [-c config]")
+		fmt.Println("  keygen   print a new random key")
+		fmt.Println("  encrypt  encrypt existing sessions, memory, the cron store and other chat data")
+		fmt.Println("  decrypt  decrypt them again, before turning encryption off")
+		os.Exit(1)
+	}
+
+	action := args[0]
+	fs := flag.NewFlagSet("encryption", flag.ExitOnError)
+	configPath := fs.String("c", "", "Path to config file")
+	fs.Parse(args[1:])
+
+	if action == "keygen" {
+		key, err := atrest.NewKey()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(key)
+		return
+	}
+	if action != "encrypt" && action != "decrypt" {
+		fmt.Printf("Unknown action: %s\n", action)
+		os.Exit(1)
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	workspace := expandPath(cfg.Agents.Defaults.Workspace)
+	// The key is needed either way, even when encryption is already off
+	key, err := atrest.LoadKey(cfg.Encryption.KeyEnv, cfg.Encryption.Keyring)
+	if err == nil {
+		err = atrest.SetKey(key)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	protectWorkspace(workspace)
+
+	decrypt := action == "decrypt"
+	changed, err := atrest.Rewrite(decrypt)
+	if err != nil {
+		fmt.Printf("Error after %d files: %v\n", changed, err)
+		os.Exit(1)
+	}
+	verb := "Encrypted"
+	if decrypt {
+		verb = "Decrypted"
+	}
+	fmt.Printf("%s %d files.\n", verb, changed)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -13,14 +14,17 @@ import (
 	"github.com/HKUDS/nanobot-go/pkg/channels"
 	"github.com/HKUDS/nanobot-go/pkg/config"
 	"github.com/HKUDS/nanobot-go/pkg/cron"
+	"github.com/HKUDS/nanobot-go/pkg/gateway"
 	"github.com/HKUDS/nanobot-go/pkg/providers"
+	"github.com/HKUDS/nanobot-go/pkg/tools"
+	"github.com/HKUDS/nanobot-go/pkg/tracing"
 	"github.com/HKUDS/nanobot-go/pkg/utils"
 )
 
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: nanobot <command> [args]")
-		fmt.Println("Commands: agent, onboard, gateway")
+		fmt.Println("Commands: agent, chat, onboard, gateway, sessions, cron, channels, credentials, usage, encryption, purge, version")
 		os.Exit(1)
 	}
 
@@ -28,10 +32,28 @@ func main() {
 	switch cmd {
 	case "agent":
 		runAgent(os.Args[2:])
+	case "chat":
+		runChat(os.Args[2:])
 	case "onboard":
-		runOnboard()
+		runOnboard(os.Args[2:])
 	case "gateway":
-		fmt.Println("Gateway not implemented yet")
+		runGateway(os.Args[2:])
+	case "sessions":
+		runSessions(os.Args[2:])
+	case "cron":
+		runCron(os.Args[2:])
+	case "channels":
+		runChannels(os.Args[2:])
+	case "credentials":
+		runCredentials(os.Args[2:])
+	case "usage":
+		runUsage(os.Args[2:])
+	case "encryption":
+		runEncryption(os.Args[2:])
+	case "purge":
+		runPurge(os.Args[2:])
+	case "version", "--version", "-v":
+		runVersion()
 	default:
 		fmt.Printf("Unknown command: %s\n", cmd)
 		os.Exit(1)
@@ -46,18 +68,61 @@ func expandPath(path string) string {
 	return path
 }
 
-func runAgent(args []string) {
-	fs := flag.NewFlagSet("agent", flag.ExitOnError)
-	message := fs.String("m", "", "Message to send")
-	configPath := fs.String("c", "", "Path to config file")
-	fs.Parse(args)
+// runtime holds the components shared by the agent and gateway commands.
+type runtime struct {
+	Config    *config.Config
+	Workspace string
+	Bus       *bus.MessageBus
+	Cron      *cron.Service
+	Digest    *cron.Digest
+	Loop      *agent.AgentLoop
+	Channels  *channels.Monitor
+	// started lists the channels that started, to be stopped on shutdown.
+	started []channels.Channel
+	// ReloadCredentials re-reads provider API keys from the config file.
+	ReloadCredentials func() error
+}
+
+// runtimeFlags are command-line overrides of the config file shared by
+// the agent and gateway commands.
+type runtimeFlags struct {
+	ReadOnly bool   // turns on tools.readOnly
+	Repo     string // turns on coding mode for this repository
+}
+
+// addRuntimeFlags defines the shared flags on fs.
+func addRuntimeFlags(fs *flag.FlagSet) *runtimeFlags {
+	f := &runtimeFlags{}
+	fs.BoolVar(&f.ReadOnly, "read-only", false, "Disable file writes, exec and cron changes")
+	fs.StringVar(&f.Repo, "repo", "", "Work as a coding agent on this repository")
+	return f
+}
 
+// startRuntime loads the config and starts the bus, cron service, channels and agent loop.
+func startRuntime(configPath string, flags *runtimeFlags) *runtime {
 	// Load config
-	cfg, err := config.LoadConfig(*configPath)
+	cfg, err := config.LoadConfig(configPath)
 	if err != nil {
 		fmt.Printf("Error loading config: %v\n", err)
 		os.Exit(1)
 	}
+	setupEncryption(cfg)
+	tracing.Setup(cfg.Tracing)
+	if flags.ReadOnly {
+		cfg.Tools.ReadOnly = true
+	}
+	if flags.Repo != "" {
+		cfg.Agents.Coding.Enabled = true
+		cfg.Agents.Coding.Repo = flags.Repo
+	}
+	if coding := &cfg.Agents.Coding; coding.Enabled {
+		repo, err := filepath.Abs(expandPath(coding.Repo))
+		if info, statErr := os.Stat(repo); coding.Repo == "" || err != nil || statErr != nil || !info.IsDir() {
+			fmt.Printf("Error: coding repository %q is not a directory\n", coding.Repo)
+			os.Exit(1)
+		}
+		coding.Repo = repo
+	}
 
 	// Setup logger
 	workspace := expandPath(cfg.Agents.Defaults.Workspace)
@@ -66,48 +131,49 @@ func runAgent(args []string) {
 
 	// Initialize components
 	messageBus := bus.NewMessageBus()
+	if cfg.Bus.Persist {
+		if err := messageBus.EnablePersistence(filepath.Join(workspace, "bus"), cfg.Bus.MaxAttempts); err != nil {
+			fmt.Printf("Error enabling bus persistence, messages will not survive a restart: %v\n", err)
+		}
+		messageBus.SetRedactor(agent.RedactSecrets)
+	}
+	if len(cfg.Channels.Format) > 0 {
+		messageBus.AddOutboundHook(channels.NewOutboundFormatter(cfg.Channels.Format))
+	}
 
 	// Initialize Cron
 	cronStorePath := filepath.Join(workspace, "cron.json")
-	cronService := cron.NewService(cronStorePath, func(job cron.CronJob) {
-		content := job.Payload.Message
-		if job.Payload.Kind == "agent_turn" {
-			// Inject message to bus to trigger agent
-			// We use "cron" as channel and job.Payload.Channel/To as origin if available
-			channel := "cron"
-			chatID := job.ID
-
-			if job.Payload.Channel != "" {
-				channel = job.Payload.Channel
-			}
-			if job.Payload.To != "" {
-				chatID = job.Payload.To
-			}
-
-			// If it's an agent turn, we want the agent to process it.
-			// We can send it as a system message or user message.
-			// Ideally, we treat it as an inbound message.
-			messageBus.PublishInbound(bus.InboundMessage{
-				Channel:  channel,
-				SenderID: "cron",
-				ChatID:   chatID,
-				Content:  content,
-			})
-		}
-	})
+	cronDigest := newCronDigest(cfg, messageBus)
+	cronService := cron.NewService(cronStorePath, newCronHandler(cfg, workspace, messageBus, cronDigest))
 	cronService.Start()
-	defer cronService.Stop()
+	messageBus.SetScheduler(newOutboundScheduler(cronService))
 
 	// Initialize Channels
+	monitor := channels.NewMonitor(filepath.Join(workspace, channelStatusFile))
+	monitor.Register("telegram", cfg.Channels.Telegram.Enabled)
+	monitor.Register("feishu", cfg.Channels.Feishu.Enabled)
+	monitor.Register("dingtalk", cfg.Channels.DingTalk.Enabled)
+	var started []channels.Channel
+
 	// Telegram
 	if cfg.Channels.Telegram.Enabled {
-		tgChannel := channels.NewTelegramChannel(&cfg.Channels.Telegram, messageBus)
-		if err := tgChannel.Start(); err != nil {
+		tgChannel := channels.NewTelegramChannel(&cfg.Channels.Telegram, messageBus, workspace)
+		tgChannel.Monitor = monitor
+		err := tgChannel.Start()
+		monitor.Started(tgChannel.Name(), err)
+		if err != nil {
 			fmt.Printf("Error starting Telegram channel: %v\n", err)
 		} else {
+			started = append(started, tgChannel)
+			messageBus.SetEditor(tgChannel.Name(), tgChannel)
+			send := channels.NewLimitedSender(tgChannel.Name(), cfg.Channels.RateLimit[tgChannel.Name()], tgChannel.Send)
+			send = channels.NewFileFallbackSender(tgChannel.Name(), cfg.Channels.FileFallback[tgChannel.Name()], workspace, send)
 			messageBus.SubscribeOutbound(tgChannel.Name(), func(msg bus.OutboundMessage) {
-				if err := tgChannel.Send(msg); err != nil {
+				err := send(msg)
+				monitor.RecordOutbound(tgChannel.Name(), err)
+				if err != nil {
 					fmt.Printf("Error sending to Telegram: %v\n", err)
+					messageBus.ReportFailure(msg, err)
 				}
 			})
 		}
@@ -116,12 +182,25 @@ func runAgent(args []string) {
 	// Feishu
 	if cfg.Channels.Feishu.Enabled {
 		feishuChannel := channels.NewFeishuChannel(&cfg.Channels.Feishu, messageBus, workspace)
-		if err := feishuChannel.Start(); err != nil {
+		feishuChannel.Monitor = monitor
+		if cfg.Channels.Transcription.Enabled {
+			feishuChannel.Transcriber = channels.NewTranscriber(cfg.Channels.Transcription)
+		}
+		err := feishuChannel.Start()
+		monitor.Started(feishuChannel.Name(), err)
+		if err != nil {
 			fmt.Printf("Error starting Feishu channel: %v\n", err)
 		} else {
+			started = append(started, feishuChannel)
+			messageBus.SetEditor(feishuChannel.Name(), feishuChannel)
+			send := channels.NewLimitedSender(feishuChannel.Name(), cfg.Channels.RateLimit[feishuChannel.Name()], feishuChannel.Send)
+			send = channels.NewFileFallbackSender(feishuChannel.Name(), cfg.Channels.FileFallback[feishuChannel.Name()], workspace, send)
 			messageBus.SubscribeOutbound(feishuChannel.Name(), func(msg bus.OutboundMessage) {
-				if err := feishuChannel.Send(msg); err != nil {
+				err := send(msg)
+				monitor.RecordOutbound(feishuChannel.Name(), err)
+				if err != nil {
 					fmt.Printf("Error sending to Feishu: %v\n", err)
+					messageBus.ReportFailure(msg, err)
 				}
 			})
 		}
@@ -129,13 +208,26 @@ func runAgent(args []string) {
 
 	// DingTalk
 	if cfg.Channels.DingTalk.Enabled {
-		dingTalkChannel := channels.NewDingTalkChannel(&cfg.Channels.DingTalk, messageBus)
-		if err := dingTalkChannel.Start(); err != nil {
+		dingTalkChannel := channels.NewDingTalkChannel(&cfg.Channels.DingTalk, messageBus, workspace)
+		dingTalkChannel.Monitor = monitor
+		if cfg.Channels.Transcription.Enabled {
+			dingTalkChannel.Transcriber = channels.NewTranscriber(cfg.Channels.Transcription)
+		}
+		err := dingTalkChannel.Start()
+		monitor.Started(dingTalkChannel.Name(), err)
+		if err != nil {
 			fmt.Printf("Error starting DingTalk channel: %v\n", err)
 		} else {
+			started = append(started, dingTalkChannel)
+			messageBus.SetEditor(dingTalkChannel.Name(), dingTalkChannel)
+			send := channels.NewLimitedSender(dingTalkChannel.Name(), cfg.Channels.RateLimit[dingTalkChannel.Name()], dingTalkChannel.Send)
+			send = channels.NewFileFallbackSender(dingTalkChannel.Name(), cfg.Channels.FileFallback[dingTalkChannel.Name()], workspace, send)
 			messageBus.SubscribeOutbound(dingTalkChannel.Name(), func(msg bus.OutboundMessage) {
-				if err := dingTalkChannel.Send(msg); err != nil {
+				err := send(msg)
+				monitor.RecordOutbound(dingTalkChannel.Name(), err)
+				if err != nil {
 					fmt.Printf("Error sending to DingTalk: %v\n", err)
+					messageBus.ReportFailure(msg, err)
 				}
 			})
 		}
@@ -149,11 +241,42 @@ func runAgent(args []string) {
 		os.Exit(1)
 	}
 
+	reload := func() error { return reloadCredentials(configPath, provider) }
+	watchReloadSignal(reload)
+
 	loop := agent.NewAgentLoop(messageBus, provider, workspace, cfg, cronService)
+	loop.CronDigest = cronDigest
+	loop.RegisterTool(tools.NewChannelsStatusTool(monitor))
 
+	messageBus.Recover()
 	go messageBus.DispatchOutbound()
 	go loop.Run()
 
+	return &runtime{
+		Config:    cfg,
+		Workspace: workspace,
+		Bus:       messageBus,
+		Cron:      cronService,
+		Digest:    cronDigest,
+		Loop:      loop,
+		Channels:  monitor,
+		started:   started,
+
+		ReloadCredentials: reload,
+	}
+}
+
+func runAgent(args []string) {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	message := fs.String("m", "", "Message to send")
+	configPath := fs.String("c", "", "Path to config file")
+	flags := addRuntimeFlags(fs)
+	fs.Parse(args)
+
+	rt := startRuntime(*configPath, flags)
+	defer rt.Cron.Stop()
+	messageBus := rt.Bus
+
 	if *message != "" {
 		messageBus.PublishInbound(bus.InboundMessage{
 			Channel:  "cli",
@@ -172,20 +295,120 @@ func runAgent(args []string) {
 				fmt.Println()
 			} else {
 				fmt.Println(msg.Content)
+				if msg.Media != "" {
+					fmt.Printf("[%s: %s]\n", msg.Type, msg.Media)
+				}
 			}
 			close(done)
 		})
 
 		<-done
-		loop.Stop()
+		// Let the turn save its session before exiting
+		rt.Loop.Shutdown(turnGracePeriod)
+		tracing.Shutdown(flushTimeout)
 	} else {
 		// Server mode
+		if feishu := rt.Config.Channels.Feishu; feishu.Enabled && strings.EqualFold(feishu.Mode, "webhook") {
+			fmt.Println("Warning: Feishu is in webhook mode, which needs the gateway; run 'nanobot gateway' to receive its messages.")
+		}
+		rt.Loop.Subagents.ResumeResearch()
+		sendStartupBanner(rt, nil)
 		fmt.Println("Agent running in server mode. Press Ctrl+C to stop.")
-		select {}
+		waitForShutdown(rt, nil)
 	}
 }
 
-func runOnboard() {
+func runGateway(args []string) {
+	fs := flag.NewFlagSet("gateway", flag.ExitOnError)
+	configPath := fs.String("c", "", "Path to config file")
+	flags := addRuntimeFlags(fs)
+	fs.Parse(args)
+
+	rt := startRuntime(*configPath, flags)
+	defer rt.Cron.Stop()
+
+	server := gateway.NewServer(&rt.Config.Gateway, rt.Bus)
+	gateway.NewCronAPI(rt.Cron).Register(server)
+	gateway.NewSessionAPI(rt.Loop.Sessions).Register(server)
+	gateway.NewChannelAPI(rt.Channels).Register(server)
+	gateway.NewProviderAPI(rt.ReloadCredentials).Register(server)
+	gateway.NewBroadcastAPI(rt.Bus).Register(server)
+	gateway.NewBusAPI(rt.Bus).Register(server)
+	if gw := rt.Config.Gateway; gw.WebUI && gw.WebToken == "" {
+		log.Printf("Web chat disabled: gateway.webToken is required")
+	} else if gw.WebUI {
+		webChat := gateway.NewWebChat(rt.Bus, gw.WebToken)
+		webChat.Register(server)
+		rt.Bus.SubscribeOutbound(webChat.Name(), func(msg bus.OutboundMessage) {
+			if err := webChat.Send(msg); err != nil {
+				fmt.Printf("Error sending to web chat: %v\n", err)
+			}
+		})
+	}
+
+	if fed := &rt.Config.Channels.Federation; fed.Enabled && fed.Name == "" {
+		log.Printf("Federation disabled: channels.federation.name is required")
+	} else if fed.Enabled {
+		federation := gateway.NewFederation(fed, rt.Bus)
+		federation.Register(server)
+		if len(fed.Peers) > 0 {
+			rt.Loop.RegisterTool(tools.NewDelegateTool(federation))
+		}
+		send := channels.NewLimitedSender(federation.Name(), rt.Config.Channels.RateLimit[federation.Name()], federation.Send)
+		rt.Bus.SubscribeOutbound(federation.Name(), func(msg bus.OutboundMessage) {
+			if err := send(msg); err != nil {
+				fmt.Printf("Error sending to federation peer: %v\n", err)
+				rt.Bus.ReportFailure(msg, err)
+			}
+		})
+	}
+
+	if wh := &rt.Config.Channels.Webhook; wh.Enabled && wh.Token == "" {
+		log.Printf("Webhook disabled: channels.webhook.token is required")
+	} else if wh.Enabled {
+		webhook := gateway.NewWebhook(wh, rt.Bus)
+		webhook.Register(server)
+		send := channels.NewLimitedSender(webhook.Name(), rt.Config.Channels.RateLimit[webhook.Name()], webhook.Send)
+		rt.Bus.SubscribeOutbound(webhook.Name(), func(msg bus.OutboundMessage) {
+			if err := send(msg); err != nil {
+				fmt.Printf("Error sending to webhook callback: %v\n", err)
+				rt.Bus.ReportFailure(msg, err)
+			}
+		})
+	}
+
+	for _, ch := range rt.started {
+		if feishu, ok := ch.(*channels.FeishuChannel); ok {
+			if handler := feishu.WebhookHandler(); handler != nil {
+				server.Handle(feishu.WebhookPath(), handler)
+			}
+		}
+	}
+
+	if publicURL := rt.Config.Gateway.PublicURL; publicURL != "" {
+		rt.Loop.OAuth.RedirectURL = strings.TrimRight(publicURL, "/") + "/oauth/callback"
+		gateway.NewOAuthCallback(rt.Loop.OAuth, rt.Bus).Register(server)
+	}
+
+	if err := server.Start(); err != nil {
+		fmt.Printf("Error starting gateway: %v\n", err)
+		os.Exit(1)
+	}
+	rt.Loop.Subagents.ResumeResearch()
+	sendStartupBanner(rt, server)
+	fmt.Printf("Gateway listening on %s. Press Ctrl+C to stop.\n", server.Addr())
+	if rt.Config.Gateway.WebUI && rt.Config.Gateway.WebToken != "" {
+		fmt.Printf("Web chat: http://%s/#token=<webToken>\n", server.Addr())
+	}
+	waitForShutdown(rt, server)
+}
+
+func runOnboard(args []string) {
+	fs := flag.NewFlagSet("onboard", flag.ExitOnError)
+	from := fs.String("from", "", "Git repository to use as the workspace template")
+	ref := fs.String("ref", "", "Branch or tag of the template repository")
+	fs.Parse(args)
+
 	configDir := ".nanobot"
 	if err := os.MkdirAll(configDir, 0755); err != nil {
 		fmt.Printf("Error creating config directory: %v\n", err)
@@ -227,6 +450,13 @@ func runOnboard() {
 	}
 	fmt.Printf("Created workspace at %s\n", workspace)
 
+	if *from != "" {
+		if err := applyTemplate(*from, *ref, workspace); err != nil {
+			fmt.Printf("Error applying workspace template: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Create SOUL.md
 	soulPath := filepath.Join(workspace, "SOUL.md")
 	if _, err := os.Stat(soulPath); os.IsNotExist(err) {
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/HKUDS/nanobot-go/pkg/memory"
+	"github.com/HKUDS/nanobot-go/pkg/purge"
+	"github.com/HKUDS/nanobot-go/pkg/secrets"
+	"github.com/HKUDS/nanobot-go/pkg/session"
+)
+
+func runPurge(args []string) {
+	fs := flag.NewFlagSet("purge", flag.ExitOnError)
+	configPath := fs.String("c", "", "Path to config file")
+	sender := fs.String("sender", "", "The user whose data to remove, as channel:id (e.g. telegram:123456)")
+	asJSON := fs.Bool("json", false, "Print the deletion report as JSON")
+	fs.Parse(args)
+
+	if *sender == "" {
+		fmt.Println("Usage: nanobot purge --sender <channel:id> [-c config] [-json]")
+		fmt.Println("Stop the gateway first, or use /purge in chat: a running gateway would save its copy of the sessions back.")
+		os.Exit(1)
+	}
+	if _, _, err := purge.ParseSender(*sender); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg, workspace := loadWorkspace(*configPath)
+	// Files purged in place are written back encrypted when they should be
+	protectWorkspace(workspace)
+	purger := &purge.Purger{
+		Workspace: workspace,
+		Sessions:  session.NewManager(workspace),
+		Memory:    memory.NewMemoryStore(workspace),
+		Secrets:   secrets.NewStore(workspace),
+		Contacts:  cfg.Contacts,
+		// The gateway is stopped, so the bus journals are not in use
+		Journals: true,
+	}
+	report, err := purger.Purge(*sender)
+	if *asJSON && report != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else if report != nil {
+		fmt.Println(report)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/secrets"
+)
+
+func runCredentials(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: nanobot credentials <list|set|remove> [-c config] [identity] [service]")
+		fmt.Println("The secret for set is read from standard input.")
+		os.Exit(1)
+	}
+
+	action := args[0]
+	fs := flag.NewFlagSet("credentials", flag.ExitOnError)
+	configPath := fs.String("c", "", "Path to config file")
+	fs.Parse(args[1:])
+
+	cfg, workspace := loadWorkspace(*configPath)
+	store := secrets.NewStore(workspace)
+	rest := fs.Args()
+
+	switch action {
+	case "list":
+		identities := rest
+		if len(identities) == 0 {
+			var err error
+			if identities, err = store.Identities(); err != nil {
+				fmt.Printf("Error reading credentials: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		for _, id := range identities {
+			services, err := store.Services(id)
+			if err != nil {
+				fmt.Printf("Error reading credentials: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("%-30s %s\n", id, strings.Join(services, ", "))
+		}
+
+	case "set":
+		if len(rest) != 2 {
+			fmt.Println("Usage: nanobot credentials set <identity> <service> < secret")
+			os.Exit(1)
+		}
+		if _, ok := cfg.Tools.Credentials[rest[1]]; !ok {
+			fmt.Printf("Warning: %s is not in tools.credentials, so no tool will use it\n", rest[1])
+		}
+		fmt.Fprint(os.Stderr, "Secret: ")
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		token := strings.TrimSpace(line)
+		if token == "" {
+			fmt.Println("No secret given.")
+			os.Exit(1)
+		}
+		if err := store.Set(rest[0], rest[1], secrets.Credential{Token: token}); err != nil {
+			fmt.Printf("Error saving credential: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("✓ saved %s credential for %s\n", rest[1], rest[0])
+
+	case "remove":
+		if len(rest) != 2 {
+			fmt.Println("Usage: nanobot credentials remove <identity> <service>")
+			os.Exit(1)
+		}
+		removed, err := store.Remove(rest[0], rest[1])
+		if err != nil {
+			fmt.Printf("Error removing credential: %v\n", err)
+			os.Exit(1)
+		}
+		if !removed {
+			fmt.Printf("%s has no %s credential\n", rest[0], rest[1])
+			os.Exit(1)
+		}
+		fmt.Printf("✓ removed %s credential for %s\n", rest[1], rest[0])
+
+	default:
+		fmt.Printf("Unknown credentials action: %s\n", action)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/config"
+	"github.com/HKUDS/nanobot-go/pkg/session"
+)
+
+// loadWorkspace loads the config and returns it with the expanded workspace path.
+func loadWorkspace(configPath string) (*config.Config, string) {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	setupEncryption(cfg)
+	return cfg, expandPath(cfg.Agents.Defaults.Workspace)
+}
+
+func runSessions(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: nanobot sessions <list|clear|archive|export> [-c config] [-idle-days N] [-o file] [keys...]")
+		os.Exit(1)
+	}
+
+	action := args[0]
+	fs := flag.NewFlagSet("sessions", flag.ExitOnError)
+	configPath := fs.String("c", "", "Path to config file")
+	idleDays := fs.Int("idle-days", -1, "Select sessions idle for at least N days")
+	output := fs.String("o", "", "Output file for export (default stdout)")
+	fs.Parse(args[1:])
+
+	cfg, workspace := loadWorkspace(*configPath)
+	manager := session.NewManager(workspace)
+
+	keys := fs.Args()
+	if *idleDays >= 0 {
+		infos, err := manager.List()
+		if err != nil {
+			fmt.Printf("Error listing sessions: %v\n", err)
+			os.Exit(1)
+		}
+		for _, info := range session.FilterIdle(infos, time.Duration(*idleDays)*24*time.Hour) {
+			keys = append(keys, info.Key)
+		}
+	}
+
+	switch action {
+	case "list":
+		infos, err := manager.List()
+		if err != nil {
+			fmt.Printf("Error listing sessions: %v\n", err)
+			os.Exit(1)
+		}
+		if *idleDays >= 0 {
+			infos = session.FilterIdle(infos, time.Duration(*idleDays)*24*time.Hour)
+		}
+		var total int64
+		fmt.Printf("%-40s %8s %10s  %s\n", "KEY", "MESSAGES", "SIZE", "LAST ACTIVITY")
+		for _, info := range infos {
+			total += info.SizeBytes
+			fmt.Printf("%-40s %8d %10s  %s\n", info.Key, info.Messages, formatBytes(info.SizeBytes), info.UpdatedAt.Format("2006-01-02 15:04"))
+		}
+		fmt.Printf("\n%d sessions, %s total\n", len(infos), formatBytes(total))
+
+	case "clear", "archive":
+		if len(keys) == 0 {
+			fmt.Println("No sessions selected. Pass session keys or -idle-days N.")
+			os.Exit(1)
+		}
+		// A running gateway keeps sessions in memory and would save them
+		// back, so it has to make the change itself
+		if gatewayURL := runningGateway(cfg); gatewayURL != "" {
+			if cfg.Gateway.AdminToken == "" {
+				fmt.Println("Error: the gateway is running and would save these sessions back. Stop it, or set gateway.adminToken so this command goes through its admin API.")
+				os.Exit(1)
+			}
+			if !adminSessions(gatewayURL, cfg.Gateway.AdminToken, action, keys) {
+				os.Exit(1)
+			}
+			return
+		}
+		failed := 0
+		for _, key := range keys {
+			if action == "clear" {
+				if err := manager.Clear(key); err != nil {
+					fmt.Printf("✗ %s: %v\n", key, err)
+					failed++
+					continue
+				}
+				fmt.Printf("✓ cleared %s\n", key)
+			} else {
+				path, err := manager.Archive(key)
+				if err != nil {
+					fmt.Printf("✗ %s: %v\n", key, err)
+					failed++
+					continue
+				}
+				fmt.Printf("✓ archived %s -> %s\n", key, path)
+			}
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+
+	case "export":
+		sessions, err := manager.Export(keys)
+		if err != nil {
+			fmt.Printf("Error exporting sessions: %v\n", err)
+			os.Exit(1)
+		}
+		out := os.Stdout
+		if *output != "" {
+			f, err := os.Create(*output)
+			if err != nil {
+				fmt.Printf("Error creating output file: %v\n", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			out = f
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(map[string]interface{}{
+			"exported_at": time.Now().Format(time.RFC3339),
+			"sessions":    sessions,
+		})
+		if *output != "" {
+			fmt.Printf("Exported %d sessions to %s\n", len(sessions), *output)
+		}
+
+	default:
+		fmt.Printf("Unknown sessions action: %s\n", action)
+		os.Exit(1)
+	}
+}
+
+// runningGateway returns the address of the gateway if one answers on the
+// configured port, or "".
+func runningGateway(cfg *config.Config) string {
+	host := cfg.Gateway.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	port := cfg.Gateway.Port
+	if port == 0 {
+		port = 18790
+	}
+	url := "http://" + net.JoinHostPort(host, strconv.Itoa(port))
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(url + "/health")
+	if err != nil {
+		return ""
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	return url
+}
+
+// adminSessions clears or archives sessions through the gateway's admin
+// API and prints the results. It reports whether all of them succeeded.
+func adminSessions(gatewayURL, token, action string, keys []string) bool {
+	body, _ := json.Marshal(map[string][]string{"keys": keys})
+	req, err := http.NewRequest("POST", gatewayURL+"/api/admin/sessions/"+action, bytes.NewReader(body))
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		fmt.Printf("Error: the gateway is running but did not answer: %v\n", err)
+		return false
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Results []struct {
+			Key     string `json:"key"`
+			OK      bool   `json:"ok"`
+			Archive string `json:"archive"`
+			Error   string `json:"error"`
+		} `json:"results"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || resp.StatusCode != http.StatusOK {
+		if result.Error == "" {
+			result.Error = resp.Status
+		}
+		fmt.Printf("Error: the gateway refused: %s\n", result.Error)
+		return false
+	}
+	ok := true
+	for _, r := range result.Results {
+		switch {
+		case !r.OK:
+			fmt.Printf("✗ %s: %s\n", r.Key, r.Error)
+			ok = false
+		case action == "clear":
+			fmt.Printf("✓ cleared %s\n", r.Key)
+		default:
+			fmt.Printf("✓ archived %s -> %s\n", r.Key, r.Archive)
+		}
+	}
+	return ok
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
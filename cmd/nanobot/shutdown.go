@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/gateway"
+	"github.com/HKUDS/nanobot-go/pkg/tracing"
+)
+
+const (
+	// turnGracePeriod is how long running turns may finish on their own
+	// before they are interrupted.
+	turnGracePeriod = 20 * time.Second
+	// flushTimeout bounds the wait for queued replies to be delivered.
+	flushTimeout = 10 * time.Second
+)
+
+// waitForShutdown blocks until SIGINT or SIGTERM, then stops the runtime.
+// A second signal exits immediately.
+func waitForShutdown(rt *runtime, server *gateway.Server) {
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	s := <-sig
+	fmt.Printf("\nReceived %s, shutting down (press Ctrl+C again to force)...\n", s)
+	go func() {
+		<-sig
+		fmt.Println("Forced exit")
+		os.Exit(1)
+	}()
+	shutdownRuntime(rt, server)
+}
+
+// shutdownRuntime stops cron first so no new jobs fire, then the agent
+// loop (interrupted turns save their session), then flushes batched cron
+// deliveries and pending replies before the gateway server, channels and
+// bus are stopped.
+func shutdownRuntime(rt *runtime, server *gateway.Server) {
+	rt.Cron.Stop()
+	rt.Loop.Shutdown(turnGracePeriod)
+	rt.Digest.Flush()
+	if !rt.Bus.Flush(flushTimeout) {
+		log.Printf("Some outbound messages were not delivered before shutdown")
+	}
+
+	if server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := server.Stop(ctx); err != nil {
+			log.Printf("Error stopping gateway: %v", err)
+		}
+		cancel()
+	}
+	for _, ch := range rt.started {
+		if err := ch.Stop(); err != nil {
+			log.Printf("Error stopping %s channel: %v", ch.Name(), err)
+		}
+	}
+	rt.Bus.Stop()
+	tracing.Shutdown(flushTimeout)
+	log.Println("Shutdown complete")
+	fmt.Println("Bye.")
+}
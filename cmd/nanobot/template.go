@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// applyTemplate fills the workspace from a git repository holding a shared
+// workspace template (SOUL.md, AGENTS.md, skills, memory seeds). An empty
+// workspace becomes a clone, so it can later be updated with git pull; into
+// an existing one only files it does not have yet are copied.
+func applyTemplate(repo, ref, workspace string) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git is required for --from: %w", err)
+	}
+
+	entries, err := ioutil.ReadDir(workspace)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(entries) == 0 {
+		if err := gitClone(repo, ref, workspace); err != nil {
+			return err
+		}
+		fmt.Printf("Cloned workspace template %s into %s (run git pull there to update it)\n", repo, workspace)
+		return nil
+	}
+
+	tmp, err := ioutil.TempDir("", "nanobot-template-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	if err := gitClone(repo, ref, tmp); err != nil {
+		return err
+	}
+
+	var copied, skipped int
+	err = filepath.Walk(tmp, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(tmp, path)
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(filepath.Join(workspace, rel), 0755)
+		}
+		dst := filepath.Join(workspace, rel)
+		if _, err := os.Stat(dst); err == nil {
+			fmt.Printf("Kept existing %s\n", rel)
+			skipped++
+			return nil
+		}
+		copied++
+		return copyFile(path, dst, info.Mode())
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy template: %w", err)
+	}
+	fmt.Printf("Copied %d files from workspace template %s (%d existing files kept)\n", copied, repo, skipped)
+	return nil
+}
+
+func gitClone(repo, ref, dir string) error {
+	args := []string{"clone", "--depth", "1"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	args = append(args, repo, dir)
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git clone %s failed: %w", repo, err)
+	}
+	return nil
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
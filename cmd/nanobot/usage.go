@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/usage"
+)
+
+func runUsage(args []string) {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	configPath := fs.String("c", "", "Path to config file")
+	period := fs.String("period", "today", "today, yesterday, <n>d for the last n days, month, or YYYY-MM-DD")
+	by := fs.String("by", "day", "Breakdown: "+strings.Join(usage.Groupings, ", "))
+	channel := fs.String("channel", "", "Only this channel")
+	session := fs.String("session", "", "Only this session")
+	asJSON := fs.Bool("json", false, "Print the requests as JSON lines instead of a report")
+	fs.Parse(args)
+
+	cfg, workspace := loadWorkspace(*configPath)
+	first, last, err := usage.Period(*period, time.Now())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	valid := false
+	for _, g := range usage.Groupings {
+		valid = valid || g == *by
+	}
+	if !valid {
+		fmt.Printf("Error: -by must be one of %s\n", strings.Join(usage.Groupings, ", "))
+		os.Exit(1)
+	}
+
+	tracker := usage.NewTracker(workspace, cfg.Usage.Prices)
+	records, err := tracker.Read(first, last)
+	if err != nil {
+		fmt.Printf("Error reading usage: %v\n", err)
+		os.Exit(1)
+	}
+	kept := records[:0]
+	for _, r := range records {
+		if (*channel == "" || r.Channel == *channel) && (*session == "" || r.Session == *session) {
+			kept = append(kept, r)
+		}
+	}
+	records = kept
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range records {
+			enc.Encode(r)
+		}
+		return
+	}
+	fmt.Printf("Usage from %s to %s\n\n", first.Format("2006-01-02"), last.Format("2006-01-02"))
+	fmt.Println(usage.Report(records, *by))
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/HKUDS/nanobot-go/pkg/buildinfo"
+)
+
+func runVersion() {
+	fmt.Printf("nanobot %s\n", buildinfo.Version)
+	info := buildinfo.Info()
+	if info["commit"] != "" {
+		fmt.Printf("Commit:  %s\n", info["commit"])
+	}
+	if info["date"] != "" {
+		fmt.Printf("Built:   %s\n", info["date"])
+	}
+	fmt.Printf("Go:      %s %s\n", info["go"], info["platform"])
+}
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/cron"
+	"github.com/HKUDS/nanobot-go/pkg/memory"
+	"github.com/HKUDS/nanobot-go/pkg/tools"
+)
+
+// maxActivityItems caps each list in the activity note to keep the prompt small.
+const maxActivityItems = 10
+
+// activityNote returns the "Active jobs & background tasks" system prompt
+// section for a chat: its scheduled cron jobs and its queued or running
+// subagents. It is empty when there are none.
+func (l *AgentLoop) activityNote(channel, chatID string) string {
+	var lines []string
+
+	if l.CronService != nil {
+		var jobs []cron.CronJob
+		for _, j := range l.CronService.ListJobs() {
+			if j.Enabled && (j.Payload.Channel == "" || j.Payload.Channel == channel && j.Payload.To == chatID) {
+				jobs = append(jobs, j)
+			}
+		}
+		for i, j := range jobs {
+			if i == maxActivityItems {
+				lines = append(lines, fmt.Sprintf("- ... and %d more jobs (use cron list)", len(jobs)-i))
+				break
+			}
+			line := fmt.Sprintf("- Job %q (id: %s): %s", j.Name, j.ID, cron.Describe(j.Schedule))
+			if j.State.NextRunAtMs > 0 {
+				line += ", next " + time.UnixMilli(j.State.NextRunAtMs).In(j.Schedule.Location()).Format("2006-01-02 15:04")
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	tasks := l.Subagents.activeTasks(channel, chatID)
+	for i, t := range tasks {
+		if i == maxActivityItems {
+			lines = append(lines, fmt.Sprintf("- ... and %d more subagents", len(tasks)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("- Subagent [%s] (id: %s): %s for %s", t.Label, t.ID, t.State, time.Since(t.SpawnedAt).Round(time.Second)))
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+	return "## Active jobs & background tasks\n" +
+		"These already exist for this chat. Do not create duplicates; update or remove them instead, and mention running subagents when relevant.\n" +
+		strings.Join(lines, "\n")
+}
+
+// fileTools change files; their runs are also recorded as file changes.
+var fileTools = map[string]bool{"write_file": true, "edit_file": true, "append_file": true}
+
+// recordToolRun adds a tool run to the activity ledger, described by its
+// main argument, and a file entry for tools that change files.
+func recordToolRun(activity *memory.ActivityLog, name string, args map[string]interface{}) {
+	if activity == nil {
+		return
+	}
+	detail := name
+	if v := toolRunDetail(args); v != "" {
+		detail = fmt.Sprintf("%s: %s", name, v)
+	}
+	activity.Record(memory.ActivityTool, detail)
+	if path, _ := args["path"].(string); fileTools[name] && path != "" {
+		activity.Record(memory.ActivityFile, fmt.Sprintf("%s (%s)", path, strings.TrimSuffix(name, "_file")))
+	}
+}
+
+// toolRunDetail returns the main argument of a tool run, redacted, or "".
+func toolRunDetail(args map[string]interface{}) string {
+	redacted := tools.RedactArgs(args)
+	for _, key := range []string{"command", "path", "query", "url", "action"} {
+		if v, ok := redacted[key].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/HKUDS/nanobot-go/pkg/tools"
+)
+
+// fenceLanguages maps file extensions to the language tag used on the fenced block.
+var fenceLanguages = map[string]string{
+	".go": "go", ".py": "python", ".js": "javascript", ".ts": "typescript",
+	".jsx": "jsx", ".tsx": "tsx", ".java": "java", ".kt": "kotlin",
+	".c": "c", ".h": "c", ".cpp": "cpp", ".cc": "cpp", ".hpp": "cpp",
+	".cs": "csharp", ".rs": "rust", ".rb": "ruby", ".php": "php",
+	".swift": "swift", ".sh": "bash", ".bash": "bash", ".zsh": "bash",
+	".sql": "sql", ".html": "html", ".css": "css", ".xml": "xml",
+	".json": "json", ".yaml": "yaml", ".yml": "yaml", ".toml": "toml",
+	".md": "markdown", ".ini": "ini", ".lua": "lua", ".r": "r",
+}
+
+// describeAttachment renders a non-image attachment for the user message.
+// Small text files are inlined as a fenced block so the model can use them
+// without calling read_file; anything else is referenced by path.
+func (c *ContextBuilder) describeAttachment(path string, info os.FileInfo) string {
+	name := filepath.Base(path)
+	if c.MaxInlineFileBytes <= 0 || info.Size() > int64(c.MaxInlineFileBytes) {
+		return fmt.Sprintf("[Attached file: %s (%d bytes), saved at %s — use read_file to view it]", name, info.Size(), path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil || !isTextContent(data) {
+		return fmt.Sprintf("[Attached file: %s (%d bytes), saved at %s]", name, info.Size(), path)
+	}
+
+	fence := "```"
+	for strings.Contains(string(data), fence) {
+		fence += "`"
+	}
+	lang := fenceLanguages[strings.ToLower(filepath.Ext(name))]
+	return fmt.Sprintf("[Attached file: %s, saved at %s]\n%s%s\n%s\n%s",
+		name, path, fence, lang, strings.TrimRight(string(data), "\n"), fence)
+}
+
+// isTextContent reports whether data looks like UTF-8 text.
+func isTextContent(data []byte) bool {
+	if bytes.IndexByte(data, 0) >= 0 {
+		return false
+	}
+	return utf8.Valid(data)
+}
+
+// remoteImageClient fetches image URLs found in inbound media, only from
+// public addresses, so a URL cannot reach services on the host or its
+// network.
+var remoteImageClient = &http.Client{Timeout: 20 * time.Second, Transport: tools.PublicOnlyTransport()}
+
+// isRemoteMedia reports whether a media entry is an http(s) URL rather than a local path.
+func isRemoteMedia(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// remoteImage turns an image URL into an image_url content part according
+// to RemoteImages. When the URL is not used as an image it returns nil and
+// a note for the user message instead.
+func (c *ContextBuilder) remoteImage(url string) (map[string]interface{}, string) {
+	imagePart := func(u string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":      "image_url",
+			"image_url": map[string]interface{}{"url": u},
+		}
+	}
+
+	switch c.RemoteImages {
+	case "url":
+		return imagePart(url), ""
+	case "fetch":
+		// Fetched below
+	default:
+		return nil, fmt.Sprintf("[Attached link: %s]", url)
+	}
+
+	maxBytes := c.MaxRemoteImageBytes
+	if maxBytes <= 0 {
+		maxBytes = 5 * 1024 * 1024
+	}
+	resp, err := remoteImageClient.Get(url)
+	if err != nil {
+		return nil, fmt.Sprintf("[Attached link: %s — could not be fetched: %v]", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Sprintf("[Attached link: %s — could not be fetched: %s]", url, resp.Status)
+	}
+	if resp.ContentLength > int64(maxBytes) {
+		return nil, fmt.Sprintf("[Attached link: %s (%d bytes) is too large to fetch]", url, resp.ContentLength)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, int64(maxBytes)+1))
+	if err != nil {
+		return nil, fmt.Sprintf("[Attached link: %s — could not be fetched: %v]", url, err)
+	}
+	if len(data) > maxBytes {
+		return nil, fmt.Sprintf("[Attached link: %s is larger than %d bytes and too large to fetch]", url, maxBytes)
+	}
+
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return nil, fmt.Sprintf("[Attached link: %s (%s)]", url, mimeType)
+	}
+	return imagePart(fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data))), ""
+}
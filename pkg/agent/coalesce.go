@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// sentenceEnds are the characters after which a buffered chunk is preferably cut.
+const sentenceEnds = ".!?;\n。！？；…"
+
+// coalesceStream batches small stream deltas so channels that edit a message
+// per chunk (cards, Telegram edits) see a few larger updates instead of
+// hundreds of tiny ones. A chunk is emitted once the buffer holds minChars
+// characters, cut after the last sentence boundary if there is one, or when
+// interval has passed since the oldest buffered delta. Whatever is left is
+// flushed when in closes. With both limits 0, in is returned unchanged.
+func coalesceStream(in <-chan string, minChars int, interval time.Duration) <-chan string {
+	if minChars <= 0 && interval <= 0 {
+		return in
+	}
+
+	out := make(chan string, 10)
+	go func() {
+		defer close(out)
+
+		var buf string
+		var timer *time.Timer
+		var timeout <-chan time.Time
+
+		stopTimer := func() {
+			if timer != nil {
+				timer.Stop()
+				timer, timeout = nil, nil
+			}
+		}
+
+		for {
+			select {
+			case chunk, ok := <-in:
+				if !ok {
+					stopTimer()
+					if buf != "" {
+						out <- buf
+					}
+					return
+				}
+				buf += chunk
+				if minChars > 0 && utf8.RuneCountInString(buf) >= minChars {
+					n := len(buf)
+					if i := strings.LastIndexAny(buf, sentenceEnds); i >= 0 {
+						_, size := utf8.DecodeRuneInString(buf[i:])
+						n = i + size
+					}
+					out <- buf[:n]
+					buf = buf[n:]
+					if buf == "" {
+						stopTimer()
+					}
+				}
+				if buf != "" && timeout == nil && interval > 0 {
+					timer = time.NewTimer(interval)
+					timeout = timer.C
+				}
+			case <-timeout:
+				timer, timeout = nil, nil
+				if buf != "" {
+					out <- buf
+					buf = ""
+				}
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/session"
+	"github.com/HKUDS/nanobot-go/pkg/tools"
+)
+
+// handleCommand runs a slash command that changes per-chat settings.
+// It returns the reply and true if the message was a command.
+func (l *AgentLoop) handleCommand(sess *session.Session, msg bus.InboundMessage) (string, bool) {
+	fields := strings.Fields(strings.TrimSpace(msg.Content))
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", false
+	}
+	arg := ""
+	if len(fields) > 1 {
+		arg = strings.ToLower(fields[1])
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case "/verbosity":
+		return l.setVerbosity(sess, arg), true
+	case "/maxlen":
+		return l.setMaxReplyChars(sess, arg), true
+	case "/lang":
+		return l.setLanguage(sess, strings.Join(fields[1:], " ")), true
+	case "/send", "/discard":
+		return l.resolveDrafts(sess.Key, strings.ToLower(fields[0]) == "/send"), true
+	case "/usage":
+		return l.usageReport(sess), true
+	case "/report":
+		return l.activityReport(strings.Join(fields[1:], " ")), true
+	case "/credential", "/credentials":
+		return l.credentialCommand(l.identity(msg), fields[1:]), true
+	case "/restore":
+		return l.restoreCommand(sess.Key, arg), true
+	case "/model":
+		return l.modelCommand(sess, msg, strings.Join(fields[1:], " ")), true
+	case "/temp", "/temperature":
+		return l.temperatureCommand(sess, msg.Channel, msg.ChatID, arg), true
+	case "/profile":
+		return l.profileCommand(sess, msg.Channel, msg.ChatID, strings.Join(fields[1:], " ")), true
+	case "/connect":
+		return l.connectCommand(msg, fields[1:]), true
+	case "/skill", "/skills":
+		return l.skillCommand(fields[1:]), true
+	case "/purge":
+		return l.purgeCommand(msg, fields[1:]), true
+	case "/logs":
+		return l.logsCommand(msg, fields[1:]), true
+	case "/whoami":
+		return l.whoamiCommand(msg), true
+	case "/good", "/bad":
+		return l.feedbackCommand(sess, msg, strings.TrimPrefix(strings.ToLower(fields[0]), "/")), true
+	case "/more":
+		rest, _ := sess.Metadata[metaPendingReply].(string)
+		if rest == "" {
+			return "There is nothing more to show.", true
+		}
+		sess.DeleteMeta(metaPendingReply)
+		l.Sessions.Save(sess)
+		return rest, true
+	}
+	return "", false
+}
+
+func (l *AgentLoop) setVerbosity(sess *session.Session, arg string) string {
+	switch arg {
+	case "":
+		verbosity, _ := l.replyStyle(sess)
+		return fmt.Sprintf("Verbosity: %s. Use /verbosity %s or reset.", verbosity, strings.Join(verbosityLevels, "|"))
+	case "reset":
+		sess.DeleteMeta(metaVerbosity)
+	default:
+		valid := false
+		for _, v := range verbosityLevels {
+			valid = valid || v == arg
+		}
+		if !valid {
+			return fmt.Sprintf("Unknown verbosity %q. Use one of: %s.", arg, strings.Join(verbosityLevels, ", "))
+		}
+		sess.SetMeta(metaVerbosity, arg)
+	}
+	l.Sessions.Save(sess)
+	verbosity, _ := l.replyStyle(sess)
+	return fmt.Sprintf("Verbosity set to %s for this chat.", verbosity)
+}
+
+func (l *AgentLoop) setMaxReplyChars(sess *session.Session, arg string) string {
+	switch arg {
+	case "":
+		_, maxChars := l.replyStyle(sess)
+		if maxChars <= 0 {
+			return "Replies are not limited. Use /maxlen <characters>, off or reset."
+		}
+		return fmt.Sprintf("Replies are limited to %d characters. Use /maxlen <characters>, off or reset.", maxChars)
+	case "reset":
+		sess.DeleteMeta(metaMaxReplyChars)
+	case "off", "0":
+		sess.SetMeta(metaMaxReplyChars, 0)
+	default:
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return "Usage: /maxlen <characters>, off or reset."
+		}
+		sess.SetMeta(metaMaxReplyChars, n)
+	}
+	l.Sessions.Save(sess)
+	_, maxChars := l.replyStyle(sess)
+	if maxChars <= 0 {
+		return "Replies are no longer limited in this chat."
+	}
+	return fmt.Sprintf("Replies in this chat are now limited to %d characters; send /more to see the rest of a longer one.", maxChars)
+}
+
+func (l *AgentLoop) setLanguage(sess *session.Session, arg string) string {
+	switch strings.ToLower(arg) {
+	case "":
+		return fmt.Sprintf("Reply language: %s. Use /lang <language>, auto, off or reset.", l.replyLanguage(sess))
+	case "reset":
+		sess.DeleteMeta(metaLanguage)
+	case "auto", "off":
+		sess.SetMeta(metaLanguage, strings.ToLower(arg))
+	default:
+		if name, ok := languageAliases[strings.ToLower(arg)]; ok {
+			arg = name
+		}
+		sess.SetMeta(metaLanguage, arg)
+	}
+	l.Sessions.Save(sess)
+	switch lang := l.replyLanguage(sess); lang {
+	case "auto":
+		return "I'll reply in the language you write in."
+	case "off":
+		return "Reply language matching is off for this chat."
+	default:
+		return fmt.Sprintf("I'll reply in %s in this chat.", lang)
+	}
+}
+
+// resolveDrafts posts or drops the message drafts held for the chat with
+// session key key.
+func (l *AgentLoop) resolveDrafts(key string, send bool) string {
+	var drafts *tools.DraftBox
+	if tool, ok := l.Tools.Get("message"); ok {
+		if messageTool, ok := tool.(*tools.MessageTool); ok {
+			drafts = messageTool.Drafts
+		}
+	}
+	channel, chatID := key, ""
+	if i := strings.Index(key, ":"); i >= 0 {
+		channel, chatID = key[:i], key[i+1:]
+	}
+	n := 0
+	if drafts != nil {
+		if send {
+			n = drafts.Send(channel, chatID)
+		} else {
+			n = drafts.Discard(channel, chatID)
+		}
+	}
+	switch {
+	case n == 0:
+		return "There are no drafts waiting for approval."
+	case send:
+		return fmt.Sprintf("Sent %d draft(s).", n)
+	default:
+		return fmt.Sprintf("Discarded %d draft(s).", n)
+	}
+}
+
+// maxReportEntries caps the entries listed by /report.
+const maxReportEntries = 30
+
+func (l *AgentLoop) activityReport(arg string) string {
+	day := time.Now()
+	switch arg = strings.ToLower(strings.TrimSpace(arg)); arg {
+	case "", "today":
+	case "yesterday":
+		day = day.AddDate(0, 0, -1)
+	default:
+		t, err := time.ParseInLocation("2006-01-02", arg, time.Local)
+		if err != nil {
+			return "Usage: /report [today|yesterday|YYYY-MM-DD]."
+		}
+		day = t
+	}
+	report, err := l.Activity.Report(day, maxReportEntries)
+	if err != nil {
+		return fmt.Sprintf("Failed to read the activity ledger: %v", err)
+	}
+	return report
+}
+
+// maxRestoreListed caps the archives listed by /restore list.
+const maxRestoreListed = 10
+
+// restoreCommand handles /restore [list|n], bringing back a conversation
+// archived by a reset. The current one is archived in its place.
+func (l *AgentLoop) restoreCommand(key, arg string) string {
+	archives, err := l.Sessions.Archives(key)
+	if err != nil {
+		return fmt.Sprintf("Failed to read archived conversations: %v", err)
+	}
+	if len(archives) == 0 {
+		return "There are no archived conversations for this chat."
+	}
+	if arg == "list" {
+		var sb strings.Builder
+		sb.WriteString("Archived conversations, newest first:")
+		for i, a := range archives {
+			if i == maxRestoreListed {
+				fmt.Fprintf(&sb, "\n... and %d older", len(archives)-i)
+				break
+			}
+			fmt.Fprintf(&sb, "\n%d. %s, %d messages", i+1, a.ArchivedAt.Format("2006-01-02 15:04"), a.Messages)
+		}
+		sb.WriteString("\nUse /restore <number> to bring one back.")
+		return sb.String()
+	}
+	n := 1
+	if arg != "" {
+		if n, err = strconv.Atoi(arg); err != nil || n < 1 || n > len(archives) {
+			return fmt.Sprintf("Usage: /restore [list|1-%d].", len(archives))
+		}
+	}
+	a := archives[n-1]
+	if err := l.Sessions.Restore(key, a.Path); err != nil {
+		return fmt.Sprintf("Failed to restore the conversation: %v", err)
+	}
+	return fmt.Sprintf("Restored the conversation archived %s (%d messages). The one it replaced is archived; /restore again to switch back.", a.ArchivedAt.Format("2006-01-02 15:04"), a.Messages)
+}
@@ -0,0 +1,239 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+const (
+	// keepRecentMessages are left out of the summary so the model still sees
+	// the latest exchanges verbatim.
+	keepRecentMessages = 4
+	// maxTrimmedToolResult is what long tool results are cut to when a
+	// request is still too large after summarizing.
+	maxTrimmedToolResult = 2000
+)
+
+// overflowNotice tells the user a turn is being retried with its history
+// summarized after the model rejected it as too long.
+const overflowNotice = "Conversation too long, summarizing…"
+
+// errConversationTooLong is reported when a request is still too long for
+// the model after summarizing.
+var errConversationTooLong = errors.New("this conversation is too long for the model, even summarized. Send /reset to start a new one")
+
+// requestSize returns the size in bytes of a request's messages and tools as JSON.
+func requestSize(messages, toolDefs []interface{}) int {
+	data, _ := json.Marshal(map[string]interface{}{"messages": messages, "tools": toolDefs})
+	return len(data)
+}
+
+// fitRequest keeps a request within agents.defaults.maxRequestBytes and
+// maxRequestMessages, and its estimated tokens within the model's context
+// window. Older history is summarized with the model first; if that is not
+// enough, long tool results are trimmed, the always-loaded skills dropped
+// from the system prompt and then the oldest messages dropped. The system
+// message and latest user message are kept.
+func (l *AgentLoop) fitRequest(ctx context.Context, messages, toolDefs []interface{}) []interface{} {
+	return l.compactRequest(ctx, messages, toolDefs, l.promptBudget())
+}
+
+// shrinkRequest compacts a request the provider rejected as longer than the
+// model's context window, which turned out smaller than thought: the
+// conversation after the system message is cut to half its tokens.
+func (l *AgentLoop) shrinkRequest(ctx context.Context, messages, toolDefs []interface{}) []interface{} {
+	fixed := promptTokens(messages[:1], toolDefs)
+	maxTokens := fixed + (promptTokens(messages, toolDefs)-fixed)/2
+	if budget := l.promptBudget(); budget > 0 && budget < maxTokens {
+		maxTokens = budget
+	}
+	return l.compactRequest(ctx, messages, toolDefs, maxTokens)
+}
+
+// compactRequest is fitRequest with maxTokens as the token limit.
+func (l *AgentLoop) compactRequest(ctx context.Context, messages, toolDefs []interface{}, maxTokens int) []interface{} {
+	maxBytes := l.Config.Agents.Defaults.MaxRequestBytes
+	maxMessages := l.Config.Agents.Defaults.MaxRequestMessages
+	fits := func() bool {
+		return (maxMessages <= 0 || len(messages) <= maxMessages) &&
+			(maxBytes <= 0 || requestSize(messages, toolDefs) <= maxBytes) &&
+			(maxTokens <= 0 || promptTokens(messages, toolDefs) <= maxTokens)
+	}
+	if fits() {
+		return messages
+	}
+	log.Printf("Request too large (%d messages, %d bytes, ~%d tokens), compacting", len(messages), requestSize(messages, toolDefs), promptTokens(messages, toolDefs))
+
+	messages = l.summarizeHistory(ctx, messages)
+	if fits() {
+		return messages
+	}
+
+	for _, m := range messages {
+		if msg, ok := m.(map[string]interface{}); ok && msg["role"] == "tool" {
+			if content, _ := msg["content"].(string); len(content) > maxTrimmedToolResult {
+				head, rest := truncateReply(content, maxTrimmedToolResult)
+				msg["content"] = fmt.Sprintf("%s\n... (%d more characters trimmed to fit the request)", head, len([]rune(rest)))
+			}
+		}
+	}
+
+	if !fits() {
+		messages = withoutActiveSkills(messages)
+	}
+
+	for !fits() {
+		i := 1
+		if i < len(messages) && i == lastUserIndex(messages) {
+			i++
+		}
+		if i >= len(messages) {
+			break
+		}
+		// Tool results cannot outlive the assistant message that called them
+		end := i + 1
+		for end < len(messages) && messageRole(messages[end]) == "tool" {
+			end++
+		}
+		messages = append(messages[:i], messages[end:]...)
+	}
+	log.Printf("Compacted request to %d messages, %d bytes, ~%d tokens", len(messages), requestSize(messages, toolDefs), promptTokens(messages, toolDefs))
+	return messages
+}
+
+// withoutActiveSkills removes the full text of the always-loaded skills
+// from the system message. They stay listed in the skills summary, so the
+// model can still read them with read_file.
+func withoutActiveSkills(messages []interface{}) []interface{} {
+	system, ok := messages[0].(map[string]interface{})
+	if !ok || system["role"] != "system" {
+		return messages
+	}
+	content, _ := system["content"].(string)
+	sections := strings.Split(content, "\n\n---\n\n")
+	kept := sections[:0]
+	for _, s := range sections {
+		if !strings.HasPrefix(s, "# Active Skills\n") {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) == len(sections) {
+		return messages
+	}
+	log.Printf("Dropped active skills from the system prompt to fit the context window")
+	trimmed := make(map[string]interface{}, len(system))
+	for k, v := range system {
+		trimmed[k] = v
+	}
+	trimmed["content"] = strings.Join(kept, "\n\n---\n\n")
+	messages[0] = trimmed
+	return messages
+}
+
+// summarizeHistory replaces the history before the latest user message,
+// except the last few messages, with a model-written summary in the system
+// message. On failure the messages are returned unchanged.
+func (l *AgentLoop) summarizeHistory(ctx context.Context, messages []interface{}) []interface{} {
+	cut := lastUserIndex(messages) - keepRecentMessages
+	for cut > 1 && messageRole(messages[cut]) == "tool" {
+		cut--
+	}
+	if cut <= 1 {
+		return messages
+	}
+
+	var transcript strings.Builder
+	for _, m := range messages[1:cut] {
+		text := messageText(m)
+		if len(text) > maxTrimmedToolResult {
+			text, _ = truncateReply(text, maxTrimmedToolResult)
+		}
+		if text != "" {
+			transcript.WriteString(fmt.Sprintf("%s: %s\n\n", messageRole(m), text))
+		}
+	}
+	input := transcript.String()
+	if limit := l.Config.Agents.Defaults.MaxRequestBytes / 2; limit > 0 && len(input) > limit {
+		input = input[len(input)-limit:]
+	}
+
+	summary, err := l.summarizeTranscript(ctx, input)
+	if err != nil {
+		log.Printf("Failed to summarize history: %v", err)
+		return messages
+	}
+
+	compacted := append([]interface{}{messages[0]}, messages[cut:]...)
+	return l.Context.AddSystemNote(compacted, summaryNote(summary))
+}
+
+// summarizeTranscript asks the model for a short summary of a conversation transcript.
+func (l *AgentLoop) summarizeTranscript(ctx context.Context, transcript string) (string, error) {
+	resp, err := l.Provider.Chat(ctx, []interface{}{
+		map[string]interface{}{"role": "system", "content": "Summarize this earlier part of a conversation for your own future reference. Keep facts, decisions, names, open questions and anything the user asked you to remember. Use at most 200 words."},
+		map[string]interface{}{"role": "user", "content": transcript},
+	}, nil, l.Model)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(resp.Content) == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return strings.TrimSpace(resp.Content), nil
+}
+
+// summaryNote is the system prompt section carrying a conversation summary.
+func summaryNote(summary string) string {
+	if summary == "" {
+		return ""
+	}
+	return "## Earlier Conversation (summarized)\n" + summary
+}
+
+// lastUserIndex returns the index of the last user message, or -1.
+func lastUserIndex(messages []interface{}) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messageRole(messages[i]) == "user" {
+			return i
+		}
+	}
+	return -1
+}
+
+func messageRole(m interface{}) string {
+	msg, _ := m.(map[string]interface{})
+	role, _ := msg["role"].(string)
+	return role
+}
+
+// messageText returns the text of a message, including the text parts of
+// multimodal content and the names of tools it called.
+func messageText(m interface{}) string {
+	msg, _ := m.(map[string]interface{})
+	var parts []string
+	switch content := msg["content"].(type) {
+	case string:
+		parts = append(parts, content)
+	case []map[string]interface{}:
+		for _, part := range content {
+			if part["type"] == "text" {
+				text, _ := part["text"].(string)
+				parts = append(parts, text)
+			}
+		}
+	}
+	if calls, ok := msg["tool_calls"].([]interface{}); ok {
+		for _, c := range calls {
+			call, _ := c.(map[string]interface{})
+			fn, _ := call["function"].(map[string]interface{})
+			if name, ok := fn["name"].(string); ok {
+				parts = append(parts, "[called "+name+"]")
+			}
+		}
+	}
+	return strings.TrimSpace(strings.Join(parts, " "))
+}
@@ -1,9 +1,11 @@
 package agent
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"mime"
 	"os"
 	"path/filepath"
@@ -11,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/HKUDS/nanobot-go/pkg/buildinfo"
 	"github.com/HKUDS/nanobot-go/pkg/memory"
 	"github.com/HKUDS/nanobot-go/pkg/skills"
 )
@@ -20,6 +23,24 @@ type ContextBuilder struct {
 	Workspace string
 	Memory    *memory.MemoryStore
 	Skills    *skills.Loader
+	// MaxInlineFileBytes bounds text attachments inlined into the user message.
+	MaxInlineFileBytes int
+	// RemoteImages is how http(s) media URLs reach the model: "fetch"
+	// downloads them from public addresses (up to MaxRemoteImageBytes) and
+	// inlines them, "url" passes the URL for the provider to fetch, anything
+	// else ("off") mentions the link only.
+	RemoteImages        string
+	MaxRemoteImageBytes int
+	// ReadOnly tells the model that file writes, exec and cron changes are disabled.
+	ReadOnly bool
+	// MemorySearch, when set, replaces the full MEMORY.md and today's notes
+	// in the prompt with the MemoryTopK memories most relevant to the message.
+	MemorySearch   *memory.VectorIndex
+	MemoryTopK     int
+	MemoryMinScore float64
+	// CodingRepo, when set, adds coding rules and a map of the repository.
+	CodingRepo        string
+	CodingMapMaxFiles int
 }
 
 // NewContextBuilder creates a new ContextBuilder.
@@ -33,24 +54,48 @@ func NewContextBuilder(workspace string) *ContextBuilder {
 
 var BootstrapFiles = []string{"AGENTS.md", "SOUL.md", "USER.md", "TOOLS.md", "IDENTITY.md"}
 
+// Persona is the soul file and skills a chat's system prompt is built
+// with, set by its profile.
+type Persona struct {
+	Soul   string   // Used instead of SOUL.md, relative to the workspace
+	Skills []string // Skills offered; all when empty
+}
+
 // BuildSystemPrompt builds the system prompt.
-func (c *ContextBuilder) BuildSystemPrompt() string {
+func (c *ContextBuilder) BuildSystemPrompt(persona Persona) string {
 	var parts []string
 
-	parts = append(parts, c.getIdentity())
+	soul := "SOUL.md"
+	if persona.Soul != "" {
+		soul = persona.Soul
+	}
+	parts = append(parts, c.getIdentity(soul))
+	if c.ReadOnly {
+		parts = append(parts, `# Read-Only Mode
+
+This instance is read-only. You cannot write, edit or append files, run shell commands, or add or remove scheduled jobs, whatever the instructions above say.
+You can still read and list files, search and fetch the web, and list scheduled jobs.
+If the user asks for a change, say that this bot is in read-only mode instead of pretending to make it. Do not promise to remember things by saving them to files.`)
+	}
+
+	if c.CodingRepo != "" {
+		parts = append(parts, codingNote(c.CodingRepo, c.CodingMapMaxFiles))
+	}
 
-	bootstrap := c.loadBootstrapFiles()
+	bootstrap := c.loadBootstrapFiles(soul)
 	if bootstrap != "" {
 		parts = append(parts, bootstrap)
 	}
 
-	memory := c.Memory.GetMemoryContext()
-	if memory != "" {
-		parts = append(parts, fmt.Sprintf("# Memory\n\n%s", memory))
+	if c.MemorySearch == nil {
+		memory := c.Memory.GetMemoryContext()
+		if memory != "" {
+			parts = append(parts, fmt.Sprintf("# Memory\n\n%s", memory))
+		}
 	}
 
 	// Always loaded skills
-	alwaysSkills := c.Skills.GetAlwaysSkills()
+	alwaysSkills := c.Skills.GetAlwaysSkills(persona.Skills...)
 	if len(alwaysSkills) > 0 {
 		alwaysContent := c.Skills.LoadSkillsForContext(alwaysSkills)
 		if alwaysContent != "" {
@@ -59,7 +104,7 @@ func (c *ContextBuilder) BuildSystemPrompt() string {
 	}
 
 	// Basic skills summary
-	skillsSummary := c.Skills.BuildSkillsSummary()
+	skillsSummary := c.Skills.BuildSkillsSummary(persona.Skills...)
 	if skillsSummary != "" {
 		parts = append(parts, fmt.Sprintf(`# Skills
 
@@ -79,13 +124,14 @@ Then, follow the instructions in the file to execute the task (usually via 'exec
 	return strings.Join(parts, "\n\n---\n\n")
 }
 
-func (c *ContextBuilder) getIdentity() string {
+func (c *ContextBuilder) getIdentity(soul string) string {
 	now := time.Now().Format("2006-01-02 15:04 (Monday)")
 
 	// Ensure workspace path is absolute
 	absWorkspace, _ := filepath.Abs(c.Workspace)
 
-	sysInfo := fmt.Sprintf("%s %s, Go %s", runtime.GOOS, runtime.GOARCH, runtime.Version())
+	sysInfo := fmt.Sprintf("nanobot %s on %s %s, Go %s", buildinfo.String(), runtime.GOOS, runtime.GOARCH, runtime.Version())
+	soulPath := filepath.Join(absWorkspace, soul)
 
 	return fmt.Sprintf(`# nanobot 🐈
 
@@ -119,10 +165,11 @@ Always be helpful, accurate, and concise. When using tools, explain what you're
 You have a long-term memory file at %s/memory/MEMORY.md.
 When the user provides important personal information (e.g., name, location, preferences) or explicitly asks you to remember something, you **MUST** immediately use the 'append_file' tool to save it to this file.
 Do not just say "I will remember that" — you must physically write it to the file using the 'append_file' tool.
+For facts that only matter to the current chat or the current user, use the 'memory' tool instead (set share=true for facts about the user that should follow them to their other chats).
 
 ## Identity & Behavior Management
-You have a soul file at %s/SOUL.md.
-When the user defines your persona, character, personality, or fundamental behavioral rules (e.g., "You are a virtual girlfriend", "Always answer in French"), you **MUST** save this definition to %s/SOUL.md using the 'write_file' (to overwrite/initialize) or 'append_file' tool.
+You have a soul file at %s.
+When the user defines your persona, character, personality, or fundamental behavioral rules (e.g., "You are a virtual girlfriend", "Always answer in French"), you **MUST** save this definition to %s using the 'write_file' (to overwrite/initialize) or 'append_file' tool.
 This ensures you maintain this personality across sessions.
 
 ## Conversation Handling
@@ -130,13 +177,17 @@ In group chats, user messages may be prefixed with '[Name]:' (e.g., '[Alice]: He
 - This indicates the sender's name.
 - You should associate this name with the user in your context.
 - When replying, address the user by this name to be more personal.
-- If you need to remember facts about this specific user, associate them with this name in your memory.`, now, sysInfo, absWorkspace, absWorkspace, absWorkspace, absWorkspace, absWorkspace, absWorkspace, absWorkspace)
+- If you need to remember facts about this specific user, associate them with this name in your memory.`, now, sysInfo, absWorkspace, absWorkspace, absWorkspace, absWorkspace, absWorkspace, soulPath, soulPath)
 }
 
-func (c *ContextBuilder) loadBootstrapFiles() string {
+// loadBootstrapFiles reads the bootstrap files, with soul in place of SOUL.md.
+func (c *ContextBuilder) loadBootstrapFiles(soul string) string {
 	var parts []string
 	for _, filename := range BootstrapFiles {
 		path := filepath.Join(c.Workspace, filename)
+		if filename == "SOUL.md" {
+			path = filepath.Join(c.Workspace, soul)
+		}
 		if _, err := os.Stat(path); err == nil {
 			content, _ := ioutil.ReadFile(path)
 			parts = append(parts, fmt.Sprintf("## %s\n\n%s", filename, string(content)))
@@ -148,19 +199,55 @@ func (c *ContextBuilder) loadBootstrapFiles() string {
 	return strings.Join(parts, "\n\n")
 }
 
+// relevantMemories returns the memories matching message when memory search
+// is on. If the search fails, all of MEMORY.md and today's notes are used.
+func (c *ContextBuilder) relevantMemories(message string) string {
+	if c.MemorySearch == nil {
+		return ""
+	}
+	if strings.TrimSpace(message) == "" {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	hits, err := c.MemorySearch.Search(ctx, message, c.MemoryTopK, c.MemoryMinScore)
+	if err != nil {
+		log.Printf("Memory search failed, using full memory: %v", err)
+		return c.Memory.GetMemoryContext()
+	}
+	if len(hits) == 0 {
+		return ""
+	}
+	return "## Relevant Memories\nRetrieved from your memory files; use the memory_search tool to look up more.\n" + memory.FormatHits(hits)
+}
+
 // BuildMessages builds the complete message list for an LLM call.
+// contact is the sender's contact name when shared context applies, or "".
 func (c *ContextBuilder) BuildMessages(
 	history []map[string]interface{},
 	currentMessage string,
 	media []string,
 	channel string,
 	chatID string,
+	contact string,
+	persona Persona,
 ) []interface{} {
 	var messages []interface{}
 
-	systemPrompt := c.BuildSystemPrompt()
+	systemPrompt := c.BuildSystemPrompt(persona)
+	if relevant := c.relevantMemories(currentMessage); relevant != "" {
+		systemPrompt += "\n\n---\n\n# Memory\n\n" + relevant
+	}
 	if channel != "" && chatID != "" {
 		systemPrompt += fmt.Sprintf("\n\n## Current Session\nChannel: %s\nChat ID: %s", channel, chatID)
+		if contact != "" {
+			systemPrompt += fmt.Sprintf("\nContact: %s", contact)
+		}
+
+		chatMemory := c.Memory.GetChatMemoryContext(channel+":"+chatID, contact)
+		if chatMemory != "" {
+			systemPrompt += "\n\n" + chatMemory
+		}
 	}
 	messages = append(messages, map[string]interface{}{
 		"role":    "system",
@@ -186,9 +273,18 @@ func (c *ContextBuilder) buildUserContent(text string, media []string) interface
 	}
 
 	var content []map[string]interface{}
+	var attachments []string
 
 	for _, path := range media {
-		if _, err := os.Stat(path); err == nil {
+		if isRemoteMedia(path) {
+			if part, note := c.remoteImage(path); part != nil {
+				content = append(content, part)
+			} else {
+				attachments = append(attachments, note)
+			}
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
 			mimeType := mime.TypeByExtension(filepath.Ext(path))
 			if strings.HasPrefix(mimeType, "image/") {
 				data, _ := ioutil.ReadFile(path)
@@ -199,10 +295,18 @@ func (c *ContextBuilder) buildUserContent(text string, media []string) interface
 						"url": fmt.Sprintf("data:%s;base64,%s", mimeType, b64),
 					},
 				})
+				// The path lets the model keep the image or send it on
+				attachments = append(attachments, fmt.Sprintf("[Attached image: %s, saved at %s]", filepath.Base(path), path))
+			} else if !info.IsDir() {
+				attachments = append(attachments, c.describeAttachment(path, info))
 			}
 		}
 	}
 
+	if len(attachments) > 0 {
+		text = strings.TrimSpace(text + "\n\n" + strings.Join(attachments, "\n\n"))
+	}
+
 	if len(content) == 0 {
 		return text
 	}
@@ -247,3 +351,15 @@ func (c *ContextBuilder) AddAssistantMessage(
 	messages = append(messages, msg)
 	return messages
 }
+
+// AddSystemNote appends a per-turn instruction to the system message.
+func (c *ContextBuilder) AddSystemNote(messages []interface{}, note string) []interface{} {
+	if note == "" || len(messages) == 0 {
+		return messages
+	}
+	if sys, ok := messages[0].(map[string]interface{}); ok && sys["role"] == "system" {
+		content, _ := sys["content"].(string)
+		sys["content"] = content + "\n\n" + note
+	}
+	return messages
+}
@@ -0,0 +1,191 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/secrets"
+)
+
+// identity returns who owns the credentials used for a message.
+func (l *AgentLoop) identity(msg bus.InboundMessage) string {
+	return secrets.Identity(l.Contacts.Resolve(msg.Channel, msg.SenderID), msg.Channel, msg.SenderID)
+}
+
+// credentialEnv returns the exec environment variables of the configured
+// services, set to identity's secrets, or to "" where identity has none
+// so the variable is removed. An empty identity gets none.
+func (l *AgentLoop) credentialEnv(identity string) map[string]string {
+	if len(l.Config.Tools.Credentials) == 0 {
+		return nil
+	}
+	env := make(map[string]string, len(l.Config.Tools.Credentials))
+	for service, c := range l.Config.Tools.Credentials {
+		if c.Env == "" {
+			continue
+		}
+		env[c.Env] = ""
+		if identity == "" {
+			continue
+		}
+		cred, ok, err := l.Secrets.Get(identity, service)
+		if err != nil {
+			log.Printf("Failed to read credentials: %v", err)
+			continue
+		}
+		if ok && cred.Expired() && cred.RefreshToken != "" {
+			if cred, err = l.OAuth.Refresh(identity, service, cred); err != nil {
+				log.Printf("Failed to renew %s token of %s: %v", service, identity, err)
+			}
+		}
+		if ok && !cred.Expired() {
+			env[c.Env] = cred.Token
+		}
+	}
+	return env
+}
+
+// credentialNote tells the model which of the user's credentials exec
+// commands can use, without their values.
+func credentialNote(env map[string]string) string {
+	var set []string
+	for name, value := range env {
+		if value != "" {
+			set = append(set, "$"+name)
+		}
+	}
+	if len(set) == 0 {
+		return ""
+	}
+	sort.Strings(set)
+	return fmt.Sprintf("The user's own credentials are available to exec commands as %s. Never print or repeat their values.", strings.Join(set, ", "))
+}
+
+// metaGroup is the inbound metadata key a channel sets on messages from a
+// group chat.
+const metaGroup = "group"
+
+func isGroup(msg bus.InboundMessage) bool {
+	group, _ := msg.Metadata[metaGroup].(bool)
+	return group
+}
+
+// connectCommand handles /connect <service>, replying with the page where
+// the user authorizes access to their account. Whoever opens the page
+// connects their account as the user, so it is only sent in a direct chat.
+func (l *AgentLoop) connectCommand(msg bus.InboundMessage, args []string) string {
+	var services []string
+	for name, c := range l.Config.Tools.Credentials {
+		if c.OAuth != nil {
+			services = append(services, name)
+		}
+	}
+	if len(services) == 0 {
+		return "No accounts can be connected here."
+	}
+	sort.Strings(services)
+	if len(args) != 1 {
+		return "Usage: /connect <service>. Services: " + strings.Join(services, ", ") + "."
+	}
+	if isGroup(msg) {
+		return "Send /connect in a direct chat with me; the link connects the account of whoever opens it."
+	}
+	service := strings.ToLower(args[0])
+	link, err := l.OAuth.AuthURL(secrets.Authorization{
+		Identity: l.identity(msg),
+		Service:  service,
+		Channel:  msg.Channel,
+		ChatID:   msg.ChatID,
+	})
+	if err != nil {
+		return fmt.Sprintf("Cannot connect %s: %v.", service, err)
+	}
+	return fmt.Sprintf("Open this link within 15 minutes to connect your %s account:\n%s", service, link)
+}
+
+// RedactSecrets replaces the secret of a /credential set command, to keep
+// it out of the bus journal. It reports whether content was such a command.
+func RedactSecrets(content string) (string, bool) {
+	fields := strings.Fields(content)
+	if len(fields) < 4 || strings.ToLower(fields[1]) != "set" {
+		return content, false
+	}
+	if cmd := strings.ToLower(fields[0]); cmd != "/credential" && cmd != "/credentials" {
+		return content, false
+	}
+	return strings.Join(fields[:3], " ") + " [redacted]", true
+}
+
+// credentialCommand handles /credential [set <service> <secret> | remove <service>].
+func (l *AgentLoop) credentialCommand(identity string, args []string) string {
+	services := l.Config.Tools.Credentials
+	if len(services) == 0 {
+		return "No services take personal credentials here."
+	}
+	usage := "Usage: /credential, /credential set <service> <secret> or /credential remove <service>."
+	action := ""
+	if len(args) > 0 {
+		action = strings.ToLower(args[0])
+	}
+	switch action {
+	case "":
+		stored, err := l.Secrets.Services(identity)
+		if err != nil {
+			return fmt.Sprintf("Failed to read credentials: %v", err)
+		}
+		have := make(map[string]bool, len(stored))
+		for _, s := range stored {
+			have[s] = true
+		}
+		names := make([]string, 0, len(services))
+		for name := range services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var sb strings.Builder
+		sb.WriteString("Your credentials:")
+		for _, name := range names {
+			state := "not set"
+			if have[name] {
+				state = "set"
+			}
+			line := fmt.Sprintf("\n- %s: %s", name, state)
+			if d := services[name].Description; d != "" {
+				line += " (" + d + ")"
+			}
+			sb.WriteString(line)
+		}
+		return sb.String()
+
+	case "set":
+		if len(args) != 3 {
+			return usage
+		}
+		service := strings.ToLower(args[1])
+		if _, ok := services[service]; !ok {
+			return fmt.Sprintf("Unknown service %q.", service)
+		}
+		if err := l.Secrets.Set(identity, service, secrets.Credential{Token: args[2]}); err != nil {
+			return fmt.Sprintf("Failed to save the credential: %v", err)
+		}
+		return fmt.Sprintf("Saved your %s credential. It is used only for your requests; delete the message that contained it if others can read this chat.", service)
+
+	case "remove":
+		if len(args) != 2 {
+			return usage
+		}
+		service := strings.ToLower(args[1])
+		removed, err := l.Secrets.Remove(identity, service)
+		if err != nil {
+			return fmt.Sprintf("Failed to remove the credential: %v", err)
+		}
+		if !removed {
+			return fmt.Sprintf("You have no %s credential.", service)
+		}
+		return fmt.Sprintf("Removed your %s credential.", service)
+	}
+	return usage
+}
@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/session"
+)
+
+// Ratings a reply can be given with /good and /bad or a reaction.
+const (
+	ratingGood = "good"
+	ratingBad  = "bad"
+)
+
+// metaFeedback is the inbound metadata key a channel sets to the rating
+// when a user reacts to one of the bot's replies.
+const metaFeedback = "feedback"
+
+// feedbackContextMessages is how many messages before the rated exchange
+// are kept with it, so the exchange can be judged in context.
+const feedbackContextMessages = 6
+
+// feedbackMu serializes appends to feedback datasets.
+var feedbackMu sync.Mutex
+
+// feedbackRecord is one rated exchange in the feedback dataset, a JSONL
+// file under the workspace.
+type feedbackRecord struct {
+	Time     time.Time                `json:"time"`
+	Rating   string                   `json:"rating"`
+	Comment  string                   `json:"comment,omitempty"`
+	Source   string                   `json:"source"` // "command" or "reaction"
+	Agent    string                   `json:"agent,omitempty"`
+	Channel  string                   `json:"channel"`
+	ChatID   string                   `json:"chat_id"`
+	SenderID string                   `json:"sender_id"`
+	Model    string                   `json:"model"`
+	Profile  string                   `json:"profile,omitempty"`
+	Context  []map[string]interface{} `json:"context,omitempty"`
+	Input    string                   `json:"input"`
+	Output   string                   `json:"output"`
+}
+
+// ProtectFiles registers the files the agent keeps chat content in besides
+// sessions and memory, the feedback dataset and research tasks, for
+// encryption at rest.
+func ProtectFiles(workspace string) {
+	atrest.Protect(filepath.Join(workspace, "feedback"))
+	atrest.Protect(filepath.Join(workspace, researchDir))
+}
+
+// feedbackPath returns the feedback dataset of the agent's workspace.
+func (l *AgentLoop) feedbackPath() string {
+	return filepath.Join(l.Workspace, "feedback", "dataset.jsonl")
+}
+
+// feedbackCommand handles /good and /bad [comment].
+func (l *AgentLoop) feedbackCommand(sess *session.Session, msg bus.InboundMessage, rating string) string {
+	comment := strings.TrimSpace(msg.Content)
+	if i := strings.IndexAny(comment, " \t\n"); i >= 0 {
+		comment = strings.TrimSpace(comment[i:])
+	} else {
+		comment = ""
+	}
+	ok, err := l.recordFeedback(sess, msg, rating, comment, "command")
+	if err != nil {
+		log.Printf("Error recording feedback: %v", err)
+		return "Sorry, the feedback could not be saved."
+	}
+	if !ok {
+		return "There is no reply to rate yet."
+	}
+	if rating == ratingBad {
+		return "Thanks, noted that the last reply was not helpful."
+	}
+	return "Thanks, noted that the last reply was helpful."
+}
+
+// recordFeedback appends the latest exchange of the chat, rated, to the
+// feedback dataset. It reports false if the chat has no exchange yet.
+func (l *AgentLoop) recordFeedback(sess *session.Session, msg bus.InboundMessage, rating, comment, source string) (bool, error) {
+	reply := -1
+	for i := len(sess.Messages) - 1; i >= 0; i-- {
+		if role, _ := sess.Messages[i]["role"].(string); role == "assistant" {
+			reply = i
+			break
+		}
+	}
+	if reply < 1 {
+		return false, nil
+	}
+	input := reply - 1
+	if role, _ := sess.Messages[input]["role"].(string); role != "user" {
+		return false, nil
+	}
+
+	profileName, profile := l.chatProfile(sess, msg.Channel, msg.ChatID)
+	model, _, _ := l.applyProfile(context.Background(), sess, profile)
+	record := feedbackRecord{
+		Time:     time.Now(),
+		Rating:   rating,
+		Comment:  comment,
+		Source:   source,
+		Agent:    l.Name,
+		Channel:  msg.Channel,
+		ChatID:   msg.ChatID,
+		SenderID: msg.SenderID,
+		Model:    model,
+		Profile:  profileName,
+		Input:    fmt.Sprint(sess.Messages[input]["content"]),
+		Output:   fmt.Sprint(sess.Messages[reply]["content"]),
+	}
+	start := input - feedbackContextMessages
+	if start < 0 {
+		start = 0
+	}
+	for _, m := range sess.Messages[start:input] {
+		record.Context = append(record.Context, map[string]interface{}{"role": m["role"], "content": m["content"]})
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return false, err
+	}
+	path := l.feedbackPath()
+	feedbackMu.Lock()
+	defer feedbackMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	if err := atrest.AppendFile(path, append(line, '\n'), 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/config"
+	"github.com/HKUDS/nanobot-go/pkg/session"
+)
+
+const (
+	metaSummary        = "summary"
+	metaSummarizedUpTo = "summarized_up_to"
+	// defaultHistoryMessages is the most session messages sent verbatim per
+	// turn when the config does not say.
+	defaultHistoryMessages = 50
+)
+
+func historyTokens(msgs []map[string]interface{}) int {
+	total := 0
+	for _, m := range msgs {
+		total += messageTokens(m)
+	}
+	return total
+}
+
+// historyLimits returns the most messages and the token budget of the
+// history sent with a turn in a channel: the agent defaults, overridden
+// by channelHistory and then by the chat's profile. A budget of 0 means
+// history is not summarized.
+func (l *AgentLoop) historyLimits(channel string, p config.ProfileConfig) config.HistoryConfig {
+	defaults := l.Config.Agents.Defaults
+	limits := config.HistoryConfig{Messages: defaults.HistoryMessages, TokenBudget: defaults.HistoryTokenBudget}
+	override := func(o config.HistoryConfig) {
+		if o.Messages > 0 {
+			limits.Messages = o.Messages
+		}
+		if o.TokenBudget != 0 {
+			limits.TokenBudget = o.TokenBudget
+		}
+	}
+	if c, ok := defaults.ChannelHistory[channel]; ok {
+		override(c)
+	}
+	if p.History != nil {
+		override(*p.History)
+	}
+	if limits.Messages <= 0 {
+		limits.Messages = defaultHistoryMessages
+	}
+	if limits.TokenBudget < 0 {
+		limits.TokenBudget = 0
+	}
+	return limits
+}
+
+// sessionHistory returns the history sent with a turn and the summary of
+// the turns before it. When the unsummarized history exceeds the limits,
+// its older part is first folded into the summary kept in the session
+// metadata.
+func (l *AgentLoop) sessionHistory(sess *session.Session, limits config.HistoryConfig) ([]map[string]interface{}, string) {
+	maxMessages, budget := limits.Messages, limits.TokenBudget
+	if budget <= 0 {
+		return sess.GetHistory(maxMessages), ""
+	}
+
+	summary, _ := sess.Metadata[metaSummary].(string)
+	upTo, _ := metaInt(sess.Metadata, metaSummarizedUpTo)
+	if upTo > len(sess.Messages) {
+		summary, upTo = "", 0
+	}
+
+	recent := sess.Messages[upTo:]
+	if len(recent) > maxMessages || historyTokens(recent) > budget {
+		if cut := upTo + historyCut(recent, budget/2, maxMessages/2); cut > upTo {
+			folded, err := l.foldIntoSummary(summary, sess.Messages[upTo:cut])
+			if err != nil {
+				log.Printf("Failed to summarize history of %s: %v", sess.Key, err)
+			} else {
+				log.Printf("Summarized %d messages of %s", cut-upTo, sess.Key)
+				summary, upTo = folded, cut
+				sess.SetMeta(metaSummary, summary)
+				sess.SetMeta(metaSummarizedUpTo, upTo)
+				l.Sessions.Save(sess)
+			}
+		}
+	}
+	return sess.GetHistorySince(upTo, maxMessages), summary
+}
+
+// historyCut returns how many of msgs to summarize so that the rest fits
+// in keepTokens and keepMessages, keeping at least keepRecentMessages and
+// starting the kept part at a user message.
+func historyCut(msgs []map[string]interface{}, keepTokens, keepMessages int) int {
+	cut := len(msgs)
+	tokens := 0
+	for cut > 0 {
+		next := historyTokens(msgs[cut-1 : cut])
+		kept := len(msgs) - cut
+		if kept >= keepRecentMessages && (tokens+next > keepTokens || kept >= keepMessages) {
+			break
+		}
+		tokens += next
+		cut--
+	}
+	for cut > 0 && cut < len(msgs) {
+		if role, _ := msgs[cut]["role"].(string); role == "user" {
+			break
+		}
+		cut++
+	}
+	if cut >= len(msgs) {
+		return 0
+	}
+	return cut
+}
+
+// foldIntoSummary returns a new summary covering the previous summary and msgs.
+func (l *AgentLoop) foldIntoSummary(previous string, msgs []map[string]interface{}) (string, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		transcript.WriteString("Summary of the conversation before this:\n" + previous + "\n\n")
+	}
+	for _, m := range msgs {
+		role, _ := m["role"].(string)
+		content, _ := m["content"].(string)
+		if len(content) > maxTrimmedToolResult {
+			content, _ = truncateReply(content, maxTrimmedToolResult)
+		}
+		if content != "" {
+			transcript.WriteString(fmt.Sprintf("%s: %s\n\n", role, content))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(l.baseCtx, 2*time.Minute)
+	defer cancel()
+	return l.summarizeTranscript(ctx, transcript.String())
+}
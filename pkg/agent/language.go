@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"fmt"
+	"unicode"
+
+	"github.com/HKUDS/nanobot-go/pkg/session"
+)
+
+// metaLanguage is the session metadata key for a chat's reply language.
+const metaLanguage = "language"
+
+// languageAliases maps short codes accepted by /lang to language names.
+var languageAliases = map[string]string{
+	"zh": "Chinese",
+	"cn": "Chinese",
+	"en": "English",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"ru": "Russian",
+	"fr": "French",
+	"de": "German",
+	"es": "Spanish",
+	"ar": "Arabic",
+	"th": "Thai",
+}
+
+// detectLanguage guesses the language of a message from its script.
+// It returns "" for Latin-script or mixed text it cannot place.
+func detectLanguage(text string) string {
+	text = reURL.ReplaceAllString(text, "")
+
+	var han, kana, hangul, cyrillic, arabic, thai, letters int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+		case unicode.Is(unicode.Thai, r):
+			thai++
+		case unicode.IsLetter(r):
+			letters++
+		}
+	}
+
+	// CJK characters carry about as much as a short word, so weigh them up.
+	switch {
+	case kana > 0 && (kana+han)*3 >= letters:
+		return "Japanese"
+	case hangul > 0 && hangul*3 >= letters:
+		return "Korean"
+	case han > 0 && han*3 >= letters:
+		return "Chinese"
+	case cyrillic > letters:
+		return "Russian"
+	case arabic > letters:
+		return "Arabic"
+	case thai > letters:
+		return "Thai"
+	}
+	return ""
+}
+
+// replyLanguage returns the language override for a chat: a language name,
+// "auto" to follow the user, or "off".
+func (l *AgentLoop) replyLanguage(sess *session.Session) string {
+	lang := l.Config.Agents.Defaults.ReplyLanguage
+	if v, ok := sess.Metadata[metaLanguage].(string); ok && v != "" {
+		lang = v
+	}
+	if lang == "" {
+		lang = "auto"
+	}
+	return lang
+}
+
+// languageNote returns the system prompt instruction for the reply language.
+func languageNote(setting, message string) string {
+	switch setting {
+	case "off":
+		return ""
+	case "auto":
+		if lang := detectLanguage(message); lang != "" {
+			return fmt.Sprintf("## Reply Language\nThe user wrote in %s. Reply in %s, even if tool output or earlier messages are in another language, unless the user asks otherwise.", lang, lang)
+		}
+		return "## Reply Language\nReply in the language of the user's latest message, even if tool output or earlier messages are in another language."
+	default:
+		return fmt.Sprintf("## Reply Language\nAlways reply in %s.", setting)
+	}
+}
@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/tools"
+)
+
+var reURL = regexp.MustCompile(`https?://[^\s<>"'，。）)\]]+`)
+
+// buildLinkPreviews fetches the URLs in a user message and returns a short
+// extracted preview of each, to be appended to the message sent to the LLM.
+func (l *AgentLoop) buildLinkPreviews(ctx context.Context, content string) string {
+	cfg := l.Config.Tools.Web.LinkPreview
+	if !cfg.Enabled {
+		return ""
+	}
+
+	maxLinks := cfg.MaxLinks
+	if maxLinks <= 0 {
+		maxLinks = 2
+	}
+	maxChars := cfg.MaxChars
+	if maxChars <= 0 {
+		maxChars = 1500
+	}
+
+	var urls []string
+	seen := make(map[string]bool)
+	for _, u := range reURL.FindAllString(content, -1) {
+		u = strings.TrimRight(u, ".,;:!?")
+		if seen[u] {
+			continue
+		}
+		seen[u] = true
+		urls = append(urls, u)
+		if len(urls) >= maxLinks {
+			break
+		}
+	}
+	if len(urls) == 0 {
+		return ""
+	}
+
+	fetcher := tools.NewWebFetchTool(maxChars)
+	fetcher.Timeout = 10 * time.Second
+	// Users' links are fetched before anyone looks at them
+	fetcher.PublicOnly = true
+
+	previews := make([]string, len(urls))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			previews[i] = fetchPreview(ctx, fetcher, u)
+		}(i, u)
+	}
+	wg.Wait()
+
+	var parts []string
+	for i, p := range previews {
+		if p != "" {
+			parts = append(parts, fmt.Sprintf("[Link preview: %s]\n%s", urls[i], p))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func fetchPreview(ctx context.Context, fetcher *tools.WebFetchTool, u string) string {
+	raw, err := fetcher.Execute(ctx, map[string]interface{}{"url": u, "extractMode": "markdown"})
+	if err != nil {
+		log.Printf("Link preview failed for %s: %v", u, err)
+		return ""
+	}
+
+	var result struct {
+		Error     string `json:"error"`
+		Status    int    `json:"status"`
+		Text      string `json:"text"`
+		Truncated bool   `json:"truncated"`
+	}
+	if err := json.Unmarshal([]byte(raw), &result); err != nil || result.Error != "" {
+		log.Printf("Link preview failed for %s: %s", u, result.Error)
+		return ""
+	}
+	if result.Status >= 400 || strings.TrimSpace(result.Text) == "" {
+		return ""
+	}
+
+	text := strings.TrimSpace(result.Text)
+	if result.Truncated {
+		text += " …"
+	}
+	return text
+}
@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/utils"
+)
+
+const logsUsage = "Usage: /logs [tail] [lines] [error|warn|info] [module], e.g. /logs tail 50 error feishu."
+
+// logsCommand handles /logs, for admins only: the most recent log lines,
+// optionally of a level and above or of one module, in any order.
+func (l *AgentLoop) logsCommand(msg bus.InboundMessage, args []string) string {
+	if !l.isAdmin(msg) {
+		return "Only admins can read the logs."
+	}
+	var q utils.LogQuery
+	if len(args) > 0 && strings.EqualFold(args[0], "tail") {
+		args = args[1:]
+	}
+	for _, arg := range args {
+		lower := strings.ToLower(arg)
+		if n, err := strconv.Atoi(arg); err == nil && n > 0 && q.Lines == 0 {
+			q.Lines = n
+			continue
+		}
+		isLevel := false
+		for _, level := range utils.LogLevels {
+			isLevel = isLevel || level == lower
+		}
+		switch {
+		case isLevel && q.Level == "":
+			q.Level = lower
+		case !isLevel && q.Module == "":
+			q.Module = lower
+		default:
+			return logsUsage
+		}
+	}
+	tail, err := utils.LogTail(q)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err)
+	}
+	return tail
+}
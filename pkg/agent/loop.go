@@ -3,17 +3,30 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"os"
 	"sort"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/HKUDS/nanobot-go/pkg/bus"
 	"github.com/HKUDS/nanobot-go/pkg/config"
+	"github.com/HKUDS/nanobot-go/pkg/contacts"
 	"github.com/HKUDS/nanobot-go/pkg/cron"
+	"github.com/HKUDS/nanobot-go/pkg/memory"
+	"github.com/HKUDS/nanobot-go/pkg/moderation"
 	"github.com/HKUDS/nanobot-go/pkg/providers"
+	"github.com/HKUDS/nanobot-go/pkg/secrets"
 	"github.com/HKUDS/nanobot-go/pkg/session"
+	"github.com/HKUDS/nanobot-go/pkg/skills"
 	"github.com/HKUDS/nanobot-go/pkg/tools"
+	"github.com/HKUDS/nanobot-go/pkg/tracing"
+	"github.com/HKUDS/nanobot-go/pkg/translate"
+	"github.com/HKUDS/nanobot-go/pkg/usage"
 )
 
 // AgentLoop is the core processing engine.
@@ -25,14 +38,46 @@ type AgentLoop struct {
 	MaxIterations int
 	Config        *config.Config
 	CronService   *cron.Service
-
-	Context   *ContextBuilder
-	Sessions  *session.Manager
-	Tools     *tools.Registry
-	Subagents *SubagentManager
+	// CronDigest batches the replies to scheduled turns with other cron
+	// deliveries to the same chat; nil sends them directly.
+	CronDigest *cron.Digest
+
+	Context    *ContextBuilder
+	Sessions   *session.Manager
+	Tools      *tools.Registry
+	Subagents  *SubagentManager
+	Contacts   *contacts.Directory
+	Moderator  *moderation.Checker
+	Translator translate.Translator
+	Activity   *memory.ActivityLog
+	Secrets    *secrets.Store // Per-user tool credentials
+	OAuth      *secrets.OAuth // Connects and renews users' OAuth credentials
+	// SkillSuggester drafts skills for recurring tool sequences; nil when
+	// skill suggestions are off.
+	SkillSuggester *skills.Suggester
+	Usage          *usage.Tracker // Accounts for the model usage of chats
+
+	// Name is the agent's name in agents.named, "" for the default agent,
+	// whose Agents are the named agents it routes messages to.
+	Name         string
+	Agents       map[string]*AgentLoop
+	allowedTools []string
 
 	running  bool
 	stopChan chan struct{}
+	stopOnce sync.Once
+	stopped  chan struct{} // closed when Run returns
+
+	// Turns derive their context from baseCtx; Shutdown cancels it to
+	// interrupt turns that outlast the grace period.
+	baseCtx     context.Context
+	cancelTurns context.CancelFunc
+	inflight    sync.WaitGroup
+
+	// Running turns by session key, so /stop can cancel them
+	turnsMu  sync.Mutex
+	turns    map[string]map[int]context.CancelCauseFunc
+	nextTurn int
 }
 
 // NewAgentLoop creates a new AgentLoop.
@@ -61,45 +106,200 @@ func NewAgentLoop(
 		Sessions:      session.NewManager(workspace),
 		Tools:         tools.NewRegistry(),
 		Subagents:     NewSubagentManager(provider, workspace, bus, model, cfg.Tools.Web.Search.APIKey, &cfg.Tools.Exec),
+		Contacts:      contacts.NewDirectory(cfg.Contacts),
+		Activity:      memory.NewActivityLog(workspace),
+		Secrets:       secrets.NewStore(workspace),
+		Usage:         usage.NewTracker(workspace, cfg.Usage.Prices),
 		stopChan:      make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	ProtectFiles(workspace)
+	loop.OAuth = secrets.NewOAuth(cfg.Tools.Credentials, loop.Secrets)
+	if suggest := cfg.Agents.Defaults.SkillSuggestions; suggest.Enabled {
+		loop.SkillSuggester = skills.NewSuggester(workspace, suggest.MinDays, suggest.WindowDays)
+	}
+	loop.Sessions.ArchiveRetention = time.Duration(cfg.Sessions.ArchiveRetentionDays) * 24 * time.Hour
+	loop.baseCtx, loop.cancelTurns = context.WithCancel(context.Background())
+
+	loop.Context.MaxInlineFileBytes = cfg.Agents.Defaults.MaxInlineFileBytes
+	loop.Context.ReadOnly = cfg.Tools.ReadOnly
+	loop.Context.RemoteImages = cfg.Agents.Defaults.RemoteImages
+	loop.Context.MaxRemoteImageBytes = cfg.Agents.Defaults.MaxRemoteImageBytes
+	if coding := cfg.Agents.Coding; coding.Enabled && coding.Repo != "" {
+		loop.Context.CodingRepo = coding.Repo
+		loop.Context.CodingMapMaxFiles = coding.MapMaxFiles
+	}
+	if search := cfg.Memory.Search; search.Enabled {
+		apiKey, apiBase := search.APIKey, search.APIBase
+		if apiKey == "" {
+			apiKey = cfg.Providers.OpenAI.APIKey
+		}
+		if apiBase == "" {
+			apiBase = cfg.Providers.OpenAI.APIBase
+		}
+		embedder := memory.NewOpenAIEmbedder(apiKey, apiBase, search.Model)
+		loop.Context.MemorySearch = memory.NewVectorIndex(loop.Context.Memory, embedder, search.Model)
+		loop.Context.MemoryTopK = search.TopK
+		loop.Context.MemoryMinScore = search.MinScore
+	}
+	loop.Subagents.Encodings = loop.toolEncodings()
+	loop.Subagents.Renderer = tools.NewPageRenderer(cfg.Tools.Web.Render)
+	loop.Subagents.MaxConcurrent = cfg.Agents.Subagents.MaxConcurrent
+	loop.Subagents.MaxQueued = cfg.Agents.Subagents.MaxQueued
+	loop.Subagents.MaxIterations = cfg.Agents.Subagents.MaxIterations
+	loop.Subagents.Timeout = time.Duration(cfg.Agents.Subagents.Timeout) * time.Second
+	loop.Subagents.MaxTokens = cfg.Agents.Subagents.MaxTokens
+	loop.Subagents.ReadOnly = cfg.Tools.ReadOnly
+	loop.Subagents.Activity = loop.Activity
+	loop.Subagents.Usage = loop.Usage
+	loop.Subagents.DedupWindow = time.Duration(cfg.Agents.Subagents.DedupWindow) * time.Second
+	loop.Subagents.ProgressInterval = time.Duration(cfg.Agents.Subagents.ProgressInterval) * time.Second
+	loop.Subagents.ResearchSections = cfg.Agents.Research.MaxSections
+	loop.Subagents.ResearchIterations = cfg.Agents.Research.SectionIterations
+
+	if cfg.Moderation.Enabled {
+		checker, err := moderation.NewChecker(&cfg.Moderation, cfg.Providers.OpenAI)
+		if err != nil {
+			log.Printf("Moderation disabled: %v", err)
+		} else {
+			loop.Moderator = checker
+		}
+	}
+	if cfg.Translation.Enabled {
+		translator, err := translate.New(&cfg.Translation, provider, model)
+		if err != nil {
+			log.Printf("Translation disabled: %v", err)
+		} else {
+			loop.Translator = translator
+		}
 	}
 
 	loop.registerDefaultTools()
+	loop.addNamedAgents()
 	return loop
 }
 
 func (l *AgentLoop) registerDefaultTools() {
-	l.Tools.Register(&tools.ReadFileTool{})
-	l.Tools.Register(&tools.WriteFileTool{})
-	l.Tools.Register(&tools.AppendFileTool{})
-	l.Tools.Register(&tools.EditFileTool{})
+	readOnly := l.Config.Tools.ReadOnly
+	if readOnly {
+		log.Printf("Read-only mode: file writes, exec and cron changes are disabled")
+	}
+	l.Tools.Register(&tools.ReadFileTool{Encodings: l.toolEncodings()})
+	if !readOnly {
+		l.Tools.Register(&tools.WriteFileTool{})
+		l.Tools.Register(&tools.AppendFileTool{})
+		l.Tools.Register(&tools.EditFileTool{})
+	}
 	l.Tools.Register(&tools.ListDirTool{})
 
 	// Exec Tool
-	l.Tools.Register(tools.NewExecTool(l.Config.Tools.Exec.Timeout, l.Workspace, l.Config.Tools.Exec.RestrictToWorkspace))
+	if !readOnly {
+		workingDir := l.Workspace
+		if repo := l.Context.CodingRepo; repo != "" {
+			workingDir = repo
+		}
+		execTool := tools.NewExecTool(l.Config.Tools.Exec.Timeout, workingDir, l.Config.Tools.Exec.RestrictToWorkspace)
+		execTool.Encodings = l.toolEncodings()
+		l.Tools.Register(execTool)
+	}
+
+	// Coding Tools
+	if repo := l.Context.CodingRepo; repo != "" {
+		l.Tools.Register(&tools.GrepTool{Repo: repo})
+		l.Tools.Register(&tools.GlobTool{Repo: repo})
+		l.Tools.Register(&tools.GitTool{Repo: repo, ReadOnly: readOnly})
+		if !readOnly {
+			l.Tools.Register(&tools.ApplyPatchTool{Repo: repo})
+		}
+	}
+
+	// Test Runner
+	if !readOnly {
+		if repo := l.Context.CodingRepo; repo != "" {
+			l.Tools.Register(&tools.RunTestsTool{Repo: repo, Command: l.Config.Agents.Coding.TestCommand, Restrict: true})
+		} else {
+			l.Tools.Register(&tools.RunTestsTool{Repo: l.Workspace, Restrict: l.Config.Tools.Exec.RestrictToWorkspace})
+		}
+	}
 
 	// Web Tools
 	l.Tools.Register(tools.NewWebSearchTool(l.Config.Tools.Web.Search.APIKey, 5))
-	l.Tools.Register(tools.NewWebFetchTool(50000))
+	webFetch := tools.NewWebFetchTool(50000)
+	webFetch.Renderer = l.Subagents.Renderer
+	l.Tools.Register(webFetch)
 
 	// Register SpawnTool
-	l.Tools.Register(tools.NewSpawnTool(l.Subagents))
+	spawnTool := tools.NewSpawnTool(l.Subagents)
+	for alias := range l.Config.Models {
+		spawnTool.ModelAliases = append(spawnTool.ModelAliases, alias)
+	}
+	sort.Strings(spawnTool.ModelAliases)
+	l.Tools.Register(spawnTool)
+	l.Tools.Register(tools.NewResearchTool(l.Subagents))
 
 	// Register CronTool
 	if l.CronService != nil {
-		l.Tools.Register(tools.NewCronTool(l.CronService))
+		cronTool := tools.NewCronTool(l.CronService)
+		cronTool.ReadOnly = readOnly
+		l.Tools.Register(cronTool)
 	}
 
 	// Register MessageTool
-	l.Tools.Register(tools.NewMessageTool(l.Bus))
+	messageTool := tools.NewMessageTool(l.Bus)
+	if l.Config.Tools.Message.ConfirmOtherChats {
+		messageTool.Drafts = tools.NewDraftBox(l.Bus)
+	}
+	l.Tools.Register(messageTool)
 
 	// Register MediaGenTool
-	l.Tools.Register(tools.NewMediaGenTool(l.Config))
+	l.Tools.Register(tools.NewMediaGenTool(l.Config, l.Bus))
+	if ocr := l.newOCRTool(); ocr != nil {
+		l.Tools.Register(ocr)
+	}
+
+	// Register MemoryTool
+	l.Tools.Register(tools.NewMemoryTool(l.Context.Memory, l.Config.Memory.SharedContext))
+	l.Tools.Register(tools.NewUsageTool(l.Usage))
+	l.Tools.Register(tools.NewLogsTool())
+
+	// Register MemorySearchTool
+	if index := l.Context.MemorySearch; index != nil {
+		l.Tools.Register(tools.NewMemorySearchTool(index, l.Context.MemoryTopK, l.Context.MemoryMinScore))
+	}
+
+	// Register FeishuLookupTool
+	if feishu := &l.Config.Channels.Feishu; feishu.Enabled && feishu.AppID != "" {
+		l.Tools.Register(tools.NewFeishuLookupTool(feishu, l.Contacts))
+	}
+
+	// Register DingTalkGroupTool
+	if dingtalk := &l.Config.Channels.DingTalk; dingtalk.Enabled && dingtalk.ClientID != "" {
+		l.Tools.Register(tools.NewDingTalkGroupTool(dingtalk, l.Contacts))
+	}
+}
+
+// toolEncodings returns the encodings read_file and exec convert from,
+// or nil when normalization is disabled.
+func (l *AgentLoop) toolEncodings() []string {
+	if !l.Config.Tools.Encoding.Normalize {
+		return nil
+	}
+	return l.Config.Tools.Encoding.Candidates
+}
+
+// sharedContact returns the contact whose shared facts apply to a sender,
+// or "" if shared context is disabled or the sender is unknown.
+func (l *AgentLoop) sharedContact(channel, senderID string) string {
+	if !l.Config.Memory.SharedContext {
+		return ""
+	}
+	return l.Contacts.Resolve(channel, senderID)
 }
 
 // Run starts the agent loop.
 func (l *AgentLoop) Run() {
 	l.running = true
+	defer close(l.stopped)
 	log.Println("Agent loop started")
 
 	inbound := l.Bus.ConsumeInbound()
@@ -107,13 +307,16 @@ func (l *AgentLoop) Run() {
 	for {
 		select {
 		case msg := <-inbound:
+			l.inflight.Add(1)
 			go func(m bus.InboundMessage) {
+				defer l.inflight.Done()
+				defer l.Bus.AckInbound(m)
 				if err := l.processMessage(m); err != nil {
 					log.Printf("Error processing message: %v", err)
 					l.Bus.PublishOutbound(bus.OutboundMessage{
 						Channel: m.Channel,
 						ChatID:  m.ChatID,
-						Content: fmt.Sprintf("Sorry, I encountered an error: %v", err),
+						Content: errorReply(err),
 					})
 				}
 			}(msg)
@@ -125,12 +328,76 @@ func (l *AgentLoop) Run() {
 	}
 }
 
-// Stop stops the agent loop.
+// errorReply is what a chat is told when its turn failed with err.
+func errorReply(err error) string {
+	switch {
+	case errors.Is(err, providers.ErrAuth):
+		return "Sorry, the model provider rejected my API key, so I can't answer right now. Please let the operator know."
+	case errors.Is(err, providers.ErrQuota):
+		return "Sorry, the model provider account is out of quota or credit, so I can't answer right now. Please let the operator know."
+	case errors.Is(err, providers.ErrRateLimited):
+		return "Sorry, the model provider is rate limiting my requests. Please try again in a minute."
+	case errors.Is(err, providers.ErrModelNotFound):
+		return "Sorry, the model this chat uses is not available from the provider. Use /model to pick another."
+	}
+	return fmt.Sprintf("Sorry, I encountered an error: %v", err)
+}
+
+// Stop stops the agent loop. It is safe to call more than once.
 func (l *AgentLoop) Stop() {
-	close(l.stopChan)
+	l.stopOnce.Do(func() { close(l.stopChan) })
+}
+
+// Shutdown stops taking new messages and waits up to grace for running
+// turns to finish. Turns still running after that are interrupted; they
+// save their session and tell the user before returning.
+func (l *AgentLoop) Shutdown(grace time.Duration) {
+	l.Stop()
+	select {
+	case <-l.stopped:
+	case <-time.After(grace):
+	}
+	if waitGroupTimeout(&l.inflight, grace) {
+		return
+	}
+	log.Printf("Interrupting turns still running after %s", grace)
+	l.cancelTurns()
+	if !waitGroupTimeout(&l.inflight, 10*time.Second) {
+		log.Printf("Some turns did not stop in time")
+	}
+}
+
+// waitGroupTimeout waits for wg and reports whether it finished within d.
+func waitGroupTimeout(wg *sync.WaitGroup, d time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(d):
+		return false
+	}
 }
 
-func (l *AgentLoop) processMessage(msg bus.InboundMessage) error {
+func (l *AgentLoop) processMessage(msg bus.InboundMessage) (err error) {
+	if msg.Channel != "system" && !isPassive(msg) && isStopCommand(msg.Content) {
+		l.stopCommand(msg)
+		return nil
+	}
+
+	agent, routed := l.route(msg)
+	if agent != l {
+		return agent.processMessage(routed)
+	}
+
+	if isPassive(msg) {
+		l.keepAsContext(msg)
+		return nil
+	}
+
 	// Handle system messages (subagent announces)
 	if msg.Channel == "system" {
 		return l.processSystemMessage(msg)
@@ -140,57 +407,165 @@ func (l *AgentLoop) processMessage(msg bus.InboundMessage) error {
 
 	sessionKey := msg.SessionKey()
 
-	// Handle "New Topic" command
-	if strings.TrimSpace(msg.Content) == "新话题" {
-		if err := l.Sessions.Clear(sessionKey); err != nil {
-			log.Printf("Error clearing session: %v", err)
+	// Handle "New Topic" command; the old conversation can be restored
+	if text := strings.TrimSpace(msg.Content); text == "新话题" || strings.EqualFold(text, "/reset") {
+		if _, err := l.Sessions.Archive(sessionKey); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error archiving session: %v", err)
+		}
+		reply := "Started a new conversation. Use /restore to bring back the previous one."
+		if text == "新话题" {
+			reply = "已为您开启新话题，之前的对话已归档，可发送 /restore 恢复。"
 		}
 		l.Bus.PublishOutbound(bus.OutboundMessage{
 			Channel: msg.Channel,
 			ChatID:  msg.ChatID,
-			Content: "已为您开启新话题，之前的对话记录已被清除。",
+			Content: reply,
 		})
 		return nil
 	}
 
 	sess := l.Sessions.GetOrCreate(sessionKey)
 
+	// A reaction to one of the replies rates the latest exchange
+	if rating, ok := msg.Metadata[metaFeedback].(string); ok {
+		if _, err := l.recordFeedback(sess, msg, rating, "", "reaction"); err != nil {
+			log.Printf("Error recording feedback: %v", err)
+		}
+		return nil
+	}
+
+	if reply, ok := l.handleCommand(sess, msg); ok {
+		l.Bus.PublishOutbound(bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: reply,
+		})
+		return nil
+	}
+
+	l.Activity.Record(memory.ActivityMessage, fmt.Sprintf("%s:%s from %s", msg.Channel, msg.ChatID, msg.SenderID))
+
+	safetyNote, refused := l.moderate(msg)
+	if refused {
+		return nil
+	}
+
 	// Update tool contexts
 	if tool, ok := l.Tools.Get("spawn"); ok {
 		if spawnTool, ok := tool.(*tools.SpawnTool); ok {
 			spawnTool.SetContext(msg.Channel, msg.ChatID)
 		}
 	}
+	if tool, ok := l.Tools.Get("research"); ok {
+		if researchTool, ok := tool.(*tools.ResearchTool); ok {
+			researchTool.SetContext(msg.Channel, msg.ChatID)
+		}
+	}
+	if tool, ok := l.Tools.Get("delegate"); ok {
+		if delegateTool, ok := tool.(*tools.DelegateTool); ok {
+			delegateTool.SetContext(msg.Channel, msg.ChatID)
+		}
+	}
 	if tool, ok := l.Tools.Get("cron"); ok {
 		if cronTool, ok := tool.(*tools.CronTool); ok {
 			cronTool.SetContext(msg.Channel, msg.ChatID)
 		}
 	}
-	if tool, ok := l.Tools.Get("message"); ok {
-		if msgTool, ok := tool.(*tools.MessageTool); ok {
-			msgTool.SetContext(msg.Channel, msg.ChatID)
-		}
-	}
-
-	// Build initial messages
-	content := msg.Content
+	credentials := l.credentialEnv(l.identity(msg))
+
+	ctx, cancel := l.turnContext(sessionKey)
+	defer cancel()
+	ctx = tools.WithSession(ctx, sessionKey)
+	ctx = tools.WithOrigin(ctx, msg.Channel, msg.ChatID)
+	ctx = tools.WithCredentials(ctx, credentials)
+	ctx = tools.WithAdmin(ctx, l.isAdmin(msg))
+	ctx = tools.WithMemoryScope(ctx, sessionKey, l.Contacts.Resolve(msg.Channel, msg.SenderID))
+	ctx, span := tracing.Start(ctx, "agent turn", tracing.String("session", sessionKey), tracing.String("channel", msg.Channel))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	// Build initial messages; the agent sees messages in the working language
+	text, userLang := l.translateInbound(msg.Channel, msg.Content)
+	content := text
 	if name, ok := msg.Metadata["sender_name"].(string); ok && name != "" {
 		content = fmt.Sprintf("[%s]: %s", name, content)
 	}
 
-	history := sess.GetHistory(50) // Limit history
-	messages := l.Context.BuildMessages(history, content, msg.Media, msg.Channel, msg.ChatID)
+	// Link previews are only shown to the LLM for this turn, not stored in history
+	llmContent := content
+	if previews := l.buildLinkPreviews(ctx, msg.Content); previews != "" {
+		llmContent += "\n\n" + previews
+	}
+
+	_, profile := l.chatProfile(sess, msg.Channel, msg.ChatID)
+	model, ctx, persona := l.applyProfile(ctx, sess, profile)
+	span.SetAttributes(tracing.String("gen_ai.request.model", model))
+
+	history, summary := l.sessionHistory(sess, l.historyLimits(msg.Channel, profile))
+	messages := l.Context.BuildMessages(history, llmContent, msg.Media, msg.Channel, msg.ChatID, l.sharedContact(msg.Channel, msg.SenderID), persona)
+	messages = l.Context.AddSystemNote(messages, summaryNote(summary))
+
+	// Replies with a length limit are sent whole at the end so they can be truncated
+	verbosity, maxReplyChars := l.replyStyle(sess)
+	messages = l.Context.AddSystemNote(messages, replyStyleNote(verbosity, maxReplyChars))
+	if userLang != "" {
+		messages = l.Context.AddSystemNote(messages, translationNote(l.Config.Translation.WorkingLanguage, userLang))
+	} else {
+		messages = l.Context.AddSystemNote(messages, languageNote(l.replyLanguage(sess), msg.Content))
+	}
+	messages = l.Context.AddSystemNote(messages, l.activityNote(msg.Channel, msg.ChatID))
+	messages = l.Context.AddSystemNote(messages, safetyNote)
+	messages = l.Context.AddSystemNote(messages, credentialNote(credentials))
+	// Translated replies and replies to scheduled turns are sent whole too
+	cronJob, fromCron := msg.Metadata["cron_job"].(string)
+	fromCron = fromCron && msg.SenderID == "cron" && l.CronDigest != nil
+	streamReplies := maxReplyChars <= 0 && userLang == "" && !fromCron
+
+	var card *statusCard
+	if streamReplies {
+		card = l.openStatusCard(msg.Channel, msg.ChatID)
+		defer card.Close("")
+	}
+
+	var stage string // what the turn is doing, reported on timeout
+	var steps []skills.Step
+	overflowNotified := false
+	streamShrunk := false
 
 	iteration := 0
 	var finalContent string
 
 	for iteration < l.MaxIterations {
 		iteration++
+		span.SetAttributes(tracing.Int("agent.iterations", iteration))
 
 		// Call LLM with streaming
-		ctx := context.Background()
-		stream, err := l.Provider.Stream(ctx, messages, l.Tools.GetDefinitions(), l.Model)
+		stage = fmt.Sprintf("waiting for the model (step %d)", iteration)
+		if iteration > 1 {
+			card.Update("thinking")
+		}
+		toolDefs := l.Tools.GetDefinitions()
+		messages = l.fitRequest(ctx, messages, toolDefs)
+		stream, err := l.Provider.Stream(ctx, messages, toolDefs, model)
+		if errors.Is(err, providers.ErrContextLength) && ctx.Err() == nil {
+			// The model's window is smaller than estimated: summarize and retry once
+			log.Printf("Request rejected as too long (~%d tokens), summarizing and retrying", promptTokens(messages, toolDefs))
+			if !overflowNotified {
+				l.Bus.PublishOutbound(bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Content: overflowNotice})
+				overflowNotified = true
+			}
+			messages = l.shrinkRequest(ctx, messages, toolDefs)
+			stream, err = l.Provider.Stream(ctx, messages, toolDefs, model)
+		}
 		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			if errors.Is(err, providers.ErrContextLength) {
+				return errConversationTooLong
+			}
 			return fmt.Errorf("LLM error: %w", err)
 		}
 
@@ -205,25 +580,37 @@ func (l *AgentLoop) processMessage(msg bus.InboundMessage) error {
 
 		streamOut := make(chan string, 10)
 		messagePublished := false
+		var reported map[string]int
 
+		var streamErr error
 		for chunk := range stream {
 			if chunk.Error != nil {
 				log.Printf("Stream error: %v", chunk.Error)
+				streamErr = chunk.Error
 				break
 			}
+			if chunk.Usage != nil {
+				reported = chunk.Usage
+			}
 
-			if chunk.Content != "" {
+			if chunk.Content != "" && streamReplies {
 				if !messagePublished {
-					l.Bus.PublishOutbound(bus.OutboundMessage{
-						Channel: msg.Channel,
-						ChatID:  msg.ChatID,
-						Stream:  streamOut,
-					})
+					if out := card.Take(); out != nil {
+						// The reply goes on the card already showing the status
+						streamOut = out
+					} else {
+						streamCfg := l.Config.Agents.Defaults.Stream
+						l.Bus.PublishOutbound(bus.OutboundMessage{
+							Channel: msg.Channel,
+							ChatID:  msg.ChatID,
+							Stream:  coalesceStream(streamOut, streamCfg.MinChars, time.Duration(streamCfg.FlushIntervalMs)*time.Millisecond),
+						})
+					}
 					messagePublished = true
 				}
 				streamOut <- chunk.Content
-				contentBuilder.WriteString(chunk.Content)
 			}
+			contentBuilder.WriteString(chunk.Content)
 
 			if chunk.ToolCall != nil {
 				tc := chunk.ToolCall
@@ -245,6 +632,27 @@ func (l *AgentLoop) processMessage(msg bus.InboundMessage) error {
 
 		close(streamOut)
 		finalContent = contentBuilder.String()
+		if ctx.Err() != nil {
+			break
+		}
+		if streamErr != nil && finalContent == "" && len(toolCallAccumulator) == 0 {
+			// The provider failed before answering, as if it had rejected the request
+			if errors.Is(streamErr, providers.ErrContextLength) && !streamShrunk {
+				log.Printf("Stream failed as too long (~%d tokens), summarizing and retrying", promptTokens(messages, toolDefs))
+				if !overflowNotified {
+					l.Bus.PublishOutbound(bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Content: overflowNotice})
+					overflowNotified = true
+				}
+				messages = l.shrinkRequest(ctx, messages, toolDefs)
+				streamShrunk = true
+				iteration-- // Try the step again
+				continue
+			}
+			if errors.Is(streamErr, providers.ErrContextLength) {
+				return errConversationTooLong
+			}
+			return fmt.Errorf("LLM error: %w", streamErr)
+		}
 
 		// Reconstruct Tool Calls
 		var toolCalls []providers.ToolCallRequest
@@ -273,6 +681,7 @@ func (l *AgentLoop) processMessage(msg bus.InboundMessage) error {
 				Arguments: args,
 			})
 		}
+		l.recordUsage(sess, msg.Channel, model, reported, promptTokens(messages, toolDefs), completionTokens(finalContent, toolCalls))
 
 		if len(toolCalls) > 0 {
 			// Add assistant message with tool calls
@@ -292,23 +701,74 @@ func (l *AgentLoop) processMessage(msg bus.InboundMessage) error {
 
 			// Execute tools
 			for _, tc := range toolCalls {
-				argsJSON, _ := json.Marshal(tc.Arguments)
+				argsJSON, _ := json.Marshal(tools.RedactArgs(tc.Arguments))
 				log.Printf("Executing tool: %s with args: %s", tc.Name, string(argsJSON))
-				result, err := l.Tools.Execute(tc.Name, tc.Arguments)
+				stage = fmt.Sprintf("running the %s tool", tc.Name)
+				card.Update(describeToolCall(tc.Name, tc.Arguments))
+				recordToolRun(l.Activity, tc.Name, tc.Arguments)
+				steps = append(steps, skills.Step{Tool: tc.Name, Detail: toolRunDetail(tc.Arguments)})
+				result, err := executeTool(ctx, l.Tools, tc.Name, tc.Arguments)
+				if ctx.Err() != nil {
+					break
+				}
 				if err != nil {
 					result = fmt.Sprintf("Error executing tool: %v", err)
 				}
 				log.Printf("Tool result: %s", result)
 				messages = l.Context.AddToolResult(messages, tc.ID, tc.Name, result)
 			}
+			if ctx.Err() != nil {
+				break
+			}
 		} else {
 			break
 		}
 	}
 
+	if ctx.Err() != nil {
+		span.SetError(fmt.Sprintf("%v while %s", context.Cause(ctx), stage))
+		var notice string
+		if context.Cause(ctx) == errTurnStopped {
+			notice = stoppedMessage(sessionKey, stage)
+		} else if ctx.Err() == context.Canceled {
+			notice = l.interruptedMessage(sessionKey, stage)
+		} else {
+			notice = l.timeoutMessage(sessionKey, stage)
+		}
+		if !card.Close(notice) {
+			l.Bus.PublishOutbound(bus.OutboundMessage{
+				Channel: msg.Channel,
+				ChatID:  msg.ChatID,
+				Content: notice,
+			})
+		}
+		sess.AddMessage("user", content, senderExtra(msg))
+		sess.AddMessage("assistant", strings.TrimSpace(finalContent+"\n\n"+notice), nil)
+		l.Sessions.Save(sess)
+		return nil
+	}
+
+	if !streamReplies && finalContent != "" {
+		reply, rest := truncateReply(l.translateReply(finalContent, userLang), maxReplyChars)
+		sess.DeleteMeta(metaPendingReply)
+		if rest != "" {
+			sess.SetMeta(metaPendingReply, rest)
+			reply += fmt.Sprintf("\n\n… (%d more characters, send /more to see the rest)", utf8.RuneCountInString(rest))
+		}
+		if fromCron {
+			l.CronDigest.Add(msg.Channel, msg.ChatID, cronJob, reply)
+		} else {
+			l.Bus.PublishOutbound(bus.OutboundMessage{
+				Channel: msg.Channel,
+				ChatID:  msg.ChatID,
+				Content: reply,
+			})
+		}
+	}
+
 	if finalContent == "" {
 		finalContent = "I've completed processing but have no response to give."
-		if iteration == 1 {
+		if iteration == 1 && !card.Close(finalContent) {
 			// If we failed to produce anything in the first iteration, send this fallback
 			l.Bus.PublishOutbound(bus.OutboundMessage{
 				Channel: msg.Channel,
@@ -319,9 +779,10 @@ func (l *AgentLoop) processMessage(msg bus.InboundMessage) error {
 	}
 
 	// Save to session
-	sess.AddMessage("user", content, nil)
+	sess.AddMessage("user", content, senderExtra(msg))
 	sess.AddMessage("assistant", finalContent, nil)
 	l.Sessions.Save(sess)
 
+	l.suggestSkill(msg, steps)
 	return nil
 }
@@ -3,15 +3,18 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 
 	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/providers"
 	"github.com/HKUDS/nanobot-go/pkg/tools"
+	"github.com/HKUDS/nanobot-go/pkg/tracing"
 )
 
-func (l *AgentLoop) processSystemMessage(msg bus.InboundMessage) error {
+func (l *AgentLoop) processSystemMessage(msg bus.InboundMessage) (err error) {
 	log.Printf("Processing system message from %s", msg.SenderID)
 
 	// Parse origin from chat_id (format: "channel:chat_id")
@@ -34,33 +37,71 @@ func (l *AgentLoop) processSystemMessage(msg bus.InboundMessage) error {
 			spawnTool.SetContext(originChannel, originChatID)
 		}
 	}
+	if tool, ok := l.Tools.Get("research"); ok {
+		if researchTool, ok := tool.(*tools.ResearchTool); ok {
+			researchTool.SetContext(originChannel, originChatID)
+		}
+	}
+	if tool, ok := l.Tools.Get("delegate"); ok {
+		if delegateTool, ok := tool.(*tools.DelegateTool); ok {
+			delegateTool.SetContext(originChannel, originChatID)
+		}
+	}
 	if tool, ok := l.Tools.Get("cron"); ok {
 		if cronTool, ok := tool.(*tools.CronTool); ok {
 			cronTool.SetContext(originChannel, originChatID)
 		}
 	}
-	if tool, ok := l.Tools.Get("message"); ok {
-		if msgTool, ok := tool.(*tools.MessageTool); ok {
-			msgTool.SetContext(originChannel, originChatID)
-		}
-	}
+
+	ctx, cancel := l.turnContext(sessionKey)
+	defer cancel()
+	ctx = tools.WithSession(ctx, sessionKey)
+	ctx = tools.WithOrigin(ctx, originChannel, originChatID)
+	// No user asked for this turn, so no one's credentials apply
+	ctx = tools.WithCredentials(ctx, l.credentialEnv(""))
+	ctx = tools.WithMemoryScope(ctx, sessionKey, "")
+	ctx, span := tracing.Start(ctx, "agent system turn", tracing.String("session", sessionKey), tracing.String("sender", msg.SenderID))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	_, profile := l.chatProfile(sess, originChannel, originChatID)
+	model, ctx, persona := l.applyProfile(ctx, sess, profile)
+	span.SetAttributes(tracing.String("gen_ai.request.model", model))
 
 	// Build messages with the announce content
-	history := sess.GetHistory(50)
-	messages := l.Context.BuildMessages(history, msg.Content, nil, originChannel, originChatID)
+	history, summary := l.sessionHistory(sess, l.historyLimits(originChannel, profile))
+	messages := l.Context.BuildMessages(history, msg.Content, nil, originChannel, originChatID, "", persona)
+	messages = l.Context.AddSystemNote(messages, summaryNote(summary))
+	messages = l.Context.AddSystemNote(messages, l.activityNote(originChannel, originChatID))
 
 	// Agent loop (limited for announce handling)
+
 	iteration := 0
 	var finalContent string
 
 	for iteration < l.MaxIterations {
 		iteration++
 
-		ctx := context.Background()
-		response, err := l.Provider.Chat(ctx, messages, l.Tools.GetDefinitions(), l.Model)
+		toolDefs := l.Tools.GetDefinitions()
+		messages = l.fitRequest(ctx, messages, toolDefs)
+		response, err := l.Provider.Chat(ctx, messages, toolDefs, model)
+		if errors.Is(err, providers.ErrContextLength) && ctx.Err() == nil {
+			log.Printf("Request rejected as too long (~%d tokens), summarizing and retrying", promptTokens(messages, toolDefs))
+			messages = l.shrinkRequest(ctx, messages, toolDefs)
+			response, err = l.Provider.Chat(ctx, messages, toolDefs, model)
+		}
 		if err != nil {
+			if context.Cause(ctx) == errTurnStopped {
+				log.Printf("Turn for %s stopped by the user", sessionKey)
+				return nil
+			}
+			if errors.Is(err, providers.ErrContextLength) {
+				return errConversationTooLong
+			}
 			return fmt.Errorf("LLM error: %w", err)
 		}
+		l.recordUsage(sess, originChannel, model, response.Usage, promptTokens(messages, toolDefs), completionTokens(response.Content, response.ToolCalls))
 
 		if response.HasToolCalls() {
 			toolCallsRaw := make([]interface{}, len(response.ToolCalls))
@@ -79,7 +120,8 @@ func (l *AgentLoop) processSystemMessage(msg bus.InboundMessage) error {
 
 			for _, tc := range response.ToolCalls {
 				log.Printf("Executing tool: %s", tc.Name)
-				result, err := l.Tools.Execute(tc.Name, tc.Arguments)
+				recordToolRun(l.Activity, tc.Name, tc.Arguments)
+				result, err := executeTool(ctx, l.Tools, tc.Name, tc.Arguments)
 				if err != nil {
 					result = fmt.Sprintf("Error executing tool: %v", err)
 				}
@@ -96,7 +138,7 @@ func (l *AgentLoop) processSystemMessage(msg bus.InboundMessage) error {
 	}
 
 	// Save to session (mark as system message in history)
-	sess.AddMessage("user", fmt.Sprintf("[System: %s] %s", msg.SenderID, msg.Content), nil)
+	sess.AddMessage("user", fmt.Sprintf("[System: %s] %s", msg.SenderID, msg.Content), senderExtra(msg))
 	sess.AddMessage("assistant", finalContent, nil)
 	l.Sessions.Save(sess)
 
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+)
+
+// moderate screens an inbound message. It returns a system prompt note when
+// the agent should answer with caution, and true when the message was
+// refused and must not be processed further.
+func (l *AgentLoop) moderate(msg bus.InboundMessage) (string, bool) {
+	if l.Moderator == nil || !l.Moderator.Applies(msg.Channel) {
+		return "", false
+	}
+
+	result, err := l.Moderator.Check(msg.Content, msg.Media)
+	if err != nil {
+		// Fail open: an unavailable moderation API must not take the bot down
+		log.Printf("Moderation check failed: %v", err)
+		return "", false
+	}
+	if !result.Flagged {
+		return "", false
+	}
+
+	categories := strings.Join(result.Categories, ", ")
+	log.Printf("Message from %s:%s flagged by %s moderation: %s", msg.Channel, msg.SenderID, result.Source, categories)
+
+	cfg := &l.Config.Moderation
+	switch cfg.Policy {
+	case "warn":
+		return fmt.Sprintf("## Content Warning\nThe user's latest message was flagged by the content filter (%s). Do not produce harmful content: decline those parts briefly and help with anything legitimate.", categories), false
+	case "alert":
+		if cfg.AlertChannel != "" && cfg.AlertTo != "" {
+			excerpt, _ := truncateReply(msg.Content, 500)
+			l.Bus.PublishOutbound(bus.OutboundMessage{
+				Channel: cfg.AlertChannel,
+				ChatID:  cfg.AlertTo,
+				Content: fmt.Sprintf("⚠️ Flagged message (%s) from %s in %s:%s:\n%s", categories, msg.SenderID, msg.Channel, msg.ChatID, excerpt),
+			})
+		}
+	}
+
+	l.Bus.PublishOutbound(bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: cfg.RefuseMessage,
+	})
+	return "", true
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/tools"
+)
+
+// ocrPrompt asks a vision model to transcribe an image rather than describe it.
+const ocrPrompt = "Transcribe all text in this image exactly as written, keeping its line breaks, reading order and the layout of tables. Do not describe, translate or summarize it. If there is no text, reply with nothing."
+
+// newOCRTool returns the ocr tool with the configured Tesseract and
+// vision model, or nil when OCR is off.
+func (l *AgentLoop) newOCRTool() *tools.OCRTool {
+	cfg := l.Config.Tools.OCR
+	if !cfg.Enabled {
+		return nil
+	}
+	t := &tools.OCRTool{Languages: cfg.Languages}
+	tesseract := cfg.Tesseract
+	if tesseract == "" {
+		tesseract = "tesseract"
+	}
+	if path, err := exec.LookPath(tesseract); err == nil {
+		t.Tesseract = path
+	}
+	if cfg.Vision {
+		t.Vision = l.visionOCR
+	}
+	return t
+}
+
+// visionOCR reads the text of an image with the OCR model, by default the
+// agent's model.
+func (l *AgentLoop) visionOCR(ctx context.Context, mimeType string, image []byte) (string, error) {
+	model := l.Config.Tools.OCR.Model
+	if model == "" {
+		model = l.Model
+	}
+	resp, err := l.Provider.Chat(ctx, []interface{}{
+		map[string]interface{}{"role": "user", "content": []map[string]interface{}{
+			{"type": "image_url", "image_url": map[string]interface{}{
+				"url": fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(image)),
+			}},
+			{"type": "text", "text": ocrPrompt},
+		}},
+	}, nil, model)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Content), nil
+}
@@ -0,0 +1,31 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+)
+
+// metaPassive is the inbound metadata key a channel sets on a group message
+// that is not addressed to the bot. It is kept in the chat's history, as
+// context for later replies, without a turn of its own.
+const metaPassive = "passive"
+
+func isPassive(msg bus.InboundMessage) bool {
+	passive, _ := msg.Metadata[metaPassive].(bool)
+	return passive
+}
+
+// keepAsContext appends a passive message to its chat's session.
+func (l *AgentLoop) keepAsContext(msg bus.InboundMessage) {
+	if msg.Content == "" {
+		return
+	}
+	content := msg.Content
+	if name, ok := msg.Metadata["sender_name"].(string); ok && name != "" {
+		content = fmt.Sprintf("[%s]: %s", name, content)
+	}
+	sess := l.Sessions.GetOrCreate(msg.SessionKey())
+	sess.AddMessage("user", content, senderExtra(msg))
+	l.Sessions.Save(sess)
+}
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/config"
+	"github.com/HKUDS/nanobot-go/pkg/providers"
+	"github.com/HKUDS/nanobot-go/pkg/session"
+)
+
+// Session metadata keys for the per-chat model settings.
+const (
+	metaProfile     = "profile"     // Chosen with /profile
+	metaModel       = "model"       // Set with /model
+	metaTemperature = "temperature" // Set with /temp
+)
+
+// chatProfile returns the profile a chat uses and its name: the one chosen
+// with /profile, else the one listing the chat, else the one listing its
+// channel. The name is "" when the chat uses the defaults.
+func (l *AgentLoop) chatProfile(sess *session.Session, channel, chatID string) (string, config.ProfileConfig) {
+	profiles := l.Config.Agents.Profiles
+	if name, ok := sess.Metadata[metaProfile].(string); ok {
+		if p, ok := profiles[name]; ok {
+			return name, p
+		}
+	}
+	channelMatch := ""
+	for _, name := range profileNames(profiles) {
+		for _, c := range profiles[name].Chats {
+			if c == channel+":"+chatID {
+				return name, profiles[name]
+			}
+			if c == channel && channelMatch == "" {
+				channelMatch = name
+			}
+		}
+	}
+	if channelMatch != "" {
+		return channelMatch, profiles[channelMatch]
+	}
+	return "", config.ProfileConfig{}
+}
+
+// applyProfile returns the model, request context and persona of a turn
+// run with profile p in the chat of sess. A model or temperature set with
+// /model or /temp takes precedence over the profile's.
+func (l *AgentLoop) applyProfile(ctx context.Context, sess *session.Session, p config.ProfileConfig) (string, context.Context, Persona) {
+	model := l.Model
+	if p.Model != "" {
+		model = p.Model
+	}
+	if m, ok := sess.Metadata[metaModel].(string); ok && m != "" {
+		model = m
+	}
+	if t, ok := sess.Metadata[metaTemperature].(float64); ok {
+		ctx = providers.WithTemperature(ctx, t)
+	} else if p.Temperature != nil {
+		ctx = providers.WithTemperature(ctx, *p.Temperature)
+	}
+	return model, ctx, Persona{Soul: p.Soul, Skills: p.Skills}
+}
+
+func profileNames(profiles map[string]config.ProfileConfig) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profileCommand handles /profile [name|reset].
+func (l *AgentLoop) profileCommand(sess *session.Session, channel, chatID, arg string) string {
+	profiles := l.Config.Agents.Profiles
+	if len(profiles) == 0 {
+		return "No profiles are configured."
+	}
+	names := profileNames(profiles)
+	if strings.EqualFold(arg, "reset") {
+		arg = "reset"
+	}
+	switch arg {
+	case "":
+		current, _ := l.chatProfile(sess, channel, chatID)
+		if current == "" {
+			current = "none (defaults)"
+		}
+		return fmt.Sprintf("Profile: %s\nAvailable: %s\nUse /profile <name> to switch, or /profile reset for the configured one.", current, strings.Join(names, ", "))
+	case "reset":
+		sess.DeleteMeta(metaProfile)
+		l.Sessions.Save(sess)
+		current, _ := l.chatProfile(sess, channel, chatID)
+		if current == "" {
+			return "This chat now uses the defaults."
+		}
+		return fmt.Sprintf("This chat now uses its configured profile, %s.", current)
+	}
+	if _, ok := profiles[arg]; !ok {
+		return fmt.Sprintf("Unknown profile %q. Available: %s.", arg, strings.Join(names, ", "))
+	}
+	sess.SetMeta(metaProfile, arg)
+	l.Sessions.Save(sess)
+	return fmt.Sprintf("This chat now uses the %s profile.", arg)
+}
+
+// configuredModel reports whether name is a model alias or the model of the
+// defaults, an alias or a profile.
+func (l *AgentLoop) configuredModel(name string) bool {
+	if name == l.Model {
+		return true
+	}
+	for alias, model := range l.Config.Models {
+		if name == alias || name == model {
+			return true
+		}
+	}
+	for _, p := range l.Config.Agents.Profiles {
+		if name == p.Model {
+			return true
+		}
+	}
+	return false
+}
+
+// modelCommand handles /model [name|reset]. Only admins can choose a model
+// that is not configured.
+func (l *AgentLoop) modelCommand(sess *session.Session, msg bus.InboundMessage, arg string) string {
+	switch {
+	case arg == "":
+		_, profile := l.chatProfile(sess, msg.Channel, msg.ChatID)
+		model, _, _ := l.applyProfile(context.Background(), sess, profile)
+		reply := fmt.Sprintf("Model: %s. Use /model <name> or reset.", model)
+		if len(l.Config.Models) > 0 {
+			aliases := make([]string, 0, len(l.Config.Models))
+			for alias := range l.Config.Models {
+				aliases = append(aliases, alias)
+			}
+			sort.Strings(aliases)
+			reply += "\nAliases: " + strings.Join(aliases, ", ")
+		}
+		return reply
+	case strings.EqualFold(arg, "reset"):
+		sess.DeleteMeta(metaModel)
+		l.Sessions.Save(sess)
+		return "This chat is back to its usual model."
+	}
+	if !l.configuredModel(arg) && !l.isAdmin(msg) {
+		return fmt.Sprintf("Unknown model %q. Use a configured model or alias; only admins can choose others.", arg)
+	}
+	sess.SetMeta(metaModel, arg)
+	l.Sessions.Save(sess)
+	return fmt.Sprintf("This chat now uses %s.", arg)
+}
+
+// temperatureCommand handles /temp [value|reset].
+func (l *AgentLoop) temperatureCommand(sess *session.Session, channel, chatID, arg string) string {
+	switch {
+	case arg == "":
+		if t, ok := sess.Metadata[metaTemperature].(float64); ok {
+			return fmt.Sprintf("Temperature: %g. Use /temp <0-2> or reset.", t)
+		}
+		if name, p := l.chatProfile(sess, channel, chatID); p.Temperature != nil {
+			return fmt.Sprintf("Temperature: %g, from the %s profile. Use /temp <0-2> or reset.", *p.Temperature, name)
+		}
+		return "This chat uses the model's default temperature. Use /temp <0-2> or reset."
+	case strings.EqualFold(arg, "reset"):
+		sess.DeleteMeta(metaTemperature)
+		l.Sessions.Save(sess)
+		return "This chat is back to its usual temperature."
+	}
+	t, err := strconv.ParseFloat(arg, 64)
+	if err != nil || t < 0 || t > 2 {
+		return "Usage: /temp <0-2> or reset."
+	}
+	sess.SetMeta(metaTemperature, t)
+	l.Sessions.Save(sess)
+	return fmt.Sprintf("Temperature set to %g for this chat.", t)
+}
@@ -0,0 +1,133 @@
+package agent
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+)
+
+// subagentProgress posts short status updates from a running subagent to
+// the chat that spawned it, so the user does not wait in silence: what it
+// is doing at most once per interval, and that it is still working when it
+// has been quiet for an interval. A nil *subagentProgress does nothing.
+type subagentProgress struct {
+	bus      *bus.MessageBus
+	channel  string
+	chatID   string
+	label    string
+	interval time.Duration
+	started  time.Time
+
+	mu     sync.Mutex
+	last   time.Time // when the last update was posted
+	status string    // what the subagent is doing now
+	done   chan struct{}
+	once   sync.Once
+}
+
+// startProgress starts progress updates for t, or returns nil when they
+// are disabled or the task has no chat to report to.
+func (m *SubagentManager) startProgress(t *subagentTask) *subagentProgress {
+	if m.ProgressInterval <= 0 || t.OriginChannel == "" || t.OriginChannel == "cron" {
+		return nil
+	}
+	now := time.Now()
+	p := &subagentProgress{
+		bus:      m.Bus,
+		channel:  t.OriginChannel,
+		chatID:   t.OriginChatID,
+		label:    t.Label,
+		interval: m.ProgressInterval,
+		started:  now,
+		last:     now,
+		status:   "working",
+		done:     make(chan struct{}),
+	}
+	go p.heartbeat()
+	return p
+}
+
+// Update records what the subagent is doing and posts it unless an update
+// was posted less than an interval ago.
+func (p *subagentProgress) Update(status string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status = status
+	if time.Since(p.last) >= p.interval {
+		p.postLocked(status)
+	}
+}
+
+// Stop ends the updates. It is safe to call more than once.
+func (p *subagentProgress) Stop() {
+	if p == nil {
+		return
+	}
+	p.once.Do(func() { close(p.done) })
+}
+
+func (p *subagentProgress) heartbeat() {
+	ticker := time.NewTicker(p.interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			if time.Since(p.last) >= p.interval {
+				p.postLocked("still " + p.status)
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *subagentProgress) postLocked(status string) {
+	p.last = time.Now()
+	p.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: p.channel,
+		ChatID:  p.chatID,
+		Content: fmt.Sprintf("[%s] %s… (%s)", p.label, status, time.Since(p.started).Round(time.Second)),
+	})
+}
+
+// describeToolCall says in a few words what a tool call does, for progress updates.
+func describeToolCall(name string, args map[string]interface{}) string {
+	str := func(key string) string {
+		s, _ := args[key].(string)
+		return s
+	}
+	switch name {
+	case "web_search":
+		if q := str("query"); q != "" {
+			return fmt.Sprintf("searching the web for %q", q)
+		}
+		return "searching the web"
+	case "web_fetch":
+		if u, err := url.Parse(str("url")); err == nil && u.Host != "" {
+			return "reading " + u.Host
+		}
+		return "reading a web page"
+	case "read_file", "list_dir":
+		if path := str("path"); path != "" {
+			return "reading " + filepath.Base(path)
+		}
+		return "reading files"
+	case "write_file", "edit_file", "append_file":
+		if path := str("path"); path != "" {
+			return "writing " + filepath.Base(path)
+		}
+		return "writing files"
+	case "exec":
+		return "running a command"
+	}
+	return "running " + name
+}
@@ -0,0 +1,73 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/purge"
+	"github.com/HKUDS/nanobot-go/pkg/session"
+)
+
+// senderExtra records who sent a user message in the session, and the
+// files it came with, so their messages and uploads can be found and
+// purged.
+func senderExtra(msg bus.InboundMessage) map[string]interface{} {
+	extra := map[string]interface{}{}
+	if msg.SenderID != "" {
+		extra[session.SenderKey] = msg.Channel + ":" + msg.SenderID
+	}
+	if len(msg.Media) > 0 {
+		extra[session.MediaKey] = msg.Media
+	}
+	if len(extra) == 0 {
+		return nil
+	}
+	return extra
+}
+
+// isAdmin reports whether the sender is listed in admins. Composite IDs
+// like "123|username" match on either part.
+func (l *AgentLoop) isAdmin(msg bus.InboundMessage) bool {
+	for _, admin := range l.Config.Admins {
+		channel, id, ok := strings.Cut(strings.TrimSpace(admin), ":")
+		if !ok || !strings.EqualFold(channel, msg.Channel) {
+			continue
+		}
+		for _, part := range strings.Split(msg.SenderID, "|") {
+			if part != "" && part == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// purgeCommand handles /purge <channel:id>, for admins only.
+func (l *AgentLoop) purgeCommand(msg bus.InboundMessage, args []string) string {
+	if !l.isAdmin(msg) {
+		return "Only admins can purge user data."
+	}
+	if len(args) != 1 {
+		return "Usage: /purge <channel:id>, e.g. /purge telegram:123456."
+	}
+	purger := &purge.Purger{
+		Workspace: l.Workspace,
+		Sessions:  l.Sessions,
+		Memory:    l.Context.Memory,
+		Secrets:   l.Secrets,
+		Contacts:  l.Config.Contacts,
+	}
+	report, err := purger.Purge(args[0])
+	if report != nil {
+		log.Printf("Purged data of %s at the request of %s:%s", report.Sender, msg.Channel, msg.SenderID)
+	}
+	if err != nil {
+		if report == nil {
+			return fmt.Sprintf("Error: %v", err)
+		}
+		return fmt.Sprintf("Error: %v\n\nRemoved before the error:\n%s", err, report)
+	}
+	return report.String()
+}
@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/HKUDS/nanobot-go/pkg/session"
+)
+
+// Session metadata keys for per-chat reply settings.
+const (
+	metaVerbosity     = "verbosity"
+	metaMaxReplyChars = "max_reply_chars"
+	metaPendingReply  = "pending_reply"
+)
+
+var verbosityLevels = []string{"short", "normal", "detailed"}
+
+// replyStyle returns the verbosity and reply length limit for a chat,
+// falling back to the agent defaults.
+func (l *AgentLoop) replyStyle(sess *session.Session) (string, int) {
+	verbosity := l.Config.Agents.Defaults.Verbosity
+	if v, ok := sess.Metadata[metaVerbosity].(string); ok && v != "" {
+		verbosity = v
+	}
+	maxChars := l.Config.Agents.Defaults.MaxReplyChars
+	if v, ok := metaInt(sess.Metadata, metaMaxReplyChars); ok {
+		maxChars = v
+	}
+	return verbosity, maxChars
+}
+
+// metaInt reads an integer from session metadata, which holds float64
+// after a round trip through JSON.
+func metaInt(meta map[string]interface{}, key string) (int, bool) {
+	switch v := meta[key].(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// replyStyleNote returns the system prompt instruction for a reply style.
+func replyStyleNote(verbosity string, maxChars int) string {
+	var rules []string
+	switch verbosity {
+	case "short":
+		rules = append(rules, "Keep replies short: answer in one to three sentences, skip preambles and summaries, and only use lists when asked.")
+	case "detailed":
+		rules = append(rules, "Give thorough replies: explain your reasoning, cover edge cases and include examples where they help.")
+	}
+	if maxChars > 0 {
+		rules = append(rules, fmt.Sprintf("Keep each reply under %d characters; longer replies are cut off.", maxChars))
+	}
+	if len(rules) == 0 {
+		return ""
+	}
+	return "## Reply Style\n" + strings.Join(rules, "\n")
+}
+
+// truncateReply splits content into a part of at most maxChars characters,
+// cut at a paragraph, line or sentence boundary when possible, and the rest.
+func truncateReply(content string, maxChars int) (string, string) {
+	if maxChars <= 0 || utf8.RuneCountInString(content) <= maxChars {
+		return content, ""
+	}
+
+	cut := len(content)
+	n := 0
+	for i := range content {
+		if n == maxChars {
+			cut = i
+			break
+		}
+		n++
+	}
+	head := content[:cut]
+
+	for _, sep := range []string{"\n\n", "\n", "。", ". ", "！", "? ", "？", "! "} {
+		if i := strings.LastIndex(head, sep); i > len(head)/2 {
+			cut = i + len(sep)
+			break
+		}
+	}
+	return strings.TrimRight(content[:cut], " \n"), strings.TrimLeft(content[cut:], " \n")
+}
@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/tools"
+)
+
+// codingNote returns the "# Coding Mode" system prompt section: rules for
+// working on code and a map of the repository.
+func codingNote(repo string, maxFiles int) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(`# Coding Mode
+
+You are working as a coding agent on the repository at %s. Relative paths in grep, glob, apply_patch, git and run_tests are relative to it; use absolute paths under it with read_file, write_file and edit_file. exec runs in it.
+
+Rules:
+1. Read the code you are about to change first (grep, glob, read_file). Never guess at APIs, names or file contents.
+2. Make the smallest change that solves the task and match the surrounding style. Prefer apply_patch or edit_file over rewriting whole files.
+3. Run run_tests after every change and before saying you are done. Never claim tests pass without running them; report failures as they are.
+4. Do not commit, switch branches or discard changes unless the user asks.
+5. When you finish, summarize what you changed (files and why) and the test result.`, repo))
+
+	if branch := gitOutput(repo, "rev-parse", "--abbrev-ref", "HEAD"); branch != "" {
+		sb.WriteString("\n\n## Repository\nBranch: " + branch)
+		if status := gitOutput(repo, "status", "--short"); status != "" {
+			lines := strings.Split(status, "\n")
+			sb.WriteString(fmt.Sprintf("\nUncommitted changes in %d file(s)", len(lines)))
+		}
+	} else {
+		sb.WriteString("\n\n## Repository")
+	}
+
+	files, total := tools.ListRepoFiles(repo, maxFiles)
+	if total == 0 {
+		sb.WriteString("\nThe repository is empty.")
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf("\nFiles (%d):\n", total))
+	var dir string
+	var names []string
+	flush := func() {
+		if len(names) > 0 {
+			sb.WriteString(fmt.Sprintf("%s %s\n", dir, strings.Join(names, ", ")))
+		}
+	}
+	for _, f := range files {
+		d := path.Dir(f) + "/"
+		if d == "./" {
+			d = "/"
+		}
+		if d != dir {
+			flush()
+			dir, names = d, nil
+		}
+		names = append(names, path.Base(f))
+	}
+	flush()
+	if total > len(files) {
+		sb.WriteString(fmt.Sprintf("... and %d more files (use glob)\n", total-len(files)))
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// gitOutput runs a git command in repo and returns its trimmed output, or "" on error.
+func gitOutput(repo string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repo
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
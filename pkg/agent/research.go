@@ -0,0 +1,393 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/tools"
+)
+
+// researchDir holds one directory per research task, relative to the workspace.
+const researchDir = "research"
+
+// researchSection is one planned section of a research report.
+type researchSection struct {
+	Title    string   `json:"title"`
+	Question string   `json:"question"`
+	Notes    string   `json:"notes,omitempty"`
+	Sources  []string `json:"sources,omitempty"` // URLs fetched so far
+	Done     bool     `json:"done"`
+}
+
+// researchCheckpoint is the state of a research task. It is saved to
+// research/<id>/checkpoint.json after every step, so a task interrupted
+// by a restart resumes where it stopped.
+type researchCheckpoint struct {
+	ID            string            `json:"id"`
+	Topic         string            `json:"topic"`
+	Label         string            `json:"label"`
+	Model         string            `json:"model,omitempty"`
+	OriginChannel string            `json:"originChannel"`
+	OriginChatID  string            `json:"originChatId"`
+	Started       time.Time         `json:"started"`
+	Sections      []researchSection `json:"sections"`
+	Report        string            `json:"report,omitempty"` // Path of the written report
+	Delivered     bool              `json:"delivered"`
+	Error         string            `json:"error,omitempty"` // Set when the task failed; it is not resumed
+}
+
+// SpawnResearch starts a deep research task on topic in the background.
+// The report is sent to the origin chat as a Markdown file.
+func (m *SubagentManager) SpawnResearch(topic, label, originChannel, originChatID string) string {
+	t := newSubagentTask(topic, label, "", originChannel, originChatID)
+	t.Research = true
+	return m.enqueue(t)
+}
+
+// ResumeResearch restarts the research tasks that had not been delivered
+// when the process last stopped.
+func (m *SubagentManager) ResumeResearch() {
+	dirs, _ := filepath.Glob(filepath.Join(m.Workspace, researchDir, "*", "checkpoint.json"))
+	for _, path := range dirs {
+		cp, err := m.loadResearch(filepath.Base(filepath.Dir(path)))
+		if err != nil {
+			log.Printf("Skipping research checkpoint %s: %v", path, err)
+			continue
+		}
+		if cp.Delivered || cp.Error != "" {
+			continue
+		}
+		t := &subagentTask{
+			ID:            cp.ID,
+			Task:          cp.Topic,
+			Label:         cp.Label,
+			Model:         cp.Model,
+			OriginChannel: cp.OriginChannel,
+			OriginChatID:  cp.OriginChatID,
+			SpawnedAt:     cp.Started,
+			Research:      true,
+		}
+		log.Printf("Resuming research [%s]: %s", cp.ID, cp.Label)
+		m.enqueue(t)
+	}
+}
+
+// sourceCount returns the number of sources read across all sections.
+func (cp *researchCheckpoint) sourceCount() int {
+	n := 0
+	for _, s := range cp.Sections {
+		n += len(s.Sources)
+	}
+	return n
+}
+
+func (m *SubagentManager) researchPath(id, name string) string {
+	return filepath.Join(m.Workspace, researchDir, id, name)
+}
+
+func (m *SubagentManager) loadResearch(id string) (*researchCheckpoint, error) {
+	data, err := atrest.ReadFile(m.researchPath(id, "checkpoint.json"))
+	if err != nil {
+		return nil, err
+	}
+	var cp researchCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func (m *SubagentManager) saveResearch(cp *researchCheckpoint) error {
+	path := m.researchPath(cp.ID, "checkpoint.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Written atomically so a crash never leaves a half-written checkpoint
+	return atrest.WriteFileAtomic(path, data, 0644)
+}
+
+// runResearch plans the report, researches each section with web search
+// and fetch, writes the report and sends it, checkpointing after each step.
+func (m *SubagentManager) runResearch(t *subagentTask, updates *subagentProgress) {
+	cp, err := m.loadResearch(t.ID)
+	if err != nil {
+		cp = &researchCheckpoint{
+			ID:            t.ID,
+			Topic:         t.Task,
+			Label:         t.Label,
+			Model:         t.Model,
+			OriginChannel: t.OriginChannel,
+			OriginChatID:  t.OriginChatID,
+			Started:       t.SpawnedAt,
+		}
+	}
+	model := cp.Model
+	if model == "" {
+		model = m.Model
+	}
+	ctx := context.Background()
+
+	fail := func(err error) {
+		log.Printf("Research [%s] failed: %v", cp.ID, err)
+		cp.Error = err.Error()
+		m.saveResearch(cp)
+		m.announceResult(cp.ID, cp.Label, cp.Topic, fmt.Sprintf("Error: %v", err), cp.OriginChannel, cp.OriginChatID, "error")
+	}
+
+	if len(cp.Sections) == 0 {
+		log.Printf("Research [%s] planning: %s", cp.ID, cp.Label)
+		updates.Update("planning the report")
+		sections, err := m.planResearch(ctx, cp.Topic, model)
+		if err != nil {
+			fail(err)
+			return
+		}
+		cp.Sections = sections
+		if err := m.saveResearch(cp); err != nil {
+			fail(err)
+			return
+		}
+	}
+
+	for i := range cp.Sections {
+		if cp.Sections[i].Done {
+			continue
+		}
+		log.Printf("Research [%s] section %d/%d: %s", cp.ID, i+1, len(cp.Sections), cp.Sections[i].Title)
+		updates.Update(fmt.Sprintf("researching section %d of %d, %s", i+1, len(cp.Sections), cp.Sections[i].Title))
+		if err := m.researchSection(ctx, cp, i, model, updates); err != nil {
+			fail(err)
+			return
+		}
+	}
+
+	if cp.Report == "" {
+		log.Printf("Research [%s] writing the report", cp.ID)
+		updates.Update(fmt.Sprintf("writing the report from %d sources", cp.sourceCount()))
+		report, err := m.writeResearchReport(ctx, cp, model)
+		if err != nil {
+			fail(err)
+			return
+		}
+		path := m.researchPath(cp.ID, reportFileName(cp.Topic))
+		if err := atrest.WriteFile(path, []byte(report), 0644); err != nil {
+			fail(err)
+			return
+		}
+		cp.Report = path
+		m.saveResearch(cp)
+	}
+
+	m.Bus.PublishOutbound(bus.OutboundMessage{
+		Channel: cp.OriginChannel,
+		ChatID:  cp.OriginChatID,
+		Type:    bus.MessageTypeFile,
+		Media:   cp.Report,
+		Content: "Research report: " + cp.Label,
+	})
+	cp.Delivered = true
+	m.saveResearch(cp)
+
+	report, _ := atrest.ReadFile(cp.Report)
+	summary, _ := truncateReply(string(report), 1500)
+	log.Printf("Research [%s] completed: %s", cp.ID, cp.Report)
+	m.announceResult(cp.ID, cp.Label, cp.Topic, fmt.Sprintf("The full report was sent to the user as a file (%s). It begins:\n\n%s", cp.Report, summary), cp.OriginChannel, cp.OriginChatID, "ok")
+}
+
+// planResearch asks the model for the sections of a report on topic.
+func (m *SubagentManager) planResearch(ctx context.Context, topic, model string) ([]researchSection, error) {
+	maxSections := m.ResearchSections
+	if maxSections <= 0 {
+		maxSections = 5
+	}
+	resp, err := m.Provider.Chat(ctx, []interface{}{
+		map[string]interface{}{"role": "system", "content": fmt.Sprintf(`You plan research reports. Split the topic into 2 to %d sections that together answer it, each with a title and the question its research must answer.
+Reply with JSON only, in this form: [{"title": "...", "question": "..."}]`, maxSections)},
+		map[string]interface{}{"role": "user", "content": topic},
+	}, nil, model)
+	if err != nil {
+		return nil, err
+	}
+
+	var sections []researchSection
+	content := resp.Content
+	if start, end := strings.Index(content, "["), strings.LastIndex(content, "]"); start >= 0 && end > start {
+		json.Unmarshal([]byte(content[start:end+1]), &sections)
+	}
+	var planned []researchSection
+	for _, s := range sections {
+		if strings.TrimSpace(s.Title) != "" {
+			planned = append(planned, researchSection{Title: s.Title, Question: s.Question})
+		}
+	}
+	if len(planned) == 0 {
+		// Research the topic as a whole rather than fail on a bad plan
+		planned = []researchSection{{Title: topic, Question: topic}}
+	}
+	if len(planned) > maxSections {
+		planned = planned[:maxSections]
+	}
+	return planned, nil
+}
+
+// researchSection runs search and fetch rounds for section i until the
+// model writes its notes, saving the checkpoint after each round.
+func (m *SubagentManager) researchSection(ctx context.Context, cp *researchCheckpoint, i int, model string, updates *subagentProgress) error {
+	section := &cp.Sections[i]
+	reg := tools.NewRegistry()
+	reg.Register(tools.NewWebSearchTool(m.BraveAPIKey, 5))
+	webFetch := tools.NewWebFetchTool(50000)
+	webFetch.Renderer = m.Renderer
+	reg.Register(webFetch)
+	reg.Register(&tools.ReadFileTool{Encodings: m.Encodings})
+
+	var outline []string
+	for j, s := range cp.Sections {
+		outline = append(outline, fmt.Sprintf("%d. %s", j+1, s.Title))
+	}
+	prompt := fmt.Sprintf(`# Research
+
+You are researching one section of a report on: %s
+
+Report outline:
+%s
+
+## Your Section
+%s
+Question: %s
+
+Use web_search and web_fetch to find reliable, current sources. Prefer primary sources and check important claims in more than one place.
+When you have enough, reply without calling tools with your notes for this section in Markdown: the key facts, figures and open questions, each followed by its source URL. Do not write the final report.`,
+		cp.Topic, strings.Join(outline, "\n"), section.Title, section.Question)
+	if len(section.Sources) > 0 {
+		prompt += "\n\nYou were interrupted after reading these sources; read others or go on from what you remember of them:\n- " + strings.Join(section.Sources, "\n- ")
+	}
+
+	messages := []interface{}{
+		map[string]interface{}{"role": "system", "content": prompt},
+		map[string]interface{}{"role": "user", "content": "Research this section."},
+	}
+	maxIterations := m.ResearchIterations
+	if maxIterations <= 0 {
+		maxIterations = 8
+	}
+
+	for iteration := 0; iteration < maxIterations; iteration++ {
+		response, err := m.Provider.Chat(ctx, messages, reg.GetDefinitions(), model)
+		if err != nil {
+			return err
+		}
+		if !response.HasToolCalls() {
+			section.Notes = strings.TrimSpace(response.Content)
+			break
+		}
+
+		toolCallsRaw := make([]interface{}, len(response.ToolCalls))
+		for j, tc := range response.ToolCalls {
+			argsJSON, _ := json.Marshal(tc.Arguments)
+			toolCallsRaw[j] = map[string]interface{}{
+				"id":   tc.ID,
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":      tc.Name,
+					"arguments": string(argsJSON),
+				},
+			}
+		}
+		messages = append(messages, map[string]interface{}{
+			"role":       "assistant",
+			"content":    response.Content,
+			"tool_calls": toolCallsRaw,
+		})
+		for _, tc := range response.ToolCalls {
+			log.Printf("Research [%s] executing: %s", cp.ID, tc.Name)
+			recordToolRun(m.Activity, tc.Name, tc.Arguments)
+			status := describeToolCall(tc.Name, tc.Arguments)
+			if n := cp.sourceCount(); n > 0 {
+				status += fmt.Sprintf(", %d sources found so far", n)
+			}
+			updates.Update(status)
+			result, err := executeTool(ctx, reg, tc.Name, tc.Arguments)
+			if err != nil {
+				result = fmt.Sprintf("Error executing tool: %v", err)
+			}
+			if url, _ := tc.Arguments["url"].(string); tc.Name == "web_fetch" && url != "" {
+				section.Sources = append(section.Sources, url)
+			}
+			messages = append(messages, map[string]interface{}{
+				"role":         "tool",
+				"tool_call_id": tc.ID,
+				"name":         tc.Name,
+				"content":      result,
+			})
+		}
+		m.saveResearch(cp)
+	}
+
+	if section.Notes == "" {
+		// Out of rounds: ask for notes on what was found so far
+		messages = append(messages, map[string]interface{}{"role": "user", "content": "Stop researching and write your notes for this section now."})
+		response, err := m.Provider.Chat(ctx, messages, nil, model)
+		if err != nil {
+			return err
+		}
+		section.Notes = strings.TrimSpace(response.Content)
+	}
+	if section.Notes == "" {
+		section.Notes = "(no findings)"
+	}
+	section.Done = true
+	return m.saveResearch(cp)
+}
+
+// writeResearchReport asks the model to turn the section notes into the final report.
+func (m *SubagentManager) writeResearchReport(ctx context.Context, cp *researchCheckpoint, model string) (string, error) {
+	var notes strings.Builder
+	for i, s := range cp.Sections {
+		notes.WriteString(fmt.Sprintf("## %d. %s\nQuestion: %s\n\n%s\n\n", i+1, s.Title, s.Question, s.Notes))
+	}
+	resp, err := m.Provider.Chat(ctx, []interface{}{
+		map[string]interface{}{"role": "system", "content": `Write a research report in Markdown from the research notes you are given.
+Start with a "# " title and a short summary of the findings, then one "## " section per part of the notes, and end with a "## Sources" list of the URLs cited.
+Use only what the notes support, cite sources inline as Markdown links, and say where the evidence is thin or conflicting.`},
+		map[string]interface{}{"role": "user", "content": fmt.Sprintf("Topic: %s\n\nResearch notes:\n\n%s", cp.Topic, notes.String())},
+	}, nil, model)
+	if err != nil {
+		return "", err
+	}
+	report := strings.TrimSpace(resp.Content)
+	if report == "" {
+		return "", fmt.Errorf("the model wrote an empty report")
+	}
+	if !strings.HasPrefix(report, "#") {
+		report = "# " + cp.Topic + "\n\n" + report
+	}
+	return report + "\n", nil
+}
+
+var reFileNameNoise = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// reportFileName returns a file name for the report on topic, e.g. "solar-panel-efficiency.md".
+func reportFileName(topic string) string {
+	name := strings.Trim(reFileNameNoise.ReplaceAllString(strings.ToLower(topic), "-"), "-")
+	if r := []rune(name); len(r) > 60 {
+		name = strings.TrimRight(string(r[:60]), "-")
+	}
+	if name == "" {
+		name = "report"
+	}
+	return name + ".md"
+}
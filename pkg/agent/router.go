@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/tools"
+)
+
+// addNamedAgents creates the agents configured in agents.named. They
+// share the default agent's bus, provider and cron service but have their
+// own workspace; the default agent's Run routes messages to them.
+func (l *AgentLoop) addNamedAgents() {
+	if len(l.Config.Agents.Named) == 0 {
+		return
+	}
+	l.Agents = make(map[string]*AgentLoop, len(l.Config.Agents.Named))
+	for name, a := range l.Config.Agents.Named {
+		workspace := a.Workspace
+		if workspace == "" {
+			workspace = filepath.Join(l.Workspace, "agents", name)
+		}
+		if err := os.MkdirAll(workspace, 0755); err != nil {
+			log.Printf("Agent %s disabled: %v", name, err)
+			continue
+		}
+
+		cfg := *l.Config
+		cfg.Agents.Named = nil
+		cfg.Agents.Defaults.Workspace = workspace
+		if a.Model != "" {
+			cfg.Agents.Defaults.Model = a.Model
+		}
+		agent := NewAgentLoop(l.Bus, l.Provider, workspace, &cfg, l.CronService)
+		agent.Name = name
+		agent.allowedTools = a.Tools
+		agent.Subagents.Agent = name
+		// Shutdown interrupts the named agents' turns with the default's
+		agent.baseCtx, agent.cancelTurns = l.baseCtx, l.cancelTurns
+		for _, tool := range agent.Tools.Names() {
+			if !agent.allowsTool(tool) {
+				agent.Tools.Unregister(tool)
+			}
+		}
+		l.Agents[name] = agent
+		log.Printf("Agent %s ready (workspace %s)", name, workspace)
+	}
+}
+
+// allowsTool reports whether the agent may use the named tool.
+func (l *AgentLoop) allowsTool(name string) bool {
+	if len(l.allowedTools) == 0 {
+		return true
+	}
+	for _, t := range l.allowedTools {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterTool registers a tool with the agent and with the named agents
+// allowed to use it.
+func (l *AgentLoop) RegisterTool(tool tools.Tool) {
+	l.Tools.Register(tool)
+	for _, agent := range l.Agents {
+		if agent.allowsTool(tool.Name()) {
+			agent.Tools.Register(tool)
+		}
+	}
+}
+
+// route returns the agent that handles a message and the message as that
+// agent sees it. A message starting with @name goes to that agent, with
+// the mention removed; otherwise a named agent given the chat, or else
+// its channel, takes it. The rest go to the default agent, l.
+func (l *AgentLoop) route(msg bus.InboundMessage) (*AgentLoop, bus.InboundMessage) {
+	if len(l.Agents) == 0 {
+		return l, msg
+	}
+	if msg.Channel == "system" {
+		// Results go back to the agent that started the work
+		if name, ok := msg.Metadata["agent"].(string); ok {
+			if agent, ok := l.Agents[name]; ok {
+				return agent, msg
+			}
+			return l, msg
+		}
+		if i := strings.Index(msg.ChatID, ":"); i > 0 {
+			return l.routeChat(msg.ChatID[:i], msg.ChatID[i+1:]), msg
+		}
+		return l, msg
+	}
+	if agent, rest, ok := l.mentionedAgent(msg.Content); ok {
+		msg.Content = rest
+		return agent, msg
+	}
+	return l.routeChat(msg.Channel, msg.ChatID), msg
+}
+
+// routeChat returns the agent a chat is given to, or l.
+func (l *AgentLoop) routeChat(channel, chatID string) *AgentLoop {
+	names := make([]string, 0, len(l.Agents))
+	for name := range l.Agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var channelMatch *AgentLoop
+	for _, name := range names {
+		for _, c := range l.Config.Agents.Named[name].Chats {
+			if c == channel+":"+chatID {
+				return l.Agents[name]
+			}
+			if c == channel && channelMatch == nil {
+				channelMatch = l.Agents[name]
+			}
+		}
+	}
+	if channelMatch != nil {
+		return channelMatch
+	}
+	return l
+}
+
+// mentionedAgent finds an @name among the mentions a message starts with,
+// as in "@coder fix the build" or "@nanobot @coder ...", and returns the
+// agent and the message without that mention.
+func (l *AgentLoop) mentionedAgent(content string) (*AgentLoop, string, bool) {
+	rest := strings.TrimLeftFunc(content, unicode.IsSpace)
+	prefix := ""
+	for strings.HasPrefix(rest, "@") {
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			end = len(rest)
+		}
+		mention := rest[:end]
+		name := strings.TrimRightFunc(mention[1:], unicode.IsPunct)
+		for agentName, agent := range l.Agents {
+			if strings.EqualFold(name, agentName) {
+				return agent, prefix + strings.TrimLeftFunc(rest[end:], unicode.IsSpace), true
+			}
+		}
+		prefix += mention + " "
+		rest = strings.TrimLeftFunc(rest[end:], unicode.IsSpace)
+	}
+	return nil, content, false
+}
@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/skills"
+)
+
+// maxWorkflowText caps the request and step details kept in the workflow log.
+const maxWorkflowText = 200
+
+// suggestSkill records the tool runs of a finished turn and, when they
+// repeat a workflow often enough, tells the chat a skill was drafted for it.
+func (l *AgentLoop) suggestSkill(msg bus.InboundMessage, steps []skills.Step) {
+	if l.SkillSuggester == nil || len(steps) < 2 {
+		return
+	}
+	for i := range steps {
+		steps[i].Detail = truncateRunes(steps[i].Detail, maxWorkflowText)
+	}
+	suggestion, err := l.SkillSuggester.Record(skills.Workflow{
+		Time:    time.Now(),
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Request: truncateRunes(strings.Join(strings.Fields(msg.Content), " "), maxWorkflowText),
+		Steps:   steps,
+	})
+	if err != nil {
+		log.Printf("Error recording workflow: %v", err)
+		return
+	}
+	if suggestion == nil {
+		return
+	}
+	log.Printf("Drafted skill %s for workflow %s", suggestion.Name, suggestion.Pattern)
+	l.Bus.PublishOutbound(bus.OutboundMessage{
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: fmt.Sprintf("I've run the same steps (%s) on %d different days, so I drafted a skill for them at %s. Review and edit it, then send /skill accept %s to start using it, or /skill discard %s.",
+			suggestion.Pattern, suggestion.Days, suggestion.Path, suggestion.Name, suggestion.Name),
+	})
+}
+
+func truncateRunes(s string, max int) string {
+	if r := []rune(s); len(r) > max {
+		return string(r[:max]) + "…"
+	}
+	return s
+}
+
+// skillCommand handles /skill [accept|discard <name>].
+func (l *AgentLoop) skillCommand(args []string) string {
+	if l.SkillSuggester == nil {
+		return "Skill suggestions are turned off."
+	}
+	if len(args) == 0 {
+		drafts, err := l.SkillSuggester.Drafts()
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err)
+		}
+		if len(drafts) == 0 {
+			return "There are no drafted skills to review."
+		}
+		return fmt.Sprintf("Drafted skills: %s\nUse /skill accept <name> or /skill discard <name>.", strings.Join(drafts, ", "))
+	}
+	if len(args) != 2 {
+		return "Usage: /skill [accept|discard <name>]."
+	}
+	name := args[1]
+	switch strings.ToLower(args[0]) {
+	case "accept":
+		path, err := l.SkillSuggester.Accept(name)
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err)
+		}
+		return fmt.Sprintf("The %s skill is now available, at %s.", name, path)
+	case "discard":
+		if err := l.SkillSuggester.Discard(name); err != nil {
+			return fmt.Sprintf("Error: %v", err)
+		}
+		return fmt.Sprintf("Discarded the %s draft. That workflow will not be suggested again.", name)
+	}
+	return "Usage: /skill [accept|discard <name>]."
+}
@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+)
+
+// statusCard is a streamed reply opened as soon as a turn starts, so that
+// on channels showing streams as cards the user sees the agent at work
+// through long tool chains: until the reply begins, the card shows what
+// the agent is doing and for how long. A nil *statusCard does nothing.
+type statusCard struct {
+	status   chan string
+	interval time.Duration
+	started  time.Time
+
+	mu     sync.Mutex
+	stream chan string // The reply; nil once taken or closed
+	doing  string      // what the agent is doing now
+	done   chan struct{}
+}
+
+// openStatusCard publishes a status card for a turn in the chat, or
+// returns nil when the channel does not show them.
+func (l *AgentLoop) openStatusCard(channel, chatID string) *statusCard {
+	streamCfg := l.Config.Agents.Defaults.Stream
+	enabled := false
+	for _, name := range streamCfg.StatusChannels {
+		if name == channel {
+			enabled = true
+		}
+	}
+	if !enabled {
+		return nil
+	}
+	interval := time.Duration(streamCfg.StatusInterval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	c := &statusCard{
+		status:   make(chan string, 1),
+		interval: interval,
+		started:  time.Now(),
+		stream:   make(chan string, 10),
+		doing:    "thinking",
+		done:     make(chan struct{}),
+	}
+	l.Bus.PublishOutbound(bus.OutboundMessage{
+		Channel: channel,
+		ChatID:  chatID,
+		Stream:  coalesceStream(c.stream, streamCfg.MinChars, time.Duration(streamCfg.FlushIntervalMs)*time.Millisecond),
+		Status:  c.status,
+	})
+	c.post()
+	go c.heartbeat()
+	return c
+}
+
+// Update records what the agent is doing and shows it.
+func (c *statusCard) Update(doing string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stream == nil {
+		return
+	}
+	c.doing = doing
+	c.postLocked()
+}
+
+func (c *statusCard) heartbeat() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.post()
+		}
+	}
+}
+
+func (c *statusCard) post() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.postLocked()
+}
+
+// postLocked replaces the note the channel has not read yet, if any, with
+// the current one.
+func (c *statusCard) postLocked() {
+	if c.stream == nil {
+		return
+	}
+	note := strings.ToUpper(c.doing[:1]) + c.doing[1:] + "…"
+	if elapsed := time.Since(c.started).Round(time.Second); elapsed > 0 {
+		note += fmt.Sprintf(" (%s)", elapsed)
+	}
+	select {
+	case <-c.status:
+	default:
+	}
+	select {
+	case c.status <- note:
+	default:
+	}
+}
+
+// Take returns the card's stream for the reply to be written to, ending
+// the status notes, or nil if it was already taken. The caller closes it.
+func (c *statusCard) Take() chan string {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stream := c.stream
+	if stream != nil {
+		c.stream = nil
+		close(c.done)
+		close(c.status)
+	}
+	return stream
+}
+
+// Close ends a card the reply was never written to, with content if it is
+// not empty. It reports whether content was shown on the card.
+func (c *statusCard) Close(content string) bool {
+	stream := c.Take()
+	if stream == nil {
+		return false
+	}
+	if content != "" {
+		stream <- content
+	}
+	close(stream)
+	return content != ""
+}
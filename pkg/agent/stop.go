@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+)
+
+// errTurnStopped is the cause of turns cancelled with /stop.
+var errTurnStopped = errors.New("stopped by the user")
+
+// isStopCommand reports whether a message asks to stop the running turn.
+func isStopCommand(content string) bool {
+	switch strings.ToLower(strings.TrimSpace(content)) {
+	case "stop", "/stop", "/cancel", "停止":
+		return true
+	}
+	return false
+}
+
+// addTurn registers a running turn of a session and returns its ID.
+func (l *AgentLoop) addTurn(sessionKey string, stop context.CancelCauseFunc) int {
+	l.turnsMu.Lock()
+	defer l.turnsMu.Unlock()
+	if l.turns == nil {
+		l.turns = make(map[string]map[int]context.CancelCauseFunc)
+	}
+	if l.turns[sessionKey] == nil {
+		l.turns[sessionKey] = make(map[int]context.CancelCauseFunc)
+	}
+	l.nextTurn++
+	l.turns[sessionKey][l.nextTurn] = stop
+	return l.nextTurn
+}
+
+func (l *AgentLoop) removeTurn(sessionKey string, id int) {
+	l.turnsMu.Lock()
+	defer l.turnsMu.Unlock()
+	delete(l.turns[sessionKey], id)
+	if len(l.turns[sessionKey]) == 0 {
+		delete(l.turns, sessionKey)
+	}
+}
+
+// stopTurns cancels the running turns of a session, in this agent and the
+// named agents, and returns how many there were.
+func (l *AgentLoop) stopTurns(sessionKey string) int {
+	l.turnsMu.Lock()
+	n := 0
+	for _, stop := range l.turns[sessionKey] {
+		stop(errTurnStopped)
+		n++
+	}
+	l.turnsMu.Unlock()
+	for _, agent := range l.Agents {
+		n += agent.stopTurns(sessionKey)
+	}
+	return n
+}
+
+// stopCommand handles "stop", /stop and /cancel. Each stopped turn
+// confirms with what it was doing; the command only answers when nothing
+// was running.
+func (l *AgentLoop) stopCommand(msg bus.InboundMessage) {
+	if n := l.stopTurns(msg.SessionKey()); n > 0 {
+		log.Printf("Stopping %d turn(s) for %s", n, msg.SessionKey())
+		return
+	}
+	reply := "Nothing is running."
+	if strings.TrimSpace(msg.Content) == "停止" {
+		reply = "当前没有正在进行的任务。"
+	}
+	l.Bus.PublishOutbound(bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Content: reply})
+}
+
+// stoppedMessage logs a turn stopped with /stop and returns the confirmation for the user.
+func stoppedMessage(sessionKey, stage string) string {
+	log.Printf("Turn for %s stopped by the user while %s", sessionKey, stage)
+	return fmt.Sprintf("Stopped while %s.", stage)
+}
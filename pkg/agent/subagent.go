@@ -5,23 +5,84 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/HKUDS/nanobot-go/pkg/bus"
 	"github.com/HKUDS/nanobot-go/pkg/config"
+	"github.com/HKUDS/nanobot-go/pkg/memory"
 	"github.com/HKUDS/nanobot-go/pkg/providers"
 	"github.com/HKUDS/nanobot-go/pkg/tools"
+	"github.com/HKUDS/nanobot-go/pkg/usage"
 )
 
 // SubagentManager manages background subagent execution.
 type SubagentManager struct {
-	Provider      providers.LLMProvider
-	Workspace     string
-	Bus           *bus.MessageBus
-	Model         string
-	BraveAPIKey   string
-	ExecConfig    *config.ExecToolConfig
-	running       map[string]bool // Simplified tracking
+	Provider    providers.LLMProvider
+	Workspace   string
+	Bus         *bus.MessageBus
+	Model       string
+	BraveAPIKey string
+	ExecConfig  *config.ExecToolConfig
+	Encodings   []string // Passed to read_file and exec for UTF-8 normalization
+	// Renderer runs pages' JavaScript for web_fetch; nil fetches them as is.
+	Renderer *tools.PageRenderer
+	// MaxConcurrent caps running subagents (0 = unlimited); up to MaxQueued
+	// further tasks wait for a free slot.
+	MaxConcurrent int
+	MaxQueued     int
+	// Per-subagent budgets; zero values mean 15 iterations, no time limit
+	// and no token limit.
+	MaxIterations int
+	Timeout       time.Duration
+	MaxTokens     int
+	// ReadOnly leaves out the write_file, edit_file and exec tools.
+	ReadOnly bool
+	// Activity records subagent tool runs in the daily activity ledger.
+	Activity *memory.ActivityLog
+	// Usage accounts for subagents' model requests, under their origin chat.
+	Usage *usage.Tracker
+	// DedupWindow is how long a spawned task answers identical spawns from
+	// the same chat with its own ID instead of starting a duplicate.
+	DedupWindow time.Duration
+	// ProgressInterval is the minimum time between progress updates posted
+	// to the origin chat; 0 disables them.
+	ProgressInterval time.Duration
+	// Research tasks are bounded by these instead of the budgets above.
+	ResearchSections   int
+	ResearchIterations int
+	// Agent is the named agent the subagents work for, which their results
+	// are routed back to; "" for the default agent.
+	Agent string
+
+	mu      sync.Mutex
+	running map[string]*subagentTask
+	queue   []*subagentTask
+	recent  map[string]*subagentTask // By dedupKey
+}
+
+// subagentTask is a spawned task, running or waiting in the queue.
+type subagentTask struct {
+	ID            string
+	Task          string
+	Label         string
+	Model         string // Empty for the manager's model
+	OriginChannel string
+	OriginChatID  string
+	SpawnedAt     time.Time
+	Research      bool // A deep research task, see runResearch
+}
+
+var reTaskNoise = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+// dedupKey identifies a task by its chat and normalized text, so that case,
+// punctuation and whitespace differences do not make it a new task.
+func dedupKey(task, originChannel, originChatID string) string {
+	norm := strings.TrimSpace(reTaskNoise.ReplaceAllString(strings.ToLower(task), " "))
+	return originChannel + ":" + originChatID + "|" + norm
 }
 
 // NewSubagentManager creates a new SubagentManager.
@@ -40,13 +101,14 @@ func NewSubagentManager(
 		execConfig = &config.ExecToolConfig{Timeout: 60, RestrictToWorkspace: true}
 	}
 	return &SubagentManager{
-		Provider:      provider,
-		Workspace:     workspace,
-		Bus:           messageBus,
-		Model:         model,
-		BraveAPIKey:   braveAPIKey,
-		ExecConfig:    execConfig,
-		running:       make(map[string]bool),
+		Provider:    provider,
+		Workspace:   workspace,
+		Bus:         messageBus,
+		Model:       model,
+		BraveAPIKey: braveAPIKey,
+		ExecConfig:  execConfig,
+		running:     make(map[string]*subagentTask),
+		recent:      make(map[string]*subagentTask),
 	}
 }
 
@@ -54,10 +116,16 @@ func NewSubagentManager(
 func (m *SubagentManager) Spawn(
 	task string,
 	label string,
+	model string,
 	originChannel string,
 	originChatID string,
 ) string {
-	taskID := fmt.Sprintf("%d", time.Now().UnixNano()) // Simple ID
+	return m.enqueue(newSubagentTask(task, label, model, originChannel, originChatID))
+}
+
+// newSubagentTask creates a task with a new ID, labelled with the start of
+// the task when label is empty.
+func newSubagentTask(task, label, model, originChannel, originChatID string) *subagentTask {
 	if label == "" {
 		if len(task) > 30 {
 			label = task[:30] + "..."
@@ -65,38 +133,169 @@ func (m *SubagentManager) Spawn(
 			label = task
 		}
 	}
+	return &subagentTask{
+		ID:            fmt.Sprintf("%d", time.Now().UnixNano()), // Simple ID
+		Task:          task,
+		Label:         label,
+		Model:         model,
+		OriginChannel: originChannel,
+		OriginChatID:  originChatID,
+		SpawnedAt:     time.Now(),
+	}
+}
+
+// enqueue starts a task, or queues it when MaxConcurrent tasks are running.
+// A task identical to one spawned recently from the same chat is not
+// started again.
+func (m *SubagentManager) enqueue(t *subagentTask) string {
+	taskID, label := t.ID, t.Label
+	key := dedupKey(t.Task, t.OriginChannel, t.OriginChatID)
+	if t.Research {
+		key = "research|" + key
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	m.running[taskID] = true
-	go m.runSubagent(taskID, task, label, originChannel, originChatID)
+	m.pruneRecentLocked()
+	if prev, ok := m.recent[key]; ok {
+		state := m.stateLocked(prev.ID)
+		log.Printf("Duplicate spawn of subagent [%s] (%s): %s", prev.ID, state, prev.Label)
+		if state == "finished" {
+			return fmt.Sprintf("Subagent [%s] already finished this task %s ago (id: %s) and its result was reported. Use that result instead of spawning it again.", prev.Label, time.Since(prev.SpawnedAt).Round(time.Second), prev.ID)
+		}
+		return fmt.Sprintf("Subagent [%s] is already %s for this task (id: %s); no duplicate was started. I'll notify you when it completes.", prev.Label, state, prev.ID)
+	}
+
+	if m.MaxConcurrent > 0 && len(m.running) >= m.MaxConcurrent {
+		if len(m.queue) >= m.MaxQueued {
+			log.Printf("Subagent queue full, rejected: %s", label)
+			return fmt.Sprintf("Cannot start subagent [%s]: %d subagents are running and %d are queued. Try again after some finish.", label, len(m.running), len(m.queue))
+		}
+		m.queue = append(m.queue, t)
+		m.recent[key] = t
+		log.Printf("Queued subagent [%s]: %s (position %d)", taskID, label, len(m.queue))
+		return fmt.Sprintf("Subagent [%s] queued (id: %s, position %d); it starts when one of the %d running subagents finishes. I'll notify you when it completes.", label, taskID, len(m.queue), len(m.running))
+	}
 
+	m.startLocked(t)
+	m.recent[key] = t
 	log.Printf("Spawned subagent [%s]: %s", taskID, label)
 	return fmt.Sprintf("Subagent [%s] started (id: %s). I'll notify you when it completes.", label, taskID)
 }
 
+// stateLocked reports whether a task is running, queued or finished. m.mu must be held.
+func (m *SubagentManager) stateLocked(taskID string) string {
+	if _, ok := m.running[taskID]; ok {
+		return "running"
+	}
+	for _, t := range m.queue {
+		if t.ID == taskID {
+			return "queued"
+		}
+	}
+	return "finished"
+}
+
+// pruneRecentLocked forgets finished tasks spawned before the dedup window. m.mu must be held.
+func (m *SubagentManager) pruneRecentLocked() {
+	for key, t := range m.recent {
+		if time.Since(t.SpawnedAt) >= m.DedupWindow && m.stateLocked(t.ID) == "finished" {
+			delete(m.recent, key)
+		}
+	}
+}
+
+// activeTask describes a queued or running subagent.
+type activeTask struct {
+	ID        string
+	Label     string
+	State     string
+	SpawnedAt time.Time
+}
+
+// activeTasks lists the running and then queued subagents spawned from a chat.
+func (m *SubagentManager) activeTasks(originChannel, originChatID string) []activeTask {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tasks []activeTask
+	for _, t := range m.running {
+		if t.OriginChannel == originChannel && t.OriginChatID == originChatID {
+			tasks = append(tasks, activeTask{t.ID, t.Label, "running", t.SpawnedAt})
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].SpawnedAt.Before(tasks[j].SpawnedAt) })
+	for _, t := range m.queue {
+		if t.OriginChannel == originChannel && t.OriginChatID == originChatID {
+			tasks = append(tasks, activeTask{t.ID, t.Label, "queued", t.SpawnedAt})
+		}
+	}
+	return tasks
+}
+
+// startLocked runs a task in the background. m.mu must be held.
+func (m *SubagentManager) startLocked(t *subagentTask) {
+	m.running[t.ID] = t
+	go func() {
+		defer m.finish(t.ID)
+		updates := m.startProgress(t)
+		defer updates.Stop()
+		if t.Research {
+			m.runResearch(t, updates)
+			return
+		}
+		m.runSubagent(t.ID, t.Task, t.Label, t.Model, t.OriginChannel, t.OriginChatID, updates)
+	}()
+}
+
+// finish releases a task's slot and starts the next queued task.
+func (m *SubagentManager) finish(taskID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.running, taskID)
+	for len(m.queue) > 0 && (m.MaxConcurrent <= 0 || len(m.running) < m.MaxConcurrent) {
+		next := m.queue[0]
+		m.queue = m.queue[1:]
+		log.Printf("Starting queued subagent [%s]: %s", next.ID, next.Label)
+		m.startLocked(next)
+	}
+}
+
 func (m *SubagentManager) runSubagent(
 	taskID string,
 	task string,
 	label string,
+	model string,
 	originChannel string,
 	originChatID string,
+	updates *subagentProgress,
 ) {
-	defer delete(m.running, taskID)
-
-	log.Printf("Subagent [%s] starting task: %s", taskID, label)
+	if model == "" {
+		model = m.Model
+	}
+	log.Printf("Subagent [%s] starting task with %s: %s", taskID, model, label)
 
 	// Build subagent tools
 	reg := tools.NewRegistry()
-	reg.Register(&tools.ReadFileTool{})
-	reg.Register(&tools.WriteFileTool{})
+	reg.Register(&tools.ReadFileTool{Encodings: m.Encodings})
 	reg.Register(&tools.ListDirTool{})
-	reg.Register(&tools.EditFileTool{})
-	
-	// Add ExecTool
-	reg.Register(tools.NewExecTool(m.ExecConfig.Timeout, m.Workspace, m.ExecConfig.RestrictToWorkspace))
-	
+	if !m.ReadOnly {
+		reg.Register(&tools.WriteFileTool{})
+		reg.Register(&tools.EditFileTool{})
+
+		// Add ExecTool
+		execTool := tools.NewExecTool(m.ExecConfig.Timeout, m.Workspace, m.ExecConfig.RestrictToWorkspace)
+		execTool.Encodings = m.Encodings
+		reg.Register(execTool)
+	}
+
 	// Add Web Tools
 	reg.Register(tools.NewWebSearchTool(m.BraveAPIKey, 5))
-	reg.Register(tools.NewWebFetchTool(50000))
+	webFetch := tools.NewWebFetchTool(50000)
+	webFetch.Renderer = m.Renderer
+	reg.Register(webFetch)
 
 	systemPrompt := m.buildSubagentPrompt(task)
 	messages := []interface{}{
@@ -104,22 +303,46 @@ func (m *SubagentManager) runSubagent(
 		map[string]interface{}{"role": "user", "content": task},
 	}
 
-	maxIterations := 15
+	maxIterations := m.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = 15
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if m.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), m.Timeout)
+	}
+	defer cancel()
+
 	iteration := 0
-	var finalResult string
+	usedTokens := 0
+	var finalResult, progress, stopReason string
 
 	for iteration < maxIterations {
 		iteration++
 
-		ctx := context.Background()
-		response, err := m.Provider.Chat(ctx, messages, reg.GetDefinitions(), m.Model)
+		response, err := m.Provider.Chat(ctx, messages, reg.GetDefinitions(), model)
 		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				stopReason = fmt.Sprintf("time limit of %s reached", m.Timeout)
+				break
+			}
 			log.Printf("Subagent [%s] error: %v", taskID, err)
 			m.announceResult(taskID, label, task, fmt.Sprintf("Error: %v", err), originChannel, originChatID, "error")
 			return
 		}
 
+		usedTokens += response.Usage["total_tokens"]
+		m.recordUsage(originChannel, originChatID, model, response, messages, reg.GetDefinitions())
+		if response.Content != "" {
+			progress = response.Content
+		}
+
 		if response.HasToolCalls() {
+			if m.MaxTokens > 0 && usedTokens >= m.MaxTokens {
+				stopReason = fmt.Sprintf("token budget of %d reached", m.MaxTokens)
+				break
+			}
+
 			toolCallsRaw := make([]interface{}, len(response.ToolCalls))
 			for i, tc := range response.ToolCalls {
 				argsJSON, _ := json.Marshal(tc.Arguments)
@@ -132,7 +355,7 @@ func (m *SubagentManager) runSubagent(
 					},
 				}
 			}
-			
+
 			// Add assistant message
 			msg := map[string]interface{}{
 				"role":       "assistant",
@@ -144,11 +367,17 @@ func (m *SubagentManager) runSubagent(
 			// Execute tools
 			for _, tc := range response.ToolCalls {
 				log.Printf("Subagent [%s] executing: %s", taskID, tc.Name)
-				result, err := reg.Execute(tc.Name, tc.Arguments)
+				recordToolRun(m.Activity, tc.Name, tc.Arguments)
+				updates.Update(describeToolCall(tc.Name, tc.Arguments))
+				result, err := executeTool(ctx, reg, tc.Name, tc.Arguments)
+				if ctx.Err() == context.DeadlineExceeded {
+					stopReason = fmt.Sprintf("time limit of %s reached", m.Timeout)
+					break
+				}
 				if err != nil {
 					result = fmt.Sprintf("Error executing tool: %v", err)
 				}
-				
+
 				messages = append(messages, map[string]interface{}{
 					"role":         "tool",
 					"tool_call_id": tc.ID,
@@ -156,12 +385,27 @@ func (m *SubagentManager) runSubagent(
 					"content":      result,
 				})
 			}
+			if stopReason != "" {
+				break
+			}
 		} else {
 			finalResult = response.Content
 			break
 		}
 	}
 
+	if finalResult == "" && stopReason == "" && iteration >= maxIterations {
+		stopReason = fmt.Sprintf("iteration limit of %d reached", maxIterations)
+	}
+	if stopReason != "" {
+		if progress == "" {
+			progress = "(no findings reported yet)"
+		}
+		log.Printf("Subagent [%s] stopped: %s (%d tokens used)", taskID, stopReason, usedTokens)
+		m.announceResult(taskID, label, task, fmt.Sprintf("Stopped early: %s.\n\nProgress so far:\n%s", stopReason, progress), originChannel, originChatID, "stopped")
+		return
+	}
+
 	if finalResult == "" {
 		finalResult = "Task completed but no final response was generated."
 	}
@@ -174,7 +418,9 @@ func (m *SubagentManager) announceResult(
 	taskID, label, task, result, originChannel, originChatID, status string,
 ) {
 	statusText := "completed successfully"
-	if status != "ok" {
+	if status == "stopped" {
+		statusText = "stopped before finishing"
+	} else if status != "ok" {
 		statusText = "failed"
 	}
 
@@ -193,10 +439,19 @@ Summarize this naturally for the user. Keep it brief (1-2 sentences). Do not men
 		ChatID:   fmt.Sprintf("%s:%s", originChannel, originChatID),
 		Content:  content,
 	}
+	if m.Agent != "" {
+		msg.Metadata = map[string]interface{}{"agent": m.Agent}
+	}
 	m.Bus.PublishInbound(msg)
 }
 
 func (m *SubagentManager) buildSubagentPrompt(task string) string {
+	can := "- Read and write files in the workspace\n- Execute shell commands"
+	cannot := ""
+	if m.ReadOnly {
+		can = "- Read and list files in the workspace"
+		cannot = "\n- Write or edit files, or execute shell commands (read-only mode)"
+	}
 	return fmt.Sprintf(`# Subagent
 
 You are a subagent spawned by the main agent to complete a specific task.
@@ -211,18 +466,40 @@ You are a subagent spawned by the main agent to complete a specific task.
 4. Be concise but informative in your findings
 
 ## What You Can Do
-- Read and write files in the workspace
-- Execute shell commands
+%s
 - Search the web and fetch web pages
 - Complete the task thoroughly
 
 ## What You Cannot Do
 - Send messages directly to users (no message tool available)
 - Spawn other subagents
-- Access the main agent's conversation history
+- Access the main agent's conversation history%s
 
 ## Workspace
 Your workspace is at: %s
 
-When you have completed the task, provide a clear summary of your findings or actions.`, task, m.Workspace)
+When you have completed the task, provide a clear summary of your findings or actions.`, task, can, cannot, m.Workspace)
+}
+
+// recordUsage accounts for a subagent's model request under its origin
+// chat, estimating the tokens when the provider reported none.
+func (m *SubagentManager) recordUsage(channel, chatID, model string, response *providers.LLMResponse, messages, toolDefs []interface{}) {
+	if m.Usage == nil {
+		return
+	}
+	r := usage.Record{
+		Session:          channel + ":" + chatID,
+		Channel:          channel,
+		Model:            providerModel(m.Provider, model),
+		PromptTokens:     response.Usage["prompt_tokens"],
+		CompletionTokens: response.Usage["completion_tokens"],
+	}
+	if r.PromptTokens == 0 && r.CompletionTokens == 0 {
+		r.PromptTokens = promptTokens(messages, toolDefs)
+		r.CompletionTokens = completionTokens(response.Content, response.ToolCalls)
+		r.Estimated = true
+	}
+	if err := m.Usage.Record(r); err != nil {
+		log.Printf("Error recording usage: %v", err)
+	}
 }
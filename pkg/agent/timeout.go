@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/tools"
+	"github.com/HKUDS/nanobot-go/pkg/tracing"
+)
+
+// turnContext returns the context bounding one agent turn in a session,
+// limited by agents.defaults.turnTimeout when set and cancelled on
+// shutdown or by /stop.
+func (l *AgentLoop) turnContext(sessionKey string) (context.Context, context.CancelFunc) {
+	ctx, stop := context.WithCancelCause(l.baseCtx)
+	id := l.addTurn(sessionKey, stop)
+	release := func() {
+		l.removeTurn(sessionKey, id)
+		stop(nil)
+	}
+	if timeout := l.Config.Agents.Defaults.TurnTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		return ctx, func() {
+			cancel()
+			release()
+		}
+	}
+	return ctx, release
+}
+
+// executeTool runs a tool call, giving up when ctx is done. Tools that do
+// network or process I/O stop with ctx; the rest finish in the background.
+func executeTool(ctx context.Context, reg *tools.Registry, name string, args map[string]interface{}) (string, error) {
+	ctx, span := tracing.Start(ctx, "tool "+name, tracing.String("tool.name", name))
+	defer span.End()
+
+	type toolResult struct {
+		result string
+		err    error
+	}
+	done := make(chan toolResult, 1)
+	go func() {
+		result, err := reg.Execute(ctx, name, args)
+		done <- toolResult{result, err}
+	}()
+
+	select {
+	case r := <-done:
+		span.RecordError(r.err)
+		if strings.HasPrefix(r.result, "Error") {
+			// Tools report most failures to the model as text
+			line, _, _ := strings.Cut(r.result, "\n")
+			span.SetError(line)
+		}
+		return r.result, r.err
+	case <-ctx.Done():
+		span.RecordError(ctx.Err())
+		return "", ctx.Err()
+	}
+}
+
+// timeoutMessage logs a turn that ran out of time and returns the notice for the user.
+func (l *AgentLoop) timeoutMessage(sessionKey, stage string) string {
+	timeout := l.Config.Agents.Defaults.TurnTimeout
+	log.Printf("Turn for %s exceeded %ds while %s", sessionKey, timeout, stage)
+	return fmt.Sprintf("Sorry, this request took longer than %d seconds and was stopped while %s. Try a smaller request or ask again.", timeout, stage)
+}
+
+// interruptedMessage logs a turn stopped by shutdown and returns the notice for the user.
+func (l *AgentLoop) interruptedMessage(sessionKey, stage string) string {
+	log.Printf("Turn for %s interrupted by shutdown while %s", sessionKey, stage)
+	return fmt.Sprintf("Sorry, I'm restarting and had to stop while %s. Please ask again in a moment.", stage)
+}
@@ -0,0 +1,269 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/HKUDS/nanobot-go/pkg/providers"
+	"github.com/HKUDS/nanobot-go/pkg/session"
+	"github.com/HKUDS/nanobot-go/pkg/usage"
+)
+
+const (
+	// tokensPerMessage is the overhead of a message's role and framing.
+	tokensPerMessage = 4
+	// tokensPerImage is charged for each image part, as for a high-detail
+	// 512px tile plus the base cost.
+	tokensPerImage = 765
+)
+
+// tokenPattern splits text into the pieces BPE tokenizers such as
+// cl100k start from: contractions, words with their leading space, runs of
+// up to three digits, punctuation and whitespace.
+var tokenPattern = regexp.MustCompile(`'(?:s|t|re|ve|m|ll|d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s+`)
+
+// estimateTokens estimates the token count of text. Each piece of the
+// pre-tokenized text costs one token per six ASCII characters, one per
+// CJK character and one per two other characters, and at least one.
+func estimateTokens(text string) int {
+	tokens := 0
+	for _, piece := range tokenPattern.FindAllString(text, -1) {
+		ascii, cjk, other := 0, 0, 0
+		for _, r := range piece {
+			switch {
+			case r < 128:
+				ascii++
+			case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+				cjk++
+			default:
+				other++
+			}
+		}
+		n := (ascii+5)/6 + cjk + (other+1)/2
+		if n == 0 {
+			n = 1
+		}
+		tokens += n
+	}
+	return tokens
+}
+
+// messageTokens estimates the tokens of one chat message, including
+// multimodal parts and the tool calls it makes.
+func messageTokens(m interface{}) int {
+	msg, _ := m.(map[string]interface{})
+	tokens := tokensPerMessage
+	partTokens := func(part map[string]interface{}) int {
+		if part["type"] == "image_url" {
+			return tokensPerImage
+		}
+		text, _ := part["text"].(string)
+		return estimateTokens(text)
+	}
+	switch content := msg["content"].(type) {
+	case string:
+		tokens += estimateTokens(content)
+	case []map[string]interface{}:
+		for _, part := range content {
+			tokens += partTokens(part)
+		}
+	case []interface{}:
+		for _, p := range content {
+			part, _ := p.(map[string]interface{})
+			tokens += partTokens(part)
+		}
+	}
+	if calls, ok := msg["tool_calls"].([]interface{}); ok {
+		for _, c := range calls {
+			call, _ := c.(map[string]interface{})
+			fn, _ := call["function"].(map[string]interface{})
+			name, _ := fn["name"].(string)
+			args, _ := fn["arguments"].(string)
+			tokens += tokensPerMessage + estimateTokens(name) + estimateTokens(args)
+		}
+	}
+	if name, ok := msg["name"].(string); ok {
+		tokens += estimateTokens(name)
+	}
+	return tokens
+}
+
+// promptTokens estimates the prompt tokens of a request's messages and tool definitions.
+func promptTokens(messages, toolDefs []interface{}) int {
+	tokens := 3 // every reply is primed with the assistant role
+	for _, m := range messages {
+		tokens += messageTokens(m)
+	}
+	if len(toolDefs) > 0 {
+		data, _ := json.Marshal(toolDefs)
+		tokens += estimateTokens(string(data))
+	}
+	return tokens
+}
+
+// knownContextWindows are the context windows of common model families,
+// matched by the longest prefix of the model name without its provider.
+var knownContextWindows = map[string]int{
+	"gpt-3.5-turbo":    16385,
+	"gpt-4":            8192,
+	"gpt-4-turbo":      128000,
+	"gpt-4o":           128000,
+	"gpt-4.1":          1047576,
+	"gpt-5":            400000,
+	"o1":               200000,
+	"o3":               200000,
+	"o4":               200000,
+	"claude":           200000,
+	"gemini":           1048576,
+	"deepseek":         64000,
+	"qwen":             131072,
+	"glm-4":            128000,
+	"kimi":             131072,
+	"moonshot-v1-8k":   8192,
+	"moonshot-v1-32k":  32768,
+	"moonshot-v1-128k": 131072,
+	"llama-3.1":        131072,
+	"llama-3.3":        131072,
+	"mistral-large":    131072,
+}
+
+// longestPrefix returns the value of the longest key in windows that model starts with.
+func longestPrefix(windows map[string]int, model string) (int, bool) {
+	best, value := -1, 0
+	for prefix, v := range windows {
+		if len(prefix) > best && strings.HasPrefix(model, prefix) {
+			best, value = len(prefix), v
+		}
+	}
+	return value, best >= 0
+}
+
+// contextWindow returns the context window in tokens of model, or 0 when unknown.
+func (l *AgentLoop) contextWindow(model string) int {
+	model = strings.ToLower(providerModel(l.Provider, model))
+	bare := model[strings.LastIndex(model, "/")+1:]
+
+	defaults := l.Config.Agents.Defaults
+	configured := make(map[string]int, len(defaults.ContextWindows))
+	for k, v := range defaults.ContextWindows {
+		configured[strings.ToLower(k)] = v
+	}
+	for _, name := range []string{model, bare} {
+		if v, ok := longestPrefix(configured, name); ok {
+			return v
+		}
+	}
+	if v, ok := longestPrefix(knownContextWindows, bare); ok {
+		return v
+	}
+	return defaults.ContextWindow
+}
+
+// providerModel returns the model a request for model goes to, with
+// aliases and provider prefixes resolved.
+func providerModel(provider providers.LLMProvider, model string) string {
+	if fallback, ok := provider.(*providers.FallbackProvider); ok {
+		provider = fallback.Primary
+	}
+	if router, ok := provider.(*providers.Router); ok {
+		_, model = router.Resolve(model)
+	}
+	return model
+}
+
+// promptBudget returns the most tokens a prompt for l.Model may use: its
+// context window less room for the reply (maxTokens, at most a quarter of
+// the window) and a tenth for estimation error. 0 means no limit.
+func (l *AgentLoop) promptBudget() int {
+	window := l.contextWindow(l.Model)
+	if window <= 0 {
+		return 0
+	}
+	reserve := l.Config.Agents.Defaults.MaxTokens
+	if reserve > window/4 {
+		reserve = window / 4
+	}
+	return (window - reserve) * 9 / 10
+}
+
+const (
+	metaUsagePromptTokens     = "usage_prompt_tokens"
+	metaUsageCompletionTokens = "usage_completion_tokens"
+	metaUsageRequests         = "usage_requests"
+	metaUsageEstimated        = "usage_estimated_requests"
+	metaUsageLastPrompt       = "usage_last_prompt_tokens"
+)
+
+// recordUsage adds one model request for a chat to the usage totals kept
+// in the session metadata and to the usage tracker. When the provider
+// reported no usage, the estimates are recorded instead and the request is
+// counted as estimated.
+func (l *AgentLoop) recordUsage(sess *session.Session, channel, model string, reported map[string]int, estPrompt, estCompletion int) {
+	prompt, completion := reported["prompt_tokens"], reported["completion_tokens"]
+	estimated := prompt == 0 && completion == 0
+	if estimated {
+		prompt, completion = estPrompt, estCompletion
+		n, _ := metaInt(sess.Metadata, metaUsageEstimated)
+		sess.SetMeta(metaUsageEstimated, n+1)
+	}
+	add := func(key string, v int) {
+		n, _ := metaInt(sess.Metadata, key)
+		sess.SetMeta(key, n+v)
+	}
+	add(metaUsagePromptTokens, prompt)
+	add(metaUsageCompletionTokens, completion)
+	add(metaUsageRequests, 1)
+	sess.SetMeta(metaUsageLastPrompt, prompt)
+
+	if l.Usage == nil {
+		return
+	}
+	err := l.Usage.Record(usage.Record{
+		Session:          sess.Key,
+		Channel:          channel,
+		Model:            providerModel(l.Provider, model),
+		PromptTokens:     prompt,
+		CompletionTokens: completion,
+		Estimated:        estimated,
+	})
+	if err != nil {
+		log.Printf("Error recording usage: %v", err)
+	}
+}
+
+// completionTokens estimates the tokens of a reply and the tool calls in it.
+func completionTokens(content string, toolCalls []providers.ToolCallRequest) int {
+	tokens := estimateTokens(content)
+	for _, tc := range toolCalls {
+		args, _ := json.Marshal(tc.Arguments)
+		tokens += tokensPerMessage + estimateTokens(tc.Name) + estimateTokens(string(args))
+	}
+	return tokens
+}
+
+// usageReport describes the token usage recorded for a chat.
+func (l *AgentLoop) usageReport(sess *session.Session) string {
+	requests, _ := metaInt(sess.Metadata, metaUsageRequests)
+	if requests == 0 {
+		return "No model usage has been recorded for this chat yet."
+	}
+	prompt, _ := metaInt(sess.Metadata, metaUsagePromptTokens)
+	completion, _ := metaInt(sess.Metadata, metaUsageCompletionTokens)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("This chat has used %d tokens over %d model requests: %d prompt, %d completion.", prompt+completion, requests, prompt, completion))
+	if estimated, _ := metaInt(sess.Metadata, metaUsageEstimated); estimated > 0 {
+		sb.WriteString(fmt.Sprintf(" %d of the requests were not reported by the provider and are estimated.", estimated))
+	}
+	if last, ok := metaInt(sess.Metadata, metaUsageLastPrompt); ok {
+		if window := l.contextWindow(l.Model); window > 0 {
+			sb.WriteString(fmt.Sprintf("\nThe last prompt was %d tokens, %d%% of the %d-token context window.", last, last*100/window, window))
+		} else {
+			sb.WriteString(fmt.Sprintf("\nThe last prompt was %d tokens.", last))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/translate"
+)
+
+// translationTimeout bounds a single translation call.
+const translationTimeout = 60 * time.Second
+
+// translationApplies reports whether messages from channel are translated.
+func (l *AgentLoop) translationApplies(channel string) bool {
+	if l.Translator == nil {
+		return false
+	}
+	channels := l.Config.Translation.Channels
+	if len(channels) == 0 {
+		return true
+	}
+	for _, c := range channels {
+		if strings.EqualFold(c, channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// translateInbound translates a user message into the working language.
+// It returns the text the agent sees and the user's language, or "" when
+// the message is in the working language or could not be translated.
+func (l *AgentLoop) translateInbound(channel, text string) (string, string) {
+	working := l.Config.Translation.WorkingLanguage
+	if !l.translationApplies(channel) || strings.TrimSpace(text) == "" || translate.SameLanguage(detectLanguage(text), working) {
+		return text, ""
+	}
+
+	ctx, cancel := context.WithTimeout(l.baseCtx, translationTimeout)
+	defer cancel()
+	translated, lang, err := l.Translator.Translate(ctx, text, working)
+	if err != nil {
+		// Fail open: the agent can still answer the original
+		log.Printf("Failed to translate message from %s: %v", channel, err)
+		return text, ""
+	}
+	if lang == "" || translate.SameLanguage(lang, working) {
+		return text, ""
+	}
+	log.Printf("Translated message from %s into %s", lang, working)
+	return translated, lang
+}
+
+// translateReply translates a reply into the user's language, returning
+// it unchanged if that fails.
+func (l *AgentLoop) translateReply(text, lang string) string {
+	if lang == "" || strings.TrimSpace(text) == "" {
+		return text
+	}
+	ctx, cancel := context.WithTimeout(l.baseCtx, translationTimeout)
+	defer cancel()
+	translated, _, err := l.Translator.Translate(ctx, text, lang)
+	if err != nil {
+		log.Printf("Failed to translate reply into %s: %v", lang, err)
+		return text
+	}
+	return translated
+}
+
+// translationNote tells the agent that it is talking through a translator.
+func translationNote(working, userLang string) string {
+	return fmt.Sprintf("## Translation\nThe user writes in %s. Their messages are translated into %s for you and your replies are translated back, so always reply in %s.", userLang, working, working)
+}
@@ -0,0 +1,35 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+)
+
+// whoamiCommand handles /whoami: the sender's and chat's IDs on this
+// channel, written the way allowFrom and admins take them.
+func (l *AgentLoop) whoamiCommand(msg bus.InboundMessage) string {
+	// Telegram senders are "id|username"
+	id, username, _ := strings.Cut(msg.SenderID, "|")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Channel: %s\n", msg.Channel)
+	if username != "" {
+		fmt.Fprintf(&b, "Your ID: %s (@%s)\n", id, username)
+	} else {
+		fmt.Fprintf(&b, "Your ID: %s\n", id)
+	}
+	fmt.Fprintf(&b, "Chat ID: %s\n", msg.ChatID)
+
+	b.WriteString("\n")
+	switch msg.Channel {
+	case "telegram", "feishu", "dingtalk":
+		fmt.Fprintf(&b, "To allow yourself, add to channels.%s.allowFrom:\n  %q\n", msg.Channel, id)
+	}
+	if msg.Channel == "telegram" && strings.HasPrefix(msg.ChatID, "-") {
+		fmt.Fprintf(&b, "To allow everyone in this group instead:\n  %q\n", msg.ChatID)
+	}
+	fmt.Fprintf(&b, "To make yourself an admin, add to admins:\n  %q", msg.Channel+":"+id)
+	return b.String()
+}
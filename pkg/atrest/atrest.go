@@ -0,0 +1,371 @@
+// Package atrest encrypts the files that hold chat history, such as
+// sessions, memory and the cron store, with AES-GCM, for bots running on
+// servers other users can read files on.
+//
+// Components register the directories and files they keep sensitive data
+// in with Protect and read and write them through this package. While a key
+// is set, files written under a protected path are encrypted; reads decrypt
+// encrypted files and pass plain ones through, so files written before
+// encryption was turned on are encrypted the next time they are written.
+package atrest
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// magic starts every encrypted file, followed by the nonce and the sealed
+// content.
+const magic = "NBENC1\n"
+
+// KeySize is the length of a key: AES-256.
+const KeySize = 32
+
+var (
+	// ErrNoKey is returned when reading an encrypted file without a key.
+	ErrNoKey = errors.New("file is encrypted but no encryption key is set")
+	// ErrWrongKey is returned when an encrypted file does not open with the key.
+	ErrWrongKey = errors.New("cannot decrypt file: wrong encryption key or corrupted file")
+)
+
+var (
+	mu        sync.RWMutex
+	aead      cipher.AEAD
+	protected []string
+	excluded  []string
+)
+
+// ParseKey decodes a key given as base64 or hex.
+func ParseKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	for _, decode := range []func(string) ([]byte, error){
+		base64.StdEncoding.DecodeString,
+		base64.URLEncoding.DecodeString,
+		base64.RawStdEncoding.DecodeString,
+		hex.DecodeString,
+	} {
+		if key, err := decode(s); err == nil && len(key) == KeySize {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("encryption key must be %d bytes, base64 or hex encoded", KeySize)
+}
+
+// NewKey returns a random key, base64 encoded.
+func NewKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// SetKey turns on encryption with key; nil turns it off.
+func SetKey(key []byte) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if key == nil {
+		aead = nil
+		return nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	aead = gcm
+	return nil
+}
+
+// Enabled reports whether a key is set.
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return aead != nil
+}
+
+// Protect marks a directory or file as holding sensitive data.
+func Protect(path string) {
+	mu.Lock()
+	defer mu.Unlock()
+	protected = appendPath(protected, path)
+}
+
+// Exclude keeps a directory under a protected one in plain text, for
+// files other programs must read as they are, such as media sent to
+// channels.
+func Exclude(path string) {
+	mu.Lock()
+	defer mu.Unlock()
+	excluded = appendPath(excluded, path)
+}
+
+func appendPath(paths []string, path string) []string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	for _, p := range paths {
+		if p == path {
+			return paths
+		}
+	}
+	return append(paths, path)
+}
+
+// Protected returns the protected directories and files.
+func Protected() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]string(nil), protected...)
+}
+
+// IsProtected reports whether path is under a protected path and not under
+// an excluded one.
+func IsProtected(path string) bool {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	return within(path, protected) && !within(path, excluded)
+}
+
+func within(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEncrypted reports whether data is an encrypted file.
+func IsEncrypted(data []byte) bool {
+	return strings.HasPrefix(string(data), magic)
+}
+
+// Encrypt seals data with the key.
+func Encrypt(data []byte) ([]byte, error) {
+	mu.RLock()
+	gcm := aead
+	mu.RUnlock()
+	if gcm == nil {
+		return nil, errors.New("no encryption key is set")
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append([]byte(magic), nonce...)
+	return gcm.Seal(out, nonce, data, nil), nil
+}
+
+// Decrypt opens data sealed by Encrypt. Data that is not encrypted is
+// returned as is.
+func Decrypt(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+	mu.RLock()
+	gcm := aead
+	mu.RUnlock()
+	if gcm == nil {
+		return nil, ErrNoKey
+	}
+	data = data[len(magic):]
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrWrongKey
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plain, nil
+}
+
+// ReadFile reads a file, decrypting it if it is encrypted.
+func ReadFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := Decrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return plain, nil
+}
+
+// Open opens a file for reading, decrypting it if it is encrypted. Plain
+// files are streamed; encrypted ones are read and decrypted whole.
+func Open(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, len(magic))
+	n, _ := io.ReadFull(f, head)
+	if !IsEncrypted(head[:n]) {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return f, nil
+	}
+	f.Close()
+	data, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// seal encrypts data for path if it is protected and a key is set.
+func seal(path string, data []byte) ([]byte, error) {
+	if !Enabled() || !IsProtected(path) {
+		return data, nil
+	}
+	return Encrypt(data)
+}
+
+// WriteFile writes a file, encrypted if it is protected and a key is set.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	data, err := seal(path, data)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, perm)
+}
+
+// WriteFileAtomic writes a file like WriteFile, through a temporary file
+// renamed over it, so readers and a crash never leave a partial file.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	data, err := seal(path, data)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// AppendFile appends data to a file, creating it if needed. An encrypted
+// file can't be appended to in place, so it is read, extended and written
+// back whole.
+func AppendFile(path string, data []byte, perm os.FileMode) error {
+	if Enabled() && IsProtected(path) || encryptedFile(path) {
+		existing, err := ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return WriteFile(path, append(existing, data...), perm)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(data)
+	return err
+}
+
+// encryptedFile reports whether the file at path exists and is encrypted.
+func encryptedFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, len(magic))
+	n, _ := f.Read(head)
+	return IsEncrypted(head[:n])
+}
+
+// Rewrite rewrites the protected files under the protected paths
+// encrypted, or decrypted when decrypt is set, returning how many changed.
+// It is for turning encryption on or off for existing data.
+func Rewrite(decrypt bool) (int, error) {
+	if !Enabled() {
+		return 0, errors.New("no encryption key is set")
+	}
+	changed := 0
+	for _, root := range Protected() {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path != root && !IsProtected(path) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !info.Mode().IsRegular() || !IsProtected(path) {
+				return nil
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if IsEncrypted(data) != decrypt {
+				return nil
+			}
+			plain, err := Decrypt(data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			out := plain
+			if !decrypt {
+				if out, err = Encrypt(plain); err != nil {
+					return err
+				}
+			}
+			if err := ioutil.WriteFile(path, out, info.Mode().Perm()); err != nil {
+				return err
+			}
+			changed++
+			return nil
+		})
+		if err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
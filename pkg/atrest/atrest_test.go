@@ -0,0 +1,185 @@
+package atrest
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useKey turns on encryption with a new key until the test ends.
+func useKey(t *testing.T) []byte {
+	t.Helper()
+	encoded, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetKey(key); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetKey(nil) })
+	return key
+}
+
+func TestRoundTrip(t *testing.T) {
+	useKey(t)
+	dir := t.TempDir()
+	Protect(filepath.Join(dir, "protected"))
+	Exclude(filepath.Join(dir, "protected", "media"))
+	for _, sub := range []string{"protected/media", "plain"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plain := []byte("user: my card number is 4111\n")
+	writers := []struct {
+		name  string
+		write func(path string) error
+		want  []byte
+	}{
+		{"WriteFile", func(path string) error { return WriteFile(path, plain, 0600) }, plain},
+		{"WriteFileAtomic", func(path string) error { return WriteFileAtomic(path, plain, 0600) }, plain},
+		{"AppendFile", func(path string) error {
+			if err := AppendFile(path, plain, 0600); err != nil {
+				return err
+			}
+			return AppendFile(path, plain, 0600)
+		}, append(append([]byte(nil), plain...), plain...)},
+	}
+	places := []struct {
+		dir       string
+		encrypted bool
+	}{
+		{"protected", true},
+		{"protected/media", false},
+		{"plain", false},
+	}
+	for _, w := range writers {
+		for _, p := range places {
+			t.Run(w.name+" "+p.dir, func(t *testing.T) {
+				path := filepath.Join(dir, p.dir, w.name+".jsonl")
+				if err := w.write(path); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+				raw, err := ioutil.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if IsEncrypted(raw) != p.encrypted {
+					t.Errorf("encrypted on disk = %v, want %v", IsEncrypted(raw), p.encrypted)
+				}
+				if p.encrypted && bytes.Contains(raw, []byte("4111")) {
+					t.Errorf("plain text on disk: %q", raw)
+				}
+				got, err := ReadFile(path)
+				if err != nil {
+					t.Fatalf("ReadFile: %v", err)
+				}
+				if !bytes.Equal(got, w.want) {
+					t.Errorf("ReadFile = %q, want %q", got, w.want)
+				}
+				f, err := Open(path)
+				if err != nil {
+					t.Fatalf("Open: %v", err)
+				}
+				defer f.Close()
+				if got, _ := ioutil.ReadAll(f); !bytes.Equal(got, w.want) {
+					t.Errorf("Open = %q, want %q", got, w.want)
+				}
+			})
+		}
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	key := useKey(t)
+	sealed, err := Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name string
+		data []byte
+		key  string // "" keeps the key, "none" removes it, "other" sets another
+		want error
+	}{
+		{"right key", sealed, "", nil},
+		{"plain data passes through", []byte("plain"), "none", nil},
+		{"wrong key", sealed, "other", ErrWrongKey},
+		{"no key", sealed, "none", ErrNoKey},
+		{"tampered", tampered, "", ErrWrongKey},
+		{"truncated", sealed[:len(magic)+4], "", ErrWrongKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Registered first, so it runs after useKey's own cleanup
+			t.Cleanup(func() { SetKey(key) })
+			switch tt.key {
+			case "none":
+				SetKey(nil)
+			case "other":
+				useKey(t)
+			}
+			path := filepath.Join(t.TempDir(), "file")
+			if err := ioutil.WriteFile(path, tt.data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ReadFile(path)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ReadFile error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		ok   bool
+	}{
+		{"base64", "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=", true},
+		{"raw base64", "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8", true},
+		{"hex", "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", true},
+		{"surrounding space", " 000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f\n", true},
+		{"too short", "AAECAwQFBgcICQoLDA0ODw==", false},
+		{"not encoded", "correct horse battery staple", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseKey(tt.in)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ParseKey(%q) error = %v, want ok %v", tt.in, err, tt.ok)
+			}
+			if tt.ok && len(key) != KeySize {
+				t.Errorf("key is %d bytes, want %d", len(key), KeySize)
+			}
+		})
+	}
+}
+
+func TestLoadKeyClearsEnvironment(t *testing.T) {
+	const env = "NANOBOT_TEST_ENCRYPTION_KEY"
+	encoded, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(env, encoded)
+	if _, err := LoadKey(env, false); err != nil {
+		t.Fatalf("LoadKey: %v", err)
+	}
+	if _, ok := os.LookupEnv(env); ok {
+		t.Errorf("%s is still set after LoadKey", env)
+	}
+}
@@ -0,0 +1,57 @@
+package atrest
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Keyring entry the key is stored under.
+const (
+	keyringService = "nanobot"
+	keyringAccount = "encryption-key"
+)
+
+// LoadKey returns the key from the environment variable envVar or, if that
+// is unset and useKeyring is set, from the system keyring. The variable is
+// removed from the environment once read, so commands the agent runs, which
+// inherit it, never see the key.
+func LoadKey(envVar string, useKeyring bool) ([]byte, error) {
+	if value := os.Getenv(envVar); value != "" {
+		os.Unsetenv(envVar)
+		return ParseKey(value)
+	}
+	if !useKeyring {
+		return nil, fmt.Errorf("no encryption key: set %s", envVar)
+	}
+	value, err := keyringKey()
+	if err != nil {
+		return nil, fmt.Errorf("no encryption key in %s, and reading the keyring failed: %w", envVar, err)
+	}
+	return ParseKey(value)
+}
+
+// keyringKey reads the key with the platform's keyring tool: security on
+// macOS, secret-tool (libsecret) elsewhere.
+func keyringKey() (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", keyringAccount, "-w")
+	case "windows":
+		return "", fmt.Errorf("the keyring is not supported on Windows")
+	default:
+		cmd = exec.Command("secret-tool", "lookup", "service", keyringService, "account", keyringAccount)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+	key := strings.TrimSpace(string(out))
+	if key == "" {
+		return "", fmt.Errorf("no %s entry for %s", keyringService, keyringAccount)
+	}
+	return key, nil
+}
@@ -0,0 +1,90 @@
+// Package buildinfo describes the running nanobot build, so bug reports and
+// the agent's description of itself name a concrete build. Version, Commit
+// and Date are set at build time (see the Makefile):
+//
+//	-ldflags "-X github.com/HKUDS/nanobot-go/pkg/buildinfo.Version=v1.2.3
+//	          -X github.com/HKUDS/nanobot-go/pkg/buildinfo.Commit=1a2b3c4
+//	          -X github.com/HKUDS/nanobot-go/pkg/buildinfo.Date=2026-01-02T15:04:05Z"
+//
+// Builds without them fall back to the VCS details the Go toolchain embeds.
+package buildinfo
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	if Version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		Version = info.Main.Version
+	}
+	var revision, modified string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value
+		case "vcs.time":
+			if Date == "" {
+				Date = s.Value
+			}
+		}
+	}
+	if Commit == "" && revision != "" {
+		Commit = revision
+		if modified == "true" {
+			Commit += "-dirty"
+		}
+	}
+}
+
+// shortCommit abbreviates a full commit hash, keeping any suffix.
+func shortCommit() string {
+	hash, suffix := Commit, ""
+	if i := strings.Index(hash, "-"); i >= 0 {
+		hash, suffix = hash[:i], hash[i:]
+	}
+	if len(hash) > 7 {
+		hash = hash[:7]
+	}
+	return hash + suffix
+}
+
+// String describes the build, e.g. "v1.2.3 (1a2b3c4, built 2026-01-02T15:04:05Z)".
+func String() string {
+	var details []string
+	if Commit != "" {
+		details = append(details, shortCommit())
+	}
+	if Date != "" {
+		details = append(details, "built "+Date)
+	}
+	if len(details) == 0 {
+		return Version
+	}
+	return fmt.Sprintf("%s (%s)", Version, strings.Join(details, ", "))
+}
+
+// Info returns the build details for JSON output.
+func Info() map[string]string {
+	return map[string]string{
+		"version":  Version,
+		"commit":   Commit,
+		"date":     Date,
+		"go":       runtime.Version(),
+		"platform": runtime.GOOS + "/" + runtime.GOARCH,
+	}
+}
@@ -1,8 +1,13 @@
 package bus
 
 import (
+	"fmt"
 	"log"
+	"path"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // MessageBus decouples chat channels from the agent core.
@@ -10,10 +15,24 @@ type MessageBus struct {
 	inbound             chan InboundMessage
 	outbound            chan OutboundMessage
 	outboundSubscribers map[string][]func(OutboundMessage)
+	patternSubscribers  []patternSubscriber
+	outboundHooks       []OutboundHook
+	handledHooks        []func(InboundMessage)
 	subscribersMu       sync.RWMutex
 	stopChan            chan struct{}
+	stopOnce            sync.Once
+	pending             int64 // outbound messages not yet fully delivered
+	persist             *persistence
+	counters            busCounters
+	scheduler           Scheduler
+	redactor            Redactor
+	sent                sentLog
 }
 
+// Scheduler stores a message with a future DeliverAt and publishes it
+// again when it is due.
+type Scheduler func(OutboundMessage) error
+
 // NewMessageBus creates a new MessageBus.
 func NewMessageBus() *MessageBus {
 	return &MessageBus{
@@ -24,9 +43,20 @@ func NewMessageBus() *MessageBus {
 	}
 }
 
-// PublishInbound publishes a message from a channel to the agent.
+// PublishInbound publishes a message from a channel to the agent. It
+// waits for room when the queue is full, unless the bus is persistent.
 func (b *MessageBus) PublishInbound(msg InboundMessage) {
-	b.inbound <- msg
+	atomic.AddUint64(&b.counters.inPublished, 1)
+	if p := b.persist; p != nil {
+		seq, err := p.inbound.add(b.redact(msg))
+		if err == nil {
+			msg.Seq = seq
+			p.push(msg)
+			return
+		}
+		log.Printf("Bus: failed to journal inbound message, delivering without it: %v", err)
+	}
+	b.sendInbound(msg)
 }
 
 // ConsumeInbound returns a channel to consume inbound messages.
@@ -34,18 +64,171 @@ func (b *MessageBus) ConsumeInbound() <-chan InboundMessage {
 	return b.inbound
 }
 
-// PublishOutbound publishes a response from the agent to channels.
-func (b *MessageBus) PublishOutbound(msg OutboundMessage) {
+// PublishOutbound publishes a response from the agent to channels and
+// returns its ID.
+func (b *MessageBus) PublishOutbound(msg OutboundMessage) string {
+	if msg.ID == "" {
+		msg.ID = NewMessageID()
+	}
+	atomic.AddUint64(&b.counters.outPublished, 1)
+	if p := b.persist; p != nil && msg.Stream == nil {
+		if seq, err := p.outbound.add(msg); err == nil {
+			msg.Seq = seq
+		} else {
+			log.Printf("Bus: failed to journal outbound message: %v", err)
+		}
+	}
+	atomic.AddInt64(&b.pending, 1)
 	b.outbound <- msg
+	return msg.ID
+}
+
+// patternSubscriber receives outbound messages for every channel whose
+// name matches pattern.
+type patternSubscriber struct {
+	pattern  string
+	callback func(OutboundMessage)
 }
 
-// SubscribeOutbound subscribes to outbound messages for a specific channel.
+// SubscribeOutbound subscribes to outbound messages for a channel. The
+// channel may be "*" for all channels or a pattern as in path.Match, such
+// as "ding*".
 func (b *MessageBus) SubscribeOutbound(channel string, callback func(OutboundMessage)) {
 	b.subscribersMu.Lock()
 	defer b.subscribersMu.Unlock()
+	if strings.ContainsAny(channel, "*?[") {
+		if _, err := path.Match(channel, ""); err != nil {
+			log.Printf("Invalid outbound subscription pattern %q: %v", channel, err)
+			return
+		}
+		b.patternSubscribers = append(b.patternSubscribers, patternSubscriber{pattern: channel, callback: callback})
+		return
+	}
 	b.outboundSubscribers[channel] = append(b.outboundSubscribers[channel], callback)
 }
 
+// subscribersLocked returns the callbacks subscribed to a channel by name
+// or by pattern.
+func (b *MessageBus) subscribersLocked(channel string) []func(OutboundMessage) {
+	subscribers := b.outboundSubscribers[channel]
+	for _, ps := range b.patternSubscribers {
+		if ok, _ := path.Match(ps.pattern, channel); ok {
+			subscribers = append(subscribers[:len(subscribers):len(subscribers)], ps.callback)
+		}
+	}
+	return subscribers
+}
+
+// HasSubscribers reports whether any subscriber receives messages for channel.
+func (b *MessageBus) HasSubscribers(channel string) bool {
+	b.subscribersMu.RLock()
+	defer b.subscribersMu.RUnlock()
+	return len(b.subscribersLocked(channel)) > 0
+}
+
+// Target is a chat to deliver an outbound message to.
+type Target struct {
+	Channel string `json:"channel"`
+	ChatID  string `json:"chat_id"`
+}
+
+// ParseTarget parses a target written as "channel:chat_id".
+func ParseTarget(s string) (Target, error) {
+	channel, chatID, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok || channel == "" || chatID == "" {
+		return Target{}, fmt.Errorf("invalid target %q, expected channel:chat_id", s)
+	}
+	return Target{Channel: channel, ChatID: chatID}, nil
+}
+
+// Broadcast publishes a copy of msg to each target. Each copy passes the
+// outbound hooks on its own, so per-channel formatting applies. A stream
+// cannot be shared, so msg.Stream is read to the end and sent as content.
+func (b *MessageBus) Broadcast(msg OutboundMessage, targets []Target) {
+	if msg.Stream != nil {
+		var sb strings.Builder
+		for chunk := range msg.Stream {
+			sb.WriteString(chunk)
+		}
+		msg.Content += sb.String()
+		msg.Stream = nil
+	}
+	for _, t := range targets {
+		m := msg
+		m.ID = ""
+		m.Channel = t.Channel
+		m.ChatID = t.ChatID
+		if msg.Metadata != nil {
+			m.Metadata = make(map[string]interface{}, len(msg.Metadata))
+			for k, v := range msg.Metadata {
+				m.Metadata[k] = v
+			}
+		}
+		b.PublishOutbound(m)
+	}
+}
+
+// OutboundHook rewrites an outbound message before it reaches subscribers.
+type OutboundHook func(OutboundMessage) OutboundMessage
+
+// AddOutboundHook registers a hook applied, in order of registration, to
+// every outbound message during dispatch.
+func (b *MessageBus) AddOutboundHook(hook OutboundHook) {
+	b.subscribersMu.Lock()
+	defer b.subscribersMu.Unlock()
+	b.outboundHooks = append(b.outboundHooks, hook)
+}
+
+// OnHandled registers a function called with every inbound message once
+// the agent is done with it, after it published its replies.
+func (b *MessageBus) OnHandled(fn func(InboundMessage)) {
+	b.subscribersMu.Lock()
+	defer b.subscribersMu.Unlock()
+	b.handledHooks = append(b.handledHooks, fn)
+}
+
+// Redactor returns content with the secrets it carries, such as a token
+// given in a command, replaced, and whether there were any.
+type Redactor func(content string) (string, bool)
+
+// SetRedactor sets the function that keeps secrets in inbound messages
+// out of the journal. Messages it redacted are not delivered again after
+// a restart, as their content is incomplete.
+func (b *MessageBus) SetRedactor(r Redactor) {
+	b.subscribersMu.Lock()
+	defer b.subscribersMu.Unlock()
+	b.redactor = r
+}
+
+// SetScheduler sets the scheduler that holds back messages to be
+// delivered later. Without one they are delivered at once.
+func (b *MessageBus) SetScheduler(s Scheduler) {
+	b.subscribersMu.Lock()
+	defer b.subscribersMu.Unlock()
+	b.scheduler = s
+}
+
+// schedule hands msg to the scheduler if it is due later, and reports
+// whether it did.
+func (b *MessageBus) schedule(msg OutboundMessage, scheduler Scheduler) bool {
+	if msg.DeliverAt.IsZero() || !msg.DeliverAt.After(time.Now()) {
+		return false
+	}
+	switch {
+	case msg.Stream != nil:
+		log.Printf("Bus: a streamed message cannot be scheduled, delivering it now")
+	case scheduler == nil:
+		log.Printf("Bus: no scheduler, delivering message for %s:%s due at %s now", msg.Channel, msg.ChatID, msg.DeliverAt.Format(time.RFC3339))
+	default:
+		err := scheduler(msg)
+		if err == nil {
+			return true
+		}
+		log.Printf("Bus: failed to schedule message for %s:%s, delivering it now: %v", msg.Channel, msg.ChatID, err)
+	}
+	return false
+}
+
 // DispatchOutbound starts dispatching outbound messages to subscribers.
 // This should be run in a goroutine.
 func (b *MessageBus) DispatchOutbound() {
@@ -53,28 +236,73 @@ func (b *MessageBus) DispatchOutbound() {
 		select {
 		case msg := <-b.outbound:
 			b.subscribersMu.RLock()
-			subscribers, ok := b.outboundSubscribers[msg.Channel]
+			subscribers := b.subscribersLocked(msg.Channel)
+			hooks := b.outboundHooks
+			scheduler := b.scheduler
 			b.subscribersMu.RUnlock()
 
-			if ok {
-				for _, cb := range subscribers {
-					go func(callback func(OutboundMessage), message OutboundMessage) {
-						defer func() {
-							if r := recover(); r != nil {
-								log.Printf("Error in outbound subscriber callback: %v", r)
-							}
-						}()
-						callback(message)
-					}(cb, msg)
+			if b.schedule(msg, scheduler) || len(subscribers) == 0 {
+				b.ackOutbound(msg)
+				atomic.AddInt64(&b.pending, -1)
+				continue
+			}
+			b.startOutbound(msg)
+			for _, hook := range hooks {
+				msg = hook(msg)
+			}
+			// Each subscriber of a stream gets its own copy of every chunk
+			var streams []<-chan string
+			if msg.Stream != nil && len(subscribers) > 1 {
+				streams = teeStream(msg.Stream, len(subscribers))
+			}
+			var delivering sync.WaitGroup
+			delivering.Add(len(subscribers))
+			for i, cb := range subscribers {
+				message := msg
+				if streams != nil {
+					message.Stream = streams[i]
 				}
+				go func(callback func(OutboundMessage), message OutboundMessage) {
+					defer delivering.Done()
+					defer func() {
+						if r := recover(); r != nil {
+							log.Printf("Error in outbound subscriber callback: %v", r)
+						}
+						// A subscriber that ignored the stream must not stall its producer
+						if message.Stream != nil {
+							for range message.Stream {
+							}
+						}
+					}()
+					callback(message)
+				}(cb, message)
 			}
+			go func(message OutboundMessage) {
+				delivering.Wait()
+				b.ackOutbound(message)
+				atomic.AddInt64(&b.pending, -1)
+			}(msg)
 		case <-b.stopChan:
 			return
 		}
 	}
 }
 
-// Stop stops the dispatcher loop.
+// Flush waits until every published outbound message has been handed to
+// its subscribers and their callbacks have returned. It reports false if
+// messages were still pending after timeout.
+func (b *MessageBus) Flush(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadInt64(&b.pending) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return true
+}
+
+// Stop stops the dispatcher loop. It is safe to call more than once.
 func (b *MessageBus) Stop() {
-	close(b.stopChan)
+	b.stopOnce.Do(func() { close(b.stopChan) })
 }
@@ -12,6 +12,7 @@ const (
 	MessageTypeImage MessageType = "image"
 	MessageTypeAudio MessageType = "audio"
 	MessageTypeVideo MessageType = "video"
+	MessageTypeFile  MessageType = "file" // A document, sent as an attachment
 )
 
 // InboundMessage represents a message received from a chat channel.
@@ -23,6 +24,8 @@ type InboundMessage struct {
 	Timestamp time.Time              `json:"timestamp"`
 	Media     []string               `json:"media"`
 	Metadata  map[string]interface{} `json:"metadata"`
+	// Seq identifies the message in the bus journal; 0 if not journaled.
+	Seq uint64 `json:"-"`
 }
 
 // SessionKey returns a unique key for session identification.
@@ -32,6 +35,9 @@ func (m *InboundMessage) SessionKey() string {
 
 // OutboundMessage represents a message to send to a chat channel.
 type OutboundMessage struct {
+	// ID identifies the message for EditMessage and DeleteMessage once
+	// sent; PublishOutbound assigns one when empty.
+	ID       string                 `json:"id,omitempty"`
 	Channel  string                 `json:"channel"`
 	ChatID   string                 `json:"chat_id"`
 	Type     MessageType            `json:"type"`
@@ -40,4 +46,12 @@ type OutboundMessage struct {
 	Media    string                 `json:"media"`
 	Metadata map[string]interface{} `json:"metadata"`
 	Stream   <-chan string          `json:"-"`
+	// Status, sent with a Stream, carries short notes on what the agent is
+	// doing, for channels to show until the first chunk of the stream.
+	// Notes are dropped rather than wait for a channel that ignores them.
+	Status <-chan string `json:"-"`
+	// DeliverAt, when in the future, holds the message back until then.
+	DeliverAt time.Time `json:"deliver_at"`
+	// Seq identifies the message in the bus journal; 0 if not journaled.
+	Seq uint64 `json:"-"`
 }
@@ -0,0 +1,243 @@
+package bus
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+)
+
+// journalCompactAfter is how many records are written before a journal
+// is rewritten with only its pending messages, when some stay pending. A
+// journal with nothing pending is truncated as soon as its last message is
+// acked, so handled messages do not linger on disk.
+const journalCompactAfter = 1000
+
+// journal is an append-only log of queued messages, one JSON record per
+// line, so messages not yet handled when the process stops are delivered
+// again after a restart. A message is added, started for each delivery
+// attempt and acked once handled.
+type journal struct {
+	path    string
+	mu      sync.Mutex
+	file    *os.File
+	nextSeq uint64
+	pending map[uint64]*journalEntry
+	records int // written since the file was last compacted
+}
+
+type journalRecord struct {
+	Op  string          `json:"op"` // add, start, ack
+	Seq uint64          `json:"seq"`
+	Msg json.RawMessage `json:"msg,omitempty"`
+}
+
+type journalEntry struct {
+	seq      uint64
+	attempts int
+	msg      json.RawMessage
+}
+
+// openJournal reads the journal at path and rewrites it with only the
+// messages still pending. Journals hold whole messages, so they are only
+// readable by their owner.
+func openJournal(path string) (*journal, error) {
+	j := &journal{path: path, nextSeq: 1, pending: make(map[uint64]*journalEntry)}
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var rec journalRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				continue // a torn write at the end
+			}
+			if rec.Seq >= j.nextSeq {
+				j.nextSeq = rec.Seq + 1
+			}
+			switch rec.Op {
+			case "add":
+				j.pending[rec.Seq] = &journalEntry{seq: rec.Seq, msg: rec.Msg}
+			case "start":
+				if e, ok := j.pending[rec.Seq]; ok {
+					e.attempts++
+				}
+			case "ack":
+				delete(j.pending, rec.Seq)
+			}
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := j.compactLocked(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// compactLocked rewrites the journal with the pending messages only.
+func (j *journal) compactLocked() error {
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range j.entriesLocked() {
+		writeRecord(w, journalRecord{Op: "add", Seq: e.seq, Msg: e.msg})
+		for i := 0; i < e.attempts; i++ {
+			writeRecord(w, journalRecord{Op: "start", Seq: e.seq})
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+	if err := os.Rename(tmp, j.path); err != nil {
+		return err
+	}
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0600)
+	j.records = 0
+	return err
+}
+
+func writeRecord(w interface{ Write([]byte) (int, error) }, rec journalRecord) error {
+	data, _ := json.Marshal(rec)
+	_, err := w.Write(append(data, '\n'))
+	return err
+}
+
+// appendLocked writes a record and syncs it to disk.
+func (j *journal) appendLocked(rec journalRecord) error {
+	if j.file == nil {
+		return fmt.Errorf("journal %s is closed", j.path)
+	}
+	if err := writeRecord(j.file, rec); err != nil {
+		return err
+	}
+	j.records++
+	return j.file.Sync()
+}
+
+// add journals msg and returns its sequence number.
+func (j *journal) add(msg interface{}) (uint64, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	seq := j.nextSeq
+	if err := j.appendLocked(journalRecord{Op: "add", Seq: seq, Msg: data}); err != nil {
+		return 0, err
+	}
+	j.nextSeq++
+	j.pending[seq] = &journalEntry{seq: seq, msg: data}
+	return seq, nil
+}
+
+// start records a delivery attempt.
+func (j *journal) start(seq uint64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e, ok := j.pending[seq]
+	if !ok {
+		return
+	}
+	e.attempts++
+	if err := j.appendLocked(journalRecord{Op: "start", Seq: seq}); err != nil {
+		log.Printf("Bus journal: %v", err)
+	}
+}
+
+// ack records that a message was handled.
+func (j *journal) ack(seq uint64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, ok := j.pending[seq]; !ok {
+		return
+	}
+	delete(j.pending, seq)
+	if err := j.appendLocked(journalRecord{Op: "ack", Seq: seq}); err != nil {
+		log.Printf("Bus journal: %v", err)
+	}
+	if len(j.pending) == 0 || j.records >= journalCompactAfter {
+		if err := j.compactLocked(); err != nil {
+			log.Printf("Bus journal: compaction failed: %v", err)
+		}
+	}
+}
+
+// entries returns the pending messages in the order they were added.
+func (j *journal) entries() []journalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.entriesLocked()
+}
+
+func (j *journal) entriesLocked() []journalEntry {
+	entries := make([]journalEntry, 0, len(j.pending))
+	for _, e := range j.pending {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].seq < entries[b].seq })
+	return entries
+}
+
+// DeadLetter is a message the bus gave up on, as kept in the dead-letter file.
+type DeadLetter struct {
+	Time      time.Time       `json:"time"`
+	Direction string          `json:"direction"` // inbound, outbound
+	Attempts  int             `json:"attempts,omitempty"`
+	Error     string          `json:"error"`
+	Message   json.RawMessage `json:"message"`
+}
+
+// appendDeadLetter adds a record to the dead-letter file at path.
+func appendDeadLetter(path string, dl DeadLetter) error {
+	data, _ := json.Marshal(dl)
+	if err := atrest.AppendFile(path, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	// Files written by earlier versions were readable by everyone
+	return os.Chmod(path, 0600)
+}
+
+// readDeadLetters returns the records of the dead-letter file at path.
+func readDeadLetters(path string) ([]DeadLetter, error) {
+	data, err := atrest.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var out []DeadLetter
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var dl DeadLetter
+		if json.Unmarshal(line, &dl) == nil {
+			out = append(out, dl)
+		}
+	}
+	return out, nil
+}
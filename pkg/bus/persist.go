@@ -0,0 +1,315 @@
+package bus
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+)
+
+// deadLetterFile is the file, in the persistence dir, of messages given up on.
+const deadLetterFile = "dead-letter.jsonl"
+
+// Stats describes the bus queues, to watch for backpressure.
+type Stats struct {
+	Persistent        bool   `json:"persistent"`
+	InboundQueued     int    `json:"inboundQueued"`  // waiting for the agent
+	OutboundQueued    int    `json:"outboundQueued"` // waiting for dispatch or delivery
+	InboundPublished  uint64 `json:"inboundPublished"`
+	OutboundPublished uint64 `json:"outboundPublished"`
+	InboundBlocked    uint64 `json:"inboundBlocked"`   // publishes that waited for room in the queue
+	InboundBlockedMs  int64  `json:"inboundBlockedMs"` // the total time they waited
+	Redelivered       uint64 `json:"redelivered"`      // replayed from the journal after a restart
+	DeadLettered      uint64 `json:"deadLettered"`
+}
+
+type busCounters struct {
+	inPublished  uint64
+	outPublished uint64
+	inBlocked    uint64
+	inBlockedNs  int64
+	redelivered  uint64
+	deadLettered uint64
+}
+
+// persistence is the on-disk state of a persistent bus.
+type persistence struct {
+	dir         string
+	inbound     *journal
+	outbound    *journal
+	maxAttempts int
+
+	mu      sync.Mutex
+	backlog []InboundMessage // journaled and waiting for room in the inbound queue
+	ready   chan struct{}
+}
+
+// EnablePersistence journals messages under dir, so those not handled
+// when the process stops are delivered again after a restart: at least
+// once, and possibly twice if the process stopped while handling one. A
+// message whose delivery was started maxAttempts times without finishing,
+// e.g. because it crashed the process each time, is moved to the
+// dead-letter file instead. Inbound messages then queue on disk, so
+// PublishInbound no longer blocks when the agent is busy. Call Recover
+// once the subscribers are registered.
+func (b *MessageBus) EnablePersistence(dir string, maxAttempts int) error {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	in, err := openJournal(filepath.Join(dir, "inbound.wal"))
+	if err != nil {
+		return fmt.Errorf("inbound journal: %w", err)
+	}
+	out, err := openJournal(filepath.Join(dir, "outbound.wal"))
+	if err != nil {
+		return fmt.Errorf("outbound journal: %w", err)
+	}
+	// Directories made by earlier versions were readable by everyone
+	os.Chmod(dir, 0700)
+	// The journals are rewritten too often to encrypt, but dead letters
+	// are kept until purged
+	atrest.Protect(filepath.Join(dir, deadLetterFile))
+	b.persist = &persistence{
+		dir:         dir,
+		inbound:     in,
+		outbound:    out,
+		maxAttempts: maxAttempts,
+		ready:       make(chan struct{}, 1),
+	}
+	go b.feedInbound()
+	return nil
+}
+
+// Recover replays the messages journaled but not handled before the last
+// stop, or dead-letters those that were attempted too often.
+func (b *MessageBus) Recover() {
+	p := b.persist
+	if p == nil {
+		return
+	}
+	for _, e := range p.inbound.entries() {
+		var msg InboundMessage
+		if !b.replayable(e, "inbound", &msg) {
+			p.inbound.ack(e.seq)
+			continue
+		}
+		msg.Seq = e.seq
+		p.push(msg)
+	}
+	var outbound []OutboundMessage
+	for _, e := range p.outbound.entries() {
+		var msg OutboundMessage
+		if !b.replayable(e, "outbound", &msg) {
+			p.outbound.ack(e.seq)
+			continue
+		}
+		msg.Seq = e.seq
+		outbound = append(outbound, msg)
+	}
+	if len(outbound) > 0 {
+		go func() {
+			for _, msg := range outbound {
+				atomic.AddInt64(&b.pending, 1)
+				b.outbound <- msg
+			}
+		}()
+	}
+}
+
+// replayable decodes a journaled message into msg, or dead-letters it and
+// returns false when it cannot be decoded or was attempted too often.
+func (b *MessageBus) replayable(e journalEntry, direction string, msg interface{}) bool {
+	p := b.persist
+	var reason string
+	if e.attempts >= p.maxAttempts {
+		reason = fmt.Sprintf("delivery started %d times without finishing", e.attempts)
+	} else if err := json.Unmarshal(e.msg, msg); err != nil {
+		reason = "invalid journal entry: " + err.Error()
+	}
+	if reason != "" {
+		b.deadLetter(direction, e.attempts, reason, e.msg)
+		return false
+	}
+	if in, ok := msg.(*InboundMessage); ok && redacted(*in) {
+		log.Printf("Bus: not redelivering %s message %d, its secrets were not journaled", direction, e.seq)
+		return false
+	}
+	atomic.AddUint64(&b.counters.redelivered, 1)
+	log.Printf("Bus: redelivering %s message %d (attempt %d)", direction, e.seq, e.attempts+1)
+	return true
+}
+
+func (b *MessageBus) deadLetter(direction string, attempts int, reason string, msg json.RawMessage) {
+	atomic.AddUint64(&b.counters.deadLettered, 1)
+	log.Printf("Bus: dead-lettering %s message: %s", direction, reason)
+	err := appendDeadLetter(filepath.Join(b.persist.dir, deadLetterFile), DeadLetter{
+		Time:      time.Now(),
+		Direction: direction,
+		Attempts:  attempts,
+		Error:     reason,
+		Message:   msg,
+	})
+	if err != nil {
+		log.Printf("Bus: failed to write dead letter: %v", err)
+	}
+}
+
+// ReportFailure records an outbound message a channel failed to send in
+// the dead-letter file. It does nothing unless persistence is enabled.
+func (b *MessageBus) ReportFailure(msg OutboundMessage, err error) {
+	if b.persist == nil || msg.Stream != nil {
+		return
+	}
+	data, _ := json.Marshal(msg)
+	b.deadLetter("outbound", 0, err.Error(), data)
+}
+
+// DeadLetters returns up to limit of the most recent dead letters.
+func (b *MessageBus) DeadLetters(limit int) ([]DeadLetter, error) {
+	if b.persist == nil {
+		return nil, nil
+	}
+	letters, err := readDeadLetters(filepath.Join(b.persist.dir, deadLetterFile))
+	if limit > 0 && len(letters) > limit {
+		letters = letters[len(letters)-limit:]
+	}
+	return letters, err
+}
+
+// redact returns msg as journaled: with its secrets replaced and marked
+// as redacted, if the redactor found any.
+func (b *MessageBus) redact(msg InboundMessage) InboundMessage {
+	b.subscribersMu.RLock()
+	r := b.redactor
+	b.subscribersMu.RUnlock()
+	if r == nil {
+		return msg
+	}
+	content, ok := r(msg.Content)
+	if !ok {
+		return msg
+	}
+	meta := make(map[string]interface{}, len(msg.Metadata)+1)
+	for k, v := range msg.Metadata {
+		meta[k] = v
+	}
+	meta["redacted"] = true
+	msg.Content = content
+	msg.Metadata = meta
+	return msg
+}
+
+func redacted(msg InboundMessage) bool {
+	r, _ := msg.Metadata["redacted"].(bool)
+	return r
+}
+
+// AckInbound marks an inbound message as handled, so it is not delivered
+// again after a restart, and tells the OnHandled functions.
+func (b *MessageBus) AckInbound(msg InboundMessage) {
+	if b.persist != nil && msg.Seq != 0 {
+		b.persist.inbound.ack(msg.Seq)
+	}
+	b.subscribersMu.RLock()
+	hooks := b.handledHooks
+	b.subscribersMu.RUnlock()
+	for _, fn := range hooks {
+		fn(msg)
+	}
+}
+
+func (b *MessageBus) ackOutbound(msg OutboundMessage) {
+	if b.persist != nil && msg.Seq != 0 {
+		b.persist.outbound.ack(msg.Seq)
+	}
+}
+
+func (b *MessageBus) startOutbound(msg OutboundMessage) {
+	if b.persist != nil && msg.Seq != 0 {
+		b.persist.outbound.start(msg.Seq)
+	}
+}
+
+// push adds a journaled message to the backlog fed to the inbound queue.
+func (p *persistence) push(msg InboundMessage) {
+	p.mu.Lock()
+	p.backlog = append(p.backlog, msg)
+	p.mu.Unlock()
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+}
+
+// feedInbound moves the backlog into the inbound queue in order.
+func (b *MessageBus) feedInbound() {
+	p := b.persist
+	for {
+		p.mu.Lock()
+		if len(p.backlog) == 0 {
+			p.mu.Unlock()
+			select {
+			case <-p.ready:
+				continue
+			case <-b.stopChan:
+				return
+			}
+		}
+		msg := p.backlog[0]
+		p.backlog = p.backlog[1:]
+		p.mu.Unlock()
+
+		p.inbound.start(msg.Seq)
+		if !b.sendInbound(msg) {
+			return
+		}
+	}
+}
+
+// sendInbound puts msg on the inbound queue, waiting for room when it is
+// full. It returns false if the bus stopped first.
+func (b *MessageBus) sendInbound(msg InboundMessage) bool {
+	select {
+	case b.inbound <- msg:
+		return true
+	default:
+	}
+	start := time.Now()
+	defer func() {
+		atomic.AddUint64(&b.counters.inBlocked, 1)
+		atomic.AddInt64(&b.counters.inBlockedNs, int64(time.Since(start)))
+	}()
+	select {
+	case b.inbound <- msg:
+		return true
+	case <-b.stopChan:
+		return false
+	}
+}
+
+// Stats returns the current queue sizes and counters.
+func (b *MessageBus) Stats() Stats {
+	s := Stats{
+		Persistent:        b.persist != nil,
+		InboundQueued:     len(b.inbound),
+		OutboundQueued:    int(atomic.LoadInt64(&b.pending)),
+		InboundPublished:  atomic.LoadUint64(&b.counters.inPublished),
+		OutboundPublished: atomic.LoadUint64(&b.counters.outPublished),
+		InboundBlocked:    atomic.LoadUint64(&b.counters.inBlocked),
+		InboundBlockedMs:  atomic.LoadInt64(&b.counters.inBlockedNs) / int64(time.Millisecond),
+		Redelivered:       atomic.LoadUint64(&b.counters.redelivered),
+		DeadLettered:      atomic.LoadUint64(&b.counters.deadLettered),
+	}
+	if p := b.persist; p != nil {
+		p.mu.Lock()
+		s.InboundQueued += len(p.backlog)
+		p.mu.Unlock()
+	}
+	return s
+}
@@ -0,0 +1,199 @@
+package bus
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// maxSentMessages is how many sent messages are remembered for editing
+// and deleting; older ones are forgotten first.
+const maxSentMessages = 1000
+
+var (
+	// ErrUnknownMessage is returned for a message ID that was never sent,
+	// or was sent too long ago to be remembered.
+	ErrUnknownMessage = errors.New("unknown message ID")
+	// ErrNotSupported is returned when a channel cannot edit or delete
+	// the messages it sent.
+	ErrNotSupported = errors.New("not supported by the channel")
+)
+
+// MessageEditor is implemented by channels that can change their messages
+// after sending them. platformID is the ID the chat platform gave the
+// message, as passed to RecordSent.
+type MessageEditor interface {
+	EditMessage(chatID, platformID, content string) error
+	DeleteMessage(chatID, platformID string) error
+}
+
+// SentMessage is an outbound message as delivered: a long reply may have
+// been split into several platform messages.
+type SentMessage struct {
+	Channel     string   `json:"channel"`
+	ChatID      string   `json:"chat_id"`
+	PlatformIDs []string `json:"platform_ids"`
+}
+
+// sentLog maps outbound message IDs to the platform messages they became.
+type sentLog struct {
+	mu       sync.Mutex
+	messages map[string]*SentMessage
+	order    []string // IDs, oldest first
+	editors  map[string]MessageEditor
+}
+
+// NewMessageID returns a new outbound message ID. Publishers that want to
+// edit or delete a message later set its ID themselves, or keep the one
+// PublishOutbound returns.
+func NewMessageID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SetEditor registers the editor of a channel's sent messages.
+func (b *MessageBus) SetEditor(channel string, editor MessageEditor) {
+	b.sent.mu.Lock()
+	defer b.sent.mu.Unlock()
+	if b.sent.editors == nil {
+		b.sent.editors = make(map[string]MessageEditor)
+	}
+	b.sent.editors[channel] = editor
+}
+
+// RecordSent is called by a channel for each platform message msg was
+// delivered as, in order.
+func (b *MessageBus) RecordSent(msg OutboundMessage, platformID string) {
+	if msg.ID == "" || platformID == "" {
+		return
+	}
+	s := &b.sent
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.messages == nil {
+		s.messages = make(map[string]*SentMessage)
+	}
+	if m, ok := s.messages[msg.ID]; ok {
+		m.PlatformIDs = append(m.PlatformIDs, platformID)
+		return
+	}
+	s.messages[msg.ID] = &SentMessage{Channel: msg.Channel, ChatID: msg.ChatID, PlatformIDs: []string{platformID}}
+	s.order = append(s.order, msg.ID)
+	if len(s.order) > maxSentMessages {
+		delete(s.messages, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// Sent returns where the message with the given ID was delivered.
+func (b *MessageBus) Sent(id string) (SentMessage, bool) {
+	b.sent.mu.Lock()
+	defer b.sent.mu.Unlock()
+	m, ok := b.sent.messages[id]
+	if !ok {
+		return SentMessage{}, false
+	}
+	sent := *m
+	sent.PlatformIDs = append([]string(nil), m.PlatformIDs...)
+	return sent, true
+}
+
+// SentAs returns the sent message a platform message of the channel is
+// part of, so that reactions to it can be traced back to its chat.
+func (b *MessageBus) SentAs(channel, platformID string) (SentMessage, bool) {
+	b.sent.mu.Lock()
+	defer b.sent.mu.Unlock()
+	for i := len(b.sent.order) - 1; i >= 0; i-- {
+		m := b.sent.messages[b.sent.order[i]]
+		if m.Channel != channel {
+			continue
+		}
+		for _, id := range m.PlatformIDs {
+			if id == platformID {
+				sent := *m
+				sent.PlatformIDs = append([]string(nil), m.PlatformIDs...)
+				return sent, true
+			}
+		}
+	}
+	return SentMessage{}, false
+}
+
+// editorFor returns a sent message and the editor of its channel.
+func (b *MessageBus) editorFor(id string) (SentMessage, MessageEditor, error) {
+	sent, ok := b.Sent(id)
+	if !ok {
+		return SentMessage{}, nil, ErrUnknownMessage
+	}
+	b.sent.mu.Lock()
+	editor := b.sent.editors[sent.Channel]
+	b.sent.mu.Unlock()
+	if editor == nil {
+		return SentMessage{}, nil, fmt.Errorf("%s: %w", sent.Channel, ErrNotSupported)
+	}
+	return sent, editor, nil
+}
+
+// EditMessage replaces the content of a sent message. A message that was
+// split when sent gets the new content in its first part and the other
+// parts are deleted.
+func (b *MessageBus) EditMessage(id, content string) error {
+	sent, editor, err := b.editorFor(id)
+	if err != nil {
+		return err
+	}
+	if err := editor.EditMessage(sent.ChatID, sent.PlatformIDs[0], content); err != nil {
+		return err
+	}
+	return b.deleteParts(id, sent, editor, sent.PlatformIDs[1:])
+}
+
+// DeleteMessage deletes a sent message, all of its parts.
+func (b *MessageBus) DeleteMessage(id string) error {
+	sent, editor, err := b.editorFor(id)
+	if err != nil {
+		return err
+	}
+	return b.deleteParts(id, sent, editor, sent.PlatformIDs)
+}
+
+// deleteParts deletes some platform messages of a sent message and
+// forgets them, forgetting the message too when none are left.
+func (b *MessageBus) deleteParts(id string, sent SentMessage, editor MessageEditor, parts []string) error {
+	deleted := make(map[string]bool, len(parts))
+	var err error
+	for _, platformID := range parts {
+		if err = editor.DeleteMessage(sent.ChatID, platformID); err != nil {
+			break
+		}
+		deleted[platformID] = true
+	}
+
+	s := &b.sent
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.messages[id]
+	if !ok {
+		return err
+	}
+	kept := m.PlatformIDs[:0]
+	for _, platformID := range m.PlatformIDs {
+		if !deleted[platformID] {
+			kept = append(kept, platformID)
+		}
+	}
+	m.PlatformIDs = kept
+	if len(kept) == 0 {
+		delete(s.messages, id)
+		for i, v := range s.order {
+			if v == id {
+				s.order = append(s.order[:i], s.order[i+1:]...)
+				break
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package bus
+
+// teeStream copies every chunk of src to n streams. Each copy is buffered
+// without bound, so a slow subscriber does not hold back the others or the
+// producer; a copy is closed once src is closed and its chunks are read.
+func teeStream(src <-chan string, n int) []<-chan string {
+	ins := make([]chan string, n)
+	outs := make([]<-chan string, n)
+	for i := range ins {
+		ins[i] = make(chan string)
+		out := make(chan string)
+		outs[i] = out
+		go relayStream(ins[i], out)
+	}
+	go func() {
+		for chunk := range src {
+			for _, in := range ins {
+				in <- chunk
+			}
+		}
+		for _, in := range ins {
+			close(in)
+		}
+	}()
+	return outs
+}
+
+// relayStream passes chunks from in to out in order, queueing those out
+// is not ready for, and closes out after the last one.
+func relayStream(in <-chan string, out chan<- string) {
+	defer close(out)
+	var queue []string
+	for in != nil || len(queue) > 0 {
+		var send chan<- string
+		var next string
+		if len(queue) > 0 {
+			send, next = out, queue[0]
+		}
+		select {
+		case chunk, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			queue = append(queue, chunk)
+		case send <- next:
+			queue = queue[1:]
+		}
+	}
+}
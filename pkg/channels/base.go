@@ -16,9 +16,10 @@ type Channel interface {
 
 // BaseChannel provides common functionality for channels.
 type BaseChannel struct {
-	Config   interface{}
-	Bus      *bus.MessageBus
+	Config    interface{}
+	Bus       *bus.MessageBus
 	AllowFrom []string
+	Monitor   *Monitor
 }
 
 // IsAllowed checks if a sender is allowed to use this bot.
@@ -66,5 +67,6 @@ func (c *BaseChannel) HandleMessage(
 		Metadata: metadata,
 	}
 
+	c.Monitor.RecordInbound(channelName)
 	c.Bus.PublishInbound(msg)
 }
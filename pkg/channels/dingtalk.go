@@ -9,8 +9,10 @@ import (
 	"log"
 	"mime/multipart"
 	"net/http"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/HKUDS/nanobot-go/pkg/bus"
@@ -31,25 +33,34 @@ import (
 
 type DingTalkChannel struct {
 	BaseChannel
-	Config       *config.DingTalkConfig
+	Config    *config.DingTalkConfig
+	Workspace string
+	// Transcriber, if set, turns voice messages DingTalk did not recognize
+	// into text.
+	Transcriber  *Transcriber
 	streamClient *client.StreamClient
 	robotClient  *dingtalkrobot.Client
 	imClient     *dingtalkim.Client
 	oauthClient  *dingtalkoauth2.Client
 
+	// noStandardCard is set once the built-in card could not be sent, so
+	// later replies go straight to text.
+	noStandardCard atomic.Bool
+
 	tokenMu       sync.RWMutex
 	accessToken   string
 	tokenExpireAt time.Time
 }
 
-func NewDingTalkChannel(cfg *config.DingTalkConfig, messageBus *bus.MessageBus) *DingTalkChannel {
+func NewDingTalkChannel(cfg *config.DingTalkConfig, messageBus *bus.MessageBus, workspace string) *DingTalkChannel {
 	return &DingTalkChannel{
 		BaseChannel: BaseChannel{
 			Config:    cfg,
 			Bus:       messageBus,
 			AllowFrom: cfg.AllowFrom,
 		},
-		Config: cfg,
+		Config:    cfg,
+		Workspace: workspace,
 	}
 }
 
@@ -97,6 +108,7 @@ func (c *DingTalkChannel) Start() error {
 		defer func() {
 			if r := recover(); r != nil {
 				log.Printf("[DingTalk] Panic recovered in stream client goroutine: %v", r)
+				c.Monitor.Disconnected(c.Name(), fmt.Errorf("panic: %v", r))
 			}
 		}()
 
@@ -104,6 +116,7 @@ func (c *DingTalkChannel) Start() error {
 		// Start is blocking, so run in goroutine
 		if err := c.streamClient.Start(context.Background()); err != nil {
 			log.Printf("DingTalk Stream Client error: %v", err)
+			c.Monitor.Disconnected(c.Name(), err)
 		}
 	}()
 
@@ -162,12 +175,6 @@ func (c *DingTalkChannel) onChatReceive(ctx context.Context, data *chatbot.BotCa
 		}
 	}()
 
-	content := strings.TrimSpace(data.Text.Content)
-	if content == "" {
-		log.Printf("[DingTalk] Empty content received")
-		return nil, nil
-	}
-
 	senderStaffId := data.SenderStaffId
 	if senderStaffId == "" {
 		senderStaffId = data.SenderId
@@ -183,6 +190,12 @@ func (c *DingTalkChannel) onChatReceive(ctx context.Context, data *chatbot.BotCa
 		return nil, nil
 	}
 
+	content, media := c.parseMessage(ctx, data)
+	if content == "" && len(media) == 0 {
+		log.Printf("[DingTalk] Empty content received")
+		return nil, nil
+	}
+
 	// Determine ChatID based on conversation type
 	// conversationType: "1" for single chat, "2" for group chat
 	conversationType := data.ConversationType
@@ -195,13 +208,16 @@ func (c *DingTalkChannel) onChatReceive(ctx context.Context, data *chatbot.BotCa
 
 	log.Printf("[DingTalk] Processing message from %s (Type=%s, ConvID=%s) -> ChatID: %s", senderStaffId, conversationType, conversationId, targetId)
 
+	c.Monitor.RecordInbound(c.Name())
 	c.Bus.PublishInbound(bus.InboundMessage{
 		Channel:  c.Name(),
 		SenderID: senderStaffId,
 		ChatID:   targetId,
 		Content:  content,
+		Media:    media,
 		Metadata: map[string]interface{}{
 			"sender_name": data.SenderNick,
+			"group":       conversationType == "2",
 		},
 	})
 
@@ -222,8 +238,8 @@ func (c *DingTalkChannel) Send(msg bus.OutboundMessage) error {
 	if msg.Stream != nil {
 		// 1. 如果是文本消息，我们需要流内容作为最终的 Content
 		if msg.Type == bus.MessageTypeText || msg.Type == "" {
-			// 如果配置了 TemplateID，且是文本，尝试使用卡片流式发送
-			if c.Config.TemplateID != "" {
+			// 文本流式回复使用卡片发送：配置了 TemplateID 时用该模板，否则用内置的 StandardCard
+			if c.Config.TemplateID != "" || !c.noStandardCard.Load() {
 				return c.sendStream(msg, token)
 			}
 
@@ -269,7 +285,7 @@ func (c *DingTalkChannel) Send(msg bus.OutboundMessage) error {
 			"photoURL": mediaId,
 			"picURL":   mediaId,
 		}
-		return c.sendMedia(token, msg.ChatID, "sampleImageMsg", param)
+		return c.sendMedia(token, msg, "sampleImageMsg", param)
 
 	case bus.MessageTypeAudio:
 		if msg.Media == "" {
@@ -287,7 +303,7 @@ func (c *DingTalkChannel) Send(msg bus.OutboundMessage) error {
 		}
 
 		param := map[string]string{"mediaId": mediaId, "duration": "10"}
-		return c.sendMedia(token, msg.ChatID, "sampleAudio", param)
+		return c.sendMedia(token, msg, "sampleAudio", param)
 
 	case bus.MessageTypeVideo:
 		if msg.Media == "" {
@@ -316,7 +332,36 @@ func (c *DingTalkChannel) Send(msg bus.OutboundMessage) error {
 			"duration":     "10",
 			"videoType":    "mp4",
 		}
-		return c.sendMedia(token, msg.ChatID, "sampleVideo", param)
+		return c.sendMedia(token, msg, "sampleVideo", param)
+
+	case bus.MessageTypeFile:
+		if msg.Media == "" {
+			return fmt.Errorf("media is empty")
+		}
+		reader, filename, err := utils.GetMediaReader(msg.Media)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		mediaId, err := c.uploadMedia(token, "file", filename, reader)
+		if err != nil {
+			return err
+		}
+
+		param := map[string]string{
+			"mediaId":  mediaId,
+			"fileName": filename,
+			"fileType": strings.TrimPrefix(filepath.Ext(filename), "."),
+		}
+		if err := c.sendMedia(token, msg, "sampleFile", param); err != nil {
+			return err
+		}
+		// 文件消息没有说明文字，单独发送文本
+		if msg.Content != "" {
+			return c.Send(bus.OutboundMessage{ID: msg.ID, Channel: msg.Channel, ChatID: msg.ChatID, Content: msg.Content})
+		}
+		return nil
 
 	default:
 		if msg.Content == "" {
@@ -351,9 +396,13 @@ func (c *DingTalkChannel) sendStream(msg bus.OutboundMessage, token string) erro
 	// 1. 创建卡片（初始状态）
 	// 使用 "..." 或其他 Loading 字符占位
 	currentContent := "Thinking..."
-	log.Printf("[DingTalk] Creating interactive card (TemplateID=%s, OutTrackID=%s)...", c.Config.TemplateID, outTrackId)
+	log.Printf("[DingTalk] Creating interactive card (TemplateID=%s, OutTrackID=%s)...", c.cardTemplateID(), outTrackId)
 	if err := c.createInteractiveCard(token, outTrackId, msg.ChatID, isGroup, currentContent); err != nil {
 		log.Printf("[DingTalk] Failed to create interactive card: %v. Fallback to text.", err)
+		if c.Config.TemplateID == "" {
+			log.Printf("[DingTalk] Streamed replies are sent as text from now on. Add the qyapi_chat_manage permission or set templateId to stream them in cards.")
+			c.noStandardCard.Store(true)
+		}
 
 		// 如果创建卡片失败，降级为普通文本发送
 		var builder strings.Builder
@@ -367,13 +416,16 @@ func (c *DingTalkChannel) sendStream(msg bus.OutboundMessage, token string) erro
 		return c.sendOTO(token, msg)
 	}
 
+	c.Bus.RecordSent(msg, dingTalkCardPrefix+outTrackId)
+
 	// 2. 开启流式更新循环
 	// 钉钉接口有频率限制，建议控制在 200ms 以上
 	ticker := time.NewTicker(200 * time.Millisecond)
 	defer ticker.Stop()
 
 	var contentBuilder strings.Builder
-	var hasPending bool
+	var hasPending, statusShown bool
+	status := msg.Status
 
 	log.Printf("[DingTalk] Stream loop started. Waiting for chunks...")
 
@@ -389,12 +441,30 @@ func (c *DingTalkChannel) sendStream(msg bus.OutboundMessage, token string) erro
 					} else {
 						log.Printf("[DingTalk] Final card update success")
 					}
+				} else if statusShown {
+					// 不要让卡片停留在最后一条状态上
+					if err := c.updateInteractiveCard(token, outTrackId, "No content generated."); err != nil {
+						log.Printf("[DingTalk] Final card update failed: %v", err)
+					}
 				}
 				return nil
 			}
 			contentBuilder.WriteString(chunk)
 			hasPending = true
 
+		case note, ok := <-status:
+			if !ok {
+				status = nil
+				continue
+			}
+			// 回复开始之前，卡片显示 Agent 正在做什么
+			if contentBuilder.Len() == 0 {
+				if err := c.updateInteractiveCard(token, outTrackId, note); err != nil {
+					log.Printf("[DingTalk] Status update failed: %v", err)
+				}
+				statusShown = true
+			}
+
 		case <-ticker.C:
 			if hasPending {
 				log.Printf("[DingTalk] Ticker update. Len=%d", contentBuilder.Len())
@@ -407,27 +477,110 @@ func (c *DingTalkChannel) sendStream(msg bus.OutboundMessage, token string) erro
 	}
 }
 
+// dingTalkCardPrefix marks the IDs of sent interactive cards, which are
+// their out track IDs; other sent messages are known by process query key.
+const dingTalkCardPrefix = "card:"
+
+// EditMessage updates a reply sent as an interactive card. Robot text
+// messages cannot be edited, only recalled.
+func (c *DingTalkChannel) EditMessage(chatID, messageID, content string) error {
+	if !strings.HasPrefix(messageID, dingTalkCardPrefix) {
+		return fmt.Errorf("dingtalk text messages cannot be edited: %w", bus.ErrNotSupported)
+	}
+	token, err := c.getAccessToken()
+	if err != nil {
+		return fmt.Errorf("failed to get access token: %v", err)
+	}
+	return c.updateInteractiveCard(token, strings.TrimPrefix(messageID, dingTalkCardPrefix), content)
+}
+
+// DeleteMessage recalls a message the robot sent.
+func (c *DingTalkChannel) DeleteMessage(chatID, messageID string) error {
+	if strings.HasPrefix(messageID, dingTalkCardPrefix) {
+		return fmt.Errorf("dingtalk interactive cards cannot be recalled: %w", bus.ErrNotSupported)
+	}
+	token, err := c.getAccessToken()
+	if err != nil {
+		return fmt.Errorf("failed to get access token: %v", err)
+	}
+	if strings.HasPrefix(chatID, "cid") {
+		headers := &dingtalkrobot.OrgGroupRecallHeaders{
+			XAcsDingtalkAccessToken: tea.String(token),
+		}
+		req := &dingtalkrobot.OrgGroupRecallRequest{
+			RobotCode:          tea.String(c.Config.RobotCode),
+			OpenConversationId: tea.String(chatID),
+			ProcessQueryKeys:   []*string{tea.String(messageID)},
+		}
+		_, err = c.robotClient.OrgGroupRecallWithOptions(req, headers, &util.RuntimeOptions{})
+		return err
+	}
+	headers := &dingtalkrobot.BatchRecallOTOHeaders{
+		XAcsDingtalkAccessToken: tea.String(token),
+	}
+	req := &dingtalkrobot.BatchRecallOTORequest{
+		RobotCode:        tea.String(c.Config.RobotCode),
+		ProcessQueryKeys: []*string{tea.String(messageID)},
+	}
+	_, err = c.robotClient.BatchRecallOTOWithOptions(req, headers, &util.RuntimeOptions{})
+	return err
+}
+
+// dingTalkStandardCard is DingTalk's built-in interactive card template,
+// used to stream replies when no templateId is configured. Its whole
+// layout is passed as JSON in the sys_full_json_obj parameter.
+const dingTalkStandardCard = "StandardCard"
+
+// cardTemplateID returns the template the reply cards are created with.
+func (c *DingTalkChannel) cardTemplateID() string {
+	if c.Config.TemplateID != "" {
+		return c.Config.TemplateID
+	}
+	return dingTalkStandardCard
+}
+
+// standardCardParams returns the card data of a StandardCard showing
+// content as Markdown.
+func standardCardParams(content string) map[string]*string {
+	card := map[string]interface{}{
+		"config": map[string]interface{}{
+			"autoLayout":    true,
+			"enableForward": true,
+		},
+		"contents": []map[string]interface{}{
+			{"type": "markdown", "id": "content", "text": content},
+		},
+	}
+	data, _ := json.Marshal(card)
+	return map[string]*string{"sys_full_json_obj": tea.String(string(data))}
+}
+
 // createInteractiveCard 创建互动卡片实例
 func (c *DingTalkChannel) createInteractiveCard(token, outTrackId, targetId string, isGroup bool, content string) error {
 	headers := &dingtalkim.SendInteractiveCardHeaders{
 		XAcsDingtalkAccessToken: tea.String(token),
 	}
 
+	params := map[string]*string{
+		"content":         tea.String(content),
+		"text":            tea.String(content),
+		"markdown":        tea.String(content),
+		"body":            tea.String(content),
+		"message":         tea.String(content),
+		"description":     tea.String(content),
+		"title":           tea.String(content),
+		"header":          tea.String(content),
+		"markdownContent": tea.String(content),
+	}
+	if c.Config.TemplateID == "" {
+		params = standardCardParams(content)
+	}
+
 	req := &dingtalkim.SendInteractiveCardRequest{
 		OutTrackId:     tea.String(outTrackId),
-		CardTemplateId: tea.String(c.Config.TemplateID),
+		CardTemplateId: tea.String(c.cardTemplateID()),
 		CardData: &dingtalkim.SendInteractiveCardRequestCardData{
-			CardParamMap: map[string]*string{
-				"content":         tea.String(content),
-				"text":            tea.String(content),
-				"markdown":        tea.String(content),
-				"body":            tea.String(content),
-				"message":         tea.String(content),
-				"description":     tea.String(content),
-				"title":           tea.String(content),
-				"header":          tea.String(content),
-				"markdownContent": tea.String(content),
-			},
+			CardParamMap: params,
 		},
 		RobotCode: tea.String(c.Config.RobotCode),
 	}
@@ -450,13 +603,18 @@ func (c *DingTalkChannel) updateInteractiveCard(token, outTrackId, content strin
 		XAcsDingtalkAccessToken: tea.String(token),
 	}
 
+	params := map[string]*string{
+		"content":     tea.String(content),
+		"lastMessage": tea.String(content),
+	}
+	if c.Config.TemplateID == "" {
+		params = standardCardParams(content)
+	}
+
 	req := &dingtalkim.UpdateInteractiveCardRequest{
 		OutTrackId: tea.String(outTrackId),
 		CardData: &dingtalkim.UpdateInteractiveCardRequestCardData{
-			CardParamMap: map[string]*string{
-				"content":     tea.String(content),
-				"lastMessage": tea.String(content),
-			},
+			CardParamMap: params,
 		},
 		CardOptions: &dingtalkim.UpdateInteractiveCardRequestCardOptions{
 			UpdateCardDataByKey: tea.Bool(false),
@@ -472,18 +630,23 @@ func (c *DingTalkChannel) sendOTO(token string, msg bus.OutboundMessage) error {
 		XAcsDingtalkAccessToken: tea.String(token),
 	}
 
-	param := dingTalkSampleTextParam{Content: msg.Content}
-	msgParamBytes, _ := json.Marshal(param)
+	for _, m := range dingTalkTextMessages(msg.Content) {
+		req := &dingtalkrobot.BatchSendOTORequest{
+			RobotCode: tea.String(c.Config.RobotCode),
+			UserIds:   []*string{tea.String(msg.ChatID)},
+			MsgKey:    tea.String(m.Key),
+			MsgParam:  tea.String(m.Param),
+		}
 
-	req := &dingtalkrobot.BatchSendOTORequest{
-		RobotCode: tea.String(c.Config.RobotCode),
-		UserIds:   []*string{tea.String(msg.ChatID)},
-		MsgKey:    tea.String("sampleText"),
-		MsgParam:  tea.String(string(msgParamBytes)),
+		resp, err := c.robotClient.BatchSendOTOWithOptions(req, headers, &util.RuntimeOptions{})
+		if err != nil {
+			return err
+		}
+		if resp.Body != nil {
+			c.Bus.RecordSent(msg, tea.StringValue(resp.Body.ProcessQueryKey))
+		}
 	}
-
-	_, err := c.robotClient.BatchSendOTOWithOptions(req, headers, &util.RuntimeOptions{})
-	return err
+	return nil
 }
 
 func (c *DingTalkChannel) sendGroup(token string, msg bus.OutboundMessage) error {
@@ -491,18 +654,23 @@ func (c *DingTalkChannel) sendGroup(token string, msg bus.OutboundMessage) error
 		XAcsDingtalkAccessToken: tea.String(token),
 	}
 
-	param := dingTalkSampleTextParam{Content: msg.Content}
-	msgParamBytes, _ := json.Marshal(param)
+	for _, m := range dingTalkTextMessages(msg.Content) {
+		req := &dingtalkrobot.OrgGroupSendRequest{
+			RobotCode:          tea.String(c.Config.RobotCode),
+			OpenConversationId: tea.String(msg.ChatID),
+			MsgKey:             tea.String(m.Key),
+			MsgParam:           tea.String(m.Param),
+		}
 
-	req := &dingtalkrobot.OrgGroupSendRequest{
-		RobotCode:          tea.String(c.Config.RobotCode),
-		OpenConversationId: tea.String(msg.ChatID),
-		MsgKey:             tea.String("sampleText"),
-		MsgParam:           tea.String(string(msgParamBytes)),
+		resp, err := c.robotClient.OrgGroupSendWithOptions(req, headers, &util.RuntimeOptions{})
+		if err != nil {
+			return err
+		}
+		if resp.Body != nil {
+			c.Bus.RecordSent(msg, tea.StringValue(resp.Body.ProcessQueryKey))
+		}
 	}
-
-	_, err := c.robotClient.OrgGroupSendWithOptions(req, headers, &util.RuntimeOptions{})
-	return err
+	return nil
 }
 
 func (c *DingTalkChannel) uploadMedia(token, mediaType, filename string, reader io.Reader) (string, error) {
@@ -564,10 +732,11 @@ func (c *DingTalkChannel) getCoverMediaId(token string) (string, error) {
 	return c.uploadMedia(token, "image", "cover.png", r)
 }
 
-func (c *DingTalkChannel) sendMedia(token, chatID, msgKey string, param interface{}) error {
+func (c *DingTalkChannel) sendMedia(token string, msg bus.OutboundMessage, msgKey string, param interface{}) error {
 	paramBytes, _ := json.Marshal(param)
 	msgParam := string(paramBytes)
 
+	chatID := msg.ChatID
 	if strings.HasPrefix(chatID, "cid") {
 		headers := &dingtalkrobot.OrgGroupSendHeaders{
 			XAcsDingtalkAccessToken: tea.String(token),
@@ -578,7 +747,10 @@ func (c *DingTalkChannel) sendMedia(token, chatID, msgKey string, param interfac
 			MsgKey:             tea.String(msgKey),
 			MsgParam:           tea.String(msgParam),
 		}
-		_, err := c.robotClient.OrgGroupSendWithOptions(req, headers, &util.RuntimeOptions{})
+		resp, err := c.robotClient.OrgGroupSendWithOptions(req, headers, &util.RuntimeOptions{})
+		if err == nil && resp.Body != nil {
+			c.Bus.RecordSent(msg, tea.StringValue(resp.Body.ProcessQueryKey))
+		}
 		return err
 	}
 
@@ -591,6 +763,9 @@ func (c *DingTalkChannel) sendMedia(token, chatID, msgKey string, param interfac
 		MsgKey:    tea.String(msgKey),
 		MsgParam:  tea.String(msgParam),
 	}
-	_, err := c.robotClient.BatchSendOTOWithOptions(req, headers, &util.RuntimeOptions{})
+	resp, err := c.robotClient.BatchSendOTOWithOptions(req, headers, &util.RuntimeOptions{})
+	if err == nil && resp.Body != nil {
+		c.Bus.RecordSent(msg, tea.StringValue(resp.Body.ProcessQueryKey))
+	}
 	return err
 }
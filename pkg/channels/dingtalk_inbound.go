@@ -0,0 +1,199 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/utils"
+
+	dingtalkrobot "github.com/alibabacloud-go/dingtalk/robot_1_0"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/open-dingtalk/dingtalk-stream-sdk-go/chatbot"
+)
+
+// dingTalkMaxDownload bounds the size of a file downloaded from a message.
+const dingTalkMaxDownload = 50 * 1024 * 1024
+
+// dingTalkContent holds the fields of the content of the message types the
+// bot reads.
+type dingTalkContent struct {
+	DownloadCode        string `json:"downloadCode"`
+	PictureDownloadCode string `json:"pictureDownloadCode"`
+	FileName            string `json:"fileName"`
+	// Audio
+	Recognition string `json:"recognition"`
+	// Rich text
+	RichText []dingTalkRichTextElement `json:"richText"`
+}
+
+// dingTalkRichTextElement is a piece of a rich text message: text, or a
+// picture when it has a download code.
+type dingTalkRichTextElement struct {
+	Text         string `json:"text"`
+	DownloadCode string `json:"downloadCode"`
+}
+
+// parseMessage returns the text of a received message for the agent, and
+// the pictures, files and voice messages it carries, downloaded into the
+// workspace. Voice messages use DingTalk's own recognition, or the
+// Transcriber when DingTalk sent none.
+func (c *DingTalkChannel) parseMessage(ctx context.Context, data *chatbot.BotCallbackDataModel) (string, []string) {
+	if data.Msgtype == "" || data.Msgtype == "text" {
+		return strings.TrimSpace(data.Text.Content), nil
+	}
+
+	var content dingTalkContent
+	raw, err := json.Marshal(data.Content)
+	if err == nil {
+		err = json.Unmarshal(raw, &content)
+	}
+	if err != nil {
+		log.Printf("[DingTalk] Failed to parse %s message %s: %v", data.Msgtype, data.MsgId, err)
+		return "", nil
+	}
+
+	var media []string
+	var notes []string
+	// Message IDs are base64 and may contain slashes
+	prefix := strings.ReplaceAll(data.MsgId, "/", "_")
+	download := func(code, name, label string) {
+		path, err := c.downloadFile(code, fmt.Sprintf("%s_%d%s", prefix, len(media), name))
+		if err != nil {
+			log.Printf("[DingTalk] Failed to download %s of message %s: %v", label, data.MsgId, err)
+			notes = append(notes, fmt.Sprintf("[%s received (download failed)]", label))
+			return
+		}
+		media = append(media, path)
+	}
+
+	switch data.Msgtype {
+	case "picture":
+		code := content.DownloadCode
+		if code == "" {
+			code = content.PictureDownloadCode
+		}
+		download(code, "", "Image")
+		notes = append([]string{"[Image received]"}, notes...)
+
+	case "richText":
+		var text strings.Builder
+		for _, el := range content.RichText {
+			if el.Text != "" {
+				text.WriteString(el.Text)
+				continue
+			}
+			if el.DownloadCode != "" {
+				download(el.DownloadCode, "", "Image")
+			}
+		}
+		return strings.TrimSpace(strings.Join(append([]string{text.String()}, notes...), "\n")), media
+
+	case "file":
+		download(content.DownloadCode, "_"+filepath.Base(content.FileName), "File")
+		notes = append([]string{"[File received: " + content.FileName + "]"}, notes...)
+
+	case "video":
+		download(content.DownloadCode, "", "Video")
+		notes = append([]string{"[Video received]"}, notes...)
+
+	case "audio":
+		if text := strings.TrimSpace(content.Recognition); text != "" {
+			return "[Voice message, transcribed] " + text, nil
+		}
+		download(content.DownloadCode, "", "Voice message")
+		if len(media) == 0 {
+			return strings.Join(notes, "\n"), nil
+		}
+		if c.Transcriber == nil {
+			return "[Voice message received]", media
+		}
+		text, err := c.Transcriber.Transcribe(ctx, media[0])
+		if err != nil {
+			log.Printf("[DingTalk] Failed to transcribe voice message %s: %v", data.MsgId, err)
+			return "[Voice message received (transcription failed)]", media
+		}
+		return "[Voice message, transcribed] " + text, media
+
+	default:
+		log.Printf("[DingTalk] Unsupported message type: %s", data.Msgtype)
+		return "", nil
+	}
+	return strings.Join(notes, "\n"), media
+}
+
+// downloadFile saves the file behind a message's download code under
+// workspace/uploads/dingtalk and returns its path.
+func (c *DingTalkChannel) downloadFile(downloadCode, name string) (string, error) {
+	if downloadCode == "" {
+		return "", fmt.Errorf("no download code")
+	}
+	token, err := c.getAccessToken()
+	if err != nil {
+		return "", err
+	}
+	headers := &dingtalkrobot.RobotMessageFileDownloadHeaders{
+		XAcsDingtalkAccessToken: tea.String(token),
+	}
+	req := &dingtalkrobot.RobotMessageFileDownloadRequest{
+		DownloadCode: tea.String(downloadCode),
+		RobotCode:    tea.String(c.Config.RobotCode),
+	}
+	resp, err := c.robotClient.RobotMessageFileDownloadWithOptions(req, headers, &util.RuntimeOptions{})
+	if err != nil {
+		return "", err
+	}
+	if resp.Body == nil || tea.StringValue(resp.Body.DownloadUrl) == "" {
+		return "", fmt.Errorf("no download URL returned")
+	}
+
+	dir := filepath.Join(c.Workspace, "uploads", "dingtalk")
+	path, err := utils.DownloadMedia(tea.StringValue(resp.Body.DownloadUrl), dir, name, dingTalkMaxDownload)
+	if err != nil {
+		return "", err
+	}
+	if filepath.Ext(path) != "" {
+		return path, nil
+	}
+	// Pictures and voice messages come without a name, and the agent needs
+	// the extension to see an image
+	ext, err := sniffExtension(path)
+	if err != nil || ext == "" {
+		return path, nil
+	}
+	if err := os.Rename(path, path+ext); err != nil {
+		return path, nil
+	}
+	return path + ext, nil
+}
+
+// sniffExtension returns the extension matching the content of the image
+// or audio file at path, or "" if it is not recognized.
+func sniffExtension(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := f.Read(head)
+	head = head[:n]
+
+	if strings.HasPrefix(string(head), "#!AMR") {
+		return ".amr", nil
+	}
+	contentType := http.DetectContentType(head)
+	switch contentType {
+	case "application/ogg":
+		return ".ogg", nil
+	case "video/mp4":
+		return ".mp4", nil
+	}
+	return imageExtensions[contentType], nil
+}
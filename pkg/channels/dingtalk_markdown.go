@@ -0,0 +1,105 @@
+package channels
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// dingTalkMaxMessage is the most characters sent in one robot message;
+// longer replies are split.
+const dingTalkMaxMessage = 4000
+
+// dingTalkMaxTitle bounds the title of a Markdown message, which DingTalk
+// shows in the chat list and notifications.
+const dingTalkMaxTitle = 30
+
+// mdNumbered matches a numbered list item.
+var mdNumbered = regexp.MustCompile(`^\s*\d+[.)]\s+\S`)
+
+type dingTalkSampleMarkdownParam struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+// dingTalkRobotMessage is one robot message: its msgKey and msgParam.
+type dingTalkRobotMessage struct {
+	Key   string
+	Param string
+}
+
+// dingTalkTextMessages returns the robot messages that send content:
+// sampleMarkdown when it uses Markdown, which sampleText would show
+// literally, and sampleText otherwise, split to fit dingTalkMaxMessage.
+func dingTalkTextMessages(content string) []dingTalkRobotMessage {
+	chunks := splitMarkdown(content, dingTalkMaxMessage)
+	if !hasMarkdown(content) {
+		messages := make([]dingTalkRobotMessage, 0, len(chunks))
+		for _, chunk := range chunks {
+			param, _ := json.Marshal(dingTalkSampleTextParam{Content: chunk})
+			messages = append(messages, dingTalkRobotMessage{Key: "sampleText", Param: string(param)})
+		}
+		return messages
+	}
+
+	title := markdownTitle(content)
+	messages := make([]dingTalkRobotMessage, 0, len(chunks))
+	for i, chunk := range chunks {
+		t := title
+		if len(chunks) > 1 {
+			t = fmt.Sprintf("%s (%d/%d)", title, i+1, len(chunks))
+		}
+		param, _ := json.Marshal(dingTalkSampleMarkdownParam{Title: t, Text: chunk})
+		messages = append(messages, dingTalkRobotMessage{Key: "sampleMarkdown", Param: string(param)})
+	}
+	return messages
+}
+
+// hasMarkdown reports whether text uses Markdown that DingTalk renders:
+// headings, emphasis, code, links, quotes or lists.
+func hasMarkdown(text string) bool {
+	for _, re := range []*regexp.Regexp{mdCode, mdLink, mdBold, mdStrike} {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if mdFence.MatchString(line) || mdHeading.MatchString(line) || mdQuote.MatchString(line) ||
+			mdBullet.MatchString(line) || mdNumbered.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// markdownTitle derives the title of a Markdown message: its first
+// heading, or else its first line, without markup and shortened.
+func markdownTitle(text string) string {
+	title := ""
+	for _, line := range strings.Split(text, "\n") {
+		if m := mdHeading.FindStringSubmatch(line); m != nil {
+			title = m[1]
+			break
+		}
+		if title == "" && strings.TrimSpace(line) != "" && !mdFence.MatchString(line) {
+			title = line
+		}
+	}
+	title = mdLink.ReplaceAllString(title, "$1")
+	title = mdBold.ReplaceAllString(title, "$1")
+	title = mdCode.ReplaceAllString(title, "$1")
+	title = strings.TrimLeft(strings.TrimSpace(title), "#>-*+ ")
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		return "Reply"
+	}
+	return truncateRunes(title, dingTalkMaxTitle)
+}
+
+func truncateRunes(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
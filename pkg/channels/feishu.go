@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/HKUDS/nanobot-go/pkg/bus"
@@ -31,6 +32,16 @@ type FeishuChannel struct {
 	Workspace string
 	client    *lark.Client
 	wsClient  *larkws.Client
+	// dispatcher handles the events posted to the webhook in webhook mode.
+	dispatcher *larkdispatcher.EventDispatcher
+	// Transcriber, if set, turns voice messages into text.
+	Transcriber *Transcriber
+	// botOpenID is the bot's own open_id, to recognize mentions of it.
+	botOpenID string
+
+	seenMu sync.Mutex
+	seen   map[string]bool
+	recent []string // Event IDs in seen, oldest first
 }
 
 // NewFeishuChannel creates a new FeishuChannel.
@@ -86,39 +97,53 @@ func (c *FeishuChannel) Start() error {
 	// API Client (for sending messages)
 	c.client = lark.NewClient(c.Config.AppID, c.Config.AppSecret)
 
-	// WebSocket Client (for receiving messages)
 	// For WebSocket, we use the dispatcher but VerificationToken and EncryptKey are generally not used for signature validation
 	// in the same way as Webhooks, but we pass them if available.
-	handler := larkdispatcher.NewEventDispatcher(c.Config.VerificationToken, c.Config.EncryptKey).
-		OnP2MessageReceiveV1(func(ctx context.Context, event *larkim.P2MessageReceiveV1) error {
-			// Extract message content
-			content := *event.Event.Message.Content
-			// msgType := *event.Event.Message.MsgType // Removed due to compilation error
-			log.Printf("Received Feishu event content: %s", content)
+	if c.Config.RequireMention {
+		c.loadBotOpenID()
+	}
+	handler := c.eventDispatcher()
+	if c.Webhook() {
+		if c.Config.EncryptKey == "" && c.Config.VerificationToken == "" {
+			return fmt.Errorf("webhook mode needs encryptKey or verificationToken to authenticate events")
+		}
+		c.dispatcher = handler
+		log.Printf("Feishu bot started in webhook mode, receiving events at %s on the gateway", c.WebhookPath())
+		return nil
+	}
 
-			var textContent string
+	// WebSocket Client (for receiving messages)
+	c.wsClient = larkws.NewClient(
+		c.Config.AppID,
+		c.Config.AppSecret,
+		larkws.WithEventHandler(handler),
+		larkws.WithLogLevel(larkcore.LogLevelInfo),
+	)
 
-			// Try to parse as text message
-			var msgContent struct {
-				Text string `json:"text"`
-			}
-			if err := json.Unmarshal([]byte(content), &msgContent); err == nil && msgContent.Text != "" {
-				textContent = msgContent.Text
-			} else {
-				// Fallback: try to parse generic map
-				var generic map[string]interface{}
-				if err := json.Unmarshal([]byte(content), &generic); err == nil {
-					// Check for "title" and "content" (Post message)
-					if _, ok := generic["content"]; ok {
-						textContent = fmt.Sprintf("[Rich Text] %s", content)
-					} else {
-						textContent = content
-					}
-				} else {
-					textContent = content
-				}
+	go func() {
+		log.Println("Starting Feishu WebSocket client...")
+		if err := c.wsClient.Start(context.Background()); err != nil {
+			log.Printf("Feishu WebSocket error: %v", err)
+			c.Monitor.Disconnected(c.Name(), err)
+		}
+	}()
+
+	log.Println("Feishu bot started")
+	return nil
+}
+
+// eventDispatcher returns the handler of the events the bot subscribes to,
+// for either transport.
+func (c *FeishuChannel) eventDispatcher() *larkdispatcher.EventDispatcher {
+	return larkdispatcher.NewEventDispatcher(c.Config.VerificationToken, c.Config.EncryptKey).
+		OnP2MessageReceiveV1(func(ctx context.Context, event *larkim.P2MessageReceiveV1) error {
+			// Feishu delivers an event again when it gets no timely answer
+			if event.EventV2Base != nil && event.EventV2Base.Header != nil && c.seenEvent(event.EventV2Base.Header.EventID) {
+				return nil
 			}
 
+			log.Printf("Received Feishu event content: %s", larkcore.StringValue(event.Event.Message.Content))
+
 			chatID := *event.Event.Message.ChatId
 			senderID := *event.Event.Sender.SenderId.OpenId
 
@@ -128,33 +153,60 @@ func (c *FeishuChannel) Start() error {
 				return nil
 			}
 
+			// In groups, messages not addressed to the bot are only kept as context
+			msg := event.Event.Message
+			passive := c.Config.RequireMention && isFeishuGroup(msg) && !c.mentionsBot(msg)
+			textContent, media := c.parseMessage(ctx, msg, !passive)
+			textContent = c.resolveMentions(textContent, msg.Mentions)
+			metadata := map[string]interface{}{"group": isFeishuGroup(msg)}
+			if passive {
+				metadata["passive"] = true
+			}
+
 			// Publish to bus
+			c.Monitor.RecordInbound(c.Name())
 			c.Bus.PublishInbound(bus.InboundMessage{
 				Channel:  c.Name(),
 				SenderID: senderID,
 				ChatID:   chatID,
 				Content:  textContent,
+				Media:    media,
+				Metadata: metadata,
 			})
 
+			return nil
+		}).
+		OnP2MessageReactionCreatedV1(func(ctx context.Context, event *larkim.P2MessageReactionCreatedV1) error {
+			// A thumbs up or down on one of the bot's replies is feedback
+			data := event.Event
+			if data == nil || data.ReactionType == nil || data.UserId == nil {
+				return nil
+			}
+			var rating string
+			switch strings.ToLower(larkcore.StringValue(data.ReactionType.EmojiType)) {
+			case "thumbsup":
+				rating = "good"
+			case "thumbsdown":
+				rating = "bad"
+			default:
+				return nil
+			}
+			senderID := larkcore.StringValue(data.UserId.OpenId)
+			if !c.IsAllowed(senderID) {
+				return nil
+			}
+			sent, ok := c.Bus.SentAs(c.Name(), larkcore.StringValue(data.MessageId))
+			if !ok {
+				return nil
+			}
+			c.Bus.PublishInbound(bus.InboundMessage{
+				Channel:  c.Name(),
+				SenderID: senderID,
+				ChatID:   sent.ChatID,
+				Metadata: map[string]interface{}{"feedback": rating},
+			})
 			return nil
 		})
-
-	c.wsClient = larkws.NewClient(
-		c.Config.AppID,
-		c.Config.AppSecret,
-		larkws.WithEventHandler(handler),
-		larkws.WithLogLevel(larkcore.LogLevelInfo),
-	)
-
-	go func() {
-		log.Println("Starting Feishu WebSocket client...")
-		if err := c.wsClient.Start(context.Background()); err != nil {
-			log.Printf("Feishu WebSocket error: %v", err)
-		}
-	}()
-
-	log.Println("Feishu bot started")
-	return nil
 }
 
 func (c *FeishuChannel) sendStream(msg bus.OutboundMessage, receiveIDType string) error {
@@ -269,6 +321,7 @@ func (c *FeishuChannel) sendStream(msg bus.OutboundMessage, receiveIDType string
 	if !msgResp.Success() {
 		return fmt.Errorf("feishu send message failed: %d %s", msgResp.Code, msgResp.Msg)
 	}
+	c.Bus.RecordSent(msg, larkcore.StringValue(msgResp.Data.MessageId))
 
 	// 3. Loop stream updates
 	sequence := 1
@@ -277,9 +330,29 @@ func (c *FeishuChannel) sendStream(msg bus.OutboundMessage, receiveIDType string
 	defer ticker.Stop()
 
 	var hasPending bool
+	status := msg.Status
 
 	for {
 		select {
+		case note, ok := <-status:
+			if !ok {
+				status = nil
+				continue
+			}
+			// Until the reply begins, the card shows what the agent is doing
+			if contentBuilder.Len() == 0 {
+				updateReq := &larkcore.ApiReq{
+					HttpMethod:                "PUT",
+					ApiPath:                   fmt.Sprintf("https://open.feishu.cn/open-apis/cardkit/v1/cards/%s/elements/%s/content", cardID, elementID),
+					Body:                      map[string]interface{}{"content": note, "sequence": sequence},
+					SupportedAccessTokenTypes: []larkcore.AccessTokenType{larkcore.AccessTokenTypeTenant},
+				}
+				sequence++
+				if _, err := c.client.Do(ctx, updateReq); err != nil {
+					log.Printf("Failed to update stream status: %v", err)
+				}
+			}
+
 		case chunk, ok := <-msg.Stream:
 			if !ok {
 				// Stream closed, send remaining content if any
@@ -435,6 +508,7 @@ func (c *FeishuChannel) Send(msg bus.OutboundMessage) error {
 		if !resp.Success() {
 			return fmt.Errorf("feishu send image failed: %d %s", resp.Code, resp.Msg)
 		}
+		c.Bus.RecordSent(msg, larkcore.StringValue(resp.Data.MessageId))
 		return nil
 
 	case bus.MessageTypeAudio:
@@ -470,6 +544,7 @@ func (c *FeishuChannel) Send(msg bus.OutboundMessage) error {
 		if !resp.Success() {
 			return fmt.Errorf("feishu send audio failed: %d %s", resp.Code, resp.Msg)
 		}
+		c.Bus.RecordSent(msg, larkcore.StringValue(resp.Data.MessageId))
 		return nil
 
 	case bus.MessageTypeVideo:
@@ -511,39 +586,56 @@ func (c *FeishuChannel) Send(msg bus.OutboundMessage) error {
 		if !resp.Success() {
 			return fmt.Errorf("feishu send video failed: %d %s", resp.Code, resp.Msg)
 		}
+		c.Bus.RecordSent(msg, larkcore.StringValue(resp.Data.MessageId))
 		return nil
 
-	default:
-		// Construct Interactive Card (Text)
-		cardContent := map[string]interface{}{
-			"config": map[string]interface{}{
-				"wide_screen_mode": true,
-			},
-			"header": map[string]interface{}{
-				"title": map[string]interface{}{
-					"tag":     "plain_text",
-					"content": c.getAgentName(),
-				},
-				"template": "blue",
-			},
-			"elements": []interface{}{
-				map[string]interface{}{
-					"tag": "div",
-					"text": map[string]interface{}{
-						"tag":     "lark_md",
-						"content": msg.Content,
-					},
-				},
-			},
+	case bus.MessageTypeFile:
+		if msg.Media == "" {
+			return fmt.Errorf("media path/url is empty")
+		}
+		reader, filename, err := utils.GetMediaReader(msg.Media)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		fileKey, err := c.uploadFile(ctx, reader, filename, "stream")
+		if err != nil {
+			return err
+		}
+
+		content := map[string]interface{}{"file_key": fileKey}
+		contentBytes, _ := json.Marshal(content)
+
+		req := larkim.NewCreateMessageReqBuilder().
+			ReceiveIdType(receiveIDType).
+			Body(larkim.NewCreateMessageReqBodyBuilder().
+				ReceiveId(msg.ChatID).
+				MsgType(larkim.MsgTypeFile).
+				Content(string(contentBytes)).
+				Build()).
+			Build()
+		resp, err := c.client.Im.Message.Create(ctx, req)
+		if err != nil {
+			return err
+		}
+		if !resp.Success() {
+			return fmt.Errorf("feishu send file failed: %d %s", resp.Code, resp.Msg)
 		}
-		contentJSON, _ := json.Marshal(cardContent)
+		c.Bus.RecordSent(msg, larkcore.StringValue(resp.Data.MessageId))
+		// File messages have no caption; send it as a text message
+		if msg.Content != "" {
+			return c.Send(bus.OutboundMessage{ID: msg.ID, Channel: msg.Channel, ChatID: msg.ChatID, Content: msg.Content})
+		}
+		return nil
 
+	default:
 		req := larkim.NewCreateMessageReqBuilder().
 			ReceiveIdType(receiveIDType).
 			Body(larkim.NewCreateMessageReqBodyBuilder().
 				ReceiveId(msg.ChatID).
 				MsgType(larkim.MsgTypeInteractive).
-				Content(string(contentJSON)).
+				Content(c.textCard(msg.Content)).
 				Build()).
 			Build()
 
@@ -554,11 +646,71 @@ func (c *FeishuChannel) Send(msg bus.OutboundMessage) error {
 		if !resp.Success() {
 			return fmt.Errorf("feishu error: %d %s", resp.Code, resp.Msg)
 		}
+		c.Bus.RecordSent(msg, larkcore.StringValue(resp.Data.MessageId))
 
 		return nil
 	}
 }
 
+// textCard returns the interactive card a text reply is sent as.
+func (c *FeishuChannel) textCard(content string) string {
+	cardContent := map[string]interface{}{
+		"config": map[string]interface{}{
+			"wide_screen_mode": true,
+			// Lets EditMessage update the card for everyone in the chat
+			"update_multi": true,
+		},
+		"header": map[string]interface{}{
+			"title": map[string]interface{}{
+				"tag":     "plain_text",
+				"content": c.getAgentName(),
+			},
+			"template": "blue",
+		},
+		"elements": markdownToCardElements(content),
+	}
+	contentJSON, _ := json.Marshal(cardContent)
+	return string(contentJSON)
+}
+
+// EditMessage replaces the content of a sent reply card. Feishu only
+// allows editing messages up to 14 days old.
+func (c *FeishuChannel) EditMessage(chatID, messageID, content string) error {
+	if c.client == nil {
+		return fmt.Errorf("feishu client not initialized")
+	}
+	req := larkim.NewPatchMessageReqBuilder().
+		MessageId(messageID).
+		Body(larkim.NewPatchMessageReqBodyBuilder().
+			Content(c.textCard(content)).
+			Build()).
+		Build()
+	resp, err := c.client.Im.Message.Patch(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	if !resp.Success() {
+		return fmt.Errorf("feishu edit message failed: %d %s", resp.Code, resp.Msg)
+	}
+	return nil
+}
+
+// DeleteMessage recalls a sent message.
+func (c *FeishuChannel) DeleteMessage(chatID, messageID string) error {
+	if c.client == nil {
+		return fmt.Errorf("feishu client not initialized")
+	}
+	req := larkim.NewDeleteMessageReqBuilder().MessageId(messageID).Build()
+	resp, err := c.client.Im.Message.Delete(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	if !resp.Success() {
+		return fmt.Errorf("feishu delete message failed: %d %s", resp.Code, resp.Msg)
+	}
+	return nil
+}
+
 func (c *FeishuChannel) uploadImage(ctx context.Context, reader io.Reader) (string, error) {
 	req := larkim.NewCreateImageReqBuilder().
 		Body(larkim.NewCreateImageReqBodyBuilder().
@@ -0,0 +1,174 @@
+package channels
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Limits of the Feishu card format; content beyond them degrades to plain markdown.
+const (
+	feishuMaxCardElements = 50
+	feishuMaxTableColumns = 10
+	feishuTablePageSize   = 10
+)
+
+var (
+	reMdHeading   = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	reMdListItem  = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	reMdImage     = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)[^)]*\)`)
+	reMdRule      = regexp.MustCompile(`^\s*(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	reMdTableSep  = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	reMdFenceLine = regexp.MustCompile("^\\s*(```|~~~)")
+)
+
+// markdownToCardElements converts common Markdown into Feishu card elements.
+// Code blocks and text become markdown elements, tables become table
+// elements and rules become hr. Constructs the card can't show (headings,
+// nested lists, images) are rewritten into forms it can.
+func markdownToCardElements(md string) []interface{} {
+	var elements []interface{}
+	var text []string
+
+	flushText := func() {
+		content := strings.Trim(strings.Join(text, "\n"), "\n")
+		text = text[:0]
+		if strings.TrimSpace(content) != "" {
+			elements = append(elements, map[string]interface{}{"tag": "markdown", "content": content})
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		// Fenced code block: keep verbatim.
+		if m := reMdFenceLine.FindStringSubmatch(line); m != nil {
+			block := []string{strings.TrimSpace(line)}
+			for i++; i < len(lines); i++ {
+				block = append(block, lines[i])
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), m[1]) {
+					break
+				}
+			}
+			if !strings.HasPrefix(strings.TrimSpace(block[len(block)-1]), m[1]) || len(block) == 1 {
+				block = append(block, m[1])
+			}
+			flushText()
+			elements = append(elements, map[string]interface{}{"tag": "markdown", "content": strings.Join(block, "\n")})
+			continue
+		}
+
+		// Table: header row followed by a separator row.
+		if strings.Contains(line, "|") && i+1 < len(lines) && reMdTableSep.MatchString(lines[i+1]) {
+			header := splitTableRow(line)
+			var rows [][]string
+			j := i + 2
+			for ; j < len(lines) && strings.Contains(lines[j], "|") && strings.TrimSpace(lines[j]) != ""; j++ {
+				rows = append(rows, splitTableRow(lines[j]))
+			}
+			flushText()
+			elements = append(elements, tableElement(header, rows, lines[i:j]))
+			i = j - 1
+			continue
+		}
+
+		if reMdRule.MatchString(line) {
+			flushText()
+			elements = append(elements, map[string]interface{}{"tag": "hr"})
+			continue
+		}
+
+		if m := reMdHeading.FindStringSubmatch(line); m != nil {
+			text = append(text, "**"+strings.TrimSpace(m[2])+"**")
+			continue
+		}
+
+		if m := reMdListItem.FindStringSubmatch(line); m != nil && len(m[1]) >= 2 {
+			// Nested list item: card markdown only renders one level.
+			depth := len(strings.ReplaceAll(m[1], "\t", "    ")) / 2
+			text = append(text, strings.Repeat("　", depth)+"◦ "+convertInline(m[3]))
+			continue
+		}
+
+		text = append(text, convertInline(line))
+	}
+	flushText()
+
+	if len(elements) == 0 || len(elements) > feishuMaxCardElements {
+		// Nothing parsed, or too many modules for one card: fall back to a single markdown element.
+		return []interface{}{map[string]interface{}{"tag": "markdown", "content": md}}
+	}
+	return elements
+}
+
+// convertInline rewrites inline Markdown the card can't render.
+func convertInline(line string) string {
+	// Images need an uploaded img_key; link to them instead.
+	return reMdImage.ReplaceAllStringFunc(line, func(s string) string {
+		m := reMdImage.FindStringSubmatch(s)
+		alt := m[1]
+		if alt == "" {
+			alt = "image"
+		}
+		return fmt.Sprintf("[%s](%s)", alt, m[2])
+	})
+}
+
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+	cells := strings.Split(line, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+// tableElement builds a card table, or a code block of the raw rows if the
+// table is too wide for the card.
+func tableElement(header []string, rows [][]string, raw []string) map[string]interface{} {
+	if len(header) == 0 || len(header) > feishuMaxTableColumns {
+		return map[string]interface{}{"tag": "markdown", "content": "```\n" + strings.Join(raw, "\n") + "\n```"}
+	}
+
+	columns := make([]interface{}, len(header))
+	for i, h := range header {
+		columns[i] = map[string]interface{}{
+			"name":         fmt.Sprintf("c%d", i),
+			"display_name": h,
+			"data_type":    "lark_md",
+		}
+	}
+
+	tableRows := make([]interface{}, 0, len(rows))
+	for _, row := range rows {
+		r := make(map[string]interface{}, len(header))
+		for i := range header {
+			cell := ""
+			if i < len(row) {
+				cell = convertInline(row[i])
+			}
+			r[fmt.Sprintf("c%d", i)] = cell
+		}
+		tableRows = append(tableRows, r)
+	}
+
+	pageSize := len(rows)
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	if pageSize > feishuTablePageSize {
+		pageSize = feishuTablePageSize
+	}
+
+	return map[string]interface{}{
+		"tag":          "table",
+		"page_size":    pageSize,
+		"row_height":   "low",
+		"header_style": map[string]interface{}{"bold": true, "background_style": "grey"},
+		"columns":      columns,
+		"rows":         tableRows,
+	}
+}
@@ -0,0 +1,212 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+)
+
+// feishuMaxDownload bounds the size of a file downloaded from a message.
+const feishuMaxDownload = 50 * 1024 * 1024
+
+// feishuContent holds the fields of the content of the message types the
+// bot reads.
+type feishuContent struct {
+	Text     string `json:"text"`
+	ImageKey string `json:"image_key"`
+	FileKey  string `json:"file_key"`
+	FileName string `json:"file_name"`
+	// Post
+	Title   string                `json:"title"`
+	Content [][]feishuPostElement `json:"content"`
+}
+
+// feishuPostElement is an element of a paragraph of a rich text post.
+type feishuPostElement struct {
+	Tag      string `json:"tag"`
+	Text     string `json:"text"`
+	Href     string `json:"href"`
+	UserID   string `json:"user_id"`
+	UserName string `json:"user_name"`
+	ImageKey string `json:"image_key"`
+	FileKey  string `json:"file_key"`
+	Language string `json:"language"`
+}
+
+// parseMessage returns the text of a received message for the agent, and
+// the images, files and voice messages it carries, downloaded into the
+// workspace unless fetch is false. Voice messages are transcribed when a
+// Transcriber is set.
+func (c *FeishuChannel) parseMessage(ctx context.Context, msg *larkim.EventMessage, fetch bool) (string, []string) {
+	raw := larkcore.StringValue(msg.Content)
+	msgType := larkcore.StringValue(msg.MessageType)
+	messageID := larkcore.StringValue(msg.MessageId)
+
+	var content feishuContent
+	if err := json.Unmarshal([]byte(raw), &content); err != nil {
+		return raw, nil
+	}
+
+	var media []string
+	var notes []string
+	download := func(key, resourceType, name, label string) {
+		if !fetch {
+			return
+		}
+		path, err := c.downloadResource(ctx, messageID, key, resourceType, name)
+		if err != nil {
+			log.Printf("Feishu: failed to download %s %s: %v", label, key, err)
+			notes = append(notes, fmt.Sprintf("[%s received (download failed)]", label))
+			return
+		}
+		media = append(media, path)
+	}
+
+	switch msgType {
+	case larkim.MsgTypeText:
+		return content.Text, nil
+
+	case larkim.MsgTypePost:
+		text := c.postText(content, download)
+		return strings.TrimSpace(strings.Join(append([]string{text}, notes...), "\n")), media
+
+	case larkim.MsgTypeImage:
+		download(content.ImageKey, "image", "", "Image")
+		notes = append([]string{"[Image received]"}, notes...)
+
+	case larkim.MsgTypeFile:
+		download(content.FileKey, "file", content.FileName, "File")
+		notes = append([]string{"[File received: " + content.FileName + "]"}, notes...)
+
+	case larkim.MsgTypeMedia:
+		download(content.FileKey, "file", content.FileName, "Video")
+		notes = append([]string{"[Video received: " + content.FileName + "]"}, notes...)
+
+	case larkim.MsgTypeAudio:
+		if !fetch {
+			return "[Voice message received]", nil
+		}
+		// Voice messages are Opus in an Ogg container
+		download(content.FileKey, "file", content.FileKey+".ogg", "Voice message")
+		if len(media) == 0 {
+			return strings.Join(notes, "\n"), nil
+		}
+		if c.Transcriber == nil {
+			return "[Voice message received]", media
+		}
+		text, err := c.Transcriber.Transcribe(ctx, media[0])
+		if err != nil {
+			log.Printf("Feishu: failed to transcribe voice message %s: %v", messageID, err)
+			return "[Voice message received (transcription failed)]", media
+		}
+		return "[Voice message, transcribed] " + text, media
+
+	case "sticker":
+		return "[Sticker]", nil
+
+	default:
+		return raw, nil
+	}
+	return strings.Join(notes, "\n"), media
+}
+
+// postText returns the text of a rich text post, with links as Markdown,
+// and downloads its images and videos.
+func (c *FeishuChannel) postText(content feishuContent, download func(key, resourceType, name, label string)) string {
+	var lines []string
+	if content.Title != "" {
+		lines = append(lines, content.Title)
+	}
+	for _, paragraph := range content.Content {
+		var line strings.Builder
+		for _, el := range paragraph {
+			switch el.Tag {
+			case "text":
+				line.WriteString(el.Text)
+			case "a":
+				fmt.Fprintf(&line, "[%s](%s)", el.Text, el.Href)
+			case "at":
+				// The mention's placeholder, resolved with the message's mentions
+				if strings.HasPrefix(el.UserID, "@_") {
+					line.WriteString(el.UserID)
+				} else {
+					line.WriteString("@" + el.UserName)
+				}
+			case "code_block":
+				fmt.Fprintf(&line, "```%s\n%s\n```", el.Language, strings.TrimRight(el.Text, "\n"))
+			case "img":
+				download(el.ImageKey, "image", "", "Image")
+			case "media":
+				download(el.FileKey, "file", "", "Video")
+			}
+		}
+		lines = append(lines, line.String())
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// downloadResource saves an image or file of a message under
+// workspace/uploads/feishu and returns its path.
+func (c *FeishuChannel) downloadResource(ctx context.Context, messageID, key, resourceType, name string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("no resource key")
+	}
+	req := larkim.NewGetMessageResourceReqBuilder().
+		MessageId(messageID).
+		FileKey(key).
+		Type(resourceType).
+		Build()
+	resp, err := c.client.Im.MessageResource.Get(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if !resp.Success() {
+		return "", fmt.Errorf("feishu get message resource failed: %d %s", resp.Code, resp.Msg)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.File, feishuMaxDownload+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > feishuMaxDownload {
+		return "", fmt.Errorf("file exceeds %d bytes", feishuMaxDownload)
+	}
+
+	if name == "" {
+		name = resp.FileName
+	}
+	if name == "" {
+		name = key
+	}
+	// Image keys have no extension, which the agent needs to see an image
+	if filepath.Ext(name) == "" {
+		name += imageExtensions[http.DetectContentType(data)]
+	}
+	dir := filepath.Join(c.Workspace, "uploads", "feishu")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, messageID+"_"+filepath.Base(name))
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/bmp":  ".bmp",
+}
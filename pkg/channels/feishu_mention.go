@@ -0,0 +1,87 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	larkcore "github.com/larksuite/oapi-sdk-go/v3/core"
+	larkim "github.com/larksuite/oapi-sdk-go/v3/service/im/v1"
+)
+
+// loadBotOpenID looks up the bot's own open_id, to tell mentions of the bot
+// from mentions of others in group chats.
+func (c *FeishuChannel) loadBotOpenID() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := c.client.Get(ctx, "/open-apis/bot/v3/info", nil, larkcore.AccessTokenTypeTenant)
+	if err == nil && resp.StatusCode != 200 {
+		err = fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var info struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+		Bot  struct {
+			OpenID string `json:"open_id"`
+		} `json:"bot"`
+	}
+	if err == nil {
+		err = json.Unmarshal(resp.RawBody, &info)
+	}
+	if err == nil && info.Bot.OpenID == "" {
+		err = fmt.Errorf("%d %s", info.Code, info.Msg)
+	}
+	if err != nil {
+		log.Printf("Feishu: failed to look up the bot's open_id, any mention in a group counts as addressing the bot: %v", err)
+		return
+	}
+	c.botOpenID = info.Bot.OpenID
+}
+
+// isFeishuGroup reports whether a message was sent in a group chat.
+func isFeishuGroup(msg *larkim.EventMessage) bool {
+	chatType := larkcore.StringValue(msg.ChatType)
+	return chatType == "group" || chatType == "topic_group"
+}
+
+// mentionsBot reports whether a message mentions the bot.
+func (c *FeishuChannel) mentionsBot(msg *larkim.EventMessage) bool {
+	for _, m := range msg.Mentions {
+		if c.isBot(m) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *FeishuChannel) isBot(m *larkim.MentionEvent) bool {
+	if m == nil {
+		return false
+	}
+	if c.botOpenID == "" {
+		return true
+	}
+	return m.Id != nil && larkcore.StringValue(m.Id.OpenId) == c.botOpenID
+}
+
+// resolveMentions replaces the placeholders Feishu puts in the text for
+// mentions, such as "@_user_1": mentions of the bot are removed and others
+// become "@Name".
+func (c *FeishuChannel) resolveMentions(text string, mentions []*larkim.MentionEvent) string {
+	for _, m := range mentions {
+		key := larkcore.StringValue(m.Key)
+		if key == "" {
+			continue
+		}
+		if c.botOpenID != "" && c.isBot(m) {
+			text = strings.ReplaceAll(text, key+" ", "")
+			text = strings.ReplaceAll(text, key, "")
+			continue
+		}
+		text = strings.ReplaceAll(text, key, "@"+larkcore.StringValue(m.Name))
+	}
+	return strings.TrimSpace(text)
+}
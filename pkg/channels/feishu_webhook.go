@@ -0,0 +1,111 @@
+package channels
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/larksuite/oapi-sdk-go/v3/core/httpserverext"
+)
+
+const (
+	// DefaultFeishuWebhookPath is where the gateway receives Feishu events
+	// in webhook mode unless webhookPath says otherwise.
+	DefaultFeishuWebhookPath = "/feishu/events"
+	// maxFeishuEventBytes bounds the body of an event request.
+	maxFeishuEventBytes = 1 << 20
+	// seenEventsSize is how many recent event IDs are remembered to drop
+	// events Feishu delivers again.
+	seenEventsSize = 1024
+)
+
+// Webhook reports whether Feishu posts events to the gateway instead of
+// sending them over the long connection.
+func (c *FeishuChannel) Webhook() bool {
+	return strings.EqualFold(c.Config.Mode, "webhook")
+}
+
+// WebhookPath returns the gateway path events are posted to.
+func (c *FeishuChannel) WebhookPath() string {
+	if c.Config.WebhookPath != "" {
+		return "/" + strings.TrimLeft(c.Config.WebhookPath, "/")
+	}
+	return DefaultFeishuWebhookPath
+}
+
+// WebhookHandler returns the handler for the webhook, to be mounted on the
+// gateway at WebhookPath, or nil if the channel is not started in webhook
+// mode. The SDK answers the URL verification challenge, decrypts events
+// with encryptKey and checks their signature. Without an encryptKey events
+// are neither signed nor encrypted, so their verification token is checked
+// instead.
+func (c *FeishuChannel) WebhookHandler() http.Handler {
+	if c.dispatcher == nil {
+		return nil
+	}
+	handle := httpserverext.NewEventHandlerFunc(c.dispatcher)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxFeishuEventBytes))
+		if err != nil {
+			http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if c.Config.EncryptKey == "" && !c.validToken(body) {
+			log.Printf("Feishu webhook request with a wrong verification token from %s", r.RemoteAddr)
+			http.Error(w, "invalid verification token", http.StatusUnauthorized)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		handle(w, r)
+	})
+}
+
+// validToken reports whether a plain event carries the verification token:
+// in its header (schema 2.0) or at the top level (schema 1.0 and the URL
+// verification challenge).
+func (c *FeishuChannel) validToken(body []byte) bool {
+	var event struct {
+		Token  string `json:"token"`
+		Header struct {
+			Token string `json:"token"`
+		} `json:"header"`
+	}
+	if json.Unmarshal(body, &event) != nil {
+		return false
+	}
+	token := event.Header.Token
+	if token == "" {
+		token = event.Token
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(c.Config.VerificationToken)) == 1
+}
+
+// seenEvent reports whether an event was handled already, and remembers it.
+func (c *FeishuChannel) seenEvent(id string) bool {
+	if id == "" {
+		return false
+	}
+	c.seenMu.Lock()
+	defer c.seenMu.Unlock()
+	if c.seen[id] {
+		return true
+	}
+	if c.seen == nil {
+		c.seen = make(map[string]bool)
+	}
+	c.seen[id] = true
+	c.recent = append(c.recent, id)
+	if len(c.recent) > seenEventsSize {
+		delete(c.seen, c.recent[0])
+		c.recent = c.recent[1:]
+	}
+	return false
+}
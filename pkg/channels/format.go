@@ -0,0 +1,118 @@
+package channels
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/config"
+)
+
+// NewOutboundFormatter returns a bus hook that applies each channel's
+// configured prefix, suffix, signature and text adjustments to its text
+// messages, including streamed ones.
+func NewOutboundFormatter(formats map[string]config.OutboundFormat) bus.OutboundHook {
+	return func(msg bus.OutboundMessage) bus.OutboundMessage {
+		f, ok := formats[msg.Channel]
+		if !ok || (msg.Type != "" && msg.Type != bus.MessageTypeText) || !inScope(f.Scope, msg.Channel, msg.ChatID) {
+			return msg
+		}
+		head := f.Prefix
+		tail := f.Suffix
+		if f.Signature != "" {
+			tail += "\n\n" + f.Signature
+		}
+		replacer := newFormatReplacer(f)
+
+		if msg.Stream == nil {
+			if msg.Content != "" {
+				msg.Content = head + replacer(msg.Content) + tail
+			}
+			return msg
+		}
+
+		in := msg.Stream
+		out := make(chan string)
+		go func() {
+			defer close(out)
+			sent := false
+			for chunk := range in {
+				if chunk = replacer(chunk); chunk == "" {
+					continue
+				}
+				if !sent {
+					chunk = head + chunk
+					sent = true
+				}
+				out <- chunk
+			}
+			if sent && tail != "" {
+				out <- tail
+			}
+		}()
+		msg.Stream = out
+		return msg
+	}
+}
+
+// inScope reports whether a format with the given scope applies to a chat.
+func inScope(scope, channel, chatID string) bool {
+	switch scope {
+	case "group":
+		return isGroupChat(channel, chatID)
+	case "direct":
+		return !isGroupChat(channel, chatID)
+	}
+	return true
+}
+
+// isGroupChat recognizes group chat IDs on channels where the ID tells.
+func isGroupChat(channel, chatID string) bool {
+	switch channel {
+	case "dingtalk":
+		return strings.HasPrefix(chatID, "cid")
+	case "telegram":
+		return strings.HasPrefix(chatID, "-")
+	}
+	return false
+}
+
+// newFormatReplacer returns the text adjustments of a format as one function.
+func newFormatReplacer(f config.OutboundFormat) func(string) string {
+	var pairs []string
+	keys := make([]string, 0, len(f.Replace))
+	for k := range f.Replace {
+		keys = append(keys, k)
+	}
+	// Longer matches first so overlapping keys replace predictably
+	sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+	for _, k := range keys {
+		if k != "" {
+			pairs = append(pairs, k, f.Replace[k])
+		}
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	return func(s string) string {
+		if f.StripEmoji {
+			s = strings.Map(func(r rune) rune {
+				if isEmoji(r) {
+					return -1
+				}
+				return r
+			}, s)
+		}
+		if len(pairs) > 0 {
+			s = replacer.Replace(s)
+		}
+		return s
+	}
+}
+
+// isEmoji reports whether r is an emoji or an emoji modifier.
+func isEmoji(r rune) bool {
+	return (r >= 0x1F000 && r <= 0x1FAFF) || // Pictographs, emoticons, flags, skin tones
+		(r >= 0x2600 && r <= 0x27BF) || // Miscellaneous symbols and dingbats
+		r == 0x2B50 || r == 0x2B55 || // Star, circle
+		r == 0xFE0F || r == 0x200D // Variation selector, zero-width joiner
+}
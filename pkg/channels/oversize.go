@@ -0,0 +1,138 @@
+package channels
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+)
+
+// oversizePreviewChars is the length of the start of an oversized reply
+// shown in the chat next to the file.
+const oversizePreviewChars = 500
+
+// NewFileFallbackSender wraps send so a text reply longer than maxChars
+// characters goes out as a file attachment, after a message with its
+// start, instead of as a flood of messages or a failing send. A streamed
+// reply is shown until it passes maxChars and then attached in full. The
+// file is written under workspace/outbox and removed once sent. A
+// maxChars of 0 sends everything as is.
+func NewFileFallbackSender(name string, maxChars int, workspace string, send Sender) Sender {
+	if maxChars <= 0 {
+		return send
+	}
+	f := &fileFallback{name: name, maxChars: maxChars, dir: filepath.Join(workspace, "outbox"), send: send}
+	return f.Send
+}
+
+type fileFallback struct {
+	name     string
+	maxChars int
+	dir      string
+	send     Sender
+}
+
+func (f *fileFallback) Send(msg bus.OutboundMessage) error {
+	if msg.Type != "" && msg.Type != bus.MessageTypeText {
+		return f.send(msg)
+	}
+	if msg.Stream != nil {
+		return f.sendStream(msg)
+	}
+	n := utf8.RuneCountInString(msg.Content)
+	if n <= f.maxChars {
+		return f.send(msg)
+	}
+
+	preview := splitMarkdown(msg.Content, oversizePreviewChars)[0]
+	notice := preview + "\n\n…\n\n" + fmt.Sprintf("The full reply (%d characters) is attached.", n)
+	text := msg
+	text.Content = notice
+	if err := f.send(text); err != nil {
+		return err
+	}
+	return f.sendFile(msg, msg.Content)
+}
+
+// sendStream passes a streamed reply through until it grows past
+// maxChars, then ends the streamed message with a note and attaches the
+// whole reply once the stream is done.
+func (f *fileFallback) sendStream(msg bus.OutboundMessage) error {
+	in := msg.Stream
+	out := make(chan string, cap(in))
+	done := make(chan struct{})
+	var full strings.Builder
+	overflowed := false
+
+	go func() {
+		defer close(done)
+		n := 0
+		for chunk := range in {
+			full.WriteString(chunk)
+			if overflowed {
+				continue
+			}
+			n += utf8.RuneCountInString(chunk)
+			if n > f.maxChars {
+				overflowed = true
+				out <- "\n\n… (too long for the chat, the full reply follows as a file)"
+				close(out)
+				continue
+			}
+			out <- chunk
+		}
+		if !overflowed {
+			close(out)
+		}
+	}()
+
+	msg.Stream = out
+	err := f.send(msg)
+	// A failed send may stop reading; the rest is still consumed
+	go func() {
+		for range out {
+		}
+	}()
+	<-done
+	if err != nil || !overflowed {
+		return err
+	}
+	return f.sendFile(msg, full.String())
+}
+
+// sendFile sends content as a Markdown or text file in the chat of msg.
+func (f *fileFallback) sendFile(msg bus.OutboundMessage, content string) error {
+	if err := os.MkdirAll(f.dir, 0700); err != nil {
+		return err
+	}
+	dir, err := ioutil.TempDir(f.dir, f.name+"-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	ext := ".txt"
+	if hasMarkdown(content) {
+		ext = ".md"
+	}
+	path := filepath.Join(dir, "reply-"+time.Now().Format("20060102-150405")+ext)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		return err
+	}
+	log.Printf("%s: reply to %s is %d characters, sending it as %s", f.name, msg.ChatID, utf8.RuneCountInString(content), filepath.Base(path))
+	return f.send(bus.OutboundMessage{
+		ID:       msg.ID,
+		Channel:  msg.Channel,
+		ChatID:   msg.ChatID,
+		Type:     bus.MessageTypeFile,
+		ReplyTo:  msg.ReplyTo,
+		Media:    path,
+		Metadata: msg.Metadata,
+	})
+}
@@ -0,0 +1,186 @@
+package channels
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/config"
+	"github.com/alibabacloud-go/tea/tea"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxBackoff caps the wait between retries of a failed send.
+const maxBackoff = 30 * time.Second
+
+// Sender delivers one outbound message, like Channel.Send.
+type Sender func(bus.OutboundMessage) error
+
+// NewLimitedSender wraps send so a channel's messages go out no faster than
+// its configured rates, and sends failing with a transient error (rate
+// limited, server error, network error) are retried with exponential
+// backoff. Streamed messages are not retried, as their stream is spent.
+func NewLimitedSender(name string, limit config.RateLimit, send Sender) Sender {
+	if limit.Rate <= 0 && limit.ChatRate <= 0 && limit.MaxRetries <= 0 {
+		return send
+	}
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	l := &sendLimiter{
+		name:       name,
+		limit:      limit,
+		burst:      burst,
+		channel:    newTokenBucket(limit.Rate, burst),
+		chats:      make(map[string]*tokenBucket),
+		send:       send,
+		backoff:    time.Duration(limit.Backoff) * time.Millisecond,
+		maxRetries: limit.MaxRetries,
+	}
+	if l.backoff <= 0 {
+		l.backoff = time.Second
+	}
+	return l.Send
+}
+
+type sendLimiter struct {
+	name       string
+	limit      config.RateLimit
+	burst      float64
+	send       Sender
+	backoff    time.Duration
+	maxRetries int
+
+	mu      sync.Mutex
+	channel *tokenBucket
+	chats   map[string]*tokenBucket
+}
+
+func (l *sendLimiter) Send(msg bus.OutboundMessage) error {
+	for attempt := 0; ; attempt++ {
+		time.Sleep(l.reserve(msg.ChatID))
+		err := l.send(msg)
+		if err == nil || msg.Stream != nil || attempt >= l.maxRetries || !isTransientSendError(err) {
+			return err
+		}
+		delay := telegramRetryAfter(err)
+		if delay == 0 {
+			delay = l.backoff << uint(attempt)
+			if delay > maxBackoff || delay <= 0 {
+				delay = maxBackoff
+			}
+			// Jitter keeps retries of a burst from arriving together
+			delay += time.Duration(rand.Int63n(int64(delay)/4 + 1))
+		}
+		log.Printf("%s: send to %s failed (%v), retry %d/%d in %s", l.name, msg.ChatID, err, attempt+1, l.maxRetries, delay.Round(time.Millisecond))
+		time.Sleep(delay)
+	}
+}
+
+// reserve takes a slot from the channel's and the chat's bucket and
+// returns how long to wait before sending.
+func (l *sendLimiter) reserve(chatID string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	wait := l.channel.reserve(now)
+	if l.limit.ChatRate > 0 {
+		if len(l.chats) > 1000 {
+			// Forget chats whose bucket has refilled; they start full anyway
+			for id, b := range l.chats {
+				if b.full(now) {
+					delete(l.chats, id)
+				}
+			}
+		}
+		b, ok := l.chats[chatID]
+		if !ok {
+			b = newTokenBucket(l.limit.ChatRate, l.burst)
+			l.chats[chatID] = b
+		}
+		if w := b.reserve(now); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+// tokenBucket allows rate events a second after an initial burst. Tokens
+// go negative as sends queue up, so waits are handed out in order.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// reserve takes a token and returns how long until it is available.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+func (b *tokenBucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// sdkStatusPattern finds the HTTP status in DingTalk SDK errors, which
+// the channel wraps as text.
+var sdkStatusPattern = regexp.MustCompile(`StatusCode: (\d+)`)
+
+// isTransientSendError reports whether a send may succeed if retried:
+// the platform limited the rate or had a server error, or the network
+// failed.
+func isTransientSendError(err error) bool {
+	transientStatus := func(code int) bool {
+		return code == http.StatusTooManyRequests || code >= 500
+	}
+	var tgErr *tgbotapi.Error
+	if errors.As(err, &tgErr) {
+		return transientStatus(tgErr.Code)
+	}
+	var sdkErr *tea.SDKError
+	if errors.As(err, &sdkErr) {
+		return transientStatus(tea.IntValue(sdkErr.StatusCode))
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	msg := err.Error()
+	if m := sdkStatusPattern.FindStringSubmatch(msg); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return transientStatus(code)
+	}
+	// Feishu reports rate limiting as code 99991400
+	return strings.Contains(msg, "99991400") || strings.Contains(msg, "Too Many Requests")
+}
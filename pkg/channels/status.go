@@ -0,0 +1,189 @@
+package channels
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxRecentErrors is the number of errors kept per channel.
+const maxRecentErrors = 5
+
+// ChannelError is an error reported by a channel.
+type ChannelError struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// ChannelStatus is the health of a single channel.
+type ChannelStatus struct {
+	Name         string         `json:"name"`
+	Enabled      bool           `json:"enabled"`
+	Connected    bool           `json:"connected"`
+	StartedAt    time.Time      `json:"startedAt"`
+	LastInbound  time.Time      `json:"lastInbound"`
+	LastOutbound time.Time      `json:"lastOutbound"`
+	ErrorCount   int            `json:"errorCount"`
+	RecentErrors []ChannelError `json:"recentErrors,omitempty"`
+}
+
+// StatusReport is the snapshot written to disk for the CLI.
+type StatusReport struct {
+	UpdatedAt time.Time       `json:"updatedAt"`
+	PID       int             `json:"pid"`
+	Channels  []ChannelStatus `json:"channels"`
+}
+
+// Monitor tracks connection state, traffic and errors of the running channels.
+// A nil Monitor ignores all updates.
+type Monitor struct {
+	mu       sync.Mutex
+	channels map[string]*ChannelStatus
+	path     string
+}
+
+// NewMonitor creates a Monitor. If path is not empty, a snapshot is written
+// there after every update so other processes can read it.
+func NewMonitor(path string) *Monitor {
+	return &Monitor{
+		channels: make(map[string]*ChannelStatus),
+		path:     path,
+	}
+}
+
+// Register adds a configured channel.
+func (m *Monitor) Register(name string, enabled bool) {
+	m.update(name, func(s *ChannelStatus) {
+		s.Enabled = enabled
+	})
+}
+
+// Started records the result of starting a channel.
+func (m *Monitor) Started(name string, err error) {
+	m.update(name, func(s *ChannelStatus) {
+		s.Enabled = true
+		s.Connected = err == nil
+		if err != nil {
+			s.addError("start: " + err.Error())
+			return
+		}
+		s.StartedAt = time.Now()
+	})
+}
+
+// Disconnected records that a channel lost its connection.
+func (m *Monitor) Disconnected(name string, err error) {
+	m.update(name, func(s *ChannelStatus) {
+		s.Connected = false
+		if err != nil {
+			s.addError("connection: " + err.Error())
+		}
+	})
+}
+
+// RecordInbound records a message received from the platform.
+func (m *Monitor) RecordInbound(name string) {
+	m.update(name, func(s *ChannelStatus) {
+		s.LastInbound = time.Now()
+	})
+}
+
+// RecordOutbound records the result of sending a message to the platform.
+func (m *Monitor) RecordOutbound(name string, err error) {
+	m.update(name, func(s *ChannelStatus) {
+		if err != nil {
+			s.addError("send: " + err.Error())
+			return
+		}
+		s.LastOutbound = time.Now()
+	})
+}
+
+// Snapshot returns the status of all channels, sorted by name.
+func (m *Monitor) Snapshot() []ChannelStatus {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshotLocked()
+}
+
+func (m *Monitor) snapshotLocked() []ChannelStatus {
+	out := make([]ChannelStatus, 0, len(m.channels))
+	for _, s := range m.channels {
+		c := *s
+		c.RecentErrors = append([]ChannelError(nil), s.RecentErrors...)
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (m *Monitor) update(name string, fn func(s *ChannelStatus)) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.channels[name]
+	if !ok {
+		s = &ChannelStatus{Name: name}
+		m.channels[name] = s
+	}
+	fn(s)
+	m.saveLocked()
+}
+
+func (s *ChannelStatus) addError(msg string) {
+	s.ErrorCount++
+	s.RecentErrors = append(s.RecentErrors, ChannelError{Time: time.Now(), Message: msg})
+	if len(s.RecentErrors) > maxRecentErrors {
+		s.RecentErrors = s.RecentErrors[len(s.RecentErrors)-maxRecentErrors:]
+	}
+}
+
+func (m *Monitor) saveLocked() {
+	if m.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(StatusReport{
+		UpdatedAt: time.Now(),
+		PID:       os.Getpid(),
+		Channels:  m.snapshotLocked(),
+	}, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		log.Printf("Failed to save channel status: %v", err)
+		return
+	}
+	tmp := m.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("Failed to save channel status: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		log.Printf("Failed to save channel status: %v", err)
+	}
+}
+
+// LoadStatusReport reads a snapshot written by a Monitor.
+func LoadStatusReport(path string) (*StatusReport, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report StatusReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
@@ -1,8 +1,11 @@
 package channels
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -15,20 +18,27 @@ import (
 // TelegramChannel implements the Telegram channel.
 type TelegramChannel struct {
 	BaseChannel
-	Config *config.TelegramConfig
-	bot    *tgbotapi.BotAPI
-	running bool
+	Config    *config.TelegramConfig
+	Workspace string
+	bot       *tgbotapi.BotAPI
+	running   bool
+	allow     *telegramAllowList
 }
 
+// telegramMaxDownload is the Bot API limit for files fetched with getFile.
+const telegramMaxDownload = 20 * 1024 * 1024
+
 // NewTelegramChannel creates a new TelegramChannel.
-func NewTelegramChannel(cfg *config.TelegramConfig, messageBus *bus.MessageBus) *TelegramChannel {
+func NewTelegramChannel(cfg *config.TelegramConfig, messageBus *bus.MessageBus, workspace string) *TelegramChannel {
 	return &TelegramChannel{
 		BaseChannel: BaseChannel{
 			Config:    cfg,
 			Bus:       messageBus,
 			AllowFrom: cfg.AllowFrom,
 		},
-		Config: cfg,
+		Config:    cfg,
+		Workspace: workspace,
+		allow:     newTelegramAllowList(cfg.AllowFrom),
 	}
 }
 
@@ -89,6 +99,14 @@ func (c *TelegramChannel) Send(msg bus.OutboundMessage) error {
 		return fmt.Errorf("invalid chat ID: %s", msg.ChatID)
 	}
 
+	if msg.Stream != nil && (msg.Type == bus.MessageTypeText || msg.Type == "") {
+		ids, err := c.sendStream(chatID, msg.Stream)
+		for _, id := range ids {
+			c.Bus.RecordSent(msg, strconv.Itoa(id))
+		}
+		return err
+	}
+
 	content := msg.Content
 	if msg.Stream != nil {
 		var sb strings.Builder
@@ -99,7 +117,7 @@ func (c *TelegramChannel) Send(msg bus.OutboundMessage) error {
 	}
 
 	switch msg.Type {
-	case bus.MessageTypeImage, bus.MessageTypeAudio, bus.MessageTypeVideo:
+	case bus.MessageTypeImage, bus.MessageTypeAudio, bus.MessageTypeVideo, bus.MessageTypeFile:
 		if msg.Media == "" {
 			return fmt.Errorf("media path/url is empty")
 		}
@@ -128,24 +146,112 @@ func (c *TelegramChannel) Send(msg bus.OutboundMessage) error {
 			v := tgbotapi.NewVideo(chatID, file)
 			v.Caption = content
 			msgConfig = v
+		case bus.MessageTypeFile:
+			d := tgbotapi.NewDocument(chatID, file)
+			d.Caption = content
+			msgConfig = d
 		}
 
-		_, err = c.bot.Send(msgConfig)
-		return err
+		sent, err := c.bot.Send(msgConfig)
+		if err != nil {
+			return err
+		}
+		c.Bus.RecordSent(msg, strconv.Itoa(sent.MessageID))
+		return nil
 
 	default:
 		// Default to text or if explicitly text
 		if content == "" {
 			return nil
 		}
-		reply := tgbotapi.NewMessage(chatID, content)
-		_, err = c.bot.Send(reply)
+		for _, chunk := range splitMarkdown(content, telegramMaxMessage) {
+			id, err := c.sendText(chatID, chunk)
+			if err != nil {
+				return err
+			}
+			c.Bus.RecordSent(msg, strconv.Itoa(id))
+		}
+		return nil
+	}
+}
+
+// sendText sends Markdown text as Telegram HTML, or as plain text when
+// HTML is turned off or Telegram rejects the converted markup, and
+// returns the ID of the sent message.
+func (c *TelegramChannel) sendText(chatID int64, text string) (int, error) {
+	if c.Config.ParseMode != "plain" {
+		reply := tgbotapi.NewMessage(chatID, markdownToTelegramHTML(text))
+		reply.ParseMode = tgbotapi.ModeHTML
+		sent, err := c.bot.Send(reply)
+		var apiErr *tgbotapi.Error
+		if err == nil || !errors.As(err, &apiErr) || apiErr.Code != http.StatusBadRequest {
+			return sent.MessageID, err
+		}
+		log.Printf("Telegram: HTML message rejected (%s), sending as plain text", apiErr.Message)
+	}
+	sent, err := c.bot.Send(tgbotapi.NewMessage(chatID, text))
+	return sent.MessageID, err
+}
+
+// EditMessage replaces the text of a sent message, rendered like a reply.
+func (c *TelegramChannel) EditMessage(chatID, messageID, content string) error {
+	chat, id, err := c.messageRef(chatID, messageID)
+	if err != nil {
 		return err
 	}
+	if len([]rune(content)) > telegramMaxMessage {
+		return fmt.Errorf("message is longer than Telegram's %d characters", telegramMaxMessage)
+	}
+	if c.Config.ParseMode != "plain" {
+		edit := tgbotapi.NewEditMessageText(chat, id, markdownToTelegramHTML(content))
+		edit.ParseMode = tgbotapi.ModeHTML
+		_, err := c.bot.Request(edit)
+		var apiErr *tgbotapi.Error
+		if err == nil || !errors.As(err, &apiErr) || apiErr.Code != http.StatusBadRequest || isNotModified(err) {
+			return ignoreNotModified(err)
+		}
+		log.Printf("Telegram: HTML edit rejected (%s), editing as plain text", apiErr.Message)
+	}
+	_, err = c.bot.Request(tgbotapi.NewEditMessageText(chat, id, content))
+	return ignoreNotModified(err)
+}
+
+// DeleteMessage deletes a sent message. Telegram only allows this for
+// messages less than 48 hours old.
+func (c *TelegramChannel) DeleteMessage(chatID, messageID string) error {
+	chat, id, err := c.messageRef(chatID, messageID)
+	if err != nil {
+		return err
+	}
+	_, err = c.bot.Request(tgbotapi.NewDeleteMessage(chat, id))
+	return err
+}
+
+// messageRef parses the chat and message IDs of a sent message.
+func (c *TelegramChannel) messageRef(chatID, messageID string) (int64, int, error) {
+	if c.bot == nil {
+		return 0, 0, fmt.Errorf("telegram bot not initialized")
+	}
+	chat, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid chat ID: %s", chatID)
+	}
+	id, err := strconv.Atoi(messageID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid message ID: %s", messageID)
+	}
+	return chat, id, nil
 }
 
 func (c *TelegramChannel) handleUpdate(update tgbotapi.Update) {
 	msg := update.Message
+	if !c.allow.allows(msg) {
+		logTelegramDenied(msg)
+		return
+	}
+	if msg.From == nil {
+		return
+	}
 	senderID := strconv.FormatInt(msg.From.ID, 10)
 	if msg.From.UserName != "" {
 		senderID = fmt.Sprintf("%s|%s", senderID, msg.From.UserName)
@@ -171,6 +277,16 @@ func (c *TelegramChannel) handleUpdate(update tgbotapi.Update) {
 		content = "[Photo received]" // Download logic omitted for brevity
 	} else if msg.Voice != nil {
 		content = "[Voice received]"
+	} else if msg.Document != nil {
+		if path, err := c.downloadDocument(msg.Document); err != nil {
+			log.Printf("Telegram: failed to download %s: %v", msg.Document.FileName, err)
+			content = strings.TrimSpace(content + "\n[File received: " + msg.Document.FileName + " (download failed)]")
+		} else {
+			media = append(media, path)
+			if content == "" {
+				content = "[File received: " + msg.Document.FileName + "]"
+			}
+		}
 	}
 
 	if content == "" {
@@ -182,6 +298,35 @@ func (c *TelegramChannel) handleUpdate(update tgbotapi.Update) {
 		"username":   msg.From.UserName,
 		"first_name": msg.From.FirstName,
 	}
+	if msg.Chat.IsGroup() || msg.Chat.IsSuperGroup() || msg.Chat.IsChannel() {
+		metadata["group"] = true
+	}
 
-	c.HandleMessage(c.Name(), senderID, chatID, content, media, metadata)
+	// allowFrom was checked above, with usernames and group chats
+	c.Monitor.RecordInbound(c.Name())
+	c.Bus.PublishInbound(bus.InboundMessage{
+		Channel:  c.Name(),
+		SenderID: senderID,
+		ChatID:   chatID,
+		Content:  content,
+		Media:    media,
+		Metadata: metadata,
+	})
+}
+
+// downloadDocument saves a document sent by the user under workspace/uploads/telegram.
+func (c *TelegramChannel) downloadDocument(doc *tgbotapi.Document) (string, error) {
+	if doc.FileSize > telegramMaxDownload {
+		return "", fmt.Errorf("file too large (%d bytes)", doc.FileSize)
+	}
+	url, err := c.bot.GetFileDirectURL(doc.FileID)
+	if err != nil {
+		return "", err
+	}
+	name := doc.FileName
+	if name == "" {
+		name = doc.FileUniqueID
+	}
+	dir := filepath.Join(c.Workspace, "uploads", "telegram")
+	return utils.DownloadMedia(url, dir, doc.FileUniqueID+"_"+name, telegramMaxDownload)
 }
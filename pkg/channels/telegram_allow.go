@@ -0,0 +1,87 @@
+package channels
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// telegramAllowList is the parsed allowFrom of the Telegram channel. An
+// entry is a user ID, a username (with or without "@", any case) or a
+// group chat ID, which is negative. Entries written as "id|username", the
+// form of Telegram sender IDs, count as both.
+type telegramAllowList struct {
+	users     map[int64]bool
+	usernames map[string]bool
+	chats     map[int64]bool
+}
+
+func newTelegramAllowList(entries []string) *telegramAllowList {
+	if len(entries) == 0 {
+		return nil
+	}
+	a := &telegramAllowList{
+		users:     map[int64]bool{},
+		usernames: map[string]bool{},
+		chats:     map[int64]bool{},
+	}
+	for _, entry := range entries {
+		for _, part := range strings.Split(entry, "|") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			if id, err := strconv.ParseInt(part, 10, 64); err == nil {
+				if id < 0 {
+					a.chats[id] = true
+				} else {
+					a.users[id] = true
+				}
+				continue
+			}
+			a.usernames[normalizeTelegramUsername(part)] = true
+		}
+	}
+	return a
+}
+
+// allows reports whether a message may reach the agent: its sender is
+// listed by ID or username, or it was sent in a listed group, where
+// everyone may talk to the bot. Without an allowFrom everyone may.
+func (a *telegramAllowList) allows(msg *tgbotapi.Message) bool {
+	if a == nil {
+		return true
+	}
+	if a.chats[msg.Chat.ID] {
+		return true
+	}
+	if msg.From == nil {
+		return false
+	}
+	if a.users[msg.From.ID] {
+		return true
+	}
+	return msg.From.UserName != "" && a.usernames[normalizeTelegramUsername(msg.From.UserName)]
+}
+
+func normalizeTelegramUsername(name string) string {
+	return strings.ToLower(strings.TrimPrefix(name, "@"))
+}
+
+// logTelegramDenied explains a rejected message with the IDs that would allow it.
+func logTelegramDenied(msg *tgbotapi.Message) {
+	from := "unknown sender"
+	if msg.From != nil {
+		from = strconv.FormatInt(msg.From.ID, 10)
+		if msg.From.UserName != "" {
+			from += " (@" + msg.From.UserName + ")"
+		}
+	}
+	if msg.Chat.IsGroup() || msg.Chat.IsSuperGroup() {
+		log.Printf("Telegram: ignoring message from %s in group %d: neither is in allowFrom", from, msg.Chat.ID)
+		return
+	}
+	log.Printf("Telegram: ignoring message from %s: not in allowFrom", from)
+}
@@ -0,0 +1,250 @@
+package channels
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// telegramMaxMessage is the most characters (UTF-16 code units) Telegram
+// accepts in one text message.
+const telegramMaxMessage = 4096
+
+var (
+	mdFence       = regexp.MustCompile("^\\s*(```|~~~)\\s*([\\w+#.-]*)\\s*$")
+	mdHeading     = regexp.MustCompile(`^#{1,6}\s+(.+?)\s*#*\s*$`)
+	mdQuote       = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	mdBullet      = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdRule        = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	mdCode        = regexp.MustCompile("`([^`]+)`")
+	mdLink        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	mdBold        = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	mdBoldUnder   = regexp.MustCompile(`(^|[^\p{L}\p{N}_])__(.+?)__([^\p{L}\p{N}_]|$)`)
+	mdStrike      = regexp.MustCompile(`~~(.+?)~~`)
+	mdItalic      = regexp.MustCompile(`(^|[^\p{L}\p{N}*])\*([^*\s](?:[^*]*[^*\s])?)\*([^\p{L}\p{N}*]|$)`)
+	mdItalicUnd   = regexp.MustCompile(`(^|[^\p{L}\p{N}_])_([^_\s](?:[^_]*[^_\s])?)_([^\p{L}\p{N}_]|$)`)
+	mdPlaceholder = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// markdownToTelegramHTML converts the Markdown models write to the HTML
+// subset Telegram renders: bold, italic, strikethrough, inline code, code
+// blocks, links and block quotes. Headings become bold lines and bullets
+// "•". Everything else is escaped, so unbalanced or unusual Markdown
+// comes out as literal text rather than markup.
+func markdownToTelegramHTML(text string) string {
+	var out []string
+	var code []string // lines of the open code block
+	var quote []string
+	inCode, lang := false, ""
+
+	flushQuote := func() {
+		if len(quote) > 0 {
+			out = append(out, "<blockquote>"+strings.Join(quote, "\n")+"</blockquote>")
+			quote = nil
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			if !inCode {
+				flushQuote()
+				inCode, lang, code = true, m[2], nil
+				continue
+			}
+			if m[2] == "" {
+				out = append(out, telegramPre(code, lang))
+				inCode = false
+				continue
+			}
+		}
+		if inCode {
+			code = append(code, line)
+			continue
+		}
+		if m := mdQuote.FindStringSubmatch(line); m != nil {
+			quote = append(quote, inlineMarkdownToHTML(m[1]))
+			continue
+		}
+		flushQuote()
+
+		switch {
+		case mdRule.MatchString(line):
+			out = append(out, "──────────")
+		case mdHeading.MatchString(line):
+			out = append(out, "<b>"+inlineMarkdownToHTML(mdHeading.FindStringSubmatch(line)[1])+"</b>")
+		case mdBullet.MatchString(line):
+			m := mdBullet.FindStringSubmatch(line)
+			out = append(out, m[1]+"• "+inlineMarkdownToHTML(m[2]))
+		default:
+			out = append(out, inlineMarkdownToHTML(line))
+		}
+	}
+	flushQuote()
+	if inCode {
+		// An unclosed block runs to the end, as Markdown renders it
+		out = append(out, telegramPre(code, lang))
+	}
+	return strings.Join(out, "\n")
+}
+
+func telegramPre(lines []string, lang string) string {
+	body := escapeTelegramHTML(strings.Join(lines, "\n"))
+	if lang != "" {
+		return `<pre><code class="language-` + escapeTelegramHTML(lang) + `">` + body + "</code></pre>"
+	}
+	return "<pre>" + body + "</pre>"
+}
+
+// inlineMarkdownToHTML converts the inline Markdown of one line.
+func inlineMarkdownToHTML(line string) string {
+	line = escapeTelegramHTML(line)
+
+	// Code spans and links are set aside so their contents are not formatted
+	var held []string
+	hold := func(s string) string {
+		held = append(held, s)
+		return "\x00" + strconv.Itoa(len(held)-1) + "\x00"
+	}
+	line = mdCode.ReplaceAllStringFunc(line, func(s string) string {
+		return hold("<code>" + mdCode.FindStringSubmatch(s)[1] + "</code>")
+	})
+	line = mdLink.ReplaceAllStringFunc(line, func(s string) string {
+		m := mdLink.FindStringSubmatch(s)
+		return hold(`<a href="` + strings.ReplaceAll(m[2], `"`, "&quot;") + `">` + m[1] + "</a>")
+	})
+
+	line = mdBold.ReplaceAllString(line, "<b>$1</b>")
+	line = replaceBounded(mdBoldUnder, line, "$1<b>$2</b>$3")
+	line = mdStrike.ReplaceAllString(line, "<s>$1</s>")
+	line = replaceBounded(mdItalic, line, "$1<i>$2</i>$3")
+	line = replaceBounded(mdItalicUnd, line, "$1<i>$2</i>$3")
+
+	// Restore twice: a link's text may hold a code span
+	for i := 0; i < 2; i++ {
+		line = mdPlaceholder.ReplaceAllStringFunc(line, func(s string) string {
+			n, _ := strconv.Atoi(mdPlaceholder.FindStringSubmatch(s)[1])
+			return held[n]
+		})
+	}
+	return line
+}
+
+// replaceBounded replaces matches of a pattern that also matches the
+// characters around them. Adjacent matches share a boundary character, so
+// it repeats until nothing changes.
+func replaceBounded(re *regexp.Regexp, s, repl string) string {
+	for i := 0; i < 4; i++ {
+		next := re.ReplaceAllString(s, repl)
+		if next == s {
+			break
+		}
+		s = next
+	}
+	return s
+}
+
+// escapeTelegramHTML escapes the characters Telegram's HTML parse mode reserves.
+func escapeTelegramHTML(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// telegramLen counts s as Telegram does, in UTF-16 code units.
+func telegramLen(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// splitMarkdown splits Markdown text into chunks of at most limit
+// characters, breaking between lines where it can. A code block cut by a
+// break is closed at the end of one chunk and reopened in the next.
+func splitMarkdown(text string, limit int) []string {
+	if telegramLen(text) <= limit {
+		return []string{text}
+	}
+
+	var chunks []string
+	var cur strings.Builder
+	curLen := 0
+	fence := "" // opening line of the code block at the end of cur
+
+	flush := func() {
+		if curLen == 0 {
+			return
+		}
+		s := strings.TrimRight(cur.String(), "\n")
+		if fence != "" {
+			s += "\n" + fence[:3]
+		}
+		chunks = append(chunks, s)
+		cur.Reset()
+		curLen = 0
+		if fence != "" {
+			cur.WriteString(fence + "\n")
+			curLen = telegramLen(fence) + 1
+		}
+	}
+	// Room kept free for closing a code block
+	const closing = len("\n```")
+
+	for _, line := range strings.Split(text, "\n") {
+		for _, piece := range splitLongLine(line, limit-closing-telegramLen(fence)-1) {
+			n := telegramLen(piece) + 1
+			if curLen+n+closing > limit {
+				flush()
+			}
+			cur.WriteString(piece + "\n")
+			curLen += n
+		}
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			if fence == "" {
+				fence = strings.TrimSpace(line)
+			} else if m[2] == "" {
+				fence = ""
+			}
+		}
+	}
+	fence = ""
+	flush()
+	return chunks
+}
+
+// splitLongLine cuts a line longer than limit characters, at spaces where
+// possible.
+func splitLongLine(line string, limit int) []string {
+	if limit < 1 {
+		limit = 1
+	}
+	var pieces []string
+	for telegramLen(line) > limit {
+		cut, n := 0, 0
+		lastSpace := -1
+		for i, r := range line {
+			w := 1
+			if r >= 0x10000 {
+				w = 2
+			}
+			if n+w > limit {
+				break
+			}
+			n += w
+			cut = i + utf8.RuneLen(r)
+			if r == ' ' {
+				lastSpace = cut
+			}
+		}
+		if lastSpace > 0 && lastSpace > cut/2 {
+			cut = lastSpace
+		}
+		pieces = append(pieces, line[:cut])
+		line = line[cut:]
+	}
+	return append(pieces, line)
+}
@@ -0,0 +1,177 @@
+package channels
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// telegramStreamInterval is the default time between edits of a streamed
+// reply. Telegram allows about one message a second per chat, and 20 a
+// minute in groups, where the interval is tripled.
+const telegramStreamInterval = time.Second
+
+// telegramStream shows a streamed reply as it arrives by sending it and
+// then editing the sent messages, one message per 4096-character chunk.
+// Partial text is sent plain, since its Markdown may be unbalanced; the
+// final edit renders it like any other reply.
+type telegramStream struct {
+	c          *TelegramChannel
+	chatID     int64
+	sent       []telegramStreamMessage
+	pauseUntil time.Time // Telegram asked to slow down until then
+}
+
+type telegramStreamMessage struct {
+	id   int
+	text string
+}
+
+// sendStream sends a streamed text reply with throttled edits and returns
+// the IDs of the messages it ended up in.
+func (c *TelegramChannel) sendStream(chatID int64, stream <-chan string) ([]int, error) {
+	interval := time.Duration(c.Config.StreamInterval) * time.Millisecond
+	if interval <= 0 {
+		interval = telegramStreamInterval
+	}
+	if chatID < 0 {
+		interval *= 3
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s := &telegramStream{c: c, chatID: chatID}
+	var sb strings.Builder
+	pending := false
+	for {
+		select {
+		case chunk, ok := <-stream:
+			if !ok {
+				err := s.finish(sb.String())
+				ids := make([]int, len(s.sent))
+				for i, m := range s.sent {
+					ids[i] = m.id
+				}
+				return ids, err
+			}
+			sb.WriteString(chunk)
+			pending = true
+		case <-ticker.C:
+			if pending && time.Now().After(s.pauseUntil) {
+				s.update(sb.String())
+				pending = false
+			}
+		}
+	}
+}
+
+// update shows the text received so far. Failures are logged: the final
+// edit makes up for a missed update.
+func (s *telegramStream) update(text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	for i, chunk := range splitMarkdown(text, telegramMaxMessage) {
+		var err error
+		if i < len(s.sent) {
+			if s.sent[i].text == chunk {
+				continue
+			}
+			_, err = s.c.bot.Request(tgbotapi.NewEditMessageText(s.chatID, s.sent[i].id, chunk))
+			if err == nil {
+				s.sent[i].text = chunk
+			}
+		} else {
+			var m tgbotapi.Message
+			m, err = s.c.bot.Send(tgbotapi.NewMessage(s.chatID, chunk))
+			if err == nil {
+				s.sent = append(s.sent, telegramStreamMessage{id: m.MessageID, text: chunk})
+			}
+		}
+		if err != nil {
+			if wait := telegramRetryAfter(err); wait > 0 {
+				s.pauseUntil = time.Now().Add(wait)
+			}
+			log.Printf("Telegram: stream update failed: %v", err)
+			return
+		}
+	}
+}
+
+// finish edits the sent messages to the complete reply, rendered, and
+// sends whatever did not fit in them.
+func (s *telegramStream) finish(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	if wait := time.Until(s.pauseUntil); wait > 0 {
+		time.Sleep(wait)
+	}
+	for i, chunk := range splitMarkdown(text, telegramMaxMessage) {
+		err := s.finishChunk(i, chunk)
+		if wait := telegramRetryAfter(err); wait > 0 {
+			time.Sleep(wait)
+			err = s.finishChunk(i, chunk)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *telegramStream) finishChunk(i int, chunk string) error {
+	if i >= len(s.sent) {
+		id, err := s.c.sendText(s.chatID, chunk)
+		if err == nil {
+			s.sent = append(s.sent, telegramStreamMessage{id: id, text: chunk})
+		}
+		return err
+	}
+	msg := s.sent[i]
+	if s.c.Config.ParseMode != "plain" {
+		edit := tgbotapi.NewEditMessageText(s.chatID, msg.id, markdownToTelegramHTML(chunk))
+		edit.ParseMode = tgbotapi.ModeHTML
+		_, err := s.c.bot.Request(edit)
+		var apiErr *tgbotapi.Error
+		if err == nil || !errors.As(err, &apiErr) || apiErr.Code != http.StatusBadRequest || isNotModified(err) {
+			return ignoreNotModified(err)
+		}
+		log.Printf("Telegram: HTML edit rejected (%s), keeping plain text", apiErr.Message)
+	}
+	if msg.text == chunk {
+		return nil
+	}
+	_, err := s.c.bot.Request(tgbotapi.NewEditMessageText(s.chatID, msg.id, chunk))
+	return ignoreNotModified(err)
+}
+
+// telegramRetryAfter returns how long Telegram asked to wait after a
+// flood-control error, or 0 for other errors.
+func telegramRetryAfter(err error) time.Duration {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusTooManyRequests {
+		if apiErr.RetryAfter > 0 {
+			return time.Duration(apiErr.RetryAfter) * time.Second
+		}
+		return time.Second
+	}
+	return 0
+}
+
+// isNotModified reports whether an edit failed because the message already
+// had that text, which is harmless.
+func isNotModified(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "message is not modified")
+}
+
+func ignoreNotModified(err error) error {
+	if isNotModified(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/config"
+)
+
+// Transcriber turns voice messages into text with an OpenAI-compatible
+// speech-to-text endpoint.
+type Transcriber struct {
+	Config config.TranscriptionConfig
+	client *http.Client
+}
+
+// NewTranscriber creates a new Transcriber.
+func NewTranscriber(cfg config.TranscriptionConfig) *Transcriber {
+	return &Transcriber{
+		Config: cfg,
+		client: &http.Client{Timeout: 120 * time.Second},
+	}
+}
+
+// Transcribe returns the text spoken in the audio file at path.
+func (t *Transcriber) Transcribe(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return "", err
+	}
+	form.WriteField("model", t.Config.Model)
+	form.WriteField("response_format", "json")
+	if t.Config.Language != "" {
+		form.WriteField("language", t.Config.Language)
+	}
+	form.Close()
+
+	url := strings.TrimRight(t.Config.APIBase, "/") + "/audio/transcriptions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if t.Config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Config.APIKey)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("transcription API returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("invalid transcription response: %w", err)
+	}
+	return strings.TrimSpace(result.Text), nil
+}
@@ -2,8 +2,8 @@ package config
 
 import (
 	"encoding/json"
+	"io/ioutil"
 	"os"
-	"path/filepath"
 )
 
 type WhatsAppConfig struct {
@@ -17,6 +17,12 @@ type TelegramConfig struct {
 	Token     string   `json:"token"`
 	AllowFrom []string `json:"allowFrom"`
 	Proxy     string   `json:"proxy,omitempty"`
+	// ParseMode is "html" (default) to render the Markdown in replies, or
+	// "plain" to send it as written.
+	ParseMode string `json:"parseMode,omitempty"`
+	// StreamInterval is the time in milliseconds between edits of a
+	// streamed reply (default 1000, tripled in groups).
+	StreamInterval int `json:"streamInterval,omitempty"`
 }
 
 type FeishuConfig struct {
@@ -26,6 +32,14 @@ type FeishuConfig struct {
 	EncryptKey        string   `json:"encryptKey"`
 	VerificationToken string   `json:"verificationToken"`
 	AllowFrom         []string `json:"allowFrom"`
+	// Mode is how events are received: "websocket", the long connection
+	// (the default), or "webhook", posted by Feishu to the gateway at
+	// WebhookPath (default /feishu/events).
+	Mode        string `json:"mode,omitempty"`
+	WebhookPath string `json:"webhookPath,omitempty"`
+	// RequireMention makes the bot answer in group chats only when it is
+	// @-mentioned; other group messages are kept as context for later replies.
+	RequireMention bool `json:"requireMention,omitempty"`
 }
 
 type DingTalkConfig struct {
@@ -35,6 +49,8 @@ type DingTalkConfig struct {
 	RobotCode  string   `json:"robotCode"`
 	TemplateID string   `json:"templateId"`
 	AllowFrom  []string `json:"allowFrom"`
+	// GroupTemplateID is the scene group template used by the dingtalk_group tool.
+	GroupTemplateID string `json:"groupTemplateId,omitempty"`
 }
 
 type ChannelsConfig struct {
@@ -42,6 +58,96 @@ type ChannelsConfig struct {
 	Telegram TelegramConfig `json:"telegram"`
 	Feishu   FeishuConfig   `json:"feishu"`
 	DingTalk DingTalkConfig `json:"dingtalk"`
+	// Federation links this nanobot to other instances through their gateways.
+	Federation FederationConfig `json:"federation"`
+	// Webhook lets any system talk to the agent over HTTP.
+	Webhook WebhookConfig `json:"webhook"`
+	// Format adjusts outgoing messages per channel name ("dingtalk", "web", ...).
+	Format map[string]OutboundFormat `json:"format,omitempty"`
+	// RateLimit paces and retries outgoing messages per channel name. An
+	// entry replaces the channel's defaults.
+	RateLimit map[string]RateLimit `json:"rateLimit,omitempty"`
+	// FileFallback sends text replies longer than this many characters on
+	// a channel as a file attachment, after a message with their start;
+	// 0 sends them as messages.
+	FileFallback map[string]int `json:"fileFallback,omitempty"`
+	// Transcription turns voice messages into text before they reach the agent.
+	Transcription TranscriptionConfig `json:"transcription"`
+}
+
+// TranscriptionConfig is an OpenAI-compatible speech-to-text endpoint
+// (POST {apiBase}/audio/transcriptions), such as Whisper.
+type TranscriptionConfig struct {
+	Enabled bool   `json:"enabled"`
+	APIKey  string `json:"apiKey"`
+	APIBase string `json:"apiBase"`
+	Model   string `json:"model"`
+	// Language is an ISO-639-1 hint such as "zh"; empty lets the model detect it.
+	Language string `json:"language,omitempty"`
+}
+
+// FederationConfig lets nanobot instances delegate tasks to each other.
+// Each peer appears to the other as a chat on the "federation" channel.
+type FederationConfig struct {
+	Enabled bool `json:"enabled"`
+	// Name is how this instance identifies itself to its peers, which must
+	// list it under that name.
+	Name  string                `json:"name"`
+	Peers map[string]PeerConfig `json:"peers,omitempty"`
+}
+
+// WebhookConfig is the "webhook" channel: other systems post messages to
+// the gateway's /api/webhook/message and get the replies in the response,
+// or posted to CallbackURL.
+type WebhookConfig struct {
+	Enabled bool `json:"enabled"`
+	// Token is required as a bearer token on every request.
+	Token string `json:"token"`
+	// CallbackURL receives replies to requests that do not wait for them,
+	// and those sent later, such as reminders.
+	CallbackURL string `json:"callbackUrl,omitempty"`
+	// CallbackToken, if set, is sent as a bearer token to CallbackURL.
+	CallbackToken string `json:"callbackToken,omitempty"`
+	// Timeout is how many seconds a request waits for the agent to finish.
+	Timeout int `json:"timeout"`
+}
+
+// PeerConfig is another nanobot instance.
+type PeerConfig struct {
+	URL string `json:"url"` // The peer's gateway, e.g. "https://office.example.com:18790"
+	// Token is a secret shared with the peer: sent with messages to it and
+	// required on messages from it.
+	Token string `json:"token"`
+	// Description tells the agent what the peer is good for.
+	Description string `json:"description,omitempty"`
+}
+
+// RateLimit paces a channel's outgoing messages and retries failed sends.
+type RateLimit struct {
+	// Rate is the most messages a second on the channel and ChatRate the
+	// most to a single chat; 0 is unlimited. Up to Burst messages may go
+	// out at once before the rates apply.
+	Rate     float64 `json:"rate,omitempty"`
+	ChatRate float64 `json:"chatRate,omitempty"`
+	Burst    int     `json:"burst,omitempty"`
+	// MaxRetries is how many times a send failing with a transient error
+	// (rate limited, server or network error) is retried. The first retry
+	// waits Backoff milliseconds (default 1000), doubling each time.
+	MaxRetries int `json:"maxRetries,omitempty"`
+	Backoff    int `json:"backoff,omitempty"`
+}
+
+// OutboundFormat adds fixed text to, and tidies, a channel's outgoing
+// messages without touching the persona.
+type OutboundFormat struct {
+	Prefix    string `json:"prefix,omitempty"`
+	Suffix    string `json:"suffix,omitempty"`
+	Signature string `json:"signature,omitempty"` // Appended on its own line
+	// Scope is "all" (default), "group" or "direct". Group chats are
+	// recognized on DingTalk and Telegram.
+	Scope      string            `json:"scope,omitempty"`
+	StripEmoji bool              `json:"stripEmoji,omitempty"`
+	Replace    map[string]string `json:"replace,omitempty"` // Literal text replacements
 }
 
 type AgentDefaults struct {
@@ -51,15 +157,176 @@ type AgentDefaults struct {
 	MaxTokens         int     `json:"maxTokens"`
 	Temperature       float64 `json:"temperature"`
 	MaxToolIterations int     `json:"maxToolIterations"`
+	// MaxInlineFileBytes is the largest text file attachment inlined into the
+	// user message. Larger files are passed by path only; 0 disables inlining.
+	MaxInlineFileBytes int `json:"maxInlineFileBytes"`
+	// RemoteImages controls image URLs in inbound media: "off" (the
+	// default), "fetch" (download from public addresses up to
+	// MaxRemoteImageBytes and inline) or "url" (let the provider fetch them).
+	RemoteImages        string       `json:"remoteImages"`
+	MaxRemoteImageBytes int          `json:"maxRemoteImageBytes"`
+	Stream              StreamConfig `json:"stream"`
+	// Verbosity is the default reply style: short, normal or detailed.
+	// MaxReplyChars truncates longer replies and offers the rest on /more;
+	// 0 means unlimited. Both can be changed per chat with /verbosity and /maxlen.
+	Verbosity     string `json:"verbosity"`
+	MaxReplyChars int    `json:"maxReplyChars"`
+	// ReplyLanguage is "auto" to answer in the language of each user message,
+	// "off", or a fixed language such as "Chinese". Chats override it with /lang.
+	ReplyLanguage string `json:"replyLanguage"`
+	// TurnTimeout bounds a whole turn (model calls and tools) in seconds; 0 disables it.
+	TurnTimeout int `json:"turnTimeout"`
+	// MaxRequestBytes and MaxRequestMessages bound a chat completions request
+	// (messages and tool definitions, as JSON). Larger requests are compacted
+	// before sending; 0 disables a limit.
+	MaxRequestBytes    int `json:"maxRequestBytes"`
+	MaxRequestMessages int `json:"maxRequestMessages"`
+	// HistoryTokenBudget is the estimated token size of chat history sent
+	// each turn. Older turns beyond it are summarized into the session and
+	// the summary is sent instead; 0 keeps the last HistoryMessages verbatim.
+	HistoryTokenBudget int `json:"historyTokenBudget"`
+	// HistoryMessages is the most history messages sent verbatim each turn.
+	HistoryMessages int `json:"historyMessages"`
+	// ChannelHistory overrides the history limits per channel name, e.g.
+	// a bigger window for group chats on "dingtalk".
+	ChannelHistory map[string]HistoryConfig `json:"channelHistory,omitempty"`
+	// ContextWindows sets the context window in tokens per model name or
+	// name prefix, e.g. {"gpt-4o": 128000}. Well-known models have built-in
+	// sizes; ContextWindow applies to the rest, 0 meaning no limit. Prompts
+	// estimated to exceed the window minus MaxTokens are trimmed before sending.
+	ContextWindows map[string]int `json:"contextWindows,omitempty"`
+	ContextWindow  int            `json:"contextWindow"`
+	// SkillSuggestions drafts skills for the tool sequences the agent
+	// keeps repeating.
+	SkillSuggestions SkillSuggestConfig `json:"skillSuggestions"`
+}
+
+// SkillSuggestConfig controls skill suggestions: when the same sequence of
+// tool runs has made up a turn on MinDays different days within the last
+// WindowDays, a SKILL.md for it is drafted and offered to the chat.
+type SkillSuggestConfig struct {
+	Enabled    bool `json:"enabled"`
+	MinDays    int  `json:"minDays"`
+	WindowDays int  `json:"windowDays"`
+}
+
+// StreamConfig controls how streamed reply deltas are batched before they
+// reach the channels. A chunk is flushed once it holds MinChars characters
+// (cut at a sentence boundary when possible) or after FlushIntervalMs.
+// Both 0 forwards every delta as-is.
+//
+// On StatusChannels the reply card is opened as soon as a turn starts and
+// shows what the agent is doing until the reply begins, refreshed every
+// StatusInterval seconds.
+type StreamConfig struct {
+	MinChars        int      `json:"minChars"`
+	FlushIntervalMs int      `json:"flushIntervalMs"`
+	StatusChannels  []string `json:"statusChannels"`
+	StatusInterval  int      `json:"statusInterval"`
+}
+
+// SubagentsConfig controls background subagents started with the spawn tool.
+type SubagentsConfig struct {
+	// MaxConcurrent caps subagents running at once; further spawns wait in a
+	// queue of up to MaxQueued tasks. 0 means no limit.
+	MaxConcurrent int `json:"maxConcurrent"`
+	MaxQueued     int `json:"maxQueued"`
+	// Budgets for a single subagent. A subagent that hits one stops and
+	// reports what it has so far. Timeout is in seconds; 0 disables a limit.
+	MaxIterations int `json:"maxIterations"`
+	Timeout       int `json:"timeout"`
+	MaxTokens     int `json:"maxTokens"`
+	// DedupWindow is how many seconds a spawned task answers identical spawns
+	// from the same chat instead of a duplicate being started.
+	DedupWindow int `json:"dedupWindow"`
+	// ProgressInterval is the most often, in seconds, that a running
+	// subagent posts what it is doing to the chat that spawned it; it also
+	// says it is still working after that long without an update. 0 is silent.
+	ProgressInterval int `json:"progressInterval"`
 }
 
 type AgentsConfig struct {
-	Defaults AgentDefaults `json:"defaults"`
+	Defaults  AgentDefaults   `json:"defaults"`
+	Subagents SubagentsConfig `json:"subagents"`
+	Coding    CodingConfig    `json:"coding"`
+	Research  ResearchConfig  `json:"research"`
+	// Profiles are named sets of overrides for some chats, such as a work
+	// group that gets a formal persona on a stronger model.
+	Profiles map[string]ProfileConfig `json:"profiles,omitempty"`
+	// Named are agents besides the default one, by name. Messages reach
+	// them through the chats they are given or by starting with @name.
+	Named map[string]NamedAgentConfig `json:"named,omitempty"`
+}
+
+// NamedAgentConfig is an agent with its own workspace, and so its own
+// SOUL.md, memory and sessions. Other settings are the defaults'.
+type NamedAgentConfig struct {
+	Description string `json:"description,omitempty"`
+	// Workspace defaults to agents/<name> in the default workspace.
+	Workspace string `json:"workspace,omitempty"`
+	Model     string `json:"model,omitempty"`
+	// Tools limits the agent to the tools named.
+	Tools []string `json:"tools,omitempty"`
+	// Chats are routed to the agent: "channel" for every chat of a channel
+	// or "channel:chatId" for one, which takes precedence.
+	Chats []string `json:"chats,omitempty"`
+}
+
+// HistoryConfig overrides the chat history sent each turn. A 0 keeps the
+// value it overrides; a negative TokenBudget turns summarizing off.
+type HistoryConfig struct {
+	Messages    int `json:"messages,omitempty"`
+	TokenBudget int `json:"tokenBudget,omitempty"`
+}
+
+// ProfileConfig overrides the agent defaults for the chats it applies to.
+// Empty fields keep the default.
+type ProfileConfig struct {
+	// Chats are the chats the profile applies to: "channel" for every chat
+	// of a channel or "channel:chatId" for one, which takes precedence.
+	// Any chat can also switch to a profile with /profile.
+	Chats       []string `json:"chats,omitempty"`
+	Model       string   `json:"model,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	// Soul is the persona file used instead of SOUL.md, relative to the workspace.
+	Soul string `json:"soul,omitempty"`
+	// Skills limits the skills offered to those named.
+	Skills []string `json:"skills,omitempty"`
+	// History overrides the history limits of the channel and defaults.
+	History *HistoryConfig `json:"history,omitempty"`
+}
+
+// ResearchConfig controls deep research tasks started with the research
+// tool, which plan a report, research it section by section on the web and
+// send it as a Markdown file.
+type ResearchConfig struct {
+	MaxSections int `json:"maxSections"`
+	// SectionIterations caps the search and fetch rounds per section.
+	SectionIterations int `json:"sectionIterations"`
+}
+
+// CodingConfig turns the agent into a coding assistant for one source
+// repository: it adds grep, glob, apply_patch, git and run_tests tools, a
+// repository map in the prompt and stricter instructions for code changes.
+type CodingConfig struct {
+	Enabled bool   `json:"enabled"`
+	Repo    string `json:"repo"` // Path of the repository; exec also runs there
+	// TestCommand runs the tests, e.g. "go test ./..."; detected from the
+	// project files when empty.
+	TestCommand string `json:"testCommand,omitempty"`
+	// MapMaxFiles caps the files listed in the repository map.
+	MapMaxFiles int `json:"mapMaxFiles"`
 }
 
 type ProviderConfig struct {
 	APIKey  string `json:"apiKey"`
 	APIBase string `json:"apiBase,omitempty"`
+	// APIKeys are further keys that requests are spread over along with
+	// APIKey. KeySelection is "round-robin" (default) or "least-errors"; a
+	// key answering 429 or 401 is skipped for KeyCooldown seconds (default 60).
+	APIKeys      []string `json:"apiKeys,omitempty"`
+	KeySelection string   `json:"keySelection,omitempty"`
+	KeyCooldown  int      `json:"keyCooldown,omitempty"`
 }
 
 type ProvidersConfig struct {
@@ -72,11 +339,45 @@ type ProvidersConfig struct {
 	VLLM       ProviderConfig `json:"vllm"`
 	Gemini     ProviderConfig `json:"gemini"`
 	SiliconFlow ProviderConfig `json:"siliconflow"`
+	Fallback    FallbackConfig `json:"fallback"`
+	Retry       RetryConfig    `json:"retry"`
+}
+
+// RetryConfig retries a model request that failed with a rate limit, a
+// server error or a network error, up to MaxAttempts tries in all. The
+// delay starts at InitialDelayMs and doubles up to MaxDelayMs, randomized
+// by Jitter (0.2 is ±20%). A Retry-After longer than MaxDelayMs is not
+// waited for. MaxAttempts 1 turns retrying off.
+type RetryConfig struct {
+	MaxAttempts    int     `json:"maxAttempts"`
+	InitialDelayMs int     `json:"initialDelayMs"`
+	MaxDelayMs     int     `json:"maxDelayMs"`
+	Jitter         float64 `json:"jitter"`
+}
+
+// FallbackConfig lists models to try, in order, when a request fails with
+// a rate limit, a server error or a network error. A model is written
+// "<provider>/<model>" to use another configured provider, or as a model
+// name or alias for the default one. A model failing FailureThreshold
+// times in a row (default 3) is skipped for Cooldown seconds (default 60).
+type FallbackConfig struct {
+	Models           []string `json:"models,omitempty"`
+	FailureThreshold int      `json:"failureThreshold,omitempty"`
+	Cooldown         int      `json:"cooldown,omitempty"`
 }
 
 type GatewayConfig struct {
-	Host string `json:"host"`
-	Port int    `json:"port"`
+	Host  string `json:"host"`
+	Port  int    `json:"port"`
+	WebUI bool   `json:"webUI"` // Serve the browser chat playground at "/"
+	// WebToken protects the web chat, which anyone able to use it can have
+	// run commands. The web chat is disabled when empty.
+	WebToken string `json:"webToken,omitempty"`
+	// AdminToken protects the /api/admin endpoints. Admin APIs are disabled when empty.
+	AdminToken string `json:"adminToken,omitempty"`
+	// PublicURL is the address users' browsers reach the gateway at, e.g.
+	// "https://bot.example.com", used for OAuth redirects.
+	PublicURL string `json:"publicUrl,omitempty"`
 }
 
 type WebSearchConfig struct {
@@ -84,8 +385,30 @@ type WebSearchConfig struct {
 	MaxResults int    `json:"maxResults"`
 }
 
+// LinkPreviewConfig controls automatic fetching of URLs found in user
+// messages. It is off by default; when on, only public addresses are fetched.
+type LinkPreviewConfig struct {
+	Enabled  bool `json:"enabled"`
+	MaxChars int  `json:"maxChars"` // Preview length per link
+	MaxLinks int  `json:"maxLinks"` // Links previewed per message
+}
+
 type WebToolsConfig struct {
-	Search WebSearchConfig `json:"search"`
+	Search      WebSearchConfig   `json:"search"`
+	LinkPreview LinkPreviewConfig `json:"linkPreview"`
+	Render      RenderConfig      `json:"render"`
+}
+
+// RenderConfig lets web_fetch run a page's JavaScript in a headless Chrome
+// or Chromium when the page is mostly empty without it. It is off by
+// default and never used when nanobot runs as root.
+type RenderConfig struct {
+	Enabled bool `json:"enabled"`
+	// Browser is the browser executable; empty looks for Chrome or
+	// Chromium on the PATH.
+	Browser  string `json:"browser,omitempty"`
+	Timeout  int    `json:"timeout"`  // Seconds per page
+	MinChars int    `json:"minChars"` // Less text than this counts as empty
 }
 
 type ExecToolConfig struct {
@@ -98,20 +421,233 @@ type MediaToolConfig struct {
 	DefaultImageToImageModel string `json:"defaultImageToImageModel"`
 	DefaultImageToVideoModel string `json:"defaultImageToVideoModel"`
 	DefaultTextToAudioModel  string `json:"defaultTextToAudioModel"`
+	// AutoSend sends generated media to the chat that asked for it, with
+	// the prompt as the caption, instead of leaving that to the model.
+	AutoSend bool `json:"autoSend"`
+}
+
+// OCRToolConfig controls the ocr tool, which reads the text of images
+// with Tesseract, if installed, or a vision model.
+type OCRToolConfig struct {
+	Enabled bool `json:"enabled"`
+	// Tesseract is the tesseract executable; empty looks it up on the PATH.
+	Tesseract string `json:"tesseract,omitempty"`
+	// Languages are Tesseract's language codes, e.g. "eng+chi_sim".
+	Languages string `json:"languages"`
+	// Vision reads images with a vision model when Tesseract is missing or
+	// finds no text. Model defaults to the agent's model.
+	Vision bool   `json:"vision"`
+	Model  string `json:"model,omitempty"`
+}
+
+// MessageToolConfig controls the message tool.
+type MessageToolConfig struct {
+	// ConfirmOtherChats shows messages addressed to a chat other than the
+	// requester's as a draft first; the requester posts them with /send.
+	ConfirmOtherChats bool `json:"confirmOtherChats"`
+}
+
+// EncodingConfig controls conversion of non-UTF-8 output from exec and read_file.
+type EncodingConfig struct {
+	Normalize  bool     `json:"normalize"`
+	Candidates []string `json:"candidates"` // Encodings tried in order, e.g. "gbk", "big5"
 }
 
 type ToolsConfig struct {
-	Web   WebToolsConfig  `json:"web"`
-	Exec  ExecToolConfig  `json:"exec"`
-	Media MediaToolConfig `json:"media"`
+	Web      WebToolsConfig    `json:"web"`
+	Exec     ExecToolConfig    `json:"exec"`
+	Media    MediaToolConfig   `json:"media"`
+	Encoding EncodingConfig    `json:"encoding"`
+	Message  MessageToolConfig `json:"message"`
+	OCR      OCRToolConfig     `json:"ocr"`
+	// Credentials are the services users store their own secrets for, by
+	// service name, e.g. "github".
+	Credentials map[string]CredentialConfig `json:"credentials,omitempty"`
+	// ReadOnly removes write_file, edit_file, append_file and exec, and
+	// blocks adding or removing cron jobs, for demos and inspecting a
+	// production workspace.
+	ReadOnly bool `json:"readOnly"`
+}
+
+// CredentialConfig is a service whose secret each user provides. Commands
+// run with exec for a user get their secret in the environment variable
+// Env; for users without one the variable is removed, so a secret in the
+// process environment is never shared.
+type CredentialConfig struct {
+	Env         string `json:"env"`
+	Description string `json:"description,omitempty"`
+	// OAuth lets users connect their account with /connect instead of
+	// pasting a token.
+	OAuth *OAuthConfig `json:"oauth,omitempty"`
+}
+
+// OAuthConfig is the OAuth app a credential service's tokens are issued
+// to. Provider is "google", "github" or "microsoft"; other providers need
+// AuthURL and TokenURL. Register <gateway.publicUrl>/oauth/callback as the
+// app's redirect URL.
+type OAuthConfig struct {
+	Provider     string   `json:"provider,omitempty"`
+	ClientID     string   `json:"clientId"`
+	ClientSecret string   `json:"clientSecret"`
+	Scopes       []string `json:"scopes,omitempty"`
+	AuthURL      string   `json:"authUrl,omitempty"`
+	TokenURL     string   `json:"tokenUrl,omitempty"`
+}
+
+// ContactConfig maps one person to the sender IDs they use on each channel.
+// IDs are written as "channel:senderId", e.g. "telegram:123456" or "feishu:ou_xxx".
+type ContactConfig struct {
+	Name string   `json:"name"`
+	IDs  []string `json:"ids"`
+}
+
+type MemoryConfig struct {
+	// SharedContext lets facts saved with the memory tool follow a contact
+	// across all of their chats instead of staying in the chat they were learned in.
+	SharedContext bool `json:"sharedContext"`
+	// Search indexes MEMORY.md and daily notes with embeddings so only the
+	// memories relevant to a message go into the prompt.
+	Search MemorySearchConfig `json:"search"`
+}
+
+// MemorySearchConfig configures embeddings-based memory retrieval.
+type MemorySearchConfig struct {
+	Enabled bool   `json:"enabled"`
+	APIKey  string `json:"apiKey,omitempty"` // Defaults to providers.openai.apiKey
+	APIBase string `json:"apiBase,omitempty"`
+	Model   string `json:"model"` // OpenAI-compatible embeddings model
+	// TopK is how many memories are added to the system prompt.
+	TopK int `json:"topK"`
+	// MinScore drops matches with a lower cosine similarity.
+	MinScore float64 `json:"minScore"`
+}
+
+// ModerationConfig controls the content-safety check on inbound messages.
+type ModerationConfig struct {
+	Enabled bool `json:"enabled"`
+	// Provider is "openai" to call the moderation API, or "local" to only
+	// apply BlockedWords and Patterns. Local rules are checked first either way.
+	Provider string `json:"provider"`
+	APIKey   string `json:"apiKey,omitempty"` // Defaults to providers.openai.apiKey
+	APIBase  string `json:"apiBase,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// BlockedWords are matched case-insensitively; Patterns are regular expressions.
+	BlockedWords []string `json:"blockedWords,omitempty"`
+	Patterns     []string `json:"patterns,omitempty"`
+	// Policy for flagged content: "refuse" replies with RefuseMessage, "alert"
+	// also notifies AlertChannel/AlertTo, "warn" lets the agent answer with a caution.
+	Policy        string   `json:"policy"`
+	RefuseMessage string   `json:"refuseMessage,omitempty"`
+	AlertChannel  string   `json:"alertChannel,omitempty"`
+	AlertTo       string   `json:"alertTo,omitempty"`
+	Channels      []string `json:"channels,omitempty"` // Only check these channels; empty = all
+}
+
+// TranslationConfig lets the agent work in one language: inbound messages
+// in other languages are translated into it and replies translated back.
+type TranslationConfig struct {
+	Enabled bool `json:"enabled"`
+	// Provider is "llm" to translate with a chat model or "deepl" for the DeepL API.
+	Provider string `json:"provider"`
+	Model    string `json:"model,omitempty"`   // For "llm"; defaults to the agent's model
+	APIKey   string `json:"apiKey,omitempty"`  // DeepL authentication key
+	APIBase  string `json:"apiBase,omitempty"` // Defaults to the DeepL Free or Pro API, by key
+	// WorkingLanguage is the language the agent reads and writes, e.g. "English".
+	WorkingLanguage string   `json:"workingLanguage"`
+	Channels        []string `json:"channels,omitempty"` // Only translate these channels; empty = all
+}
+
+// StartupConfig controls the startup banner.
+type StartupConfig struct {
+	// Banner sends a summary of the agent's state (version, model, channels,
+	// cron jobs, degraded subsystems) to the owner chat Channel/To on start.
+	Banner  bool   `json:"banner"`
+	Channel string `json:"channel,omitempty"`
+	To      string `json:"to,omitempty"`
+}
+
+// SessionsConfig controls stored conversations.
+type SessionsConfig struct {
+	// ArchiveRetentionDays is how long conversations archived by a reset
+	// are kept for /restore; 0 keeps them forever.
+	ArchiveRetentionDays int `json:"archiveRetentionDays"`
+}
+
+// BusConfig controls the message bus between the channels and the agent.
+type BusConfig struct {
+	// Persist journals queued messages in workspace/bus, so those not yet
+	// handled when the process stops are delivered after a restart.
+	Persist bool `json:"persist"`
+	// MaxAttempts is how many deliveries of a journaled message may be
+	// started before it is moved to the dead-letter file.
+	MaxAttempts int `json:"maxAttempts"`
+}
+
+// CronConfig controls how scheduled jobs are delivered.
+type CronConfig struct {
+	// DigestWindow is how many seconds cron deliveries to one chat are
+	// collected and sent as a single message; 0 sends each at once.
+	DigestWindow int `json:"digestWindow"`
 }
 
 type Config struct {
-	Agents    AgentsConfig    `json:"agents"`
-	Channels  ChannelsConfig  `json:"channels"`
-	Providers ProvidersConfig `json:"providers"`
-	Gateway   GatewayConfig   `json:"gateway"`
-	Tools     ToolsConfig     `json:"tools"`
+	Agents      AgentsConfig      `json:"agents"`
+	Channels    ChannelsConfig    `json:"channels"`
+	Providers   ProvidersConfig   `json:"providers"`
+	Gateway     GatewayConfig     `json:"gateway"`
+	Tools       ToolsConfig       `json:"tools"`
+	Memory      MemoryConfig      `json:"memory"`
+	Moderation  ModerationConfig  `json:"moderation"`
+	Translation TranslationConfig `json:"translation"`
+	Cron        CronConfig        `json:"cron"`
+	Startup     StartupConfig     `json:"startup"`
+	Bus         BusConfig         `json:"bus"`
+	Sessions    SessionsConfig    `json:"sessions"`
+	Contacts    []ContactConfig   `json:"contacts"`
+	Usage       UsageConfig       `json:"usage"`
+	Encryption  EncryptionConfig  `json:"encryption"`
+	Tracing     TracingConfig     `json:"tracing"`
+	// Admins are the senders, as "channel:senderId", allowed to run admin
+	// chat commands such as /purge.
+	Admins []string `json:"admins,omitempty"`
+	// Models maps aliases such as "fast" or "smart" to a model, optionally
+	// prefixed with the provider to send it to ("groq/llama-3.1-8b-instant").
+	// Aliases work anywhere a model name is accepted.
+	Models map[string]string `json:"models,omitempty"`
+}
+
+// UsageConfig prices model usage so that spend can be tracked. Prices maps
+// model names or name prefixes, with or without the provider, to their
+// price; usage of other models is counted in tokens only.
+type UsageConfig struct {
+	Prices map[string]ModelPrice `json:"prices,omitempty"`
+}
+
+// EncryptionConfig encrypts session files, memory files and the cron store
+// with AES-256-GCM. The key is 32 bytes, base64 or hex encoded, read from
+// the environment variable KeyEnv or, if that is unset and Keyring is set,
+// from the system keyring (service "nanobot", account "encryption-key").
+type EncryptionConfig struct {
+	Enabled bool   `json:"enabled"`
+	KeyEnv  string `json:"keyEnv"`
+	Keyring bool   `json:"keyring"`
+}
+
+// TracingConfig exports OpenTelemetry traces of agent turns, model calls
+// and tool calls over OTLP/HTTP. Endpoint is the collector's base URL, to
+// which /v1/traces is added; SampleRatio is the fraction of turns traced.
+type TracingConfig struct {
+	Enabled     bool              `json:"enabled"`
+	Endpoint    string            `json:"endpoint"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ServiceName string            `json:"serviceName"`
+	SampleRatio float64           `json:"sampleRatio"`
+}
+
+// ModelPrice is a model's price in US dollars per million tokens.
+type ModelPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
 }
 
 // DefaultConfig returns the default configuration.
@@ -119,57 +655,183 @@ func DefaultConfig() *Config {
 	return &Config{
 		Agents: AgentsConfig{
 			Defaults: AgentDefaults{
-				Workspace:         ".nanobot/workspace",
-				Model:             "anthropic/claude-opus-4-5",
-				MaxTokens:         8192,
-				Temperature:       0.7,
-				MaxToolIterations: 20,
+				Workspace:          ".nanobot/workspace",
+				Model:              "anthropic/claude-opus-4-5",
+				MaxTokens:          8192,
+				Temperature:        0.7,
+				MaxToolIterations:  20,
+				MaxInlineFileBytes: 32 * 1024,
+
+				RemoteImages:        "off",
+				MaxRemoteImageBytes: 5 * 1024 * 1024,
+				Stream: StreamConfig{
+					MinChars:        80,
+					FlushIntervalMs: 300,
+					StatusChannels:  []string{"dingtalk", "feishu"},
+					StatusInterval:  5,
+				},
+				Verbosity:     "normal",
+				ReplyLanguage: "auto",
+				TurnTimeout:   300,
+
+				MaxRequestBytes:    400 * 1024,
+				MaxRequestMessages: 200,
+				HistoryTokenBudget: 6000,
+				HistoryMessages:    50,
+				SkillSuggestions: SkillSuggestConfig{
+					Enabled:    true,
+					MinDays:    3,
+					WindowDays: 30,
+				},
+			},
+			Subagents: SubagentsConfig{
+				MaxConcurrent: 3,
+				MaxQueued:     10,
+				MaxIterations: 15,
+				Timeout:       600,
+				DedupWindow:   600,
+
+				ProgressInterval: 30,
+			},
+			Coding: CodingConfig{
+				MapMaxFiles: 300,
+			},
+			Research: ResearchConfig{
+				MaxSections:       5,
+				SectionIterations: 8,
+			},
+		},
+		Providers: ProvidersConfig{
+			Retry: RetryConfig{
+				MaxAttempts:    3,
+				InitialDelayMs: 500,
+				MaxDelayMs:     8000,
+				Jitter:         0.2,
 			},
 		},
 		Channels: ChannelsConfig{
 			WhatsApp: WhatsAppConfig{BridgeURL: "ws://localhost:3001"},
+			Webhook:  WebhookConfig{Timeout: 120},
+			// The platforms' published limits
+			RateLimit: map[string]RateLimit{
+				"telegram": {Rate: 30, ChatRate: 1, Burst: 3, MaxRetries: 3, Backoff: 1000},
+				"feishu":   {Rate: 50, ChatRate: 5, Burst: 5, MaxRetries: 3, Backoff: 1000},
+				"dingtalk": {Rate: 20, ChatRate: 20.0 / 60, Burst: 3, MaxRetries: 3, Backoff: 1000},
+			},
+			FileFallback: map[string]int{
+				"telegram": 12000,
+				"feishu":   20000,
+				"dingtalk": 12000,
+			},
+			Transcription: TranscriptionConfig{
+				APIBase: "https://api.openai.com/v1",
+				Model:   "whisper-1",
+			},
 		},
 		Gateway: GatewayConfig{
 			Host: "0.0.0.0",
 			Port: 18790,
 		},
+		Memory: MemoryConfig{
+			Search: MemorySearchConfig{
+				Model:    "text-embedding-3-small",
+				TopK:     5,
+				MinScore: 0.3,
+			},
+		},
+		Moderation: ModerationConfig{
+			Provider:      "openai",
+			Model:         "omni-moderation-latest",
+			Policy:        "refuse",
+			RefuseMessage: "Sorry, I can't help with that.",
+		},
+		Translation: TranslationConfig{
+			Provider:        "llm",
+			WorkingLanguage: "English",
+		},
+		Cron: CronConfig{
+			DigestWindow: 30,
+		},
+		Bus: BusConfig{
+			MaxAttempts: 3,
+		},
+		Sessions: SessionsConfig{
+			ArchiveRetentionDays: 30,
+		},
+		Encryption: EncryptionConfig{
+			KeyEnv: "NANOBOT_ENCRYPTION_KEY",
+		},
+		Tracing: TracingConfig{
+			Endpoint:    "http://localhost:4318",
+			ServiceName: "nanobot",
+			SampleRatio: 1,
+		},
 		Tools: ToolsConfig{
 			Web: WebToolsConfig{
 				Search: WebSearchConfig{MaxResults: 5},
+				LinkPreview: LinkPreviewConfig{
+					MaxChars: 1500,
+					MaxLinks: 2,
+				},
+				Render: RenderConfig{
+					Timeout:  30,
+					MinChars: 200,
+				},
 			},
 			Exec: ExecToolConfig{
 				Timeout:             60,
 				RestrictToWorkspace: false,
 			},
+			OCR: OCRToolConfig{
+				Enabled:   true,
+				Languages: "eng",
+				Vision:    true,
+			},
 			Media: MediaToolConfig{
 				DefaultTextToImageModel:  "black-forest-labs/FLUX.1-schnell",
 				DefaultImageToImageModel: "Qwen/Qwen-Image-Edit-2509",
 				DefaultImageToVideoModel: "Lightricks/LTX-Video",
 				DefaultTextToAudioModel:  "fishaudio/fish-speech-1.5",
+				AutoSend:                 true,
+			},
+			Encoding: EncodingConfig{
+				Normalize:  true,
+				Candidates: []string{"gbk", "big5"},
 			},
 		},
 	}
 }
 
-// LoadConfig loads the configuration from the given path.
+// LoadConfig loads the configuration from the given path, or from
+// DefaultConfigPath if it is empty. The file may be JSON, YAML (.yaml,
+// .yml) or TOML (.toml), and ${VAR} in its values is replaced from the
+// environment.
 func LoadConfig(path string) (*Config, error) {
 	if path == "" {
-		path = filepath.Join(".nanobot", "config.json")
+		path = DefaultConfigPath()
 	}
 
 	config := DefaultConfig()
 
-	file, err := os.Open(path)
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return config, nil
 		}
 		return nil, err
 	}
-	defer file.Close()
 
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(config); err != nil {
+	doc, err := decodeConfigFile(path, data)
+	if err != nil {
+		return nil, err
+	}
+	// Settings are applied over the defaults through their JSON names, so
+	// all formats use the same keys
+	raw, err := json.Marshal(expandEnv(doc))
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, config); err != nil {
 		return nil, err
 	}
 
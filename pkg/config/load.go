@@ -0,0 +1,94 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames are looked for in .nanobot, in order, when no config
+// file is given.
+var configFileNames = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+// DefaultConfigPath returns the first config file found in .nanobot, or
+// .nanobot/config.json if there is none.
+func DefaultConfigPath() string {
+	for _, name := range configFileNames {
+		path := filepath.Join(".nanobot", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(".nanobot", configFileNames[0])
+}
+
+// decodeConfigFile decodes a config file by its extension.
+func decodeConfigFile(path string, data []byte) (map[string]interface{}, error) {
+	doc := make(map[string]interface{})
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		doc, err = parseTOML(data)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber() // Keep large IDs exact
+		err = decoder.Decode(&doc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// envPattern matches ${VAR} and ${VAR:-default}; $${ is a literal ${.
+var envPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// expandEnv replaces environment variable references in the strings of a
+// decoded config, so secrets such as API keys can stay out of the file.
+// An unset variable without a default becomes empty and is logged. YAML
+// maps with non-string keys are converted so the result encodes as JSON.
+func expandEnv(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return envPattern.ReplaceAllStringFunc(v, func(ref string) string {
+			if strings.HasPrefix(ref, "$$") {
+				return ref[1:]
+			}
+			m := envPattern.FindStringSubmatch(ref)
+			if value, ok := os.LookupEnv(m[1]); ok {
+				return value
+			}
+			if m[2] != "" {
+				return m[2][2:]
+			}
+			log.Printf("Config: environment variable %s is not set", m[1])
+			return ""
+		})
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = expandEnv(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[fmt.Sprint(k)] = expandEnv(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = expandEnv(item)
+		}
+		return v
+	}
+	return v
+}
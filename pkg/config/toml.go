@@ -0,0 +1,567 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML decodes a TOML document into maps, slices, strings, int64,
+// float64 and bool. It covers what a config file needs: tables, arrays of
+// tables, dotted and quoted keys, all string forms, numbers, booleans,
+// arrays and inline tables, and rejects what TOML 1.0 does not allow, such
+// as tables defined twice. Dates and times are kept as strings.
+func parseTOML(data []byte) (map[string]interface{}, error) {
+	p := &tomlParser{
+		src:     string(data),
+		line:    1,
+		defined: make(map[uintptr]bool),
+		headers: make(map[uintptr]bool),
+		inline:  make(map[uintptr]bool),
+		static:  make(map[tomlSlot]bool),
+	}
+	root := make(map[string]interface{})
+	current := root
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return root, nil
+		}
+		var err error
+		if p.peek() == '[' {
+			current, err = p.parseHeader(root)
+		} else {
+			err = p.parseKeyValue(current)
+		}
+		if err == nil {
+			err = p.endOfLine()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("toml: line %d: %w", p.line, err)
+		}
+	}
+}
+
+type tomlParser struct {
+	src  string
+	pos  int
+	line int
+
+	// TOML tables can't be defined twice. defined holds the tables
+	// defined by a header or a dotted key, headers those defined by a
+	// header, which dotted keys can't add to, and inline the inline
+	// tables, which can't be added to at all.
+	defined map[uintptr]bool
+	headers map[uintptr]bool
+	inline  map[uintptr]bool
+	// static holds the keys assigned arrays, which [[headers]] can't
+	// append to.
+	static map[tomlSlot]bool
+}
+
+// tomlSlot is a key of a table.
+type tomlSlot struct {
+	table uintptr
+	key   string
+}
+
+func tableID(t map[string]interface{}) uintptr {
+	return reflect.ValueOf(t).Pointer()
+}
+
+func (p *tomlParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *tomlParser) hasPrefix(s string) bool { return strings.HasPrefix(p.src[p.pos:], s) }
+
+// skipBlank skips spaces, tabs and comments, and newlines if newlines is set.
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+			p.line++
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) endOfLine() error {
+	p.skipBlank(false)
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != '\n' {
+		return fmt.Errorf("unexpected %q after value", p.peek())
+	}
+	return nil
+}
+
+// parseHeader parses [table] or [[array.of.tables]] and returns the table
+// that following keys go into.
+func (p *tomlParser) parseHeader(root map[string]interface{}) (map[string]interface{}, error) {
+	array := p.hasPrefix("[[")
+	if array {
+		p.pos += 2
+	} else {
+		p.pos++
+	}
+	keys, err := p.parseKey()
+	if err != nil {
+		return nil, err
+	}
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	p.skipBlank(false)
+	if !p.hasPrefix(closing) {
+		return nil, fmt.Errorf("expected %s", closing)
+	}
+	p.pos += len(closing)
+
+	parent, err := p.table(root, keys[:len(keys)-1], false)
+	if err != nil {
+		return nil, err
+	}
+	last := keys[len(keys)-1]
+	name := strings.Join(keys, ".")
+	if !array {
+		if _, ok := parent[last].([]interface{}); ok {
+			return nil, fmt.Errorf("table %q is already an array", name)
+		}
+		table, err := p.table(parent, []string{last}, false)
+		if err != nil {
+			return nil, err
+		}
+		if p.defined[tableID(table)] {
+			return nil, fmt.Errorf("table %q is defined twice", name)
+		}
+		p.defined[tableID(table)] = true
+		p.headers[tableID(table)] = true
+		return table, nil
+	}
+	table := make(map[string]interface{})
+	switch v := parent[last].(type) {
+	case nil:
+		parent[last] = []interface{}{table}
+	case []interface{}:
+		if p.static[tomlSlot{tableID(parent), last}] {
+			return nil, fmt.Errorf("key %q is an array value, not an array of tables", name)
+		}
+		parent[last] = append(v, table)
+	default:
+		return nil, fmt.Errorf("key %q is already defined", name)
+	}
+	p.defined[tableID(table)] = true
+	p.headers[tableID(table)] = true
+	return table, nil
+}
+
+// table walks keys from t, creating tables as needed. A key holding an
+// array of tables resolves to its last table. dotted is set for the keys
+// of a key/value pair, which can't add to tables defined by headers.
+func (p *tomlParser) table(t map[string]interface{}, keys []string, dotted bool) (map[string]interface{}, error) {
+	for _, k := range keys {
+		switch v := t[k].(type) {
+		case nil:
+			next := make(map[string]interface{})
+			if dotted {
+				p.defined[tableID(next)] = true
+			}
+			t[k] = next
+			t = next
+		case map[string]interface{}:
+			t = v
+		case []interface{}:
+			last, ok := interface{}(nil), false
+			if len(v) > 0 && !p.static[tomlSlot{tableID(t), k}] {
+				last = v[len(v)-1]
+				_, ok = last.(map[string]interface{})
+			}
+			if !ok || dotted {
+				return nil, fmt.Errorf("key %q is not a table", k)
+			}
+			t = last.(map[string]interface{})
+		default:
+			return nil, fmt.Errorf("key %q is not a table", k)
+		}
+		if p.inline[tableID(t)] {
+			return nil, fmt.Errorf("inline table %q can't be extended", k)
+		}
+		if dotted && p.headers[tableID(t)] {
+			return nil, fmt.Errorf("table %q is defined by a header", k)
+		}
+	}
+	return t, nil
+}
+
+func (p *tomlParser) parseKeyValue(t map[string]interface{}) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipBlank(false)
+	if p.peek() != '=' {
+		return fmt.Errorf("expected = after key %q", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skipBlank(false)
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	parent, err := p.table(t, keys[:len(keys)-1], true)
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, exists := parent[last]; exists {
+		return fmt.Errorf("key %q is defined twice", strings.Join(keys, "."))
+	}
+	parent[last] = value
+	if _, ok := value.([]interface{}); ok {
+		p.static[tomlSlot{tableID(parent), last}] = true
+	}
+	return nil
+}
+
+// parseKey parses a possibly dotted key of bare and quoted parts.
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipBlank(false)
+		var key string
+		switch c := p.peek(); {
+		case c == '"':
+			s, err := p.parseBasicString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		case c == '\'':
+			s, err := p.parseLiteralString()
+			if err != nil {
+				return nil, err
+			}
+			key = s
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, fmt.Errorf("expected a key, found %q", p.peek())
+			}
+			key = p.src[start:p.pos]
+		}
+		keys = append(keys, key)
+		p.skipBlank(false)
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+func (p *tomlParser) parseValue() (interface{}, error) {
+	switch {
+	case p.eof():
+		return nil, fmt.Errorf("missing value")
+	case p.hasPrefix(`"""`):
+		return p.parseMultilineString(`"""`, true)
+	case p.hasPrefix(`'''`):
+		return p.parseMultilineString(`'''`, false)
+	case p.peek() == '"':
+		return p.parseBasicString()
+	case p.peek() == '\'':
+		return p.parseLiteralString()
+	case p.hasPrefix("true"):
+		p.pos += 4
+		return true, nil
+	case p.hasPrefix("false"):
+		p.pos += 5
+		return false, nil
+	case p.peek() == '[':
+		return p.parseArray()
+	case p.peek() == '{':
+		return p.parseInlineTable()
+	}
+	return p.parseNumber()
+}
+
+func (p *tomlParser) parseBasicString() (string, error) {
+	p.pos++ // opening quote
+	var sb strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", fmt.Errorf("unterminated string")
+		}
+		c := p.peek()
+		if c == '"' {
+			p.pos++
+			return sb.String(), nil
+		}
+		if c == '\\' {
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if isControl(c, false) {
+			return "", fmt.Errorf("control character %q in string", c)
+		}
+		sb.WriteByte(c)
+		p.pos++
+	}
+}
+
+// isControl reports whether c is a control character strings can't hold
+// as it is. Tabs are allowed, and line breaks in multi-line strings.
+func isControl(c byte, multiline bool) bool {
+	if multiline && (c == '\n' || c == '\r') {
+		return false
+	}
+	return c < 0x20 && c != '\t' || c == 0x7f
+}
+
+func (p *tomlParser) parseLiteralString() (string, error) {
+	p.pos++
+	end := strings.IndexAny(p.src[p.pos:], "'\n")
+	if end < 0 || p.src[p.pos+end] != '\'' {
+		return "", fmt.Errorf("unterminated string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	for i := 0; i < len(s); i++ {
+		if isControl(s[i], false) {
+			return "", fmt.Errorf("control character %q in string", s[i])
+		}
+	}
+	p.pos += end + 1
+	return s, nil
+}
+
+// parseMultilineString parses a multi-line basic or literal string. A
+// newline right after the opening delimiter is dropped.
+func (p *tomlParser) parseMultilineString(delim string, escapes bool) (string, error) {
+	p.pos += 3
+	if p.hasPrefix("\r\n") {
+		p.pos += 2
+		p.line++
+	} else if p.hasPrefix("\n") {
+		p.pos++
+		p.line++
+	}
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if p.hasPrefix(delim) {
+			p.pos += 3
+			// Up to two quotes may end the content before the delimiter
+			for i := 0; i < 2 && p.hasPrefix(delim[:1]); i++ {
+				sb.WriteByte(delim[0])
+				p.pos++
+			}
+			return sb.String(), nil
+		}
+		c := p.peek()
+		if escapes && c == '\\' {
+			// A backslash at the end of a line joins it to the next
+			rest := strings.TrimLeft(p.src[p.pos+1:], " \t\r")
+			if strings.HasPrefix(rest, "\n") {
+				p.pos++
+				for !p.eof() && strings.IndexByte(" \t\r\n", p.peek()) >= 0 {
+					if p.peek() == '\n' {
+						p.line++
+					}
+					p.pos++
+				}
+				continue
+			}
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if isControl(c, true) {
+			return "", fmt.Errorf("control character %q in string", c)
+		}
+		if c == '\n' {
+			p.line++
+		}
+		sb.WriteByte(c)
+		p.pos++
+	}
+}
+
+func (p *tomlParser) parseEscape(sb *strings.Builder) error {
+	p.pos++ // backslash
+	if p.eof() {
+		return fmt.Errorf("unterminated escape")
+	}
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		sb.WriteByte('\b')
+	case 't':
+		sb.WriteByte('\t')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'r':
+		sb.WriteByte('\r')
+	case '"':
+		sb.WriteByte('"')
+	case '\\':
+		sb.WriteByte('\\')
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.src) {
+			return fmt.Errorf("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return fmt.Errorf("invalid unicode escape")
+		}
+		sb.WriteRune(rune(code))
+		p.pos += n
+	default:
+		return fmt.Errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+func (p *tomlParser) parseArray() ([]interface{}, error) {
+	p.pos++
+	values := []interface{}{}
+	for {
+		p.skipBlank(true)
+		if p.peek() == ']' {
+			p.pos++
+			return values, nil
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		p.skipBlank(true)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
+
+func (p *tomlParser) parseInlineTable() (map[string]interface{}, error) {
+	p.pos++
+	t := make(map[string]interface{})
+	p.skipBlank(false)
+	if p.peek() == '}' {
+		p.pos++
+		p.inline[tableID(t)] = true
+		return t, nil
+	}
+	for {
+		if err := p.parseKeyValue(t); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		switch p.peek() {
+		case ',':
+			p.pos++
+			p.skipBlank(false)
+			if p.peek() == '}' {
+				return nil, fmt.Errorf("trailing comma in inline table")
+			}
+		case '}':
+			p.pos++
+			p.inline[tableID(t)] = true
+			return t, nil
+		default:
+			return nil, fmt.Errorf("expected , or } in inline table")
+		}
+	}
+}
+
+var (
+	tomlInteger  = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)$`)
+	tomlPrefixed = regexp.MustCompile(`^0(x[0-9A-Fa-f](_?[0-9A-Fa-f])*|o[0-7](_?[0-7])*|b[01](_?[01])*)$`)
+	tomlFloat    = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][+-]?[0-9](_?[0-9])*)?$|^[+-]?(inf|nan)$`)
+	tomlDateTime = regexp.MustCompile(`^([0-9]{4}-[0-9]{2}-[0-9]{2}([Tt ][0-9]{2}:[0-9]{2}:[0-9]{2}(\.[0-9]+)?([Zz]|[+-][0-9]{2}:[0-9]{2})?)?|[0-9]{2}:[0-9]{2}:[0-9]{2}(\.[0-9]+)?)$`)
+)
+
+// parseNumber parses an integer or float. Dates and times, which also
+// start with digits, are returned as strings.
+func (p *tomlParser) parseNumber() (interface{}, error) {
+	start := p.pos
+	for !p.eof() && strings.IndexByte(" \t\r\n,]}#", p.peek()) < 0 {
+		p.pos++
+	}
+	raw := p.src[start:p.pos]
+	// A date and time may have a space between them
+	if len(raw) == 10 && raw[4] == '-' && raw[7] == '-' && p.peek() == ' ' && p.pos+1 < len(p.src) && p.src[p.pos+1] >= '0' && p.src[p.pos+1] <= '9' {
+		p.pos++
+		for !p.eof() && strings.IndexByte(" \t\r\n,]}#", p.peek()) < 0 {
+			p.pos++
+		}
+		raw = p.src[start:p.pos]
+	}
+	if raw == "" {
+		return nil, fmt.Errorf("missing value")
+	}
+	s := strings.ReplaceAll(raw, "_", "")
+	switch {
+	case tomlInteger.MatchString(raw):
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", raw)
+		}
+		return n, nil
+	case tomlPrefixed.MatchString(raw):
+		n, err := strconv.ParseInt(s, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", raw)
+		}
+		return n, nil
+	case tomlFloat.MatchString(raw):
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", raw)
+		}
+		return f, nil
+	case tomlDateTime.MatchString(raw):
+		return raw, nil
+	}
+	return nil, fmt.Errorf("invalid value %q", raw)
+}
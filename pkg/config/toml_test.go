@@ -0,0 +1,293 @@
+package config
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type tomlMap = map[string]interface{}
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want tomlMap
+	}{
+		{
+			name: "key values",
+			doc: `
+# a comment
+title = "nanobot" # trailing comment
+count = 3
+ratio = 0.5
+on = true
+off = false
+`,
+			want: tomlMap{"title": "nanobot", "count": int64(3), "ratio": 0.5, "on": true, "off": false},
+		},
+		{
+			name: "tables",
+			doc: `
+[agents.defaults]
+model = "gpt-4o"
+
+[channels.telegram]
+enabled = true
+`,
+			want: tomlMap{
+				"agents":   tomlMap{"defaults": tomlMap{"model": "gpt-4o"}},
+				"channels": tomlMap{"telegram": tomlMap{"enabled": true}},
+			},
+		},
+		{
+			name: "super table after sub table",
+			doc: `
+[a.b]
+x = 1
+[a]
+y = 2
+`,
+			want: tomlMap{"a": tomlMap{"b": tomlMap{"x": int64(1)}, "y": int64(2)}},
+		},
+		{
+			name: "dotted and quoted keys",
+			doc: `
+site."google.com" = true
+fruit.apple.color = "red"
+'quoted key' = 1
+"" = "empty"
+[ dog . "tater.man" ]
+type = "pug"
+`,
+			want: tomlMap{
+				"site":       tomlMap{"google.com": true},
+				"fruit":      tomlMap{"apple": tomlMap{"color": "red"}},
+				"quoted key": int64(1),
+				"":           "empty",
+				"dog":        tomlMap{"tater.man": tomlMap{"type": "pug"}},
+			},
+		},
+		{
+			name: "sub table of a dotted key table",
+			doc: `
+[fruit]
+apple.color = "red"
+[fruit.apple.texture]
+smooth = true
+`,
+			want: tomlMap{"fruit": tomlMap{"apple": tomlMap{"color": "red", "texture": tomlMap{"smooth": true}}}},
+		},
+		{
+			name: "inline tables",
+			doc: `
+point = { x = 1, y = 2 }
+empty = {}
+nested = { name = { first = "Tom", last = "Preston" }, dotted.key = "v" }
+`,
+			want: tomlMap{
+				"point":  tomlMap{"x": int64(1), "y": int64(2)},
+				"empty":  tomlMap{},
+				"nested": tomlMap{"name": tomlMap{"first": "Tom", "last": "Preston"}, "dotted": tomlMap{"key": "v"}},
+			},
+		},
+		{
+			name: "arrays",
+			doc: `
+ints = [1, 2, 3]
+empty = []
+mixed = ["a", 1, { b = true }, [2]]
+multiline = [
+  "x", # first
+  "y",
+]
+`,
+			want: tomlMap{
+				"ints":      []interface{}{int64(1), int64(2), int64(3)},
+				"empty":     []interface{}{},
+				"mixed":     []interface{}{"a", int64(1), tomlMap{"b": true}, []interface{}{int64(2)}},
+				"multiline": []interface{}{"x", "y"},
+			},
+		},
+		{
+			name: "arrays of tables",
+			doc: `
+[[providers]]
+name = "a"
+[providers.extra]
+k = 1
+
+[[providers]]
+name = "b"
+[[providers.models]]
+id = "m1"
+[[providers.models]]
+id = "m2"
+`,
+			want: tomlMap{"providers": []interface{}{
+				tomlMap{"name": "a", "extra": tomlMap{"k": int64(1)}},
+				tomlMap{"name": "b", "models": []interface{}{tomlMap{"id": "m1"}, tomlMap{"id": "m2"}}},
+			}},
+		},
+		{
+			name: "escapes",
+			doc:  `s = "tab\there\nquote\" backslash\\ \u00e9 \U0001F600 \b\f\r"`,
+			want: tomlMap{"s": "tab\there\nquote\" backslash\\ é 😀 \b\f\r"},
+		},
+		{
+			name: "literal strings",
+			doc:  "path = 'C:\\Users\\nanobot'\nregex = '<\\i\\c*\\s*>'\nquoted = 'Tom \"Dubs\" Preston'",
+			want: tomlMap{"path": `C:\Users\nanobot`, "regex": `<\i\c*\s*>`, "quoted": `Tom "Dubs" Preston`},
+		},
+		{
+			name: "multi-line basic strings",
+			doc: "a = \"\"\"\nRoses are red\nViolets are blue\"\"\"\n" +
+				"b = \"\"\"\\\n  The quick \\\n  brown fox.\\\n  \"\"\"\n" +
+				"c = \"\"\"Here are two quotes: \"\". Ends with one\"\"\"\"\n" +
+				"d = \"\"\"escaped \\\"\"\" and \\u0041\"\"\"\n",
+			want: tomlMap{
+				"a": "Roses are red\nViolets are blue",
+				"b": "The quick brown fox.",
+				"c": `Here are two quotes: "". Ends with one"`,
+				"d": `escaped """ and A`,
+			},
+		},
+		{
+			name: "multi-line literal strings",
+			doc:  "re = '''\nI [dw]on't need \\d{2} apples\n'''\nq = '''Two quotes: ''.'''\n",
+			want: tomlMap{
+				"re": "I [dw]on't need \\d{2} apples\n",
+				"q":  "Two quotes: ''.",
+			},
+		},
+		{
+			name: "numbers",
+			doc: `
+big = 1_000_000
+neg = -17
+pos = +42
+zero = 0
+hex = 0xDEAD_beef
+oct = 0o755
+bin = 0b1101
+float = 3.14
+exp = 5e+22
+frac_exp = -2.5E-3
+under = 9_224.617_445
+inf = -inf
+`,
+			want: tomlMap{
+				"big": int64(1000000), "neg": int64(-17), "pos": int64(42), "zero": int64(0),
+				"hex": int64(0xDEADBEEF), "oct": int64(0755), "bin": int64(13),
+				"float": 3.14, "exp": 5e22, "frac_exp": -2.5e-3, "under": 9224.617445,
+				"inf": math.Inf(-1),
+			},
+		},
+		{
+			name: "dates and times are strings",
+			doc: `
+odt = 1979-05-27T07:32:00Z
+offset = 1979-05-27T00:32:00.999999-07:00
+space = 1979-05-27 07:32:00
+date = 1979-05-27
+time = 07:32:00
+`,
+			want: tomlMap{
+				"odt":    "1979-05-27T07:32:00Z",
+				"offset": "1979-05-27T00:32:00.999999-07:00",
+				"space":  "1979-05-27 07:32:00",
+				"date":   "1979-05-27",
+				"time":   "07:32:00",
+			},
+		},
+		{
+			name: "windows line endings",
+			doc:  "[a]\r\nb = 1\r\nc = \"x\"\r\n",
+			want: tomlMap{"a": tomlMap{"b": int64(1), "c": "x"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML([]byte(tt.doc))
+			if err != nil {
+				t.Fatalf("parseTOML: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTOML =\n%#v\nwant\n%#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLNaN(t *testing.T) {
+	got, err := parseTOML([]byte("n = nan"))
+	if err != nil {
+		t.Fatalf("parseTOML: %v", err)
+	}
+	if f, ok := got["n"].(float64); !ok || !math.IsNaN(f) {
+		t.Errorf("n = %#v, want NaN", got["n"])
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string // in the error
+	}{
+		{"duplicate key", "a = 1\na = 2", `line 2: key "a" is defined twice`},
+		{"duplicate dotted key", "a.b = 1\na.b = 2", `key "a.b" is defined twice`},
+		{"duplicate table", "[a]\nx = 1\n[a]\ny = 2", `table "a" is defined twice`},
+		{"table over a value", "a = 1\n[a]", `key "a" is not a table`},
+		{"value over a table", "[a.b]\n[a]\nb = 1", `key "b" is defined twice`},
+		{"dotted key table redefined", "a.b = 1\n[a]", `table "a" is defined twice`},
+		{"dotted key into a header table", "[a.b]\nx = 1\n[a]\nb.y = 2", `table "b" is defined by a header`},
+		{"header extends an inline table", "a = { x = 1 }\n[a]\ny = 2", `inline table "a" can't be extended`},
+		{"dotted key extends an inline table", "a = { x = 1 }\na.y = 2", `inline table "a" can't be extended`},
+		{"table header over an array of tables", "[[a]]\n[a]", `table "a" is already an array`},
+		{"array of tables over an array value", "a = [1]\n[[a]]", `key "a" is an array value`},
+		{"unclosed header", "[a\nb = 1", "expected ]"},
+		{"unclosed array of tables header", "[[a]\nb = 1", "expected ]]"},
+		{"missing equals", "a 1", "expected = after key"},
+		{"missing key", "= 1", "expected a key"},
+		{"missing value", "a =", "missing value"},
+		{"missing value before comment", "a = # none", "missing value"},
+		{"two values on a line", "a = 1 b = 2", "after value"},
+		{"unterminated string", `a = "abc`, "unterminated string"},
+		{"newline in a string", "a = \"ab\ncd\"", "unterminated string"},
+		{"unterminated literal string", "a = 'abc\n", "unterminated string"},
+		{"unterminated multi-line string", `a = """abc`, "unterminated string"},
+		{"unterminated multi-line literal string", "a = '''abc\n", "unterminated string"},
+		{"control character", "a = \"a\x01b\"", "control character"},
+		{"invalid escape", `a = "\q"`, `invalid escape \q`},
+		{"short unicode escape", `a = "\u12"`, "invalid unicode escape"},
+		{"invalid unicode escape", `a = "\uD800"`, "invalid unicode escape"},
+		{"unclosed array", "a = [1, 2", "expected , or ] in array"},
+		{"array without commas", "a = [1 2]", "expected , or ] in array"},
+		{"unclosed inline table", "a = { x = 1", "expected , or } in inline table"},
+		{"newline in an inline table", "a = { x = 1,\ny = 2 }", "expected a key"},
+		{"trailing comma in an inline table", "a = { x = 1, }", "trailing comma in inline table"},
+		{"duplicate key in an inline table", "a = { x = 1, x = 2 }", `key "x" is defined twice`},
+		{"leading zero", "a = 012", `invalid value "012"`},
+		{"double underscore", "a = 1__000", `invalid value "1__000"`},
+		{"trailing underscore", "a = 1_", `invalid value "1_"`},
+		{"bare dot float", "a = 1.", `invalid value "1."`},
+		{"signed hex", "a = -0x1F", `invalid value "-0x1F"`},
+		{"integer overflow", "a = 9223372036854775808", "invalid number"},
+		{"bare word", "a = yes", `invalid value "yes"`},
+		{"lone sign", "a = -", `invalid value "-"`},
+		{"bad date", "a = 1979-5-27", `invalid value "1979-5-27"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML([]byte(tt.doc))
+			if err == nil {
+				t.Fatalf("parseTOML(%q) succeeded, want an error with %q", tt.doc, tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseTOML(%q) = %v, want an error with %q", tt.doc, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package contacts
+
+import (
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/config"
+)
+
+// Directory resolves channel sender IDs to the contact (identity) that owns them.
+type Directory struct {
+	byID   map[string]string
+	byName map[string][]string
+}
+
+// NewDirectory creates a Directory from the configured contacts.
+func NewDirectory(cfg []config.ContactConfig) *Directory {
+	d := &Directory{byID: make(map[string]string), byName: make(map[string][]string)}
+	for _, contact := range cfg {
+		if contact.Name == "" {
+			continue
+		}
+		for _, id := range contact.IDs {
+			id = strings.TrimSpace(id)
+			d.byID[strings.ToLower(id)] = contact.Name
+			d.byName[strings.ToLower(contact.Name)] = append(d.byName[strings.ToLower(contact.Name)], id)
+		}
+	}
+	return d
+}
+
+// Resolve returns the contact name for a sender on a channel, or "" if unknown.
+func (d *Directory) Resolve(channel, senderID string) string {
+	if d == nil || senderID == "" {
+		return ""
+	}
+
+	// Handle composite IDs like "id|username"
+	for _, part := range strings.Split(senderID, "|") {
+		key := strings.ToLower(channel + ":" + part)
+		if name, ok := d.byID[key]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// IDs returns the sender IDs a contact uses on a channel (case-insensitive name match).
+func (d *Directory) IDs(name, channel string) []string {
+	if d == nil {
+		return nil
+	}
+	var ids []string
+	for _, id := range d.byName[strings.ToLower(strings.TrimSpace(name))] {
+		if parts := strings.SplitN(id, ":", 2); len(parts) == 2 && strings.EqualFold(parts[0], channel) {
+			ids = append(ids, parts[1])
+		}
+	}
+	return ids
+}
@@ -0,0 +1,95 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdayNames = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+
+// Describe renders a schedule in plain words, e.g. "every 2 hours",
+// "daily at 09:00 Asia/Shanghai" or "once at 2024-07-01 18:00".
+func Describe(schedule CronSchedule) string {
+	switch schedule.Kind {
+	case "at":
+		return "once at " + time.UnixMilli(schedule.AtMs).In(schedule.Location()).Format("2006-01-02 15:04")
+	case "every":
+		return "every " + describeInterval(time.Duration(schedule.EveryMs)*time.Millisecond)
+	case "cron":
+		desc := describeExpr(schedule.Expr)
+		if schedule.Tz != "" {
+			desc += " " + schedule.Tz
+		}
+		return desc
+	}
+	return schedule.Kind
+}
+
+func describeInterval(d time.Duration) string {
+	units := []struct {
+		size time.Duration
+		name string
+	}{
+		{24 * time.Hour, "day"},
+		{time.Hour, "hour"},
+		{time.Minute, "minute"},
+		{time.Second, "second"},
+	}
+	for _, u := range units {
+		if d >= u.size && d%u.size == 0 {
+			n := int(d / u.size)
+			if n == 1 {
+				return u.name
+			}
+			return fmt.Sprintf("%d %ss", n, u.name)
+		}
+	}
+	return d.String()
+}
+
+// describeExpr recognizes the common five-field patterns and falls back
+// to quoting the expression.
+func describeExpr(expr string) string {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return fmt.Sprintf("cron '%s'", expr)
+	}
+	minute, hour, dom, month, dow := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	m, errM := strconv.Atoi(minute)
+	h, errH := strconv.Atoi(hour)
+	atTime := errM == nil && errH == nil
+
+	switch {
+	case strings.HasPrefix(minute, "*/") && hour == "*" && dom == "*" && month == "*" && dow == "*":
+		if n, err := strconv.Atoi(minute[2:]); err == nil {
+			return "every " + describeInterval(time.Duration(n)*time.Minute)
+		}
+	case errM == nil && hour == "*" && dom == "*" && month == "*" && dow == "*":
+		return fmt.Sprintf("hourly at :%02d", m)
+	case errM == nil && strings.HasPrefix(hour, "*/") && dom == "*" && month == "*" && dow == "*":
+		if n, err := strconv.Atoi(hour[2:]); err == nil {
+			return fmt.Sprintf("every %s at :%02d", describeInterval(time.Duration(n)*time.Hour), m)
+		}
+	case atTime && dom == "*" && month == "*":
+		at := fmt.Sprintf("%02d:%02d", h, m)
+		switch dow {
+		case "*":
+			return "daily at " + at
+		case "1-5", "MON-FRI", "mon-fri":
+			return "weekdays at " + at
+		case "0,6", "6,0", "SAT,SUN", "sat,sun":
+			return "weekends at " + at
+		}
+		if d, err := strconv.Atoi(dow); err == nil && d >= 0 && d <= 7 {
+			return fmt.Sprintf("every %s at %s", weekdayNames[d%7], at)
+		}
+	case atTime && month == "*" && dow == "*":
+		if d, err := strconv.Atoi(dom); err == nil {
+			return fmt.Sprintf("monthly on day %d at %02d:%02d", d, h, m)
+		}
+	}
+	return fmt.Sprintf("cron '%s'", expr)
+}
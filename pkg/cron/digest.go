@@ -0,0 +1,101 @@
+package cron
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Digest batches cron deliveries per chat. The first delivery to a chat
+// opens a window; everything delivered to that chat before the window
+// closes is sent as one combined message.
+type Digest struct {
+	Window time.Duration
+	Send   func(channel, chatID, content string)
+
+	mu      sync.Mutex
+	pending map[string]*digestBatch // By channel:chatID
+}
+
+type digestBatch struct {
+	channel string
+	chatID  string
+	items   []digestItem
+	timer   *time.Timer
+}
+
+type digestItem struct {
+	title   string
+	content string
+}
+
+// NewDigest creates a Digest that hands combined messages to send. A
+// window of 0 sends every delivery at once.
+func NewDigest(window time.Duration, send func(channel, chatID, content string)) *Digest {
+	return &Digest{
+		Window:  window,
+		Send:    send,
+		pending: make(map[string]*digestBatch),
+	}
+}
+
+// Add queues content from the job titled title for a chat.
+func (d *Digest) Add(channel, chatID, title, content string) {
+	if d.Window <= 0 {
+		d.Send(channel, chatID, content)
+		return
+	}
+
+	key := channel + ":" + chatID
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	b, ok := d.pending[key]
+	if !ok {
+		b = &digestBatch{channel: channel, chatID: chatID}
+		b.timer = time.AfterFunc(d.Window, func() { d.flush(key) })
+		d.pending[key] = b
+	}
+	b.items = append(b.items, digestItem{title: title, content: content})
+}
+
+// Flush sends every pending batch now, e.g. before shutdown.
+func (d *Digest) Flush() {
+	d.mu.Lock()
+	keys := make([]string, 0, len(d.pending))
+	for key, b := range d.pending {
+		b.timer.Stop()
+		keys = append(keys, key)
+	}
+	d.mu.Unlock()
+	for _, key := range keys {
+		d.flush(key)
+	}
+}
+
+func (d *Digest) flush(key string) {
+	d.mu.Lock()
+	b, ok := d.pending[key]
+	delete(d.pending, key)
+	d.mu.Unlock()
+	if ok {
+		d.Send(b.channel, b.chatID, formatDigest(b.items))
+	}
+}
+
+// formatDigest combines the items of a batch. A single item is sent as it is.
+func formatDigest(items []digestItem) string {
+	if len(items) == 1 {
+		return items[0].content
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%d scheduled messages:", len(items)))
+	for _, it := range items {
+		sb.WriteString("\n\n")
+		if it.title != "" {
+			sb.WriteString("[" + it.title + "]\n")
+		}
+		sb.WriteString(strings.TrimSpace(it.content))
+	}
+	return sb.String()
+}
@@ -0,0 +1,37 @@
+package cron
+
+import (
+	"github.com/HKUDS/nanobot-go/pkg/migrate"
+)
+
+// storeVersion is the version of cron.json this build writes.
+const storeVersion = 2
+
+// storeFormat upgrades cron.json from older versions.
+var storeFormat = &migrate.Format{
+	Name:    "cron store",
+	Current: storeVersion,
+	Steps: []migrate.Step{
+		{
+			To:          2,
+			Description: "store payload kinds explicitly (agent_turn for none, message for system_event)",
+			Up: func(doc map[string]interface{}) error {
+				jobs, _ := doc["jobs"].([]interface{})
+				for _, j := range jobs {
+					job, _ := j.(map[string]interface{})
+					payload, _ := job["payload"].(map[string]interface{})
+					if payload == nil {
+						continue
+					}
+					switch payload["kind"] {
+					case nil, "":
+						payload["kind"] = PayloadAgentTurn
+					case "system_event":
+						payload["kind"] = PayloadMessage
+					}
+				}
+				return nil
+			},
+		},
+	},
+}
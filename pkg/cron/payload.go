@@ -0,0 +1,71 @@
+package cron
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ValidatePayload reports whether a payload has what its kind needs to run.
+func ValidatePayload(payload CronPayload) error {
+	switch payload.Kind {
+	case "", PayloadAgentTurn, PayloadMessage, "system_event":
+		if payload.Message == "" {
+			return fmt.Errorf("message is required")
+		}
+	case PayloadShell:
+		if payload.Command == "" {
+			return fmt.Errorf("'shell' payload requires command")
+		}
+	case PayloadWebhook:
+		u, err := url.Parse(payload.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("'webhook' payload requires an http(s) url")
+		}
+	case PayloadOutbound:
+		if len(payload.Outbound) == 0 {
+			return fmt.Errorf("'outbound' payload requires the message")
+		}
+	default:
+		return fmt.Errorf("unknown payload kind %q (expected agent_turn, message, shell, webhook or outbound)", payload.Kind)
+	}
+	return nil
+}
+
+var webhookClient = &http.Client{Timeout: 15 * time.Second}
+
+// PostWebhook sends the job to its payload URL as JSON.
+func PostWebhook(job CronJob) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":      job.ID,
+		"name":    job.Name,
+		"message": job.Payload.Message,
+		"firedAt": time.Now().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, job.Payload.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "nanobot-cron")
+	for k, v := range job.Payload.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package cron
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var exprParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// parseExpr parses a cron expression, applying the schedule's time zone if set.
+func parseExpr(schedule CronSchedule) (cron.Schedule, *time.Location, error) {
+	loc := time.Local
+	if schedule.Tz != "" {
+		l, err := time.LoadLocation(schedule.Tz)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid time zone %q: %w", schedule.Tz, err)
+		}
+		loc = l
+	}
+	sched, err := exprParser.Parse(schedule.Expr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cron expression %q: %w", schedule.Expr, err)
+	}
+	return sched, loc, nil
+}
+
+// Location returns the schedule's time zone, or the local zone if unset or invalid.
+func (s CronSchedule) Location() *time.Location {
+	if s.Tz != "" {
+		if loc, err := time.LoadLocation(s.Tz); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// ValidateSchedule reports why a schedule can never fire, or nil if it is valid.
+func ValidateSchedule(schedule CronSchedule) error {
+	switch schedule.Kind {
+	case "at":
+		if schedule.AtMs <= 0 {
+			return fmt.Errorf("'at' schedule requires atMs")
+		}
+		if schedule.AtMs < time.Now().UnixNano()/int64(time.Millisecond) {
+			return fmt.Errorf("'at' time %s is in the past", time.UnixMilli(schedule.AtMs).Format(time.RFC3339))
+		}
+	case "every":
+		if schedule.EveryMs < 1000 {
+			return fmt.Errorf("'every' schedule requires an interval of at least 1 second")
+		}
+	case "cron":
+		if schedule.Expr == "" {
+			return fmt.Errorf("'cron' schedule requires expr")
+		}
+		if _, _, err := parseExpr(schedule); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown schedule kind %q (expected at, every or cron)", schedule.Kind)
+	}
+	return nil
+}
+
+// NextRuns returns up to n upcoming fire times of a schedule after from.
+func NextRuns(schedule CronSchedule, from time.Time, n int) []time.Time {
+	var runs []time.Time
+	switch schedule.Kind {
+	case "at":
+		if at := time.UnixMilli(schedule.AtMs); schedule.AtMs > 0 && at.After(from) {
+			runs = append(runs, at)
+		}
+	case "every":
+		if schedule.EveryMs > 0 {
+			interval := time.Duration(schedule.EveryMs) * time.Millisecond
+			for i := 1; i <= n; i++ {
+				runs = append(runs, from.Add(time.Duration(i)*interval))
+			}
+		}
+	case "cron":
+		sched, loc, err := parseExpr(schedule)
+		if err != nil {
+			return nil
+		}
+		next := from.In(loc)
+		for i := 0; i < n; i++ {
+			next = sched.Next(next)
+			if next.IsZero() {
+				break
+			}
+			runs = append(runs, next)
+		}
+	}
+	return runs
+}
@@ -3,7 +3,6 @@ package cron
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
@@ -11,26 +10,47 @@ import (
 	"sync"
 	"time"
 
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+	"github.com/HKUDS/nanobot-go/pkg/migrate"
 	"github.com/google/uuid"
-	"github.com/robfig/cron/v3"
 )
 
 // Service manages scheduled jobs.
 type Service struct {
 	StorePath string
-	OnJob     func(CronJob)
+	OnJob     func(CronJob) error
 	store     *CronStore
 	running   bool
 	stopChan  chan struct{}
+	stopOnce  sync.Once
+	wake      chan struct{} // signaled when a job is added, so it can fire before the next poll
 	mu        sync.RWMutex
+	// frozen is set when the store on disk could not be migrated to this
+	// build's version; it is then never overwritten.
+	frozen bool
+	// stamp identifies the store file as last read or written, to notice
+	// changes made by other processes.
+	stamp storeStamp
 }
 
+// storeStamp is the modification time and size of the store file.
+type storeStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// storeCheckInterval is how often the running service looks for changes
+// to the store file and for jobs asked to run.
+const storeCheckInterval = 5 * time.Second
+
 // NewService creates a new cron service.
-func NewService(storePath string, onJob func(CronJob)) *Service {
+func NewService(storePath string, onJob func(CronJob) error) *Service {
+	atrest.Protect(storePath)
 	return &Service{
 		StorePath: storePath,
 		OnJob:     onJob,
 		stopChan:  make(chan struct{}),
+		wake:      make(chan struct{}, 1),
 	}
 }
 
@@ -51,13 +71,12 @@ func (s *Service) computeNextRun(schedule CronSchedule, nowMs int64) int64 {
 	}
 
 	if schedule.Kind == "cron" && schedule.Expr != "" {
-		parser := cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-		sched, err := parser.Parse(schedule.Expr)
+		sched, loc, err := parseExpr(schedule)
 		if err != nil {
-			log.Printf("Error parsing cron expr '%s': %v", schedule.Expr, err)
+			log.Printf("Error parsing cron schedule: %v", err)
 			return 0
 		}
-		now := time.Unix(0, nowMs*int64(time.Millisecond))
+		now := time.Unix(0, nowMs*int64(time.Millisecond)).In(loc)
 		next := sched.Next(now)
 		return next.UnixNano() / int64(time.Millisecond)
 	}
@@ -65,76 +84,131 @@ func (s *Service) computeNextRun(schedule CronSchedule, nowMs int64) int64 {
 	return 0
 }
 
-func (s *Service) loadStore() {
+// refresh loads the store, or reloads it when another process, such as
+// `nanobot cron`, changed the file since it was last read or written.
+func (s *Service) refresh() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.store != nil {
+	if s.store == nil {
+		s.readStoreLocked(true)
 		return
 	}
-
-	s.store = &CronStore{Version: 1, Jobs: []CronJob{}}
-
-	if _, err := os.Stat(s.StorePath); os.IsNotExist(err) {
+	if s.statStore() == s.stamp {
 		return
 	}
+	if s.running {
+		log.Printf("Cron store changed on disk, reloading")
+	}
+	s.readStoreLocked(false)
+}
 
-	data, err := ioutil.ReadFile(s.StorePath)
+// statStore returns the modification time and size of the store file.
+func (s *Service) statStore() storeStamp {
+	info, err := os.Stat(s.StorePath)
 	if err != nil {
-		log.Printf("Failed to load cron store: %v", err)
-		return
+		return storeStamp{}
 	}
+	return storeStamp{modTime: info.ModTime(), size: info.Size()}
+}
 
-	if err := json.Unmarshal(data, s.store); err != nil {
-		log.Printf("Failed to parse cron store: %v", err)
+// readStoreLocked reads the store file, upgrading it from older versions.
+// On the first load a file that cannot be read freezes the store; on a
+// reload the jobs in memory are kept until the file changes again.
+func (s *Service) readStoreLocked(first bool) {
+	s.stamp = s.statStore()
+	if first {
+		s.store = &CronStore{Version: storeVersion, Jobs: []CronJob{}}
+	}
+	if s.stamp == (storeStamp{}) {
+		return
 	}
-}
 
-func (s *Service) saveStore() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	data, err := atrest.ReadFile(s.StorePath)
+	if err != nil {
+		if first {
+			log.Printf("Failed to load cron store, changes will not be saved: %v", err)
+			s.frozen = true
+		} else {
+			log.Printf("Failed to reload cron store: %v", err)
+		}
+		return
+	}
 
-	if s.store == nil {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		if first {
+			log.Printf("Failed to parse cron store, changes will not be saved: %v", err)
+			s.frozen = true
+		} else {
+			log.Printf("Failed to parse cron store on reload: %v", err)
+		}
 		return
 	}
+	frozen := false
+	version := migrate.Version(doc, "version")
+	changed, err := storeFormat.Upgrade(doc, version)
+	if err != nil {
+		// Load what parses, but keep the file as it is
+		log.Printf("Cron store will not be saved: %v", err)
+		frozen = true
+	} else if changed {
+		if err := migrate.Backup(s.StorePath, version); err != nil {
+			log.Printf("Failed to back up cron store: %v", err)
+			frozen = true
+		}
+		data, _ = json.Marshal(doc)
+	}
 
-	dir := filepath.Dir(s.StorePath)
-	os.MkdirAll(dir, 0755)
+	store := &CronStore{Version: storeVersion, Jobs: []CronJob{}}
+	if err := json.Unmarshal(data, store); err != nil {
+		log.Printf("Failed to parse cron store: %v", err)
+	}
+	s.store, s.frozen = store, frozen
+	if changed && !s.frozen {
+		s.store.Version = storeVersion
+		s.saveStoreLocked()
+	}
+}
 
-	data, err := json.MarshalIndent(s.store, "", "  ")
-	if err != nil {
-		log.Printf("Failed to marshal cron store: %v", err)
-		return
+// modify changes the store with fn while holding the lock on the store
+// file, after reloading the file if another process changed it, and saves
+// the store when fn reports a change. Every process writes the store this
+// way, so none overwrites changes it has not seen.
+func (s *Service) modify(fn func() bool) {
+	os.MkdirAll(filepath.Dir(s.StorePath), 0755)
+	if unlock, err := lockFile(s.StorePath + ".lock"); err != nil {
+		log.Printf("Failed to lock cron store: %v", err)
+	} else {
+		defer unlock()
 	}
+	s.refresh()
 
-	if err := ioutil.WriteFile(s.StorePath, data, 0644); err != nil {
-		log.Printf("Failed to save cron store: %v", err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fn() {
+		s.saveStoreLocked()
 	}
 }
 
 // Start starts the cron service.
 func (s *Service) Start() {
-	s.loadStore()
-	s.recomputeNextRuns()
-	s.saveStore()
+	s.modify(func() bool {
+		s.recomputeNextRunsLocked()
+		return true
+	})
 	s.running = true
 	go s.loop()
 	log.Printf("Cron service started with %d jobs", len(s.store.Jobs))
 }
 
-// Stop stops the cron service.
+// Stop stops the cron service. It is safe to call more than once.
 func (s *Service) Stop() {
 	s.running = false
-	close(s.stopChan)
+	s.stopOnce.Do(func() { close(s.stopChan) })
 }
 
-func (s *Service) recomputeNextRuns() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if s.store == nil {
-		return
-	}
+func (s *Service) recomputeNextRunsLocked() {
 	now := s.nowMs()
 	for i := range s.store.Jobs {
 		job := &s.store.Jobs[i]
@@ -168,6 +242,8 @@ func (s *Service) loop() {
 		if !s.running {
 			return
 		}
+		s.refresh()
+		s.runRequested()
 
 		nextWake := s.getNextWakeMs()
 		now := s.nowMs()
@@ -181,17 +257,18 @@ func (s *Service) loop() {
 			}
 		} else {
 			// No jobs scheduled, check periodically
-			delay = 10 * time.Second 
+			delay = storeCheckInterval
 		}
 
-		// Cap max delay to avoid sleeping too long if new jobs added
-		if delay > 10*time.Second {
-			delay = 10 * time.Second
+		// Cap max delay to notice jobs added by other processes
+		if delay > storeCheckInterval {
+			delay = storeCheckInterval
 		}
 
 		select {
 		case <-s.stopChan:
 			return
+		case <-s.wake:
 		case <-time.After(delay):
 			s.processJobs()
 		}
@@ -199,6 +276,7 @@ func (s *Service) loop() {
 }
 
 func (s *Service) processJobs() {
+	s.refresh()
 	s.mu.Lock()
 	// Copy jobs to avoid holding lock during execution
 	// But we need to update state, so we just identify indices
@@ -230,42 +308,44 @@ func (s *Service) processJobs() {
 
 		s.executeJob(&job)
 
-		// Update state after execution
-		s.mu.Lock()
-		// Need to find job again by ID because slice might have changed (though we are single threaded in loop)
-		// But Add/Remove might happen concurrently.
-		// Safe approach: find by ID
-		storeIdx := -1
-		for i, j := range s.store.Jobs {
-			if j.ID == job.ID {
-				storeIdx = i
-				break
+		// Update state after execution, keeping changes other processes
+		// made to the job meanwhile
+		s.modify(func() bool {
+			storeIdx := -1
+			for i, j := range s.store.Jobs {
+				if j.ID == job.ID {
+					storeIdx = i
+					break
+				}
+			}
+			if storeIdx == -1 {
+				return false
 			}
-		}
 
-		if storeIdx != -1 {
-			s.store.Jobs[storeIdx] = job // Update job in store with new state
-			
+			stored := &s.store.Jobs[storeIdx]
+			recordRun(stored, job)
 			// Handle one-shot
-			if job.Schedule.Kind == "at" {
-				if job.DeleteAfterRun {
-					// Remove
+			if stored.Schedule.Kind == "at" {
+				if stored.DeleteAfterRun {
 					s.store.Jobs = append(s.store.Jobs[:storeIdx], s.store.Jobs[storeIdx+1:]...)
 				} else {
-					s.store.Jobs[storeIdx].Enabled = false
-					s.store.Jobs[storeIdx].State.NextRunAtMs = 0
+					stored.Enabled = false
+					stored.State.NextRunAtMs = 0
 				}
 			} else {
-				// Recompute next
-				s.store.Jobs[storeIdx].State.NextRunAtMs = s.computeNextRun(job.Schedule, s.nowMs())
+				stored.State.NextRunAtMs = s.computeNextRun(stored.Schedule, s.nowMs())
 			}
-		}
-		s.mu.Unlock()
+			return true
+		})
 	}
+}
 
-	if len(dueIndices) > 0 {
-		s.saveStore()
-	}
+// recordRun copies the outcome of running a copy of a job to the job.
+func recordRun(job *CronJob, ran CronJob) {
+	job.State.LastRunAtMs = ran.State.LastRunAtMs
+	job.State.LastStatus = ran.State.LastStatus
+	job.State.LastError = ran.State.LastError
+	job.UpdatedAtMs = ran.UpdatedAtMs
 }
 
 func (s *Service) executeJob(job *CronJob) {
@@ -280,19 +360,25 @@ func (s *Service) executeJob(job *CronJob) {
 		}
 	}()
 
-	if s.OnJob != nil {
-		s.OnJob(*job)
-	}
-
 	job.State.LastStatus = "ok"
 	job.State.LastError = ""
 	job.State.LastRunAtMs = startMs
+
+	if s.OnJob != nil {
+		if err := s.OnJob(*job); err != nil {
+			log.Printf("Cron: job '%s' (%s) failed: %v", job.Name, job.ID, err)
+			job.State.LastStatus = "error"
+			job.State.LastError = err.Error()
+		}
+	}
+
 	job.UpdatedAtMs = s.nowMs()
 }
 
 // Public API
 
 func (s *Service) ListJobs() []CronJob {
+	s.refresh()
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	if s.store == nil {
@@ -315,29 +401,26 @@ func (s *Service) ListJobs() []CronJob {
 	return jobs
 }
 
-func (s *Service) AddJob(name string, schedule CronSchedule, message string, deliver bool, channel, to string, deleteAfterRun bool) CronJob {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if s.store == nil {
-		s.store = &CronStore{Version: 1, Jobs: []CronJob{}}
+// AddJob validates the schedule and payload and adds a new job.
+// An empty payload kind defaults to agent_turn.
+func (s *Service) AddJob(name string, schedule CronSchedule, payload CronPayload, deleteAfterRun bool) (CronJob, error) {
+	if err := ValidateSchedule(schedule); err != nil {
+		return CronJob{}, err
+	}
+	if err := ValidatePayload(payload); err != nil {
+		return CronJob{}, err
+	}
+	if payload.Kind == "" {
+		payload.Kind = PayloadAgentTurn
 	}
 
 	now := s.nowMs()
-	id := uuid.New().String()[:8]
-
 	job := CronJob{
-		ID:      id,
-		Name:    name,
-		Enabled: true,
+		ID:       uuid.New().String()[:8],
+		Name:     name,
+		Enabled:  true,
 		Schedule: schedule,
-		Payload: CronPayload{
-			Kind:    "agent_turn",
-			Message: message,
-			Deliver: deliver,
-			Channel: channel,
-			To:      to,
-		},
+		Payload:  payload,
 		State: CronJobState{
 			NextRunAtMs: s.computeNextRun(schedule, now),
 		},
@@ -345,49 +428,179 @@ func (s *Service) AddJob(name string, schedule CronSchedule, message string, del
 		UpdatedAtMs:    now,
 		DeleteAfterRun: deleteAfterRun,
 	}
+	s.modify(func() bool {
+		s.store.Jobs = append(s.store.Jobs, job)
+		return true
+	})
 
-	s.store.Jobs = append(s.store.Jobs, job)
-	
-	// Trigger save implicitly by returning, caller might assume it persists? 
-	// Ideally we save here.
-	// We can't call s.saveStore() because we hold the lock.
-	// Refactor saveStore to internal _saveStore
-	s.saveStoreLocked()
-	
-	return job
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
 }
 
 func (s *Service) saveStoreLocked() {
-	if s.store == nil {
+	if s.store == nil || s.frozen {
 		return
 	}
+
 	dir := filepath.Dir(s.StorePath)
 	os.MkdirAll(dir, 0755)
-	data, _ := json.MarshalIndent(s.store, "", "  ")
-	ioutil.WriteFile(s.StorePath, data, 0644)
+
+	data, err := json.MarshalIndent(s.store, "", "  ")
+	if err != nil {
+		log.Printf("Failed to marshal cron store: %v", err)
+		return
+	}
+
+	if err := atrest.WriteFileAtomic(s.StorePath, data, 0644); err != nil {
+		log.Printf("Failed to save cron store: %v", err)
+		return
+	}
+	s.stamp = s.statStore()
 }
 
 func (s *Service) RemoveJob(jobID string) bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	found := false
+	s.modify(func() bool {
+		newJobs := make([]CronJob, 0, len(s.store.Jobs))
+		for _, job := range s.store.Jobs {
+			if job.ID == jobID {
+				found = true
+				continue
+			}
+			newJobs = append(newJobs, job)
+		}
+		if found {
+			s.store.Jobs = newJobs
+		}
+		return found
+	})
+	return found
+}
+
+// GetJob returns a copy of the job with the given ID.
+func (s *Service) GetJob(jobID string) (CronJob, bool) {
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
 	if s.store == nil {
+		return CronJob{}, false
+	}
+	for _, job := range s.store.Jobs {
+		if job.ID == jobID {
+			return job, true
+		}
+	}
+	return CronJob{}, false
+}
+
+// UpdateJob applies update to the job with the given ID and persists the store.
+// The next run is recomputed when the schedule changes or the job is re-enabled.
+func (s *Service) UpdateJob(jobID string, update func(job *CronJob)) (CronJob, bool) {
+	var updated CronJob
+	found := false
+	s.modify(func() bool {
+		for i := range s.store.Jobs {
+			job := &s.store.Jobs[i]
+			if job.ID != jobID {
+				continue
+			}
+
+			prev := *job
+			update(job)
+			job.UpdatedAtMs = s.nowMs()
+			if !job.Enabled {
+				job.State.NextRunAtMs = 0
+			} else if job.Schedule != prev.Schedule || !prev.Enabled || job.State.NextRunAtMs == 0 {
+				job.State.NextRunAtMs = s.computeNextRun(job.Schedule, job.UpdatedAtMs)
+			}
+			updated, found = *job, true
+			return true
+		}
 		return false
+	})
+	return updated, found
+}
+
+// RunJob executes a job immediately without changing its schedule.
+func (s *Service) RunJob(jobID string) (CronJob, bool) {
+	job, ok := s.GetJob(jobID)
+	if !ok {
+		return CronJob{}, false
 	}
 
-	newJobs := make([]CronJob, 0, len(s.store.Jobs))
+	s.executeJob(&job)
+
+	result := job
+	s.modify(func() bool {
+		for i := range s.store.Jobs {
+			if s.store.Jobs[i].ID == jobID {
+				recordRun(&s.store.Jobs[i], job)
+				result = s.store.Jobs[i]
+				return true
+			}
+		}
+		return false
+	})
+	return result, true
+}
+
+// RequestRun asks the running service, possibly in another process, to run
+// a job as soon as it next checks the store, without changing its schedule.
+func (s *Service) RequestRun(jobID string) (CronJob, bool) {
+	var requested CronJob
 	found := false
+	s.modify(func() bool {
+		for i := range s.store.Jobs {
+			if s.store.Jobs[i].ID == jobID {
+				s.store.Jobs[i].State.RunRequestedAtMs = s.nowMs()
+				requested, found = s.store.Jobs[i], true
+				return true
+			}
+		}
+		return false
+	})
+	return requested, found
+}
+
+// runRequested runs the jobs asked to run with RequestRun. The requests are
+// cleared first so a job that crashes the process is not run again.
+func (s *Service) runRequested() {
+	var ids []string
+	s.mu.RLock()
 	for _, job := range s.store.Jobs {
-		if job.ID == jobID {
-			found = true
-			continue
+		if job.State.RunRequestedAtMs > 0 {
+			ids = append(ids, job.ID)
 		}
-		newJobs = append(newJobs, job)
+	}
+	s.mu.RUnlock()
+	if len(ids) == 0 {
+		return
 	}
 
-	if found {
-		s.store.Jobs = newJobs
-		s.saveStoreLocked()
+	s.modify(func() bool {
+		ids = ids[:0]
+		for i := range s.store.Jobs {
+			if s.store.Jobs[i].State.RunRequestedAtMs > 0 {
+				s.store.Jobs[i].State.RunRequestedAtMs = 0
+				ids = append(ids, s.store.Jobs[i].ID)
+			}
+		}
+		return len(ids) > 0
+	})
+	for _, id := range ids {
+		s.RunJob(id)
 	}
-	return found
+}
+
+// Frozen reports whether the store on disk could not be read or upgraded,
+// in which case changes are not saved.
+func (s *Service) Frozen() bool {
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.frozen
 }
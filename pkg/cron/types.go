@@ -1,5 +1,7 @@
 package cron
 
+import "encoding/json"
+
 // CronSchedule definition.
 type CronSchedule struct {
 	Kind    string `json:"kind"` // at, every, cron
@@ -9,13 +11,27 @@ type CronSchedule struct {
 	Tz      string `json:"tz,omitempty"`
 }
 
+// Payload kinds.
+const (
+	PayloadAgentTurn = "agent_turn" // Run the message through the agent
+	PayloadMessage   = "message"    // Deliver the message as-is, without an LLM call
+	PayloadShell     = "shell"      // Run Command and deliver its output
+	PayloadWebhook   = "webhook"    // POST the job to URL
+	PayloadOutbound  = "outbound"   // Publish Outbound, a message composed earlier, unchanged
+)
+
 // CronPayload definition.
 type CronPayload struct {
-	Kind    string `json:"kind"` // system_event, agent_turn
-	Message string `json:"message"`
-	Deliver bool   `json:"deliver"`
-	Channel string `json:"channel,omitempty"`
-	To      string `json:"to,omitempty"`
+	Kind    string            `json:"kind"` // agent_turn, message, shell, webhook, outbound (system_event is treated as message)
+	Message string            `json:"message"`
+	Deliver bool              `json:"deliver"`
+	Channel string            `json:"channel,omitempty"`
+	To      string            `json:"to,omitempty"`
+	Command string            `json:"command,omitempty"` // shell
+	URL     string            `json:"url,omitempty"`     // webhook
+	Headers map[string]string `json:"headers,omitempty"` // webhook
+	// Outbound is the message to publish, as JSON (outbound)
+	Outbound json.RawMessage `json:"outbound,omitempty"`
 }
 
 // CronJobState runtime state.
@@ -24,6 +40,9 @@ type CronJobState struct {
 	LastRunAtMs int64  `json:"lastRunAtMs,omitempty"`
 	LastStatus  string `json:"lastStatus,omitempty"` // ok, error, skipped
 	LastError   string `json:"lastError,omitempty"`
+	// RunRequestedAtMs is set by `nanobot cron run` for the running service
+	// to run the job now.
+	RunRequestedAtMs int64 `json:"runRequestedAtMs,omitempty"`
 }
 
 // CronJob definition.
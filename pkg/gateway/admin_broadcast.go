@@ -0,0 +1,74 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+)
+
+// BroadcastAPI sends announcements under /api/admin/broadcast.
+//
+//	POST /api/admin/broadcast   send a message to several chats  {"content": "...", "targets": ["telegram:123", ...]}
+type BroadcastAPI struct {
+	Bus *bus.MessageBus
+}
+
+// NewBroadcastAPI creates a new BroadcastAPI.
+func NewBroadcastAPI(messageBus *bus.MessageBus) *BroadcastAPI {
+	return &BroadcastAPI{Bus: messageBus}
+}
+
+// Register mounts the broadcast endpoint on the server.
+func (a *BroadcastAPI) Register(s *Server) {
+	s.HandleAdmin("/api/admin/broadcast", a.handleBroadcast)
+}
+
+var errChannelNotRunning = errors.New("channel is not running")
+
+type broadcastRequest struct {
+	Content string   `json:"content"`
+	Targets []string `json:"targets"`
+}
+
+type broadcastResult struct {
+	Target string `json:"target"`
+	OK     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (a *BroadcastAPI) handleBroadcast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var req broadcastRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" || len(req.Targets) == 0 {
+		writeError(w, http.StatusBadRequest, "content and targets are required")
+		return
+	}
+
+	var targets []bus.Target
+	results := make([]broadcastResult, 0, len(req.Targets))
+	for _, s := range req.Targets {
+		t, err := bus.ParseTarget(s)
+		if err == nil && !a.Bus.HasSubscribers(t.Channel) {
+			err = errChannelNotRunning
+		}
+		if err != nil {
+			results = append(results, broadcastResult{Target: s, Error: err.Error()})
+			continue
+		}
+		targets = append(targets, t)
+		results = append(results, broadcastResult{Target: s, OK: true})
+	}
+
+	a.Bus.Broadcast(bus.OutboundMessage{Type: bus.MessageTypeText, Content: req.Content}, targets)
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"sent": len(targets), "results": results})
+}
@@ -0,0 +1,50 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+)
+
+// BusAPI exposes message bus health under /api/admin/bus.
+//
+//	GET /api/admin/bus?dead_letters=N   queue sizes, counters and the N latest dead letters (default 20)
+type BusAPI struct {
+	Bus *bus.MessageBus
+}
+
+// NewBusAPI creates a new BusAPI.
+func NewBusAPI(messageBus *bus.MessageBus) *BusAPI {
+	return &BusAPI{Bus: messageBus}
+}
+
+// Register mounts the bus endpoints on the server.
+func (a *BusAPI) Register(s *Server) {
+	s.HandleAdmin("/api/admin/bus", a.handleStats)
+}
+
+func (a *BusAPI) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	limit := 20
+	if v := r.URL.Query().Get("dead_letters"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "dead_letters must be a non-negative integer")
+			return
+		}
+		limit = n
+	}
+	letters, err := a.Bus.DeadLetters(limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if letters == nil || limit == 0 {
+		letters = []bus.DeadLetter{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"stats": a.Bus.Stats(), "deadLetters": letters})
+}
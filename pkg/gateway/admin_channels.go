@@ -0,0 +1,36 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/HKUDS/nanobot-go/pkg/channels"
+)
+
+// ChannelAPI exposes channel health under /api/admin/channels.
+//
+//	GET /api/admin/channels   connection state, last traffic and recent errors per channel
+type ChannelAPI struct {
+	Monitor *channels.Monitor
+}
+
+// NewChannelAPI creates a new ChannelAPI.
+func NewChannelAPI(monitor *channels.Monitor) *ChannelAPI {
+	return &ChannelAPI{Monitor: monitor}
+}
+
+// Register mounts the channel endpoints on the server.
+func (a *ChannelAPI) Register(s *Server) {
+	s.HandleAdmin("/api/admin/channels", a.handleList)
+}
+
+func (a *ChannelAPI) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	statuses := a.Monitor.Snapshot()
+	if statuses == nil {
+		statuses = []channels.ChannelStatus{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"channels": statuses})
+}
@@ -0,0 +1,237 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/cron"
+)
+
+// CronAPI exposes cron job management under /api/admin/cron/jobs.
+//
+//	GET    /api/admin/cron/jobs           list jobs
+//	POST   /api/admin/cron/jobs           add a job
+//	GET    /api/admin/cron/jobs/{id}      get a job
+//	PATCH  /api/admin/cron/jobs/{id}      update a job (PUT is accepted too)
+//	DELETE /api/admin/cron/jobs/{id}      remove a job
+//	POST   /api/admin/cron/jobs/{id}/run  run a job now
+type CronAPI struct {
+	Service *cron.Service
+}
+
+// NewCronAPI creates a new CronAPI.
+func NewCronAPI(service *cron.Service) *CronAPI {
+	return &CronAPI{Service: service}
+}
+
+// Register mounts the cron endpoints on the server.
+func (a *CronAPI) Register(s *Server) {
+	s.HandleAdmin("/api/admin/cron/jobs", a.handleJobs)
+	s.HandleAdmin("/api/admin/cron/jobs/", a.handleJob)
+}
+
+// cronJobRequest is the body for add and update. Pointer fields are optional on update.
+type cronJobRequest struct {
+	Name           *string            `json:"name"`
+	Kind           *string            `json:"kind"`
+	Message        *string            `json:"message"`
+	Command        *string            `json:"command"`
+	URL            *string            `json:"url"`
+	Headers        map[string]string  `json:"headers"`
+	Schedule       *cron.CronSchedule `json:"schedule"`
+	Enabled        *bool              `json:"enabled"`
+	Deliver        *bool              `json:"deliver"`
+	Channel        *string            `json:"channel"`
+	To             *string            `json:"to"`
+	DeleteAfterRun *bool              `json:"deleteAfterRun"`
+}
+
+// applyPayload copies the payload fields set in the request onto p.
+func (req *cronJobRequest) applyPayload(p *cron.CronPayload) {
+	if req.Kind != nil {
+		p.Kind = *req.Kind
+	}
+	if req.Message != nil {
+		p.Message = *req.Message
+	}
+	if req.Command != nil {
+		p.Command = *req.Command
+	}
+	if req.URL != nil {
+		p.URL = *req.URL
+	}
+	if req.Deliver != nil {
+		p.Deliver = *req.Deliver
+	}
+	if req.Channel != nil {
+		p.Channel = *req.Channel
+	}
+	if req.To != nil {
+		p.To = *req.To
+	}
+}
+
+func (a *CronAPI) handleJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		jobs := a.Service.ListJobs()
+		if jobs == nil {
+			jobs = []cron.CronJob{}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"jobs": jobs})
+	case http.MethodPost:
+		a.addJob(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (a *CronAPI) addJob(w http.ResponseWriter, r *http.Request) {
+	var req cronJobRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Schedule == nil || req.Schedule.Kind == "" {
+		writeError(w, http.StatusBadRequest, "schedule is required")
+		return
+	}
+
+	payload := cron.CronPayload{Deliver: true, Headers: req.Headers}
+	req.applyPayload(&payload)
+
+	name := payload.Message
+	if req.Name != nil && *req.Name != "" {
+		name = *req.Name
+	}
+	if name == "" {
+		name = payload.Command + payload.URL
+	}
+	deleteAfterRun := req.Schedule.Kind == "at"
+	if req.DeleteAfterRun != nil {
+		deleteAfterRun = *req.DeleteAfterRun
+	}
+
+	job, err := a.Service.AddJob(name, *req.Schedule, payload, deleteAfterRun)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Enabled != nil && !*req.Enabled {
+		job, _ = a.Service.UpdateJob(job.ID, func(j *cron.CronJob) { j.Enabled = false })
+	}
+	writeJSON(w, http.StatusCreated, withNextRuns(job))
+}
+
+// cronJobResponse is a job with a readable schedule and a preview of its upcoming fire times.
+type cronJobResponse struct {
+	cron.CronJob
+	Description string   `json:"description"`
+	NextRuns    []string `json:"nextRuns"`
+}
+
+func withNextRuns(job cron.CronJob) cronJobResponse {
+	resp := cronJobResponse{CronJob: job, Description: cron.Describe(job.Schedule), NextRuns: []string{}}
+	if job.Enabled {
+		for _, t := range cron.NextRuns(job.Schedule, time.Now(), 3) {
+			resp.NextRuns = append(resp.NextRuns, t.Format(time.RFC3339))
+		}
+	}
+	return resp
+}
+
+func (a *CronAPI) handleJob(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin/cron/jobs/"), "/")
+	parts := strings.Split(rest, "/")
+	jobID := parts[0]
+	if jobID == "" {
+		a.handleJobs(w, r)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "run" {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		job, ok := a.Service.RunJob(jobID)
+		if !ok {
+			writeError(w, http.StatusNotFound, "job not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+		return
+	}
+	if len(parts) > 1 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		job, ok := a.Service.GetJob(jobID)
+		if !ok {
+			writeError(w, http.StatusNotFound, "job not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, withNextRuns(job))
+	case http.MethodPatch, http.MethodPut:
+		a.updateJob(w, r, jobID)
+	case http.MethodDelete:
+		if !a.Service.RemoveJob(jobID) {
+			writeError(w, http.StatusNotFound, "job not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "removed", "id": jobID})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (a *CronAPI) updateJob(w http.ResponseWriter, r *http.Request, jobID string) {
+	var req cronJobRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Schedule != nil {
+		if err := cron.ValidateSchedule(*req.Schedule); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if current, ok := a.Service.GetJob(jobID); ok {
+		payload := current.Payload
+		req.applyPayload(&payload)
+		if err := cron.ValidatePayload(payload); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	job, ok := a.Service.UpdateJob(jobID, func(j *cron.CronJob) {
+		if req.Name != nil {
+			j.Name = *req.Name
+		}
+		req.applyPayload(&j.Payload)
+		if req.Headers != nil {
+			j.Payload.Headers = req.Headers
+		}
+		if req.Schedule != nil {
+			j.Schedule = *req.Schedule
+		}
+		if req.Enabled != nil {
+			j.Enabled = *req.Enabled
+		}
+		if req.DeleteAfterRun != nil {
+			j.DeleteAfterRun = *req.DeleteAfterRun
+		}
+	})
+	if !ok {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, withNextRuns(job))
+}
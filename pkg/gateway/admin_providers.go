@@ -0,0 +1,34 @@
+package gateway
+
+import (
+	"net/http"
+)
+
+// ProviderAPI exposes provider management under /api/admin/providers.
+//
+//	POST /api/admin/providers/reload   re-read API keys from the config file
+type ProviderAPI struct {
+	Reload func() error
+}
+
+// NewProviderAPI creates a new ProviderAPI.
+func NewProviderAPI(reload func() error) *ProviderAPI {
+	return &ProviderAPI{Reload: reload}
+}
+
+// Register mounts the provider endpoints on the server.
+func (a *ProviderAPI) Register(s *Server) {
+	s.HandleAdmin("/api/admin/providers/reload", a.handleReload)
+}
+
+func (a *ProviderAPI) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if err := a.Reload(); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "reloaded"})
+}
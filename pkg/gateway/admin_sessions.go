@@ -0,0 +1,152 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/session"
+)
+
+// SessionAPI exposes bulk session administration under /api/admin/sessions.
+//
+//	GET  /api/admin/sessions?idle_days=N   list sessions (optionally only idle ones)
+//	POST /api/admin/sessions/clear         delete sessions   {"keys": [...]}
+//	POST /api/admin/sessions/archive       archive sessions  {"keys": [...]}
+//	POST /api/admin/sessions/export        export sessions   {"keys": [...]} (empty = all)
+type SessionAPI struct {
+	Sessions *session.Manager
+}
+
+// NewSessionAPI creates a new SessionAPI.
+func NewSessionAPI(sessions *session.Manager) *SessionAPI {
+	return &SessionAPI{Sessions: sessions}
+}
+
+// Register mounts the session endpoints on the server.
+func (a *SessionAPI) Register(s *Server) {
+	s.HandleAdmin("/api/admin/sessions", a.handleList)
+	s.HandleAdmin("/api/admin/sessions/clear", a.handleClear)
+	s.HandleAdmin("/api/admin/sessions/archive", a.handleArchive)
+	s.HandleAdmin("/api/admin/sessions/export", a.handleExport)
+}
+
+type sessionKeysRequest struct {
+	Keys []string `json:"keys"`
+}
+
+type sessionResult struct {
+	Key     string `json:"key"`
+	OK      bool   `json:"ok"`
+	Archive string `json:"archive,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (a *SessionAPI) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	infos, err := a.Sessions.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if v := r.URL.Query().Get("idle_days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			writeError(w, http.StatusBadRequest, "idle_days must be a non-negative integer")
+			return
+		}
+		infos = session.FilterIdle(infos, time.Duration(days)*24*time.Hour)
+	}
+	if infos == nil {
+		infos = []session.Info{}
+	}
+
+	var totalBytes int64
+	for _, info := range infos {
+		totalBytes += info.SizeBytes
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sessions":    infos,
+		"count":       len(infos),
+		"total_bytes": totalBytes,
+	})
+}
+
+func (a *SessionAPI) decodeKeys(w http.ResponseWriter, r *http.Request, required bool) ([]string, bool) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return nil, false
+	}
+	var req sessionKeysRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return nil, false
+	}
+	if required && len(req.Keys) == 0 {
+		writeError(w, http.StatusBadRequest, "keys is required")
+		return nil, false
+	}
+	return req.Keys, true
+}
+
+func (a *SessionAPI) handleClear(w http.ResponseWriter, r *http.Request) {
+	keys, ok := a.decodeKeys(w, r, true)
+	if !ok {
+		return
+	}
+	results := make([]sessionResult, 0, len(keys))
+	for _, key := range keys {
+		res := sessionResult{Key: key, OK: true}
+		if err := a.Sessions.Clear(key); err != nil {
+			res.OK = false
+			res.Error = err.Error()
+		}
+		results = append(results, res)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+}
+
+func (a *SessionAPI) handleArchive(w http.ResponseWriter, r *http.Request) {
+	keys, ok := a.decodeKeys(w, r, true)
+	if !ok {
+		return
+	}
+	results := make([]sessionResult, 0, len(keys))
+	for _, key := range keys {
+		res := sessionResult{Key: key, OK: true}
+		path, err := a.Sessions.Archive(key)
+		if err != nil {
+			res.OK = false
+			res.Error = err.Error()
+		}
+		res.Archive = path
+		results = append(results, res)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"results": results})
+}
+
+func (a *SessionAPI) handleExport(w http.ResponseWriter, r *http.Request) {
+	keys, ok := a.decodeKeys(w, r, false)
+	if !ok {
+		return
+	}
+	sessions, err := a.Sessions.Export(keys)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if sessions == nil {
+		sessions = []*session.Session{}
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="sessions-export.json"`)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"exported_at": time.Now().Format(time.RFC3339),
+		"sessions":    sessions,
+	})
+}
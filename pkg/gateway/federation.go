@@ -0,0 +1,200 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/config"
+)
+
+// delegationTTL is how long a peer may answer a delegated task.
+const delegationTTL = 24 * time.Hour
+
+// Federation is the "federation" channel, linking this nanobot to other
+// instances. Peers post to /api/federation/message on each other's
+// gateway, authenticated with the token they share.
+//
+// A task delegated to a peer arrives there as a message from a chat named
+// "<our name>:<chat waiting for the answer>", so each of our chats gets
+// its own session on the peer. The peer's replies to that chat come back
+// to the waiting chat as a system message, which the agent relays to the
+// user; they are never answered, so two agents cannot talk in circles.
+type Federation struct {
+	Config *config.FederationConfig
+	Bus    *bus.MessageBus
+	client *http.Client
+
+	mu      sync.Mutex
+	pending map[string]time.Time // peer and waiting chat -> when its answer stops being accepted
+}
+
+// federationMessage is what peers post to each other.
+type federationMessage struct {
+	From    string `json:"from"`
+	Kind    string `json:"kind"`               // request, reply
+	ReplyTo string `json:"reply_to,omitempty"` // the requester's chat waiting for the answer
+	Content string `json:"content"`
+}
+
+// NewFederation creates a new Federation.
+func NewFederation(cfg *config.FederationConfig, messageBus *bus.MessageBus) *Federation {
+	return &Federation{
+		Config:  cfg,
+		Bus:     messageBus,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		pending: make(map[string]time.Time),
+	}
+}
+
+func (f *Federation) Name() string {
+	return "federation"
+}
+
+// Register mounts the endpoint peers post messages to.
+func (f *Federation) Register(s *Server) {
+	s.HandleFunc("/api/federation/message", f.handleMessage)
+}
+
+// Peers returns the configured peers and what they are good for.
+func (f *Federation) Peers() map[string]string {
+	peers := make(map[string]string, len(f.Config.Peers))
+	for name, p := range f.Config.Peers {
+		peers[name] = p.Description
+	}
+	return peers
+}
+
+// Delegate sends a task to a peer. Its answer is delivered to the chat
+// originChannel:originChatID.
+func (f *Federation) Delegate(peer, task, originChannel, originChatID string) error {
+	replyTo := originChannel + ":" + originChatID
+	f.mu.Lock()
+	now := time.Now()
+	for key, until := range f.pending {
+		if now.After(until) {
+			delete(f.pending, key)
+		}
+	}
+	f.pending[peer+"\x00"+replyTo] = now.Add(delegationTTL)
+	f.mu.Unlock()
+	return f.post(peer, federationMessage{Kind: "request", ReplyTo: replyTo, Content: task})
+}
+
+// Send posts an outbound message for chat "<peer>[:<peer's waiting chat>]"
+// to the peer as a reply.
+func (f *Federation) Send(msg bus.OutboundMessage) error {
+	peer, replyTo, _ := strings.Cut(msg.ChatID, ":")
+	content := msg.Content
+	if msg.Stream != nil {
+		var sb strings.Builder
+		for chunk := range msg.Stream {
+			sb.WriteString(chunk)
+		}
+		content += sb.String()
+	}
+	if msg.Media != "" {
+		content += fmt.Sprintf("\n[%s: %s]", msg.Type, msg.Media)
+	}
+	if strings.TrimSpace(content) == "" {
+		return nil
+	}
+	return f.post(peer, federationMessage{Kind: "reply", ReplyTo: replyTo, Content: content})
+}
+
+func (f *Federation) post(peer string, msg federationMessage) error {
+	p, ok := f.Config.Peers[peer]
+	if !ok {
+		return fmt.Errorf("unknown peer %q", peer)
+	}
+	msg.From = f.Config.Name
+	body, _ := json.Marshal(msg)
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(p.URL, "/")+"/api/federation/message", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.Token)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("peer %s: StatusCode: %d: %s", peer, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+func (f *Federation) handleMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	var msg federationMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&msg); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	peer, ok := f.Config.Peers[msg.From]
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || peer.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(peer.Token)) != 1 {
+		writeError(w, http.StatusUnauthorized, "unknown peer or invalid token")
+		return
+	}
+	if strings.TrimSpace(msg.Content) == "" {
+		writeError(w, http.StatusBadRequest, "content is required")
+		return
+	}
+
+	switch msg.Kind {
+	case "request":
+		chatID := msg.From
+		if msg.ReplyTo != "" {
+			chatID += ":" + msg.ReplyTo
+		}
+		f.Bus.PublishInbound(bus.InboundMessage{
+			Channel:   f.Name(),
+			SenderID:  msg.From,
+			ChatID:    chatID,
+			Content:   msg.Content,
+			Timestamp: time.Now(),
+			Metadata:  map[string]interface{}{"sender_name": "peer " + msg.From},
+		})
+	case "reply":
+		if !f.expected(msg.From, msg.ReplyTo) {
+			log.Printf("[Federation] Dropping reply from %s for %q: no task delegated from that chat", msg.From, msg.ReplyTo)
+			writeError(w, http.StatusConflict, "no task delegated from that chat")
+			return
+		}
+		f.Bus.PublishInbound(bus.InboundMessage{
+			Channel:  "system",
+			SenderID: "peer " + msg.From,
+			ChatID:   msg.ReplyTo,
+			Content:  fmt.Sprintf("Peer %s answered the task delegated to it:\n\n%s", msg.From, msg.Content),
+		})
+	default:
+		writeError(w, http.StatusBadRequest, "kind must be request or reply")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "queued"})
+}
+
+// expected reports whether a task was recently delegated to peer from
+// the chat replyTo.
+func (f *Federation) expected(peer, replyTo string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	until, ok := f.pending[peer+"\x00"+replyTo]
+	return ok && time.Now().Before(until)
+}
@@ -0,0 +1,77 @@
+package gateway
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/secrets"
+)
+
+// OAuthCallback is where providers send users' browsers back after they
+// authorize an account connected with /connect. The tokens are stored and
+// the chat that asked is told the outcome.
+type OAuthCallback struct {
+	OAuth *secrets.OAuth
+	Bus   *bus.MessageBus
+}
+
+// NewOAuthCallback creates a new OAuthCallback.
+func NewOAuthCallback(oauth *secrets.OAuth, messageBus *bus.MessageBus) *OAuthCallback {
+	return &OAuthCallback{OAuth: oauth, Bus: messageBus}
+}
+
+// Register mounts the callback at /oauth/callback.
+func (c *OAuthCallback) Register(s *Server) {
+	s.HandleFunc("/oauth/callback", c.handleCallback)
+}
+
+func (c *OAuthCallback) handleCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	state := q.Get("state")
+	if e := q.Get("error"); e != "" {
+		if d := q.Get("error_description"); d != "" {
+			e += ": " + d
+		}
+		if a, ok := c.OAuth.Cancel(state); ok {
+			c.notify(a, fmt.Sprintf("Your %s account was not connected: %s", a.Service, e))
+		}
+		writePage(w, http.StatusBadRequest, "Not connected", "Authorization was refused ("+e+").")
+		return
+	}
+	if state == "" || q.Get("code") == "" {
+		writePage(w, http.StatusBadRequest, "Not connected", "The request is missing its code or state.")
+		return
+	}
+
+	a, err := c.OAuth.Complete(state, q.Get("code"))
+	if err != nil {
+		log.Printf("OAuth callback failed: %v", err)
+		if a.ChatID != "" {
+			c.notify(a, fmt.Sprintf("Connecting your %s account failed: %v", a.Service, err))
+		}
+		writePage(w, http.StatusBadRequest, "Not connected", err.Error())
+		return
+	}
+	c.notify(a, fmt.Sprintf("Your %s account is connected.", a.Service))
+	writePage(w, http.StatusOK, "Connected", fmt.Sprintf("Your %s account is connected. You can close this window.", a.Service))
+}
+
+// notify tells the chat that started an authorization how it ended.
+func (c *OAuthCallback) notify(a secrets.Authorization, text string) {
+	c.Bus.PublishOutbound(bus.OutboundMessage{Channel: a.Channel, ChatID: a.ChatID, Content: text})
+}
+
+// writePage writes a minimal HTML page for the user's browser.
+func writePage(w http.ResponseWriter, status int, title, text string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<!doctype html><title>%s</title><h1>%s</h1><p>%s</p>\n",
+		html.EscapeString(title), html.EscapeString(title), html.EscapeString(text))
+}
@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/buildinfo"
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/config"
+)
+
+// Server is the HTTP gateway. Features mount their endpoints on it via Handle.
+type Server struct {
+	Config *config.GatewayConfig
+	Bus    *bus.MessageBus
+	mux    *http.ServeMux
+	server *http.Server
+	addr   string
+	// cancel ends the contexts of open requests, so long-lived streams
+	// such as the web chat events close on Stop.
+	cancel context.CancelFunc
+}
+
+// NewServer creates a new gateway server.
+func NewServer(cfg *config.GatewayConfig, messageBus *bus.MessageBus) *Server {
+	s := &Server{
+		Config: cfg,
+		Bus:    messageBus,
+		mux:    http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/health", s.handleHealth)
+	return s
+}
+
+// Handle registers a handler for the given pattern.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleFunc registers a handler function for the given pattern.
+func (s *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// HandleAdmin registers a handler that requires the admin token.
+func (s *Server) HandleAdmin(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		if s.Config.AdminToken == "" {
+			writeError(w, http.StatusServiceUnavailable, "admin API disabled (set gateway.adminToken)")
+			return
+		}
+		if !s.checkToken(r) {
+			writeError(w, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+		handler(w, r)
+	})
+}
+
+func (s *Server) checkToken(r *http.Request) bool {
+	token := r.Header.Get("X-Admin-Token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.Config.AdminToken)) == 1
+}
+
+// Start starts listening in the background.
+func (s *Server) Start() error {
+	host := s.Config.Host
+	port := s.Config.Port
+	if port == 0 {
+		port = 18790
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	s.addr = ln.Addr().String()
+
+	base, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.server = &http.Server{
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return base },
+	}
+
+	go func() {
+		log.Printf("Gateway listening on %s", s.addr)
+		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("Gateway server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop gracefully shuts down the server.
+func (s *Server) Stop(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	s.cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "build": buildinfo.Info()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
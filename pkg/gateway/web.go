@@ -0,0 +1,287 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+)
+
+//go:embed static/index.html
+var staticFiles embed.FS
+
+// streamTicketTTL is how long a ticket for the event stream can be used.
+const streamTicketTTL = 30 * time.Second
+
+// webEvent is a server-sent event pushed to browser clients.
+type webEvent struct {
+	Event string
+	Data  map[string]interface{}
+}
+
+// WebChat is the "web" channel backing the browser chat playground.
+// Browsers post messages to /api/chat/send and receive replies as
+// server-sent events from /api/chat/events.
+type WebChat struct {
+	Bus *bus.MessageBus
+	// Token is required as a bearer token on the chat endpoints. Browsers
+	// open the event stream without headers, so they get a ticket from
+	// /api/chat/ticket instead and pass it in the query: it works once,
+	// for one session and only for streamTicketTTL, so it is worthless in
+	// the access logs it ends up in.
+	Token       string
+	mu          sync.Mutex
+	subscribers map[string]map[chan webEvent]struct{}
+	tickets     map[string]streamTicket
+}
+
+// streamTicket lets a browser open the event stream of a session once.
+type streamTicket struct {
+	session string
+	expires time.Time
+}
+
+// NewWebChat creates a new WebChat.
+func NewWebChat(messageBus *bus.MessageBus, token string) *WebChat {
+	return &WebChat{
+		Bus:         messageBus,
+		Token:       token,
+		subscribers: make(map[string]map[chan webEvent]struct{}),
+		tickets:     make(map[string]streamTicket),
+	}
+}
+
+func (c *WebChat) Name() string {
+	return "web"
+}
+
+// Register mounts the playground page and chat endpoints on the server.
+func (c *WebChat) Register(s *Server) {
+	s.HandleFunc("/", c.handleIndex)
+	s.HandleFunc("/api/chat/send", c.handleSend)
+	s.HandleFunc("/api/chat/ticket", c.handleTicket)
+	s.HandleFunc("/api/chat/events", c.handleEvents)
+}
+
+// Send delivers an outbound message to every browser subscribed to the chat.
+func (c *WebChat) Send(msg bus.OutboundMessage) error {
+	if msg.Stream != nil {
+		for chunk := range msg.Stream {
+			c.publish(msg.ChatID, webEvent{Event: "delta", Data: map[string]interface{}{"content": chunk}})
+		}
+		c.publish(msg.ChatID, webEvent{Event: "done", Data: map[string]interface{}{}})
+		return nil
+	}
+
+	msgType := string(msg.Type)
+	if msgType == "" {
+		msgType = string(bus.MessageTypeText)
+	}
+	c.publish(msg.ChatID, webEvent{Event: "message", Data: map[string]interface{}{
+		"type":    msgType,
+		"content": msg.Content,
+		"media":   msg.Media,
+	}})
+	return nil
+}
+
+func (c *WebChat) publish(chatID string, ev webEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for ch := range c.subscribers[chatID] {
+		select {
+		case ch <- ev:
+		default:
+			log.Printf("[Web] Dropping event for slow client (chat %s)", chatID)
+		}
+	}
+}
+
+func (c *WebChat) subscribe(chatID string) chan webEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan webEvent, 256)
+	if c.subscribers[chatID] == nil {
+		c.subscribers[chatID] = make(map[chan webEvent]struct{})
+	}
+	c.subscribers[chatID][ch] = struct{}{}
+	return ch
+}
+
+func (c *WebChat) unsubscribe(chatID string, ch chan webEvent) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.subscribers[chatID], ch)
+	if len(c.subscribers[chatID]) == 0 {
+		delete(c.subscribers, chatID)
+	}
+}
+
+func (c *WebChat) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := staticFiles.ReadFile("static/index.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(data)
+}
+
+// authorized reports whether a request carries the web token.
+func (c *WebChat) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return c.Token != "" && token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(c.Token)) == 1
+}
+
+// issueTicket returns a new stream ticket for session.
+func (c *WebChat) issueTicket(session string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	ticket := hex.EncodeToString(b)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for t, st := range c.tickets {
+		if now.After(st.expires) {
+			delete(c.tickets, t)
+		}
+	}
+	c.tickets[ticket] = streamTicket{session: session, expires: now.Add(streamTicketTTL)}
+	return ticket, nil
+}
+
+// redeemTicket reports whether ticket was issued for session and has not
+// expired, and makes sure it cannot be used again.
+func (c *WebChat) redeemTicket(ticket, session string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st, ok := c.tickets[ticket]
+	delete(c.tickets, ticket)
+	return ok && st.session == session && time.Now().Before(st.expires)
+}
+
+func (c *WebChat) handleTicket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !c.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "invalid web token")
+		return
+	}
+	var req struct {
+		Session string `json:"session"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	req.Session = strings.TrimSpace(req.Session)
+	if req.Session == "" {
+		writeError(w, http.StatusBadRequest, "session is required")
+		return
+	}
+	ticket, err := c.issueTicket(req.Session)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"ticket": ticket})
+}
+
+func (c *WebChat) handleSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !c.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "invalid web token")
+		return
+	}
+
+	var req struct {
+		Session string `json:"session"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	req.Session = strings.TrimSpace(req.Session)
+	if req.Session == "" || strings.TrimSpace(req.Message) == "" {
+		writeError(w, http.StatusBadRequest, "session and message are required")
+		return
+	}
+
+	c.Bus.PublishInbound(bus.InboundMessage{
+		Channel:   c.Name(),
+		SenderID:  req.Session,
+		ChatID:    req.Session,
+		Content:   req.Message,
+		Timestamp: time.Now(),
+	})
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "queued"})
+}
+
+func (c *WebChat) handleEvents(w http.ResponseWriter, r *http.Request) {
+	session := strings.TrimSpace(r.URL.Query().Get("session"))
+	if session == "" {
+		writeError(w, http.StatusBadRequest, "session is required")
+		return
+	}
+	if !c.authorized(r) && !c.redeemTicket(r.URL.Query().Get("ticket"), session) {
+		writeError(w, http.StatusUnauthorized, "invalid web token or stream ticket")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ch := c.subscribe(session)
+	defer c.unsubscribe(session, ch)
+
+	heartbeat := time.NewTicker(25 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case ev := <-ch:
+			data, _ := json.Marshal(ev.Data)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Event, data)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+	"github.com/HKUDS/nanobot-go/pkg/config"
+)
+
+// webhookSettle bounds how long a finished turn waits for its replies to
+// be delivered before its request is answered.
+const webhookSettle = 5 * time.Second
+
+// Webhook is the "webhook" channel, a plain HTTP interface to the agent
+// for systems that are not chat platforms. They post a message to
+// /api/webhook/message and either wait for the agent's replies in the
+// response or get them posted to the configured callback URL.
+//
+// Only one request per chat waits at a time. Replies with no request
+// waiting for them, such as reminders or the end of a turn that timed
+// out, go to the callback URL, or are dropped without one.
+type Webhook struct {
+	Config *config.WebhookConfig
+	Bus    *bus.MessageBus
+	client *http.Client
+
+	mu      sync.Mutex
+	waiting map[string]*webhookWait // chat ID -> request waiting for its replies
+}
+
+// webhookWait collects the replies of the turn a request waits for.
+type webhookWait struct {
+	id      string
+	replies []webhookReply
+	done    chan struct{}
+}
+
+// webhookRequest is a message posted to the webhook.
+type webhookRequest struct {
+	ChatID     string `json:"chat_id"`
+	SenderID   string `json:"sender_id"`
+	SenderName string `json:"sender_name,omitempty"`
+	Content    string `json:"content"`
+	// Wait returns the replies in the response. It defaults to true
+	// without a callback URL and to false with one.
+	Wait *bool `json:"wait,omitempty"`
+}
+
+// webhookReply is a message from the agent, in a response or posted to
+// the callback URL.
+type webhookReply struct {
+	ID      string          `json:"id"`
+	ChatID  string          `json:"chat_id"`
+	Type    bus.MessageType `json:"type"`
+	Content string          `json:"content"`
+	Media   string          `json:"media,omitempty"`
+}
+
+// NewWebhook creates a new Webhook.
+func NewWebhook(cfg *config.WebhookConfig, messageBus *bus.MessageBus) *Webhook {
+	w := &Webhook{
+		Config:  cfg,
+		Bus:     messageBus,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		waiting: make(map[string]*webhookWait),
+	}
+	messageBus.OnHandled(w.handled)
+	return w
+}
+
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+// Register mounts the endpoint messages are posted to.
+func (w *Webhook) Register(s *Server) {
+	s.HandleFunc("/api/webhook/message", w.handleMessage)
+}
+
+// Send hands an outbound message to the request waiting for it, or posts
+// it to the callback URL.
+func (w *Webhook) Send(msg bus.OutboundMessage) error {
+	content := msg.Content
+	if msg.Stream != nil {
+		var sb strings.Builder
+		for chunk := range msg.Stream {
+			sb.WriteString(chunk)
+		}
+		content += sb.String()
+	}
+	if strings.TrimSpace(content) == "" && msg.Media == "" {
+		return nil
+	}
+	reply := webhookReply{ID: msg.ID, ChatID: msg.ChatID, Type: msg.Type, Content: content, Media: msg.Media}
+	if reply.Type == "" {
+		reply.Type = bus.MessageTypeText
+	}
+
+	w.mu.Lock()
+	if wait := w.waiting[msg.ChatID]; wait != nil {
+		wait.replies = append(wait.replies, reply)
+		w.mu.Unlock()
+		return nil
+	}
+	w.mu.Unlock()
+
+	if w.Config.CallbackURL == "" {
+		log.Printf("[Webhook] Dropping reply to %s: no request is waiting and no callbackUrl is configured", msg.ChatID)
+		return nil
+	}
+	return w.post(reply)
+}
+
+func (w *Webhook) post(reply webhookReply) error {
+	body, _ := json.Marshal(reply)
+	req, err := http.NewRequest(http.MethodPost, w.Config.CallbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Config.CallbackToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.Config.CallbackToken)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook callback: StatusCode: %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+func (w *Webhook) handleMessage(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(rw, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if w.Config.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(w.Config.Token)) != 1 {
+		writeError(rw, http.StatusUnauthorized, "invalid token")
+		return
+	}
+	var req webhookRequest
+	if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(rw, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		writeError(rw, http.StatusBadRequest, "content is required")
+		return
+	}
+	if req.ChatID == "" {
+		req.ChatID = "default"
+	}
+	if req.SenderID == "" {
+		req.SenderID = req.ChatID
+	}
+	wait := w.Config.CallbackURL == ""
+	if req.Wait != nil {
+		wait = *req.Wait
+	}
+	if !wait && w.Config.CallbackURL == "" {
+		writeError(rw, http.StatusBadRequest, "wait is false but no callbackUrl is configured")
+		return
+	}
+
+	msg := bus.InboundMessage{
+		Channel:   w.Name(),
+		SenderID:  req.SenderID,
+		ChatID:    req.ChatID,
+		Content:   req.Content,
+		Timestamp: time.Now(),
+		Metadata:  map[string]interface{}{},
+	}
+	if req.SenderName != "" {
+		msg.Metadata["sender_name"] = req.SenderName
+	}
+	if !wait {
+		w.Bus.PublishInbound(msg)
+		writeJSON(rw, http.StatusAccepted, map[string]string{"status": "queued", "chat_id": req.ChatID})
+		return
+	}
+
+	pending := &webhookWait{id: bus.NewMessageID(), done: make(chan struct{})}
+	w.mu.Lock()
+	if w.waiting[req.ChatID] != nil {
+		w.mu.Unlock()
+		writeError(rw, http.StatusConflict, "another request is waiting for this chat")
+		return
+	}
+	w.waiting[req.ChatID] = pending
+	w.mu.Unlock()
+	msg.Metadata["webhook_request"] = pending.id
+	w.Bus.PublishInbound(msg)
+
+	timeout := time.Duration(w.Config.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 120 * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	done := true
+	select {
+	case <-pending.done:
+	case <-timer.C:
+		done = false
+	case <-r.Context().Done():
+		w.release(req.ChatID, pending)
+		return
+	}
+	w.release(req.ChatID, pending)
+
+	w.mu.Lock()
+	replies := append([]webhookReply{}, pending.replies...)
+	w.mu.Unlock()
+	writeJSON(rw, http.StatusOK, map[string]interface{}{
+		"chat_id": req.ChatID,
+		"done":    done,
+		"replies": replies,
+	})
+}
+
+// handled ends the request waiting for msg once its replies are delivered.
+func (w *Webhook) handled(msg bus.InboundMessage) {
+	if msg.Channel != w.Name() {
+		return
+	}
+	id, _ := msg.Metadata["webhook_request"].(string)
+	if id == "" {
+		return
+	}
+	go func() {
+		// The last replies may still be on their way through the bus
+		w.Bus.Flush(webhookSettle)
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if pending := w.waiting[msg.ChatID]; pending != nil && pending.id == id {
+			delete(w.waiting, msg.ChatID)
+			close(pending.done)
+		}
+	}()
+}
+
+// release stops collecting replies for a request that is no longer waiting.
+func (w *Webhook) release(chatID string, pending *webhookWait) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.waiting[chatID] == pending {
+		delete(w.waiting, chatID)
+	}
+}
@@ -0,0 +1,150 @@
+package memory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+)
+
+// Activity kinds recorded in the ledger.
+const (
+	ActivityMessage  = "message"
+	ActivityTool     = "tool"
+	ActivityFile     = "file"
+	ActivityReminder = "reminder"
+)
+
+// maxActivityDetail caps the detail of a single ledger entry.
+const maxActivityDetail = 120
+
+// activityMu serializes appends from every ActivityLog in the process.
+var activityMu sync.Mutex
+
+// ActivityLog is a daily ledger of what the agent did, one line per event,
+// kept in memory/ACTIVITY-YYYY-MM-DD.md.
+type ActivityLog struct {
+	MemoryDir string
+}
+
+// NewActivityLog creates an ActivityLog for the workspace.
+func NewActivityLog(workspace string) *ActivityLog {
+	dir := filepath.Join(workspace, "memory")
+	atrest.Protect(dir)
+	return &ActivityLog{MemoryDir: dir}
+}
+
+// FileFor returns the ledger path for the given day.
+func (a *ActivityLog) FileFor(day time.Time) string {
+	return filepath.Join(a.MemoryDir, fmt.Sprintf("ACTIVITY-%s.md", day.Format("2006-01-02")))
+}
+
+// Record appends an entry of the given kind. Errors are ignored so the
+// ledger never gets in the way of the work it records.
+func (a *ActivityLog) Record(kind, detail string) {
+	detail = strings.Join(strings.Fields(detail), " ")
+	if r := []rune(detail); len(r) > maxActivityDetail {
+		detail = string(r[:maxActivityDetail]) + "…"
+	}
+	now := time.Now()
+	path := a.FileFor(now)
+
+	activityMu.Lock()
+	defer activityMu.Unlock()
+	os.MkdirAll(a.MemoryDir, 0755)
+	entry := fmt.Sprintf("- %s %s %s\n", now.Format("15:04:05"), kind, detail)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		entry = fmt.Sprintf("# Activity %s\n\n", now.Format("2006-01-02")) + entry
+	}
+	atrest.AppendFile(path, []byte(entry), 0644)
+}
+
+// ActivityEntry is one parsed ledger line.
+type ActivityEntry struct {
+	Time   string
+	Kind   string
+	Detail string
+}
+
+// Read returns the entries recorded on the given day, oldest first.
+func (a *ActivityLog) Read(day time.Time) ([]ActivityEntry, error) {
+	data, err := atrest.ReadFile(a.FileFor(day))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []ActivityEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "- ") {
+			continue
+		}
+		fields := strings.SplitN(strings.TrimPrefix(line, "- "), " ", 3)
+		if len(fields) < 2 {
+			continue
+		}
+		entry := ActivityEntry{Time: fields[0], Kind: fields[1]}
+		if len(fields) == 3 {
+			entry.Detail = fields[2]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Report summarizes a day's ledger: counts per kind followed by the last
+// maxEntries entries.
+func (a *ActivityLog) Report(day time.Time, maxEntries int) (string, error) {
+	entries, err := a.Read(day)
+	if err != nil {
+		return "", err
+	}
+	date := day.Format("2006-01-02")
+	if len(entries) == 0 {
+		return fmt.Sprintf("No activity recorded on %s.", date), nil
+	}
+
+	counts := map[string]int{}
+	for _, e := range entries {
+		counts[e.Kind]++
+	}
+	labels := []struct{ kind, label string }{
+		{ActivityMessage, "messages handled"},
+		{ActivityTool, "tool runs"},
+		{ActivityFile, "files changed"},
+		{ActivityReminder, "reminders fired"},
+	}
+	var summary []string
+	for _, l := range labels {
+		summary = append(summary, fmt.Sprintf("%d %s", counts[l.kind], l.label))
+		delete(counts, l.kind)
+	}
+	var others []string
+	for kind := range counts {
+		others = append(others, kind)
+	}
+	sort.Strings(others)
+	for _, kind := range others {
+		summary = append(summary, fmt.Sprintf("%d %s", counts[kind], kind))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Activity on %s: %s.\n", date, strings.Join(summary, ", ")))
+	start := 0
+	if maxEntries > 0 && len(entries) > maxEntries {
+		start = len(entries) - maxEntries
+		sb.WriteString(fmt.Sprintf("\nLast %d of %d entries:\n", maxEntries, len(entries)))
+	} else {
+		sb.WriteString("\n")
+	}
+	for _, e := range entries[start:] {
+		sb.WriteString(fmt.Sprintf("- %s %s %s\n", e.Time, e.Kind, e.Detail))
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
@@ -0,0 +1,95 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// factDateFormat is the format of the dates in a fact line.
+const factDateFormat = "2006-01-02"
+
+// Confidence levels a fact can be saved with.
+var FactConfidences = []string{"high", "medium", "low"}
+
+// Fact is one remembered fact. Facts are stored one per line as
+// "- <text> (<saved>[, expires <date>][, confidence <level>][, source <source>])".
+type Fact struct {
+	Text       string
+	Saved      time.Time
+	Expires    time.Time // The last day the fact holds; zero if it does not expire
+	Confidence string    // One of FactConfidences, or "" if not given
+	Source     string    // Where the fact came from, e.g. "user" or a URL; may be ""
+}
+
+// Expired reports whether the fact no longer holds at now: its expiry day
+// has passed.
+func (f Fact) Expired(now time.Time) bool {
+	if f.Expires.IsZero() {
+		return false
+	}
+	end := time.Date(f.Expires.Year(), f.Expires.Month(), f.Expires.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1)
+	return !now.Before(end)
+}
+
+// line formats the fact for a facts file.
+func (f Fact) line() string {
+	meta := []string{f.Saved.Format(factDateFormat)}
+	if !f.Expires.IsZero() {
+		meta = append(meta, "expires "+f.Expires.Format(factDateFormat))
+	}
+	if f.Confidence != "" {
+		meta = append(meta, "confidence "+f.Confidence)
+	}
+	if f.Source != "" {
+		meta = append(meta, "source "+f.Source)
+	}
+	return fmt.Sprintf("- %s (%s)\n", f.Text, strings.Join(meta, ", "))
+}
+
+// parseFact parses a line of a facts file. It reports false for lines
+// that are not facts; facts without metadata have only Text set.
+func parseFact(line string) (Fact, bool) {
+	if !strings.HasPrefix(line, "- ") {
+		return Fact{}, false
+	}
+	text := strings.TrimSpace(strings.TrimPrefix(line, "- "))
+	f := Fact{Text: text}
+	open := strings.LastIndex(text, " (")
+	if open < 0 || !strings.HasSuffix(text, ")") {
+		return f, true
+	}
+	meta := strings.Split(text[open+2:len(text)-1], ", ")
+	saved, err := time.ParseInLocation(factDateFormat, meta[0], time.Local)
+	if err != nil {
+		return f, true
+	}
+	f.Text, f.Saved = text[:open], saved
+	for _, m := range meta[1:] {
+		key, value, _ := strings.Cut(m, " ")
+		switch key {
+		case "expires":
+			f.Expires, _ = time.ParseInLocation(factDateFormat, value, time.Local)
+		case "confidence":
+			f.Confidence = value
+		case "source":
+			f.Source = value
+		}
+	}
+	return f, true
+}
+
+// ParseFactDate parses an expiry date given to the memory tool.
+func ParseFactDate(s string) (time.Time, error) {
+	t, err := time.ParseInLocation(factDateFormat, strings.TrimSpace(s), time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", s)
+	}
+	return t, nil
+}
+
+// cleanFactField makes a metadata value safe to store in a fact line.
+func cleanFactField(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return strings.NewReplacer(",", ";", "(", "", ")", "").Replace(s)
+}
@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+	"github.com/HKUDS/nanobot-go/pkg/migrate"
+)
+
+const (
+	// layoutFile records the version of the memory directory layout,
+	// relative to the memory dir.
+	layoutFile = ".layout.json"
+	// layoutVersion is the layout this build reads and writes.
+	layoutVersion = 1
+)
+
+// layoutFormat upgrades the memory directory from older layouts. Steps
+// find the memory dir under "dir" and move or rewrite files in place.
+var layoutFormat = &migrate.Format{
+	Name:    "memory layout",
+	Current: layoutVersion,
+}
+
+// migrateLayout upgrades the memory directory to this build's layout and
+// records its version.
+func (m *MemoryStore) migrateLayout() {
+	path := filepath.Join(m.MemoryDir, layoutFile)
+	doc := map[string]interface{}{}
+	data, err := atrest.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &doc); err != nil {
+			log.Printf("Memory: failed to parse %s: %v", layoutFile, err)
+			return
+		}
+	} else if !os.IsNotExist(err) {
+		log.Printf("Memory: failed to read %s: %v", layoutFile, err)
+		return
+	}
+
+	doc["dir"] = m.MemoryDir
+	changed, err := layoutFormat.Upgrade(doc, migrate.Version(doc, "version"))
+	delete(doc, "dir")
+	if err != nil {
+		log.Printf("Memory: %v", err)
+		return
+	}
+	if data != nil && !changed {
+		return
+	}
+	doc["version"] = layoutVersion
+	data, _ = json.Marshal(doc)
+	if err := atrest.WriteFile(path, data, 0644); err != nil {
+		log.Printf("Memory: failed to write %s: %v", layoutFile, err)
+	}
+}
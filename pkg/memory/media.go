@@ -0,0 +1,178 @@
+package memory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+const (
+	// maxMediaBytes caps the size of a file kept in memory.
+	maxMediaBytes = 50 << 20
+	// thumbnailSize is the longest side of an image's thumbnail, in pixels.
+	thumbnailSize = 256
+)
+
+// MediaFile is an image or file kept in memory/media, named by the hash of
+// its content so the same file is stored once.
+type MediaFile struct {
+	Kind      string // "image" or "file"
+	Name      string // The original file name
+	Path      string
+	Thumbnail string // A small JPEG of an image; "" for files or images that can't be decoded
+}
+
+// MediaDir returns the directory remembered images and files are kept in.
+func (m *MemoryStore) MediaDir() string {
+	return filepath.Join(m.MemoryDir, "media")
+}
+
+// SaveMedia copies a file into memory/media, where it stays after the
+// attachment it came from is cleaned up, and makes a thumbnail if it is an
+// image.
+func (m *MemoryStore) SaveMedia(src string) (MediaFile, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return MediaFile{}, err
+	}
+	if info.IsDir() {
+		return MediaFile{}, fmt.Errorf("%s is a directory", src)
+	}
+	if info.Size() > maxMediaBytes {
+		return MediaFile{}, fmt.Errorf("%s is too large to keep (%d bytes, the limit is %d)", src, info.Size(), maxMediaBytes)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return MediaFile{}, err
+	}
+	defer in.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, in); err != nil {
+		return MediaFile{}, err
+	}
+	id := hex.EncodeToString(hash.Sum(nil))[:16]
+
+	ext := strings.ToLower(filepath.Ext(src))
+	file := MediaFile{
+		Kind: "file",
+		Name: filepath.Base(src),
+		Path: filepath.Join(m.MediaDir(), id+ext),
+	}
+	if strings.HasPrefix(mime.TypeByExtension(ext), "image/") {
+		file.Kind = "image"
+	}
+	if err := os.MkdirAll(m.MediaDir(), 0755); err != nil {
+		return MediaFile{}, err
+	}
+	if _, err := os.Stat(file.Path); os.IsNotExist(err) {
+		if _, err := in.Seek(0, io.SeekStart); err != nil {
+			return MediaFile{}, err
+		}
+		if err := copyFile(in, file.Path); err != nil {
+			return MediaFile{}, err
+		}
+	}
+
+	if file.Kind == "image" {
+		thumb := filepath.Join(m.MediaDir(), id+".thumb.jpg")
+		if _, err := os.Stat(thumb); err == nil || writeThumbnail(file.Path, thumb) == nil {
+			file.Thumbnail = thumb
+		}
+	}
+	return file, nil
+}
+
+func copyFile(in io.Reader, path string) error {
+	tmp := path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// writeThumbnail scales an image down to thumbnailSize on its longest side
+// and saves it as a JPEG. Formats the standard library can't decode, like
+// WebP or HEIC, get no thumbnail.
+func writeThumbnail(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return fmt.Errorf("image is empty")
+	}
+	tw, th := w, h
+	if w > thumbnailSize || h > thumbnailSize {
+		if w >= h {
+			tw, th = thumbnailSize, h*thumbnailSize/w
+		} else {
+			tw, th = w*thumbnailSize/h, thumbnailSize
+		}
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	// Each thumbnail pixel is the average of the source pixels it covers
+	thumb := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+			var r, g, bl, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, _ := img.At(sx, sy).RGBA()
+					r, g, bl, n = r+pr, g+pg, bl+pb, n+1
+				}
+			}
+			if n > 0 {
+				thumb.Set(x, y, color.RGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(bl / n >> 8), 0xff})
+			}
+		}
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(out, thumb, &jpeg.Options{Quality: 80}); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
@@ -6,7 +6,10 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
 )
 
 // MemoryStore manages persistent agent memory.
@@ -19,10 +22,15 @@ type MemoryStore struct {
 func NewMemoryStore(workspace string) *MemoryStore {
 	memoryDir := filepath.Join(workspace, "memory")
 	os.MkdirAll(memoryDir, 0755)
-	return &MemoryStore{
+	m := &MemoryStore{
 		Workspace: workspace,
 		MemoryDir: memoryDir,
 	}
+	atrest.Protect(m.MemoryDir)
+	// Remembered media is sent to channels as is
+	atrest.Exclude(m.MediaDir())
+	m.migrateLayout()
+	return m
 }
 
 // GetTodayFile returns the path to today's memory file.
@@ -34,7 +42,7 @@ func (m *MemoryStore) GetTodayFile() string {
 // ReadToday reads today's memory notes.
 func (m *MemoryStore) ReadToday() (string, error) {
 	path := m.GetTodayFile()
-	data, err := ioutil.ReadFile(path)
+	data, err := atrest.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return "", nil
@@ -50,7 +58,7 @@ func (m *MemoryStore) AppendToday(content string) error {
 
 	existing := ""
 	if _, err := os.Stat(path); err == nil {
-		data, err := ioutil.ReadFile(path)
+		data, err := atrest.ReadFile(path)
 		if err != nil {
 			return err
 		}
@@ -61,13 +69,13 @@ func (m *MemoryStore) AppendToday(content string) error {
 		content = header + content
 	}
 
-	return ioutil.WriteFile(path, []byte(content), 0644)
+	return atrest.WriteFile(path, []byte(content), 0644)
 }
 
 // ReadLongTerm reads long-term memory (MEMORY.md).
 func (m *MemoryStore) ReadLongTerm() (string, error) {
 	path := filepath.Join(m.MemoryDir, "MEMORY.md")
-	data, err := ioutil.ReadFile(path)
+	data, err := atrest.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return "", nil
@@ -80,7 +88,7 @@ func (m *MemoryStore) ReadLongTerm() (string, error) {
 // WriteLongTerm writes to long-term memory (MEMORY.md).
 func (m *MemoryStore) WriteLongTerm(content string) error {
 	path := filepath.Join(m.MemoryDir, "MEMORY.md")
-	return ioutil.WriteFile(path, []byte(content), 0644)
+	return atrest.WriteFile(path, []byte(content), 0644)
 }
 
 // GetRecentMemories returns memories from the last N days.
@@ -94,7 +102,7 @@ func (m *MemoryStore) GetRecentMemories(days int) (string, error) {
 		path := filepath.Join(m.MemoryDir, fmt.Sprintf("%s.md", dateStr))
 
 		if _, err := os.Stat(path); err == nil {
-			data, err := ioutil.ReadFile(path)
+			data, err := atrest.ReadFile(path)
 			if err != nil {
 				return "", err
 			}
@@ -140,6 +148,80 @@ func (m *MemoryStore) GetMemoryContext() string {
 	return joinStrings(parts, "\n\n")
 }
 
+// ChatFactsFile returns the path of the facts file scoped to a single chat session.
+func (m *MemoryStore) ChatFactsFile(sessionKey string) string {
+	return filepath.Join(m.MemoryDir, "chats", safeName(sessionKey)+".md")
+}
+
+// ContactFactsFile returns the path of the facts file shared by all chats of a contact.
+func (m *MemoryStore) ContactFactsFile(contact string) string {
+	return filepath.Join(m.MemoryDir, "contacts", safeName(contact)+".md")
+}
+
+// AppendFact appends a single fact as a bullet to the given facts file.
+// A zero Saved is today.
+func (m *MemoryStore) AppendFact(path string, fact Fact) error {
+	fact.Text = strings.TrimSpace(strings.ReplaceAll(fact.Text, "\n", " "))
+	if fact.Text == "" {
+		return fmt.Errorf("fact is empty")
+	}
+	if fact.Saved.IsZero() {
+		fact.Saved = time.Now()
+	}
+	fact.Confidence = cleanFactField(fact.Confidence)
+	fact.Source = cleanFactField(fact.Source)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return atrest.AppendFile(path, []byte(fact.line()), 0644)
+}
+
+// ReadFacts reads a facts file, returning "" if it doesn't exist. Facts
+// past their expiry date are left out.
+func (m *MemoryStore) ReadFacts(path string) (string, error) {
+	data, err := atrest.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	now := time.Now()
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if f, ok := parseFact(line); ok && f.Expired(now) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+// GetChatMemoryContext returns the facts visible in a chat: its own facts plus,
+// if contact is non-empty, the facts shared across that contact's chats.
+func (m *MemoryStore) GetChatMemoryContext(sessionKey, contact string) string {
+	var parts []string
+
+	if contact != "" {
+		shared, _ := m.ReadFacts(m.ContactFactsFile(contact))
+		if shared != "" {
+			parts = append(parts, fmt.Sprintf("## Shared Facts about %s\n%s", contact, shared))
+		}
+	}
+
+	chat, _ := m.ReadFacts(m.ChatFactsFile(sessionKey))
+	if chat != "" {
+		parts = append(parts, "## Facts from this Chat\n"+chat)
+	}
+
+	return joinStrings(parts, "\n\n")
+}
+
+func safeName(s string) string {
+	return strings.NewReplacer(":", "_", "/", "_", "\\", "_", " ", "_").Replace(s)
+}
+
 func joinStrings(strs []string, sep string) string {
 	if len(strs) == 0 {
 		return ""
@@ -0,0 +1,328 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+)
+
+const (
+	// vectorIndexFile holds cached embeddings, relative to the memory dir.
+	vectorIndexFile = ".vectors.json"
+	// maxChunkChars splits long paragraphs so each memory stays focused.
+	maxChunkChars = 1000
+	// embedBatchSize is the number of texts sent per embeddings request.
+	embedBatchSize = 64
+)
+
+// Embedder turns texts into embedding vectors.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// OpenAIEmbedder calls an OpenAI-compatible /embeddings endpoint.
+type OpenAIEmbedder struct {
+	APIKey  string
+	APIBase string
+	Model   string
+	client  *http.Client
+}
+
+// NewOpenAIEmbedder creates an OpenAIEmbedder. apiBase defaults to the OpenAI API.
+func NewOpenAIEmbedder(apiKey, apiBase, model string) *OpenAIEmbedder {
+	if apiBase == "" {
+		apiBase = "https://api.openai.com/v1"
+	}
+	return &OpenAIEmbedder{
+		APIKey:  apiKey,
+		APIBase: apiBase,
+		Model:   model,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Embed returns one vector per text, in order.
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"model": e.Model,
+		"input": texts,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(e.APIBase, "/")+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.APIKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embeddings API error: %s %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var parsed struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse embeddings response: %w", err)
+	}
+	vectors := make([][]float64, len(texts))
+	for _, d := range parsed.Data {
+		if d.Index >= 0 && d.Index < len(vectors) {
+			vectors[d.Index] = d.Embedding
+		}
+	}
+	for i, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("embeddings API returned no vector for input %d", i)
+		}
+	}
+	return vectors, nil
+}
+
+// SearchHit is a memory matched by VectorIndex.Search.
+type SearchHit struct {
+	Source string // file name, e.g. MEMORY.md or 2026-01-31.md
+	Text   string
+	Score  float64 // cosine similarity
+}
+
+type vectorEntry struct {
+	Hash   string    `json:"hash"`
+	Source string    `json:"source"`
+	Text   string    `json:"text"`
+	Vector []float64 `json:"vector"`
+}
+
+// VectorIndex is an embeddings index over MEMORY.md and the daily notes,
+// cached in memory/.vectors.json and refreshed as the files change.
+type VectorIndex struct {
+	Store    *MemoryStore
+	Embedder Embedder
+	Model    string // recorded with the cache; a different model rebuilds it
+	mu       sync.Mutex
+	entries  []vectorEntry
+	loaded   bool
+}
+
+// NewVectorIndex creates a VectorIndex for store.
+func NewVectorIndex(store *MemoryStore, embedder Embedder, model string) *VectorIndex {
+	return &VectorIndex{Store: store, Embedder: embedder, Model: model}
+}
+
+func (v *VectorIndex) path() string {
+	return filepath.Join(v.Store.MemoryDir, vectorIndexFile)
+}
+
+func (v *VectorIndex) load() {
+	v.loaded = true
+	data, err := atrest.ReadFile(v.path())
+	if err != nil {
+		return
+	}
+	var cache struct {
+		Model   string        `json:"model"`
+		Entries []vectorEntry `json:"entries"`
+	}
+	if json.Unmarshal(data, &cache) == nil && cache.Model == v.Model {
+		v.entries = cache.Entries
+	}
+}
+
+func (v *VectorIndex) save() error {
+	data, err := json.Marshal(map[string]interface{}{"model": v.Model, "entries": v.entries})
+	if err != nil {
+		return err
+	}
+	return atrest.WriteFile(v.path(), data, 0644)
+}
+
+// Sync re-reads the memory files and embeds chunks not yet in the index.
+// Chunks that no longer exist are dropped.
+func (v *VectorIndex) Sync(ctx context.Context) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.loaded {
+		v.load()
+	}
+
+	known := make(map[string]vectorEntry, len(v.entries))
+	for _, e := range v.entries {
+		known[e.Hash] = e
+	}
+
+	var next []vectorEntry
+	var missing []int
+	for _, c := range v.chunks() {
+		if e, ok := known[c.Hash]; ok {
+			next = append(next, e)
+			continue
+		}
+		missing = append(missing, len(next))
+		next = append(next, c)
+	}
+
+	for start := 0; start < len(missing); start += embedBatchSize {
+		end := start + embedBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		texts := make([]string, 0, end-start)
+		for _, i := range missing[start:end] {
+			texts = append(texts, next[i].Text)
+		}
+		vectors, err := v.Embedder.Embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		for j, i := range missing[start:end] {
+			next[i].Vector = vectors[j]
+		}
+	}
+
+	changed := len(missing) > 0 || len(next) != len(v.entries)
+	v.entries = next
+	if changed {
+		return v.save()
+	}
+	return nil
+}
+
+// Search returns up to k memories most similar to query with a score of
+// at least minScore, best first. The index is synced first.
+func (v *VectorIndex) Search(ctx context.Context, query string, k int, minScore float64) ([]SearchHit, error) {
+	if err := v.Sync(ctx); err != nil {
+		return nil, err
+	}
+	vectors, err := v.Embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var hits []SearchHit
+	for _, e := range v.entries {
+		if score := cosine(vectors[0], e.Vector); score >= minScore {
+			hits = append(hits, SearchHit{Source: e.Source, Text: e.Text, Score: score})
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	if k > 0 && len(hits) > k {
+		hits = hits[:k]
+	}
+	return hits, nil
+}
+
+// chunks splits MEMORY.md and the daily notes into paragraphs, each
+// prefixed with the heading it falls under.
+func (v *VectorIndex) chunks() []vectorEntry {
+	sources := []string{filepath.Join(v.Store.MemoryDir, "MEMORY.md")}
+	daily, _ := v.Store.ListMemoryFiles()
+	sources = append(sources, daily...)
+
+	var entries []vectorEntry
+	for _, path := range sources {
+		data, err := atrest.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		name := filepath.Base(path)
+		for _, text := range chunkMarkdown(string(data)) {
+			sum := sha1.Sum([]byte(name + "\x00" + text))
+			entries = append(entries, vectorEntry{Hash: hex.EncodeToString(sum[:]), Source: name, Text: text})
+		}
+	}
+	return entries
+}
+
+// chunkMarkdown splits text on blank lines and, within long paragraphs, on
+// lines. Headings are not chunks themselves but prefix the chunks below them.
+func chunkMarkdown(text string) []string {
+	var chunks []string
+	heading := ""
+	for _, para := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		var lines []string
+		for _, line := range strings.Split(para, "\n") {
+			if t := strings.TrimSpace(line); strings.HasPrefix(t, "#") {
+				heading = strings.TrimSpace(strings.TrimLeft(t, "#"))
+			} else if t != "" {
+				lines = append(lines, t)
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		var groups []string
+		if body := strings.Join(lines, "\n"); len(body) <= maxChunkChars {
+			groups = []string{body}
+		} else {
+			var cur []string
+			size := 0
+			for _, line := range lines {
+				if size > 0 && size+len(line) > maxChunkChars {
+					groups = append(groups, strings.Join(cur, "\n"))
+					cur, size = nil, 0
+				}
+				cur = append(cur, line)
+				size += len(line) + 1
+			}
+			groups = append(groups, strings.Join(cur, "\n"))
+		}
+		for _, g := range groups {
+			if heading != "" {
+				g = heading + ": " + g
+			}
+			chunks = append(chunks, g)
+		}
+	}
+	return chunks
+}
+
+func cosine(a, b []float64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// FormatHits renders search hits as a markdown list.
+func FormatHits(hits []SearchHit) string {
+	var sb strings.Builder
+	for _, h := range hits {
+		sb.WriteString(fmt.Sprintf("- [%s, %.2f] %s\n", h.Source, h.Score, strings.ReplaceAll(h.Text, "\n", " ")))
+	}
+	return strings.TrimSpace(sb.String())
+}
@@ -0,0 +1,97 @@
+// Package migrate upgrades nanobot's on-disk formats, such as the cron
+// store, session files and the memory directory, from the version that
+// wrote them to the one this build uses, one step at a time, so a format
+// change upgrades old data instead of silently dropping what no longer
+// parses.
+package migrate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// Step upgrades a document from version To-1 to version To.
+type Step struct {
+	To          int
+	Description string
+	Up          func(doc map[string]interface{}) error
+}
+
+// Format is a versioned on-disk format and the steps between its versions.
+// Versions start at 1; data written before the format was versioned is
+// version 1.
+type Format struct {
+	Name    string
+	Current int // the version this build reads and writes
+	Steps   []Step
+}
+
+// TooNewError is returned for data written by a newer build, which this
+// build should not rewrite.
+type TooNewError struct {
+	Format  string
+	Version int
+	Current int
+}
+
+func (e *TooNewError) Error() string {
+	return fmt.Sprintf("%s is version %d, newer than version %d supported by this build", e.Format, e.Version, e.Current)
+}
+
+// Upgrade runs the steps from version to f.Current on doc in order. It
+// reports whether doc changed; on error doc may be partly migrated.
+func (f *Format) Upgrade(doc map[string]interface{}, version int) (bool, error) {
+	if version > f.Current {
+		return false, &TooNewError{Format: f.Name, Version: version, Current: f.Current}
+	}
+	changed := false
+	for v := version + 1; v <= f.Current; v++ {
+		step, ok := f.step(v)
+		if !ok {
+			return changed, fmt.Errorf("%s: no migration to version %d", f.Name, v)
+		}
+		if err := step.Up(doc); err != nil {
+			return changed, fmt.Errorf("%s: migrating to version %d (%s): %w", f.Name, v, step.Description, err)
+		}
+		log.Printf("Migrated %s to version %d: %s", f.Name, v, step.Description)
+		changed = true
+	}
+	return changed, nil
+}
+
+func (f *Format) step(to int) (Step, bool) {
+	for _, s := range f.Steps {
+		if s.To == to {
+			return s, true
+		}
+	}
+	return Step{}, false
+}
+
+// Version returns the version number stored under key in doc, or 1 if
+// there is none.
+func Version(doc map[string]interface{}, key string) int {
+	switch v := doc[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 1
+}
+
+// Backup copies the file at path to path.v<version>.bak before it is
+// rewritten in a newer format. An existing backup is kept.
+func Backup(path string, version int) error {
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	if _, err := os.Stat(backup); err == nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(backup, data, 0644)
+}
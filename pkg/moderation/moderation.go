@@ -0,0 +1,197 @@
+package moderation
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/config"
+)
+
+// maxImageBytes is the largest image attachment sent to the moderation API.
+const maxImageBytes = 4 * 1024 * 1024
+
+// Result is the outcome of a moderation check.
+type Result struct {
+	Flagged    bool
+	Categories []string
+	Source     string // "rules" or "openai"
+}
+
+// Checker checks text and images against local rules and, optionally, the
+// OpenAI moderation API.
+type Checker struct {
+	Config   *config.ModerationConfig
+	APIKey   string
+	APIBase  string
+	words    []string
+	patterns []*regexp.Regexp
+	client   *http.Client
+}
+
+// NewChecker creates a Checker. openAI supplies the API key and base when
+// the moderation config does not set its own.
+func NewChecker(cfg *config.ModerationConfig, openAI config.ProviderConfig) (*Checker, error) {
+	c := &Checker{
+		Config:  cfg,
+		APIKey:  cfg.APIKey,
+		APIBase: cfg.APIBase,
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+	if c.APIKey == "" {
+		c.APIKey = openAI.APIKey
+	}
+	if c.APIBase == "" {
+		c.APIBase = openAI.APIBase
+	}
+	if c.APIBase == "" {
+		c.APIBase = "https://api.openai.com/v1"
+	}
+
+	for _, w := range cfg.BlockedWords {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			c.words = append(c.words, w)
+		}
+	}
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid moderation pattern %q: %w", p, err)
+		}
+		c.patterns = append(c.patterns, re)
+	}
+	return c, nil
+}
+
+// Applies reports whether messages from channel are checked.
+func (c *Checker) Applies(channel string) bool {
+	if len(c.Config.Channels) == 0 {
+		return true
+	}
+	for _, ch := range c.Config.Channels {
+		if ch == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// Check screens a message and its media files. Local rules are applied
+// first; the API is only called when they pass and the provider is "openai".
+func (c *Checker) Check(text string, media []string) (Result, error) {
+	if r := c.checkRules(text); r.Flagged {
+		return r, nil
+	}
+	if c.Config.Provider != "openai" {
+		return Result{}, nil
+	}
+	if c.APIKey == "" {
+		return Result{}, fmt.Errorf("moderation provider openai has no API key")
+	}
+	return c.checkOpenAI(text, media)
+}
+
+func (c *Checker) checkRules(text string) Result {
+	lower := strings.ToLower(text)
+	var hits []string
+	for _, w := range c.words {
+		if strings.Contains(lower, w) {
+			hits = append(hits, "blocked word")
+			break
+		}
+	}
+	for _, re := range c.patterns {
+		if re.MatchString(text) {
+			hits = append(hits, "pattern "+re.String())
+			break
+		}
+	}
+	return Result{Flagged: len(hits) > 0, Categories: hits, Source: "rules"}
+}
+
+func (c *Checker) checkOpenAI(text string, media []string) (Result, error) {
+	input := []map[string]interface{}{}
+	if strings.TrimSpace(text) != "" {
+		input = append(input, map[string]interface{}{"type": "text", "text": text})
+	}
+	for _, path := range media {
+		if url := imageDataURL(path); url != "" {
+			input = append(input, map[string]interface{}{
+				"type":      "image_url",
+				"image_url": map[string]string{"url": url},
+			})
+		}
+	}
+	if len(input) == 0 {
+		return Result{}, nil
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"model": c.Config.Model,
+		"input": input,
+	})
+	req, err := http.NewRequest(http.MethodPost, strings.TrimRight(c.APIBase, "/")+"/moderations", bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("moderation API error: %s %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var parsed struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return Result{}, fmt.Errorf("failed to parse moderation response: %w", err)
+	}
+
+	result := Result{Source: "openai"}
+	for _, r := range parsed.Results {
+		if !r.Flagged {
+			continue
+		}
+		result.Flagged = true
+		for name, hit := range r.Categories {
+			if hit {
+				result.Categories = append(result.Categories, name)
+			}
+		}
+	}
+	sort.Strings(result.Categories)
+	return result, nil
+}
+
+// imageDataURL returns a data URL for an image file, or "" if path is not
+// a readable image of acceptable size.
+func imageDataURL(path string) string {
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	if !strings.HasPrefix(mimeType, "image/") {
+		return ""
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil || len(data) > maxImageBytes {
+		return ""
+	}
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(data))
+}
@@ -0,0 +1,173 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxErrorBody caps how much of an error response that is not JSON ends up
+// in the error message; proxies tend to answer with whole HTML pages.
+const maxErrorBody = 300
+
+// APIError is an unsuccessful response from a provider's API. It wraps
+// ErrContextLength, ErrAuth, ErrQuota, ErrRateLimited or ErrModelNotFound
+// when the response says why the request was rejected.
+type APIError struct {
+	StatusCode int    // 0 for an error sent in the middle of a stream
+	Code       string // The provider's error code or type, if given
+	Message    string // The provider's error message, if given
+	Body       string
+	kind       error
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = strings.TrimSpace(e.Body)
+		if r := []rune(msg); len(r) > maxErrorBody {
+			msg = string(r[:maxErrorBody]) + "…"
+		}
+	}
+	prefix := fmt.Sprintf("API request failed with status %d", e.StatusCode)
+	if e.StatusCode == 0 {
+		prefix = "API stream failed"
+	}
+	if e.Code != "" {
+		prefix += fmt.Sprintf(" (%s)", e.Code)
+	}
+	return prefix + ": " + msg
+}
+
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// errorDetail is the error object of the common error payloads:
+// {"error": {...}} from OpenAI-compatible APIs, Anthropic and Gemini.
+type errorDetail struct {
+	Message string          `json:"message"`
+	Type    string          `json:"type"`
+	Code    json.RawMessage `json:"code"` // A string, or the HTTP status on Gemini
+	Status  string          `json:"status"`
+	Details []struct {
+		Reason string `json:"reason"`
+	} `json:"details"`
+}
+
+// parseErrorBody extracts the error object of a response body. It reports
+// false if the body holds none.
+func parseErrorBody(body []byte) (errorDetail, bool) {
+	var payload struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	trimmed := strings.TrimSpace(string(body))
+	if strings.HasPrefix(trimmed, "[") {
+		// Gemini wraps stream errors in an array
+		var list []json.RawMessage
+		if json.Unmarshal(body, &list) == nil && len(list) > 0 {
+			body = list[0]
+		}
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return errorDetail{}, false
+	}
+	var detail errorDetail
+	switch {
+	case len(payload.Error) > 0 && json.Unmarshal(payload.Error, &detail) == nil:
+		return detail, true
+	case len(payload.Error) > 0:
+		// {"error": "message"}
+		var msg string
+		if json.Unmarshal(payload.Error, &msg) == nil && msg != "" {
+			return errorDetail{Message: msg}, true
+		}
+	case payload.Message != "":
+		return errorDetail{Message: payload.Message}, true
+	}
+	return errorDetail{}, false
+}
+
+func apiError(status int, body []byte) error {
+	e := &APIError{StatusCode: status, Body: string(body)}
+	if detail, ok := parseErrorBody(body); ok {
+		e.Message = detail.Message
+		var code string
+		json.Unmarshal(detail.Code, &code)
+		for _, c := range []string{code, detail.reason(), detail.Status, detail.Type} {
+			if c != "" {
+				e.Code = c
+				break
+			}
+		}
+	}
+	e.kind = classifyError(e)
+	return e
+}
+
+func (d errorDetail) reason() string {
+	for _, r := range d.Details {
+		if r.Reason != "" {
+			return r.Reason
+		}
+	}
+	return ""
+}
+
+// streamError returns the error an event of a stream carries, or nil.
+// Status is taken from the error's numeric code when it has one.
+func streamError(data []byte) error {
+	detail, ok := parseErrorBody(data)
+	if !ok || detail.Message == "" && len(detail.Code) == 0 {
+		return nil
+	}
+	status, _ := strconv.Atoi(string(detail.Code))
+	return apiError(status, data)
+}
+
+// Phrases and codes providers reject requests with, by reason.
+var (
+	authMarkers = []string{
+		"invalid_api_key", "invalid api key", "incorrect api key", "api key not valid",
+		"api_key_invalid", "authentication_error", "unauthenticated", "unauthorized",
+	}
+	quotaMarkers = []string{
+		"insufficient_quota", "exceeded your current quota", "billing", "credit balance",
+		"insufficient balance", "insufficient_balance", "payment required",
+	}
+	rateLimitMarkers = []string{"rate_limit", "rate limit", "too many requests"}
+)
+
+// classifyError returns the reason an API error says the request was
+// rejected for, or nil.
+func classifyError(e *APIError) error {
+	text := strings.ToLower(e.Code + " " + e.Message + " " + e.Body)
+	switch {
+	case isContextLengthError(e.StatusCode, []byte(e.Body)):
+		return ErrContextLength
+	case e.StatusCode == 401 || e.StatusCode == 403 || containsAny(text, authMarkers):
+		return ErrAuth
+	case e.StatusCode == 402 || strings.Contains(text, "insufficient_quota") ||
+		e.StatusCode != 429 && containsAny(text, quotaMarkers):
+		// Gemini words its per-minute limits like a used-up quota
+		return ErrQuota
+	case e.StatusCode == 429 || containsAny(text, rateLimitMarkers):
+		return ErrRateLimited
+	case strings.Contains(text, "model_not_found") ||
+		(e.StatusCode == 404 || e.StatusCode == 400) && strings.Contains(text, "model") &&
+			(strings.Contains(text, "not found") || strings.Contains(text, "does not exist")):
+		return ErrModelNotFound
+	}
+	return nil
+}
+
+func containsAny(text string, markers []string) bool {
+	for _, m := range markers {
+		if strings.Contains(text, m) {
+			return true
+		}
+	}
+	return false
+}
@@ -4,123 +4,158 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/HKUDS/nanobot-go/pkg/config"
 )
 
+// CredentialUpdater is implemented by providers whose API keys and base can
+// be swapped while running.
+type CredentialUpdater interface {
+	SetCredentials(creds Credentials)
+}
+
 // NewProvider creates a new LLM provider based on configuration.
 func NewProvider(cfg *config.Config) (LLMProvider, error) {
-	defaultModel := cfg.Agents.Defaults.Model
-	explicitProvider := cfg.Agents.Defaults.Provider
+	creds, err := resolveCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+	provider := newNamedProvider(SelectedProvider(cfg), creds, cfg.Agents.Defaults.Model)
+	if len(cfg.Models) > 0 {
+		provider = NewRouter(cfg, provider)
+	}
+	if len(cfg.Providers.Fallback.Models) > 0 {
+		provider = NewFallbackProvider(cfg, provider)
+	}
+	return provider, nil
+}
 
-	// Helper to check env if config is empty
-	checkEnv := func(cfgVal, envKey string) string {
-		if cfgVal != "" {
-			return cfgVal
-		}
-		return os.Getenv(envKey)
+// UpdateCredentials re-resolves the API keys and base from cfg and applies
+// them to a running provider, so keys can be rotated without a restart.
+func UpdateCredentials(provider LLMProvider, cfg *config.Config) error {
+	if fallback, ok := provider.(*FallbackProvider); ok {
+		return fallback.updateCredentials(cfg)
+	}
+	if router, ok := provider.(*Router); ok {
+		return router.updateCredentials(cfg)
+	}
+	updater, ok := provider.(CredentialUpdater)
+	if !ok {
+		return fmt.Errorf("provider does not support credential updates")
 	}
+	creds, err := resolveCredentials(cfg)
+	if err != nil {
+		return err
+	}
+	updater.SetCredentials(creds)
+	return nil
+}
 
-	// 1. Explicit selection
-	if explicitProvider != "" {
-		switch strings.ToLower(explicitProvider) {
-		case "openai":
-			apiKey := checkEnv(cfg.Providers.OpenAI.APIKey, "OPENAI_API_KEY")
-			return NewOpenAIProvider(apiKey, cfg.Providers.OpenAI.APIBase, defaultModel), nil
-		case "anthropic":
-			// Assuming Anthropic uses OpenAI-compatible endpoint or we have a specific provider
-			// For now, if we don't have AnthropicProvider, we might fail or use generic if compatible
-			// But Anthropic API is different.
-			// TODO: Implement AnthropicProvider if not using OpenRouter
-			return nil, fmt.Errorf("anthropic provider not implemented yet (use openrouter)")
-		case "deepseek":
-			apiKey := checkEnv(cfg.Providers.DeepSeek.APIKey, "DEEPSEEK_API_KEY")
-			apiBase := cfg.Providers.DeepSeek.APIBase
-			if apiBase == "" {
-				apiBase = "https://api.deepseek.com"
-			}
-			return NewOpenAIProvider(apiKey, apiBase, defaultModel), nil
-		case "openrouter":
-			apiKey := checkEnv(cfg.Providers.OpenRouter.APIKey, "OPENROUTER_API_KEY")
-			apiBase := cfg.Providers.OpenRouter.APIBase
-			if apiBase == "" {
-				apiBase = "https://openrouter.ai/api/v1"
-			}
-			return NewOpenAIProvider(apiKey, apiBase, defaultModel), nil
-		case "vllm":
-			apiKey := checkEnv(cfg.Providers.VLLM.APIKey, "VLLM_API_KEY")
-			apiBase := cfg.Providers.VLLM.APIBase
-			return NewOpenAIProvider(apiKey, apiBase, defaultModel), nil
-		case "gemini":
-			apiKey := checkEnv(cfg.Providers.Gemini.APIKey, "GEMINI_API_KEY")
-			// Gemini has an OpenAI compatible endpoint now
-			apiBase := cfg.Providers.Gemini.APIBase
-			if apiBase == "" {
-				apiBase = "https://generativelanguage.googleapis.com/v1beta/openai/"
-			}
-			return NewOpenAIProvider(apiKey, apiBase, defaultModel), nil
-		default:
-			return nil, fmt.Errorf("unknown provider: %s", explicitProvider)
-		}
+// providerCredentials collects a provider's keys: apiKey (or the envKey
+// environment variable) followed by apiKeys, without blanks or duplicates.
+func providerCredentials(pc config.ProviderConfig, envKey, defaultBase string) Credentials {
+	creds := Credentials{
+		APIBase:      pc.APIBase,
+		KeySelection: pc.KeySelection,
+		KeyCooldown:  time.Duration(pc.KeyCooldown) * time.Second,
+	}
+	if creds.APIBase == "" {
+		creds.APIBase = defaultBase
 	}
 
-	// 2. Heuristic selection based on keys (Precedence: OpenRouter > DeepSeek > OpenAI > ...)
-	
-	// OpenRouter
-	if key := checkEnv(cfg.Providers.OpenRouter.APIKey, "OPENROUTER_API_KEY"); key != "" {
-		apiBase := cfg.Providers.OpenRouter.APIBase
-		if apiBase == "" {
-			apiBase = "https://openrouter.ai/api/v1"
+	apiKey := pc.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv(envKey)
+	}
+	seen := make(map[string]bool)
+	for _, key := range append([]string{apiKey}, pc.APIKeys...) {
+		if key = strings.TrimSpace(key); key != "" && !seen[key] {
+			seen[key] = true
+			creds.APIKeys = append(creds.APIKeys, key)
 		}
-		return NewOpenAIProvider(key, apiBase, defaultModel), nil
 	}
+	return creds
+}
 
-	// DeepSeek
-	if key := checkEnv(cfg.Providers.DeepSeek.APIKey, "DEEPSEEK_API_KEY"); key != "" {
-		apiBase := cfg.Providers.DeepSeek.APIBase
-		if apiBase == "" {
-			apiBase = "https://api.deepseek.com"
-		}
-		return NewOpenAIProvider(key, apiBase, defaultModel), nil
+// providerOrder is the precedence used when no provider is set explicitly.
+var providerOrder = []string{"openrouter", "deepseek", "openai", "vllm", "gemini", "zhipu", "groq"}
+
+// namedCredentials returns the credentials of an OpenAI-compatible provider
+// by its config name. ok is false for unknown names.
+func namedCredentials(cfg *config.Config, name string) (Credentials, bool) {
+	p := &cfg.Providers
+	var creds Credentials
+	switch name {
+	case "openrouter":
+		creds = providerCredentials(p.OpenRouter, "OPENROUTER_API_KEY", "https://openrouter.ai/api/v1")
+	case "deepseek":
+		creds = providerCredentials(p.DeepSeek, "DEEPSEEK_API_KEY", "https://api.deepseek.com")
+	case "openai":
+		creds = providerCredentials(p.OpenAI, "OPENAI_API_KEY", "")
+	case "vllm":
+		creds = providerCredentials(p.VLLM, "VLLM_API_KEY", "")
+	case "gemini":
+		// Served natively unless apiBase is the OpenAI compatible endpoint
+		creds = providerCredentials(p.Gemini, "GEMINI_API_KEY", defaultGeminiAPIBase)
+	case "zhipu":
+		creds = providerCredentials(p.Zhipu, "ZHIPU_API_KEY", "https://open.bigmodel.cn/api/paas/v4/")
+	case "groq":
+		creds = providerCredentials(p.Groq, "GROQ_API_KEY", "https://api.groq.com/openai/v1")
+	default:
+		return Credentials{}, false
 	}
+	creds.Retry = retryPolicy(cfg.Providers.Retry)
+	return creds, true
+}
 
-	// OpenAI
-	if key := checkEnv(cfg.Providers.OpenAI.APIKey, "OPENAI_API_KEY"); key != "" {
-		apiBase := cfg.Providers.OpenAI.APIBase
-		return NewOpenAIProvider(key, apiBase, defaultModel), nil
+// newNamedProvider creates the provider for a config name: Gemini's native
+// API for gemini, else an OpenAI compatible one.
+func newNamedProvider(name string, creds Credentials, model string) LLMProvider {
+	if name == "gemini" && !isGeminiCompatBase(creds.APIBase) {
+		return NewGeminiProvider(creds, model)
 	}
+	return NewOpenAIProvider(creds, model)
+}
 
-	// VLLM
-	if key := checkEnv(cfg.Providers.VLLM.APIKey, "VLLM_API_KEY"); key != "" {
-		return NewOpenAIProvider(key, cfg.Providers.VLLM.APIBase, defaultModel), nil
-	}
-	
-	// Gemini
-	if key := checkEnv(cfg.Providers.Gemini.APIKey, "GEMINI_API_KEY"); key != "" {
-		apiBase := cfg.Providers.Gemini.APIBase
-		if apiBase == "" {
-			apiBase = "https://generativelanguage.googleapis.com/v1beta/openai/"
+// SelectedProvider returns the name of the provider the config selects,
+// or "" if none has an API key.
+func SelectedProvider(cfg *config.Config) string {
+	if explicitProvider := cfg.Agents.Defaults.Provider; explicitProvider != "" {
+		return strings.ToLower(explicitProvider)
+	}
+	for _, name := range providerOrder {
+		if creds, _ := namedCredentials(cfg, name); len(creds.APIKeys) > 0 {
+			return name
 		}
-		return NewOpenAIProvider(key, apiBase, defaultModel), nil
 	}
+	return ""
+}
 
-	// Zhipu
-	if key := checkEnv(cfg.Providers.Zhipu.APIKey, "ZHIPU_API_KEY"); key != "" {
-		apiBase := cfg.Providers.Zhipu.APIBase
-		if apiBase == "" {
-			apiBase = "https://open.bigmodel.cn/api/paas/v4/"
+// resolveCredentials picks the API keys and base of the configured provider.
+func resolveCredentials(cfg *config.Config) (Credentials, error) {
+	// 1. Explicit selection
+	if explicitProvider := cfg.Agents.Defaults.Provider; explicitProvider != "" {
+		name := strings.ToLower(explicitProvider)
+		if name == "anthropic" {
+			// Assuming Anthropic uses OpenAI-compatible endpoint or we have a specific provider
+			// For now, if we don't have AnthropicProvider, we might fail or use generic if compatible
+			// But Anthropic API is different.
+			// TODO: Implement AnthropicProvider if not using OpenRouter
+			return Credentials{}, fmt.Errorf("anthropic provider not implemented yet (use openrouter)")
 		}
-		return NewOpenAIProvider(key, apiBase, defaultModel), nil
+		if creds, ok := namedCredentials(cfg, name); ok {
+			return creds, nil
+		}
+		return Credentials{}, fmt.Errorf("unknown provider: %s", explicitProvider)
 	}
 
-	// Groq
-	if key := checkEnv(cfg.Providers.Groq.APIKey, "GROQ_API_KEY"); key != "" {
-		apiBase := cfg.Providers.Groq.APIBase
-		if apiBase == "" {
-			apiBase = "https://api.groq.com/openai/v1"
+	// 2. Heuristic selection based on keys (Precedence: OpenRouter > DeepSeek > OpenAI > ...)
+	for _, name := range providerOrder {
+		if creds, _ := namedCredentials(cfg, name); len(creds.APIKeys) > 0 {
+			return creds, nil
 		}
-		return NewOpenAIProvider(key, apiBase, defaultModel), nil
 	}
 
-	return nil, fmt.Errorf("no API key configured for any provider")
+	return Credentials{}, fmt.Errorf("no API key configured for any provider")
 }
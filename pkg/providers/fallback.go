@@ -0,0 +1,229 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/config"
+)
+
+const (
+	defaultFailureThreshold = 3
+	defaultCircuitCooldown  = 60 * time.Second
+)
+
+// FallbackProvider is an LLMProvider that retries a failed request with
+// the next model in its chain: first the requested model on Primary, then
+// the configured fallbacks. Only failures another model may not have are
+// retried: rate limits, server errors, timeouts and network errors. Each
+// model has a circuit breaker, so one that keeps failing is skipped for a
+// while instead of delaying every request. A stream is retried only if it
+// fails to start.
+type FallbackProvider struct {
+	Primary   LLMProvider
+	Fallbacks []string
+	Threshold int           // Consecutive failures that open a circuit
+	Cooldown  time.Duration // How long an open circuit is skipped
+
+	mu       sync.Mutex
+	cfg      *config.Config
+	named    map[string]LLMProvider // Created on first use
+	circuits map[string]*circuit
+}
+
+// circuit is the breaker state of one model.
+type circuit struct {
+	failures  int
+	openUntil time.Time
+}
+
+// fallbackTarget is a model of the chain and the provider serving it.
+type fallbackTarget struct {
+	name     string // As configured, for logs and the circuit
+	provider LLMProvider
+	model    string
+}
+
+// NewFallbackProvider wraps primary with the fallback chain in cfg.
+func NewFallbackProvider(cfg *config.Config, primary LLMProvider) *FallbackProvider {
+	fc := cfg.Providers.Fallback
+	f := &FallbackProvider{
+		Primary:   primary,
+		Fallbacks: fc.Models,
+		Threshold: fc.FailureThreshold,
+		Cooldown:  time.Duration(fc.Cooldown) * time.Second,
+		cfg:       cfg,
+		named:     make(map[string]LLMProvider),
+		circuits:  make(map[string]*circuit),
+	}
+	if f.Threshold <= 0 {
+		f.Threshold = defaultFailureThreshold
+	}
+	if f.Cooldown <= 0 {
+		f.Cooldown = defaultCircuitCooldown
+	}
+	return f
+}
+
+// chain returns the models to try for a request for model, those with an
+// open circuit last.
+func (f *FallbackProvider) chain(model string) []fallbackTarget {
+	if model == "" {
+		model = f.Primary.GetDefaultModel()
+	}
+	targets := []fallbackTarget{{name: model, provider: f.Primary, model: model}}
+	for _, name := range f.Fallbacks {
+		if name == model {
+			continue
+		}
+		p, m := f.resolve(name)
+		targets = append(targets, fallbackTarget{name: name, provider: p, model: m})
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	var closed, open []fallbackTarget
+	for _, t := range targets {
+		if c := f.circuits[t.name]; c != nil && now.Before(c.openUntil) {
+			open = append(open, t)
+		} else {
+			closed = append(closed, t)
+		}
+	}
+	return append(closed, open...)
+}
+
+// resolve returns the provider and model of a fallback written
+// "<provider>/<model>", or Primary for other names.
+func (f *FallbackProvider) resolve(name string) (LLMProvider, string) {
+	i := strings.Index(name, "/")
+	if i <= 0 {
+		return f.Primary, name
+	}
+	provider, model := strings.ToLower(name[:i]), name[i+1:]
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.named[provider]; ok {
+		return p, model
+	}
+	if creds, ok := namedCredentials(f.cfg, provider); ok && (len(creds.APIKeys) > 0 || creds.APIBase != "") {
+		p := newNamedProvider(provider, creds, model)
+		f.named[provider] = p
+		return p, model
+	}
+	// Not a configured provider, e.g. an OpenRouter model ID
+	return f.Primary, name
+}
+
+// report updates the circuit of a model after a request.
+func (f *FallbackProvider) report(name string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := f.circuits[name]
+	if c == nil {
+		c = &circuit{}
+		f.circuits[name] = c
+	}
+	if err == nil {
+		c.failures, c.openUntil = 0, time.Time{}
+		return
+	}
+	c.failures++
+	if c.failures >= f.Threshold {
+		c.openUntil = time.Now().Add(f.Cooldown)
+		log.Printf("Model %s failed %d times in a row, skipping it for %s", name, c.failures, f.Cooldown)
+	}
+}
+
+// retryable reports whether a request that failed with err may succeed
+// with another model.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		// Another model may have the key, quota or name this one lacks
+		return retryableStatus(apiErr.StatusCode) || errors.Is(err, ErrAuth) || errors.Is(err, ErrQuota) || errors.Is(err, ErrModelNotFound)
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// try runs call on each model of the chain until one succeeds or fails
+// with an error that is not retryable.
+func (f *FallbackProvider) try(ctx context.Context, model string, call func(LLMProvider, string) error) error {
+	var errs []string
+	targets := f.chain(model)
+	for i, t := range targets {
+		err := call(t.provider, t.model)
+		if err == nil || !retryable(ctx, err) {
+			if err == nil {
+				f.report(t.name, nil)
+			}
+			return err
+		}
+		f.report(t.name, err)
+		errs = append(errs, fmt.Sprintf("%s: %v", t.name, err))
+		if i+1 < len(targets) {
+			log.Printf("Model %s failed (%v), falling back to %s", t.name, err, targets[i+1].name)
+		}
+	}
+	return fmt.Errorf("all models failed: %s", strings.Join(errs, "; "))
+}
+
+// Chat sends a chat completion request, falling back on failure.
+func (f *FallbackProvider) Chat(ctx context.Context, messages []interface{}, tools []interface{}, model string) (*LLMResponse, error) {
+	var resp *LLMResponse
+	err := f.try(ctx, model, func(p LLMProvider, m string) error {
+		var err error
+		resp, err = p.Chat(ctx, messages, tools, m)
+		return err
+	})
+	return resp, err
+}
+
+// Stream starts a streaming chat completion request, falling back when it
+// cannot be started.
+func (f *FallbackProvider) Stream(ctx context.Context, messages []interface{}, tools []interface{}, model string) (<-chan LLMStreamChunk, error) {
+	var stream <-chan LLMStreamChunk
+	err := f.try(ctx, model, func(p LLMProvider, m string) error {
+		var err error
+		stream, err = p.Stream(ctx, messages, tools, m)
+		return err
+	})
+	return stream, err
+}
+
+// GetDefaultModel returns the primary provider's default model.
+func (f *FallbackProvider) GetDefaultModel() string {
+	return f.Primary.GetDefaultModel()
+}
+
+// updateCredentials re-reads the keys of the primary provider and of every
+// provider a fallback has been sent to.
+func (f *FallbackProvider) updateCredentials(cfg *config.Config) error {
+	if err := UpdateCredentials(f.Primary, cfg); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cfg = cfg
+	for name, p := range f.named {
+		creds, ok := namedCredentials(cfg, name)
+		if !ok {
+			return fmt.Errorf("unknown provider: %s", name)
+		}
+		if updater, ok := p.(CredentialUpdater); ok {
+			updater.SetCredentials(creds)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,581 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultGeminiAPIBase = "https://generativelanguage.googleapis.com/v1beta"
+	// geminiCallPrefix marks tool call IDs made up here, for calls Gemini
+	// gave no ID; they are not sent back to it.
+	geminiCallPrefix = "gemini_call_"
+	// maxThoughtSignatures is how many tool calls' thought signatures are
+	// remembered to send back with the calls.
+	maxThoughtSignatures = 1000
+)
+
+// GeminiProvider implements the LLMProvider interface with Gemini's native
+// generateContent API, which keeps what the OpenAI compatible endpoint
+// loses: function declarations with full JSON schemas, inline image parts
+// and the thought signatures Gemini wants back with its function calls.
+type GeminiProvider struct {
+	APIBase string
+	Model   string
+	keys    *keyPool
+	retry   RetryPolicy
+	mu      sync.RWMutex // Guards APIBase, keys and retry, which can be replaced at runtime
+
+	sigMu      sync.Mutex
+	signatures map[string]string // Thought signature by tool call ID
+	sigOrder   []string          // Tool call IDs, oldest first
+}
+
+// NewGeminiProvider creates a new GeminiProvider.
+func NewGeminiProvider(creds Credentials, defaultModel string) *GeminiProvider {
+	if defaultModel == "" {
+		defaultModel = "gemini-2.5-flash"
+	}
+	p := &GeminiProvider{Model: defaultModel, signatures: make(map[string]string)}
+	p.SetCredentials(creds)
+	return p
+}
+
+// isGeminiCompatBase reports whether a Gemini API base is the OpenAI
+// compatible endpoint, which is served by OpenAIProvider instead.
+func isGeminiCompatBase(apiBase string) bool {
+	return strings.HasSuffix(strings.TrimRight(apiBase, "/"), "/openai")
+}
+
+// SetCredentials replaces the API keys and base used by subsequent requests.
+func (p *GeminiProvider) SetCredentials(creds Credentials) {
+	if creds.APIBase == "" {
+		creds.APIBase = defaultGeminiAPIBase
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.APIBase = creds.APIBase
+	p.keys = newKeyPool(creds, p.keys)
+	p.retry = creds.Retry
+}
+
+// Gemini request and response bodies.
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	ThoughtSignature string                  `json:"thoughtSignature,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FileData         *geminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+type geminiFileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+type geminiFunctionCall struct {
+	ID   string                 `json:"id,omitempty"`
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+type geminiFunctionResponse struct {
+	ID       string                 `json:"id,omitempty"`
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name                 string          `json:"name"`
+	Description          string          `json:"description,omitempty"`
+	ParametersJSONSchema json.RawMessage `json:"parametersJsonSchema,omitempty"`
+}
+
+type geminiRequest struct {
+	Contents          []geminiContent  `json:"contents"`
+	SystemInstruction *geminiContent   `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool     `json:"tools,omitempty"`
+	GenerationConfig  *geminiGenConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiGenConfig struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	Error json.RawMessage `json:"error"` // Sent instead mid-stream on failure
+}
+
+// usage returns the token counts in the OpenAI names the agent uses, or nil.
+func (r *geminiResponse) usage() map[string]int {
+	u := r.UsageMetadata
+	if u.TotalTokenCount == 0 {
+		return nil
+	}
+	return map[string]int{
+		"prompt_tokens":     u.PromptTokenCount,
+		"completion_tokens": u.CandidatesTokenCount,
+		"total_tokens":      u.TotalTokenCount,
+	}
+}
+
+// geminiFinishReason maps Gemini's finish reasons to OpenAI's.
+func geminiFinishReason(reason string, toolCalls bool) string {
+	switch {
+	case toolCalls:
+		return "tool_calls"
+	case reason == "" || reason == "STOP":
+		return "stop"
+	case reason == "MAX_TOKENS":
+		return "length"
+	case reason == "SAFETY", reason == "RECITATION", reason == "BLOCKLIST", reason == "PROHIBITED_CONTENT", reason == "SPII":
+		return "content_filter"
+	}
+	return strings.ToLower(reason)
+}
+
+// request converts OpenAI-style messages and tools to a Gemini request.
+func (p *GeminiProvider) request(ctx context.Context, messages []interface{}, tools []interface{}) (*geminiRequest, error) {
+	req := &geminiRequest{}
+	var system []string
+	for _, m := range messages {
+		msg, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		role, _ := msg["role"].(string)
+		var content geminiContent
+		switch role {
+		case "system":
+			if text := contentText(msg["content"]); text != "" {
+				system = append(system, text)
+			}
+			continue
+		case "assistant":
+			content = geminiContent{Role: "model"}
+			if text := contentText(msg["content"]); text != "" {
+				content.Parts = append(content.Parts, geminiPart{Text: text})
+			}
+			calls, _ := msg["tool_calls"].([]interface{})
+			for _, c := range calls {
+				call, _ := c.(map[string]interface{})
+				id, _ := call["id"].(string)
+				fn, _ := call["function"].(map[string]interface{})
+				name, _ := fn["name"].(string)
+				var args map[string]interface{}
+				if s, ok := fn["arguments"].(string); ok && s != "" {
+					json.Unmarshal([]byte(s), &args)
+				}
+				part := geminiPart{
+					FunctionCall:     &geminiFunctionCall{ID: geminiCallID(id), Name: name, Args: args},
+					ThoughtSignature: p.signature(id),
+				}
+				content.Parts = append(content.Parts, part)
+			}
+		case "tool":
+			id, _ := msg["tool_call_id"].(string)
+			name, _ := msg["name"].(string)
+			content = geminiContent{Role: "user", Parts: []geminiPart{{FunctionResponse: &geminiFunctionResponse{
+				ID:       geminiCallID(id),
+				Name:     name,
+				Response: map[string]interface{}{"result": contentText(msg["content"])},
+			}}}}
+		default:
+			content = geminiContent{Role: "user", Parts: userParts(msg["content"])}
+		}
+		if len(content.Parts) == 0 {
+			continue
+		}
+		// Gemini wants turns to alternate, so consecutive tool results and
+		// messages of the same role share one turn
+		if n := len(req.Contents); n > 0 && req.Contents[n-1].Role == content.Role {
+			req.Contents[n-1].Parts = append(req.Contents[n-1].Parts, content.Parts...)
+			continue
+		}
+		req.Contents = append(req.Contents, content)
+	}
+	if len(system) > 0 {
+		req.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: strings.Join(system, "\n\n")}}}
+	}
+
+	if len(tools) > 0 {
+		data, err := json.Marshal(tools)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal tools: %w", err)
+		}
+		var defs []struct {
+			Function struct {
+				Name        string          `json:"name"`
+				Description string          `json:"description"`
+				Parameters  json.RawMessage `json:"parameters"`
+			} `json:"function"`
+		}
+		if err := json.Unmarshal(data, &defs); err != nil {
+			return nil, fmt.Errorf("failed to read tools: %w", err)
+		}
+		var decls []geminiFunctionDeclaration
+		for _, d := range defs {
+			decl := geminiFunctionDeclaration{Name: d.Function.Name, Description: d.Function.Description}
+			if len(d.Function.Parameters) > 0 && string(d.Function.Parameters) != "null" {
+				decl.ParametersJSONSchema = d.Function.Parameters
+			}
+			decls = append(decls, decl)
+		}
+		req.Tools = []geminiTool{{FunctionDeclarations: decls}}
+	}
+
+	if t, ok := temperature(ctx); ok {
+		req.GenerationConfig = &geminiGenConfig{Temperature: &t}
+	}
+	return req, nil
+}
+
+// contentParts returns the parts of a multimodal message content, however
+// it was built or decoded.
+func contentParts(content interface{}) []map[string]interface{} {
+	switch c := content.(type) {
+	case []map[string]interface{}:
+		return c
+	case []interface{}:
+		parts := make([]map[string]interface{}, 0, len(c))
+		for _, p := range c {
+			if part, ok := p.(map[string]interface{}); ok {
+				parts = append(parts, part)
+			}
+		}
+		return parts
+	}
+	return nil
+}
+
+// contentText returns the text of a message content.
+func contentText(content interface{}) string {
+	if s, ok := content.(string); ok {
+		return s
+	}
+	var texts []string
+	for _, part := range contentParts(content) {
+		if text, ok := part["text"].(string); ok && text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// userParts converts a user message content to Gemini parts: images given
+// as data URLs are sent inline, others by URL.
+func userParts(content interface{}) []geminiPart {
+	if s, ok := content.(string); ok {
+		if s == "" {
+			return nil
+		}
+		return []geminiPart{{Text: s}}
+	}
+	var parts []geminiPart
+	for _, part := range contentParts(content) {
+		switch part["type"] {
+		case "text":
+			if text, _ := part["text"].(string); text != "" {
+				parts = append(parts, geminiPart{Text: text})
+			}
+		case "image_url":
+			var url string
+			switch image := part["image_url"].(type) {
+			case map[string]interface{}:
+				url, _ = image["url"].(string)
+			case map[string]string:
+				url = image["url"]
+			}
+			if rest, ok := strings.CutPrefix(url, "data:"); ok {
+				if meta, data, ok := strings.Cut(rest, ","); ok && strings.HasSuffix(meta, ";base64") {
+					parts = append(parts, geminiPart{InlineData: &geminiBlob{MimeType: strings.TrimSuffix(meta, ";base64"), Data: data}})
+				}
+			} else if url != "" {
+				parts = append(parts, geminiPart{FileData: &geminiFileData{MimeType: mime.TypeByExtension(path.Ext(url)), FileURI: url}})
+			}
+		}
+	}
+	return parts
+}
+
+// geminiCallID returns the ID to send Gemini for a tool call: its own, or
+// none for IDs made up here.
+func geminiCallID(id string) string {
+	if strings.HasPrefix(id, geminiCallPrefix) {
+		return ""
+	}
+	return id
+}
+
+// callID returns the ID of a function call Gemini made, making one up if
+// it gave none, and remembers the call's thought signature.
+func (p *GeminiProvider) callID(part geminiPart) string {
+	id := part.FunctionCall.ID
+	if id == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id = geminiCallPrefix + hex.EncodeToString(b)
+	}
+	if part.ThoughtSignature != "" {
+		p.sigMu.Lock()
+		defer p.sigMu.Unlock()
+		p.signatures[id] = part.ThoughtSignature
+		p.sigOrder = append(p.sigOrder, id)
+		if len(p.sigOrder) > maxThoughtSignatures {
+			delete(p.signatures, p.sigOrder[0])
+			p.sigOrder = p.sigOrder[1:]
+		}
+	}
+	return id
+}
+
+// signature returns the thought signature of a tool call, if remembered.
+func (p *GeminiProvider) signature(id string) string {
+	p.sigMu.Lock()
+	defer p.sigMu.Unlock()
+	return p.signatures[id]
+}
+
+func (p *GeminiProvider) apiBase() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.APIBase
+}
+
+// post sends a request for model to a generateContent method, moving on to
+// the next API key when one is rate limited or rejected and retrying
+// transient failures. The caller closes the response body.
+func (p *GeminiProvider) post(ctx context.Context, model, method string, body []byte) (*http.Response, error) {
+	p.mu.RLock()
+	apiBase, keys, retry := p.APIBase, p.keys, p.retry
+	p.mu.RUnlock()
+
+	model = strings.TrimPrefix(model, "models/")
+	url := fmt.Sprintf("%s/models/%s:%s", strings.TrimRight(apiBase, "/"), model, method)
+	return send(ctx, keys, retry, func(apiKey string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-goog-api-key", apiKey)
+		return req, nil
+	})
+}
+
+// Chat sends a generateContent request.
+func (p *GeminiProvider) Chat(ctx context.Context, messages []interface{}, tools []interface{}, model string) (*LLMResponse, error) {
+	if model == "" {
+		model = p.Model
+	}
+	ctx, span := startCall(ctx, "gemini", p.apiBase(), model, false)
+	resp, err := p.chat(ctx, messages, tools, model)
+	endCall(span, resp, err)
+	return resp, err
+}
+
+func (p *GeminiProvider) chat(ctx context.Context, messages []interface{}, tools []interface{}, model string) (*LLMResponse, error) {
+	req, err := p.request(ctx, messages, tools)
+	if err != nil {
+		return nil, err
+	}
+	jsonBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	resp, err := p.post(ctx, model, "generateContent", jsonBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, apiError(resp.StatusCode, bodyBytes)
+	}
+
+	var response geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if len(response.Candidates) == 0 {
+		if reason := response.PromptFeedback.BlockReason; reason != "" {
+			return nil, fmt.Errorf("prompt blocked by Gemini: %s", reason)
+		}
+		return nil, fmt.Errorf("no candidates in response")
+	}
+
+	candidate := response.Candidates[0]
+	llmResp := &LLMResponse{Usage: response.usage()}
+	var text strings.Builder
+	for _, part := range candidate.Content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			args := part.FunctionCall.Args
+			if args == nil {
+				args = make(map[string]interface{})
+			}
+			llmResp.ToolCalls = append(llmResp.ToolCalls, ToolCallRequest{
+				ID:        p.callID(part),
+				Name:      part.FunctionCall.Name,
+				Arguments: args,
+			})
+		case !part.Thought:
+			text.WriteString(part.Text)
+		}
+	}
+	llmResp.Content = text.String()
+	llmResp.FinishReason = geminiFinishReason(candidate.FinishReason, len(llmResp.ToolCalls) > 0)
+	return llmResp, nil
+}
+
+// Stream sends a streamGenerateContent request.
+func (p *GeminiProvider) Stream(ctx context.Context, messages []interface{}, tools []interface{}, model string) (<-chan LLMStreamChunk, error) {
+	if model == "" {
+		model = p.Model
+	}
+	ctx, span := startCall(ctx, "gemini", p.apiBase(), model, true)
+	stream, err := p.stream(ctx, messages, tools, model)
+	if err != nil {
+		endCall(span, nil, err)
+		return nil, err
+	}
+	return traceStream(span, stream), nil
+}
+
+func (p *GeminiProvider) stream(ctx context.Context, messages []interface{}, tools []interface{}, model string) (<-chan LLMStreamChunk, error) {
+	req, err := p.request(ctx, messages, tools)
+	if err != nil {
+		return nil, err
+	}
+	jsonBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	resp, err := p.post(ctx, model, "streamGenerateContent?alt=sse", jsonBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, apiError(resp.StatusCode, bodyBytes)
+	}
+
+	ch := make(chan LLMStreamChunk)
+
+	go func() {
+		defer resp.Body.Close()
+		defer close(ch)
+
+		calls := 0
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				if err != io.EOF {
+					ch <- LLMStreamChunk{Error: err}
+				}
+				return
+			}
+
+			line = strings.TrimSpace(line)
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+
+			var chunk geminiResponse
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk); err != nil {
+				continue
+			}
+			if len(chunk.Error) > 0 {
+				if err := streamError([]byte(strings.TrimPrefix(line, "data: "))); err != nil {
+					ch <- LLMStreamChunk{Error: err}
+					return
+				}
+			}
+			if len(chunk.Candidates) == 0 && chunk.PromptFeedback.BlockReason != "" {
+				ch <- LLMStreamChunk{Error: fmt.Errorf("prompt blocked by Gemini: %s", chunk.PromptFeedback.BlockReason)}
+				return
+			}
+
+			if len(chunk.Candidates) > 0 {
+				candidate := chunk.Candidates[0]
+				for _, part := range candidate.Content.Parts {
+					switch {
+					case part.FunctionCall != nil:
+						args := []byte("{}")
+						if part.FunctionCall.Args != nil {
+							args, _ = json.Marshal(part.FunctionCall.Args)
+						}
+						ch <- LLMStreamChunk{ToolCall: &ToolCallChunk{
+							Index:     calls,
+							ID:        p.callID(part),
+							Name:      part.FunctionCall.Name,
+							Arguments: string(args),
+						}}
+						calls++
+					case !part.Thought && part.Text != "":
+						ch <- LLMStreamChunk{Content: part.Text}
+					}
+				}
+				if candidate.FinishReason != "" {
+					ch <- LLMStreamChunk{FinishReason: geminiFinishReason(candidate.FinishReason, calls > 0)}
+				}
+			}
+
+			if usage := chunk.usage(); usage != nil {
+				ch <- LLMStreamChunk{Usage: usage}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// GetDefaultModel returns the default model.
+func (p *GeminiProvider) GetDefaultModel() string {
+	return p.Model
+}
@@ -0,0 +1,147 @@
+package providers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultKeyCooldown is how long a rate-limited key is skipped when the
+// provider config and the Retry-After header do not say.
+const defaultKeyCooldown = 60 * time.Second
+
+// Credentials are the API keys and base URL a provider sends requests with.
+type Credentials struct {
+	APIKeys      []string
+	APIBase      string
+	KeySelection string        // "round-robin" (default) or "least-errors"
+	KeyCooldown  time.Duration // How long a key answering 429 is skipped
+	Retry        RetryPolicy
+}
+
+// keyPool spreads requests over several API keys and rests keys that are
+// rate limited or rejected.
+type keyPool struct {
+	mu        sync.Mutex
+	keys      []*poolKey
+	next      int
+	selection string
+	cooldown  time.Duration
+}
+
+type poolKey struct {
+	key       string
+	errors    int
+	coolUntil time.Time
+}
+
+// newKeyPool creates a pool for creds, keeping the error counts and
+// cool-downs of keys that were already in old.
+func newKeyPool(creds Credentials, old *keyPool) *keyPool {
+	p := &keyPool{selection: creds.KeySelection, cooldown: creds.KeyCooldown}
+	if p.cooldown <= 0 {
+		p.cooldown = defaultKeyCooldown
+	}
+	prev := make(map[string]*poolKey)
+	if old != nil {
+		old.mu.Lock()
+		for _, k := range old.keys {
+			prev[k.key] = k
+		}
+		old.mu.Unlock()
+	}
+	for _, key := range creds.APIKeys {
+		if k, ok := prev[key]; ok {
+			p.keys = append(p.keys, k)
+		} else {
+			p.keys = append(p.keys, &poolKey{key: key})
+		}
+	}
+	return p
+}
+
+// pick returns the next key to use that is not in tried. Keys cooling down
+// are skipped, except that the first pick of a request falls back to the key
+// whose cool-down ends soonest. ok is false when no key is left to try.
+func (p *keyPool) pick(tried map[string]bool) (key string, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.keys) == 0 {
+		return "", len(tried) == 0
+	}
+	now := time.Now()
+	var best, soonest *poolKey
+	bestIdx := 0
+	for i := 0; i < len(p.keys); i++ {
+		idx := (p.next + i) % len(p.keys)
+		k := p.keys[idx]
+		if tried[k.key] {
+			continue
+		}
+		if now.Before(k.coolUntil) {
+			if soonest == nil || k.coolUntil.Before(soonest.coolUntil) {
+				soonest = k
+			}
+			continue
+		}
+		if best == nil || p.selection == "least-errors" && k.errors < best.errors {
+			best, bestIdx = k, idx
+		}
+		if p.selection != "least-errors" {
+			break
+		}
+	}
+	if best != nil {
+		p.next = bestIdx + 1
+		return best.key, true
+	}
+	if soonest != nil && len(tried) == 0 {
+		return soonest.key, true
+	}
+	return "", false
+}
+
+// report records the outcome of a request made with key. A 429 or 401/403
+// rests the key for the cool-down, or for Retry-After when that is longer.
+// It returns true if the key was rested.
+func (p *keyPool) report(key string, resp *http.Response) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var k *poolKey
+	for _, pk := range p.keys {
+		if pk.key == key {
+			k = pk
+		}
+	}
+	if k == nil {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusUnauthorized, http.StatusForbidden:
+		k.errors++
+		wait := p.cooldown
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && time.Duration(secs)*time.Second > wait {
+			wait = time.Duration(secs) * time.Second
+		}
+		k.coolUntil = time.Now().Add(wait)
+		log.Printf("API key %s got status %d, resting it for %s", maskKey(key), resp.StatusCode, wait)
+		return true
+	default:
+		if resp.StatusCode >= 500 {
+			k.errors++
+		}
+		return false
+	}
+}
+
+// maskKey shortens an API key for logs.
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "***"
+	}
+	return key[:3] + "..." + key[len(key)-4:]
+}
@@ -9,28 +9,72 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 )
 
 // OpenAIProvider implements the LLMProvider interface for OpenAI-compatible APIs.
 type OpenAIProvider struct {
-	APIKey  string
 	APIBase string
 	Model   string
+	keys    *keyPool
+	retry   RetryPolicy
+	mu      sync.RWMutex // Guards APIBase, keys and retry, which can be replaced at runtime
 }
 
 // NewOpenAIProvider creates a new OpenAIProvider.
-func NewOpenAIProvider(apiKey, apiBase, defaultModel string) *OpenAIProvider {
-	if apiBase == "" {
-		apiBase = "https://api.openai.com/v1"
-	}
+func NewOpenAIProvider(creds Credentials, defaultModel string) *OpenAIProvider {
 	if defaultModel == "" {
 		defaultModel = "gpt-4o"
 	}
-	return &OpenAIProvider{
-		APIKey:  apiKey,
-		APIBase: apiBase,
-		Model:   defaultModel,
+	p := &OpenAIProvider{Model: defaultModel}
+	p.SetCredentials(creds)
+	return p
+}
+
+// SetCredentials replaces the API keys and base used by subsequent requests.
+// Keys that stay in the list keep their error counts and cool-downs.
+func (p *OpenAIProvider) SetCredentials(creds Credentials) {
+	if creds.APIBase == "" {
+		creds.APIBase = "https://api.openai.com/v1"
 	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.APIBase = creds.APIBase
+	p.keys = newKeyPool(creds, p.keys)
+	p.retry = creds.Retry
+}
+
+func (p *OpenAIProvider) apiBase() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.APIBase
+}
+
+// post sends a chat completions request, moving on to the next API key
+// when one is rate limited or rejected and retrying transient failures.
+// The caller closes the response body.
+func (p *OpenAIProvider) post(ctx context.Context, body []byte) (*http.Response, error) {
+	p.mu.RLock()
+	apiBase, keys, retry := p.APIBase, p.keys, p.retry
+	p.mu.RUnlock()
+
+	url := fmt.Sprintf("%s/chat/completions", strings.TrimRight(apiBase, "/"))
+	return send(ctx, keys, retry, func(apiKey string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
+
+		// Handle special headers for providers like OpenRouter if needed
+		if strings.Contains(apiBase, "openrouter.ai") {
+			req.Header.Set("HTTP-Referer", "https://github.com/HKUDS/nanobot")
+			req.Header.Set("X-Title", "nanobot")
+		}
+		return req, nil
+	})
 }
 
 // Chat sends a chat completion request.
@@ -38,8 +82,13 @@ func (p *OpenAIProvider) Chat(ctx context.Context, messages []interface{}, tools
 	if model == "" {
 		model = p.Model
 	}
+	ctx, span := startCall(ctx, "openai", p.apiBase(), model, false)
+	resp, err := p.chat(ctx, messages, tools, model)
+	endCall(span, resp, err)
+	return resp, err
+}
 
-	url := fmt.Sprintf("%s/chat/completions", strings.TrimRight(p.APIBase, "/"))
+func (p *OpenAIProvider) chat(ctx context.Context, messages []interface{}, tools []interface{}, model string) (*LLMResponse, error) {
 
 	reqBody := map[string]interface{}{
 		"model":    model,
@@ -49,36 +98,24 @@ func (p *OpenAIProvider) Chat(ctx context.Context, messages []interface{}, tools
 	if len(tools) > 0 {
 		reqBody["tools"] = tools
 	}
+	if t, ok := temperature(ctx); ok {
+		reqBody["temperature"] = t
+	}
 
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
+	resp, err := p.post(ctx, jsonBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.APIKey))
-
-	// Handle special headers for providers like OpenRouter if needed
-	if strings.Contains(p.APIBase, "openrouter.ai") {
-		req.Header.Set("HTTP-Referer", "https://github.com/HKUDS/nanobot")
-		req.Header.Set("X-Title", "nanobot")
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+		return nil, apiError(resp.StatusCode, bodyBytes)
 	}
 
 	var response struct {
@@ -146,8 +183,16 @@ func (p *OpenAIProvider) Stream(ctx context.Context, messages []interface{}, too
 	if model == "" {
 		model = p.Model
 	}
+	ctx, span := startCall(ctx, "openai", p.apiBase(), model, true)
+	stream, err := p.stream(ctx, messages, tools, model)
+	if err != nil {
+		endCall(span, nil, err)
+		return nil, err
+	}
+	return traceStream(span, stream), nil
+}
 
-	url := fmt.Sprintf("%s/chat/completions", strings.TrimRight(p.APIBase, "/"))
+func (p *OpenAIProvider) stream(ctx context.Context, messages []interface{}, tools []interface{}, model string) (<-chan LLMStreamChunk, error) {
 
 	reqBody := map[string]interface{}{
 		"model":    model,
@@ -158,6 +203,9 @@ func (p *OpenAIProvider) Stream(ctx context.Context, messages []interface{}, too
 	if len(tools) > 0 {
 		reqBody["tools"] = tools
 	}
+	if t, ok := temperature(ctx); ok {
+		reqBody["temperature"] = t
+	}
 
 	jsonBody, err := json.Marshal(reqBody)
 	if err != nil {
@@ -166,28 +214,15 @@ func (p *OpenAIProvider) Stream(ctx context.Context, messages []interface{}, too
 
 	// log.Printf("Sending request to OpenAI API: %s", string(jsonBody))
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.APIKey))
-
-	if strings.Contains(p.APIBase, "openrouter.ai") {
-		req.Header.Set("HTTP-Referer", "https://github.com/HKUDS/nanobot")
-		req.Header.Set("X-Title", "nanobot")
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := p.post(ctx, jsonBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
-		return nil, fmt.Errorf("API request failed with status %d", resp.StatusCode)
+		return nil, apiError(resp.StatusCode, bodyBytes)
 	}
 
 	ch := make(chan LLMStreamChunk)
@@ -236,12 +271,20 @@ func (p *OpenAIProvider) Stream(ctx context.Context, messages []interface{}, too
 					CompletionTokens int `json:"completion_tokens"`
 					TotalTokens      int `json:"total_tokens"`
 				} `json:"usage"`
+				Error json.RawMessage `json:"error"`
 			}
 
 			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
 				// Ignore parse errors for partial lines or keep going
 				continue
 			}
+			if len(chunk.Error) > 0 && string(chunk.Error) != "null" {
+				// Some providers report failures after the stream started
+				if err := streamError([]byte(data)); err != nil {
+					ch <- LLMStreamChunk{Error: err}
+					return
+				}
+			}
 			// log.Printf("Received chunk: %s", data)
 
 			if len(chunk.Choices) > 0 {
@@ -2,6 +2,8 @@ package providers
 
 import (
 	"context"
+	"errors"
+	"strings"
 )
 
 // ToolCallRequest represents a tool call request from the LLM.
@@ -31,6 +33,61 @@ type LLMProvider interface {
 	GetDefaultModel() string
 }
 
+// ErrContextLength is returned, wrapped, when a provider rejects a request
+// for not fitting in the model's context window.
+var ErrContextLength = errors.New("request exceeds the model's context window")
+
+// Other reasons a provider rejects requests for, wrapped by APIError.
+var (
+	ErrAuth          = errors.New("the provider rejected the API key")
+	ErrQuota         = errors.New("the provider account is out of quota or credit")
+	ErrRateLimited   = errors.New("the provider is rate limiting requests")
+	ErrModelNotFound = errors.New("the model is unknown to the provider")
+)
+
+// contextLengthMarkers are phrases providers use to reject overlong prompts:
+// OpenAI-compatible APIs, Anthropic, Gemini, vLLM and llama.cpp among them.
+var contextLengthMarkers = []string{
+	"context_length_exceeded",
+	"maximum context length",
+	"context length",
+	"context window",
+	"prompt is too long",
+	"input is too long",
+	"too many tokens",
+	"exceeds the maximum number of tokens",
+	"reduce the length of the messages",
+}
+
+// isContextLengthError reports whether an error response says the request
+// was too long for the model. Status is 0 for an error sent mid-stream.
+func isContextLengthError(status int, body []byte) bool {
+	if status != 0 && status != 400 && status != 413 && status != 422 {
+		return false
+	}
+	text := strings.ToLower(string(body))
+	for _, marker := range contextLengthMarkers {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+type temperatureKey struct{}
+
+// WithTemperature returns a context whose requests are sent with
+// temperature t instead of the model's default.
+func WithTemperature(ctx context.Context, t float64) context.Context {
+	return context.WithValue(ctx, temperatureKey{}, t)
+}
+
+// temperature returns the temperature set with WithTemperature.
+func temperature(ctx context.Context) (float64, bool) {
+	t, ok := ctx.Value(temperatureKey{}).(float64)
+	return t, ok
+}
+
 // LLMStreamChunk represents a chunk of the streaming response.
 type LLMStreamChunk struct {
 	Content      string         `json:"content,omitempty"`
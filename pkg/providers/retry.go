@@ -0,0 +1,146 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/config"
+	"github.com/HKUDS/nanobot-go/pkg/tracing"
+)
+
+// RetryPolicy is how a provider retries requests that failed for reasons
+// that may pass: rate limits, server errors and network errors. A used-up
+// quota is not retried.
+type RetryPolicy struct {
+	MaxAttempts  int // Tries in all; 1 or less means no retries
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Jitter       float64 // Fraction the delay is randomized by
+}
+
+// retryPolicy converts the providers.retry config.
+func retryPolicy(rc config.RetryConfig) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:  rc.MaxAttempts,
+		InitialDelay: time.Duration(rc.InitialDelayMs) * time.Millisecond,
+		MaxDelay:     time.Duration(rc.MaxDelayMs) * time.Millisecond,
+		Jitter:       rc.Jitter,
+	}
+}
+
+// retryableStatus reports whether a request that got status may succeed
+// when tried again.
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusRequestTimeout || status >= 500
+}
+
+// retryAfter returns the wait a Retry-After header asks for, in seconds or
+// as a date, or 0.
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// jittered randomizes d by the policy's jitter.
+func (r RetryPolicy) jittered(d time.Duration) time.Duration {
+	if r.Jitter <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + r.Jitter*(2*rand.Float64()-1)))
+}
+
+// send sends the request newRequest makes for an API key from keys. A key
+// that is rate limited or rejected is rested and the next one is tried
+// right away; when no key is left, or the failure is a server or network
+// error, the request is retried after a growing delay as the policy
+// allows. The caller closes the response body.
+func send(ctx context.Context, keys *keyPool, retry RetryPolicy, newRequest func(apiKey string) (*http.Request, error)) (*http.Response, error) {
+	delay := retry.InitialDelay
+	for attempt := 1; ; attempt++ {
+		resp, err := sendWithKeys(keys, newRequest)
+		last := attempt >= retry.MaxAttempts || ctx.Err() != nil
+		var wait time.Duration
+		var netErr net.Error
+		switch {
+		case err != nil:
+			if last || !errors.As(err, &netErr) {
+				return nil, err
+			}
+			log.Printf("Model request failed (%v), retrying (attempt %d of %d)", err, attempt+1, retry.MaxAttempts)
+			tracing.FromContext(ctx).AddEvent("retry", tracing.Int("attempt", attempt+1), tracing.String("error", err.Error()))
+		case retryableStatus(resp.StatusCode) && !last:
+			wait = retryAfter(resp.Header)
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+			if errors.Is(apiError(resp.StatusCode, body), ErrQuota) || retry.MaxDelay > 0 && wait > retry.MaxDelay {
+				// Not worth trying again or waiting; a fallback model may answer sooner
+				resp.Body = io.NopCloser(bytes.NewReader(body))
+				return resp, nil
+			}
+			log.Printf("Model request failed with status %d, retrying (attempt %d of %d)", resp.StatusCode, attempt+1, retry.MaxAttempts)
+			tracing.FromContext(ctx).AddEvent("retry", tracing.Int("attempt", attempt+1), tracing.Int("http.response.status_code", resp.StatusCode))
+		default:
+			return resp, nil
+		}
+
+		if backoff := retry.jittered(delay); backoff > wait {
+			wait = backoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+		if retry.MaxDelay > 0 && delay > retry.MaxDelay {
+			delay = retry.MaxDelay
+		}
+	}
+}
+
+// sendWithKeys sends a request, moving on to the next API key when one is
+// rate limited or rejected.
+func sendWithKeys(keys *keyPool, newRequest func(apiKey string) (*http.Request, error)) (*http.Response, error) {
+	tried := make(map[string]bool)
+	apiKey, _ := keys.pick(tried)
+	for {
+		tried[apiKey] = true
+		req, err := newRequest(apiKey)
+		if err != nil {
+			return nil, err
+		}
+		client := &http.Client{}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send request: %w", err)
+		}
+		if keys.report(apiKey, resp) {
+			if next, ok := keys.pick(tried); ok {
+				resp.Body.Close()
+				apiKey = next
+				continue
+			}
+		}
+		return resp, nil
+	}
+}
@@ -0,0 +1,97 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/HKUDS/nanobot-go/pkg/config"
+)
+
+// Router is an LLMProvider that resolves model aliases from the config's
+// models table. An alias target of the form "<provider>/<model>", where
+// <provider> is a configured provider such as groq or deepseek, is sent to
+// that provider; any other model goes to the default provider unchanged.
+type Router struct {
+	Default LLMProvider
+	Aliases map[string]string
+
+	mu    sync.Mutex
+	cfg   *config.Config
+	named map[string]LLMProvider // Created on first use
+}
+
+// NewRouter creates a Router over the default provider.
+func NewRouter(cfg *config.Config, defaultProvider LLMProvider) *Router {
+	return &Router{
+		Default: defaultProvider,
+		Aliases: cfg.Models,
+		cfg:     cfg,
+		named:   make(map[string]LLMProvider),
+	}
+}
+
+// Resolve returns the provider and model ID that a model name or alias maps to.
+func (r *Router) Resolve(model string) (LLMProvider, string) {
+	if model == "" {
+		model = r.Default.GetDefaultModel()
+	}
+	target, ok := r.Aliases[model]
+	if !ok {
+		return r.Default, model
+	}
+
+	if i := strings.Index(target, "/"); i > 0 {
+		name := strings.ToLower(target[:i])
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if p, ok := r.named[name]; ok {
+			return p, target[i+1:]
+		}
+		if creds, ok := namedCredentials(r.cfg, name); ok && (len(creds.APIKeys) > 0 || creds.APIBase != "") {
+			p := newNamedProvider(name, creds, target[i+1:])
+			r.named[name] = p
+			return p, target[i+1:]
+		}
+	}
+	return r.Default, target
+}
+
+// Chat sends a chat completion request to the provider the model resolves to.
+func (r *Router) Chat(ctx context.Context, messages []interface{}, tools []interface{}, model string) (*LLMResponse, error) {
+	p, resolved := r.Resolve(model)
+	return p.Chat(ctx, messages, tools, resolved)
+}
+
+// Stream sends a streaming chat completion request to the provider the model resolves to.
+func (r *Router) Stream(ctx context.Context, messages []interface{}, tools []interface{}, model string) (<-chan LLMStreamChunk, error) {
+	p, resolved := r.Resolve(model)
+	return p.Stream(ctx, messages, tools, resolved)
+}
+
+// GetDefaultModel returns the default model, which may be an alias.
+func (r *Router) GetDefaultModel() string {
+	return r.Default.GetDefaultModel()
+}
+
+// updateCredentials re-reads the keys of the default provider and of every
+// provider an alias has been routed to.
+func (r *Router) updateCredentials(cfg *config.Config) error {
+	if err := UpdateCredentials(r.Default, cfg); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cfg = cfg
+	for name, p := range r.named {
+		creds, ok := namedCredentials(cfg, name)
+		if !ok {
+			return fmt.Errorf("unknown provider: %s", name)
+		}
+		if updater, ok := p.(CredentialUpdater); ok {
+			updater.SetCredentials(creds)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package providers
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/tracing"
+)
+
+// startCall starts the span of a model request, named and described the
+// way OpenTelemetry's generative AI conventions have it.
+func startCall(ctx context.Context, system, apiBase, model string, stream bool) (context.Context, *tracing.Span) {
+	attrs := []tracing.Attr{
+		tracing.String("gen_ai.operation.name", "chat"),
+		tracing.String("gen_ai.system", system),
+		tracing.String("gen_ai.request.model", model),
+		tracing.Bool("gen_ai.request.stream", stream),
+	}
+	if u, err := url.Parse(apiBase); err == nil && u.Host != "" {
+		attrs = append(attrs, tracing.String("server.address", u.Hostname()))
+	}
+	return tracing.StartClient(ctx, "chat "+model, attrs...)
+}
+
+// endCall ends a model request's span with the response's usage or the
+// error it failed with.
+func endCall(span *tracing.Span, resp *LLMResponse, err error) {
+	if resp != nil {
+		span.SetAttributes(usageAttrs(resp.Usage)...)
+		span.SetAttributes(tracing.Strings("gen_ai.response.finish_reasons", []string{resp.FinishReason}))
+		span.SetAttributes(tracing.Int("gen_ai.response.tool_calls", len(resp.ToolCalls)))
+	}
+	span.RecordError(err)
+	span.End()
+}
+
+func usageAttrs(usage map[string]int) []tracing.Attr {
+	if usage == nil {
+		return nil
+	}
+	return []tracing.Attr{
+		tracing.Int("gen_ai.usage.input_tokens", usage["prompt_tokens"]),
+		tracing.Int("gen_ai.usage.output_tokens", usage["completion_tokens"]),
+	}
+}
+
+// traceStream passes a stream's chunks on, ending span when the stream
+// ends, with the time the first chunk took, the usage reported and the
+// error the stream failed with.
+func traceStream(span *tracing.Span, in <-chan LLMStreamChunk) <-chan LLMStreamChunk {
+	if span == nil {
+		return in
+	}
+	out := make(chan LLMStreamChunk)
+	go func() {
+		defer close(out)
+		defer span.End()
+		first := true
+		for chunk := range in {
+			if first {
+				first = false
+				span.AddEvent("first chunk", tracing.Int("gen_ai.response.time_to_first_chunk_ms", int(time.Since(span.StartTime())/time.Millisecond)))
+			}
+			if chunk.Usage != nil {
+				span.SetAttributes(usageAttrs(chunk.Usage)...)
+			}
+			if chunk.FinishReason != "" {
+				span.SetAttributes(tracing.Strings("gen_ai.response.finish_reasons", []string{chunk.FinishReason}))
+			}
+			span.RecordError(chunk.Error)
+			out <- chunk
+		}
+	}()
+	return out
+}
@@ -0,0 +1,511 @@
+// Package purge removes what nanobot keeps about one user, for requests to
+// have personal data deleted: their messages in sessions and on the bus,
+// the files they sent, the memory of their chats and the contact they are,
+// their credentials, their feedback, and the usage records and research
+// tasks of their chats, and reports what was removed and what was kept.
+package purge
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+	"github.com/HKUDS/nanobot-go/pkg/config"
+	"github.com/HKUDS/nanobot-go/pkg/contacts"
+	"github.com/HKUDS/nanobot-go/pkg/memory"
+	"github.com/HKUDS/nanobot-go/pkg/secrets"
+	"github.com/HKUDS/nanobot-go/pkg/session"
+)
+
+// Purger removes a user's data from a workspace.
+type Purger struct {
+	Workspace string
+	Sessions  *session.Manager
+	Memory    *memory.MemoryStore
+	Secrets   *secrets.Store
+	Contacts  []config.ContactConfig
+	// Journals purges the bus journals too. Only set it with the gateway
+	// stopped: a running bus rewrites its journals from memory.
+	Journals bool
+}
+
+// Report is what a purge removed, and what it could not.
+type Report struct {
+	Sender          string    `json:"sender"`
+	Time            time.Time `json:"time"`
+	Contact         string    `json:"contact,omitempty"`
+	MessagesRemoved int       `json:"messages_removed"`
+	SessionsDeleted []string  `json:"sessions_deleted,omitempty"`
+	SessionsEdited  []string  `json:"sessions_edited,omitempty"`
+	ArchivesChanged int       `json:"archives_changed"`
+	FactFiles       []string  `json:"fact_files_deleted,omitempty"`
+	MediaFiles      []string  `json:"media_files_deleted,omitempty"`
+	Credentials     []string  `json:"credentials_removed,omitempty"`
+	Feedback        int       `json:"feedback_removed"`
+	Activity        int       `json:"activity_entries_removed"`
+	Workflows       int       `json:"workflows_removed"`
+	Uploads         []string  `json:"uploads_deleted,omitempty"`
+	BusMessages     int       `json:"bus_messages_removed"`
+	Usage           int       `json:"usage_records_removed"`
+	Research        []string  `json:"research_deleted,omitempty"`
+	// OtherUploads counts the files left in uploads/. Files received
+	// before messages recorded their attachments can't be attributed, so
+	// they may include the user's.
+	OtherUploads int `json:"other_uploads,omitempty"`
+	// QueueKept is set when the bus journals were left alone, so messages
+	// still queued for the user were kept until they are handled.
+	QueueKept bool `json:"bus_queue_kept,omitempty"`
+	// OtherIDs are the contact's IDs on other channels, which were not purged.
+	OtherIDs []string `json:"other_ids,omitempty"`
+	// Unattributed are sessions with messages saved before senders were
+	// recorded, which may include the user's and were kept.
+	Unattributed []string `json:"unattributed_sessions,omitempty"`
+}
+
+// ParseSender splits a sender ID, "channel:id", checking it has both parts.
+func ParseSender(sender string) (string, string, error) {
+	channel, id, ok := strings.Cut(strings.TrimSpace(sender), ":")
+	if !ok || channel == "" || id == "" {
+		return "", "", fmt.Errorf("sender %q must be channel:id, e.g. telegram:123456", sender)
+	}
+	return strings.ToLower(channel), id, nil
+}
+
+// matcher returns a function reporting whether a "channel:id" names the
+// sender. IDs like "123|username" match on either part.
+func matcher(channel, id string) func(string) bool {
+	want := strings.Split(id, "|")
+	return func(s string) bool {
+		c, rest, ok := strings.Cut(s, ":")
+		if !ok || !strings.EqualFold(c, channel) {
+			return false
+		}
+		for _, part := range strings.Split(rest, "|") {
+			for _, w := range want {
+				if part != "" && part == w {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// Purge removes everything kept about sender, a "channel:id": their messages
+// and the replies to them in every session and archived copy, sessions left
+// with no one else's messages, the files their messages came with, the
+// facts of their private chat and of deleted sessions, the shared facts of
+// the contact they are, remembered media no longer referenced, their
+// credentials, their feedback records, their entries in the activity ledger
+// and workflow log, their messages in the bus dead letters and, with
+// Journals, the bus journals, and the usage records and research tasks of
+// their private chat and deleted sessions.
+func (p *Purger) Purge(sender string) (*Report, error) {
+	channel, id, err := ParseSender(sender)
+	if err != nil {
+		return nil, err
+	}
+	matches := matcher(channel, id)
+	report := &Report{Sender: channel + ":" + id, Time: time.Now()}
+	report.Contact = contacts.NewDirectory(p.Contacts).Resolve(channel, id)
+
+	result, err := p.Sessions.PurgeSender(matches, matches)
+	if err != nil {
+		return report, fmt.Errorf("purging sessions: %w", err)
+	}
+	report.MessagesRemoved = result.Messages
+	report.SessionsDeleted = result.Deleted
+	report.SessionsEdited = result.Edited
+	report.ArchivesChanged = result.Archives
+	report.Unattributed = result.Unattributed
+	sort.Strings(report.Unattributed)
+
+	deleted := map[string]bool{report.Sender: true}
+	for _, key := range result.Deleted {
+		deleted[key] = true
+	}
+	factFiles := make([]string, 0, len(deleted)+1)
+	for key := range deleted {
+		factFiles = append(factFiles, p.Memory.ChatFactsFile(key))
+	}
+	if report.Contact != "" {
+		factFiles = append(factFiles, p.Memory.ContactFactsFile(report.Contact))
+	}
+	if err := p.purgeFacts(factFiles, report); err != nil {
+		return report, err
+	}
+
+	if p.Secrets != nil {
+		identity := secrets.Identity(report.Contact, channel, id)
+		services, err := p.Secrets.Services(identity)
+		if err != nil {
+			return report, fmt.Errorf("reading credentials: %w", err)
+		}
+		for _, service := range services {
+			if _, err := p.Secrets.Remove(identity, service); err != nil {
+				return report, fmt.Errorf("removing credentials: %w", err)
+			}
+			report.Credentials = append(report.Credentials, identity+"/"+service)
+		}
+	}
+
+	inSession := func(key string) bool {
+		return deleted[key] || matches(key)
+	}
+	inChat := func(rec map[string]interface{}) bool {
+		return inSession(fmt.Sprintf("%v:%v", rec["channel"], rec["chat_id"]))
+	}
+	report.Feedback, err = filterJSONL(filepath.Join(p.Workspace, "feedback", "dataset.jsonl"), func(rec map[string]interface{}) bool {
+		return matches(fmt.Sprintf("%v:%v", rec["channel"], rec["sender_id"])) || inChat(rec)
+	})
+	if err != nil {
+		return report, fmt.Errorf("purging feedback: %w", err)
+	}
+	report.Workflows, err = filterJSONL(filepath.Join(p.Memory.MemoryDir, "workflows.jsonl"), inChat)
+	if err != nil {
+		return report, fmt.Errorf("purging the workflow log: %w", err)
+	}
+	if report.Activity, err = p.purgeActivity(matches); err != nil {
+		return report, fmt.Errorf("purging the activity ledger: %w", err)
+	}
+	if err := p.purgeUploads(result.Media, report); err != nil {
+		return report, fmt.Errorf("purging uploads: %w", err)
+	}
+	busMessage := func(msg interface{}) bool {
+		m, _ := msg.(map[string]interface{})
+		if m == nil {
+			return false
+		}
+		_, inbound := m["sender_id"]
+		return inbound && matches(fmt.Sprintf("%v:%v", m["channel"], m["sender_id"])) || inChat(m)
+	}
+	if report.BusMessages, err = p.purgeBus(busMessage, report); err != nil {
+		return report, fmt.Errorf("purging the bus: %w", err)
+	}
+	usageFiles, _ := filepath.Glob(filepath.Join(p.Workspace, "usage", "*.jsonl"))
+	for _, path := range usageFiles {
+		n, err := filterJSONL(path, func(rec map[string]interface{}) bool {
+			key, _ := rec["session"].(string)
+			return inSession(key)
+		})
+		if err != nil {
+			return report, fmt.Errorf("purging usage records: %w", err)
+		}
+		report.Usage += n
+	}
+	if err := p.purgeResearch(inSession, report); err != nil {
+		return report, fmt.Errorf("purging research: %w", err)
+	}
+
+	for _, c := range p.Contacts {
+		if c.Name != report.Contact || report.Contact == "" {
+			continue
+		}
+		for _, other := range c.IDs {
+			if !matches(strings.TrimSpace(other)) {
+				report.OtherIDs = append(report.OtherIDs, other)
+			}
+		}
+	}
+	return report, nil
+}
+
+// purgeFacts deletes facts files, then the remembered media they referred
+// to that no remaining facts file refers to.
+func (p *Purger) purgeFacts(paths []string, report *Report) error {
+	mediaRef := regexp.MustCompile(regexp.QuoteMeta(p.Memory.MediaDir()+string(filepath.Separator)) + `[0-9a-f]+(\.thumb)?\.?[A-Za-z0-9]*`)
+	media := make(map[string]bool)
+	for _, path := range paths {
+		data, err := atrest.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, ref := range mediaRef.FindAllString(string(data), -1) {
+			media[ref] = true
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		report.FactFiles = append(report.FactFiles, path)
+	}
+	sort.Strings(report.FactFiles)
+	if len(media) == 0 {
+		return nil
+	}
+
+	for _, dir := range []string{"chats", "contacts"} {
+		files, _ := filepath.Glob(filepath.Join(p.Memory.MemoryDir, dir, "*.md"))
+		for _, path := range files {
+			data, err := atrest.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			for _, ref := range mediaRef.FindAllString(string(data), -1) {
+				delete(media, ref)
+			}
+		}
+	}
+	for path := range media {
+		if err := os.Remove(path); err == nil {
+			report.MediaFiles = append(report.MediaFiles, path)
+		}
+	}
+	sort.Strings(report.MediaFiles)
+	return nil
+}
+
+// purgeUploads deletes the files under uploads/ that the removed messages
+// came with and counts the files left there.
+func (p *Purger) purgeUploads(media []string, report *Report) error {
+	dir := filepath.Join(p.Workspace, "uploads")
+	for _, path := range media {
+		if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			report.Uploads = append(report.Uploads, path)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			report.OtherUploads++
+		}
+		return nil
+	})
+	return err
+}
+
+// purgeBus removes the messages drop accepts from the bus dead letters and,
+// with Journals, from the messages queued in the bus journals.
+func (p *Purger) purgeBus(drop func(msg interface{}) bool, report *Report) (int, error) {
+	dir := filepath.Join(p.Workspace, "bus")
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return 0, nil
+	}
+	removed, err := filterJSONL(filepath.Join(dir, "dead-letter.jsonl"), func(rec map[string]interface{}) bool {
+		return drop(rec["message"])
+	})
+	if err != nil {
+		return removed, err
+	}
+	for _, name := range []string{"inbound.wal", "outbound.wal"} {
+		path := filepath.Join(dir, name)
+		if !p.Journals {
+			report.QueueKept = report.QueueKept || queued(path, drop)
+			continue
+		}
+		// Starts and acks of a dropped message are ignored when the
+		// journal is read
+		n, err := filterJSONL(path, func(rec map[string]interface{}) bool {
+			return rec["op"] == "add" && drop(rec["msg"])
+		})
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// queued reports whether the bus journal at path has a message drop
+// accepts that was not acked yet.
+func queued(path string, drop func(msg interface{}) bool) bool {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	pending := make(map[float64]bool)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		var rec map[string]interface{}
+		if json.Unmarshal(line, &rec) != nil {
+			continue
+		}
+		seq, _ := rec["seq"].(float64)
+		switch rec["op"] {
+		case "add":
+			if drop(rec["msg"]) {
+				pending[seq] = true
+			}
+		case "ack":
+			delete(pending, seq)
+		}
+	}
+	return len(pending) > 0
+}
+
+// purgeResearch deletes the research tasks started from the chats inChat
+// accepts, with their checkpoints and reports.
+func (p *Purger) purgeResearch(inChat func(string) bool, report *Report) error {
+	checkpoints, _ := filepath.Glob(filepath.Join(p.Workspace, "research", "*", "checkpoint.json"))
+	for _, path := range checkpoints {
+		data, err := atrest.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var origin struct {
+			Channel string `json:"originChannel"`
+			ChatID  string `json:"originChatId"`
+		}
+		if json.Unmarshal(data, &origin) != nil || !inChat(origin.Channel+":"+origin.ChatID) {
+			continue
+		}
+		dir := filepath.Dir(path)
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		report.Research = append(report.Research, filepath.Base(dir))
+	}
+	return nil
+}
+
+// purgeActivity removes the ledger entries of messages from the sender:
+// "- <time> message <channel>:<chat> from <sender>".
+func (p *Purger) purgeActivity(matches func(string) bool) (int, error) {
+	files, err := filepath.Glob(filepath.Join(p.Memory.MemoryDir, "ACTIVITY-*.md"))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, path := range files {
+		data, err := atrest.ReadFile(path)
+		if err != nil {
+			return removed, err
+		}
+		lines := strings.Split(string(data), "\n")
+		kept := lines[:0]
+		for _, line := range lines {
+			fields := strings.Fields(line)
+			if len(fields) >= 6 && fields[0] == "-" && fields[2] == memory.ActivityMessage && fields[4] == "from" {
+				channel, _, _ := strings.Cut(fields[3], ":")
+				if matches(channel + ":" + strings.Join(fields[5:], " ")) {
+					removed++
+					continue
+				}
+			}
+			kept = append(kept, line)
+		}
+		if len(kept) < len(lines) {
+			if err := atrest.WriteFile(path, []byte(strings.Join(kept, "\n")), 0644); err != nil {
+				return removed, err
+			}
+		}
+	}
+	return removed, nil
+}
+
+// filterJSONL removes the records drop accepts from a JSON lines file and
+// returns how many it removed.
+func filterJSONL(path string, drop func(map[string]interface{}) bool) (int, error) {
+	data, err := atrest.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var out bytes.Buffer
+	removed := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var rec map[string]interface{}
+		if json.Unmarshal(line, &rec) == nil && drop(rec) {
+			removed++
+			continue
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, atrest.WriteFile(path, out.Bytes(), 0644)
+}
+
+// String formats the report for people.
+func (r *Report) String() string {
+	var sb strings.Builder
+	who := r.Sender
+	if r.Contact != "" {
+		who += fmt.Sprintf(" (contact %s)", r.Contact)
+	}
+	sb.WriteString(fmt.Sprintf("Deletion report for %s, %s\n\n", who, r.Time.Format("2006-01-02 15:04:05 MST")))
+	sb.WriteString(fmt.Sprintf("- Messages removed, with the replies to them: %d\n", r.MessagesRemoved))
+	list := func(label string, items []string) {
+		if len(items) > 0 {
+			sb.WriteString(fmt.Sprintf("- %s (%d): %s\n", label, len(items), strings.Join(items, ", ")))
+		}
+	}
+	list("Sessions deleted", r.SessionsDeleted)
+	list("Sessions edited", r.SessionsEdited)
+	if r.ArchivesChanged > 0 {
+		sb.WriteString(fmt.Sprintf("- Archived session copies edited or deleted: %d\n", r.ArchivesChanged))
+	}
+	list("Memory files deleted", r.FactFiles)
+	list("Remembered media deleted", r.MediaFiles)
+	list("Credentials removed", r.Credentials)
+	list("Uploaded files deleted", r.Uploads)
+	list("Research tasks deleted", r.Research)
+	for _, n := range []struct {
+		label string
+		count int
+	}{
+		{"Feedback records removed", r.Feedback},
+		{"Activity ledger entries removed", r.Activity},
+		{"Workflow log entries removed", r.Workflows},
+		{"Bus messages removed", r.BusMessages},
+		{"Usage records removed", r.Usage},
+	} {
+		if n.count > 0 {
+			sb.WriteString(fmt.Sprintf("- %s: %d\n", n.label, n.count))
+		}
+	}
+
+	var kept []string
+	if len(r.OtherIDs) > 0 {
+		kept = append(kept, fmt.Sprintf("%s also uses %s; purge those IDs too if they are the same person.", r.Contact, strings.Join(r.OtherIDs, ", ")))
+	}
+	if r.Contact != "" {
+		kept = append(kept, fmt.Sprintf("The contact %s is listed in the config file; remove the entry by hand.", r.Contact))
+	}
+	if len(r.Unattributed) > 0 {
+		kept = append(kept, fmt.Sprintf("These sessions have messages saved before senders were recorded, which may include theirs: %s.", strings.Join(r.Unattributed, ", ")))
+	}
+	if r.OtherUploads > 0 {
+		kept = append(kept, fmt.Sprintf("%d other files in uploads/. Files received before messages recorded their attachments can't be attributed and may include theirs.", r.OtherUploads))
+	}
+	if r.QueueKept {
+		kept = append(kept, "Messages still queued on the bus, which are removed from its journal once handled. Purge again after they are, or with the gateway stopped.")
+	}
+	if len(kept) > 0 {
+		sb.WriteString("\nNot removed:\n")
+		for _, k := range kept {
+			sb.WriteString("- " + k + "\n")
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
@@ -0,0 +1,261 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/config"
+)
+
+// authorizationTTL is how long a user has to finish authorizing in the browser.
+const authorizationTTL = 15 * time.Minute
+
+// oauthProvider holds the endpoints of a well-known provider.
+type oauthProvider struct {
+	authURL  string
+	tokenURL string
+	params   url.Values // Extra authorize parameters
+}
+
+var oauthProviders = map[string]oauthProvider{
+	"google": {
+		authURL:  "https://accounts.google.com/o/oauth2/v2/auth",
+		tokenURL: "https://oauth2.googleapis.com/token",
+		// Google only returns a refresh token for offline access, and only
+		// on first consent unless asked again
+		params: url.Values{"access_type": {"offline"}, "prompt": {"consent"}},
+	},
+	"github": {
+		authURL:  "https://github.com/login/oauth/authorize",
+		tokenURL: "https://github.com/login/oauth/access_token",
+	},
+	"microsoft": {
+		authURL:  "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+		tokenURL: "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+	},
+}
+
+// Authorization is a user connecting an account: who it is for and the
+// chat that asked, which is told when it completes.
+type Authorization struct {
+	Identity string
+	Service  string
+	Channel  string
+	ChatID   string
+	expires  time.Time
+	verifier string // PKCE code verifier
+}
+
+// OAuth connects users' accounts for the credential services configured
+// with oauth, storing the tokens in Store and renewing them when they
+// expire. RedirectURL is the gateway's callback; without it users cannot
+// connect accounts, but stored tokens are still renewed.
+type OAuth struct {
+	Services    map[string]config.CredentialConfig
+	Store       *Store
+	RedirectURL string
+	client      *http.Client
+
+	mu      sync.Mutex
+	pending map[string]Authorization // state -> authorization
+}
+
+// NewOAuth creates a new OAuth.
+func NewOAuth(services map[string]config.CredentialConfig, store *Store) *OAuth {
+	return &OAuth{
+		Services: services,
+		Store:    store,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		pending:  make(map[string]Authorization),
+	}
+}
+
+// endpoints returns the authorize and token URLs of service, explicit
+// URLs taking precedence over the provider's.
+func (o *OAuth) endpoints(service string) (*config.OAuthConfig, oauthProvider, error) {
+	c := o.Services[service].OAuth
+	if c == nil {
+		return nil, oauthProvider{}, fmt.Errorf("%s does not support connecting an account", service)
+	}
+	p := oauthProviders[strings.ToLower(c.Provider)]
+	if c.AuthURL != "" {
+		p.authURL = c.AuthURL
+	}
+	if c.TokenURL != "" {
+		p.tokenURL = c.TokenURL
+	}
+	if p.authURL == "" || p.tokenURL == "" {
+		return nil, oauthProvider{}, fmt.Errorf("%s has an unknown provider %q and no authUrl and tokenUrl", service, c.Provider)
+	}
+	return c, p, nil
+}
+
+// AuthURL starts an authorization and returns the page the user opens to
+// grant access.
+func (o *OAuth) AuthURL(a Authorization) (string, error) {
+	if o.RedirectURL == "" {
+		return "", fmt.Errorf("connecting accounts needs the gateway running with gateway.publicUrl set")
+	}
+	c, p, err := o.endpoints(a.Service)
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	state := hex.EncodeToString(b)
+	// PKCE: only this process, which keeps the verifier, can redeem the
+	// code, even if the redirect is seen by someone else
+	v := make([]byte, 32)
+	if _, err := rand.Read(v); err != nil {
+		return "", err
+	}
+	a.verifier = base64.RawURLEncoding.EncodeToString(v)
+	challenge := sha256.Sum256([]byte(a.verifier))
+
+	o.mu.Lock()
+	now := time.Now()
+	for s, pa := range o.pending {
+		if now.After(pa.expires) {
+			delete(o.pending, s)
+		}
+	}
+	a.expires = now.Add(authorizationTTL)
+	o.pending[state] = a
+	o.mu.Unlock()
+
+	q := url.Values{}
+	for k, v := range p.params {
+		q[k] = v
+	}
+	q.Set("response_type", "code")
+	q.Set("client_id", c.ClientID)
+	q.Set("redirect_uri", o.RedirectURL)
+	q.Set("state", state)
+	q.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	q.Set("code_challenge_method", "S256")
+	if len(c.Scopes) > 0 {
+		q.Set("scope", strings.Join(c.Scopes, " "))
+	}
+	sep := "?"
+	if strings.Contains(p.authURL, "?") {
+		sep = "&"
+	}
+	return p.authURL + sep + q.Encode(), nil
+}
+
+// Complete exchanges the code the provider redirected back with for
+// tokens and stores them. state identifies the authorization, which is
+// returned so the user can be told.
+func (o *OAuth) Complete(state, code string) (Authorization, error) {
+	a, ok := o.Cancel(state)
+	if !ok {
+		return Authorization{}, fmt.Errorf("unknown or expired authorization, run /connect again")
+	}
+	cred, err := o.requestToken(a.Service, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {o.RedirectURL},
+		"code_verifier": {a.verifier},
+	})
+	if err != nil {
+		return a, err
+	}
+	return a, o.Store.Set(a.Identity, a.Service, cred)
+}
+
+// Cancel ends the authorization state without storing anything, for when
+// the user refused access, and returns it if it was still pending.
+func (o *OAuth) Cancel(state string) (Authorization, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	a, ok := o.pending[state]
+	delete(o.pending, state)
+	if !ok || time.Now().After(a.expires) {
+		return Authorization{}, false
+	}
+	return a, true
+}
+
+// Refresh renews identity's expired token for service with its refresh
+// token and stores the result.
+func (o *OAuth) Refresh(identity, service string, old Credential) (Credential, error) {
+	if old.RefreshToken == "" {
+		return old, fmt.Errorf("%s token cannot be renewed, run /connect %s again", service, service)
+	}
+	cred, err := o.requestToken(service, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {old.RefreshToken},
+	})
+	if err != nil {
+		return old, err
+	}
+	// Most providers keep the refresh token unless they rotate it
+	if cred.RefreshToken == "" {
+		cred.RefreshToken = old.RefreshToken
+	}
+	return cred, o.Store.Set(identity, service, cred)
+}
+
+// requestToken posts a token request for service.
+func (o *OAuth) requestToken(service string, form url.Values) (Credential, error) {
+	c, p, err := o.endpoints(service)
+	if err != nil {
+		return Credential{}, err
+	}
+	form.Set("client_id", c.ClientID)
+	form.Set("client_secret", c.ClientSecret)
+
+	req, err := http.NewRequest("POST", p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Credential{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// GitHub answers form-encoded unless asked for JSON
+	req.Header.Set("Accept", "application/json")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return Credential{}, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	var tok struct {
+		AccessToken      string `json:"access_token"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return Credential{}, fmt.Errorf("token request failed (%d): %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if tok.Error != "" {
+		if tok.ErrorDescription != "" {
+			return Credential{}, fmt.Errorf("%s: %s", tok.Error, tok.ErrorDescription)
+		}
+		return Credential{}, fmt.Errorf("%s", tok.Error)
+	}
+	if tok.AccessToken == "" {
+		return Credential{}, fmt.Errorf("token request failed (%d): no access token", resp.StatusCode)
+	}
+	cred := Credential{Token: tok.AccessToken, RefreshToken: tok.RefreshToken}
+	if tok.ExpiresIn > 0 {
+		cred.Expiry = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	}
+	return cred, nil
+}
@@ -0,0 +1,159 @@
+package secrets
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/config"
+)
+
+// oauthTest is an OAuth for the service "demo" against a provider that,
+// like a real one, issues a token only for the code "good" with the
+// verifier of a challenge it was shown on its authorize page.
+type oauthTest struct {
+	*OAuth
+	challenges map[string]bool
+}
+
+func newOAuthTest(t *testing.T) *oauthTest {
+	t.Helper()
+	ot := &oauthTest{challenges: make(map[string]bool)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		w.Header().Set("Content-Type", "application/json")
+		if r.Form.Get("code") != "good" || !ot.challenges[base64.RawURLEncoding.EncodeToString(sum[:])] {
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "token-1", "expires_in": 3600})
+	}))
+	t.Cleanup(server.Close)
+
+	ot.OAuth = NewOAuth(map[string]config.CredentialConfig{
+		"demo": {Env: "DEMO_TOKEN", OAuth: &config.OAuthConfig{
+			ClientID: "client", AuthURL: server.URL + "/authorize", TokenURL: server.URL + "/token",
+		}},
+	}, NewStore(t.TempDir()))
+	ot.RedirectURL = "https://bot.example.com/oauth/callback"
+	return ot
+}
+
+// start begins an authorization for telegram:42 and returns its state,
+// showing the provider the challenge as the user's browser would.
+func (ot *oauthTest) start(t *testing.T) string {
+	t.Helper()
+	link, err := ot.AuthURL(Authorization{Identity: "telegram:42", Service: "demo", Channel: "telegram", ChatID: "42"})
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("authorize link without an S256 challenge: %s", link)
+	}
+	ot.challenges[q.Get("code_challenge")] = true
+	return q.Get("state")
+}
+
+func TestOAuthComplete(t *testing.T) {
+	tests := []struct {
+		name string
+		// prepare returns the state and code of the callback
+		prepare func(t *testing.T, ot *oauthTest) (string, string)
+		err     string // in the error, "" when it connects
+		stored  bool   // whether a credential is stored in the end
+	}{
+		{"connects", func(t *testing.T, ot *oauthTest) (string, string) {
+			return ot.start(t), "good"
+		}, "", true},
+		{"unknown state", func(t *testing.T, ot *oauthTest) (string, string) {
+			ot.start(t)
+			return "forged", "good"
+		}, "unknown or expired", false},
+		{"state used twice", func(t *testing.T, ot *oauthTest) (string, string) {
+			state := ot.start(t)
+			if _, err := ot.Complete(state, "good"); err != nil {
+				t.Fatalf("first Complete: %v", err)
+			}
+			return state, "good"
+		}, "unknown or expired", true},
+		{"state after a failed exchange", func(t *testing.T, ot *oauthTest) (string, string) {
+			state := ot.start(t)
+			ot.Complete(state, "bad")
+			return state, "good"
+		}, "unknown or expired", false},
+		{"cancelled state", func(t *testing.T, ot *oauthTest) (string, string) {
+			state := ot.start(t)
+			if _, ok := ot.Cancel(state); !ok {
+				t.Fatal("Cancel of a pending authorization returned false")
+			}
+			return state, "good"
+		}, "unknown or expired", false},
+		{"expired state", func(t *testing.T, ot *oauthTest) (string, string) {
+			state := ot.start(t)
+			a := ot.pending[state]
+			a.expires = time.Now().Add(-time.Second)
+			ot.pending[state] = a
+			return state, "good"
+		}, "unknown or expired", false},
+		{"verifier does not match the challenge", func(t *testing.T, ot *oauthTest) (string, string) {
+			// The code was issued to a browser that was shown another
+			// challenge, so this authorization's verifier cannot redeem it
+			state := ot.start(t)
+			ot.challenges = map[string]bool{"another-challenge": true}
+			return state, "good"
+		}, "invalid_grant", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ot := newOAuthTest(t)
+			state, code := tt.prepare(t, ot)
+			a, err := ot.Complete(state, code)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("Complete = %v, want an error with %q", err, tt.err)
+				}
+				if _, ok, _ := ot.Store.Get("telegram:42", "demo"); ok != tt.stored {
+					t.Errorf("credential stored = %v, want %v", ok, tt.stored)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+			if a.Identity != "telegram:42" || a.ChatID != "42" {
+				t.Errorf("Complete returned %+v, want the authorization of telegram:42", a)
+			}
+			cred, ok, err := ot.Store.Get("telegram:42", "demo")
+			if err != nil || !ok || cred.Token != "token-1" {
+				t.Errorf("stored credential = %+v, %v, %v; want token-1", cred, ok, err)
+			}
+		})
+	}
+}
+
+func TestOAuthStatesAreDistinct(t *testing.T) {
+	ot := newOAuthTest(t)
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		state := ot.start(t)
+		if seen[state] {
+			t.Fatalf("state %s issued twice", state)
+		}
+		seen[state] = true
+	}
+	if len(ot.challenges) != 20 {
+		t.Errorf("%d distinct challenges for 20 authorizations", len(ot.challenges))
+	}
+}
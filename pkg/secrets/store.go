@@ -0,0 +1,161 @@
+// Package secrets keeps tool credentials per user, such as each user's
+// own GitHub token, so tools run for one user never use another's.
+package secrets
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Credential is a user's secret for one service.
+type Credential struct {
+	Token string `json:"token"`
+	// RefreshToken and Expiry are set for OAuth tokens that can be renewed.
+	RefreshToken string    `json:"refreshToken,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// Expired reports whether the credential has an expiry that has passed,
+// allowing a minute for clock skew and the request in flight.
+func (c Credential) Expired() bool {
+	return !c.Expiry.IsZero() && time.Now().Add(time.Minute).After(c.Expiry)
+}
+
+// Store is the credentials file in the workspace, keyed by identity and
+// then service. It is read on every access, so changes made with the CLI
+// apply to a running agent.
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewStore creates a Store for the workspace.
+func NewStore(workspace string) *Store {
+	return &Store{path: filepath.Join(workspace, "secrets", "credentials.json")}
+}
+
+// Identity is who credentials belong to: the contact name when the sender
+// is a known contact, so it covers all their channels, otherwise
+// "channel:senderId".
+func Identity(contact, channel, senderID string) string {
+	if contact != "" {
+		return contact
+	}
+	return channel + ":" + senderID
+}
+
+func (s *Store) load() (map[string]map[string]Credential, error) {
+	data := make(map[string]map[string]Credential)
+	raw, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// save writes the file readable by the owner only, replacing it at once.
+func (s *Store) save(data map[string]map[string]Credential) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Get returns identity's credential for service.
+func (s *Store) Get(identity, service string) (Credential, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.load()
+	if err != nil {
+		return Credential{}, false, err
+	}
+	c, ok := data[identity][service]
+	return c, ok, nil
+}
+
+// Set stores identity's credential for service.
+func (s *Store) Set(identity, service string, c Credential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.load()
+	if err != nil {
+		return err
+	}
+	if data[identity] == nil {
+		data[identity] = make(map[string]Credential)
+	}
+	c.UpdatedAt = time.Now()
+	data[identity][service] = c
+	return s.save(data)
+}
+
+// Remove deletes identity's credential for service and reports whether
+// there was one.
+func (s *Store) Remove(identity, service string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.load()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := data[identity][service]; !ok {
+		return false, nil
+	}
+	delete(data[identity], service)
+	if len(data[identity]) == 0 {
+		delete(data, identity)
+	}
+	return true, s.save(data)
+}
+
+// Services returns the services identity has credentials for, sorted.
+func (s *Store) Services(identity string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var services []string
+	for service := range data[identity] {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// Identities returns everyone with stored credentials, sorted.
+func (s *Store) Identities() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for id := range data {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
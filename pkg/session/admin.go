@@ -0,0 +1,183 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+)
+
+// Info summarizes a stored session for administration.
+type Info struct {
+	Key       string    `json:"key"`
+	Path      string    `json:"path"`
+	SizeBytes int64     `json:"size_bytes"`
+	Messages  int       `json:"messages"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// List returns all stored sessions, most recently active first.
+func (m *Manager) List() ([]Info, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries, err := ioutil.ReadDir(m.SessionsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var infos []Info
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jsonl") {
+			continue
+		}
+		path := filepath.Join(m.SessionsDir, entry.Name())
+		info := Info{
+			Key:       strings.Replace(strings.TrimSuffix(entry.Name(), ".jsonl"), "_", ":", 1),
+			Path:      path,
+			SizeBytes: entry.Size(),
+			UpdatedAt: entry.ModTime(),
+		}
+		readInfo(path, &info)
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].UpdatedAt.After(infos[j].UpdatedAt)
+	})
+	return infos, nil
+}
+
+// readInfo fills key, timestamps and message count from a session file.
+func readInfo(path string, info *Info) {
+	data, err := atrest.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var meta struct {
+			Type      string `json:"_type"`
+			Key       string `json:"key"`
+			CreatedAt string `json:"created_at"`
+			UpdatedAt string `json:"updated_at"`
+		}
+		if json.Unmarshal(line, &meta) == nil && meta.Type == "metadata" {
+			if meta.Key != "" {
+				info.Key = meta.Key
+			}
+			if t, err := time.Parse(time.RFC3339, meta.CreatedAt); err == nil {
+				info.CreatedAt = t
+			}
+			if t, err := time.Parse(time.RFC3339, meta.UpdatedAt); err == nil {
+				info.UpdatedAt = t
+			}
+			continue
+		}
+		info.Messages++
+	}
+}
+
+// Archive moves a session file into sessions/archive with a timestamp suffix
+// and drops it from the cache. It returns the archive path.
+func (m *Manager) Archive(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.archive(key)
+}
+
+func (m *Manager) archive(key string) (string, error) {
+	path := m.getSessionPath(key)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+
+	archiveDir := filepath.Join(m.SessionsDir, "archive")
+	if err := os.MkdirAll(archiveDir, 0755); err != nil {
+		return "", err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), ".jsonl")
+	stamp := time.Now().Format(archiveTimeFormat)
+	archivePath := filepath.Join(archiveDir, fmt.Sprintf("%s.%s.jsonl", name, stamp))
+	// Archives made within the same second get a counter
+	for n := 2; ; n++ {
+		if _, err := os.Stat(archivePath); os.IsNotExist(err) {
+			break
+		}
+		archivePath = filepath.Join(archiveDir, fmt.Sprintf("%s.%s-%d.jsonl", name, stamp, n))
+	}
+	if err := os.Rename(path, archivePath); err != nil {
+		return "", err
+	}
+
+	delete(m.cache, key)
+	if m.ArchiveRetention > 0 {
+		if _, err := m.pruneArchives(m.ArchiveRetention); err != nil {
+			log.Printf("Failed to prune session archives: %v", err)
+		}
+	}
+	return archivePath, nil
+}
+
+// Export loads the given sessions (all sessions if keys is empty).
+func (m *Manager) Export(keys []string) ([]*Session, error) {
+	if len(keys) == 0 {
+		infos, err := m.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			keys = append(keys, info.Key)
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Cached sessions may be in use by a turn, so they are copied
+	var sessions []*Session
+	for _, key := range keys {
+		if s, ok := m.cache[key]; ok {
+			sessions = append(sessions, s.snapshot())
+			continue
+		}
+		s := m.load(key)
+		if s == nil {
+			return nil, fmt.Errorf("session not found: %s", key)
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// FilterIdle returns the sessions with no activity for at least idle.
+func FilterIdle(infos []Info, idle time.Duration) []Info {
+	cutoff := time.Now().Add(-idle)
+	var out []Info
+	for _, info := range infos {
+		if info.UpdatedAt.Before(cutoff) {
+			out = append(out, info)
+		}
+	}
+	return out
+}
@@ -0,0 +1,132 @@
+package session
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// archiveTimeFormat is the timestamp in archive file names.
+const archiveTimeFormat = "20060102-150405"
+
+// ArchiveInfo describes an archived copy of a session.
+type ArchiveInfo struct {
+	Path       string    `json:"path"`
+	ArchivedAt time.Time `json:"archived_at"`
+	Messages   int       `json:"messages"`
+	seq        int       // Orders archives made within the same second
+}
+
+// parseArchiveName splits an archive file name, "<session>.<time>[-n].jsonl",
+// into the session file name, the time it was archived and n.
+func parseArchiveName(name string) (string, time.Time, int, bool) {
+	name = strings.TrimSuffix(name, ".jsonl")
+	i := strings.LastIndex(name, ".")
+	if i < 0 {
+		return "", time.Time{}, 0, false
+	}
+	stamp, seq := name[i+1:], 1
+	if len(stamp) > len(archiveTimeFormat) {
+		n, err := strconv.Atoi(strings.TrimPrefix(stamp[len(archiveTimeFormat):], "-"))
+		if err != nil {
+			return "", time.Time{}, 0, false
+		}
+		stamp, seq = stamp[:len(archiveTimeFormat)], n
+	}
+	t, err := time.ParseInLocation(archiveTimeFormat, stamp, time.Local)
+	if err != nil {
+		return "", time.Time{}, 0, false
+	}
+	return name[:i], t, seq, true
+}
+
+// Archives returns the archived copies of a session, newest first.
+func (m *Manager) Archives(key string) ([]ArchiveInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	archiveDir := filepath.Join(m.SessionsDir, "archive")
+	entries, err := ioutil.ReadDir(archiveDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	want := strings.TrimSuffix(filepath.Base(m.getSessionPath(key)), ".jsonl")
+	var archives []ArchiveInfo
+	for _, entry := range entries {
+		name, archivedAt, seq, ok := parseArchiveName(entry.Name())
+		if !ok || name != want {
+			continue
+		}
+		path := filepath.Join(archiveDir, entry.Name())
+		var info Info
+		readInfo(path, &info)
+		archives = append(archives, ArchiveInfo{Path: path, ArchivedAt: archivedAt, Messages: info.Messages, seq: seq})
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		if archives[i].ArchivedAt.Equal(archives[j].ArchivedAt) {
+			return archives[i].seq > archives[j].seq
+		}
+		return archives[i].ArchivedAt.After(archives[j].ArchivedAt)
+	})
+	return archives, nil
+}
+
+// Restore makes an archived copy the session's history again. The current
+// history, if any, is archived first, so restoring can be undone too.
+func (m *Manager) Restore(key, archivePath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := os.Stat(archivePath); err != nil {
+		return err
+	}
+	if _, err := m.archive(key); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to archive the current session: %w", err)
+	}
+	if err := os.Rename(archivePath, m.getSessionPath(key)); err != nil {
+		return err
+	}
+	delete(m.cache, key)
+	return nil
+}
+
+// PruneArchives deletes archived sessions older than maxAge and returns
+// how many were deleted.
+func (m *Manager) PruneArchives(maxAge time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pruneArchives(maxAge)
+}
+
+func (m *Manager) pruneArchives(maxAge time.Duration) (int, error) {
+	archiveDir := filepath.Join(m.SessionsDir, "archive")
+	entries, err := ioutil.ReadDir(archiveDir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	pruned := 0
+	for _, entry := range entries {
+		_, archivedAt, _, ok := parseArchiveName(entry.Name())
+		if !ok || !archivedAt.Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(archiveDir, entry.Name())); err != nil {
+			return pruned, err
+		}
+		pruned++
+	}
+	return pruned, nil
+}
@@ -2,12 +2,20 @@ package session
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+	"github.com/HKUDS/nanobot-go/pkg/migrate"
 )
 
 // Session represents a conversation session.
@@ -17,6 +25,13 @@ type Session struct {
 	CreatedAt time.Time                `json:"created_at"`
 	UpdatedAt time.Time                `json:"updated_at"`
 	Metadata  map[string]interface{}   `json:"metadata"`
+	// frozen is set when the file on disk could not be migrated to this
+	// build's version, e.g. because a newer build wrote it; it is then
+	// never overwritten.
+	frozen bool
+	// mu guards Messages and Metadata against readers outside the turn,
+	// such as Export, while a turn changes them.
+	mu sync.Mutex
 }
 
 // NewSession creates a new session.
@@ -40,13 +55,62 @@ func (s *Session) AddMessage(role string, content string, extra map[string]inter
 	for k, v := range extra {
 		msg[k] = v
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.Messages = append(s.Messages, msg)
 	s.UpdatedAt = time.Now()
 }
 
+// SetMeta sets the metadata key to value.
+func (s *Session) SetMeta(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Metadata[key] = value
+}
+
+// DeleteMeta removes the metadata key.
+func (s *Session) DeleteMeta(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.Metadata, key)
+}
+
+// snapshot returns a copy of the session that later changes do not affect.
+func (s *Session) snapshot() *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := &Session{
+		Key:       s.Key,
+		Messages:  make([]map[string]interface{}, len(s.Messages)),
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+		Metadata:  make(map[string]interface{}, len(s.Metadata)),
+		frozen:    s.frozen,
+	}
+	for i, msg := range s.Messages {
+		m := make(map[string]interface{}, len(msg))
+		for k, v := range msg {
+			m[k] = v
+		}
+		c.Messages[i] = m
+	}
+	for k, v := range s.Metadata {
+		c.Metadata[k] = v
+	}
+	return c
+}
+
 // GetHistory returns message history for LLM context.
 func (s *Session) GetHistory(maxMessages int) []map[string]interface{} {
+	return s.GetHistorySince(0, maxMessages)
+}
+
+// GetHistorySince is GetHistory limited to the messages from index start on.
+func (s *Session) GetHistorySince(start, maxMessages int) []map[string]interface{} {
 	msgs := s.Messages
+	if start > 0 && start <= len(msgs) {
+		msgs = msgs[start:]
+	}
 	if len(msgs) > maxMessages {
 		msgs = msgs[len(msgs)-maxMessages:]
 	}
@@ -67,14 +131,17 @@ func (s *Session) GetHistory(maxMessages int) []map[string]interface{} {
 type Manager struct {
 	Workspace   string
 	SessionsDir string
-	cache       map[string]*Session
-	mu          sync.RWMutex
+	// ArchiveRetention is how long archived sessions are kept; 0 keeps them.
+	ArchiveRetention time.Duration
+	cache            map[string]*Session
+	mu               sync.RWMutex
 }
 
 // NewManager creates a new session manager.
 func NewManager(workspace string) *Manager {
 	sessionsDir := filepath.Join(workspace, "sessions")
 	os.MkdirAll(sessionsDir, 0755)
+	atrest.Protect(sessionsDir)
 
 	return &Manager{
 		Workspace:   workspace,
@@ -109,16 +176,26 @@ func (m *Manager) GetOrCreate(key string) *Session {
 
 func (m *Manager) load(key string) *Session {
 	path := m.getSessionPath(key)
-	file, err := os.Open(path)
+	data, err := atrest.ReadFile(path)
+	if errors.Is(err, atrest.ErrNoKey) || errors.Is(err, atrest.ErrWrongKey) {
+		// Move it aside so the new session does not overwrite the history
+		log.Printf("Session %s: %v; moved it to %s.unreadable", key, err, path)
+		os.Rename(path, path+".unreadable")
+		return nil
+	}
 	if err != nil {
 		return nil
 	}
-	defer file.Close()
 
 	session := NewSession(key)
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var metaLine map[string]interface{}
+	var badLines []int
+	lineNo := 0
 
 	for scanner.Scan() {
+		lineNo++
 		line := scanner.Text()
 		if line == "" {
 			continue
@@ -126,10 +203,12 @@ func (m *Manager) load(key string) *Session {
 
 		var data map[string]interface{}
 		if err := json.Unmarshal([]byte(line), &data); err != nil {
+			badLines = append(badLines, lineNo)
 			continue
 		}
 
 		if typeVal, ok := data["_type"]; ok && typeVal == "metadata" {
+			metaLine = data
 			if meta, ok := data["metadata"].(map[string]interface{}); ok {
 				session.Metadata = meta
 			}
@@ -141,27 +220,81 @@ func (m *Manager) load(key string) *Session {
 			session.Messages = append(session.Messages, data)
 		}
 	}
+	truncated := scanner.Err()
+	if truncated != nil {
+		log.Printf("Session %s: stopped reading at a bad line: %v", key, truncated)
+	}
+	if len(badLines) > 0 || truncated != nil {
+		recoverCorrupted(key, path, data, badLines, len(session.Messages))
+	}
+
+	if version := migrate.Version(metaLine, "version"); version != fileVersion {
+		doc := map[string]interface{}{"metadata": metaLine, "messages": session.Messages}
+		if _, err := fileFormat.Upgrade(doc, version); err != nil {
+			// Use what parses, but keep the file as it is
+			log.Printf("Session %s will not be saved: %v", key, err)
+			session.frozen = true
+		} else {
+			if err := migrate.Backup(path, version); err != nil {
+				log.Printf("Session %s: failed to back up before migrating, changes will not be saved: %v", key, err)
+				session.frozen = true
+			}
+			if meta, ok := metaLine["metadata"].(map[string]interface{}); ok {
+				session.Metadata = meta
+			}
+			session.Messages, _ = doc["messages"].([]map[string]interface{})
+		}
+	}
 
 	return session
 }
 
+// recoverCorrupted keeps a copy of a session file with lines that could not
+// be read, since the next save writes only the messages that were, and logs
+// what was lost.
+func recoverCorrupted(key, path string, data []byte, badLines []int, kept int) {
+	backup := fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405"))
+	if err := atrest.WriteFile(backup, data, 0644); err != nil {
+		log.Printf("Session %s: failed to keep a copy of the corrupted file: %v", key, err)
+		backup = "(not kept)"
+	}
+	lines := make([]string, 0, len(badLines))
+	for i, n := range badLines {
+		if i == 10 {
+			lines = append(lines, "...")
+			break
+		}
+		lines = append(lines, strconv.Itoa(n))
+	}
+	skipped := "the rest of the file after an overlong line"
+	if len(badLines) > 0 {
+		skipped = fmt.Sprintf("%d corrupted lines (%s)", len(badLines), strings.Join(lines, ", "))
+	}
+	log.Printf("Session %s: skipped %s, recovered %d messages; the original file is kept at %s", key, skipped, kept, backup)
+}
+
 // Save saves a session to disk.
 func (m *Manager) Save(session *Session) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.save(session)
+}
 
+func (m *Manager) save(session *Session) error {
 	m.cache[session.Key] = session
+	if session.frozen {
+		return nil
+	}
 	path := m.getSessionPath(session.Key)
 
-	file, err := os.Create(path)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+	var file bytes.Buffer
+	session.mu.Lock()
 
 	// Write metadata
 	metaLine := map[string]interface{}{
 		"_type":      "metadata",
+		"version":    fileVersion,
+		"key":        session.Key,
 		"created_at": session.CreatedAt.Format(time.RFC3339),
 		"updated_at": session.UpdatedAt.Format(time.RFC3339),
 		"metadata":   session.Metadata,
@@ -175,8 +308,9 @@ func (m *Manager) Save(session *Session) error {
 		msgJSON, _ := json.Marshal(msg)
 		file.WriteString(string(msgJSON) + "\n")
 	}
+	session.mu.Unlock()
 
-	return nil
+	return atrest.WriteFileAtomic(path, file.Bytes(), 0644)
 }
 
 // Clear clears a session.
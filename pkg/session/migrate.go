@@ -0,0 +1,17 @@
+package session
+
+import (
+	"github.com/HKUDS/nanobot-go/pkg/migrate"
+)
+
+// fileVersion is the version of session files this build writes, stored
+// in the metadata line.
+const fileVersion = 1
+
+// fileFormat upgrades session files from older versions. Steps get the
+// metadata line as "metadata" and the message lines as "messages", a
+// []map[string]interface{}.
+var fileFormat = &migrate.Format{
+	Name:    "session file",
+	Current: fileVersion,
+}
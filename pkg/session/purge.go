@@ -0,0 +1,223 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+)
+
+// SenderKey is the field of a user message recording who sent it, as
+// "channel:senderId". Messages saved before senders were recorded have none.
+const SenderKey = "sender"
+
+// MediaKey is the field of a user message listing the files it came with,
+// such as uploads, so they can be purged with it.
+const MediaKey = "media"
+
+// derivedMetadata are the metadata keys of the agent's summary of older
+// messages, which may quote purged ones and counts messages by index.
+var derivedMetadata = []string{"summary", "summarized_up_to"}
+
+// PurgeResult describes what PurgeSender removed.
+type PurgeResult struct {
+	Deleted  []string // Sessions deleted because no one else's messages were left
+	Edited   []string // Sessions messages were removed from
+	Archives int      // Archived copies edited or deleted
+	Messages int      // Messages removed, replies included
+	Media    []string // Files the removed user messages came with
+	// Unattributed lists sessions that have user messages of unknown
+	// sender, which were kept.
+	Unattributed []string
+}
+
+// PurgeSender removes the user messages whose sender matches accepts, with
+// the replies to them, from every session and archived copy. In sessions
+// owned accepts, private chats with the sender, messages of unknown sender
+// are removed too. Sessions and copies left without user messages are
+// deleted.
+func (m *Manager) PurgeSender(matches func(sender string) bool, owned func(key string) bool) (PurgeResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result PurgeResult
+	unattributed := make(map[string]bool)
+	media := make(map[string]bool)
+	for _, dir := range []string{m.SessionsDir, filepath.Join(m.SessionsDir, "archive")} {
+		entries, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		archived := dir != m.SessionsDir
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".jsonl") {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			key := strings.Replace(strings.TrimSuffix(entry.Name(), ".jsonl"), "_", ":", 1)
+			if archived {
+				name, _, _, ok := parseArchiveName(entry.Name())
+				if !ok {
+					continue
+				}
+				key = strings.Replace(name, "_", ":", 1)
+			}
+			var info Info
+			readInfo(path, &info)
+			if info.Key != "" {
+				key = info.Key
+			}
+
+			dropped, deleted, unknown, err := purgeFile(path, matches, owned(key))
+			if err != nil {
+				return result, err
+			}
+			if unknown {
+				unattributed[key] = true
+			}
+			if len(dropped) == 0 {
+				continue
+			}
+			for _, msg := range dropped {
+				for _, path := range messageMedia(msg) {
+					media[path] = true
+				}
+			}
+			result.Messages += len(dropped)
+			if archived {
+				result.Archives++
+				continue
+			}
+			if cached, ok := m.cache[key]; ok {
+				// A turn in progress holds the cached session and saves it
+				// when done, so it must not bring the messages back
+				cached.Messages, _, _ = purgeMessages(cached.Messages, matches, owned(key))
+				for _, k := range derivedMetadata {
+					delete(cached.Metadata, k)
+				}
+			}
+			if deleted {
+				delete(m.cache, key)
+				result.Deleted = append(result.Deleted, key)
+			} else {
+				result.Edited = append(result.Edited, key)
+			}
+		}
+	}
+	for key := range unattributed {
+		result.Unattributed = append(result.Unattributed, key)
+	}
+	for path := range media {
+		result.Media = append(result.Media, path)
+	}
+	sort.Strings(result.Media)
+	return result, nil
+}
+
+// messageMedia returns the files listed under MediaKey in a message.
+func messageMedia(msg map[string]interface{}) []string {
+	switch media := msg[MediaKey].(type) {
+	case []string:
+		return media
+	case []interface{}:
+		paths := make([]string, 0, len(media))
+		for _, v := range media {
+			if path, ok := v.(string); ok && path != "" {
+				paths = append(paths, path)
+			}
+		}
+		return paths
+	}
+	return nil
+}
+
+// purgeFile removes a sender's messages from a session file, deleting it if
+// no user messages are left. It returns the messages removed and whether
+// the file was deleted or has user messages of unknown sender.
+func purgeFile(path string, matches func(string) bool, owned bool) ([]map[string]interface{}, bool, bool, error) {
+	data, err := atrest.ReadFile(path)
+	if err != nil {
+		return nil, false, false, err
+	}
+	var meta map[string]interface{}
+	var messages []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var msg map[string]interface{}
+		if len(line) == 0 || json.Unmarshal(line, &msg) != nil {
+			continue
+		}
+		if msg["_type"] == "metadata" {
+			meta = msg
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, false, false, err
+	}
+
+	kept, removed, unknown := purgeMessages(messages, matches, owned)
+	if len(removed) == 0 {
+		return nil, false, unknown, nil
+	}
+	hasUser := false
+	for _, msg := range kept {
+		hasUser = hasUser || msg["role"] == "user"
+	}
+	if !hasUser {
+		return removed, true, false, os.Remove(path)
+	}
+
+	var out bytes.Buffer
+	if meta != nil {
+		if sessionMeta, ok := meta["metadata"].(map[string]interface{}); ok {
+			for _, k := range derivedMetadata {
+				delete(sessionMeta, k)
+			}
+		}
+		line, _ := json.Marshal(meta)
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	for _, msg := range kept {
+		line, _ := json.Marshal(msg)
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	return removed, false, unknown, atrest.WriteFileAtomic(path, out.Bytes(), 0644)
+}
+
+// purgeMessages drops the user messages of a sender and everything up to
+// the next user message: the replies and tool results they led to. It
+// returns the messages kept, those dropped and whether a kept user message
+// has no sender.
+func purgeMessages(messages []map[string]interface{}, matches func(string) bool, owned bool) ([]map[string]interface{}, []map[string]interface{}, bool) {
+	kept := messages[:0:0]
+	var removed []map[string]interface{}
+	unknown, dropping := false, false
+	for _, msg := range messages {
+		if msg["role"] == "user" {
+			sender, _ := msg[SenderKey].(string)
+			dropping = sender != "" && matches(sender) || sender == "" && owned
+			unknown = unknown || sender == "" && !owned
+		}
+		if dropping {
+			removed = append(removed, msg)
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	return kept, removed, unknown
+}
@@ -147,8 +147,9 @@ func (l *Loader) LoadSkillsForContext(names []string) string {
 	return strings.Join(parts, "\n\n---\n\n")
 }
 
-// BuildSkillsSummary builds the summary for progressive loading.
-func (l *Loader) BuildSkillsSummary() string {
+// BuildSkillsSummary builds the summary for progressive loading. If only
+// names any skills, the others are left out.
+func (l *Loader) BuildSkillsSummary(only ...string) string {
 	skills, err := l.ListSkills()
 	if err != nil {
 		return ""
@@ -157,6 +158,9 @@ func (l *Loader) BuildSkillsSummary() string {
 	var sb strings.Builder
 
 	for _, s := range skills {
+		if !selected(s.Name, only) {
+			continue
+		}
 		status := "Available"
 		if !s.Available {
 			status = fmt.Sprintf("Unavailable (Missing: %s)", strings.Join(s.Missing, ", "))
@@ -171,12 +175,13 @@ func (l *Loader) BuildSkillsSummary() string {
 	return sb.String()
 }
 
-// GetAlwaysSkills returns names of skills that should always be loaded.
-func (l *Loader) GetAlwaysSkills() []string {
+// GetAlwaysSkills returns names of skills that should always be loaded,
+// among only if it names any.
+func (l *Loader) GetAlwaysSkills(only ...string) []string {
 	skills, _ := l.ListSkills()
 	var names []string
 	for _, s := range skills {
-		if s.Always && s.Available {
+		if s.Always && s.Available && selected(s.Name, only) {
 			names = append(names, s.Name)
 		}
 	}
@@ -185,6 +190,19 @@ func (l *Loader) GetAlwaysSkills() []string {
 
 // Helper functions
 
+// selected reports whether a skill is among only, or only is empty.
+func selected(name string, only []string) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, n := range only {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
 func parseFrontmatter(content []byte) (Metadata, error) {
 	var meta Metadata
 	s := string(content)
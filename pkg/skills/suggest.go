@@ -0,0 +1,383 @@
+package skills
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+)
+
+// maxSuggestedRequests is how many of the requests that started a recurring
+// workflow are quoted in its draft.
+const maxSuggestedRequests = 3
+
+// Step is one tool run of a workflow.
+type Step struct {
+	Tool   string `json:"tool"`
+	Detail string `json:"detail,omitempty"` // The main argument, e.g. the command
+}
+
+// key identifies what a step does, leaving out details that change between
+// runs: the program run by exec, the host fetched from.
+func (s Step) key() string {
+	detail := strings.TrimSpace(s.Detail)
+	if detail == "" {
+		return s.Tool
+	}
+	if u, err := url.Parse(detail); err == nil && u.Host != "" {
+		return s.Tool + " " + u.Host
+	}
+	if s.Tool == "exec" {
+		return s.Tool + " " + filepath.Base(strings.Fields(detail)[0])
+	}
+	return s.Tool
+}
+
+// Workflow is the sequence of tool runs of one turn.
+type Workflow struct {
+	Time    time.Time `json:"time"`
+	Channel string    `json:"channel"`
+	ChatID  string    `json:"chat_id"`
+	Request string    `json:"request"` // The message that started the turn
+	Steps   []Step    `json:"steps"`
+}
+
+// pattern returns the keys of the workflow's steps with repeats in a row
+// collapsed, or nil if fewer than two are left.
+func (w Workflow) pattern() []string {
+	var keys []string
+	for _, s := range w.Steps {
+		if k := s.key(); len(keys) == 0 || keys[len(keys)-1] != k {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) < 2 {
+		return nil
+	}
+	return keys
+}
+
+// Suggestion is a skill drafted for a recurring workflow.
+type Suggestion struct {
+	Name    string // The draft's directory under skills/drafts
+	Path    string // Its SKILL.md
+	Pattern string // The steps, as "exec git → web_fetch api.github.com"
+	Days    int    // How many days the workflow ran on
+}
+
+// Suggester notices the tool sequences the agent keeps repeating and drafts
+// skills for them. Turns' workflows are kept in memory/workflows.jsonl for
+// WindowDays; a pattern run on MinDays different days is suggested. Drafts go
+// to skills/drafts/<name>/SKILL.md, where the loader does not see them until
+// they are accepted.
+type Suggester struct {
+	SkillsDir  string
+	MemoryDir  string
+	MinDays    int
+	WindowDays int
+
+	mu sync.Mutex
+}
+
+// NewSuggester creates a Suggester for the workspace.
+func NewSuggester(workspace string, minDays, windowDays int) *Suggester {
+	if minDays < 2 {
+		minDays = 2
+	}
+	if windowDays <= 0 {
+		windowDays = 30
+	}
+	return &Suggester{
+		SkillsDir:  filepath.Join(workspace, "skills"),
+		MemoryDir:  filepath.Join(workspace, "memory"),
+		MinDays:    minDays,
+		WindowDays: windowDays,
+	}
+}
+
+func (s *Suggester) logPath() string {
+	return filepath.Join(s.MemoryDir, "workflows.jsonl")
+}
+
+// suggestedPath lists the patterns already suggested, so none is offered
+// twice, whether its draft was accepted or discarded.
+func (s *Suggester) suggestedPath() string {
+	return filepath.Join(s.MemoryDir, "skill-suggestions.json")
+}
+
+func (s *Suggester) draftsDir() string {
+	return filepath.Join(s.SkillsDir, "drafts")
+}
+
+// Record adds a turn's workflow to the log. If its pattern has now run on
+// MinDays different days and was never suggested, a skill is drafted for it
+// and returned.
+func (s *Suggester) Record(w Workflow) (*Suggestion, error) {
+	pattern := w.pattern()
+	if pattern == nil {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	workflows, err := s.readLog()
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().AddDate(0, 0, -s.WindowDays)
+	kept := workflows[:0]
+	for _, old := range workflows {
+		if old.Time.After(cutoff) {
+			kept = append(kept, old)
+		}
+	}
+	pruned := len(kept) < len(workflows)
+	workflows = append(kept, w)
+	if pruned {
+		err = s.writeLog(workflows)
+	} else {
+		err = s.appendLog(w)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	label := strings.Join(pattern, " → ")
+	suggested := s.readSuggested()
+	if suggested[label] {
+		return nil, nil
+	}
+	var runs []Workflow
+	days := make(map[string]bool)
+	for _, old := range workflows {
+		if strings.Join(old.pattern(), " → ") == label {
+			runs = append(runs, old)
+			days[old.Time.Format("2006-01-02")] = true
+		}
+	}
+	if len(days) < s.MinDays {
+		return nil, nil
+	}
+
+	name := s.draftName(pattern)
+	path := filepath.Join(s.draftsDir(), name, "SKILL.md")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, []byte(draftSkill(name, label, runs, len(days))), 0644); err != nil {
+		return nil, err
+	}
+	suggested[label] = true
+	if err := s.writeSuggested(suggested); err != nil {
+		return nil, err
+	}
+	return &Suggestion{Name: name, Path: path, Pattern: label, Days: len(days)}, nil
+}
+
+func (s *Suggester) readLog() ([]Workflow, error) {
+	data, err := atrest.ReadFile(s.logPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var workflows []Workflow
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var w Workflow
+		if err := json.Unmarshal(scanner.Bytes(), &w); err == nil {
+			workflows = append(workflows, w)
+		}
+	}
+	return workflows, scanner.Err()
+}
+
+func (s *Suggester) appendLog(w Workflow) error {
+	line, err := json.Marshal(w)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.MemoryDir, 0755); err != nil {
+		return err
+	}
+	return atrest.AppendFile(s.logPath(), append(line, '\n'), 0644)
+}
+
+func (s *Suggester) writeLog(workflows []Workflow) error {
+	var sb strings.Builder
+	for _, w := range workflows {
+		line, err := json.Marshal(w)
+		if err != nil {
+			return err
+		}
+		sb.Write(line)
+		sb.WriteByte('\n')
+	}
+	return atrest.WriteFile(s.logPath(), []byte(sb.String()), 0644)
+}
+
+func (s *Suggester) readSuggested() map[string]bool {
+	suggested := make(map[string]bool)
+	data, err := atrest.ReadFile(s.suggestedPath())
+	if err != nil {
+		return suggested
+	}
+	var patterns []string
+	json.Unmarshal(data, &patterns)
+	for _, p := range patterns {
+		suggested[p] = true
+	}
+	return suggested
+}
+
+func (s *Suggester) writeSuggested(suggested map[string]bool) error {
+	patterns := make([]string, 0, len(suggested))
+	for p := range suggested {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+	data, err := json.MarshalIndent(patterns, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atrest.WriteFile(s.suggestedPath(), data, 0644)
+}
+
+// draftName names a draft after what its steps do, e.g. "git-api-github-com",
+// unused by any skill or draft.
+func (s *Suggester) draftName(pattern []string) string {
+	var parts []string
+	for _, key := range pattern {
+		fields := strings.Fields(key)
+		word := strings.ToLower(fields[len(fields)-1])
+		word = strings.Trim(strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+				return r
+			}
+			return '-'
+		}, word), "-")
+		if word != "" && (len(parts) == 0 || parts[len(parts)-1] != word) {
+			parts = append(parts, word)
+		}
+	}
+	base := strings.Join(parts, "-")
+	if len(base) > 40 {
+		base = strings.TrimRight(base[:40], "-")
+	}
+	if base == "" {
+		base = "workflow"
+	}
+	name := base
+	for i := 2; ; i++ {
+		_, errSkill := os.Stat(filepath.Join(s.SkillsDir, name))
+		_, errDraft := os.Stat(filepath.Join(s.draftsDir(), name))
+		if os.IsNotExist(errSkill) && os.IsNotExist(errDraft) {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// draftSkill writes the SKILL.md of a draft from the runs of its workflow,
+// oldest first: the requests that led to it and the steps of the last run.
+func draftSkill(name, pattern string, runs []Workflow, days int) string {
+	var sb strings.Builder
+	sb.WriteString("---\n")
+	sb.WriteString(fmt.Sprintf("name: %s\n", name))
+	sb.WriteString(fmt.Sprintf("description: %q\n", "Repeats this workflow: "+pattern+". Edit this to say when to use the skill."))
+	sb.WriteString("---\n\n")
+	sb.WriteString(fmt.Sprintf("# %s\n\n", name))
+	sb.WriteString(fmt.Sprintf("Drafted from a sequence of tool runs repeated on %d different days.\n\n", days))
+
+	sb.WriteString("## When to use\n\n")
+	start := len(runs) - maxSuggestedRequests
+	if start < 0 {
+		start = 0
+	}
+	for _, w := range runs[start:] {
+		if request := strings.Join(strings.Fields(w.Request), " "); request != "" {
+			sb.WriteString(fmt.Sprintf("- %q (%s)\n", request, w.Time.Format("2006-01-02")))
+		}
+	}
+
+	sb.WriteString("\n## Steps\n\n")
+	for i, step := range runs[len(runs)-1].Steps {
+		if step.Detail != "" {
+			sb.WriteString(fmt.Sprintf("%d. `%s`: %s\n", i+1, step.Tool, step.Detail))
+		} else {
+			sb.WriteString(fmt.Sprintf("%d. `%s`\n", i+1, step.Tool))
+		}
+	}
+	return sb.String()
+}
+
+// Drafts returns the names of the drafted skills awaiting review.
+func (s *Suggester) Drafts() ([]string, error) {
+	entries, err := ioutil.ReadDir(s.draftsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// draftDir returns the directory of an existing draft.
+func (s *Suggester) draftDir(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid skill name %q", name)
+	}
+	dir := filepath.Join(s.draftsDir(), name)
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("no draft named %q", name)
+	}
+	return dir, nil
+}
+
+// Accept moves a draft into skills/, where the loader picks it up.
+func (s *Suggester) Accept(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir, err := s.draftDir(name)
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(s.SkillsDir, name)
+	if _, err := os.Stat(target); err == nil {
+		return "", fmt.Errorf("a skill named %q already exists", name)
+	}
+	if err := os.Rename(dir, target); err != nil {
+		return "", err
+	}
+	return filepath.Join(target, "SKILL.md"), nil
+}
+
+// Discard deletes a draft. Its workflow is not suggested again.
+func (s *Suggester) Discard(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir, err := s.draftDir(name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
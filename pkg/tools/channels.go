@@ -0,0 +1,98 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/channels"
+)
+
+// ChannelsStatusTool reports the health of the chat channels.
+type ChannelsStatusTool struct {
+	BaseTool
+	Monitor *channels.Monitor
+}
+
+// NewChannelsStatusTool creates a new ChannelsStatusTool.
+func NewChannelsStatusTool(monitor *channels.Monitor) *ChannelsStatusTool {
+	return &ChannelsStatusTool{Monitor: monitor}
+}
+
+func (t *ChannelsStatusTool) Name() string {
+	return "channels_status"
+}
+
+func (t *ChannelsStatusTool) Description() string {
+	return "Report which chat channels (telegram, feishu, dingtalk) are enabled and connected, when they last received and sent messages, and their recent errors. Use this to answer questions about connectivity instead of guessing."
+}
+
+func (t *ChannelsStatusTool) ToSchema() map[string]interface{} {
+	return GenerateSchema(t)
+}
+
+func (t *ChannelsStatusTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"channel": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: only report this channel",
+			},
+		},
+		"required": []string{},
+	}
+}
+
+func (t *ChannelsStatusTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	name, _ := args["channel"].(string)
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	var lines []string
+	for _, s := range t.Monitor.Snapshot() {
+		if name != "" && s.Name != name {
+			continue
+		}
+		lines = append(lines, FormatChannelStatus(s, time.Now()))
+	}
+	if len(lines) == 0 {
+		if name != "" {
+			return fmt.Sprintf("Channel %s is not configured.", name), nil
+		}
+		return "No channels are configured.", nil
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// FormatChannelStatus renders a channel status as a short human-readable block.
+func FormatChannelStatus(s channels.ChannelStatus, now time.Time) string {
+	var sb strings.Builder
+	switch {
+	case !s.Enabled:
+		sb.WriteString(fmt.Sprintf("%s: disabled", s.Name))
+	case s.Connected:
+		sb.WriteString(fmt.Sprintf("%s: connected (since %s)", s.Name, s.StartedAt.Format("2006-01-02 15:04:05")))
+	default:
+		sb.WriteString(fmt.Sprintf("%s: not connected", s.Name))
+	}
+	if !s.Enabled {
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("\n  last inbound: %s\n  last outbound: %s", since(s.LastInbound, now), since(s.LastOutbound, now)))
+	if s.ErrorCount > 0 {
+		sb.WriteString(fmt.Sprintf("\n  errors: %d total, recent:", s.ErrorCount))
+		for _, e := range s.RecentErrors {
+			sb.WriteString(fmt.Sprintf("\n    - %s %s", e.Time.Format("2006-01-02 15:04:05"), e.Message))
+		}
+	}
+	return sb.String()
+}
+
+func since(t, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Format("2006-01-02 15:04:05"), now.Sub(t).Round(time.Second))
+}
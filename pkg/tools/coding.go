@@ -0,0 +1,632 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// skipDirs are not searched by grep and glob.
+var skipDirs = map[string]bool{
+	".git": true, "node_modules": true, "vendor": true, "dist": true, "build": true,
+	"target": true, ".venv": true, "venv": true, "__pycache__": true, ".idea": true,
+}
+
+const (
+	maxGrepFileBytes = 1024 * 1024
+	maxGrepLineChars = 200
+	maxToolOutput    = 8000
+)
+
+// repoPath resolves a path given relative to repo and rejects paths outside it.
+func repoPath(repo, rel string) (string, error) {
+	path := filepath.Join(repo, rel)
+	if filepath.IsAbs(rel) {
+		path = filepath.Clean(rel)
+	}
+	r, err := filepath.Rel(repo, path)
+	if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside the repository", rel)
+	}
+	return path, nil
+}
+
+// walkRepo calls fn with the slash-separated path, relative to repo, of
+// every regular file under dir, skipping dependency and VCS directories.
+func walkRepo(repo, dir string, fn func(rel, path string) bool) error {
+	stop := fmt.Errorf("stop")
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if path != dir && skipDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, _ := filepath.Rel(repo, path)
+		if !fn(filepath.ToSlash(rel), path) {
+			return stop
+		}
+		return nil
+	})
+	if err == stop {
+		return nil
+	}
+	return err
+}
+
+// tailOutput keeps the end of long command output, where errors usually are.
+func tailOutput(out string) string {
+	if len(out) <= maxToolOutput {
+		return out
+	}
+	return fmt.Sprintf("... (%d bytes omitted)\n%s", len(out)-maxToolOutput, out[len(out)-maxToolOutput:])
+}
+
+// GrepTool searches file contents in the coding repository.
+type GrepTool struct {
+	BaseTool
+	Repo string
+}
+
+func (t *GrepTool) Name() string {
+	return "grep"
+}
+
+func (t *GrepTool) Description() string {
+	return "Search file contents in the repository with a regular expression (Go RE2 syntax). Returns path:line: text matches."
+}
+
+func (t *GrepTool) ToSchema() map[string]interface{} {
+	return GenerateSchema(t)
+}
+
+func (t *GrepTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"pattern": map[string]interface{}{
+				"type":        "string",
+				"description": "Regular expression to search for",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: directory or file to search, relative to the repository root",
+			},
+			"include": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: only search files matching this glob, e.g. **/*.go",
+			},
+			"ignore_case": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Match case-insensitively",
+			},
+			"max_results": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum matches to return (default 100)",
+			},
+		},
+		"required": []string{"pattern"},
+	}
+}
+
+func (t *GrepTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	pattern, ok := args["pattern"].(string)
+	if !ok || pattern == "" {
+		return "", fmt.Errorf("pattern must be a non-empty string")
+	}
+	if ignoreCase, _ := args["ignore_case"].(bool); ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Sprintf("Error: invalid pattern: %v", err), nil
+	}
+	var include *regexp.Regexp
+	if glob, _ := args["include"].(string); glob != "" {
+		include = globRegexp(glob)
+	}
+	maxResults := 100
+	if n, ok := args["max_results"].(float64); ok && n > 0 {
+		maxResults = int(n)
+	}
+	rel, _ := args["path"].(string)
+	dir, err := repoPath(t.Repo, rel)
+	if err != nil {
+		return "Error: " + err.Error(), nil
+	}
+
+	var matches []string
+	truncated := false
+	walkRepo(t.Repo, dir, func(rel, path string) bool {
+		if include != nil && !include.MatchString(rel) && !include.MatchString(filepath.Base(rel)) {
+			return true
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.Size() > maxGrepFileBytes {
+			return true
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return true
+		}
+		head := data
+		if len(head) > 8000 {
+			head = head[:8000]
+		}
+		if bytes.IndexByte(head, 0) >= 0 {
+			return true // binary
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64*1024), maxGrepFileBytes)
+		for n := 1; scanner.Scan(); n++ {
+			line := scanner.Text()
+			if !re.MatchString(line) {
+				continue
+			}
+			if r := []rune(strings.TrimSpace(line)); len(r) > maxGrepLineChars {
+				line = string(r[:maxGrepLineChars]) + "…"
+			} else {
+				line = string(r)
+			}
+			matches = append(matches, fmt.Sprintf("%s:%d: %s", rel, n, line))
+			if len(matches) >= maxResults {
+				truncated = true
+				return false
+			}
+		}
+		return true
+	})
+
+	if len(matches) == 0 {
+		return "No matches found.", nil
+	}
+	out := strings.Join(matches, "\n")
+	if truncated {
+		out += fmt.Sprintf("\n... (stopped at %d matches; narrow the pattern or path)", maxResults)
+	}
+	return out, nil
+}
+
+// GlobTool lists repository files matching a glob pattern.
+type GlobTool struct {
+	BaseTool
+	Repo string
+}
+
+func (t *GlobTool) Name() string {
+	return "glob"
+}
+
+func (t *GlobTool) Description() string {
+	return "Find files in the repository by path pattern, e.g. **/*.go or cmd/*/main.go. ** matches any number of directories."
+}
+
+func (t *GlobTool) ToSchema() map[string]interface{} {
+	return GenerateSchema(t)
+}
+
+func (t *GlobTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"pattern": map[string]interface{}{
+				"type":        "string",
+				"description": "Glob pattern relative to the repository root",
+			},
+		},
+		"required": []string{"pattern"},
+	}
+}
+
+func (t *GlobTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	pattern, ok := args["pattern"].(string)
+	if !ok || pattern == "" {
+		return "", fmt.Errorf("pattern must be a non-empty string")
+	}
+	re := globRegexp(strings.TrimPrefix(pattern, "./"))
+
+	const maxFiles = 200
+	var files []string
+	total := 0
+	walkRepo(t.Repo, t.Repo, func(rel, path string) bool {
+		if re.MatchString(rel) {
+			total++
+			if len(files) < maxFiles {
+				files = append(files, rel)
+			}
+		}
+		return true
+	})
+	if total == 0 {
+		return "No files matched.", nil
+	}
+	sort.Strings(files)
+	out := strings.Join(files, "\n")
+	if total > len(files) {
+		out += fmt.Sprintf("\n... and %d more", total-len(files))
+	}
+	return out, nil
+}
+
+// globRegexp converts a slash-separated glob with ** support to a regexp.
+func globRegexp(glob string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
+
+// ApplyPatchTool applies a unified diff to the repository with git apply.
+type ApplyPatchTool struct {
+	BaseTool
+	Repo string
+}
+
+func (t *ApplyPatchTool) Name() string {
+	return "apply_patch"
+}
+
+func (t *ApplyPatchTool) Description() string {
+	return "Apply a unified diff (as produced by git diff) to the repository. The patch is checked first and applied only if every hunk fits."
+}
+
+func (t *ApplyPatchTool) ToSchema() map[string]interface{} {
+	return GenerateSchema(t)
+}
+
+func (t *ApplyPatchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"patch": map[string]interface{}{
+				"type":        "string",
+				"description": "Unified diff with a/ and b/ path prefixes, relative to the repository root",
+			},
+		},
+		"required": []string{"patch"},
+	}
+}
+
+func (t *ApplyPatchTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	patch, ok := args["patch"].(string)
+	if !ok || strings.TrimSpace(patch) == "" {
+		return "", fmt.Errorf("patch must be a non-empty string")
+	}
+	if !strings.HasSuffix(patch, "\n") {
+		patch += "\n"
+	}
+
+	run := func(extra ...string) (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "git", append([]string{"apply", "--whitespace=nowarn", "--recount"}, extra...)...)
+		cmd.Dir = t.Repo
+		cmd.Stdin = strings.NewReader(patch)
+		out, err := cmd.CombinedOutput()
+		return strings.TrimSpace(string(out)), err
+	}
+	if out, err := run("--check"); err != nil {
+		return fmt.Sprintf("Error: patch does not apply, nothing was changed:\n%s", out), nil
+	}
+	if out, err := run(); err != nil {
+		return fmt.Sprintf("Error: git apply failed:\n%s", out), nil
+	}
+	stat, _ := run("--stat")
+	return "Patch applied.\n" + stat, nil
+}
+
+// gitReadCommands are the git subcommands allowed in read-only mode;
+// gitWriteCommands are allowed in addition otherwise. Commands that touch
+// remotes or rewrite history are never allowed.
+var (
+	gitReadCommands  = []string{"status", "diff", "log", "show", "blame", "branch", "ls-files", "grep"}
+	gitWriteCommands = []string{"add", "commit", "checkout", "switch", "restore", "stash", "mv", "rm"}
+)
+
+// gitFlags are the options each subcommand accepts. A trailing "=" marks
+// an option that takes a value, either attached or as the next argument; a
+// trailing "?" one whose value is optional and can only be attached.
+// Anything else, such as --no-index, --output, --ext-diff, -O or -c, is
+// rejected, since it could read or write files outside the repository or
+// run commands. git branch only lists branches in read-only mode;
+// gitBranchWriteFlags are accepted otherwise.
+var gitFlags = parseGitFlags(map[string]string{
+	"status": "-s --short -b --branch --porcelain? --long -u? --untracked-files? --ignored? -v --verbose --ahead-behind --no-ahead-behind --show-stash -z",
+	"diff": "-p --patch -U= --unified= --stat? --numstat --shortstat --dirstat? --summary --name-only --name-status --raw -z " +
+		"--cached --staged --merge-base -R -M? --find-renames? -w --ignore-all-space -b --ignore-space-change --ignore-blank-lines " +
+		"--diff-filter= --word-diff? --color? --no-color --minimal --patience --histogram --check --abbrev? --exit-code --quiet --relative?",
+	"log": "-n= --max-count= --skip= --oneline --graph --decorate? --format= --pretty? --abbrev-commit --abbrev? --date= " +
+		"--author= --committer= --since= --until= --after= --before= --grep= -i --regexp-ignore-case --all-match --invert-grep " +
+		"-S= -G= -L= --follow --reverse --no-merges --merges --first-parent --all --branches? --tags? --topo-order --date-order " +
+		"-p --patch -U= --unified= --stat? --numstat --shortstat --name-only --name-status -M? -w --diff-filter= --word-diff? --color? --no-color",
+	"show": "-p --patch -s --no-patch -U= --unified= --stat? --numstat --shortstat --name-only --name-status --oneline --format= --pretty? " +
+		"--abbrev-commit --date= --decorate? -w --word-diff? --color? --no-color",
+	"blame": "-L= -w -M? -C? -e --show-email -s -l -t -n --show-number -f --show-name --root --porcelain --line-porcelain --date=",
+	"branch": "-a --all -r --remotes -v -vv --verbose --list --show-current --contains? --no-contains? --merged? --no-merged? " +
+		"--sort= --format= --color? --no-color",
+	"ls-files": "--cached -d --deleted -m --modified -o --others -i --ignored -s --stage -u --unmerged -k --killed " +
+		"--exclude-standard -z -t -v --full-name --error-unmatch --abbrev?",
+	"grep": "-e= -i --ignore-case -w --word-regexp -v --invert-match -n --line-number -l --files-with-matches -L --files-without-match " +
+		"--count -E --extended-regexp -F --fixed-strings -P --perl-regexp -h -H --full-name -o --only-matching -q --quiet " +
+		"-A= -B= -C= --context= --after-context= --before-context= --max-depth= --cached --untracked --heading --break " +
+		"-W --function-context -p --show-function -I --column -z --all-match --and --or --not",
+	"add":      "-A --all -u --update -n --dry-run -v --verbose -f --force -N --intent-to-add",
+	"commit":   "-m= --message= -a --all --amend --no-edit --allow-empty -q --quiet -s --signoff --author= --date=",
+	"checkout": "-b= -B= --detach -t --track --no-track --ours --theirs -f --force -q --quiet",
+	"switch":   "--create= --force-create= --detach -d -t --track --no-track --discard-changes -f --force --guess --no-guess -q --quiet",
+	"restore":  "-s= --source= -S --staged -W --worktree --ours --theirs -q --quiet",
+	"stash":    "-m= --message= -u --include-untracked -k --keep-index --no-keep-index --index -q --quiet --stat",
+	"mv":       "-f --force -k -n --dry-run -v --verbose",
+	"rm":       "--cached -r -f --force -n --dry-run -q --quiet",
+})
+
+var gitBranchWriteFlags = parseGitFlags(map[string]string{
+	"branch": "-d --delete -D -m --move -M -f --force -t --track --no-track",
+})["branch"]
+
+// gitSafeFlags are added to the subcommands that show diffs, so diff
+// drivers and converters set in the repository's config never run.
+var gitSafeFlags = map[string][]string{
+	"diff": {"--no-ext-diff", "--no-textconv"},
+	"log":  {"--no-ext-diff", "--no-textconv"},
+	"show": {"--no-ext-diff", "--no-textconv"},
+}
+
+// gitFlag is how an option takes its value.
+type gitFlag int
+
+const (
+	gitBool gitFlag = iota
+	gitValue
+	gitOptional
+)
+
+func parseGitFlags(specs map[string]string) map[string]map[string]gitFlag {
+	all := make(map[string]map[string]gitFlag)
+	for sub, spec := range specs {
+		flags := make(map[string]gitFlag)
+		for _, f := range strings.Fields(spec) {
+			switch {
+			case strings.HasSuffix(f, "="):
+				flags[strings.TrimSuffix(f, "=")] = gitValue
+			case strings.HasSuffix(f, "?"):
+				flags[strings.TrimSuffix(f, "?")] = gitOptional
+			default:
+				flags[f] = gitBool
+			}
+		}
+		all[sub] = flags
+	}
+	return all
+}
+
+// GitTool runs a restricted set of git commands in the repository.
+type GitTool struct {
+	BaseTool
+	Repo     string
+	ReadOnly bool
+}
+
+func (t *GitTool) allowed() []string {
+	if t.ReadOnly {
+		return gitReadCommands
+	}
+	return append(append([]string{}, gitReadCommands...), gitWriteCommands...)
+}
+
+func (t *GitTool) Name() string {
+	return "git"
+}
+
+func (t *GitTool) Description() string {
+	return fmt.Sprintf("Run git in the repository. Allowed subcommands: %s.", strings.Join(t.allowed(), ", "))
+}
+
+func (t *GitTool) ToSchema() map[string]interface{} {
+	return GenerateSchema(t)
+}
+
+func (t *GitTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"subcommand": map[string]interface{}{
+				"type":        "string",
+				"description": "git subcommand",
+				"enum":        t.allowed(),
+			},
+			"args": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Arguments, one per item, e.g. [\"-m\", \"Fix parser\"]",
+			},
+		},
+		"required": []string{"subcommand"},
+	}
+}
+
+func (t *GitTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	sub, _ := args["subcommand"].(string)
+	ok := false
+	for _, c := range t.allowed() {
+		ok = ok || c == sub
+	}
+	if !ok {
+		return fmt.Sprintf("Error: git %s is not allowed. Allowed: %s", sub, strings.Join(t.allowed(), ", ")), nil
+	}
+	var list []string
+	if items, ok := args["args"].([]interface{}); ok {
+		for _, a := range items {
+			list = append(list, fmt.Sprint(a))
+		}
+	}
+	gitArgs, err := t.checkArgs(sub, list)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", gitArgs...)
+	cmd.Dir = t.Repo
+	killOnCancel(cmd)
+	out, err := cmd.CombinedOutput()
+	result := tailOutput(string(out))
+	if err != nil {
+		return fmt.Sprintf("%s\nExit: %v", result, err), nil
+	}
+	if strings.TrimSpace(result) == "" {
+		return "(no output)", nil
+	}
+	return result, nil
+}
+
+// checkArgs returns the git command line for sub and its arguments, or an
+// error naming the first argument that is not allowed: an option not in
+// gitFlags, or a path outside the repository.
+func (t *GitTool) checkArgs(sub string, args []string) ([]string, error) {
+	flags := gitFlags[sub]
+	if sub == "branch" && !t.ReadOnly {
+		merged := make(map[string]gitFlag)
+		for _, set := range []map[string]gitFlag{flags, gitBranchWriteFlags} {
+			for name, kind := range set {
+				merged[name] = kind
+			}
+		}
+		flags = merged
+	}
+	out := append([]string{"--no-pager", sub}, gitSafeFlags[sub]...)
+	paths, pattern := false, sub == "grep"
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		out = append(out, a)
+		switch {
+		case paths || a == "-" || !strings.HasPrefix(a, "-"):
+			if sub == "branch" && t.ReadOnly {
+				return nil, fmt.Errorf("only listing branches is allowed in read-only mode")
+			}
+			if pattern {
+				// The first operand of git grep is the pattern
+				pattern = false
+				continue
+			}
+			if err := checkGitPath(a); err != nil {
+				return nil, err
+			}
+		case a == "--":
+			paths = true
+		default:
+			kind, value, err := gitOption(flags, a)
+			if err != nil {
+				return nil, fmt.Errorf("git %s: %v", sub, err)
+			}
+			if kind == gitValue && !value {
+				if i+1 == len(args) {
+					return nil, fmt.Errorf("git %s: %s needs a value", sub, a)
+				}
+				i++
+				out = append(out, args[i])
+			}
+			if sub == "grep" && (a == "-e" || strings.HasPrefix(a, "-e")) {
+				pattern = false
+			}
+		}
+	}
+	return out, nil
+}
+
+// gitOption looks up an option, given as --name, --name=value, -x, -xvalue
+// or grouped short flags such as -sb. It reports whether the value was
+// attached.
+func gitOption(flags map[string]gitFlag, a string) (gitFlag, bool, error) {
+	if strings.HasPrefix(a, "--") {
+		name, _, attached := strings.Cut(a, "=")
+		kind, ok := flags[name]
+		if !ok || attached && kind == gitBool {
+			return 0, false, fmt.Errorf("option %s is not allowed", name)
+		}
+		return kind, attached, nil
+	}
+	if kind, ok := flags[a]; ok {
+		return kind, false, nil
+	}
+	// -n5, -U3 or -M50%: a short option with its value attached
+	if kind, ok := flags[a[:2]]; ok && kind != gitBool {
+		return kind, true, nil
+	}
+	// -sb: grouped short flags without values
+	for _, c := range a[1:] {
+		if kind, ok := flags["-"+string(c)]; !ok || kind != gitBool {
+			return 0, false, fmt.Errorf("option %s is not allowed", a)
+		}
+	}
+	return gitBool, false, nil
+}
+
+// checkGitPath rejects a path argument that leads outside the repository.
+// Revisions such as main..feature pass, as they clean to themselves.
+func checkGitPath(a string) error {
+	clean := filepath.Clean(a)
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("path %s is outside the repository", a)
+	}
+	return nil
+}
+
+// ListRepoFiles returns up to max files of a repository, relative and
+// sorted, and the total count. Tracked files are listed with git when the
+// repository is a git work tree; otherwise the directory is walked.
+func ListRepoFiles(repo string, max int) ([]string, int) {
+	var all []string
+	cmd := exec.Command("git", "ls-files", "--cached", "--others", "--exclude-standard")
+	cmd.Dir = repo
+	if out, err := cmd.Output(); err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			if line != "" {
+				all = append(all, line)
+			}
+		}
+	} else {
+		walkRepo(repo, repo, func(rel, path string) bool {
+			all = append(all, rel)
+			return true
+		})
+	}
+	sort.Strings(all)
+	if max > 0 && len(all) > max {
+		return all[:max], len(all)
+	}
+	return all, len(all)
+}
@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGitCheckArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		readOnly bool
+		sub      string
+		args     []string
+		want     []string // the command line after "--no-pager", if allowed
+		err      string   // in the error, if not
+	}{
+		{name: "status", readOnly: true, sub: "status", args: []string{"-sb"}, want: []string{"status", "-sb"}},
+		{name: "log with a value", readOnly: true, sub: "log", args: []string{"-n", "5", "--oneline"},
+			want: []string{"log", "--no-ext-diff", "--no-textconv", "-n", "5", "--oneline"}},
+		{name: "attached values", readOnly: true, sub: "log", args: []string{"-n5", "--format=%h %s", "main..feature"},
+			want: []string{"log", "--no-ext-diff", "--no-textconv", "-n5", "--format=%h %s", "main..feature"}},
+		{name: "diff of a path", readOnly: true, sub: "diff", args: []string{"--stat", "HEAD~1", "--", "pkg/tools"},
+			want: []string{"diff", "--no-ext-diff", "--no-textconv", "--stat", "HEAD~1", "--", "pkg/tools"}},
+		{name: "grep pattern may look like a path", readOnly: true, sub: "grep", args: []string{"-n", "../"},
+			want: []string{"grep", "-n", "../"}},
+		{name: "grep -e then a path", readOnly: true, sub: "grep", args: []string{"-e", "TODO", "pkg"},
+			want: []string{"grep", "-e", "TODO", "pkg"}},
+		{name: "list branches", readOnly: true, sub: "branch", args: []string{"-a", "-v"}, want: []string{"branch", "-a", "-v"}},
+		{name: "delete a branch", sub: "branch", args: []string{"-d", "old"}, want: []string{"branch", "-d", "old"}},
+		{name: "commit", sub: "commit", args: []string{"-m", "Fix the parser"}, want: []string{"commit", "-m", "Fix the parser"}},
+
+		{name: "grep runs a pager command", readOnly: true, sub: "grep", args: []string{"-Osh -c id", "x"}, err: "not allowed"},
+		{name: "grep open files in pager", readOnly: true, sub: "grep", args: []string{"--open-files-in-pager=sh", "x"}, err: "not allowed"},
+		{name: "grep pattern from a file", readOnly: true, sub: "grep", args: []string{"-f", "/etc/passwd"}, err: "not allowed"},
+		{name: "diff outside the repository", readOnly: true, sub: "diff", args: []string{"--no-index", "/etc/passwd", "/dev/null"}, err: "not allowed"},
+		{name: "diff driver", readOnly: true, sub: "diff", args: []string{"--ext-diff"}, err: "not allowed"},
+		{name: "textconv", readOnly: true, sub: "show", args: []string{"--textconv", "HEAD"}, err: "not allowed"},
+		{name: "output file", readOnly: true, sub: "log", args: []string{"--output=/tmp/x"}, err: "not allowed"},
+		{name: "value on a flag without one", readOnly: true, sub: "log", args: []string{"--oneline=x"}, err: "not allowed"},
+		{name: "grouped flag with a value", readOnly: true, sub: "grep", args: []string{"-iO", "x"}, err: "not allowed"},
+		{name: "config override", readOnly: true, sub: "log", args: []string{"-c", "core.pager=sh"}, err: "not allowed"},
+		{name: "missing value", readOnly: true, sub: "log", args: []string{"-n"}, err: "needs a value"},
+		{name: "absolute path", readOnly: true, sub: "log", args: []string{"--", "/etc"}, err: "outside the repository"},
+		{name: "parent path", readOnly: true, sub: "blame", args: []string{"../secret.txt"}, err: "outside the repository"},
+		{name: "parent path after --", readOnly: true, sub: "grep", args: []string{"-e", "x", "--", "sub/../../x"}, err: "outside the repository"},
+		{name: "read-only branch create", readOnly: true, sub: "branch", args: []string{"new"}, err: "read-only"},
+		{name: "read-only branch delete", readOnly: true, sub: "branch", args: []string{"-D", "main"}, err: "not allowed"},
+		{name: "commit message from a file", sub: "commit", args: []string{"-F", "/etc/passwd"}, err: "not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &GitTool{ReadOnly: tt.readOnly}
+			got, err := g.checkArgs(tt.sub, tt.args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("checkArgs(%q, %q) = %q, %v; want an error with %q", tt.sub, tt.args, got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("checkArgs(%q, %q): %v", tt.sub, tt.args, err)
+			}
+			want := append([]string{"--no-pager"}, tt.want...)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("checkArgs(%q, %q) = %q, want %q", tt.sub, tt.args, got, want)
+			}
+		})
+	}
+}
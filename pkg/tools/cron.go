@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -14,6 +15,8 @@ type CronTool struct {
 	Service *cron.Service
 	Channel string
 	ChatID  string
+	// ReadOnly allows listing jobs but not adding or removing them.
+	ReadOnly bool
 }
 
 // NewCronTool creates a new CronTool.
@@ -34,7 +37,10 @@ func (t *CronTool) Name() string {
 }
 
 func (t *CronTool) Description() string {
-	return "Schedule reminders and recurring tasks. Actions: add, list, remove."
+	return "Schedule reminders and recurring tasks. Actions: add, list, remove. " +
+		"Use kind 'message' for plain reminders that need no thinking (delivered as-is, no LLM call), " +
+		"'agent_turn' when the task needs you to act at run time, 'shell' to run a command and send its output, " +
+		"or 'webhook' to POST to a URL."
 }
 
 func (t *CronTool) ToSchema() map[string]interface{} {
@@ -50,9 +56,22 @@ func (t *CronTool) Parameters() map[string]interface{} {
 				"enum":        []string{"add", "list", "remove"},
 				"description": "Action to perform",
 			},
+			"kind": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"agent_turn", "message", "shell", "webhook"},
+				"description": "What the job does when it fires (for add, default agent_turn)",
+			},
 			"message": map[string]interface{}{
 				"type":        "string",
-				"description": "Reminder message (for add)",
+				"description": "Reminder message or task instruction (for add)",
+			},
+			"command": map[string]interface{}{
+				"type":        "string",
+				"description": "Shell command (for kind=shell)",
+			},
+			"url": map[string]interface{}{
+				"type":        "string",
+				"description": "URL to POST to (for kind=webhook)",
 			},
 			"every_seconds": map[string]interface{}{
 				"type":        "integer",
@@ -75,7 +94,7 @@ func (t *CronTool) Parameters() map[string]interface{} {
 	}
 }
 
-func (t *CronTool) Execute(args map[string]interface{}) (string, error) {
+func (t *CronTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	action, ok := args["action"].(string)
 	if !ok {
 		return "", fmt.Errorf("action must be a string")
@@ -87,9 +106,23 @@ func (t *CronTool) Execute(args map[string]interface{}) (string, error) {
 	cronExpr, _ := args["cron_expr"].(string)
 	jobID, _ := args["job_id"].(string)
 
+	if t.ReadOnly && (action == "add" || action == "remove") {
+		return "Error: scheduled jobs cannot be added or removed in read-only mode", nil
+	}
+
 	switch action {
 	case "add":
-		return t.addJob(message, int(everySeconds), int(runInSeconds), cronExpr)
+		kind, _ := args["kind"].(string)
+		command, _ := args["command"].(string)
+		url, _ := args["url"].(string)
+		payload := cron.CronPayload{
+			Kind:    kind,
+			Message: message,
+			Deliver: true,
+			Command: command,
+			URL:     url,
+		}
+		return t.addJob(payload, int(everySeconds), int(runInSeconds), cronExpr)
 	case "list":
 		return t.listJobs()
 	case "remove":
@@ -99,10 +132,7 @@ func (t *CronTool) Execute(args map[string]interface{}) (string, error) {
 	}
 }
 
-func (t *CronTool) addJob(message string, everySeconds int, runInSeconds int, cronExpr string) (string, error) {
-	if message == "" {
-		return "Error: message is required for add", nil
-	}
+func (t *CronTool) addJob(payload cron.CronPayload, everySeconds int, runInSeconds int, cronExpr string) (string, error) {
 	if t.Channel == "" || t.ChatID == "" {
 		return "Error: no session context (channel/chat_id)", nil
 	}
@@ -124,13 +154,34 @@ func (t *CronTool) addJob(message string, everySeconds int, runInSeconds int, cr
 		return "Error: either every_seconds, run_in_seconds, or cron_expr is required", nil
 	}
 
-	name := message
+	name := payload.Message
+	switch {
+	case name != "":
+	case payload.Kind == cron.PayloadShell:
+		name = payload.Command
+	case payload.Kind == cron.PayloadWebhook:
+		name = payload.URL
+	}
 	if len(name) > 30 {
 		name = name[:30]
 	}
 
-	job := t.Service.AddJob(name, schedule, message, true, t.Channel, t.ChatID, deleteAfterRun)
-	return fmt.Sprintf("Created job '%s' (id: %s)", job.Name, job.ID), nil
+	payload.Channel = t.Channel
+	payload.To = t.ChatID
+	job, err := t.Service.AddJob(name, schedule, payload, deleteAfterRun)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Created job '%s' (id: %s)", job.Name, job.ID))
+	if runs := cron.NextRuns(job.Schedule, time.Now(), 3); len(runs) > 0 {
+		sb.WriteString("\nNext runs:")
+		for _, r := range runs {
+			sb.WriteString("\n- " + r.Format("2006-01-02 15:04:05 (Mon) MST"))
+		}
+	}
+	return sb.String(), nil
 }
 
 func (t *CronTool) listJobs() (string, error) {
@@ -142,7 +193,20 @@ func (t *CronTool) listJobs() (string, error) {
 	var sb strings.Builder
 	sb.WriteString("Scheduled jobs:\n")
 	for _, j := range jobs {
-		sb.WriteString(fmt.Sprintf("- %s (id: %s, %s)\n", j.Name, j.ID, j.Schedule.Kind))
+		sb.WriteString(fmt.Sprintf("- %s (id: %s): %s", j.Name, j.ID, cron.Describe(j.Schedule)))
+		if j.Payload.Kind != "" && j.Payload.Kind != cron.PayloadAgentTurn {
+			sb.WriteString(fmt.Sprintf(" [%s]", j.Payload.Kind))
+		}
+		switch {
+		case !j.Enabled:
+			sb.WriteString(", disabled")
+		case j.State.NextRunAtMs > 0:
+			sb.WriteString(", next run " + time.UnixMilli(j.State.NextRunAtMs).In(j.Schedule.Location()).Format("2006-01-02 15:04 (Mon)"))
+		}
+		if j.State.LastStatus == "error" {
+			sb.WriteString(fmt.Sprintf(", last run failed: %s", j.State.LastError))
+		}
+		sb.WriteString("\n")
 	}
 	return sb.String(), nil
 }
@@ -0,0 +1,103 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Delegator sends tasks to other nanobot instances.
+type Delegator interface {
+	// Peers returns the peers' names and descriptions.
+	Peers() map[string]string
+	// Delegate sends task to peer; its answer is delivered to the chat
+	// originChannel:originChatID.
+	Delegate(peer, task, originChannel, originChatID string) error
+}
+
+// DelegateTool hands a task to another nanobot instance, which may have
+// tools and data this one lacks.
+type DelegateTool struct {
+	BaseTool
+	Delegator     Delegator
+	OriginChannel string
+	OriginChatID  string
+}
+
+// NewDelegateTool creates a new DelegateTool.
+func NewDelegateTool(delegator Delegator) *DelegateTool {
+	return &DelegateTool{Delegator: delegator}
+}
+
+// SetContext sets the chat the peer's answer is delivered to.
+func (t *DelegateTool) SetContext(channel, chatID string) {
+	t.OriginChannel = channel
+	t.OriginChatID = chatID
+}
+
+func (t *DelegateTool) Name() string {
+	return "delegate"
+}
+
+func (t *DelegateTool) Description() string {
+	return "Delegate a task to another nanobot instance (a peer) that has tools or data you lack. The peer works on it in the background and its answer is posted to this chat when ready. Describe the task fully; the peer cannot see this conversation."
+}
+
+func (t *DelegateTool) ToSchema() map[string]interface{} {
+	return GenerateSchema(t)
+}
+
+func (t *DelegateTool) Parameters() map[string]interface{} {
+	peers := t.Delegator.Peers()
+	names := make([]string, 0, len(peers))
+	for name := range peers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var desc []string
+	for _, name := range names {
+		if d := peers[name]; d != "" {
+			desc = append(desc, fmt.Sprintf("%s (%s)", name, d))
+		} else {
+			desc = append(desc, name)
+		}
+	}
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"peer": map[string]interface{}{
+				"type":        "string",
+				"description": "The peer to delegate to: " + strings.Join(desc, "; "),
+				"enum":        names,
+			},
+			"task": map[string]interface{}{
+				"type":        "string",
+				"description": "The task, with all the context the peer needs",
+			},
+		},
+		"required": []string{"peer", "task"},
+	}
+}
+
+func (t *DelegateTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	peer, _ := args["peer"].(string)
+	task, _ := args["task"].(string)
+	if peer == "" || strings.TrimSpace(task) == "" {
+		return "Error: peer and task are required", nil
+	}
+	if _, ok := t.Delegator.Peers()[peer]; !ok {
+		return fmt.Sprintf("Error: unknown peer %q", peer), nil
+	}
+	// A task from a peer is not passed on, so peers cannot delegate in circles
+	if t.OriginChannel == "federation" {
+		return "Error: this task was delegated by a peer and cannot be delegated again", nil
+	}
+	if t.OriginChannel == "" || t.OriginChatID == "" {
+		return "Error: no chat to deliver the answer to", nil
+	}
+	if err := t.Delegator.Delegate(peer, task, t.OriginChannel, t.OriginChatID); err != nil {
+		return fmt.Sprintf("Error: failed to reach peer %s: %v", peer, err), nil
+	}
+	return fmt.Sprintf("Task sent to %s. Its answer will be posted to this chat when ready.", peer), nil
+}
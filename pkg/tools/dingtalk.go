@@ -0,0 +1,230 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/config"
+	"github.com/HKUDS/nanobot-go/pkg/contacts"
+)
+
+const dingtalkOAPI = "https://oapi.dingtalk.com"
+
+// DingTalkGroupTool manages DingTalk scene groups: create, add/remove members, set title.
+type DingTalkGroupTool struct {
+	BaseTool
+	Config   *config.DingTalkConfig
+	Contacts *contacts.Directory
+	client   *http.Client
+
+	tokenMu       sync.Mutex
+	accessToken   string
+	tokenExpireAt time.Time
+}
+
+// NewDingTalkGroupTool creates a new DingTalkGroupTool.
+func NewDingTalkGroupTool(cfg *config.DingTalkConfig, directory *contacts.Directory) *DingTalkGroupTool {
+	return &DingTalkGroupTool{
+		Config:   cfg,
+		Contacts: directory,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (t *DingTalkGroupTool) Name() string {
+	return "dingtalk_group"
+}
+
+func (t *DingTalkGroupTool) Description() string {
+	return "Manage DingTalk scene groups. Actions: create (title, owner, members), add_members, remove_members, set_title. " +
+		"Members are DingTalk userIds or names from the config 'contacts' list. " +
+		"The returned open_conversation_id can be used as chat_id with the 'message' tool (channel 'dingtalk')."
+}
+
+func (t *DingTalkGroupTool) ToSchema() map[string]interface{} {
+	return GenerateSchema(t)
+}
+
+func (t *DingTalkGroupTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"create", "add_members", "remove_members", "set_title"},
+				"description": "Action to perform",
+			},
+			"chat_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Group open_conversation_id (for add_members, remove_members, set_title)",
+			},
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "Group title (for create, set_title)",
+			},
+			"owner": map[string]interface{}{
+				"type":        "string",
+				"description": "Group owner userId or contact name (for create)",
+			},
+			"members": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Member userIds or contact names",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *DingTalkGroupTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	action, _ := args["action"].(string)
+	chatID, _ := args["chat_id"].(string)
+	title, _ := args["title"].(string)
+	owner, _ := args["owner"].(string)
+	members := t.resolveUsers(stringList(args["members"]))
+
+	switch action {
+	case "create":
+		if title == "" || owner == "" {
+			return "Error: title and owner are required for create", nil
+		}
+		if t.Config.GroupTemplateID == "" {
+			return "Error: channels.dingtalk.groupTemplateId is not configured", nil
+		}
+		owners := t.resolveUsers([]string{owner})
+		body := map[string]interface{}{
+			"title":         title,
+			"template_id":   t.Config.GroupTemplateID,
+			"owner_user_id": owners[0],
+			"user_ids":      strings.Join(append(owners, members...), ","),
+		}
+		var result struct {
+			OpenConversationID string `json:"open_conversation_id"`
+			ChatID             string `json:"chat_id"`
+		}
+		if err := t.call("/topapi/im/chat/scenegroup/create", body, &result); err != nil {
+			return fmt.Sprintf("Error: %v", err), nil
+		}
+		return fmt.Sprintf("Created group '%s' (open_conversation_id: %s) with %d members", title, result.OpenConversationID, len(members)+1), nil
+
+	case "add_members", "remove_members":
+		if chatID == "" || len(members) == 0 {
+			return fmt.Sprintf("Error: chat_id and members are required for %s", action), nil
+		}
+		path := "/topapi/im/chat/scenegroup/member/add"
+		verb := "Added"
+		if action == "remove_members" {
+			path = "/topapi/im/chat/scenegroup/member/delete"
+			verb = "Removed"
+		}
+		body := map[string]interface{}{
+			"open_conversation_id": chatID,
+			"user_ids":             strings.Join(members, ","),
+		}
+		if err := t.call(path, body, nil); err != nil {
+			return fmt.Sprintf("Error: %v", err), nil
+		}
+		return fmt.Sprintf("%s %d members: %s", verb, len(members), strings.Join(members, ", ")), nil
+
+	case "set_title":
+		if chatID == "" || title == "" {
+			return "Error: chat_id and title are required for set_title", nil
+		}
+		body := map[string]interface{}{
+			"open_conversation_id": chatID,
+			"title":                title,
+		}
+		if err := t.call("/topapi/im/chat/scenegroup/update", body, nil); err != nil {
+			return fmt.Sprintf("Error: %v", err), nil
+		}
+		return fmt.Sprintf("Group title set to '%s'", title), nil
+
+	default:
+		return fmt.Sprintf("Unknown action: %s", action), nil
+	}
+}
+
+// resolveUsers maps contact names to their DingTalk userIds; other entries are kept as-is.
+func (t *DingTalkGroupTool) resolveUsers(users []string) []string {
+	var out []string
+	for _, u := range users {
+		if ids := t.Contacts.IDs(u, "dingtalk"); len(ids) > 0 {
+			out = append(out, ids[0])
+		} else {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+// call POSTs body to a DingTalk OAPI endpoint and decodes "result" into out.
+func (t *DingTalkGroupTool) call(path string, body interface{}, out interface{}) error {
+	token, err := t.getAccessToken()
+	if err != nil {
+		return fmt.Errorf("failed to get access token: %w", err)
+	}
+
+	data, _ := json.Marshal(body)
+	resp, err := t.client.Post(dingtalkOAPI+path+"?access_token="+url.QueryEscape(token), "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ErrCode int             `json:"errcode"`
+		ErrMsg  string          `json:"errmsg"`
+		Result  json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	if result.ErrCode != 0 {
+		return fmt.Errorf("dingtalk error: %d %s", result.ErrCode, result.ErrMsg)
+	}
+	if out != nil && len(result.Result) > 0 {
+		return json.Unmarshal(result.Result, out)
+	}
+	return nil
+}
+
+func (t *DingTalkGroupTool) getAccessToken() (string, error) {
+	t.tokenMu.Lock()
+	defer t.tokenMu.Unlock()
+
+	if t.accessToken != "" && time.Now().Before(t.tokenExpireAt) {
+		return t.accessToken, nil
+	}
+
+	q := url.Values{"appkey": {t.Config.ClientID}, "appsecret": {t.Config.AppSecret}}
+	resp, err := t.client.Get(dingtalkOAPI + "/gettoken?" + q.Encode())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ErrCode     int    `json:"errcode"`
+		ErrMsg      string `json:"errmsg"`
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.ErrCode != 0 || result.AccessToken == "" {
+		return "", fmt.Errorf("%d %s", result.ErrCode, result.ErrMsg)
+	}
+
+	t.accessToken = result.AccessToken
+	// Buffer the expiry by 60s
+	t.tokenExpireAt = time.Now().Add(time.Duration(result.ExpiresIn-60) * time.Second)
+	return t.accessToken, nil
+}
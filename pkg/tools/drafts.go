@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/HKUDS/nanobot-go/pkg/bus"
+)
+
+// DraftBox holds messages the agent addresses to a chat other than the one
+// it is serving until the requester approves them with /send.
+type DraftBox struct {
+	Bus     *bus.MessageBus
+	mu      sync.Mutex
+	pending map[string][]bus.OutboundMessage // keyed by requester "channel:chatID"
+}
+
+// NewDraftBox creates an empty DraftBox.
+func NewDraftBox(messageBus *bus.MessageBus) *DraftBox {
+	return &DraftBox{
+		Bus:     messageBus,
+		pending: make(map[string][]bus.OutboundMessage),
+	}
+}
+
+// Hold queues msg for the requester's approval, shows them a preview and
+// returns the result reported to the model.
+func (d *DraftBox) Hold(channel, chatID string, msg bus.OutboundMessage) string {
+	key := channel + ":" + chatID
+	d.mu.Lock()
+	d.pending[key] = append(d.pending[key], msg)
+	n := len(d.pending[key])
+	d.mu.Unlock()
+
+	var preview strings.Builder
+	preview.WriteString(fmt.Sprintf("Draft #%d to %s:%s", n, msg.Channel, msg.ChatID))
+	if msg.Type != "" && msg.Type != bus.MessageTypeText {
+		preview.WriteString(fmt.Sprintf(" (%s: %s)", msg.Type, msg.Media))
+	}
+	preview.WriteString(":\n\n")
+	if msg.Content != "" {
+		preview.WriteString(msg.Content + "\n\n")
+	}
+	preview.WriteString("Reply /send to post it or /discard to drop it.")
+	d.Bus.PublishOutbound(bus.OutboundMessage{
+		Channel: channel,
+		ChatID:  chatID,
+		Content: preview.String(),
+	})
+
+	return fmt.Sprintf("Message to %s:%s is waiting for the user's approval (draft #%d). They were shown a preview and will reply /send or /discard; do not send it again.", msg.Channel, msg.ChatID, n)
+}
+
+// Send posts and clears the drafts held for a requester, returning how many were sent.
+func (d *DraftBox) Send(channel, chatID string) int {
+	drafts := d.take(channel, chatID)
+	for _, msg := range drafts {
+		d.Bus.PublishOutbound(msg)
+	}
+	return len(drafts)
+}
+
+// Discard drops the drafts held for a requester, returning how many there were.
+func (d *DraftBox) Discard(channel, chatID string) int {
+	return len(d.take(channel, chatID))
+}
+
+func (d *DraftBox) take(channel, chatID string) []bus.OutboundMessage {
+	key := channel + ":" + chatID
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	drafts := d.pending[key]
+	delete(d.pending, key)
+	return drafts
+}
@@ -0,0 +1,38 @@
+package tools
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// DecodeText converts tool output to UTF-8. Valid UTF-8 is returned unchanged;
+// otherwise each candidate encoding (e.g. "gbk", "big5") is tried and the
+// decoding with the fewest invalid characters wins. With no candidates the
+// data is returned as is.
+func DecodeText(data []byte, candidates []string) string {
+	if len(candidates) == 0 || utf8.Valid(data) {
+		return string(data)
+	}
+
+	best := string(data)
+	bestBad := -1
+	for _, name := range candidates {
+		enc, err := htmlindex.Get(name)
+		if err != nil {
+			continue
+		}
+		decoded, err := enc.NewDecoder().Bytes(data)
+		if err != nil {
+			continue
+		}
+		bad := invalidRunes(string(decoded))
+		if bestBad < 0 || bad < bestBad {
+			best, bestBad = string(decoded), bad
+		}
+		if bad == 0 {
+			break
+		}
+	}
+	return best
+}
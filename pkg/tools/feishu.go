@@ -0,0 +1,161 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/config"
+	"github.com/HKUDS/nanobot-go/pkg/contacts"
+
+	lark "github.com/larksuite/oapi-sdk-go/v3"
+	larkcontact "github.com/larksuite/oapi-sdk-go/v3/service/contact/v3"
+)
+
+// FeishuLookupTool resolves emails, mobile numbers and contact names to Feishu open_ids.
+type FeishuLookupTool struct {
+	BaseTool
+	Contacts *contacts.Directory
+	client   *lark.Client
+}
+
+// NewFeishuLookupTool creates a new FeishuLookupTool.
+func NewFeishuLookupTool(cfg *config.FeishuConfig, directory *contacts.Directory) *FeishuLookupTool {
+	return &FeishuLookupTool{
+		Contacts: directory,
+		client:   lark.NewClient(cfg.AppID, cfg.AppSecret),
+	}
+}
+
+func (t *FeishuLookupTool) Name() string {
+	return "feishu_lookup"
+}
+
+func (t *FeishuLookupTool) Description() string {
+	return "Find a Feishu user's open_id by email, mobile number or configured contact name. " +
+		"Use the open_id as chat_id with the 'message' tool (channel 'feishu') to message that person directly."
+}
+
+func (t *FeishuLookupTool) ToSchema() map[string]interface{} {
+	return GenerateSchema(t)
+}
+
+func (t *FeishuLookupTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"emails": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Email addresses to look up (max 50)",
+			},
+			"mobiles": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Mobile numbers to look up (max 50); numbers outside mainland China need a +country code",
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "Name of a contact from the config 'contacts' list",
+			},
+		},
+	}
+}
+
+func (t *FeishuLookupTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	emails := stringList(args["emails"])
+	mobiles := stringList(args["mobiles"])
+	name, _ := args["name"].(string)
+
+	if len(emails) == 0 && len(mobiles) == 0 && name == "" {
+		return "Error: provide emails, mobiles or name", nil
+	}
+	if len(emails) > 50 || len(mobiles) > 50 {
+		return "Error: at most 50 emails and 50 mobiles per lookup", nil
+	}
+
+	var lines []string
+
+	if name != "" {
+		ids := t.Contacts.IDs(name, "feishu")
+		if len(ids) == 0 {
+			lines = append(lines, fmt.Sprintf("%s: no Feishu ID configured for this contact", name))
+		}
+		for _, id := range ids {
+			lines = append(lines, fmt.Sprintf("%s: %s", name, id))
+		}
+	}
+
+	if len(emails) > 0 || len(mobiles) > 0 {
+		req := larkcontact.NewBatchGetIdUserReqBuilder().
+			UserIdType(larkcontact.UserIdTypeOpenId).
+			Body(larkcontact.NewBatchGetIdUserReqBodyBuilder().
+				Emails(emails).
+				Mobiles(mobiles).
+				Build()).
+			Build()
+
+		resp, err := t.client.Contact.User.BatchGetId(ctx, req)
+		if err != nil {
+			return fmt.Sprintf("Error: Feishu lookup failed: %v", err), nil
+		}
+		if !resp.Success() {
+			return fmt.Sprintf("Error: Feishu lookup failed: %d %s", resp.Code, resp.Msg), nil
+		}
+
+		if resp.Data != nil {
+			for _, u := range resp.Data.UserList {
+				key := deref(u.Email)
+				if key == "" {
+					key = deref(u.Mobile)
+				}
+				openID := deref(u.UserId)
+				if openID == "" {
+					lines = append(lines, fmt.Sprintf("%s: not found (or the app can't see this user)", key))
+					continue
+				}
+				line := fmt.Sprintf("%s: %s", key, openID)
+				if userName := t.userName(ctx, openID); userName != "" {
+					line += fmt.Sprintf(" (%s)", userName)
+				}
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	if len(lines) == 0 {
+		return "No users found.", nil
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// userName returns the display name for an open_id, or "" if the app lacks permission.
+func (t *FeishuLookupTool) userName(ctx context.Context, openID string) string {
+	req := larkcontact.NewGetUserReqBuilder().
+		UserId(openID).
+		UserIdType(larkcontact.UserIdTypeOpenId).
+		Build()
+	resp, err := t.client.Contact.User.Get(ctx, req)
+	if err != nil || !resp.Success() || resp.Data == nil || resp.Data.User == nil {
+		return ""
+	}
+	return deref(resp.Data.User.Name)
+}
+
+func stringList(v interface{}) []string {
+	items, _ := v.([]interface{})
+	var out []string
+	for _, item := range items {
+		if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+			out = append(out, strings.TrimSpace(s))
+		}
+	}
+	return out
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
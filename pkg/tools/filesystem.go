@@ -1,12 +1,15 @@
 package tools
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
 )
 
 func expandPath(path string) string {
@@ -20,6 +23,7 @@ func expandPath(path string) string {
 // ReadFileTool reads file contents.
 type ReadFileTool struct {
 	BaseTool
+	Encodings []string // Legacy encodings converted to UTF-8; nil reads bytes as is
 }
 
 func (t *ReadFileTool) Name() string {
@@ -27,7 +31,7 @@ func (t *ReadFileTool) Name() string {
 }
 
 func (t *ReadFileTool) Description() string {
-	return "Read the contents of a file at the given path."
+	return "Read the contents of a text file at the given path. Binary files are summarized instead of returned."
 }
 
 func (t *ReadFileTool) Parameters() map[string]interface{} {
@@ -47,14 +51,14 @@ func (t *ReadFileTool) ToSchema() map[string]interface{} {
 	return GenerateSchema(t)
 }
 
-func (t *ReadFileTool) Execute(args map[string]interface{}) (string, error) {
+func (t *ReadFileTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	path, ok := args["path"].(string)
 	if !ok {
 		return "", fmt.Errorf("path must be a string")
 	}
 
 	expandedPath := expandPath(path)
-	data, err := ioutil.ReadFile(expandedPath)
+	data, err := atrest.ReadFile(expandedPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return fmt.Sprintf("Error: File not found: %s", path), nil
@@ -65,7 +69,12 @@ func (t *ReadFileTool) Execute(args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("error reading file: %w", err)
 	}
 
-	return string(data), nil
+	if kind, hint, binary := detectBinary(data, t.Encodings); binary {
+		return fmt.Sprintf("Binary file: %s\nType: %s\nSize: %s\nThe content was not read because it is not text.\nHint: %s",
+			path, kind, humanSize(int64(len(data))), strings.ReplaceAll(hint, "%s", path)), nil
+	}
+
+	return DecodeText(data, t.Encodings), nil
 }
 
 // WriteFileTool writes content to a file.
@@ -102,7 +111,7 @@ func (t *WriteFileTool) ToSchema() map[string]interface{} {
 	return GenerateSchema(t)
 }
 
-func (t *WriteFileTool) Execute(args map[string]interface{}) (string, error) {
+func (t *WriteFileTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	path, ok := args["path"].(string)
 	if !ok {
 		return "", fmt.Errorf("path must be a string")
@@ -117,7 +126,7 @@ func (t *WriteFileTool) Execute(args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("error creating directories: %w", err)
 	}
 
-	if err := ioutil.WriteFile(expandedPath, []byte(content), 0644); err != nil {
+	if err := atrest.WriteFile(expandedPath, []byte(content), 0644); err != nil {
 		if os.IsPermission(err) {
 			return fmt.Sprintf("Error: Permission denied: %s", path), nil
 		}
@@ -165,7 +174,7 @@ func (t *EditFileTool) ToSchema() map[string]interface{} {
 	return GenerateSchema(t)
 }
 
-func (t *EditFileTool) Execute(args map[string]interface{}) (string, error) {
+func (t *EditFileTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	path, ok := args["path"].(string)
 	if !ok {
 		return "", fmt.Errorf("path must be a string")
@@ -180,7 +189,7 @@ func (t *EditFileTool) Execute(args map[string]interface{}) (string, error) {
 	}
 
 	expandedPath := expandPath(path)
-	data, err := ioutil.ReadFile(expandedPath)
+	data, err := atrest.ReadFile(expandedPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return fmt.Sprintf("Error: File not found: %s", path), nil
@@ -199,7 +208,7 @@ func (t *EditFileTool) Execute(args map[string]interface{}) (string, error) {
 	}
 
 	newContent := strings.Replace(content, oldText, newText, 1)
-	if err := ioutil.WriteFile(expandedPath, []byte(newContent), 0644); err != nil {
+	if err := atrest.WriteFile(expandedPath, []byte(newContent), 0644); err != nil {
 		return "", fmt.Errorf("error writing file: %w", err)
 	}
 
@@ -240,7 +249,7 @@ func (t *AppendFileTool) ToSchema() map[string]interface{} {
 	return GenerateSchema(t)
 }
 
-func (t *AppendFileTool) Execute(args map[string]interface{}) (string, error) {
+func (t *AppendFileTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	path, ok := args["path"].(string)
 	if !ok {
 		return "", fmt.Errorf("path must be a string")
@@ -259,16 +268,11 @@ func (t *AppendFileTool) Execute(args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("error creating directories: %w", err)
 	}
 
-	f, err := os.OpenFile(expandedPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
+	// Encrypted memory files are rewritten whole
+	if err := atrest.AppendFile(expandedPath, []byte(content), 0644); err != nil {
 		if os.IsPermission(err) {
 			return fmt.Sprintf("Error: Permission denied: %s", path), nil
 		}
-		return "", fmt.Errorf("error opening file: %w", err)
-	}
-	defer f.Close()
-
-	if _, err := f.WriteString(content); err != nil {
 		return "", fmt.Errorf("error writing to file: %w", err)
 	}
 
@@ -305,7 +309,7 @@ func (t *ListDirTool) ToSchema() map[string]interface{} {
 	return GenerateSchema(t)
 }
 
-func (t *ListDirTool) Execute(args map[string]interface{}) (string, error) {
+func (t *ListDirTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	path, ok := args["path"].(string)
 	if !ok {
 		return "", fmt.Errorf("path must be a string")
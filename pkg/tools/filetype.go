@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// fileSignature identifies a binary format by its leading bytes.
+type fileSignature struct {
+	Offset int
+	Magic  []byte
+	Kind   string
+	Hint   string // How to inspect the file instead; %s is replaced by the path
+}
+
+var fileSignatures = []fileSignature{
+	{0, []byte("%PDF-"), "PDF document", "Extract the text with exec: `pdftotext %s -`"},
+	{0, []byte("PK\x03\x04"), "ZIP archive (also docx/xlsx/pptx/jar)", "List it with exec: `unzip -l %s`, or extract it into the workspace with `unzip`"},
+	{0, []byte("\x1f\x8b"), "gzip archive", "List it with exec: `tar -tzf %s` (or `gunzip -c` for a single file)"},
+	{0, []byte("BZh"), "bzip2 archive", "List it with exec: `tar -tjf %s`"},
+	{0, []byte("\xfd7zXZ\x00"), "xz archive", "List it with exec: `tar -tJf %s`"},
+	{0, []byte("7z\xbc\xaf\x27\x1c"), "7-Zip archive", "List it with exec: `7z l %s`"},
+	{0, []byte("Rar!\x1a\x07"), "RAR archive", "List it with exec: `unrar l %s`"},
+	{257, []byte("ustar"), "tar archive", "List it with exec: `tar -tf %s`"},
+	{0, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"), "legacy Office document (doc/xls/ppt)", "Convert it with exec: `libreoffice --headless --convert-to txt %s`"},
+	{0, []byte("SQLite format 3\x00"), "SQLite database", "Query it with exec: `sqlite3 %s .tables`"},
+	{0, []byte("\x7fELF"), "ELF executable", "Inspect it with exec: `file %s`"},
+	{0, []byte("MZ"), "Windows executable", "Inspect it with exec: `file %s`"},
+	{0, []byte("\xcf\xfa\xed\xfe"), "Mach-O executable", "Inspect it with exec: `file %s`"},
+}
+
+// detectBinary reports whether data is binary rather than text and, if so,
+// a description of its type and a hint for inspecting it. encodings are the
+// legacy text encodings that still count as text.
+func detectBinary(data []byte, encodings []string) (kind, hint string, binary bool) {
+	sample := data
+	if len(sample) > 8192 {
+		sample = trimPartialRune(sample[:8192])
+	}
+
+	// Short signatures like "MZ" also start ordinary text, so they only
+	// count when the content isn't plain UTF-8.
+	plain := bytes.IndexByte(sample, 0) < 0 && utf8.Valid(sample)
+	for _, sig := range fileSignatures {
+		if len(sig.Magic) < 4 && plain {
+			continue
+		}
+		if len(sample) >= sig.Offset+len(sig.Magic) && bytes.Equal(sample[sig.Offset:sig.Offset+len(sig.Magic)], sig.Magic) {
+			return sig.Kind, sig.Hint, true
+		}
+	}
+
+	contentType := http.DetectContentType(sample)
+	mediaType := strings.SplitN(contentType, ";", 2)[0]
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return "image (" + mediaType + ")", "Send it to the user with the 'message' tool, or describe it with a vision-capable model", true
+	case strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "video/"):
+		return "media (" + mediaType + ")", "Inspect it with exec: `ffprobe %s`", true
+	}
+
+	if bytes.IndexByte(sample, 0) >= 0 {
+		return "binary data", "Inspect it with exec: `file %s` or `xxd %s | head`", true
+	}
+	if !utf8.Valid(sample) {
+		decoded := DecodeText(sample, encodings)
+		if invalidRunes(decoded) > utf8.RuneCountInString(decoded)/20 {
+			return "binary data", "Inspect it with exec: `file %s` or `xxd %s | head`", true
+		}
+	}
+	return "", "", false
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence left at the end of a sample.
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// invalidRunes counts invalid or replacement characters in s.
+func invalidRunes(s string) int {
+	n := 0
+	for _, r := range s {
+		if r == utf8.RuneError {
+			n++
+		}
+	}
+	return n
+}
+
+// humanSize formats a byte count for display.
+func humanSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
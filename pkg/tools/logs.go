@@ -0,0 +1,83 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/HKUDS/nanobot-go/pkg/utils"
+)
+
+// LogsTool returns recent lines of nanobot's own log, for admins debugging
+// the bot from a chat.
+type LogsTool struct {
+	BaseTool
+}
+
+// NewLogsTool creates a new LogsTool.
+func NewLogsTool() *LogsTool {
+	return &LogsTool{}
+}
+
+type adminKey struct{}
+
+// WithAdmin returns a context whose turn was asked for by an admin, or
+// not. Turns without it count as not.
+func WithAdmin(ctx context.Context, admin bool) context.Context {
+	return context.WithValue(ctx, adminKey{}, admin)
+}
+
+// isAdmin reports whether the turn of ctx was asked for by an admin.
+func isAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminKey{}).(bool)
+	return admin
+}
+
+func (t *LogsTool) Name() string {
+	return "logs"
+}
+
+func (t *LogsTool) Description() string {
+	return "Read the most recent lines of nanobot's own log, optionally only errors or warnings, or only those of one module (source file, e.g. feishu, telegram, loop, cron). Only works for admins."
+}
+
+func (t *LogsTool) ToSchema() map[string]interface{} {
+	return GenerateSchema(t)
+}
+
+func (t *LogsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"lines": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Number of lines, the most recent (default 50, at most %d)", utils.MaxLogTail),
+			},
+			"level": map[string]interface{}{
+				"type":        "string",
+				"enum":        utils.LogLevels,
+				"description": "Only lines at this level or more severe",
+			},
+			"module": map[string]interface{}{
+				"type":        "string",
+				"description": "Only lines logged by source files whose name starts with this",
+			},
+		},
+	}
+}
+
+func (t *LogsTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	if !isAdmin(ctx) {
+		return "Error: only admins can read the logs", nil
+	}
+	q := utils.LogQuery{}
+	if n, ok := args["lines"].(float64); ok {
+		q.Lines = int(n)
+	}
+	q.Level, _ = args["level"].(string)
+	q.Module, _ = args["module"].(string)
+	tail, err := utils.LogTail(q)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	return tail, nil
+}
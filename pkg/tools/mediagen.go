@@ -1,24 +1,36 @@
 package tools
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/HKUDS/nanobot-go/pkg/bus"
 	"github.com/HKUDS/nanobot-go/pkg/config"
 	"github.com/HKUDS/nanobot-go/pkg/mediaproviders"
 )
 
+// maxMediaCaption is the longest caption, in characters, sent with
+// generated media.
+const maxMediaCaption = 200
+
 // MediaGenTool supports various media generation tasks using pluggable providers.
 type MediaGenTool struct {
 	BaseTool
 	Factory *mediaproviders.Factory
 	Config  *config.Config
+	// Bus, when set, is used to send generated media to the chat of the
+	// turn (tools.media.autoSend, see WithOrigin).
+	Bus *bus.MessageBus
 }
 
 // NewMediaGenTool creates a new MediaGenTool.
-func NewMediaGenTool(cfg *config.Config) *MediaGenTool {
+func NewMediaGenTool(cfg *config.Config, messageBus *bus.MessageBus) *MediaGenTool {
 	return &MediaGenTool{
 		Config:  cfg,
 		Factory: mediaproviders.NewFactory(cfg),
+		Bus:     messageBus,
 	}
 }
 
@@ -60,7 +72,7 @@ func (t *MediaGenTool) Parameters() map[string]interface{} {
 	}
 }
 
-func (t *MediaGenTool) Execute(args map[string]interface{}) (string, error) {
+func (t *MediaGenTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	prompt, _ := args["prompt"].(string)
 	if prompt == "" {
 		return "", fmt.Errorf("prompt is required")
@@ -101,22 +113,58 @@ func (t *MediaGenTool) Execute(args map[string]interface{}) (string, error) {
 		return nil
 	}
 
+	var result string
+	var err error
+	var msgType bus.MessageType
 	switch task {
 	case "text-to-image":
-		return provider.GenerateImage(prompt, model)
+		result, err = provider.GenerateImage(prompt, model)
+		msgType = bus.MessageTypeImage
 	case "image-to-image":
 		if err := checkImageURL(); err != nil {
 			return "", err
 		}
-		return provider.EditImage(prompt, imageURL, model)
+		result, err = provider.EditImage(prompt, imageURL, model)
+		msgType = bus.MessageTypeImage
 	case "image-to-video":
 		if err := checkImageURL(); err != nil {
 			return "", err
 		}
-		return provider.GenerateVideo(prompt, imageURL, model)
+		result, err = provider.GenerateVideo(prompt, imageURL, model)
+		msgType = bus.MessageTypeVideo
 	case "text-to-audio":
-		return provider.GenerateAudio(prompt, model)
+		result, err = provider.GenerateAudio(prompt, model)
+		msgType = bus.MessageTypeAudio
 	default:
 		return "", fmt.Errorf("unsupported task: %s", task)
 	}
+	if err != nil || !t.deliver(ctx, msgType, result, prompt) {
+		return result, err
+	}
+	return fmt.Sprintf("Generated %s and already sent it to the user: %s\nDo not send it again; reply with a short comment at most.", msgType, result), nil
+}
+
+// deliver sends generated media to the chat of the turn, captioned with
+// the prompt, and reports whether it did.
+func (t *MediaGenTool) deliver(ctx context.Context, msgType bus.MessageType, media, prompt string) bool {
+	channel, chatID := turnOrigin(ctx)
+	if !t.Config.Tools.Media.AutoSend || t.Bus == nil || media == "" || channel == "" || !t.Bus.HasSubscribers(channel) {
+		return false
+	}
+	caption := ""
+	if msgType != bus.MessageTypeAudio {
+		// Audio is the prompt read out, so it needs no caption
+		caption = strings.TrimSpace(prompt)
+		if utf8.RuneCountInString(caption) > maxMediaCaption {
+			caption = string([]rune(caption)[:maxMediaCaption-1]) + "…"
+		}
+	}
+	t.Bus.PublishOutbound(bus.OutboundMessage{
+		Channel: channel,
+		ChatID:  chatID,
+		Type:    msgType,
+		Media:   media,
+		Content: caption,
+	})
+	return true
 }
@@ -0,0 +1,197 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/memory"
+)
+
+// MemoryTool stores facts scoped to the current chat, or shared across
+// all chats of the current contact when shared context is enabled.
+type MemoryTool struct {
+	BaseTool
+	Store         *memory.MemoryStore
+	SharedContext bool
+}
+
+// NewMemoryTool creates a new MemoryTool.
+func NewMemoryTool(store *memory.MemoryStore, sharedContext bool) *MemoryTool {
+	return &MemoryTool{
+		Store:         store,
+		SharedContext: sharedContext,
+	}
+}
+
+// memoryScope is the session of a turn and the contact who owns it (may
+// be empty).
+type memoryScope struct {
+	sessionKey string
+	contact    string
+}
+
+type memoryScopeKey struct{}
+
+// WithMemoryScope returns a context whose turn remembers facts for
+// sessionKey and, when shared, for contact.
+func WithMemoryScope(ctx context.Context, sessionKey, contact string) context.Context {
+	return context.WithValue(ctx, memoryScopeKey{}, memoryScope{sessionKey: sessionKey, contact: contact})
+}
+
+func (t *MemoryTool) Name() string {
+	return "memory"
+}
+
+func (t *MemoryTool) Description() string {
+	return "Remember facts learned in this chat. Set share=true to make a fact about the user visible in their other chats (only works if shared context is enabled and the user is a known contact). Give facts that only hold for a while an expiry date (\"on vacation until June 3\" expires on June 3); they are forgotten after it. Say how sure you are with confidence, and where the fact came from with source. Use remember_file to keep an image or file (an attachment or a workspace file) with a caption saying what it is, e.g. \"the user's cat, Mochi\" or \"invoice from ACME, March\"; the saved path can be sent again later with the message tool."
+}
+
+func (t *MemoryTool) ToSchema() map[string]interface{} {
+	return GenerateSchema(t)
+}
+
+func (t *MemoryTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"remember", "remember_file", "list"},
+				"description": "Action to perform",
+			},
+			"fact": map[string]interface{}{
+				"type":        "string",
+				"description": "The fact to remember (for remember), or the caption of the file (for remember_file)",
+			},
+			"file": map[string]interface{}{
+				"type":        "string",
+				"description": "Path of the image or file to keep (for remember_file)",
+			},
+			"share": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Share this fact with the user's other chats",
+			},
+			"expires": map[string]interface{}{
+				"type":        "string",
+				"description": "Last day the fact holds, YYYY-MM-DD (optional)",
+			},
+			"confidence": map[string]interface{}{
+				"type":        "string",
+				"enum":        memory.FactConfidences,
+				"description": "How sure you are of the fact (optional)",
+			},
+			"source": map[string]interface{}{
+				"type":        "string",
+				"description": "Where the fact came from, e.g. \"user\", \"inferred\" or a URL (optional)",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *MemoryTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	action, ok := args["action"].(string)
+	if !ok {
+		return "", fmt.Errorf("action must be a string")
+	}
+	scope, _ := ctx.Value(memoryScopeKey{}).(memoryScope)
+	if scope.sessionKey == "" {
+		return "Error: no session context", nil
+	}
+
+	switch action {
+	case "remember", "remember_file":
+		share, _ := args["share"].(bool)
+		return t.remember(scope, args, action == "remember_file", share)
+	case "list":
+		content := t.Store.GetChatMemoryContext(scope.sessionKey, t.sharedContact(scope))
+		if content == "" {
+			return "No facts remembered for this chat.", nil
+		}
+		return content, nil
+	default:
+		return fmt.Sprintf("Unknown action: %s", action), nil
+	}
+}
+
+func (t *MemoryTool) remember(scope memoryScope, args map[string]interface{}, withFile, share bool) (string, error) {
+	text, _ := args["fact"].(string)
+	file, _ := args["file"].(string)
+	switch {
+	case withFile && file == "":
+		return "Error: file is required for remember_file", nil
+	case withFile && text == "":
+		return "Error: fact is required for remember_file, as the caption of the file", nil
+	case text == "":
+		return "Error: fact is required for remember", nil
+	}
+	fact := memory.Fact{Text: text}
+	fact.Confidence, _ = args["confidence"].(string)
+	fact.Source, _ = args["source"].(string)
+	if fact.Confidence != "" {
+		valid := false
+		for _, c := range memory.FactConfidences {
+			valid = valid || c == fact.Confidence
+		}
+		if !valid {
+			return fmt.Sprintf("Error: confidence must be one of %s", strings.Join(memory.FactConfidences, ", ")), nil
+		}
+	}
+	if expires, _ := args["expires"].(string); expires != "" {
+		date, err := memory.ParseFactDate(expires)
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err), nil
+		}
+		fact.Expires = date
+		if fact.Expired(time.Now()) {
+			return fmt.Sprintf("Error: %s is in the past, so the fact no longer holds", expires), nil
+		}
+	}
+
+	path := t.Store.ChatFactsFile(scope.sessionKey)
+	where := "this chat"
+	if share {
+		contact := t.sharedContact(scope)
+		if contact == "" {
+			return "Error: cannot share this fact (shared context is disabled or the user is not a known contact). Save it without share instead.", nil
+		}
+		path = t.Store.ContactFactsFile(contact)
+		where = fmt.Sprintf("all chats of %s", contact)
+	}
+
+	if withFile {
+		if strings.HasPrefix(file, "http://") || strings.HasPrefix(file, "https://") {
+			return "Error: file must be a local path; download it first", nil
+		}
+		saved, err := t.Store.SaveMedia(file)
+		if err != nil {
+			return fmt.Sprintf("Error: %v", err), nil
+		}
+		label := "File"
+		if saved.Kind == "image" {
+			label = "Image"
+		}
+		text = fmt.Sprintf("%s %q: %s, saved at %s", label, saved.Name, text, saved.Path)
+		if saved.Thumbnail != "" {
+			text += ", thumbnail " + saved.Thumbnail
+		}
+		fact.Text = text
+	}
+
+	if err := t.Store.AppendFact(path, fact); err != nil {
+		return "", fmt.Errorf("error saving fact: %w", err)
+	}
+	if !fact.Expires.IsZero() {
+		return fmt.Sprintf("Remembered for %s until %s: %s", where, fact.Expires.Format("2006-01-02"), text), nil
+	}
+	return fmt.Sprintf("Remembered for %s: %s", where, text), nil
+}
+
+func (t *MemoryTool) sharedContact(scope memoryScope) string {
+	if !t.SharedContext {
+		return ""
+	}
+	return scope.contact
+}
@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/memory"
+)
+
+// MemorySearchTool finds memories in MEMORY.md and the daily notes by meaning.
+type MemorySearchTool struct {
+	BaseTool
+	Index      *memory.VectorIndex
+	MaxResults int
+	MinScore   float64
+}
+
+// NewMemorySearchTool creates a new MemorySearchTool.
+func NewMemorySearchTool(index *memory.VectorIndex, maxResults int, minScore float64) *MemorySearchTool {
+	if maxResults <= 0 {
+		maxResults = 5
+	}
+	return &MemorySearchTool{
+		Index:      index,
+		MaxResults: maxResults,
+		MinScore:   minScore,
+	}
+}
+
+func (t *MemorySearchTool) Name() string {
+	return "memory_search"
+}
+
+func (t *MemorySearchTool) Description() string {
+	return "Search your long-term memory (MEMORY.md) and daily notes by meaning. Returns the most relevant entries with their source file and similarity score."
+}
+
+func (t *MemorySearchTool) ToSchema() map[string]interface{} {
+	return GenerateSchema(t)
+}
+
+func (t *MemorySearchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "What to look for, in natural language",
+			},
+			"count": map[string]interface{}{
+				"type":        "integer",
+				"description": "Results (1-20)",
+				"minimum":     1,
+				"maximum":     20,
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+func (t *MemorySearchTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	query, ok := args["query"].(string)
+	if !ok || query == "" {
+		return "", fmt.Errorf("query must be a non-empty string")
+	}
+
+	count := t.MaxResults
+	if c, ok := args["count"].(float64); ok {
+		count = int(c)
+	}
+	if count < 1 {
+		count = 1
+	}
+	if count > 20 {
+		count = 20
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	hits, err := t.Index.Search(ctx, query, count, t.MinScore)
+	if err != nil {
+		return fmt.Sprintf("Error: memory search failed: %v", err), nil
+	}
+	if len(hits) == 0 {
+		return "No matching memories found.", nil
+	}
+	return memory.FormatHits(hits), nil
+}
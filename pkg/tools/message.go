@@ -1,17 +1,21 @@
 package tools
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/HKUDS/nanobot-go/pkg/bus"
 )
 
-// MessageTool allows the agent to send messages.
+// MessageTool allows the agent to send messages, by default to the chat of
+// the turn (see WithOrigin).
 type MessageTool struct {
 	BaseTool
-	Bus            *bus.MessageBus
-	DefaultChannel string
-	DefaultChatID  string
+	Bus *bus.MessageBus
+	// Drafts, when set, holds messages for another chat until the
+	// requester approves them (tools.message.confirmOtherChats).
+	Drafts *DraftBox
 }
 
 // NewMessageTool creates a new MessageTool.
@@ -21,10 +25,24 @@ func NewMessageTool(messageBus *bus.MessageBus) *MessageTool {
 	}
 }
 
-// SetContext sets the default channel and chat ID.
-func (t *MessageTool) SetContext(channel, chatID string) {
-	t.DefaultChannel = channel
-	t.DefaultChatID = chatID
+// origin is the chat a turn answers.
+type origin struct {
+	channel string
+	chatID  string
+}
+
+type originKey struct{}
+
+// WithOrigin returns a context whose turn answers the chat chatID on
+// channel.
+func WithOrigin(ctx context.Context, channel, chatID string) context.Context {
+	return context.WithValue(ctx, originKey{}, origin{channel: channel, chatID: chatID})
+}
+
+// turnOrigin returns the chat set with WithOrigin.
+func turnOrigin(ctx context.Context) (channel, chatID string) {
+	o, _ := ctx.Value(originKey{}).(origin)
+	return o.channel, o.chatID
 }
 
 func (t *MessageTool) Name() string {
@@ -32,7 +50,7 @@ func (t *MessageTool) Name() string {
 }
 
 func (t *MessageTool) Description() string {
-	return "Send a message to the user. Supports text, image, audio, and video. Use this to send files or communicate."
+	return "Send a message to the user. Supports text, image, audio, video and file (any document, sent as an attachment). Use this to send files or communicate. Set deliver_at to compose a message now and have it delivered, unchanged, at a later time."
 }
 
 func (t *MessageTool) ToSchema() map[string]interface{} {
@@ -49,12 +67,12 @@ func (t *MessageTool) Parameters() map[string]interface{} {
 			},
 			"type": map[string]interface{}{
 				"type":        "string",
-				"description": "Message type: text, image, audio, video",
-				"enum":        []string{"text", "image", "audio", "video"},
+				"description": "Message type: text, image, audio, video, file",
+				"enum":        []string{"text", "image", "audio", "video", "file"},
 			},
 			"media": map[string]interface{}{
 				"type":        "string",
-				"description": "Path or URL to the media file (required for image/audio/video)",
+				"description": "Path or URL to the media file (required for image/audio/video/file)",
 			},
 			"channel": map[string]interface{}{
 				"type":        "string",
@@ -64,12 +82,16 @@ func (t *MessageTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Optional: target chat/user ID",
 			},
+			"deliver_at": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: when to deliver the message, as RFC 3339 (2025-01-02T09:00:00+08:00) or YYYY-MM-DD HH:MM in local time. Omit to send now.",
+			},
 		},
 		"required": []string{},
 	}
 }
 
-func (t *MessageTool) Execute(args map[string]interface{}) (string, error) {
+func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	content, _ := args["content"].(string)
 	msgType, _ := args["type"].(string)
 	media, _ := args["media"].(string)
@@ -78,20 +100,21 @@ func (t *MessageTool) Execute(args map[string]interface{}) (string, error) {
 		msgType = "text"
 	}
 
-	if (msgType == "image" || msgType == "audio" || msgType == "video") && media == "" {
+	if (msgType == "image" || msgType == "audio" || msgType == "video" || msgType == "file") && media == "" {
 		return "", fmt.Errorf("media path/url is required for %s message", msgType)
 	}
-	
+
 	if msgType == "text" && content == "" {
 		return "", fmt.Errorf("content is required for text message")
 	}
 
-	channel := t.DefaultChannel
+	originChannel, originChatID := turnOrigin(ctx)
+	channel := originChannel
 	if c, ok := args["channel"].(string); ok && c != "" {
 		channel = c
 	}
 
-	chatID := t.DefaultChatID
+	chatID := originChatID
 	if c, ok := args["chat_id"].(string); ok && c != "" {
 		chatID = c
 	}
@@ -104,16 +127,51 @@ func (t *MessageTool) Execute(args map[string]interface{}) (string, error) {
 		return "Error: Message bus not configured", nil
 	}
 
+	var deliverAt time.Time
+	if at, _ := args["deliver_at"].(string); at != "" {
+		var err error
+		if deliverAt, err = parseDeliverAt(at); err != nil {
+			return "Error: " + err.Error(), nil
+		}
+		if !deliverAt.After(time.Now()) {
+			return fmt.Sprintf("Error: deliver_at %s is in the past", deliverAt.Format(time.RFC3339)), nil
+		}
+	}
+
 	msg := bus.OutboundMessage{
-		Channel: channel,
-		ChatID:  chatID,
-		Content: content,
-		Type:    bus.MessageType(msgType),
-		Media:   media,
+		Channel:   channel,
+		ChatID:    chatID,
+		Content:   content,
+		Type:      bus.MessageType(msgType),
+		Media:     media,
+		DeliverAt: deliverAt,
+	}
+
+	// Scheduled turns have no one to approve a draft, so they send directly
+	otherChat := channel != originChannel || chatID != originChatID
+	if t.Drafts != nil && otherChat && originChannel != "" && originChannel != "cron" {
+		return t.Drafts.Hold(originChannel, originChatID, msg), nil
 	}
 
 	// We publish directly to outbound
 	t.Bus.PublishOutbound(msg)
 
+	if !deliverAt.IsZero() {
+		return fmt.Sprintf("Message (%s) scheduled for %s to %s:%s", msgType, deliverAt.Format("2006-01-02 15:04 MST"), channel, chatID), nil
+	}
 	return fmt.Sprintf("Message (%s) sent to %s:%s", msgType, channel, chatID), nil
 }
+
+// parseDeliverAt parses a delivery time as RFC 3339 or as a local date
+// and time.
+func parseDeliverAt(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid deliver_at %q, expected RFC 3339 or YYYY-MM-DD HH:MM", s)
+}
@@ -0,0 +1,215 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+)
+
+// maxOCRImage bounds the size of an image read by the ocr tool.
+const maxOCRImage = 20 * 1024 * 1024
+
+// ocrClient downloads image URLs, only from public addresses.
+var ocrClient = &http.Client{Timeout: 30 * time.Second, Transport: PublicOnlyTransport()}
+
+// VisionOCR asks a vision model for the text in an image.
+type VisionOCR func(ctx context.Context, mimeType string, image []byte) (string, error)
+
+// OCRTool extracts the text of an image, such as a screenshot, receipt or
+// photographed document, with Tesseract or else a vision model.
+type OCRTool struct {
+	BaseTool
+	// Tesseract is the tesseract executable; empty when not installed.
+	Tesseract string
+	// Languages are Tesseract's language codes, e.g. "eng+chi_sim".
+	Languages string
+	// Vision, if set, reads images Tesseract cannot or when it is missing.
+	Vision  VisionOCR
+	Timeout time.Duration
+}
+
+func (t *OCRTool) Name() string {
+	return "ocr"
+}
+
+func (t *OCRTool) Description() string {
+	return "Extract the text of an image (screenshot, photo of a document, receipt) at a file path or URL, to quote or process it exactly."
+}
+
+func (t *OCRTool) ToSchema() map[string]interface{} {
+	return GenerateSchema(t)
+}
+
+func (t *OCRTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Path or http(s) URL of the image",
+			},
+			"engine": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"auto", "tesseract", "vision"},
+				"default":     "auto",
+				"description": "auto uses Tesseract when installed and the vision model when Tesseract finds no text",
+			},
+			"lang": map[string]interface{}{
+				"type":        "string",
+				"description": "Tesseract languages, e.g. eng, deu or eng+chi_sim (default from config)",
+			},
+		},
+		"required": []string{"path"},
+	}
+}
+
+func (t *OCRTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		return "", fmt.Errorf("path must be a string")
+	}
+	engine, _ := args["engine"].(string)
+	if engine == "" {
+		engine = "auto"
+	}
+	lang, _ := args["lang"].(string)
+	if lang == "" {
+		lang = t.Languages
+	}
+
+	switch engine {
+	case "tesseract":
+		if t.Tesseract == "" {
+			return "Error: Tesseract is not installed; use engine vision", nil
+		}
+	case "vision":
+		if t.Vision == nil {
+			return "Error: no vision model is configured for OCR; use engine tesseract", nil
+		}
+	case "auto":
+		if t.Tesseract == "" && t.Vision == nil {
+			return "Error: OCR is not available: install Tesseract or configure a vision model", nil
+		}
+	default:
+		return fmt.Sprintf("Error: unknown engine %q, use auto, tesseract or vision", engine), nil
+	}
+
+	image, err := readImage(ctx, path)
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	mimeType := http.DetectContentType(image)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return fmt.Sprintf("Error: %s is not an image (%s)", path, mimeType), nil
+	}
+
+	var tessErr error
+	if engine != "vision" && t.Tesseract != "" {
+		text, err := t.tesseract(ctx, image, lang)
+		switch {
+		case err == nil && text != "":
+			return ocrResult("tesseract", text), nil
+		case engine == "tesseract" && err != nil:
+			return fmt.Sprintf("Error: %v", err), nil
+		case engine == "tesseract" || t.Vision == nil:
+			if err != nil {
+				return fmt.Sprintf("Error: %v", err), nil
+			}
+			return "No text found in the image.", nil
+		}
+		tessErr = err
+	}
+
+	text, err := t.Vision(ctx, mimeType, image)
+	if err != nil {
+		if tessErr != nil {
+			return fmt.Sprintf("Error: tesseract: %v; vision model: %v", tessErr, err), nil
+		}
+		return fmt.Sprintf("Error: vision model: %v", err), nil
+	}
+	if text == "" {
+		return "No text found in the image.", nil
+	}
+	return ocrResult("vision", text), nil
+}
+
+// tesseract runs Tesseract on the image, passed on stdin so encrypted
+// workspace files never reach the disk in the clear.
+func (t *OCRTool) tesseract(ctx context.Context, image []byte, lang string) (string, error) {
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := []string{"stdin", "stdout"}
+	if lang != "" {
+		args = append(args, "-l", lang)
+	}
+	cmd := exec.CommandContext(ctx, t.Tesseract, args...)
+	killOnCancel(cmd)
+	cmd.Stdin = bytes.NewReader(image)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("tesseract timed out after %s", timeout)
+		}
+		return "", fmt.Errorf("tesseract failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// readImage reads a local image, encrypted at rest or not, or downloads
+// one from a public URL.
+func readImage(ctx context.Context, path string) ([]byte, error) {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		req, err := http.NewRequestWithContext(ctx, "GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := ocrClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to download %s: %s", path, resp.Status)
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxOCRImage+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxOCRImage {
+			return nil, fmt.Errorf("image exceeds %d bytes", maxOCRImage)
+		}
+		return data, nil
+	}
+	path = expandPath(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("file not found: %s", path)
+		}
+		return nil, err
+	}
+	if info.Size() > maxOCRImage {
+		return nil, fmt.Errorf("image exceeds %d bytes", maxOCRImage)
+	}
+	return atrest.ReadFile(path)
+}
+
+func ocrResult(engine, text string) string {
+	return fmt.Sprintf("Text extracted with %s:\n\n%s", engine, text)
+}
@@ -0,0 +1,14 @@
+//go:build windows
+
+package tools
+
+import (
+	"os/exec"
+	"time"
+)
+
+// killOnCancel stops waiting for cmd's output shortly after its context
+// ends; children it started may outlive it.
+func killOnCancel(cmd *exec.Cmd) {
+	cmd.WaitDelay = 5 * time.Second
+}
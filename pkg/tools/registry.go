@@ -1,13 +1,18 @@
 package tools
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 // Tool represents an agent tool.
 type Tool interface {
 	Name() string
 	Description() string
 	Parameters() map[string]interface{}
-	Execute(args map[string]interface{}) (string, error)
+	// Execute runs the tool. ctx carries the turn's deadline and is
+	// cancelled when the turn is aborted; tools doing slow I/O stop then.
+	Execute(ctx context.Context, args map[string]interface{}) (string, error)
 	ToSchema() map[string]interface{}
 }
 
@@ -49,13 +54,28 @@ func (r *Registry) Get(name string) (Tool, bool) {
 	return tool, ok
 }
 
-// Execute executes a tool by name with arguments.
-func (r *Registry) Execute(name string, args map[string]interface{}) (string, error) {
+// Execute executes a tool by name with arguments. Tools stop early,
+// where they can, when ctx is done.
+func (r *Registry) Execute(ctx context.Context, name string, args map[string]interface{}) (string, error) {
 	tool, ok := r.tools[name]
 	if !ok {
 		return "", fmt.Errorf("tool not found: %s", name)
 	}
-	return tool.Execute(args)
+	return tool.Execute(ctx, args)
+}
+
+// Unregister removes a tool from the registry.
+func (r *Registry) Unregister(name string) {
+	delete(r.tools, name)
+}
+
+// Names returns the names of the registered tools.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	return names
 }
 
 // GetDefinitions returns the schema definitions for all registered tools.
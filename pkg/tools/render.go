@@ -0,0 +1,111 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/config"
+)
+
+// browserCandidates are the Chrome and Chromium executables looked up on
+// the PATH when no browser is configured.
+var browserCandidates = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome", "microsoft-edge"}
+
+// PageRenderer loads pages in a headless Chrome or Chromium to get the
+// HTML that their JavaScript builds.
+type PageRenderer struct {
+	Browser string
+	Timeout time.Duration
+	// MinChars is the least text a fetched page must have to be used
+	// without rendering.
+	MinChars int
+}
+
+// NewPageRenderer returns a renderer using the configured browser, or the
+// first one found on the PATH, or nil when rendering is off, no browser is
+// installed or nanobot runs as root, where Chrome's sandbox cannot run.
+func NewPageRenderer(cfg config.RenderConfig) *PageRenderer {
+	if !cfg.Enabled {
+		return nil
+	}
+	if os.Geteuid() == 0 {
+		log.Printf("JavaScript rendering disabled: Chrome's sandbox does not run as root; run nanobot as another user")
+		return nil
+	}
+	browser := cfg.Browser
+	if browser == "" {
+		for _, name := range browserCandidates {
+			if path, err := exec.LookPath(name); err == nil {
+				browser = path
+				break
+			}
+		}
+	}
+	if browser == "" {
+		return nil
+	}
+	r := &PageRenderer{
+		Browser:  browser,
+		Timeout:  time.Duration(cfg.Timeout) * time.Second,
+		MinChars: cfg.MinChars,
+	}
+	if r.Timeout <= 0 {
+		r.Timeout = 30 * time.Second
+	}
+	return r
+}
+
+// Render returns the DOM of the page at url after its scripts ran.
+func (r *PageRenderer) Render(ctx context.Context, url string) (string, error) {
+	// Remote pages are never loaded without Chrome's sandbox
+	if os.Geteuid() == 0 {
+		return "", fmt.Errorf("refusing to render as root")
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	args := []string{
+		"--headless",
+		"--disable-gpu",
+		"--hide-scrollbars",
+		"--mute-audio",
+		"--virtual-time-budget=10000",
+		"--dump-dom",
+	}
+	cmd := exec.CommandContext(ctx, r.Browser, append(args, url)...)
+	killOnCancel(cmd)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("rendering timed out after %s", r.Timeout)
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > 300 {
+			msg = msg[len(msg)-300:]
+		}
+		return "", fmt.Errorf("browser failed: %v: %s", err, msg)
+	}
+	return stdout.String(), nil
+}
+
+// needsRendering reports whether a page fetched as html is an empty
+// shell that scripts fill in, going by its visible text.
+func (r *PageRenderer) needsRendering(html, text string) bool {
+	minChars := r.MinChars
+	if minChars <= 0 {
+		minChars = 200
+	}
+	text = strings.TrimSpace(text)
+	if len(text) < 1000 && strings.Contains(strings.ToLower(text), "enable javascript") {
+		return true
+	}
+	return len(text) < minChars && strings.Contains(strings.ToLower(html), "<script")
+}
@@ -0,0 +1,73 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+)
+
+// ResearchManager starts deep research tasks.
+type ResearchManager interface {
+	SpawnResearch(topic, label, originChannel, originChatID string) string
+}
+
+// ResearchTool starts a deep research task that reports back with a Markdown file.
+type ResearchTool struct {
+	BaseTool
+	Manager       ResearchManager
+	OriginChannel string
+	OriginChatID  string
+}
+
+// NewResearchTool creates a new ResearchTool.
+func NewResearchTool(manager ResearchManager) *ResearchTool {
+	return &ResearchTool{
+		Manager:       manager,
+		OriginChannel: "cli",
+		OriginChatID:  "direct",
+	}
+}
+
+// SetContext sets the chat the report is sent to.
+func (t *ResearchTool) SetContext(channel, chatID string) {
+	t.OriginChannel = channel
+	t.OriginChatID = chatID
+}
+
+func (t *ResearchTool) Name() string {
+	return "research"
+}
+
+func (t *ResearchTool) Description() string {
+	return "Start in-depth research on a topic in the background. It plans sections, searches and reads the web for each, and sends the user a Markdown report as a file; this can take many minutes and continues after a restart. Use it for requests for a report, comparison or literature review, not for quick questions."
+}
+
+func (t *ResearchTool) ToSchema() map[string]interface{} {
+	return GenerateSchema(t)
+}
+
+func (t *ResearchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"topic": map[string]interface{}{
+				"type":        "string",
+				"description": "What to research, with any scope, audience or questions the user gave",
+			},
+			"label": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional short title for the report",
+			},
+		},
+		"required": []string{"topic"},
+	}
+}
+
+func (t *ResearchTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	topic, ok := args["topic"].(string)
+	if !ok || topic == "" {
+		return "", fmt.Errorf("topic must be a non-empty string")
+	}
+	label, _ := args["label"].(string)
+
+	return t.Manager.SpawnResearch(topic, label, t.OriginChannel, t.OriginChatID), nil
+}
@@ -20,6 +20,23 @@ type ExecTool struct {
 	RestrictToWorkspace bool
 	DenyPatterns        []string
 	AllowPatterns       []string
+	Encodings           []string // Legacy encodings converted to UTF-8; nil keeps raw output
+}
+
+type credentialsKey struct{}
+
+// WithCredentials returns a context whose commands get env, the requesting
+// user's secrets by environment variable; an empty value removes the
+// variable. Turns run at the same time share the tool, so each carries its
+// own user's secrets this way.
+func WithCredentials(ctx context.Context, env map[string]string) context.Context {
+	return context.WithValue(ctx, credentialsKey{}, env)
+}
+
+// credentials returns the secrets set with WithCredentials.
+func credentials(ctx context.Context) map[string]string {
+	env, _ := ctx.Value(credentialsKey{}).(map[string]string)
+	return env
 }
 
 // NewExecTool creates a new ExecTool.
@@ -68,12 +85,21 @@ func (t *ExecTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Optional working directory for the command",
 			},
+			"env": map[string]interface{}{
+				"type":                 "object",
+				"description":          "Optional environment variables for this command only, e.g. {\"API_TOKEN\": \"...\"}",
+				"additionalProperties": map[string]interface{}{"type": "string"},
+			},
+			"stdin": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional data written to the command's standard input",
+			},
 		},
 		"required": []string{"command"},
 	}
 }
 
-func (t *ExecTool) Execute(args map[string]interface{}) (string, error) {
+func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	command, ok := args["command"].(string)
 	if !ok {
 		return "", fmt.Errorf("command must be a string")
@@ -81,30 +107,72 @@ func (t *ExecTool) Execute(args map[string]interface{}) (string, error) {
 
 	workingDir := t.WorkingDir
 	if wd, ok := args["working_dir"].(string); ok && wd != "" {
+		// A relative working_dir is taken from the tool's own
+		if !filepath.IsAbs(wd) && t.WorkingDir != "" {
+			wd = filepath.Join(t.WorkingDir, wd)
+		}
 		workingDir = wd
 	}
+
+	env, _ := args["env"].(map[string]interface{})
+	stdin, _ := args["stdin"].(string)
+
+	result, _ := t.run(ctx, command, workingDir, env, stdin)
+	return result, nil
+}
+
+// RunCommand runs a command in the tool's working directory with its safety
+// guard and timeout. It returns the output and an error if the command was
+// blocked, timed out or exited non-zero.
+func (t *ExecTool) RunCommand(command string) (string, error) {
+	return t.run(context.Background(), command, t.WorkingDir, nil, "")
+}
+
+// run executes a command and returns the formatted result for the model,
+// along with an error describing any failure.
+func (t *ExecTool) run(ctx context.Context, command, workingDir string, env map[string]interface{}, stdin string) (string, error) {
 	if workingDir == "" {
 		workingDir, _ = os.Getwd()
 	}
 
 	if err := t.guardCommand(command, workingDir); err != nil {
-		return err.Error(), nil
+		return err.Error(), err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(t.Timeout)*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(t.Timeout)*time.Second)
 	defer cancel()
 
 	cmd := exec.CommandContext(ctx, "bash", "-c", command)
 	cmd.Dir = workingDir
+	killOnCancel(cmd)
+
+	if creds := credentials(ctx); len(creds) > 0 {
+		cmd.Env = credentialEnv(os.Environ(), creds)
+	}
+	if len(env) > 0 {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		for key, value := range env {
+			if key == "" || strings.ContainsAny(key, "=\x00") {
+				msg := fmt.Sprintf("Error: Invalid environment variable name: %q", key)
+				return msg, fmt.Errorf("%s", msg)
+			}
+			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%v", key, value))
+		}
+	}
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
 	err := cmd.Run()
-	
-	output := stdout.String()
-	errOutput := stderr.String()
+
+	output := DecodeText(stdout.Bytes(), t.Encodings)
+	errOutput := DecodeText(stderr.Bytes(), t.Encodings)
 
 	var result strings.Builder
 	if output != "" {
@@ -118,14 +186,20 @@ func (t *ExecTool) Execute(args map[string]interface{}) (string, error) {
 	}
 
 	if ctx.Err() == context.DeadlineExceeded {
-		return fmt.Sprintf("Error: Command timed out after %d seconds", t.Timeout), nil
+		msg := fmt.Sprintf("Error: Command timed out after %d seconds", t.Timeout)
+		return msg, fmt.Errorf("command timed out after %d seconds", t.Timeout)
+	}
+	if ctx.Err() == context.Canceled {
+		return "Error: Command was stopped because the turn ended", ctx.Err()
 	}
 
+	var runErr error
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			result.WriteString(fmt.Sprintf("\nExit code: %d", exitErr.ExitCode()))
+			runErr = fmt.Errorf("command exited with code %d", exitErr.ExitCode())
 		} else {
-			return fmt.Sprintf("Error executing command: %v", err), nil
+			return fmt.Sprintf("Error executing command: %v", err), err
 		}
 	}
 
@@ -140,7 +214,26 @@ func (t *ExecTool) Execute(args map[string]interface{}) (string, error) {
 		resStr = resStr[:maxLen] + fmt.Sprintf("\n... (truncated, %d more chars)", len(resStr)-maxLen)
 	}
 
-	return resStr, nil
+	return resStr, runErr
+}
+
+// RedactArgs returns a copy of tool arguments safe for logging, with the
+// values of exec environment variables masked.
+func RedactArgs(args map[string]interface{}) map[string]interface{} {
+	env, ok := args["env"].(map[string]interface{})
+	if !ok {
+		return args
+	}
+	masked := make(map[string]interface{}, len(env))
+	for key := range env {
+		masked[key] = "***"
+	}
+	out := make(map[string]interface{}, len(args))
+	for key, value := range args {
+		out[key] = value
+	}
+	out["env"] = masked
+	return out
 }
 
 func (t *ExecTool) guardCommand(command, cwd string) error {
@@ -171,18 +264,77 @@ func (t *ExecTool) guardCommand(command, cwd string) error {
 			return fmt.Errorf("Error: Command blocked by safety guard (path traversal detected)")
 		}
 
-		absCwd, err := filepath.Abs(cwd)
-		if err != nil {
-			return err
+		root := t.WorkingDir
+		if root == "" {
+			root, _ = os.Getwd()
+		}
+		if !withinDir(root, cwd) {
+			return fmt.Errorf("Error: Working directory %s is outside the workspace", cwd)
+		}
+		// Shell parsing is out of reach, but absolute paths written out in
+		// the command are easy to spot
+		for _, m := range absPathPattern.FindAllStringSubmatch(cmd, -1) {
+			path := m[1]
+			if strings.HasPrefix(path, "~") {
+				return fmt.Errorf("Error: Command blocked by safety guard (path outside the workspace: %s)", path)
+			}
+			if !harmlessPaths[path] && !withinDir(root, path) {
+				return fmt.Errorf("Error: Command blocked by safety guard (path outside the workspace: %s)", path)
+			}
 		}
-
-		// Simple check for paths in command - simplistic regex
-		// Real path guarding is hard without full shell parsing
-		// Here we just check if CWD is safe (assuming CWD is workspace)
-		// and simplistic checks for paths
-		// For now, let's rely on CWD being set to workspace by AgentLoop
-		_ = absCwd
 	}
 
 	return nil
 }
+
+// absPathPattern matches absolute paths, and paths from the home directory,
+// that start a word of a command: /etc/passwd, ~/.ssh, >/var/log/x or
+// C:\Windows, but not the path part of a URL or of src/main.go.
+var absPathPattern = regexp.MustCompile(`(?:^|[\s"'=<>|;&(])(~[^\s"'|;&<>()]*|/[^\s"'|;&<>()]*|[A-Za-z]:\\[^\s"'|;&<>()]*)`)
+
+// harmlessPaths are absolute paths commands may use in a restricted
+// workspace.
+var harmlessPaths = map[string]bool{
+	"/dev/null":   true,
+	"/dev/stdin":  true,
+	"/dev/stdout": true,
+	"/dev/stderr": true,
+}
+
+// withinDir reports whether path is root or inside it, after resolving
+// symbolic links where the paths exist.
+func withinDir(root, path string) bool {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return false
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path = filepath.Clean(path)
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	r, err := filepath.Rel(root, path)
+	return err == nil && r != ".." && !strings.HasPrefix(r, ".."+string(filepath.Separator))
+}
+
+// credentialEnv replaces the credential variables in environ.
+func credentialEnv(environ []string, credentials map[string]string) []string {
+	env := make([]string, 0, len(environ)+len(credentials))
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, ok := credentials[name]; !ok {
+			env = append(env, kv)
+		}
+	}
+	for name, value := range credentials {
+		if value != "" {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
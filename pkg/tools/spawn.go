@@ -1,12 +1,14 @@
 package tools
 
 import (
+	"context"
 	"fmt"
+	"strings"
 )
 
 // SubagentManagerInterface defines the interface for subagent manager.
 type SubagentManagerInterface interface {
-	Spawn(task, label, originChannel, originChatID string) string
+	Spawn(task, label, model, originChannel, originChatID string) string
 }
 
 // SpawnTool spawns a subagent.
@@ -15,6 +17,8 @@ type SpawnTool struct {
 	Manager       SubagentManagerInterface
 	OriginChannel string
 	OriginChatID  string
+	// ModelAliases are the configured model aliases offered for the model parameter.
+	ModelAliases []string
 }
 
 // NewSpawnTool creates a new SpawnTool.
@@ -45,6 +49,10 @@ func (t *SpawnTool) ToSchema() map[string]interface{} {
 }
 
 func (t *SpawnTool) Parameters() map[string]interface{} {
+	modelDesc := "Optional model for the subagent; defaults to your own model"
+	if len(t.ModelAliases) > 0 {
+		modelDesc += ". Configured aliases: " + strings.Join(t.ModelAliases, ", ")
+	}
 	return map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
@@ -56,17 +64,22 @@ func (t *SpawnTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Optional short label for the task (for display)",
 			},
+			"model": map[string]interface{}{
+				"type":        "string",
+				"description": modelDesc,
+			},
 		},
 		"required": []string{"task"},
 	}
 }
 
-func (t *SpawnTool) Execute(args map[string]interface{}) (string, error) {
+func (t *SpawnTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	task, ok := args["task"].(string)
 	if !ok {
 		return "", fmt.Errorf("task must be a string")
 	}
 	label, _ := args["label"].(string)
+	model, _ := args["model"].(string)
 
-	return t.Manager.Spawn(task, label, t.OriginChannel, t.OriginChatID), nil
+	return t.Manager.Spawn(task, label, model, t.OriginChannel, t.OriginChatID), nil
 }
@@ -0,0 +1,284 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TestFailure is one failing test (or build error) found in test output.
+type TestFailure struct {
+	Package string
+	Test    string
+	File    string // path:line when known
+	Message string
+}
+
+func (f TestFailure) String() string {
+	var sb strings.Builder
+	sb.WriteString(f.Test)
+	if f.Package != "" {
+		sb.WriteString(" in " + f.Package)
+	}
+	if f.File != "" {
+		sb.WriteString(" (" + f.File + ")")
+	}
+	if f.Message != "" {
+		sb.WriteString("\n   " + strings.ReplaceAll(f.Message, "\n", "\n   "))
+	}
+	return sb.String()
+}
+
+// maxFailureMessageLines caps the message kept per failure.
+const maxFailureMessageLines = 6
+
+// testRunner names the test framework a command runs, to pick a parser.
+func testRunner(command string) string {
+	switch {
+	case strings.Contains(command, "go test"):
+		return "go"
+	case strings.Contains(command, "pytest"):
+		return "pytest"
+	case strings.Contains(command, "cargo test"):
+		return "cargo"
+	case strings.Contains(command, "npm"), strings.Contains(command, "yarn"), strings.Contains(command, "jest"), strings.Contains(command, "vitest"):
+		return "jest"
+	}
+	return ""
+}
+
+// parseTestFailures extracts failures from the output of runner.
+func parseTestFailures(runner, output string) []TestFailure {
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	switch runner {
+	case "go":
+		return parseGoTest(lines)
+	case "pytest":
+		return parsePytest(lines)
+	case "cargo":
+		return parseCargoTest(lines)
+	case "jest":
+		return parseJest(lines)
+	}
+	return nil
+}
+
+var (
+	reGoFail       = regexp.MustCompile(`^\s*--- FAIL: (\S+)`)
+	reGoLocation   = regexp.MustCompile(`^\s+(\S+\.go:\d+): ?(.*)$`)
+	reGoPackage    = regexp.MustCompile(`^(?:FAIL|ok)\s+(\S+)`)
+	reGoBuildPkg   = regexp.MustCompile(`^# (\S+)`)
+	reGoBuildError = regexp.MustCompile(`^(\S+\.go:\d+(?::\d+)?): (.*)$`)
+	reGoPanic      = regexp.MustCompile(`^panic: (.*)$`)
+	reGoStackFrame = regexp.MustCompile(`^\t(\S+\.go:\d+)`)
+)
+
+func parseGoTest(lines []string) []TestFailure {
+	var failures []TestFailure
+	pending := 0 // failures not yet assigned a package
+	buildPkg := ""
+	current := -1 // index of the failure that indented lines belong to
+	addMessage := func(text string) {
+		appendMessage(&failures[current], text)
+	}
+
+	for _, line := range lines {
+		switch {
+		case reGoFail.MatchString(line):
+			failures = append(failures, TestFailure{Test: reGoFail.FindStringSubmatch(line)[1]})
+			current = len(failures) - 1
+			pending++
+		case reGoPackage.MatchString(line):
+			pkg := reGoPackage.FindStringSubmatch(line)[1]
+			for i := len(failures) - pending; i < len(failures); i++ {
+				failures[i].Package = pkg
+			}
+			pending, current, buildPkg = 0, -1, ""
+		case reGoBuildPkg.MatchString(line):
+			buildPkg = reGoBuildPkg.FindStringSubmatch(line)[1]
+			current = -1
+		case buildPkg != "" && reGoBuildError.MatchString(line):
+			m := reGoBuildError.FindStringSubmatch(line)
+			failures = append(failures, TestFailure{Package: buildPkg, Test: "build failed", File: m[1], Message: m[2]})
+			current = -1
+		case reGoPanic.MatchString(line):
+			msg := "panic: " + reGoPanic.FindStringSubmatch(line)[1]
+			if current >= 0 && failures[current].Message == "" {
+				// The test that panicked was just reported failing
+				failures[current].Message = msg
+				break
+			}
+			failures = append(failures, TestFailure{Test: "panic", Message: msg})
+			current = len(failures) - 1
+			pending++
+		case current >= 0 && reGoStackFrame.MatchString(line):
+			// The first frame outside the runtime and testing packages is where it panicked
+			frame := reGoStackFrame.FindStringSubmatch(line)[1]
+			if failures[current].File == "" && !strings.Contains(frame, "/src/runtime/") && !strings.Contains(frame, "/src/testing/") {
+				failures[current].File = frame
+			}
+		case current >= 0 && reGoLocation.MatchString(line):
+			m := reGoLocation.FindStringSubmatch(line)
+			if failures[current].File == "" {
+				failures[current].File = m[1]
+			}
+			addMessage(m[2])
+		case current >= 0 && strings.HasPrefix(line, "    ") && strings.TrimSpace(line) != "":
+			addMessage(strings.TrimSpace(line))
+		}
+	}
+	return failures
+}
+
+var (
+	rePytestSummary  = regexp.MustCompile(`^(FAILED|ERROR) (\S+?)(?:::(\S+))?(?: - (.*))?$`)
+	rePytestLocation = regexp.MustCompile(`^(\S+\.py):(\d+): `)
+)
+
+func parsePytest(lines []string) []TestFailure {
+	var failures []TestFailure
+	locations := map[string]string{} // file -> last path:line seen in tracebacks
+	for _, line := range lines {
+		if m := rePytestLocation.FindStringSubmatch(line); m != nil {
+			locations[m[1]] = m[1] + ":" + m[2]
+		}
+		m := rePytestSummary.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		f := TestFailure{File: m[2], Test: m[3], Message: m[4]}
+		if f.Test == "" {
+			f.Test = strings.ToLower(m[1])
+		}
+		if loc, ok := locations[m[2]]; ok {
+			f.File = loc
+		}
+		failures = append(failures, f)
+	}
+	return failures
+}
+
+var (
+	reCargoFail  = regexp.MustCompile(`^---- (\S+) stdout ----$`)
+	reCargoPanic = regexp.MustCompile(`panicked at (?:'[^']*', )?(\S+:\d+:\d+):?`)
+)
+
+func parseCargoTest(lines []string) []TestFailure {
+	var failures []TestFailure
+	current := -1
+	for _, line := range lines {
+		if m := reCargoFail.FindStringSubmatch(line); m != nil {
+			failures = append(failures, TestFailure{Test: m[1]})
+			current = len(failures) - 1
+			continue
+		}
+		if current < 0 {
+			continue
+		}
+		f := &failures[current]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "note:") || strings.HasPrefix(line, "failures:"):
+			if f.Message != "" {
+				current = -1
+			}
+		case reCargoPanic.MatchString(line):
+			f.File = reCargoPanic.FindStringSubmatch(line)[1]
+		default:
+			appendMessage(f, trimmed)
+		}
+	}
+	return failures
+}
+
+var (
+	reJestFail     = regexp.MustCompile(`^\s*● (.+)$`)
+	reJestLocation = regexp.MustCompile(`\(([^()\s]+:\d+):\d+\)`)
+)
+
+func parseJest(lines []string) []TestFailure {
+	var failures []TestFailure
+	current := -1
+	for _, line := range lines {
+		if m := reJestFail.FindStringSubmatch(line); m != nil {
+			current = -1
+			if !strings.HasPrefix(m[1], "Console") {
+				failures = append(failures, TestFailure{Test: m[1]})
+				current = len(failures) - 1
+			}
+			continue
+		}
+		if current < 0 {
+			continue
+		}
+		f := &failures[current]
+		trimmed := strings.TrimSpace(line)
+		if m := reJestLocation.FindStringSubmatch(line); m != nil && strings.HasPrefix(trimmed, "at ") {
+			if f.File == "" && !strings.Contains(m[1], "node_modules") {
+				f.File = m[1]
+			}
+			continue
+		}
+		if trimmed != "" && f.File == "" {
+			appendMessage(f, trimmed)
+		}
+	}
+	return failures
+}
+
+// appendMessage adds a line to a failure's message, up to maxFailureMessageLines.
+func appendMessage(f *TestFailure, text string) {
+	if text == "" || f.Message != "" && strings.Count(f.Message, "\n") >= maxFailureMessageLines-1 {
+		return
+	}
+	if f.Message != "" {
+		f.Message += "\n"
+	}
+	f.Message += text
+}
+
+// noiseLine reports whether a line of test output carries no information
+// about failures, such as per-test progress and passing packages.
+func noiseLine(runner, line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" {
+		return true
+	}
+	switch runner {
+	case "go":
+		return strings.HasPrefix(trimmed, "=== RUN") || strings.HasPrefix(trimmed, "=== PAUSE") ||
+			strings.HasPrefix(trimmed, "=== CONT") || strings.HasPrefix(trimmed, "--- PASS") ||
+			strings.HasPrefix(trimmed, "--- SKIP") || strings.HasPrefix(line, "ok  ") ||
+			strings.HasPrefix(line, "?   ") || trimmed == "PASS"
+	case "pytest":
+		return strings.Trim(trimmed, ".sxXF%[] 0123456789") == "" || strings.HasPrefix(trimmed, "PASSED")
+	case "cargo":
+		return strings.HasSuffix(trimmed, "... ok") || strings.HasPrefix(trimmed, "Compiling ") ||
+			strings.HasPrefix(trimmed, "Running ")
+	case "jest":
+		return strings.HasPrefix(trimmed, "✓") || strings.HasPrefix(trimmed, "PASS ")
+	}
+	return false
+}
+
+// summarizeTestOutput removes noise lines and keeps at most maxChars of the
+// end of what is left.
+func summarizeTestOutput(runner, output string, maxChars int) string {
+	var kept []string
+	dropped := 0
+	for _, line := range strings.Split(output, "\n") {
+		if noiseLine(runner, line) {
+			dropped++
+			continue
+		}
+		kept = append(kept, line)
+	}
+	out := strings.Join(kept, "\n")
+	if len(out) > maxChars {
+		out = fmt.Sprintf("... (%d bytes omitted)\n%s", len(out)-maxChars, out[len(out)-maxChars:])
+	}
+	if dropped > 0 && runner != "" {
+		out += fmt.Sprintf("\n(%d progress/passing lines omitted)", dropped)
+	}
+	return strings.TrimSpace(out)
+}
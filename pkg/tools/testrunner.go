@@ -0,0 +1,169 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxListedFailures caps the failures listed in a run_tests result.
+const maxListedFailures = 20
+
+// RunTestsTool runs a project's tests and reports failures in a
+// structured form instead of the raw output.
+type RunTestsTool struct {
+	BaseTool
+	Repo    string // Directory searched for the project; relative paths are resolved against it
+	Command string // e.g. "go test ./..."; detected from the project files when empty
+	Timeout time.Duration
+	// Restrict limits the project path to Repo.
+	Restrict bool
+}
+
+func (t *RunTestsTool) Name() string {
+	return "run_tests"
+}
+
+func (t *RunTestsTool) Description() string {
+	return "Run a project's tests (go test, pytest, npm test or cargo test, detected from the project files) and return a summary of the failures with file, test name and message. Optionally pass a target (package, directory or test file) to run a subset."
+}
+
+func (t *RunTestsTool) ToSchema() map[string]interface{} {
+	return GenerateSchema(t)
+}
+
+func (t *RunTestsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: project directory (default: the repository or workspace root)",
+			},
+			"target": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: package, directory or test file to run instead of everything",
+			},
+		},
+	}
+}
+
+// DetectTestCommand guesses the test command for a repository from its project files.
+func DetectTestCommand(repo string) string {
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(repo, name))
+		return err == nil
+	}
+	switch {
+	case exists("go.mod"):
+		return "go test ./..."
+	case exists("package.json"):
+		return "npm test --silent"
+	case exists("pytest.ini"), exists("pyproject.toml"), exists("setup.py"), exists("tox.ini"):
+		return "pytest -q"
+	case exists("Cargo.toml"):
+		return "cargo test"
+	}
+	return ""
+}
+
+func (t *RunTestsTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	dir := t.Repo
+	if rel, _ := args["path"].(string); rel != "" {
+		if t.Restrict {
+			p, err := repoPath(t.Repo, rel)
+			if err != nil {
+				return "Error: " + err.Error(), nil
+			}
+			dir = p
+		} else if rel = expandPath(rel); filepath.IsAbs(rel) {
+			dir = rel
+		} else {
+			dir = filepath.Join(t.Repo, rel)
+		}
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Sprintf("Error: %s is not a directory", dir), nil
+	}
+
+	command := t.Command
+	if command == "" {
+		command = DetectTestCommand(dir)
+	}
+	if command == "" {
+		return fmt.Sprintf("Error: no test command configured and no go.mod, package.json, pytest or Cargo.toml project found in %s", dir), nil
+	}
+	if target, _ := args["target"].(string); target != "" {
+		command = strings.TrimSuffix(command, " ./...")
+		if strings.HasPrefix(command, "npm ") {
+			command += " --"
+		}
+		command += " " + shellQuote(target)
+	}
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	killOnCancel(cmd)
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	runner := testRunner(command)
+	failures := parseTestFailures(runner, string(out))
+	status := "PASSED"
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		status = fmt.Sprintf("TIMED OUT after %s", timeout)
+	case ctx.Err() == context.Canceled:
+		status = "STOPPED (the turn ended)"
+	case err != nil && len(failures) > 0:
+		status = fmt.Sprintf("FAILED: %d failure(s)", len(failures))
+	case err != nil:
+		status = fmt.Sprintf("FAILED (%v)", err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("$ %s\n%s in %s\n", command, status, elapsed))
+	if len(failures) > 0 {
+		sb.WriteString("\nFailures:\n")
+		for i, f := range failures {
+			if i == maxListedFailures {
+				sb.WriteString(fmt.Sprintf("... and %d more\n", len(failures)-i))
+				break
+			}
+			sb.WriteString(fmt.Sprintf("%d. %s\n", i+1, f))
+		}
+	}
+	if err != nil || runner == "" {
+		// The parsed failures carry the detail; keep less of the raw output
+		maxChars := maxToolOutput
+		if len(failures) > 0 {
+			maxChars = 3000
+		}
+		if rest := summarizeTestOutput(runner, string(out), maxChars); rest != "" {
+			sb.WriteString("\nOutput:\n" + rest + "\n")
+		}
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+var reShellSafe = regexp.MustCompile(`^[\w@%+=:,./-]+$`)
+
+// shellQuote quotes s for sh unless it is made of safe characters only.
+func shellQuote(s string) string {
+	if reShellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
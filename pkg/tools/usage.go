@@ -0,0 +1,113 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/usage"
+)
+
+// UsageTool reports the tokens and cost of model requests, for the current
+// chat or, for admins, all of them.
+type UsageTool struct {
+	BaseTool
+	Tracker *usage.Tracker
+}
+
+// NewUsageTool creates a new UsageTool.
+func NewUsageTool(tracker *usage.Tracker) *UsageTool {
+	return &UsageTool{Tracker: tracker}
+}
+
+type sessionKeyKey struct{}
+
+// WithSession returns a context whose turn belongs to the session
+// sessionKey.
+func WithSession(ctx context.Context, sessionKey string) context.Context {
+	return context.WithValue(ctx, sessionKeyKey{}, sessionKey)
+}
+
+// sessionKey returns the session set with WithSession.
+func sessionKey(ctx context.Context) string {
+	key, _ := ctx.Value(sessionKeyKey{}).(string)
+	return key
+}
+
+func (t *UsageTool) Name() string {
+	return "usage"
+}
+
+func (t *UsageTool) Description() string {
+	return "Report model usage: requests, prompt and completion tokens and, for models with a configured price, the cost in US dollars. Covers this chat or, for admins, all chats, over a period, broken down by day, channel, session or model."
+}
+
+func (t *UsageTool) ToSchema() map[string]interface{} {
+	return GenerateSchema(t)
+}
+
+func (t *UsageTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"period": map[string]interface{}{
+				"type":        "string",
+				"description": "today (default), yesterday, <n>d for the last n days, month, or a date YYYY-MM-DD",
+			},
+			"group_by": map[string]interface{}{
+				"type":        "string",
+				"enum":        usage.Groupings,
+				"description": "Breakdown (default day)",
+			},
+			"scope": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"chat", "all"},
+				"description": "This chat (default) or all chats (admins only)",
+			},
+		},
+	}
+}
+
+func (t *UsageTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
+	period, _ := args["period"].(string)
+	first, last, err := usage.Period(period, time.Now())
+	if err != nil {
+		return fmt.Sprintf("Error: %v", err), nil
+	}
+	groupBy, _ := args["group_by"].(string)
+	if groupBy == "" {
+		groupBy = "day"
+	}
+	valid := false
+	for _, g := range usage.Groupings {
+		valid = valid || g == groupBy
+	}
+	if !valid {
+		return fmt.Sprintf("Error: group_by must be one of %s", strings.Join(usage.Groupings, ", ")), nil
+	}
+
+	scope, _ := args["scope"].(string)
+	if scope == "all" && !isAdmin(ctx) {
+		return "Error: only admins can see the usage of all chats", nil
+	}
+	session := sessionKey(ctx)
+	if scope != "all" && session == "" {
+		return "Error: no session context", nil
+	}
+
+	records, err := t.Tracker.Read(first, last)
+	if err != nil {
+		return fmt.Sprintf("Error: reading usage: %v", err), nil
+	}
+	if scope != "all" {
+		kept := records[:0]
+		for _, r := range records {
+			if r.Session == session {
+				kept = append(kept, r)
+			}
+		}
+		records = kept
+	}
+	return usage.Report(records, groupBy), nil
+}
@@ -1,13 +1,17 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -60,7 +64,7 @@ func (t *WebSearchTool) Parameters() map[string]interface{} {
 	}
 }
 
-func (t *WebSearchTool) Execute(args map[string]interface{}) (string, error) {
+func (t *WebSearchTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	if t.APIKey == "" {
 		return "Error: BRAVE_API_KEY not configured", nil
 	}
@@ -83,7 +87,7 @@ func (t *WebSearchTool) Execute(args map[string]interface{}) (string, error) {
 	}
 
 	reqURL := fmt.Sprintf("https://api.search.brave.com/res/v1/web/search?q=%s&count=%d", url.QueryEscape(query), count)
-	req, err := http.NewRequest("GET", reqURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", reqURL, nil)
 	if err != nil {
 		return "", err
 	}
@@ -141,6 +145,14 @@ func (t *WebSearchTool) Execute(args map[string]interface{}) (string, error) {
 type WebFetchTool struct {
 	BaseTool
 	MaxChars int
+	Timeout  time.Duration
+	// Renderer, if set, loads pages in a headless browser when they need
+	// JavaScript to show their content.
+	Renderer *PageRenderer
+	// PublicOnly refuses to connect to loopback, private and link-local
+	// addresses, such as a cloud metadata service, for fetches of URLs
+	// nobody reviewed.
+	PublicOnly bool
 }
 
 // NewWebFetchTool creates a new WebFetchTool.
@@ -150,6 +162,7 @@ func NewWebFetchTool(maxChars int) *WebFetchTool {
 	}
 	return &WebFetchTool{
 		MaxChars: maxChars,
+		Timeout:  30 * time.Second,
 	}
 }
 
@@ -182,12 +195,18 @@ func (t *WebFetchTool) Parameters() map[string]interface{} {
 				"type":    "integer",
 				"minimum": 100,
 			},
+			"render": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"auto", "never", "always"},
+				"default":     "auto",
+				"description": "Run the page's JavaScript in a headless browser: auto does when the page is mostly empty without it",
+			},
 		},
 		"required": []string{"url"},
 	}
 }
 
-func (t *WebFetchTool) Execute(args map[string]interface{}) (string, error) {
+func (t *WebFetchTool) Execute(ctx context.Context, args map[string]interface{}) (string, error) {
 	urlStr, ok := args["url"].(string)
 	if !ok {
 		return "", fmt.Errorf("url must be a string")
@@ -203,6 +222,14 @@ func (t *WebFetchTool) Execute(args map[string]interface{}) (string, error) {
 		maxChars = int(m)
 	}
 
+	render := "auto"
+	if r, ok := args["render"].(string); ok && r != "" {
+		render = r
+	}
+	if render == "always" && t.Renderer == nil {
+		return jsonError("JavaScript rendering is not available: enable tools.web.render, install Chrome or Chromium and run nanobot as a user other than root", urlStr)
+	}
+
 	// Validate URL
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
@@ -210,7 +237,7 @@ func (t *WebFetchTool) Execute(args map[string]interface{}) (string, error) {
 	}
 
 	client := &http.Client{
-		Timeout: 30 * time.Second,
+		Timeout: t.Timeout,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			if len(via) >= 5 {
 				return fmt.Errorf("stopped after 5 redirects")
@@ -218,8 +245,11 @@ func (t *WebFetchTool) Execute(args map[string]interface{}) (string, error) {
 			return nil
 		},
 	}
+	if t.PublicOnly {
+		client.Transport = PublicOnlyTransport()
+	}
 
-	req, err := http.NewRequest("GET", urlStr, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
 	if err != nil {
 		return jsonError(err.Error(), urlStr)
 	}
@@ -245,12 +275,22 @@ func (t *WebFetchTool) Execute(args map[string]interface{}) (string, error) {
 	} else if strings.Contains(contentType, "text/html") {
 		// Simple HTML processing
 		htmlContent := string(bodyBytes)
-		if extractMode == "markdown" {
-			text = toMarkdown(htmlContent)
-		} else {
-			text = stripTags(htmlContent)
-		}
+		text = extractHTML(htmlContent, extractMode)
 		extractor = "simple-html"
+
+		if t.Renderer != nil && (render == "always" || render == "auto" && t.Renderer.needsRendering(htmlContent, text)) {
+			rendered, err := t.Renderer.Render(ctx, resp.Request.URL.String())
+			switch {
+			case err != nil && render == "always":
+				return jsonError(err.Error(), urlStr)
+			case err != nil:
+				// Keep what the plain fetch got
+				log.Printf("web_fetch: rendering %s failed: %v", urlStr, err)
+			default:
+				text = extractHTML(rendered, extractMode)
+				extractor = "headless-browser"
+			}
+		}
 	} else {
 		text = string(bodyBytes)
 		extractor = "raw"
@@ -276,12 +316,55 @@ func (t *WebFetchTool) Execute(args map[string]interface{}) (string, error) {
 	return string(jsonResult), nil
 }
 
+// extractHTML turns a page into Markdown or plain text.
+func extractHTML(html, mode string) string {
+	if mode == "markdown" {
+		return toMarkdown(html)
+	}
+	return stripTags(html)
+}
+
 func jsonError(msg, url string) (string, error) {
 	res := map[string]string{"error": msg, "url": url}
 	b, _ := json.Marshal(res)
 	return string(b), nil
 }
 
+// PublicOnlyTransport connects directly, without a proxy, and only to
+// public addresses. The address is checked as dialed, after DNS and for
+// every redirect, so a name cannot resolve to one address when checked
+// and another when used.
+func PublicOnlyTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("refusing to connect to non-public address %s", host)
+			}
+			return nil
+		},
+	}
+	return &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, not public either.
+var _, sharedAddressSpace, _ = net.ParseCIDR("100.64.0.0/10")
+
+// publicIP reports whether ip is a public unicast address.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip))
+}
+
 // Regex compilation
 var (
 	reScript = regexp.MustCompile(`(?i)<script[\s\S]*?</script>`)
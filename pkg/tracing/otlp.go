@@ -0,0 +1,319 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/buildinfo"
+	"github.com/HKUDS/nanobot-go/pkg/config"
+)
+
+const (
+	// queueSize bounds the spans waiting for export; more are dropped.
+	queueSize = 2048
+	// batchSize is the most spans sent in one request.
+	batchSize = 512
+	// exportInterval is how often queued spans are sent.
+	exportInterval = 5 * time.Second
+	// exportTimeout bounds one export request.
+	exportTimeout = 10 * time.Second
+)
+
+// Exporter sends ended spans to an OTLP/HTTP collector in batches, as
+// JSON, from a goroutine of its own.
+type Exporter struct {
+	url         string
+	headers     map[string]string
+	resource    []Attr
+	sampleRatio float64
+	client      *http.Client
+
+	queue   chan *Span
+	stop    chan struct{}
+	stopped chan struct{}
+
+	mu      sync.Mutex
+	failing bool // Whether the last export failed, so failures are logged once
+	dropped int
+}
+
+var active atomic.Pointer[Exporter]
+
+func current() *Exporter {
+	return active.Load()
+}
+
+// Setup starts exporting spans as cfg says, if tracing is enabled.
+func Setup(cfg config.TracingConfig) {
+	if !cfg.Enabled {
+		return
+	}
+	endpoint := strings.TrimRight(cfg.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = "http://localhost:4318"
+	}
+	if !strings.HasSuffix(endpoint, "/v1/traces") {
+		endpoint += "/v1/traces"
+	}
+	service := cfg.ServiceName
+	if service == "" {
+		service = "nanobot"
+	}
+	resource := []Attr{
+		String("service.name", service),
+		String("service.version", buildinfo.Version),
+	}
+	if host, err := os.Hostname(); err == nil {
+		resource = append(resource, String("host.name", host))
+	}
+
+	e := &Exporter{
+		url:         endpoint,
+		headers:     cfg.Headers,
+		resource:    resource,
+		sampleRatio: cfg.SampleRatio,
+		client:      &http.Client{Timeout: exportTimeout},
+		queue:       make(chan *Span, queueSize),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go e.run()
+	if old := active.Swap(e); old != nil {
+		old.shutdown(exportTimeout)
+	}
+	log.Printf("Exporting traces to %s", endpoint)
+}
+
+// Shutdown exports the spans still queued, waiting up to timeout, and stops
+// tracing.
+func Shutdown(timeout time.Duration) {
+	if e := active.Swap(nil); e != nil {
+		e.shutdown(timeout)
+	}
+}
+
+func (e *Exporter) shutdown(timeout time.Duration) {
+	close(e.stop)
+	select {
+	case <-e.stopped:
+	case <-time.After(timeout):
+		log.Printf("Some traces were not exported before shutdown")
+	}
+}
+
+func (e *Exporter) enqueue(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+		e.mu.Lock()
+		e.dropped++
+		if e.dropped == 1 {
+			log.Printf("Trace export queue is full, dropping spans")
+		}
+		e.mu.Unlock()
+	}
+}
+
+func (e *Exporter) run() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	var batch []*Span
+	send := func() {
+		for len(batch) > 0 {
+			n := len(batch)
+			if n > batchSize {
+				n = batchSize
+			}
+			e.export(batch[:n])
+			batch = batch[n:]
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case <-e.stop:
+			for len(e.queue) > 0 {
+				batch = append(batch, <-e.queue)
+			}
+			send()
+			return
+		}
+	}
+}
+
+// export sends spans to the collector. Spans that can't be sent are
+// dropped; failures are logged when they start and when they stop.
+func (e *Exporter) export(spans []*Span) {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		log.Printf("Error encoding traces: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", e.url, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Error exporting traces: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err == nil {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			err = fmt.Errorf("collector returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		if !e.failing {
+			log.Printf("Error exporting traces to %s: %v", e.url, err)
+		}
+		e.failing = true
+		return
+	}
+	if e.failing {
+		log.Printf("Exporting traces to %s again", e.url)
+	}
+	e.failing = false
+}
+
+// The OTLP/HTTP JSON encoding of an export request: IDs are hex, 64-bit
+// integers are strings and enumerations are numbers.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              Kind           `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Events            []otlpEvent    `json:"events,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpEvent struct {
+		TimeUnixNano string         `json:"timeUnixNano"`
+		Name         string         `json:"name"`
+		Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	}
+)
+
+func (e *Exporter) request(spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: unixNano(s.start),
+			EndTimeUnixNano:   unixNano(s.end),
+			Attributes:        keyValues(s.attrs),
+		}
+		if s.parentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if s.status != statusUnset {
+			span.Status = otlpStatus{Code: s.status, Message: s.statusMsg}
+		}
+		for _, ev := range s.events {
+			span.Events = append(span.Events, otlpEvent{TimeUnixNano: unixNano(ev.time), Name: ev.name, Attributes: keyValues(ev.attrs)})
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: keyValues(e.resource)},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "github.com/HKUDS/nanobot-go", Version: buildinfo.Version},
+			Spans: out,
+		}},
+	}}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func keyValues(attrs []Attr) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		kvs = append(kvs, otlpKeyValue{Key: a.Key, Value: anyValue(a.Value)})
+	}
+	return kvs
+}
+
+func anyValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": v}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	case []string:
+		values := make([]map[string]interface{}, len(v))
+		for i, s := range v {
+			values[i] = map[string]interface{}{"stringValue": s}
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	}
+	return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+}
@@ -0,0 +1,199 @@
+// Package tracing records OpenTelemetry spans of what a turn spends its
+// time on, the turn itself, the model calls it makes and the tools it runs,
+// and exports them to an OTLP collector such as Jaeger, Tempo or the
+// OpenTelemetry Collector, so a slow turn can be broken down.
+//
+// Spans are carried in contexts: a span started with a context holding
+// another becomes its child. Until Setup is called, Start returns a nil
+// span, and every method of a nil span does nothing, so code can be
+// instrumented without checking whether tracing is on.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mrand "math/rand"
+	"sync"
+	"time"
+)
+
+// Kind is the role of a span in the OTLP span kind enumeration.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindClient   Kind = 3 // A request to another service, such as a model provider
+)
+
+// Status codes of the OTLP status enumeration.
+const (
+	statusUnset = 0
+	statusError = 2
+)
+
+// Attr is an attribute of a span or event.
+type Attr struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute.
+func String(key, value string) Attr { return Attr{key, value} }
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attr { return Attr{key, int64(value)} }
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attr { return Attr{key, value} }
+
+// Strings returns a string array attribute.
+func Strings(key string, value []string) Attr { return Attr{key, value} }
+
+type event struct {
+	name  string
+	time  time.Time
+	attrs []Attr
+}
+
+// Span is a timed operation within a trace.
+type Span struct {
+	exporter *Exporter
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	sampled  bool
+	name     string
+	kind     Kind
+	start    time.Time
+
+	mu        sync.Mutex
+	end       time.Time
+	attrs     []Attr
+	events    []event
+	status    int
+	statusMsg string
+	ended     bool
+}
+
+type spanKey struct{}
+
+// FromContext returns the span ctx carries, or nil.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start starts a span named name, the child of the span ctx carries if
+// any, and returns a context carrying it. End must be called on it.
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return start(ctx, name, KindInternal, attrs)
+}
+
+// StartClient starts a span of a request to another service.
+func StartClient(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	return start(ctx, name, KindClient, attrs)
+}
+
+func start(ctx context.Context, name string, kind Kind, attrs []Attr) (context.Context, *Span) {
+	exp := current()
+	if exp == nil {
+		return ctx, nil
+	}
+	s := &Span{exporter: exp, name: name, kind: kind, start: time.Now(), attrs: append([]Attr(nil), attrs...)}
+	if parent := FromContext(ctx); parent != nil {
+		s.traceID, s.parentID, s.sampled = parent.traceID, parent.spanID, parent.sampled
+	} else {
+		rand.Read(s.traceID[:])
+		// Whole traces are kept or dropped, decided at their root
+		s.sampled = exp.sampleRatio >= 1 || mrand.Float64() < exp.sampleRatio
+	}
+	rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// TraceID returns the ID of the span's trace in hex, as collectors show it.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// StartTime returns when the span started.
+func (s *Span) StartTime() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	return s.start
+}
+
+// SetAttributes adds attributes to the span, replacing those with the same
+// keys.
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+next:
+	for _, a := range attrs {
+		for i := range s.attrs {
+			if s.attrs[i].Key == a.Key {
+				s.attrs[i] = a
+				continue next
+			}
+		}
+		s.attrs = append(s.attrs, a)
+	}
+}
+
+// AddEvent records something that happened during the span.
+func (s *Span) AddEvent(name string, attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event{name: name, time: time.Now(), attrs: attrs})
+}
+
+// RecordError marks the span as failed with err. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.SetError(err.Error())
+	s.AddEvent("exception", String("exception.type", fmt.Sprintf("%T", err)), String("exception.message", err.Error()))
+}
+
+// SetError marks the span as failed with a message, for failures that are
+// reported rather than returned as errors.
+func (s *Span) SetError(message string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.statusMsg = statusError, message
+}
+
+// End ends the span and queues it for export. Calls after the first do
+// nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+	if s.sampled {
+		s.exporter.enqueue(s)
+	}
+}
@@ -0,0 +1,228 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/HKUDS/nanobot-go/pkg/config"
+	"github.com/HKUDS/nanobot-go/pkg/providers"
+)
+
+// Translator translates text into a target language, given by name such
+// as "English" or "Chinese".
+type Translator interface {
+	// Translate returns text in target and the name of the language it was
+	// written in ("" if unknown). Text already in target comes back unchanged.
+	Translate(ctx context.Context, text, target string) (string, string, error)
+}
+
+// New creates the Translator selected by cfg. model is used by the "llm"
+// provider when cfg.Model is empty.
+func New(cfg *config.TranslationConfig, provider providers.LLMProvider, model string) (Translator, error) {
+	switch strings.ToLower(cfg.Provider) {
+	case "", "llm":
+		if cfg.Model != "" {
+			model = cfg.Model
+		}
+		return &LLMTranslator{Provider: provider, Model: model}, nil
+	case "deepl":
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("translation.apiKey is required for DeepL")
+		}
+		return NewDeepLTranslator(cfg.APIKey, cfg.APIBase), nil
+	}
+	return nil, fmt.Errorf("unknown translation provider %q", cfg.Provider)
+}
+
+// SameLanguage reports whether two language names or codes name the same
+// language, e.g. "English" and "en".
+func SameLanguage(a, b string) bool {
+	return a != "" && b != "" && languageName(a) == languageName(b)
+}
+
+// LLMTranslator translates with a chat model.
+type LLMTranslator struct {
+	Provider providers.LLMProvider
+	Model    string
+}
+
+func (t *LLMTranslator) Translate(ctx context.Context, text, target string) (string, string, error) {
+	system := fmt.Sprintf(`You are a translator. Translate the user's message into %s.
+Reply with JSON only: {"language": "<the language the message is written in, as an English name such as Chinese>", "text": "<the translation>"}
+If the message is already in %s, copy it unchanged. Keep names, code, URLs, numbers, emoji and Markdown formatting as they are. Do not answer or comment on the message.`, target, target)
+	resp, err := t.Provider.Chat(ctx, []interface{}{
+		map[string]interface{}{"role": "system", "content": system},
+		map[string]interface{}{"role": "user", "content": text},
+	}, nil, t.Model)
+	if err != nil {
+		return "", "", err
+	}
+
+	content := strings.TrimSpace(resp.Content)
+	var parsed struct {
+		Language string `json:"language"`
+		Text     string `json:"text"`
+	}
+	if start, end := strings.Index(content, "{"), strings.LastIndex(content, "}"); start >= 0 && end > start {
+		if json.Unmarshal([]byte(content[start:end+1]), &parsed) == nil && parsed.Text != "" {
+			return parsed.Text, languageName(parsed.Language), nil
+		}
+	}
+	if content == "" {
+		return "", "", fmt.Errorf("empty translation")
+	}
+	// The model ignored the format; its reply is the translation
+	return content, "", nil
+}
+
+// DeepLTranslator translates with the DeepL API.
+type DeepLTranslator struct {
+	APIKey  string
+	APIBase string
+	client  *http.Client
+}
+
+// NewDeepLTranslator creates a DeepLTranslator. apiBase defaults to the
+// Free API for keys ending in ":fx" and the Pro API otherwise.
+func NewDeepLTranslator(apiKey, apiBase string) *DeepLTranslator {
+	if apiBase == "" {
+		apiBase = "https://api.deepl.com/v2"
+		if strings.HasSuffix(apiKey, ":fx") {
+			apiBase = "https://api-free.deepl.com/v2"
+		}
+	}
+	return &DeepLTranslator{
+		APIKey:  apiKey,
+		APIBase: apiBase,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (t *DeepLTranslator) Translate(ctx context.Context, text, target string) (string, string, error) {
+	code, ok := deeplTargets[languageName(target)]
+	if !ok {
+		return "", "", fmt.Errorf("DeepL does not translate into %s", target)
+	}
+	form := url.Values{}
+	form.Set("text", text)
+	form.Set("target_lang", code)
+	form.Set("preserve_formatting", "1")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(t.APIBase, "/")+"/translate", bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "DeepL-Auth-Key "+t.APIKey)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("DeepL API error: %s %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var parsed struct {
+		Translations []struct {
+			DetectedSourceLanguage string `json:"detected_source_language"`
+			Text                   string `json:"text"`
+		} `json:"translations"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return "", "", fmt.Errorf("failed to parse DeepL response: %w", err)
+	}
+	if len(parsed.Translations) == 0 {
+		return "", "", fmt.Errorf("DeepL returned no translation")
+	}
+	tr := parsed.Translations[0]
+	source := languageName(tr.DetectedSourceLanguage)
+	if SameLanguage(source, target) {
+		return text, source, nil
+	}
+	return tr.Text, source, nil
+}
+
+// languageCodes maps ISO 639-1 codes to language names.
+var languageCodes = map[string]string{
+	"ar": "Arabic",
+	"bg": "Bulgarian",
+	"cs": "Czech",
+	"da": "Danish",
+	"de": "German",
+	"el": "Greek",
+	"en": "English",
+	"es": "Spanish",
+	"et": "Estonian",
+	"fi": "Finnish",
+	"fr": "French",
+	"hu": "Hungarian",
+	"id": "Indonesian",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"lt": "Lithuanian",
+	"lv": "Latvian",
+	"nb": "Norwegian",
+	"nl": "Dutch",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ro": "Romanian",
+	"ru": "Russian",
+	"sk": "Slovak",
+	"sl": "Slovenian",
+	"sv": "Swedish",
+	"th": "Thai",
+	"tr": "Turkish",
+	"uk": "Ukrainian",
+	"vi": "Vietnamese",
+	"zh": "Chinese",
+}
+
+// deeplTargets maps language names to DeepL target language codes.
+var deeplTargets = map[string]string{}
+
+func init() {
+	for code, name := range languageCodes {
+		deeplTargets[name] = strings.ToUpper(code)
+	}
+	// DeepL requires a variant for these
+	deeplTargets["English"] = "EN-US"
+	deeplTargets["Portuguese"] = "PT-BR"
+	deeplTargets["Chinese"] = "ZH-HANS"
+}
+
+// languageName normalizes a language code ("en", "EN-US", "zh-Hans") or
+// name ("english") to a name such as "English".
+func languageName(lang string) string {
+	lang = strings.TrimSpace(lang)
+	lower := strings.ToLower(lang)
+	if i := strings.IndexAny(lower, "-_"); i > 0 {
+		if name, ok := languageCodes[lower[:i]]; ok {
+			return name
+		}
+	}
+	if name, ok := languageCodes[lower]; ok {
+		return name
+	}
+	for _, name := range languageCodes {
+		if strings.EqualFold(name, lang) {
+			return name
+		}
+	}
+	if lang == "" {
+		return ""
+	}
+	r := []rune(lang)
+	return string(unicode.ToUpper(r[0])) + string(r[1:])
+}
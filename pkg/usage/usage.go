@@ -0,0 +1,278 @@
+// Package usage keeps account of the tokens model requests use and what
+// they cost.
+package usage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
+	"github.com/HKUDS/nanobot-go/pkg/config"
+)
+
+// dayFormat names the daily usage files.
+const dayFormat = "2006-01-02"
+
+// Record is the usage of one model request.
+type Record struct {
+	Time             time.Time `json:"time"`
+	Session          string    `json:"session"`
+	Channel          string    `json:"channel"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	// Estimated is set when the provider reported no usage and the
+	// tokens were estimated.
+	Estimated bool `json:"estimated,omitempty"`
+	// Cost is in US dollars, at the model's configured price when the
+	// request was made; 0 if it has none.
+	Cost float64 `json:"cost,omitempty"`
+}
+
+// Tracker records model usage in the workspace, one JSON line per request
+// in usage/YYYY-MM-DD.jsonl.
+type Tracker struct {
+	Dir    string
+	Prices map[string]config.ModelPrice
+
+	mu sync.Mutex
+}
+
+// NewTracker creates a Tracker for the workspace. Records name sessions
+// and chats, so they are encrypted at rest like sessions.
+func NewTracker(workspace string, prices map[string]config.ModelPrice) *Tracker {
+	dir := filepath.Join(workspace, "usage")
+	atrest.Protect(dir)
+	return &Tracker{Dir: dir, Prices: prices}
+}
+
+func (t *Tracker) fileFor(day time.Time) string {
+	return filepath.Join(t.Dir, day.Format(dayFormat)+".jsonl")
+}
+
+// Record adds a request's usage, priced if its model has a price.
+func (t *Tracker) Record(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	if price, ok := t.price(r.Model); ok {
+		r.Cost = (float64(r.PromptTokens)*price.Prompt + float64(r.CompletionTokens)*price.Completion) / 1e6
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return err
+	}
+	return atrest.AppendFile(t.fileFor(r.Time), append(line, '\n'), 0644)
+}
+
+// price returns the price of a model: the configured one for the longest
+// prefix of its name, with or without the provider.
+func (t *Tracker) price(model string) (config.ModelPrice, bool) {
+	model = strings.ToLower(model)
+	bare := model[strings.LastIndex(model, "/")+1:]
+	for _, name := range []string{model, bare} {
+		best, found := -1, config.ModelPrice{}
+		for prefix, price := range t.Prices {
+			prefix = strings.ToLower(prefix)
+			if strings.HasPrefix(name, prefix) && len(prefix) > best {
+				best, found = len(prefix), price
+			}
+		}
+		if best >= 0 {
+			return found, true
+		}
+	}
+	return config.ModelPrice{}, false
+}
+
+// Read returns the requests made on the days from first to last, oldest
+// first.
+func (t *Tracker) Read(first, last time.Time) ([]Record, error) {
+	var records []Record
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		data, err := atrest.ReadFile(t.fileFor(day))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			var r Record
+			if json.Unmarshal(scanner.Bytes(), &r) == nil {
+				records = append(records, r)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// Period parses a reporting period, relative to now: "today",
+// "yesterday", "7d" (the last 7 days, today included), "month" (this
+// calendar month) or a date, YYYY-MM-DD. It returns the first and last day.
+func Period(s string, now time.Time) (time.Time, time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "", "today":
+		return today, today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), today.AddDate(0, 0, -1), nil
+	case "month":
+		return today.AddDate(0, 0, 1-today.Day()), today, nil
+	}
+	var days int
+	if _, err := fmt.Sscanf(s, "%dd", &days); err == nil && days > 0 && s == fmt.Sprintf("%dd", days) {
+		return today.AddDate(0, 0, 1-days), today, nil
+	}
+	if day, err := time.ParseInLocation(dayFormat, s, now.Location()); err == nil {
+		return day, day, nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("unknown period %q: use today, yesterday, <n>d, month or YYYY-MM-DD", s)
+}
+
+// Totals adds up the usage of some requests.
+type Totals struct {
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	Estimated        int // Requests whose tokens were estimated
+	Cost             float64
+	Unpriced         int // Requests with no cost, to models without a price
+}
+
+func (t *Totals) add(r Record) {
+	t.Requests++
+	t.PromptTokens += r.PromptTokens
+	t.CompletionTokens += r.CompletionTokens
+	if r.Estimated {
+		t.Estimated++
+	}
+	if r.Cost > 0 {
+		t.Cost += r.Cost
+	} else {
+		t.Unpriced++
+	}
+}
+
+// Groupings a report can be broken down by.
+var Groupings = []string{"day", "channel", "session", "model"}
+
+func groupKey(r Record, by string) string {
+	switch by {
+	case "day":
+		return r.Time.Local().Format(dayFormat)
+	case "channel":
+		return r.Channel
+	case "session":
+		return r.Session
+	case "model":
+		return r.Model
+	}
+	return ""
+}
+
+// Summarize adds up records in all and by the given grouping.
+func Summarize(records []Record, by string) (Totals, map[string]*Totals) {
+	var all Totals
+	groups := make(map[string]*Totals)
+	for _, r := range records {
+		all.add(r)
+		key := groupKey(r, by)
+		if groups[key] == nil {
+			groups[key] = &Totals{}
+		}
+		groups[key].add(r)
+	}
+	return all, groups
+}
+
+// Report describes the usage of records, broken down by the given
+// grouping, largest first.
+func Report(records []Record, by string) string {
+	all, groups := Summarize(records, by)
+	if all.Requests == 0 {
+		return "No model usage was recorded in this period."
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s, %s tokens (%s prompt, %s completion)%s.\n",
+		plural(all.Requests, "model request"), formatTokens(all.PromptTokens+all.CompletionTokens), formatTokens(all.PromptTokens), formatTokens(all.CompletionTokens), costNote(all)))
+	if all.Estimated > 0 {
+		sb.WriteString(fmt.Sprintf("%s not reported by the provider and estimated.\n", plural(all.Estimated, "request")))
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if by == "day" {
+			return keys[i] < keys[j]
+		}
+		a, b := groups[keys[i]], groups[keys[j]]
+		if a.Cost != b.Cost {
+			return a.Cost > b.Cost
+		}
+		return a.PromptTokens+a.CompletionTokens > b.PromptTokens+b.CompletionTokens
+	})
+	sb.WriteString(fmt.Sprintf("\nBy %s:\n", by))
+	for _, k := range keys {
+		g := groups[k]
+		if k == "" {
+			k = "(none)"
+		}
+		sb.WriteString(fmt.Sprintf("- %s: %s, %s tokens%s\n", k, plural(g.Requests, "request"), formatTokens(g.PromptTokens+g.CompletionTokens), costNote(*g)))
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// costNote is ", $1.23" for priced usage, noting requests without a price.
+func costNote(t Totals) string {
+	if t.Unpriced == t.Requests {
+		return ""
+	}
+	note := fmt.Sprintf(", $%.2f", t.Cost)
+	if t.Cost < 1 {
+		note = fmt.Sprintf(", $%.4f", t.Cost)
+	}
+	if t.Unpriced > 0 {
+		note += fmt.Sprintf(" (%s unpriced)", plural(t.Unpriced, "request"))
+	}
+	return note
+}
+
+// formatTokens writes large counts as 12.3k or 4.56M.
+func formatTokens(n int) string {
+	switch {
+	case n >= 1e6:
+		return fmt.Sprintf("%.2fM", float64(n)/1e6)
+	case n >= 1e4:
+		return fmt.Sprintf("%.1fk", float64(n)/1e3)
+	}
+	return fmt.Sprint(n)
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
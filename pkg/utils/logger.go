@@ -84,10 +84,18 @@ func (l *RotatableLogger) Write(p []byte) (n int, err error) {
 	return l.file.Write(p)
 }
 
+// logFile is the file SetupLogger directed the log to.
+var logFile string
+
+// LogFile returns the file the log is written to, or "" before SetupLogger.
+func LogFile() string {
+	return logFile
+}
+
 // SetupLogger configures the global logger to use the rotatable logger.
 func SetupLogger(logDir string) {
 	os.MkdirAll(logDir, 0755)
-	logFile := filepath.Join(logDir, "nanobot.log")
+	logFile = filepath.Join(logDir, "nanobot.log")
 
 	// 10MB limit, 5 backups
 	logger := NewRotatableLogger(logFile, 10*1024*1024, 5)
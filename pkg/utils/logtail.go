@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxLogTail is the most log lines LogTail returns.
+	MaxLogTail = 500
+	// maxLogLineRunes cuts long entries, such as tool results, to a size
+	// that reads on a phone.
+	maxLogLineRunes = 300
+	// maxLogTailChars bounds a tail so it fits in a few chat messages;
+	// older lines are left out.
+	maxLogTailChars = 12000
+)
+
+// LogLevels are the levels log lines can be filtered by, most severe first.
+var LogLevels = []string{"error", "warn", "info"}
+
+// logEntryStart matches the start of an entry: the date and time, then the
+// source file and line the standard logger adds.
+var logEntryStart = regexp.MustCompile(`^\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} (?:([\w.-]+\.go):\d+: )?`)
+
+// LogQuery selects the log lines LogTail returns.
+type LogQuery struct {
+	Lines  int    // The number of lines, the most recent
+	Level  string // Only lines at this level or more severe; "" for all
+	Module string // Only lines logged from source files whose name starts with it, e.g. "feishu"
+}
+
+// LogLevel guesses the level of a log message, which the log does not
+// record, from its wording.
+func LogLevel(message string) string {
+	m := strings.ToLower(message)
+	for _, marker := range []string{"error", "failed", "failure", "panic", "fatal", "cannot", "could not", "unable to"} {
+		if strings.Contains(m, marker) {
+			return "error"
+		}
+	}
+	for _, marker := range []string{"warn", "retrying", "skipping", "dropping", "exceeded", "timed out", "interrupt", "not delivered", "rejected"} {
+		if strings.Contains(m, marker) {
+			return "warn"
+		}
+	}
+	return "info"
+}
+
+func levelRank(level string) int {
+	for i, l := range LogLevels {
+		if l == level {
+			return i
+		}
+	}
+	return len(LogLevels)
+}
+
+// TailLog returns the most recent log lines matching q, oldest first.
+// Messages spanning several lines count as one, shown by their first line.
+func TailLog(q LogQuery) ([]string, error) {
+	if logFile == "" {
+		return nil, fmt.Errorf("the log is not written to a file")
+	}
+	if q.Lines <= 0 {
+		q.Lines = 50
+	}
+	if q.Lines > MaxLogTail {
+		q.Lines = MaxLogTail
+	}
+	if q.Level != "" && levelRank(q.Level) == len(LogLevels) {
+		return nil, fmt.Errorf("unknown level %q: use %s", q.Level, strings.Join(LogLevels, ", "))
+	}
+	module := strings.ToLower(q.Module)
+
+	var matched []string
+	// The rotated file holds the lines before the current one
+	for _, path := range []string{logFile, logFile + ".1"} {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var found []string
+		var entry string
+		var file string
+		keep := func() {
+			if entry == "" {
+				return
+			}
+			message := logEntryStart.ReplaceAllString(entry, "")
+			if q.Level != "" && levelRank(LogLevel(message)) > levelRank(q.Level) {
+				return
+			}
+			if module != "" && !strings.HasPrefix(strings.ToLower(file), module) {
+				return
+			}
+			found = append(found, entry)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			m := logEntryStart.FindStringSubmatch(line)
+			if m == nil {
+				// A continuation of a multi-line message
+				continue
+			}
+			keep()
+			entry, file = shortenLogLine(line), m[1]
+		}
+		keep()
+		matched = append(found, matched...)
+		if len(matched) >= q.Lines {
+			break
+		}
+	}
+	if len(matched) > q.Lines {
+		matched = matched[len(matched)-q.Lines:]
+	}
+	size := 0
+	for i := len(matched) - 1; i >= 0; i-- {
+		size += len(matched[i]) + 1
+		if size > maxLogTailChars {
+			return matched[i+1:], nil
+		}
+	}
+	return matched, nil
+}
+
+func shortenLogLine(line string) string {
+	if utf8.RuneCountInString(line) <= maxLogLineRunes {
+		return line
+	}
+	return string([]rune(line)[:maxLogLineRunes]) + " …"
+}
+
+// LogTail formats the log lines TailLog returns for a chat reply.
+func LogTail(q LogQuery) (string, error) {
+	lines, err := TailLog(q)
+	if err != nil {
+		return "", err
+	}
+	var filters []string
+	if q.Level != "" {
+		filters = append(filters, "level "+q.Level+" and above")
+	}
+	if q.Module != "" {
+		filters = append(filters, "module "+q.Module)
+	}
+	if len(lines) == 0 {
+		if len(filters) > 0 {
+			return fmt.Sprintf("No log lines match (%s).", strings.Join(filters, ", ")), nil
+		}
+		return "The log is empty.", nil
+	}
+	header := fmt.Sprintf("Last %d log lines", len(lines))
+	if len(lines) == 1 {
+		header = "Last log line"
+	}
+	if len(filters) > 0 {
+		header += " (" + strings.Join(filters, ", ") + ")"
+	}
+	return header + ":\n" + strings.Join(lines, "\n"), nil
+}
@@ -7,6 +7,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/HKUDS/nanobot-go/pkg/atrest"
 )
 
 // GetMediaReader returns a ReadCloser for the media, and its filename.
@@ -21,23 +23,63 @@ func GetMediaReader(pathOrURL string) (io.ReadCloser, string, error) {
 			resp.Body.Close()
 			return nil, "", fmt.Errorf("failed to download media: %s", resp.Status)
 		}
-		
+
 		// Try to get filename from URL
 		filename := filepath.Base(pathOrURL)
 		// If URL has query parameters, strip them
 		if idx := strings.Index(filename, "?"); idx != -1 {
 			filename = filename[:idx]
 		}
-		
+
 		if filename == "" || filename == "." || filename == "/" {
 			filename = "downloaded_media"
 		}
 		return resp.Body, filename, nil
 	}
 
-	f, err := os.Open(pathOrURL)
+	// Files such as research reports may be encrypted at rest
+	f, err := atrest.Open(pathOrURL)
 	if err != nil {
 		return nil, "", err
 	}
 	return f, filepath.Base(pathOrURL), nil
 }
+
+// DownloadMedia downloads pathOrURL into dir and returns the local path.
+// Files larger than maxBytes (when > 0) are rejected.
+func DownloadMedia(pathOrURL, dir, filename string, maxBytes int64) (string, error) {
+	reader, name, err := GetMediaReader(pathOrURL)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	if filename == "" {
+		filename = name
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, filepath.Base(filename))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	src := io.Reader(reader)
+	if maxBytes > 0 {
+		src = io.LimitReader(reader, maxBytes+1)
+	}
+	n, err := io.Copy(f, src)
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	if maxBytes > 0 && n > maxBytes {
+		os.Remove(path)
+		return "", fmt.Errorf("media exceeds %d bytes", maxBytes)
+	}
+	return path, nil
+}